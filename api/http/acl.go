@@ -0,0 +1,188 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 访问控制 ====================
+//
+// 多租户部署中按前缀授权：每个 token 被授予若干前缀及其上允许的操作（读 / 写 / 监听）。
+// 启用后，/v1 下的所有请求都需要携带 "Authorization: Bearer <token>"：
+// 缺少或未知的 token 返回 401，访问授权范围之外的 key 或前缀返回 403。
+// 集群操作要求全部 key 上的权限（查看状态需要读权限，转移 Leader 需要全部权限），
+// 没有在 aclRoutes 中列出的 /v1 路由一律拒绝，新增路由必须先声明其访问范围。
+// /health 与 /metrics 不受限制。
+
+// Permission 前缀上允许的操作，可按位组合
+type Permission uint8
+
+const (
+	PermRead  Permission = 1 << iota // 读取 key、前缀扫描
+	PermWrite                        // 写入、删除
+	PermWatch                        // 监听前缀
+
+	PermAll = PermRead | PermWrite | PermWatch
+)
+
+// ACLRule 授予某个前缀上的操作权限
+// 空前缀表示全部 key
+type ACLRule struct {
+	Prefix      string
+	Permissions Permission
+}
+
+// ACLPolicy token 到其授权规则的映射
+type ACLPolicy map[string][]ACLRule
+
+// Allow 判断 token 是否可以对 key 执行 perm 操作
+// 对前缀（扫描、监听）同样适用：只有当前缀完全落在某条规则的前缀之内时才允许，
+// 例如授权 "tenant-a/" 时可以扫描 "tenant-a/orders/"，但不能扫描 "tenant-" 或全部 key
+func (p ACLPolicy) Allow(token string, key string, perm Permission) bool {
+	for _, rule := range p[token] {
+		if rule.Permissions&perm == perm && strings.HasPrefix(key, rule.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithACL 设置按前缀授权的访问控制策略
+func WithACL(policy ACLPolicy) ServerOption {
+	return func(o *ServerOptions) {
+		o.ACL = policy
+	}
+}
+
+// aclScope 描述一个路由访问的 key 范围
+type aclScope struct {
+	perm Permission
+	keys func(c *gin.Context) ([]string, error) // 从请求中取出访问的 key 或前缀
+}
+
+// aclRoutes /v1 下允许访问的路由及其访问范围，未列出的路由返回 403
+var aclRoutes = map[string]aclScope{
+	"/v1/kv/get":              {perm: PermRead, keys: queryKeys("key")},
+	"/v1/kv/consistent_get":   {perm: PermRead, keys: queryKeys("key")},
+	"/v1/admin/entry":         {perm: PermRead, keys: queryKeys("key")},
+	"/v1/kv/access":           {perm: PermRead, keys: queryKeys("key")},
+	"/v1/kv/tree":             {perm: PermRead, keys: queryKeys("prefix")},
+	"/v1/watch":               {perm: PermWatch, keys: queryKeys("prefix")},
+	"/v1/watch/ndjson":        {perm: PermWatch, keys: queryKeys("prefix")},
+	"/v1/kv/delete":           {perm: PermWrite, keys: queryKeys("key")},
+	"/v1/kv/put":              {perm: PermWrite, keys: bodyKeys},
+	"/v1/kv/put_with_session": {perm: PermWrite, keys: bodyKeys},
+	"/v1/kv/batch_put":        {perm: PermWrite, keys: bodyKeys},
+	// 追加写入的 key 由服务端分配，不属于任何租户前缀，需要全部 key 的写权限
+	"/v1/kv/append": {perm: PermWrite, keys: allKeys},
+	// 创建会话不访问任何 key，token 有效即可；会话上的写入由 put_with_session 按 key 授权
+	"/v1/session/create": {keys: noKeys},
+	// 集群操作影响全部 key，只授予管理员
+	"/v1/cluster/status":          {perm: PermRead, keys: allKeys},
+	"/v1/cluster/transfer-leader": {perm: PermAll, keys: allKeys},
+}
+
+// ACLMiddleware 按前缀授权的访问控制中间件
+func ACLMiddleware(policy ACLPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.Request.URL.Path, "/v1/") {
+			c.Next()
+			return
+		}
+
+		token, ok := bearerToken(c.Request)
+		if !ok || len(policy[token]) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing or invalid token",
+			})
+			return
+		}
+
+		scope, ok := aclRoutes[c.FullPath()]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "access denied",
+			})
+			return
+		}
+
+		keys, err := scope.keys(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid request: " + err.Error(),
+			})
+			return
+		}
+		for _, key := range keys {
+			if !policy.Allow(token, key, scope.perm) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "access denied",
+					"key":   key,
+				})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// bearerToken 从 Authorization 请求头中取出 Bearer token
+func bearerToken(r *http.Request) (string, bool) {
+	const scheme = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(scheme):]), true
+}
+
+// queryKeys 从查询参数中取出 key 或前缀，缺省为空字符串（即全部 key）
+func queryKeys(name string) func(c *gin.Context) ([]string, error) {
+	return func(c *gin.Context) ([]string, error) {
+		return []string{c.Query(name)}, nil
+	}
+}
+
+// allKeys 访问全部 key 的路由，以空前缀授权
+func allKeys(*gin.Context) ([]string, error) {
+	return []string{""}, nil
+}
+
+// noKeys 不访问任何 key 的路由
+func noKeys(*gin.Context) ([]string, error) {
+	return nil, nil
+}
+
+// bodyKeys 从 JSON 请求体中取出 key（单个写入）或 items[].key（批量写入）
+// 读取后恢复请求体，供后续的处理函数再次解析
+func bodyKeys(c *gin.Context) ([]string, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req struct {
+		Key   *string `json:"key"`
+		Items []struct {
+			Key string `json:"key"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if req.Key != nil {
+		keys = append(keys, *req.Key)
+	}
+	for _, item := range req.Items {
+		keys = append(keys, item.Key)
+	}
+	return keys, nil
+}
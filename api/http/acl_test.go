@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/forever-free1/TideKV/watch"
+)
+
+func newACLServer(t *testing.T) *Server {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	db.Put([]byte("tenant-a/x"), []byte("1"))
+	db.Put([]byte("tenant-b/x"), []byte("2"))
+
+	policy := ACLPolicy{
+		"token-a":  {{Prefix: "tenant-a/", Permissions: PermAll}},
+		"reader-a": {{Prefix: "tenant-a/", Permissions: PermRead}},
+		"admin":    {{Prefix: "", Permissions: PermAll}},
+	}
+	return NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub(), WithACL(policy))
+}
+
+func aclRequest(server *Server, token string, method string, target string, body string) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	// 监听请求是长连接，超时后结束
+	ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req.WithContext(ctx))
+	return rec.Code
+}
+
+func TestServer_ACL(t *testing.T) {
+	server := newACLServer(t)
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"前缀内读取", "token-a", http.MethodGet, "/v1/kv/get?key=tenant-a/x", "", http.StatusOK},
+		{"前缀外读取", "token-a", http.MethodGet, "/v1/kv/get?key=tenant-b/x", "", http.StatusForbidden},
+		{"前缀内访问时间", "token-a", http.MethodGet, "/v1/kv/access?key=tenant-a/x", "", http.StatusOK},
+		{"前缀外访问时间", "token-a", http.MethodGet, "/v1/kv/access?key=tenant-b/x", "", http.StatusForbidden},
+		{"前缀内写入", "token-a", http.MethodPost, "/v1/kv/put", `{"key":"tenant-a/y","value":"v"}`, http.StatusOK},
+		{"前缀外写入", "token-a", http.MethodPost, "/v1/kv/put", `{"key":"tenant-b/y","value":"v"}`, http.StatusForbidden},
+		{"批量写入跨前缀", "token-a", http.MethodPost, "/v1/kv/batch_put",
+			`{"items":[{"key":"tenant-a/1","value":"v"},{"key":"tenant-b/1","value":"v"}]}`, http.StatusForbidden},
+		{"前缀外删除", "token-a", http.MethodDelete, "/v1/kv/delete?key=tenant-b/x", "", http.StatusForbidden},
+		{"前缀内扫描", "token-a", http.MethodGet, "/v1/kv/tree?prefix=tenant-a/", "", http.StatusOK},
+		{"前缀外扫描", "token-a", http.MethodGet, "/v1/kv/tree?prefix=tenant-b/", "", http.StatusForbidden},
+		{"扫描更宽的前缀", "token-a", http.MethodGet, "/v1/kv/tree?prefix=tenant-", "", http.StatusForbidden},
+		{"扫描全部 key", "token-a", http.MethodGet, "/v1/kv/tree", "", http.StatusForbidden},
+		{"前缀内监听", "token-a", http.MethodGet, "/v1/watch?prefix=tenant-a/", "", http.StatusOK},
+		{"前缀外监听", "token-a", http.MethodGet, "/v1/watch?prefix=tenant-b/", "", http.StatusForbidden},
+		{"监听全部 key", "token-a", http.MethodGet, "/v1/watch", "", http.StatusForbidden},
+		{"只读 token 写入", "reader-a", http.MethodPost, "/v1/kv/put", `{"key":"tenant-a/z","value":"v"}`, http.StatusForbidden},
+		{"只读 token 监听", "reader-a", http.MethodGet, "/v1/watch?prefix=tenant-a/", "", http.StatusForbidden},
+		{"缺少 token", "", http.MethodGet, "/v1/kv/get?key=tenant-a/x", "", http.StatusUnauthorized},
+		{"未知 token", "unknown", http.MethodGet, "/v1/kv/get?key=tenant-a/x", "", http.StatusUnauthorized},
+		{"全部前缀的 token", "admin", http.MethodGet, "/v1/kv/tree", "", http.StatusOK},
+		{"创建会话", "reader-a", http.MethodPost, "/v1/session/create", `{"session_id":"s1"}`, http.StatusOK},
+		{"租户查看集群状态", "token-a", http.MethodGet, "/v1/cluster/status", "", http.StatusForbidden},
+		{"租户转移 Leader", "token-a", http.MethodPost, "/v1/cluster/transfer-leader", `{"target_id":"node-2"}`, http.StatusForbidden},
+		{"未列出的路由", "admin", http.MethodGet, "/v1/unknown", "", http.StatusForbidden},
+		{"健康检查不鉴权", "", http.MethodGet, "/health", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aclRequest(server, tt.token, tt.method, tt.target, tt.body); got != tt.want {
+				t.Fatalf("状态码不匹配: got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 被拒绝的写入不应生效
+	if got := aclRequest(server, "admin", http.MethodGet, "/v1/kv/get?key=tenant-b/y", ""); got != http.StatusNotFound {
+		t.Fatalf("被拒绝的写入不应生效: got %d, want %d", got, http.StatusNotFound)
+	}
+}
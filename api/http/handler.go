@@ -1,13 +1,22 @@
 package http
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/forever-free1/TideKV/raft"
+	"github.com/forever-free1/TideKV/storage"
 	"github.com/forever-free1/TideKV/watch"
+	hraft "github.com/hashicorp/raft"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -25,6 +34,55 @@ type ConsistentNode interface {
 	NewSession(sessionID string)
 }
 
+// StalenessReader 支持有界陈旧度读取的节点（可选能力）
+type StalenessReader interface {
+	GetWithin(key []byte, maxStaleness time.Duration) ([]byte, error)
+}
+
+// AckWriter 支持指定写入确认级别的节点（可选能力）
+type AckWriter interface {
+	PutWithAck(key []byte, value []byte, level raft.AckLevel) error
+}
+
+// AckLevelHeader 指定写入确认级别的请求头：leader / quorum / all
+const AckLevelHeader = "X-Ack-Level"
+
+// DurableHeader 为 true 时写入在得到 AckLevelHeader 指定的确认、并且 Leader 已同步到磁盘后才返回
+const DurableHeader = "X-Durable"
+
+// DurableWriter 支持复制与落盘双重确认写入的节点（可选能力）
+type DurableWriter interface {
+	PutDurable(ctx context.Context, key []byte, value []byte, level raft.AckLevel) error
+}
+
+// IfMatchHeader 指定条件写入期望版本的请求头，优先于 AckLevelHeader
+const IfMatchHeader = "If-Match"
+
+// WatchVersionHeader 指定 Watch 事件格式版本的请求头，查询参数 v 优先；响应中返回实际使用的版本
+const WatchVersionHeader = "X-Watch-Version"
+
+// ClusterStatusProvider 支持查询 Raft 集群状态的节点（可选能力）
+type ClusterStatusProvider interface {
+	ClusterStatus() (*raft.ClusterStatus, error)
+}
+
+// WatchEventSource 自行产生 Watch 事件的节点（可选能力）
+// 例如 Raft 节点在应用日志时产生事件，此时 Handler 不再在写入后通知
+type WatchEventSource interface {
+	EmitsWatchEvents() bool
+}
+
+// ReadinessReporter 报告是否已就绪、可以提供读取的节点（可选能力）
+// 未就绪时健康检查返回 503，便于负载均衡器摘除流量
+type ReadinessReporter interface {
+	Ready() bool
+}
+
+// LeadershipTransferer 支持主动转移 Leadership 的节点（可选能力）
+type LeadershipTransferer interface {
+	TransferLeadership(targetID hraft.ServerID) error
+}
+
 // Handler HTTP 请求处理器
 type Handler struct {
 	// 存储引擎（通过 Raft Node 封装）
@@ -32,8 +90,24 @@ type Handler struct {
 
 	// 事件通知中心
 	watchHub *watch.WatchHub
+
+	// Watch 长连接的心跳间隔与事件缓冲区大小
+	sseHeartbeat    time.Duration
+	watchBufferSize int
+
+	// 按客户端 IP 的 Watch 连接数限制，为 nil 时不限制
+	watchLimits        *watchLimiter
+	trustedProxyHeader string
 }
 
+const (
+	// defaultSSEHeartbeat Watch 长连接的默认心跳间隔
+	defaultSSEHeartbeat = 30 * time.Second
+
+	// defaultWatchBufferSize 每个 Watch 连接的默认事件缓冲区大小
+	defaultWatchBufferSize = 1000
+)
+
 // NewHandler 创建新的 Handler
 //
 // 参数：
@@ -44,8 +118,10 @@ type Handler struct {
 //   - *Handler: Handler 实例
 func NewHandler(node ConsistentNode, watchHub *watch.WatchHub) *Handler {
 	return &Handler{
-		node:      node,
-		watchHub:  watchHub,
+		node:            node,
+		watchHub:        watchHub,
+		sseHeartbeat:    defaultSSEHeartbeat,
+		watchBufferSize: defaultWatchBufferSize,
 	}
 }
 
@@ -62,6 +138,9 @@ func (h *Handler) RegisterRoutes(engine *gin.Engine) {
 	// Prometheus Metrics 端点
 	engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// 内存占用估算
+	engine.GET("/stats", h.Stats)
+
 	// KV 存储 API
 	v1 := engine.Group("/v1")
 	{
@@ -70,8 +149,11 @@ func (h *Handler) RegisterRoutes(engine *gin.Engine) {
 			kv.POST("/put", h.Put)
 			kv.POST("/put_with_session", h.PutWithSession)
 			kv.POST("/batch_put", h.BatchPut)
+			kv.POST("/append", h.Append)
 			kv.GET("/get", h.Get)
 			kv.GET("/consistent_get", h.ConsistentGet)
+			kv.GET("/tree", h.Tree)
+			kv.GET("/access", h.LastAccess)
 			kv.DELETE("/delete", h.Delete)
 		}
 
@@ -80,13 +162,33 @@ func (h *Handler) RegisterRoutes(engine *gin.Engine) {
 
 		// Watch API (SSE 长连接)
 		v1.GET("/watch", h.Watch)
+		v1.GET("/watch/ndjson", h.WatchNDJSON)
+
+		// 集群状态
+		v1.GET("/cluster/status", h.ClusterStatus)
+		v1.POST("/cluster/transfer-leader", h.TransferLeader)
+
+		// 管理与诊断 API
+		admin := v1.Group("/admin")
+		{
+			admin.GET("/entry", h.AdminEntry)
+		}
 	}
 }
 
 // ==================== API 处理函数 ====================
 
 // HealthCheck 健康检查
+// 节点实现 ReadinessReporter 且尚未就绪时返回 503
 func (h *Handler) HealthCheck(c *gin.Context) {
+	if reporter, ok := h.node.(ReadinessReporter); ok && !reporter.Ready() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "not ready",
+			"time":   time.Now().Unix(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
 		"time":   time.Now().Unix(),
@@ -110,6 +212,33 @@ func (h *Handler) Put(c *gin.Context) {
 		return
 	}
 
+	// 指定了 If-Match 时按版本条件写入
+	if raw := c.GetHeader(IfMatchHeader); raw != "" {
+		h.putIfVersion(c, req.Key, req.Value, raw)
+		return
+	}
+
+	// 要求落盘时按确认级别写入并同步
+	if raw := c.GetHeader(DurableHeader); raw != "" {
+		durable, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid " + DurableHeader + ": " + raw,
+			})
+			return
+		}
+		if durable {
+			h.putDurable(c, req.Key, req.Value, c.GetHeader(AckLevelHeader))
+			return
+		}
+	}
+
+	// 指定了确认级别时按级别写入
+	if raw := c.GetHeader(AckLevelHeader); raw != "" {
+		h.putWithAck(c, req.Key, req.Value, raw)
+		return
+	}
+
 	// 写入存储
 	err := h.node.Put([]byte(req.Key), []byte(req.Value))
 	if err != nil {
@@ -126,6 +255,170 @@ func (h *Handler) Put(c *gin.Context) {
 	})
 }
 
+// putIfVersion 按 If-Match 请求头中的版本条件写入
+// 版本即最后一次写入该 key 的 Raft 日志索引（所有节点上相同），可从 ETag 响应头或 /v1/admin/entry 获取；
+// "0" 表示仅当 key 不存在时写入
+func (h *Handler) putIfVersion(c *gin.Context, key string, value string, raw string) {
+	expected, err := parseETag(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid " + IfMatchHeader + ": " + err.Error(),
+		})
+		return
+	}
+
+	writer, ok := h.node.(storage.VersionedWriter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "conditional put not supported",
+		})
+		return
+	}
+
+	seq, written, err := writer.PutIfVersion([]byte(key), []byte(value), expected)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotSupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "conditional put not supported",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "put failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.Header("ETag", formatETag(seq))
+	if !written {
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":   "version mismatch",
+			"key":     key,
+			"version": seq,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ok",
+		"key":     key,
+		"version": seq,
+	})
+}
+
+// parseETag 解析 If-Match 中的版本号，接受带引号（"42"）与不带引号（42）两种形式
+func parseETag(raw string) (uint64, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		raw = raw[1 : len(raw)-1]
+	}
+	return strconv.ParseUint(raw, 10, 64)
+}
+
+// formatETag 将版本号格式化为 ETag
+func formatETag(seq uint64) string {
+	return `"` + strconv.FormatUint(seq, 10) + `"`
+}
+
+// putWithAck 按请求头指定的确认级别写入
+func (h *Handler) putWithAck(c *gin.Context, key string, value string, raw string) {
+	level, err := raft.ParseAckLevel(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid " + AckLevelHeader + ": " + err.Error(),
+		})
+		return
+	}
+
+	writer, ok := h.node.(AckWriter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "ack level not supported",
+		})
+		return
+	}
+
+	if err := writer.PutWithAck([]byte(key), []byte(value), level); err != nil {
+		switch {
+		case errors.Is(err, raft.ErrAckTimeout):
+			// 写入已提交，只是未在超时前得到全部确认
+			c.JSON(http.StatusGatewayTimeout, gin.H{
+				"error": "put committed but not acknowledged: " + err.Error(),
+			})
+		case errors.Is(err, raft.ErrAckUnavailable):
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "ack level not supported: " + err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "put failed: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "ok",
+		"key":       key,
+		"ack_level": level.String(),
+	})
+}
+
+// putDurable 按确认级别写入，并等待 Leader 同步到磁盘
+// raw 为空时使用默认的 quorum 级别
+func (h *Handler) putDurable(c *gin.Context, key string, value string, raw string) {
+	level := raft.AckQuorum
+	if raw != "" {
+		var err error
+		if level, err = raft.ParseAckLevel(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid " + AckLevelHeader + ": " + err.Error(),
+			})
+			return
+		}
+	}
+	if level == raft.AckLeader {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": DurableHeader + " requires ack level quorum or all",
+		})
+		return
+	}
+
+	writer, ok := h.node.(DurableWriter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "durable put not supported",
+		})
+		return
+	}
+
+	if err := writer.PutDurable(c.Request.Context(), []byte(key), []byte(value), level); err != nil {
+		switch {
+		case errors.Is(err, raft.ErrAckTimeout), errors.Is(err, context.DeadlineExceeded):
+			// 写入可能已提交，只是未在超时前得到全部确认
+			c.JSON(http.StatusGatewayTimeout, gin.H{
+				"error": "put not acknowledged: " + err.Error(),
+			})
+		case errors.Is(err, raft.ErrAckUnavailable), errors.Is(err, storage.ErrNotSupported):
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "durable put not supported: " + err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "put failed: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "ok",
+		"key":       key,
+		"ack_level": level.String(),
+		"durable":   true,
+	})
+}
+
 // PutWithSession 请求处理
 // POST /v1/kv/put_with_session
 // 带 session 跟踪的写入，返回 Raft index
@@ -161,6 +454,50 @@ func (h *Handler) PutWithSession(c *gin.Context) {
 	})
 }
 
+// Append 请求处理
+// POST /v1/kv/append
+// 追加写入，由服务端分配单调递增的 key 并在响应中返回
+func (h *Handler) Append(c *gin.Context) {
+	type AppendRequest struct {
+		Value string `json:"value" binding:"required"`
+	}
+
+	var req AppendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	appender, ok := h.node.(storage.Appender)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "append not supported",
+		})
+		return
+	}
+
+	key, err := appender.Append([]byte(req.Value))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotSupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "append not supported",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "append failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ok",
+		"key":     string(key),
+	})
+}
+
 // BatchPutItem 批量写入的单个项
 type BatchPutItem struct {
 	Key   string `json:"key" binding:"required"`
@@ -202,6 +539,12 @@ func (h *Handler) BatchPut(c *gin.Context) {
 
 	// 批量写入
 	err := h.node.BatchPut(items)
+	if errors.Is(err, raft.ErrDuplicateKeyInBatch) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "duplicate key in batch",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "batch put failed: " + err.Error(),
@@ -217,7 +560,8 @@ func (h *Handler) BatchPut(c *gin.Context) {
 }
 
 // Get 请求处理
-// GET /v1/kv/get?key=xxx
+// GET /v1/kv/get?key=xxx[&max_staleness=500ms]
+// 指定 max_staleness 时进行有界陈旧度读取
 func (h *Handler) Get(c *gin.Context) {
 	// 获取查询参数
 	key := c.Query("key")
@@ -228,8 +572,19 @@ func (h *Handler) Get(c *gin.Context) {
 		return
 	}
 
+	if raw := c.Query("max_staleness"); raw != "" {
+		h.getWithin(c, key, raw)
+		return
+	}
+
 	// 读取数据
 	value, err := h.node.Get([]byte(key))
+	if errors.Is(err, raft.ErrNotReady) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "key not found",
@@ -244,6 +599,49 @@ func (h *Handler) Get(c *gin.Context) {
 	})
 }
 
+// getWithin 有界陈旧度读取
+func (h *Handler) getWithin(c *gin.Context, key string, raw string) {
+	maxStaleness, err := time.ParseDuration(raw)
+	if err != nil || maxStaleness < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid max_staleness: " + raw,
+		})
+		return
+	}
+
+	reader, ok := h.node.(StalenessReader)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "bounded staleness reads not supported",
+		})
+		return
+	}
+
+	value, err := reader.GetWithin([]byte(key), maxStaleness)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrKeyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "key not found",
+			})
+		case errors.Is(err, raft.ErrStaleRead), errors.Is(err, raft.ErrNotReady):
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "get failed: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":   key,
+		"value": string(value),
+	})
+}
+
 // ConsistentGet 请求处理
 // GET /v1/kv/consistent_get?session_id=xxx&key=xxx
 // 一致性读，等待 session 的 lastIndex 被应用后再读取
@@ -266,6 +664,12 @@ func (h *Handler) ConsistentGet(c *gin.Context) {
 
 	// 读取数据（一致性）
 	value, err := h.node.ConsistentGet(sessionID, []byte(key))
+	if errors.Is(err, raft.ErrNotReady) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "key not found",
@@ -280,6 +684,298 @@ func (h *Handler) ConsistentGet(c *gin.Context) {
 	})
 }
 
+// defaultHistogramBuckets /stats 中 key 分布的默认区间数量
+const defaultHistogramBuckets = 16
+
+// Stats 请求处理
+// GET /stats?buckets=N
+// 返回本地索引与布隆过滤器的内存占用估算值（字节），节点不支持时返回 501；
+// 节点支持时同时返回 key 在键空间上按首字节划分的 N 个区间（默认 16，最多 256）中的分布，
+// 以及 key 数量的估算值（可得到时附带精确值）
+func (h *Handler) Stats(c *gin.Context) {
+	buckets := defaultHistogramBuckets
+	if raw := c.Query("buckets"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 256 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "buckets must be an integer between 1 and 256",
+			})
+			return
+		}
+		buckets = n
+	}
+
+	reporter, ok := h.node.(storage.MemoryReporter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "memory stats not supported",
+		})
+		return
+	}
+
+	stats, err := reporter.MemoryStats()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotSupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "memory stats not supported",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "stats failed: " + err.Error(),
+		})
+		return
+	}
+
+	resp := gin.H{
+		"memory": gin.H{
+			"index":     stats.Index,
+			"bloom":     stats.Bloom,
+			"suffix":    stats.Suffix,
+			"hot_tier":  stats.HotTier,
+			"warm_tier": stats.WarmTier,
+			"cold_tier": stats.ColdTier,
+			"total":     stats.Total,
+		},
+	}
+
+	if reporter, ok := h.node.(storage.KeyDistributionReporter); ok {
+		dist, err := reporter.KeyDistribution(buckets)
+		switch {
+		case err == nil:
+			histogram := gin.H{"buckets": bucketsJSON(dist.Buckets)}
+			if dist.ColdTier != nil {
+				histogram["hot_tier"] = bucketsJSON(dist.HotTier)
+				histogram["warm_tier"] = bucketsJSON(dist.WarmTier)
+				histogram["cold_tier"] = bucketsJSON(dist.ColdTier)
+			}
+			resp["key_histogram"] = histogram
+		case !errors.Is(err, storage.ErrNotSupported):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "stats failed: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if counter, ok := h.node.(storage.KeyCounter); ok {
+		count, err := counter.KeyCount()
+		switch {
+		case err == nil:
+			keys := gin.H{"estimate": count.Estimate}
+			if count.Exact >= 0 {
+				keys["exact"] = count.Exact
+			}
+			resp["keys"] = keys
+		case !errors.Is(err, storage.ErrNotSupported):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "stats failed: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// bucketsJSON 将 key 分布的区间转换为 JSON，区间边界以两位十六进制表示首字节
+func bucketsJSON(buckets []storage.BucketStat) []gin.H {
+	result := make([]gin.H, 0, len(buckets))
+	for _, b := range buckets {
+		result = append(result, gin.H{
+			"low":       fmt.Sprintf("%02x", b.Low),
+			"high":      fmt.Sprintf("%02x", b.High),
+			"keys":      b.Keys,
+			"key_bytes": b.KeyBytes,
+		})
+	}
+	return result
+}
+
+// LastAccess 请求处理
+// GET /v1/kv/access?key=xxx
+// 返回 key 最近一次被访问的时间，从未被读取的 key 返回写入时间，节点不支持时返回 501
+func (h *Handler) LastAccess(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "key is required",
+		})
+		return
+	}
+
+	reporter, ok := h.node.(storage.AccessTimeReporter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "access time not supported",
+		})
+		return
+	}
+
+	last, ok := reporter.LastAccess([]byte(key))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "key not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":                   key,
+		"last_access":           last.Format(time.RFC3339Nano),
+		"last_access_unix_nano": last.UnixNano(),
+	})
+}
+
+// AdminEntry 请求处理
+// GET /v1/admin/entry?key=xxx
+// 返回 key 当前对应 Entry 的元数据，节点不支持诊断时返回 501
+func (h *Handler) AdminEntry(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "key is required",
+		})
+		return
+	}
+
+	inspector, ok := h.node.(storage.EntryInspector)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "entry inspection not supported",
+		})
+		return
+	}
+
+	meta, err := inspector.EntryMeta([]byte(key))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrKeyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "key not found",
+			})
+		case errors.Is(err, storage.ErrNotSupported):
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "entry inspection not supported",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "inspect failed: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":       key,
+		"file_id":   meta.FileID,
+		"offset":    meta.Offset,
+		"size":      meta.Size,
+		"timestamp": meta.Timestamp,
+		"seq":       meta.Seq,
+		"crc":       meta.CRC,
+		"type":      meta.Type,
+		"tier":      meta.Tier,
+	})
+}
+
+// ClusterStatus 请求处理
+// GET /v1/cluster/status
+// 返回本节点视角的 Raft 集群状态，节点不支持时返回 501
+func (h *Handler) ClusterStatus(c *gin.Context) {
+	provider, ok := h.node.(ClusterStatusProvider)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "cluster status not supported",
+		})
+		return
+	}
+
+	status, err := provider.ClusterStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "cluster status failed: " + err.Error(),
+		})
+		return
+	}
+
+	servers := make([]gin.H, 0, len(status.Servers))
+	for _, server := range status.Servers {
+		servers = append(servers, gin.H{
+			"id":        server.ID,
+			"address":   server.Address,
+			"suffrage":  server.Suffrage,
+			"is_leader": server.IsLeader,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"node_id": status.NodeID,
+		"state":   status.State,
+		"term":    status.Term,
+		"leader": gin.H{
+			"id":      status.LeaderID,
+			"address": status.LeaderAddress,
+		},
+		"servers":        servers,
+		"applied_index":  status.AppliedIndex,
+		"commit_index":   status.CommitIndex,
+		"last_log_index": status.LastLogIndex,
+		"last_log_term":  status.LastLogTerm,
+		"last_snapshot": gin.H{
+			"index": status.LastSnapshotIndex,
+			"term":  status.LastSnapshotTerm,
+		},
+	})
+}
+
+// TransferLeader 请求处理
+// POST /v1/cluster/transfer-leader
+// 将 Leadership 转移给指定的 voter，未指定 target_id 时由 Raft 选择；只能在 Leader 上调用
+func (h *Handler) TransferLeader(c *gin.Context) {
+	transferer, ok := h.node.(LeadershipTransferer)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "leadership transfer not supported",
+		})
+		return
+	}
+
+	type TransferLeaderRequest struct {
+		TargetID string `json:"target_id"`
+	}
+
+	// 请求体可以为空
+	var req TransferLeaderRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	err := transferer.TransferLeadership(hraft.ServerID(req.TargetID))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"target_id": req.TargetID,
+		})
+	case errors.Is(err, hraft.ErrNotLeader):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "not the leader",
+		})
+	case errors.Is(err, raft.ErrUnknownServer), errors.Is(err, raft.ErrNotVoter):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "leadership transfer failed: " + err.Error(),
+		})
+	}
+}
+
 // CreateSession 请求处理
 // POST /v1/session/create
 // 创建新的会话
@@ -317,11 +1013,8 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
-	// 先获取旧值（用于事件通知）
-	prevValue, _ := h.node.Get([]byte(key))
-
-	// 删除数据
-	err := h.node.Delete([]byte(key))
+	// 删除数据，同时取得旧值用于事件通知
+	prevValue, found, err := h.deleteReturning([]byte(key))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "delete failed: " + err.Error(),
@@ -330,8 +1023,9 @@ func (h *Handler) Delete(c *gin.Context) {
 	}
 
 	// 【挂载点】通知 Watch 客户端
-	// 在 Delete 操作成功后，触发 WatchHub 的通知
-	if h.watchHub != nil {
+	// 在 Delete 操作成功后，触发 WatchHub 的通知；key 原本不存在时没有变更，不通知
+	// 节点自行产生事件时由其负责通知
+	if h.watchHub != nil && found && !h.nodeEmitsWatchEvents() {
 		h.watchHub.NotifyDelete(key, string(prevValue))
 	}
 
@@ -342,14 +1036,224 @@ func (h *Handler) Delete(c *gin.Context) {
 	})
 }
 
+// nodeEmitsWatchEvents 节点是否自行产生 Watch 事件
+func (h *Handler) nodeEmitsWatchEvents() bool {
+	source, ok := h.node.(WatchEventSource)
+	return ok && source.EmitsWatchEvents()
+}
+
+// deleteReturning 删除 key 并返回删除前的值及 key 是否存在
+// 节点支持 storage.DeleteReturner 时读取与删除原子完成，否则先读取再删除
+func (h *Handler) deleteReturning(key []byte) ([]byte, bool, error) {
+	if deleter, ok := h.node.(storage.DeleteReturner); ok {
+		prev, err := deleter.DeleteReturning(key)
+		switch {
+		case err == nil:
+			return prev, true, nil
+		case errors.Is(err, storage.ErrKeyNotFound):
+			return nil, false, nil
+		case !errors.Is(err, storage.ErrNotSupported):
+			return nil, false, err
+		}
+	}
+
+	prev, err := h.node.Get(key)
+	found := err == nil
+	if err := h.node.Delete(key); err != nil {
+		return nil, false, err
+	}
+	return prev, found, nil
+}
+
 // ==================== Watch (SSE) ====================
+//
+// Watch 的每一帧都带有 SSE 的 event 字段，客户端可据此构建状态机：
+//
+//	snapshot      快照中的一个键值对（type 为 put），仅在 snapshot=true 时发送，按 key 升序
+//	snapshot-end  快照结束，data 为 {"count": N}；此后的帧都是实时变更
+//	change        实时变更事件
+//	changes       batch 窗口内就绪的多个实时变更，data 为事件 JSON 数组，按提交顺序排列
+//	error         推送过程中的错误，data 为 {"error": "..."}；事件被丢弃时附带 dropped，客户端应重新获取快照
+//	close         服务端主动结束推送，data 为 {"reason": "limit" | "closed"}
+//
+// 连接在没有 close 帧的情况下断开，说明是网络或进程异常，客户端应重连。
+// 快照在注册 Watcher 之后读取，读取期间的变更在 snapshot-end 之后作为 change 推送，可能已包含在快照中。
+
+// Watch 帧的 SSE event 类型
+const (
+	SSEEventSnapshot    = "snapshot"
+	SSEEventSnapshotEnd = "snapshot-end"
+	SSEEventChange      = "change"
+	SSEEventChanges     = "changes"
+	SSEEventError       = "error"
+	SSEEventClose       = "close"
+)
+
+// Watch 结束推送的原因（close 帧的 reason）
+const (
+	WatchCloseLimit  = "limit"  // 已推送 limit 个事件
+	WatchCloseClosed = "closed" // Watcher 被服务端关闭（例如 CloseMatching 或服务器关闭）
+)
+
+const (
+	// maxWatchBatchWindow batch 窗口的上限，窗口越长事件的推送延迟越大
+	maxWatchBatchWindow = time.Second
+
+	// watchBatchMaxEvents 一个 changes 帧最多包含的事件数，达到后立即发送
+	watchBatchMaxEvents = 256
+)
+
+// watchRequest Watch 请求的参数，SSE 与 NDJSON 两种推送方式共用
+type watchRequest struct {
+	prefix   string
+	pred     watch.EventPredicate
+	snapshot bool
+	reader   storage.PrefixMapReader // snapshot 为 true 时用于读取快照
+	encoding string
+	version  int // 事件格式版本，见 watch.ForVersion
+	limit    int
+	batch    time.Duration
+}
+
+// parseWatchRequest 解析 Watch 请求的查询参数，参数不合法时写入错误响应并返回 false
+func (h *Handler) parseWatchRequest(c *gin.Context) (*watchRequest, bool) {
+	req := &watchRequest{}
+
+	// 获取要监听的前缀
+	req.prefix = c.DefaultQuery("prefix", "")
+
+	// 服务端过滤条件
+	var preds []watch.EventPredicate
+	if substr, ok := c.GetQuery("contains"); ok {
+		preds = append(preds, watch.ValueContains(substr))
+	}
+	field, hasField := c.GetQuery("field")
+	equals, hasEquals := c.GetQuery("equals")
+	if hasField != hasEquals || (hasField && field == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "field and equals must be specified together",
+		})
+		return nil, false
+	}
+	if hasField {
+		preds = append(preds, watch.FieldEquals(field, equals))
+	}
+	req.pred = watch.AllOf(preds...)
+
+	if raw := c.Query("snapshot"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid snapshot: " + raw,
+			})
+			return nil, false
+		}
+		req.snapshot = v
+	}
+	if req.snapshot {
+		var ok bool
+		if req.reader, ok = h.node.(storage.PrefixMapReader); !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "watch snapshot not supported",
+			})
+			return nil, false
+		}
+	}
+
+	// 事件编码方式，默认为原始字符串以保持兼容
+	req.encoding = c.Query("encoding")
+	if req.encoding != "" && req.encoding != watch.EncodingBase64 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unsupported encoding: " + req.encoding,
+		})
+		return nil, false
+	}
+
+	// 事件格式版本，默认为最新版本
+	raw := c.Query("v")
+	if raw == "" {
+		raw = c.GetHeader(WatchVersionHeader)
+	}
+	version, err := watch.ParseEventVersion(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unsupported event version: " + raw,
+		})
+		return nil, false
+	}
+	req.version = version
+	c.Header(WatchVersionHeader, strconv.Itoa(version))
+
+	// 最多推送的事件数量，0 表示不限制
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid limit: " + raw,
+			})
+			return nil, false
+		}
+		req.limit = n
+	}
+
+	// 合并变更的窗口，0 表示逐个发送
+	if raw := c.Query("batch"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 || d > maxWatchBatchWindow {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid batch: " + raw,
+			})
+			return nil, false
+		}
+		req.batch = d
+	}
+
+	return req, true
+}
+
+// watchSnapshot 读取快照，失败时写入错误响应并返回 false
+// 必须在注册 Watcher 之后调用，保证不会遗漏快照与实时事件之间的变更
+func (h *Handler) watchSnapshot(c *gin.Context, req *watchRequest) (map[string][]byte, bool) {
+	pairs, err := req.reader.GetPrefixAsMap([]byte(req.prefix))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrNotSupported):
+			status = http.StatusNotImplemented
+		case errors.Is(err, raft.ErrNotReady):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"error": "watch snapshot failed: " + err.Error(),
+		})
+		return nil, false
+	}
+	return pairs, true
+}
 
 // Watch 处理 Watch 请求
-// GET /v1/watch?prefix=xxx
-// 使用 Server-Sent Events (SSE) 实现长连接
+// GET /v1/watch?prefix=xxx&limit=N&encoding=base64&snapshot=true&contains=xxx&field=status&equals=error&batch=20ms&v=2
+// 使用 Server-Sent Events (SSE) 实现长连接；指定 limit 时推送 N 个实时事件后关闭连接（快照不计入）。
+// 指定 encoding=base64 时事件的 key / value 以 base64 编码，用于二进制数据。
+// 指定 snapshot=true 时先推送前缀下的当前数据，节点不支持前缀读取时返回 501。
+// 指定 contains 时只推送 value 包含该子串的事件；指定 field 与 equals 时只推送 value 为 JSON 且该字段等于 equals 的事件，
+// 两者同时指定时都要满足。过滤对快照同样生效，被过滤的事件不计入 limit。
+// 指定 batch（例如 batch=20ms）时，收到一个变更后最多等待该时长，把期间就绪的变更合并为一个 changes 帧；
+// 窗口内只有一个变更时仍以 change 帧发送。恢复时以数组中最后一个事件的 seq 为准。
+// 指定 v（或 X-Watch-Version 请求头）时按该版本的格式序列化事件，默认为最新版本，见 watch.ForVersion
 func (h *Handler) Watch(c *gin.Context) {
-	// 获取要监听的前缀
-	prefix := c.DefaultQuery("prefix", "")
+	req, ok := h.parseWatchRequest(c)
+	if !ok {
+		return
+	}
+	prefix, pred, encoding, limit, batchWindow := req.prefix, req.pred, req.encoding, req.limit, req.batch
+
+	// 按客户端 IP 限制连接数，连接结束时释放名额
+	release, ok := h.acquireWatch(c)
+	if !ok {
+		return
+	}
+	defer release()
 
 	// 设置响应头
 	c.Header("Content-Type", "text/event-stream")
@@ -358,13 +1262,21 @@ func (h *Handler) Watch(c *gin.Context) {
 	c.Header("X-Accel-Buffering", "no")
 
 	// 注册 Watcher
-	// 使用较大的缓冲区以支持高并发场景
-	watcher := h.watchHub.Watch(prefix, 1000)
+	// 缓冲区大小见 WithWatchBufferSize，默认较大以支持高并发场景
+	watcher := h.watchHub.WatchIf(prefix, pred, h.watchBufferSize, watch.WithMaxEvents(limit))
 	defer h.watchHub.Unregister(watcher)
 
+	// 注册之后再读取快照，保证不会遗漏快照与实时事件之间的变更
+	var pairs map[string][]byte
+	if req.snapshot {
+		if pairs, ok = h.watchSnapshot(c, req); !ok {
+			return
+		}
+	}
+
 	// 创建客户端断开连接的检测
 	clientGone := c.Request.Context().Done()
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(h.sseHeartbeat)
 	defer ticker.Stop()
 
 	// 开始推送事件
@@ -381,43 +1293,151 @@ func (h *Handler) Watch(c *gin.Context) {
 	fmt.Fprintf(c.Writer, ": connected\n\n")
 	flusher.Flush()
 
+	// writeEvent 按编码方式发送一个事件帧，序列化失败时发送 error 帧
+	writeEvent := func(name string, event *watch.Event) {
+		if encoding == watch.EncodingBase64 {
+			event = event.EncodeBase64()
+		}
+		event = event.ForVersion(req.version)
+		data, err := watch.EventToJSON(event)
+		if err != nil {
+			writeSSE(c.Writer, SSEEventError, gin.H{"error": "encode event failed: " + err.Error(), "key": event.Key})
+			return
+		}
+		fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", name, data)
+	}
+
+	if req.snapshot {
+		keys := make([]string, 0, len(pairs))
+		for key := range pairs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		count := 0
+		for _, key := range keys {
+			event := &watch.Event{Type: watch.EventPut, Key: key, Value: string(pairs[key])}
+			if pred != nil && !pred(event) {
+				continue
+			}
+			writeEvent(SSEEventSnapshot, event)
+			count++
+		}
+		writeSSE(c.Writer, SSEEventSnapshotEnd, gin.H{"count": count})
+		flusher.Flush()
+	}
+
+	// writeBatch 将多个事件作为一个 changes 帧发送，只有一个事件时发送 change 帧
+	writeBatch := func(events []*watch.Event) {
+		if len(events) == 1 {
+			writeEvent(SSEEventChange, events[0])
+			return
+		}
+		for i, event := range events {
+			if encoding == watch.EncodingBase64 {
+				event = event.EncodeBase64()
+			}
+			events[i] = event.ForVersion(req.version)
+		}
+		data, err := json.Marshal(events)
+		if err != nil {
+			writeSSE(c.Writer, SSEEventError, gin.H{"error": "encode events failed: " + err.Error()})
+			return
+		}
+		fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", SSEEventChanges, data)
+	}
+
+	sent := 0
+	var dropped int64
 	for {
 		select {
 		case <-clientGone:
 			// 客户端断开连接
 			return
 
-		case event := <-watcher.Ch:
-			// 发送事件
-			data, err := watch.EventToJSON(event)
-			if err != nil {
-				continue
+		case event, ok := <-watcher.Ch:
+			// Watcher 被服务端关闭（例如 CloseMatching）或已推送 limit 个事件，结束推送
+			open := ok
+			if ok {
+				events := []*watch.Event{event}
+				if batchWindow > 0 {
+					events, open = collectWatchBatch(watcher.Ch, events, batchWindow, clientGone)
+				}
+				// 发送事件
+				writeBatch(events)
+				sent += len(events)
+				flusher.Flush()
+			}
+			if !open {
+				reason := WatchCloseClosed
+				if limit > 0 && sent >= limit {
+					reason = WatchCloseLimit
+				}
+				writeSSE(c.Writer, SSEEventClose, gin.H{"reason": reason})
+				flusher.Flush()
+				return
 			}
-			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
-			flusher.Flush()
 
 		case <-ticker.C:
 			// 发送心跳，保持连接
 			fmt.Fprintf(c.Writer, ": heartbeat\n\n")
 			flusher.Flush()
 		}
+
+		// 缓冲区已满时事件被丢弃，客户端看到的状态不再完整
+		if n := watcher.Dropped(); n > dropped {
+			dropped = n
+			writeSSE(c.Writer, SSEEventError, gin.H{"error": "events dropped", "dropped": n})
+			flusher.Flush()
+		}
 	}
 }
 
+// collectWatchBatch 在 window 内继续从 ch 接收事件追加到 events 之后
+// 窗口结束、达到 watchBatchMaxEvents 或客户端断开时返回；ch 被关闭时 open 为 false
+func collectWatchBatch(ch <-chan *watch.Event, events []*watch.Event, window time.Duration, gone <-chan struct{}) ([]*watch.Event, bool) {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	for len(events) < watchBatchMaxEvents {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events, false
+			}
+			events = append(events, event)
+		case <-timer.C:
+			return events, true
+		case <-gone:
+			return events, true
+		}
+	}
+	return events, true
+}
+
+// writeSSE 发送一个带 event 类型的 SSE 帧，data 为 JSON
+func writeSSE(w io.Writer, name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+}
+
 // ==================== 服务器启动 ====================
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Addr   string
-	TLS    *TLSConfig // TLS 配置（可选）
+	Addr string
+	TLS  *TLSConfig // TLS 配置（可选）
 }
 
 // Server HTTP 服务器
 type Server struct {
 	addr    string
 	engine  *gin.Engine
+	root    http.Handler // 处理全部请求的入口：engine，启用请求超时时外面再包一层
 	handler *Handler
 	tlsCfg  *TLSConfig
+	options *ServerOptions
 }
 
 // TLSConfig TLS 配置
@@ -433,39 +1453,60 @@ type TLSConfig struct {
 }
 
 // NewServer 创建新的 Server
-func NewServer(cfg ServerConfig, node ConsistentNode, watchHub *watch.WatchHub) *Server {
+func NewServer(cfg ServerConfig, node ConsistentNode, watchHub *watch.WatchHub, opts ...ServerOption) *Server {
+	options := defaultServerOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
 
+	// 访问日志（可选），需在注册路由前挂载
+	if options.AccessLog {
+		engine.Use(AccessLogMiddleware(options.Logger))
+	}
+
+	// 按前缀授权（可选），在访问日志之后挂载，被拒绝的请求同样会记录
+	if options.ACL != nil {
+		engine.Use(ACLMiddleware(options.ACL))
+	}
+
 	handler := NewHandler(node, watchHub)
+	handler.sseHeartbeat = options.SSEHeartbeat
+	handler.watchBufferSize = options.WatchBufferSize
+	handler.watchLimits = newWatchLimiter(options.WatchLimitPerIP)
+	handler.trustedProxyHeader = options.TrustedProxyHeader
 	handler.RegisterRoutes(engine)
 
 	return &Server{
 		addr:    cfg.Addr,
 		engine:  engine,
+		root:    newTimeoutHandler(engine, options.RequestTimeout),
 		handler: handler,
 		tlsCfg:  cfg.TLS,
+		options: options,
 	}
 }
 
 // NewServerWithTLS 创建支持 TLS 的 Server
-func NewServerWithTLS(addr string, tlsCfg *TLSConfig, node ConsistentNode, watchHub *watch.WatchHub) *Server {
-	return NewServer(ServerConfig{Addr: addr, TLS: tlsCfg}, node, watchHub)
+func NewServerWithTLS(addr string, tlsCfg *TLSConfig, node ConsistentNode, watchHub *watch.WatchHub, opts ...ServerOption) *Server {
+	return NewServer(ServerConfig{Addr: addr, TLS: tlsCfg}, node, watchHub, opts...)
 }
 
 // Start 启动服务器
 func (s *Server) Start() error {
-	return s.engine.Run(s.addr)
+	return http.ListenAndServe(s.addr, s.root)
 }
 
 // ServeHTTP 实现 http.Handler 接口
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.engine.ServeHTTP(w, r)
+	s.root.ServeHTTP(w, r)
 }
 
 // StartTLS 启动 HTTPS 服务器
 func (s *Server) StartTLS(certFile, keyFile string) error {
-	return s.engine.RunTLS(s.addr, certFile, keyFile)
+	return http.ListenAndServeTLS(s.addr, certFile, keyFile, s.root)
 }
 
 // StartTLSWithConfig 启动 HTTPS 服务器（使用配置）
@@ -473,5 +1514,5 @@ func (s *Server) StartTLSWithConfig() error {
 	if s.tlsCfg == nil {
 		return fmt.Errorf("TLS config not provided")
 	}
-	return s.engine.RunTLS(s.addr, s.tlsCfg.CertFile, s.tlsCfg.KeyFile)
+	return http.ListenAndServeTLS(s.addr, s.tlsCfg.CertFile, s.tlsCfg.KeyFile, s.root)
 }
@@ -0,0 +1,1621 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/raft"
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/forever-free1/TideKV/watch"
+	hraft "github.com/hashicorp/raft"
+)
+
+// mockNode 基于内存 map 的 ConsistentNode 实现，仅用于测试
+type mockNode struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func newMockNode() *mockNode {
+	return &mockNode{data: make(map[string][]byte)}
+}
+
+func (m *mockNode) Put(key []byte, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *mockNode) PutWithSession(sessionID string, key []byte, value []byte) (uint64, error) {
+	return 1, m.Put(key, value)
+}
+
+func (m *mockNode) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, storage.ErrKeyNotFound
+	}
+	return value, nil
+}
+
+func (m *mockNode) ConsistentGet(sessionID string, key []byte) ([]byte, error) {
+	return m.Get(key)
+}
+
+func (m *mockNode) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, string(key))
+	return nil
+}
+
+func (m *mockNode) BatchPut(items []raft.BatchCommandItem) error {
+	for _, item := range items {
+		switch item.Type {
+		case raft.CommandPut:
+			m.Put(item.Key, item.Value)
+		case raft.CommandDelete:
+			m.Delete(item.Key)
+		}
+	}
+	return nil
+}
+
+func (m *mockNode) BatchDelete(keys [][]byte) error {
+	for _, key := range keys {
+		m.Delete(key)
+	}
+	return nil
+}
+
+func (m *mockNode) NewSession(sessionID string) {}
+
+// engineNode 将 bitcask.DB 包装为 ConsistentNode，仅用于测试
+type engineNode struct {
+	*bitcask.DB
+}
+
+func (n *engineNode) PutWithSession(sessionID string, key []byte, value []byte) (uint64, error) {
+	return 1, n.Put(key, value)
+}
+
+func (n *engineNode) ConsistentGet(sessionID string, key []byte) ([]byte, error) {
+	return n.Get(key)
+}
+
+func (n *engineNode) BatchPut(items []raft.BatchCommandItem) error {
+	for _, item := range items {
+		if err := n.Put(item.Key, item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *engineNode) BatchDelete(keys [][]byte) error {
+	for _, key := range keys {
+		if err := n.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *engineNode) NewSession(sessionID string) {}
+
+// captureLogger 记录所有日志行，用于断言
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestServer_AccessLog(t *testing.T) {
+	node := newMockNode()
+	node.Put([]byte("name"), []byte("TideKV"))
+
+	logger := &captureLogger{}
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub(),
+		WithAccessLog(true), WithLogger(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/kv/get?key=name", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	lines := logger.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("期望 1 行访问日志, 得到 %d 行: %v", len(lines), lines)
+	}
+
+	line := lines[0]
+	for _, want := range []string{
+		"method=GET",
+		"path=/v1/kv/get",
+		"status=200",
+		"latency=",
+		fmt.Sprintf("bytes=%d", rec.Body.Len()),
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("访问日志缺少 %q: %s", want, line)
+		}
+	}
+}
+
+func TestServer_AccessLogDisabled(t *testing.T) {
+	logger := &captureLogger{}
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub(),
+		WithLogger(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	if lines := logger.Lines(); len(lines) != 0 {
+		t.Errorf("未启用访问日志时不应输出日志, 得到: %v", lines)
+	}
+}
+
+// adminEntryResponse GET /v1/admin/entry 的响应
+type adminEntryResponse struct {
+	Key       string `json:"key"`
+	FileID    uint32 `json:"file_id"`
+	Offset    int64  `json:"offset"`
+	Size      uint32 `json:"size"`
+	Timestamp int64  `json:"timestamp"`
+	Seq       uint64 `json:"seq"`
+	CRC       uint32 `json:"crc"`
+	Type      string `json:"type"`
+	Tier      string `json:"tier"`
+}
+
+func getAdminEntry(t *testing.T, server *Server, key string) (int, *adminEntryResponse) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/entry?key="+key, nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	var resp adminEntryResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+	}
+	return rec.Code, &resp
+}
+
+func TestServer_AdminEntry(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir, bitcask.WithIndexType(bitcask.IndexTypeHybrid))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub())
+
+	before := time.Now().UnixNano()
+	db.Put([]byte("first"), []byte("v1"))
+	db.Put([]byte("second"), []byte("value-2"))
+
+	code, meta := getAdminEntry(t, server, "second")
+	if code != http.StatusOK {
+		t.Fatalf("状态码不匹配: got %d, want %d", code, http.StatusOK)
+	}
+
+	// 第二个 Entry 紧跟在第一个之后
+	firstSize := int64(bitcask.HeaderSize + len("first") + len("v1"))
+	if meta.FileID != 0 || meta.Offset != firstSize {
+		t.Errorf("位置不匹配: got file=%d offset=%d, want file=0 offset=%d", meta.FileID, meta.Offset, firstSize)
+	}
+	if want := uint32(bitcask.HeaderSize + len("second") + len("value-2")); meta.Size != want {
+		t.Errorf("大小不匹配: got %d, want %d", meta.Size, want)
+	}
+	if meta.Seq != 2 {
+		t.Errorf("Seq 不匹配: got %d, want 2", meta.Seq)
+	}
+	if meta.Timestamp < before {
+		t.Errorf("时间戳早于写入时间: %d < %d", meta.Timestamp, before)
+	}
+	if meta.CRC == 0 {
+		t.Error("CRC 不应为 0")
+	}
+	if meta.Type != "normal" {
+		t.Errorf("类型不匹配: got %s, want normal", meta.Type)
+	}
+
+	// 新写入的 key 位于冷层，查询元数据本身不应改变所在层
+	for i := 0; i < 3; i++ {
+		if _, meta := getAdminEntry(t, server, "second"); meta.Tier != "cold" {
+			t.Fatalf("新写入的 key 应位于冷层, 得到: %q", meta.Tier)
+		}
+	}
+
+	// 读取一次后提升到温层，多次读取后提升到热层
+	db.Get([]byte("second"))
+	if _, meta := getAdminEntry(t, server, "second"); meta.Tier != "warm" {
+		t.Errorf("读取后应位于温层, 得到: %q", meta.Tier)
+	}
+	for i := 0; i < 10; i++ {
+		db.Get([]byte("second"))
+	}
+	if _, meta := getAdminEntry(t, server, "second"); meta.Tier != "hot" {
+		t.Errorf("频繁读取后应位于热层, 得到: %q", meta.Tier)
+	}
+
+	if code, _ := getAdminEntry(t, server, "missing"); code != http.StatusNotFound {
+		t.Errorf("不存在的 key 状态码不匹配: got %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestServer_AdminEntryNotSupported(t *testing.T) {
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+
+	if code, _ := getAdminEntry(t, server, "k"); code != http.StatusNotImplemented {
+		t.Errorf("不支持诊断的节点状态码不匹配: got %d, want %d", code, http.StatusNotImplemented)
+	}
+}
+
+func TestServer_LastAccess(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir, bitcask.WithAccessTracking(true))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub())
+
+	get := func(key string) (int, int64) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/kv/access?key="+key, nil)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		var resp struct {
+			LastAccessUnixNano int64 `json:"last_access_unix_nano"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return rec.Code, resp.LastAccessUnixNano
+	}
+
+	db.Put([]byte("k"), []byte("v"))
+	meta, _ := db.EntryMeta([]byte("k"))
+	code, written := get("k")
+	if code != http.StatusOK || written != meta.Timestamp {
+		t.Fatalf("未读取的 key 应返回写入时间: got %d %d, want %d", code, written, meta.Timestamp)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	db.Get([]byte("k"))
+	if _, last := get("k"); last <= written {
+		t.Errorf("读取后访问时间应更新: %d <= %d", last, written)
+	}
+
+	if code, _ := get("missing"); code != http.StatusNotFound {
+		t.Errorf("不存在的 key 状态码不匹配: got %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := get(""); code != http.StatusBadRequest {
+		t.Errorf("缺少 key 状态码不匹配: got %d, want %d", code, http.StatusBadRequest)
+	}
+
+	server = NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	req := httptest.NewRequest(http.MethodGet, "/v1/kv/access?key=k", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("不支持的节点状态码不匹配: got %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+// clusterNode 在 mockNode 基础上返回固定的集群状态
+type clusterNode struct {
+	*mockNode
+	status *raft.ClusterStatus
+}
+
+func (n *clusterNode) ClusterStatus() (*raft.ClusterStatus, error) {
+	return n.status, nil
+}
+
+// TransferLeadership 模拟只有 node-2 是可转移的 voter
+func (n *clusterNode) TransferLeadership(targetID hraft.ServerID) error {
+	switch targetID {
+	case "", "node-2":
+		return nil
+	case "node-3":
+		return raft.ErrNotVoter
+	case "node-4":
+		return hraft.ErrNotLeader
+	default:
+		return raft.ErrUnknownServer
+	}
+}
+
+func getClusterStatus(t *testing.T, server *Server) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/cluster/status", nil)
+	w := httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+	}
+	return w.Code, body
+}
+
+func TestServer_ClusterStatus(t *testing.T) {
+	node := &clusterNode{
+		mockNode: newMockNode(),
+		status: &raft.ClusterStatus{
+			NodeID:        "node-1",
+			State:         "Leader",
+			Term:          5,
+			LeaderID:      "node-1",
+			LeaderAddress: "10.0.0.1:7000",
+			Servers: []raft.ServerStatus{
+				{ID: "node-1", Address: "10.0.0.1:7000", Suffrage: "voter", IsLeader: true},
+				{ID: "node-2", Address: "10.0.0.2:7000", Suffrage: "nonvoter"},
+			},
+			AppliedIndex:      100,
+			CommitIndex:       101,
+			LastLogIndex:      102,
+			LastLogTerm:       5,
+			LastSnapshotIndex: 64,
+			LastSnapshotTerm:  4,
+		},
+	}
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub())
+
+	code, body := getClusterStatus(t, server)
+	if code != http.StatusOK {
+		t.Fatalf("状态码不匹配: got %d, want %d", code, http.StatusOK)
+	}
+
+	// JSON 数字解码为 float64
+	checks := map[string]interface{}{
+		"node_id":        "node-1",
+		"state":          "Leader",
+		"term":           float64(5),
+		"applied_index":  float64(100),
+		"commit_index":   float64(101),
+		"last_log_index": float64(102),
+		"last_log_term":  float64(5),
+	}
+	for field, want := range checks {
+		if body[field] != want {
+			t.Errorf("%s 不匹配: got %v, want %v", field, body[field], want)
+		}
+	}
+
+	leader, _ := body["leader"].(map[string]interface{})
+	if leader["id"] != "node-1" || leader["address"] != "10.0.0.1:7000" {
+		t.Errorf("leader 不匹配: %v", body["leader"])
+	}
+	snapshot, _ := body["last_snapshot"].(map[string]interface{})
+	if snapshot["index"] != float64(64) || snapshot["term"] != float64(4) {
+		t.Errorf("last_snapshot 不匹配: %v", body["last_snapshot"])
+	}
+
+	servers, _ := body["servers"].([]interface{})
+	if len(servers) != 2 {
+		t.Fatalf("servers 数量不匹配: %v", body["servers"])
+	}
+	second, _ := servers[1].(map[string]interface{})
+	if second["id"] != "node-2" || second["suffrage"] != "nonvoter" || second["is_leader"] != false {
+		t.Errorf("servers[1] 不匹配: %v", servers[1])
+	}
+}
+
+func TestServer_ClusterStatusNotSupported(t *testing.T) {
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+
+	if code, _ := getClusterStatus(t, server); code != http.StatusNotImplemented {
+		t.Errorf("不支持集群状态的节点状态码不匹配: got %d, want %d", code, http.StatusNotImplemented)
+	}
+}
+
+// ackNode 在 mockNode 基础上记录写入时指定的确认级别
+type ackNode struct {
+	*mockNode
+	levels []raft.AckLevel
+}
+
+func (n *ackNode) PutWithAck(key []byte, value []byte, level raft.AckLevel) error {
+	n.levels = append(n.levels, level)
+	return n.Put(key, value)
+}
+
+func putWithAckLevel(server *Server, level string) int {
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/put", strings.NewReader(`{"key":"k","value":"v"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if level != "" {
+		req.Header.Set(AckLevelHeader, level)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestServer_PutAckLevel(t *testing.T) {
+	node := &ackNode{mockNode: newMockNode()}
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub())
+
+	for _, level := range []string{"leader", "quorum", "all"} {
+		if code := putWithAckLevel(server, level); code != http.StatusOK {
+			t.Errorf("%s 状态码不匹配: got %d, want %d", level, code, http.StatusOK)
+		}
+	}
+	want := []raft.AckLevel{raft.AckLeader, raft.AckQuorum, raft.AckAll}
+	if fmt.Sprint(node.levels) != fmt.Sprint(want) {
+		t.Errorf("确认级别不匹配: got %v, want %v", node.levels, want)
+	}
+
+	// 不带请求头时走普通写入
+	if code := putWithAckLevel(server, ""); code != http.StatusOK || len(node.levels) != 3 {
+		t.Errorf("普通写入不应指定确认级别: code %d, levels %v", code, node.levels)
+	}
+
+	if code := putWithAckLevel(server, "majority"); code != http.StatusBadRequest {
+		t.Errorf("无效级别状态码不匹配: got %d, want %d", code, http.StatusBadRequest)
+	}
+
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	if code := putWithAckLevel(plain, "all"); code != http.StatusNotImplemented {
+		t.Errorf("不支持确认级别的节点状态码不匹配: got %d, want %d", code, http.StatusNotImplemented)
+	}
+}
+
+// durableNode 记录持久化写入的确认级别
+type durableNode struct {
+	*ackNode
+	durable []raft.AckLevel
+}
+
+func (n *durableNode) PutDurable(ctx context.Context, key []byte, value []byte, level raft.AckLevel) error {
+	n.durable = append(n.durable, level)
+	return n.Put(key, value)
+}
+
+func putDurable(server *Server, durable string, level string) int {
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/put", strings.NewReader(`{"key":"k","value":"v"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DurableHeader, durable)
+	if level != "" {
+		req.Header.Set(AckLevelHeader, level)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestServer_PutDurable(t *testing.T) {
+	node := &durableNode{ackNode: &ackNode{mockNode: newMockNode()}}
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub())
+
+	// 未指定确认级别时默认为 quorum
+	for _, level := range []string{"", "all"} {
+		if code := putDurable(server, "true", level); code != http.StatusOK {
+			t.Errorf("%q 状态码不匹配: got %d, want %d", level, code, http.StatusOK)
+		}
+	}
+	want := []raft.AckLevel{raft.AckQuorum, raft.AckAll}
+	if fmt.Sprint(node.durable) != fmt.Sprint(want) {
+		t.Errorf("确认级别不匹配: got %v, want %v", node.durable, want)
+	}
+
+	// X-Durable: false 时按确认级别普通写入
+	if code := putDurable(server, "false", "all"); code != http.StatusOK || len(node.durable) != 2 || len(node.levels) != 1 {
+		t.Errorf("非持久化写入不应调用 PutDurable: code %d, durable %v, levels %v", code, node.durable, node.levels)
+	}
+
+	for _, tc := range []struct{ durable, level string }{{"yes-please", ""}, {"true", "leader"}, {"true", "majority"}} {
+		if code := putDurable(server, tc.durable, tc.level); code != http.StatusBadRequest {
+			t.Errorf("%+v 状态码不匹配: got %d, want %d", tc, code, http.StatusBadRequest)
+		}
+	}
+
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	if code := putDurable(plain, "true", ""); code != http.StatusNotImplemented {
+		t.Errorf("不支持持久化写入的节点状态码不匹配: got %d, want %d", code, http.StatusNotImplemented)
+	}
+}
+
+func putIfMatch(server *Server, value string, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/put", strings.NewReader(`{"key":"k","value":"`+value+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IfMatchHeader, ifMatch)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer_PutIfMatch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub())
+
+	// "0" 表示仅当 key 不存在时创建
+	rec := putIfMatch(server, "v1", `"0"`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("创建状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || etag == `"0"` {
+		t.Fatalf("创建后应返回新的 ETag, 得到: %q", etag)
+	}
+	if rec := putIfMatch(server, "dup", "0"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("key 已存在时状态码不匹配: got %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+
+	// 版本匹配时写入
+	rec = putIfMatch(server, "v2", etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("版本匹配时状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	current := rec.Header().Get("ETag")
+
+	// 过期版本返回 412 与当前版本
+	rec = putIfMatch(server, "stale", etag)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("过期版本状态码不匹配: got %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	if got := rec.Header().Get("ETag"); got != current {
+		t.Errorf("412 响应应返回当前 ETag: got %s, want %s", got, current)
+	}
+	if val, _ := db.Get([]byte("k")); string(val) != "v2" {
+		t.Errorf("值不匹配: got %s, want v2", val)
+	}
+
+	if rec := putIfMatch(server, "x", "abc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("无效版本状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	if rec := putIfMatch(plain, "x", "0"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("不支持条件写入的节点状态码不匹配: got %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+func TestServer_Append(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub())
+	appendValue := func(server *Server, value string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/kv/append", strings.NewReader(`{"value":"`+value+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		var resp struct {
+			Key string `json:"key"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Key
+	}
+
+	var prev string
+	for _, value := range []string{"a", "b", "c"} {
+		code, key := appendValue(server, value)
+		if code != http.StatusOK {
+			t.Fatalf("状态码不匹配: got %d, want %d", code, http.StatusOK)
+		}
+		if key <= prev {
+			t.Errorf("key 应递增: %s <= %s", key, prev)
+		}
+		if val, err := db.Get([]byte(key)); err != nil || string(val) != value {
+			t.Errorf("%s 值不匹配: got %s, err %v", key, val, err)
+		}
+		prev = key
+	}
+
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	if code, _ := appendValue(plain, "x"); code != http.StatusNotImplemented {
+		t.Errorf("不支持追加写入的节点状态码不匹配: got %d, want %d", code, http.StatusNotImplemented)
+	}
+}
+
+func TestServer_DeletePrevValue(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for name, node := range map[string]ConsistentNode{"returning": &engineNode{db}, "fallback": newMockNode()} {
+		hub := watch.NewWatchHub()
+		server := NewServer(ServerConfig{Addr: ":0"}, node, hub)
+		watcher := hub.Watch("", 10)
+
+		node.Put([]byte("k"), []byte("old"))
+		for _, key := range []string{"k", "missing"} {
+			req := httptest.NewRequest(http.MethodDelete, "/v1/kv/delete?key="+key, nil)
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: 删除 %s 状态码不匹配: got %d", name, key, rec.Code)
+			}
+		}
+
+		// 只有实际删除的 key 产生事件，且携带删除前的值
+		hub.CloseAll()
+		var events []*watch.Event
+		for event := range watcher.Ch {
+			events = append(events, event)
+		}
+		if len(events) != 1 || events[0].Key != "k" || events[0].PrevValue != "old" {
+			t.Errorf("%s: 删除事件不匹配: %+v", name, events)
+		}
+	}
+}
+
+// eventSourceNode 自行产生 Watch 事件的节点
+type eventSourceNode struct {
+	*mockNode
+}
+
+func (n *eventSourceNode) EmitsWatchEvents() bool {
+	return true
+}
+
+func TestServer_DeleteSkipsNotifyForEventSource(t *testing.T) {
+	hub := watch.NewWatchHub()
+	node := &eventSourceNode{newMockNode()}
+	server := NewServer(ServerConfig{Addr: ":0"}, node, hub)
+	watcher := hub.Watch("", 10)
+
+	node.Put([]byte("k"), []byte("v"))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/v1/kv/delete?key=k", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// 事件由节点负责产生，Handler 不应重复通知
+	hub.CloseAll()
+	if event, ok := <-watcher.Ch; ok {
+		t.Fatalf("Handler 不应产生事件: %+v", event)
+	}
+}
+
+func TestServer_Stats(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	db.Put([]byte("name"), []byte("TideKV"))
+
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub())
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp struct {
+		Memory map[string]int64 `json:"memory"`
+		Keys   map[string]int64 `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Memory["index"] <= 0 || resp.Memory["bloom"] <= 0 || resp.Memory["total"] < resp.Memory["index"]+resp.Memory["bloom"] {
+		t.Errorf("内存估算值不合理: %v", resp.Memory)
+	}
+	if resp.Keys["estimate"] != 1 || resp.Keys["exact"] != 1 {
+		t.Errorf("key 数量不匹配: %v", resp.Keys)
+	}
+
+	// key 分布：默认 16 个区间，"name" 的首字节 0x6e 落在 60~6f 区间
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?buckets=16", nil))
+	var hist struct {
+		KeyHistogram struct {
+			Buckets []struct {
+				Low  string `json:"low"`
+				High string `json:"high"`
+				Keys int64  `json:"keys"`
+			} `json:"buckets"`
+		} `json:"key_histogram"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &hist); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	buckets := hist.KeyHistogram.Buckets
+	if len(buckets) != 16 || buckets[6].Low != "60" || buckets[6].High != "6f" || buckets[6].Keys != 1 {
+		t.Errorf("key 分布不匹配: %+v", buckets)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?buckets=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("无效的区间数量状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// 不支持内存估算的节点返回 501
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	rec = httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("状态码不匹配: got %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+func TestServer_WatchLimit(t *testing.T) {
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub)
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?prefix=cfg/&limit=2", nil))
+	}()
+
+	// 等待 Watcher 注册后再产生变更
+	deadline := time.Now().Add(time.Second)
+	for hub.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher 未注册")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= 3; i++ {
+		hub.NotifyPut(fmt.Sprintf("cfg/%d", i), "v")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("推送 limit 个事件后连接应关闭")
+	}
+
+	body := rec.Body.String()
+	if n := strings.Count(body, "event: change"); n != 2 {
+		t.Fatalf("推送的事件数不匹配: got %d, want 2\n%s", n, body)
+	}
+	if strings.Contains(body, "cfg/3") {
+		t.Errorf("超过 limit 的事件不应推送: %s", body)
+	}
+	if n := hub.Count(); n != 0 {
+		t.Errorf("连接关闭后 Watcher 应被取消注册: got %d", n)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?limit=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("非法 limit 状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_WatchLimitPerIP(t *testing.T) {
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub,
+		WithWatchLimitPerIP(2), WithTrustedProxyHeader("X-Forwarded-For"))
+
+	// open 打开一个 Watch 连接并等待 Watcher 注册，返回断开连接的函数
+	open := func(remoteAddr, forwarded string) func() {
+		t.Helper()
+		before := hub.Count()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			req := httptest.NewRequest(http.MethodGet, "/v1/watch?prefix=cfg/", nil)
+			req.RemoteAddr = remoteAddr
+			if forwarded != "" {
+				req.Header.Set("X-Forwarded-For", forwarded)
+			}
+			server.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+		}()
+		deadline := time.Now().Add(time.Second)
+		for hub.Count() == before {
+			if time.Now().After(deadline) {
+				t.Fatalf("Watcher 未注册")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+	// try 发起一个 Watch 请求，被拒绝时立即返回 429，否则在超时后返回 200
+	try := func(remoteAddr, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/watch?prefix=cfg/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+		defer cancel()
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req.WithContext(ctx))
+		return rec.Code
+	}
+
+	close1 := open("10.0.0.1:1001", "")
+	close2 := open("10.0.0.1:1002", "")
+	if code := try("10.0.0.1:1003", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("超过上限的连接状态码不匹配: got %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := try("10.0.0.2:1001", ""); code != http.StatusOK {
+		t.Fatalf("其他 IP 不受影响: got %d, want %d", code, http.StatusOK)
+	}
+
+	// 断开连接后释放名额
+	close1()
+	close3 := open("10.0.0.1:1004", "")
+	if code := try("10.0.0.1:1005", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("重新占满后状态码不匹配: got %d, want %d", code, http.StatusTooManyRequests)
+	}
+	close2()
+	close3()
+	if n := server.handler.watchLimits.count("10.0.0.1"); n != 0 {
+		t.Fatalf("全部断开后名额应释放: got %d", n)
+	}
+
+	// 经由代理的请求按请求头中的第一个地址统计
+	proxy := "10.0.0.9:443"
+	closeA := open(proxy, "203.0.113.1, 10.0.0.9")
+	closeB := open(proxy, "203.0.113.1")
+	defer closeA()
+	defer closeB()
+	if code := try(proxy, "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("同一客户端经由代理超过上限的状态码不匹配: got %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := try(proxy, "203.0.113.2"); code != http.StatusOK {
+		t.Fatalf("经由同一代理的其他客户端不受影响: got %d, want %d", code, http.StatusOK)
+	}
+	if n := server.handler.watchLimits.count("10.0.0.9"); n != 0 {
+		t.Errorf("代理地址不应被计数: got %d", n)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		forwarded string
+		want      string
+	}{
+		{"对端地址", "", "203.0.113.1", "192.0.2.1"},
+		{"请求头中的第一个地址", "X-Forwarded-For", " 203.0.113.1 , 10.0.0.1", "203.0.113.1"},
+		{"IPv6", "X-Forwarded-For", "2001:db8::1", "2001:db8::1"},
+		{"请求头缺失", "X-Forwarded-For", "", "192.0.2.1"},
+		{"请求头无效", "X-Forwarded-For", "unknown", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/watch", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(req, tt.header); got != tt.want {
+				t.Fatalf("客户端 IP 不匹配: got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_WatchHeartbeatAndBuffer(t *testing.T) {
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub,
+		WithSSEHeartbeat(20*time.Millisecond), WithWatchBufferSize(16))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "/v1/watch?prefix=cfg/", nil)
+		server.ServeHTTP(rec, req.WithContext(ctx))
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher 未注册")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	watchers := hub.FindWatchersByPrefix("cfg/x")
+	if len(watchers) != 1 || cap(watchers[0].Ch) != 16 {
+		t.Fatalf("Watcher 缓冲区大小不匹配: %d 个 watcher", len(watchers))
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	cancel()
+	<-done
+
+	// 150ms 内按 20ms 的间隔最多 7 次心跳，留出调度误差
+	if n := strings.Count(rec.Body.String(), ": heartbeat"); n < 3 || n > 7 {
+		t.Errorf("心跳次数不符合配置的间隔: got %d", n)
+	}
+
+	// 非法值被忽略，保留默认值
+	defaults := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub,
+		WithSSEHeartbeat(0), WithWatchBufferSize(-1))
+	if defaults.handler.sseHeartbeat != defaultSSEHeartbeat || defaults.handler.watchBufferSize != defaultWatchBufferSize {
+		t.Errorf("非法值应保留默认值: heartbeat %v, buffer %d",
+			defaults.handler.sseHeartbeat, defaults.handler.watchBufferSize)
+	}
+}
+
+// sseFrame 解析后的一个 SSE 帧
+type sseFrame struct {
+	event string
+	data  string
+}
+
+// parseSSE 按空行切分 SSE 响应，跳过只有注释（心跳、连接消息）的帧
+func parseSSE(body string) []sseFrame {
+	var frames []sseFrame
+	for _, block := range strings.Split(body, "\n\n") {
+		var frame sseFrame
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				frame.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				frame.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		if frame.event != "" || frame.data != "" {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+func TestServer_WatchFraming(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	db.Put([]byte("cfg/b"), []byte("2"))
+	db.Put([]byte("cfg/a"), []byte("1"))
+	db.Put([]byte("other"), []byte("x"))
+
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, hub)
+
+	// watch 在后台运行，Watcher 注册后执行 trigger，返回解析后的帧
+	run := func(url string, trigger func()) []sseFrame {
+		rec := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		}()
+		deadline := time.Now().Add(time.Second)
+		for hub.Count() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Watcher 未注册")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		trigger()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("连接应关闭: %s", url)
+		}
+		return parseSSE(rec.Body.String())
+	}
+	expect := func(frames []sseFrame, want []sseFrame) {
+		t.Helper()
+		if len(frames) != len(want) {
+			t.Fatalf("帧数量不匹配: got %+v, want %+v", frames, want)
+		}
+		for i := range want {
+			if frames[i].event != want[i].event || !strings.Contains(frames[i].data, want[i].data) {
+				t.Fatalf("第 %d 帧不匹配: got %+v, want %+v", i, frames[i], want[i])
+			}
+		}
+	}
+
+	// 快照按 key 升序，snapshot-end 之后是实时变更，推送 limit 个变更后以 close 结束
+	frames := run("/v1/watch?prefix=cfg/&snapshot=true&limit=1", func() {
+		hub.NotifyPut("cfg/c", "3")
+	})
+	expect(frames, []sseFrame{
+		{SSEEventSnapshot, `"key":"cfg/a","value":"1"`},
+		{SSEEventSnapshot, `"key":"cfg/b","value":"2"`},
+		{SSEEventSnapshotEnd, `{"count":2}`},
+		{SSEEventChange, `"key":"cfg/c","value":"3"`},
+		{SSEEventClose, `{"reason":"limit"}`},
+	})
+
+	// 服务端强制关闭
+	frames = run("/v1/watch?prefix=cfg/", func() {
+		hub.NotifyPut("cfg/d", "4")
+		hub.CloseMatching("cfg/")
+	})
+	expect(frames, []sseFrame{
+		{SSEEventChange, `"key":"cfg/d"`},
+		{SSEEventClose, `{"reason":"closed"}`},
+	})
+
+	// 服务端过滤：快照与实时变更都只推送满足条件的事件
+	db.Put([]byte("cfg/e"), []byte(`{"status":"error"}`))
+	frames = run("/v1/watch?prefix=cfg/&snapshot=true&field=status&equals=error&limit=1", func() {
+		hub.NotifyPut("cfg/f", `{"status":"ok"}`)
+		hub.NotifyPut("cfg/g", `{"status":"error"}`)
+	})
+	expect(frames, []sseFrame{
+		{SSEEventSnapshot, `"key":"cfg/e"`},
+		{SSEEventSnapshotEnd, `{"count":1}`},
+		{SSEEventChange, `"key":"cfg/g"`},
+		{SSEEventClose, `{"reason":"limit"}`},
+	})
+	frames = run("/v1/watch?prefix=cfg/&contains=ok&limit=1", func() {
+		hub.NotifyPut("cfg/g", `{"status":"error"}`)
+		hub.NotifyPut("cfg/f", `{"status":"ok"}`)
+	})
+	expect(frames, []sseFrame{
+		{SSEEventChange, `"key":"cfg/f"`},
+		{SSEEventClose, `{"reason":"limit"}`},
+	})
+
+	// 不支持前缀读取的节点无法提供快照
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	rec := httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?snapshot=true", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("状态码不匹配: got %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+	rec = httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?snapshot=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("非法 snapshot 状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?field=status", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("缺少 equals 状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_WatchNDJSON(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	db.Put([]byte("cfg/b"), []byte("2"))
+	db.Put([]byte("cfg/a"), []byte("1"))
+
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, hub)
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch/ndjson?prefix=cfg/&snapshot=true&limit=3", nil))
+	}()
+	deadline := time.Now().Add(time.Second)
+	for hub.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher 未注册")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	hub.NotifyPut("cfg/c", "3")
+	hub.NotifyPut("other", "x")
+	hub.NotifyDelete("cfg/a", "1")
+	hub.NotifyPut("cfg/a", "4")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("推送 limit 个事件后连接应关闭")
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type 不匹配: %s", ct)
+	}
+
+	// 快照按 key 升序在前，之后是按顺序推送的实时变更，每行都是一个完整的事件
+	want := []watch.Event{
+		{Type: watch.EventPut, Key: "cfg/a", Value: "1"},
+		{Type: watch.EventPut, Key: "cfg/b", Value: "2"},
+		{Type: watch.EventPut, Key: "cfg/c", Value: "3"},
+		{Type: watch.EventDelete, Key: "cfg/a", PrevValue: "1"},
+		{Type: watch.EventPut, Key: "cfg/a", Value: "4"},
+	}
+	var got []*watch.Event
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		event, err := watch.ParseEventFromJSON(line)
+		if err != nil {
+			t.Fatalf("解析事件失败: %v, line=%q", err, line)
+		}
+		got = append(got, event)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("事件数量不匹配: got %d, want %d, body=%q", len(got), len(want), rec.Body.String())
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Key != want[i].Key || got[i].Value != want[i].Value || got[i].PrevValue != want[i].PrevValue {
+			t.Fatalf("第 %d 个事件不匹配: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// 参数校验与 /v1/watch 相同
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch/ndjson?limit=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("非法的 limit 应返回 400，实际为 %d", rec.Code)
+	}
+}
+
+func TestServer_WatchBatch(t *testing.T) {
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub)
+
+	const burst, trickle = 100, 3
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		url := fmt.Sprintf("/v1/watch?prefix=cfg/&batch=50ms&limit=%d", burst+trickle)
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	}()
+	deadline := time.Now().Add(time.Second)
+	for hub.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher 未注册")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 突发的变更合并发送；间隔超过窗口的变更逐个发送
+	seq := uint64(0)
+	notify := func() {
+		seq++
+		hub.Notify(&watch.Event{Type: watch.EventPut, Key: fmt.Sprintf("cfg/%03d", seq), Value: "v", Seq: seq})
+	}
+	for i := 0; i < burst; i++ {
+		notify()
+	}
+	for i := 0; i < trickle; i++ {
+		time.Sleep(150 * time.Millisecond)
+		notify()
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("推送 limit 个事件后连接应关闭")
+	}
+
+	var events []*watch.Event
+	batches, singles := 0, 0
+	frames := parseSSE(rec.Body.String())
+	for _, frame := range frames[:len(frames)-1] {
+		switch frame.event {
+		case SSEEventChanges:
+			var batch []*watch.Event
+			if err := json.Unmarshal([]byte(frame.data), &batch); err != nil {
+				t.Fatalf("解析 changes 帧失败: %v", err)
+			}
+			if len(batch) < 2 {
+				t.Fatalf("changes 帧至少包含两个事件: %s", frame.data)
+			}
+			batches++
+			events = append(events, batch...)
+		case SSEEventChange:
+			event, err := watch.ParseEventFromJSON(frame.data)
+			if err != nil {
+				t.Fatalf("解析 change 帧失败: %v", err)
+			}
+			singles++
+			events = append(events, event)
+		default:
+			t.Fatalf("意外的帧: %+v", frame)
+		}
+	}
+	if last := frames[len(frames)-1]; last.event != SSEEventClose {
+		t.Fatalf("最后一帧应为 close: %+v", last)
+	}
+
+	if len(events) != burst+trickle {
+		t.Fatalf("事件数量不匹配: got %d, want %d", len(events), burst+trickle)
+	}
+	for i, event := range events {
+		if event.Seq != uint64(i+1) {
+			t.Fatalf("第 %d 个事件顺序错误: seq %d", i, event.Seq)
+		}
+	}
+	if batches == 0 || batches > 3 {
+		t.Errorf("突发的变更应合并为少数几个帧: got %d 个 changes 帧", batches)
+	}
+	if singles < trickle {
+		t.Errorf("间隔超过窗口的变更应逐个发送: got %d 个 change 帧", singles)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?batch=10s", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("超过上限的 batch 状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_WatchBase64(t *testing.T) {
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub)
+
+	key := "bin/\x00\xff"
+	value := string([]byte{0x00, 0x01, 0xfe, 0xff, '\n', '"', 0x80})
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?prefix=bin/&limit=1&encoding=base64", nil))
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher 未注册")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	hub.Notify(&watch.Event{Type: watch.EventPut, Key: key, Value: value, Seq: 42})
+	<-done
+
+	var data string
+	for _, frame := range parseSSE(rec.Body.String()) {
+		if frame.event == SSEEventChange {
+			data = frame.data
+		}
+	}
+	event, err := watch.ParseEventFromJSON(data)
+	if err != nil {
+		t.Fatalf("解析事件失败: %v", err)
+	}
+	if event.Encoding != watch.EncodingBase64 {
+		t.Fatalf("事件编码不匹配: got %q", event.Encoding)
+	}
+	decoded, err := event.DecodeBase64()
+	if err != nil {
+		t.Fatalf("解码事件失败: %v", err)
+	}
+	if decoded.Key != key || decoded.Value != value {
+		t.Errorf("二进制数据未能逐字节还原: key %q, value %q", decoded.Key, decoded.Value)
+	}
+	if decoded.Seq != 42 {
+		t.Errorf("编码后应保留 Seq: got %d", decoded.Seq)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?encoding=hex", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("不支持的编码状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_WatchEventVersion(t *testing.T) {
+	hub := watch.NewWatchHub()
+	server := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), hub)
+
+	// watchOne 推送一个带 Seq 的事件，返回事件解析出的字段与响应中的版本头
+	watchOne := func(url, header string) (map[string]interface{}, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if header != "" {
+			req.Header.Set(WatchVersionHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			server.ServeHTTP(rec, req)
+		}()
+		deadline := time.Now().Add(time.Second)
+		for hub.Count() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Watcher 未注册")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		hub.Notify(&watch.Event{Type: watch.EventPut, Key: "cfg/a", Value: "1", PrevValue: "0", Seq: 7})
+		<-done
+
+		data := strings.TrimSpace(rec.Body.String())
+		if !strings.Contains(url, "/ndjson") {
+			data = ""
+			for _, frame := range parseSSE(rec.Body.String()) {
+				if frame.event == SSEEventChange {
+					data = frame.data
+				}
+			}
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &fields); err != nil {
+			t.Fatalf("解析事件失败: %v, body=%q", err, rec.Body.String())
+		}
+		return fields, rec.Header().Get(WatchVersionHeader)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		header  string
+		version string
+		fields  []string
+	}{
+		{"默认为最新版本", "/v1/watch?prefix=cfg/&limit=1", "", "2", []string{"type", "key", "value", "prev_value", "seq", "version"}},
+		{"v1 查询参数", "/v1/watch?prefix=cfg/&limit=1&v=1", "", "1", []string{"type", "key", "value", "prev_value"}},
+		{"v1 请求头", "/v1/watch?prefix=cfg/&limit=1", "1", "1", []string{"type", "key", "value", "prev_value"}},
+		{"查询参数优先于请求头", "/v1/watch?prefix=cfg/&limit=1&v=2", "1", "2", []string{"type", "key", "value", "prev_value", "seq", "version"}},
+		{"NDJSON 同样协商", "/v1/watch/ndjson?prefix=cfg/&limit=1&v=1", "", "1", []string{"type", "key", "value", "prev_value"}},
+	}
+	for _, tt := range tests {
+		fields, version := watchOne(tt.url, tt.header)
+		if version != tt.version {
+			t.Fatalf("%s: 响应版本不匹配: got %q, want %q", tt.name, version, tt.version)
+		}
+		if len(fields) != len(tt.fields) {
+			t.Fatalf("%s: 字段不匹配: got %v, want %v", tt.name, fields, tt.fields)
+		}
+		for _, name := range tt.fields {
+			if _, ok := fields[name]; !ok {
+				t.Fatalf("%s: 缺少字段 %s: %v", tt.name, name, fields)
+			}
+		}
+		if v, ok := fields["version"]; ok && v != float64(watch.EventVersion2) {
+			t.Fatalf("%s: version 字段不匹配: %v", tt.name, v)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?v=9", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("不支持的版本状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_TransferLeader(t *testing.T) {
+	node := &clusterNode{mockNode: newMockNode()}
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub())
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"转移到指定 voter", `{"target_id":"node-2"}`, http.StatusOK},
+		{"不指定目标", "", http.StatusOK},
+		{"目标不是 voter", `{"target_id":"node-3"}`, http.StatusBadRequest},
+		{"目标不在集群中", `{"target_id":"node-9"}`, http.StatusBadRequest},
+		{"本节点不是 Leader", `{"target_id":"node-4"}`, http.StatusConflict},
+		{"请求体无效", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/cluster/transfer-leader", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.engine.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("状态码不匹配: got %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// 不支持转移的节点返回 501
+	server = NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	req := httptest.NewRequest(http.MethodPost, "/v1/cluster/transfer-leader", nil)
+	w := httptest.NewRecorder()
+	server.engine.ServeHTTP(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("状态码不匹配: got %d, want %d", w.Code, http.StatusNotImplemented)
+	}
+}
+
+// notReadyNode 尚未就绪的节点，读取返回 ErrNotReady
+type notReadyNode struct {
+	*mockNode
+	ready bool
+}
+
+func (n *notReadyNode) Ready() bool {
+	return n.ready
+}
+
+func (n *notReadyNode) Get(key []byte) ([]byte, error) {
+	if !n.ready {
+		return nil, raft.ErrNotReady
+	}
+	return n.mockNode.Get(key)
+}
+
+func TestServer_NotReady(t *testing.T) {
+	node := &notReadyNode{mockNode: newMockNode()}
+	node.Put([]byte("k"), []byte("v"))
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub())
+
+	for _, path := range []string{"/health", "/v1/kv/get?key=k"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: 未就绪时状态码不匹配: got %d, want %d", path, rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	node.ready = true
+	for _, path := range []string{"/health", "/v1/kv/get?key=k"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: 就绪后状态码不匹配: got %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+}
+
+// slowNode 读取阻塞到 release 关闭为止；持久化写入阻塞到请求的 context 结束，并记录结束原因
+type slowNode struct {
+	*ackNode
+	release   chan struct{}
+	cancelled chan error
+}
+
+func (n *slowNode) Get(key []byte) ([]byte, error) {
+	<-n.release
+	return n.mockNode.Get(key)
+}
+
+func (n *slowNode) PutDurable(ctx context.Context, key []byte, value []byte, level raft.AckLevel) error {
+	<-ctx.Done()
+	n.cancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestServer_RequestTimeout(t *testing.T) {
+	node := &slowNode{
+		ackNode:   &ackNode{mockNode: newMockNode()},
+		release:   make(chan struct{}),
+		cancelled: make(chan error, 1),
+	}
+	node.Put([]byte("k"), []byte("v"))
+	server := NewServer(ServerConfig{Addr: ":0"}, node, watch.NewWatchHub(), WithRequestTimeout(50*time.Millisecond))
+
+	// 阻塞的读取在超时后返回 504
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/kv/get?key=k", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("超时的读取状态码不匹配: got %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("超时的读取返回太慢: %v", elapsed)
+	}
+	if !strings.Contains(rec.Body.String(), "request timeout") {
+		t.Fatalf("超时响应缺少错误信息: %s", rec.Body.String())
+	}
+	close(node.release)
+
+	// 支持 context 的写入随请求一起取消
+	if code := putDurable(server, "true", ""); code != http.StatusGatewayTimeout {
+		t.Fatalf("超时的持久化写入状态码不匹配: got %d, want %d", code, http.StatusGatewayTimeout)
+	}
+	select {
+	case err := <-node.cancelled:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("持久化写入的取消原因不匹配: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("持久化写入没有被取消")
+	}
+
+	// 按时完成的请求正常返回
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/kv/get?key=k", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"value":"v"`) {
+		t.Fatalf("按时完成的读取不匹配: %d %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("按时完成的响应头不匹配: %q", ct)
+	}
+
+	// Watch 长连接不受超时限制，持续到客户端断开
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	start = time.Now()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/watch?prefix=k", nil).WithContext(ctx))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Watch 状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("Watch 不应在请求超时后结束: %v", elapsed)
+	}
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 日志 ====================
+
+// Logger 可插拔的日志接口
+// 默认使用标准库 log，可通过 WithLogger 替换为任意实现
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger 基于标准库 log 的默认 Logger 实现
+type stdLogger struct{}
+
+// Printf 输出一行日志
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// ==================== 服务器选项 ====================
+
+// ServerOptions 定义 Server 的可选配置
+type ServerOptions struct {
+	// AccessLog 是否输出访问日志
+	AccessLog bool
+
+	// Logger 日志输出，默认为标准库 log
+	Logger Logger
+
+	// ACL 按前缀授权的访问控制策略，为 nil 时不做鉴权
+	ACL ACLPolicy
+
+	// SSEHeartbeat Watch 长连接的心跳间隔，默认 30 秒
+	SSEHeartbeat time.Duration
+
+	// WatchBufferSize 每个 Watch 连接的事件缓冲区大小，默认 1000
+	WatchBufferSize int
+
+	// WatchLimitPerIP 每个客户端 IP 同时打开的 Watch 连接上限，0 表示不限制
+	WatchLimitPerIP int
+
+	// TrustedProxyHeader 读取客户端 IP 的请求头，为空时使用对端地址
+	TrustedProxyHeader string
+
+	// RequestTimeout Watch 之外每个请求的处理超时，超时返回 504，0 表示不限制
+	RequestTimeout time.Duration
+}
+
+// ServerOption 定义 ServerOptions 的配置函数
+type ServerOption func(*ServerOptions)
+
+// WithAccessLog 设置是否输出访问日志
+func WithAccessLog(enabled bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.AccessLog = enabled
+	}
+}
+
+// WithLogger 设置日志输出
+func WithLogger(logger Logger) ServerOption {
+	return func(o *ServerOptions) {
+		o.Logger = logger
+	}
+}
+
+// WithSSEHeartbeat 设置 Watch 长连接的心跳间隔
+// 代理的空闲超时较短时应调小；d <= 0 时忽略，保留默认值
+func WithSSEHeartbeat(d time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		if d > 0 {
+			o.SSEHeartbeat = d
+		}
+	}
+}
+
+// WithWatchBufferSize 设置每个 Watch 连接的事件缓冲区大小
+// 缓冲区写满后新事件会被丢弃（见 watch.WithSendTimeout）；n <= 0 时忽略，保留默认值
+func WithWatchBufferSize(n int) ServerOption {
+	return func(o *ServerOptions) {
+		if n > 0 {
+			o.WatchBufferSize = n
+		}
+	}
+}
+
+// defaultServerOptions 返回默认的服务器选项
+func defaultServerOptions() *ServerOptions {
+	return &ServerOptions{
+		AccessLog:       false,
+		Logger:          stdLogger{},
+		SSEHeartbeat:    defaultSSEHeartbeat,
+		WatchBufferSize: defaultWatchBufferSize,
+	}
+}
+
+// ==================== 中间件 ====================
+
+// watchPathPrefix Watch 长连接路由前缀
+// SSE 连接不会正常结束，不适合逐请求记录访问日志
+const watchPathPrefix = "/v1/watch"
+
+// AccessLogMiddleware 访问日志中间件
+// 每个请求结束后输出一行：方法、路径、状态码、耗时、响应字节数
+func AccessLogMiddleware(logger Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if strings.HasPrefix(path, watchPathPrefix) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+
+		// 未写入响应体时 gin 返回 -1
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+
+		logger.Printf("access method=%s path=%s status=%d latency=%s bytes=%d",
+			c.Request.Method,
+			path,
+			c.Writer.Status(),
+			latency,
+			size,
+		)
+	}
+}
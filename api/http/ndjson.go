@@ -0,0 +1,121 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/forever-free1/TideKV/watch"
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== NDJSON Watch ====================
+//
+// SSE 的帧格式对 curl | jq 之类的简单客户端并不友好。GET /v1/watch/ndjson 与 /v1/watch
+// 接受相同的查询参数、使用相同的 Watcher，但每行输出一个 JSON 事件，每个事件写出后立即 flush：
+//
+//	{"type":"put","key":"cfg/a","value":"1","seq":3,...}
+//
+// snapshot=true 时先按 key 升序输出快照中的 put 事件（seq 为 0），之后是实时变更。
+// 每行都是一个完整的事件，没有其他类型的行；心跳为空行，客户端应当忽略空行。
+// Watcher 被关闭、推送了 limit 个事件或缓冲区已满丢弃事件时服务端结束响应，
+// 客户端无法区分这几种情况，需要完整状态时应带 snapshot=true 重新连接。
+// batch 参数只影响 SSE，这里不合并事件。
+
+// WatchNDJSON 处理 NDJSON 格式的 Watch 请求
+// GET /v1/watch/ndjson?prefix=xxx&limit=N&encoding=base64&snapshot=true&contains=xxx&field=status&equals=error&v=2
+func (h *Handler) WatchNDJSON(c *gin.Context) {
+	req, ok := h.parseWatchRequest(c)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquireWatch(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	watcher := h.watchHub.WatchIf(req.prefix, req.pred, h.watchBufferSize, watch.WithMaxEvents(req.limit))
+	defer h.watchHub.Unregister(watcher)
+
+	// 注册之后再读取快照，保证不会遗漏快照与实时事件之间的变更
+	var pairs map[string][]byte
+	if req.snapshot {
+		if pairs, ok = h.watchSnapshot(c, req); !ok {
+			return
+		}
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "streaming not supported",
+		})
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	flusher.Flush()
+
+	// writeLine 按编码方式输出一行事件，序列化失败时结束推送
+	writeLine := func(event *watch.Event) bool {
+		if req.encoding == watch.EncodingBase64 {
+			event = event.EncodeBase64()
+		}
+		event = event.ForVersion(req.version)
+		data, err := watch.EventToJSON(event)
+		if err != nil {
+			return false
+		}
+		fmt.Fprintf(c.Writer, "%s\n", data)
+		flusher.Flush()
+		return true
+	}
+
+	if req.snapshot {
+		keys := make([]string, 0, len(pairs))
+		for key := range pairs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			event := &watch.Event{Type: watch.EventPut, Key: key, Value: string(pairs[key])}
+			if req.pred != nil && !req.pred(event) {
+				continue
+			}
+			if !writeLine(event) {
+				return
+			}
+		}
+	}
+
+	clientGone := c.Request.Context().Done()
+	ticker := time.NewTicker(h.sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-clientGone:
+			return
+
+		case event, ok := <-watcher.Ch:
+			// Watcher 被关闭或已推送 limit 个事件
+			if !ok || !writeLine(event) {
+				return
+			}
+
+		case <-ticker.C:
+			fmt.Fprint(c.Writer, "\n")
+			flusher.Flush()
+		}
+
+		// 事件被丢弃后客户端看到的状态不再完整，结束响应让客户端重新连接
+		if watcher.Dropped() > 0 {
+			return
+		}
+	}
+}
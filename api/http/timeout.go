@@ -0,0 +1,140 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== 请求超时 ====================
+//
+// 存储变慢时（例如 Merge 期间或磁盘卡顿）Get、Put 等请求可能一直挂起，占满服务端的连接。
+// 启用后每个请求在带超时的 context 中处理：超时前没有完成的请求返回 504，
+// 支持 context 的节点方法（例如 DurableWriter.PutDurable）通过请求的 context 得知取消并提前返回；
+// 其余节点方法无法中断，会在后台继续执行完毕，但结果不再写回客户端。
+//
+// 因此写入请求的 504 只表示没有在超时内得到结果，不表示写入失败：写入可能已经执行或之后完成。
+// Raft 节点上的写入一旦提交到日志就无法撤回，PutDurable 提前返回时写入同样可能已经提交，
+// 存储引擎的写入也不接受 context。客户端需要确认结果时应重新读取，或使用 If-Match 条件写入重试。
+//
+// 超时在 gin 之外的 http.Handler 层实现：处理函数在独立的 goroutine 中运行，响应先写入缓冲区，
+// 按时完成时再整体写出，超时之后处理函数的写入被丢弃，gin 的 Context 始终只在这个 goroutine 中使用。
+// Watch 是长连接，不受超时限制。
+
+// WithRequestTimeout 设置每个请求的处理超时，超时返回 504；d <= 0 表示不限制（默认）
+// 写入请求超时之后可能仍然生效，见上文
+func WithRequestTimeout(d time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.RequestTimeout = d
+	}
+}
+
+// timeoutHandler 为 Watch 之外的请求设置处理超时
+type timeoutHandler struct {
+	next    http.Handler
+	timeout time.Duration
+}
+
+// newTimeoutHandler 创建超时处理器，timeout <= 0 时直接返回 next
+func newTimeoutHandler(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return &timeoutHandler{next: next, timeout: timeout}
+}
+
+// ServeHTTP 实现 http.Handler 接口
+func (h *timeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, watchPathPrefix) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	tw := &timeoutWriter{header: make(http.Header)}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+				return
+			}
+			close(done)
+		}()
+		h.next.ServeHTTP(tw, r.WithContext(ctx))
+	}()
+
+	select {
+	case p := <-panicked:
+		// 交给 net/http 处理，与未启用超时时的行为一致
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		for key, values := range tw.header {
+			w.Header()[key] = values
+		}
+		if tw.status == 0 {
+			tw.status = http.StatusOK
+		}
+		w.WriteHeader(tw.status)
+		w.Write(tw.buf.Bytes())
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		// 客户端已断开时不需要响应
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		// 处理函数仍在后台运行，写入可能在这之后完成
+		body, _ := json.Marshal(map[string]string{"error": "request timeout"})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write(body)
+	}
+}
+
+// timeoutWriter 缓冲处理函数的响应，超时之后丢弃写入
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// Header 返回响应头
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// Write 写入响应体，超时之后返回 http.ErrHandlerTimeout
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+// WriteHeader 记录状态码，只有第一次调用生效
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
@@ -0,0 +1,212 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/forever-free1/TideKV/raft"
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 前缀树 ====================
+
+// TreeValueKey 同时是叶子和前缀的 key，其自身的值在嵌套对象中的字段名
+//
+// 例如 app=1 与 app/name=x 同时存在时，结果为 {"app": {"_value": "1", "name": "x"}}
+const TreeValueKey = "_value"
+
+// 空路径段（例如 a//b 中间的一段、a/ 末尾的一段）的处理方式，通过查询参数 empty 指定
+const (
+	// TreeEmptyKeep 保留空路径段，作为字段名为 "" 的一层（默认）
+	TreeEmptyKeep = "keep"
+	// TreeEmptyCollapse 去掉空路径段：a//b 视为 a/b，a/ 视为 a
+	TreeEmptyCollapse = "collapse"
+	// TreeEmptyReject 存在空路径段的 key 无法放入树中，返回 TreeConflictError
+	TreeEmptyReject = "reject"
+)
+
+// key 无法放入树中的原因
+const (
+	// TreeReasonEmptySegment empty=reject 时 key 含有空路径段
+	TreeReasonEmptySegment = "empty segment"
+	// TreeReasonReservedSegment key 的某一段与 TreeValueKey 相同，无法与叶子自身的值区分
+	TreeReasonReservedSegment = "reserved segment"
+	// TreeReasonDuplicatePath 与另一个 key 对应同一个路径（例如 empty=collapse 时的 a//b 与 a/b）
+	TreeReasonDuplicatePath = "duplicate path"
+)
+
+// TreeConflictError key 无法放入树中
+type TreeConflictError struct {
+	Key    string // 无法放入的 key
+	Other  string // 与之冲突的 key，仅 TreeReasonDuplicatePath 时有值
+	Reason string // 原因，见 TreeReason 常量
+}
+
+// Error 实现 error 接口
+func (e *TreeConflictError) Error() string {
+	if e.Other != "" {
+		return fmt.Sprintf("key %q cannot be placed in tree: %s with %q", e.Key, e.Reason, e.Other)
+	}
+	return fmt.Sprintf("key %q cannot be placed in tree: %s", e.Key, e.Reason)
+}
+
+// Tree 请求处理
+// GET /v1/kv/tree?prefix=xxx&sep=/&empty=keep
+// 读取 prefix 下的全部键值对，去掉前缀后按 sep（默认 "/"）拆分 key，返回嵌套的 JSON 对象。
+// empty 指定空路径段的处理方式（keep / collapse / reject），有 key 无法放入树中时返回 409 与冲突的 key
+func (h *Handler) Tree(c *gin.Context) {
+	prefix := c.Query("prefix")
+	sep := c.DefaultQuery("sep", "/")
+	if sep == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "sep must not be empty",
+		})
+		return
+	}
+	empty := c.DefaultQuery("empty", TreeEmptyKeep)
+	if empty != TreeEmptyKeep && empty != TreeEmptyCollapse && empty != TreeEmptyReject {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unsupported empty mode: " + empty,
+		})
+		return
+	}
+
+	reader, ok := h.node.(storage.PrefixMapReader)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "prefix read not supported",
+		})
+		return
+	}
+
+	kvs, err := reader.GetPrefixAsMap([]byte(prefix))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotSupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "prefix read not supported",
+			})
+			return
+		}
+		if errors.Is(err, raft.ErrNotReady) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "tree failed: " + err.Error(),
+		})
+		return
+	}
+
+	tree, err := buildTree(kvs, prefix, sep, empty)
+	if err != nil {
+		var conflict *TreeConflictError
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  err.Error(),
+				"key":    conflict.Key,
+				"other":  conflict.Other,
+				"reason": conflict.Reason,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "tree failed: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// buildTree 将扁平的键值对构建为嵌套对象
+// key 去掉 prefix 及紧随其后的 sep 后按 sep 拆分，每一段对应一层对象，value 作为字符串叶子。
+// 冲突规则：某个 key 既是叶子又是其他 key 的前缀时，该节点为对象，叶子的值放在 TreeValueKey 字段中；
+// 与 prefix 完全相同的 key 的值放在根对象的 TreeValueKey 字段中。
+// 空路径段按 empty 处理；某一段与 TreeValueKey 相同、或两个 key 对应同一个路径时返回 TreeConflictError。
+// key 按字典序依次写入，结果与输入顺序无关。
+func buildTree(kvs map[string][]byte, prefix string, sep string, empty string) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(kvs))
+	for key := range kvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	root := make(map[string]interface{})
+	// placed 记录每个路径由哪个 key 写入，用于报告重复路径
+	placed := make(map[string]string, len(keys))
+	for _, key := range keys {
+		segments, err := treeSegments(key, prefix, sep, empty)
+		if err != nil {
+			return nil, err
+		}
+		path := fmt.Sprintf("%q", segments)
+		if other, ok := placed[path]; ok {
+			return nil, &TreeConflictError{Key: key, Other: other, Reason: TreeReasonDuplicatePath}
+		}
+		placed[path] = key
+
+		value := string(kvs[key])
+		if len(segments) == 0 {
+			root[TreeValueKey] = value
+			continue
+		}
+
+		node := root
+		for _, segment := range segments[:len(segments)-1] {
+			node = childNode(node, segment)
+		}
+
+		last := segments[len(segments)-1]
+		if child, ok := node[last].(map[string]interface{}); ok {
+			child[TreeValueKey] = value
+		} else {
+			node[last] = value
+		}
+	}
+	return root, nil
+}
+
+// treeSegments 返回 key 在树中的路径，空切片表示根节点自身的值
+func treeSegments(key, prefix, sep, empty string) ([]string, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(key, prefix), sep)
+	if rest == "" {
+		return nil, nil
+	}
+
+	segments := strings.Split(rest, sep)
+	kept := segments[:0]
+	for _, segment := range segments {
+		switch {
+		case segment == TreeValueKey:
+			return nil, &TreeConflictError{Key: key, Reason: TreeReasonReservedSegment}
+		case segment != "":
+			kept = append(kept, segment)
+		case empty == TreeEmptyReject:
+			return nil, &TreeConflictError{Key: key, Reason: TreeReasonEmptySegment}
+		case empty == TreeEmptyKeep:
+			kept = append(kept, segment)
+		}
+	}
+	return kept, nil
+}
+
+// childNode 返回 node 下名为 segment 的子对象，不存在时创建；已有的叶子转换为对象
+func childNode(node map[string]interface{}, segment string) map[string]interface{} {
+	switch child := node[segment].(type) {
+	case map[string]interface{}:
+		return child
+	case string:
+		converted := map[string]interface{}{TreeValueKey: child}
+		node[segment] = converted
+		return converted
+	default:
+		created := make(map[string]interface{})
+		node[segment] = created
+		return created
+	}
+}
@@ -0,0 +1,240 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/forever-free1/TideKV/watch"
+)
+
+func TestBuildTree(t *testing.T) {
+	tests := []struct {
+		name   string
+		kvs    map[string]string
+		prefix string
+		sep    string
+		empty  string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "嵌套配置",
+			kvs:    map[string]string{"cfg/db/host": "localhost", "cfg/db/port": "5432", "cfg/name": "app"},
+			prefix: "cfg/",
+			sep:    "/",
+			want: map[string]interface{}{
+				"db":   map[string]interface{}{"host": "localhost", "port": "5432"},
+				"name": "app",
+			},
+		},
+		{
+			name:   "前缀不以分隔符结尾",
+			kvs:    map[string]string{"cfg/a": "1", "cfg/b/c": "2"},
+			prefix: "cfg",
+			sep:    "/",
+			want: map[string]interface{}{
+				"a": "1",
+				"b": map[string]interface{}{"c": "2"},
+			},
+		},
+		{
+			name:   "叶子同时是前缀",
+			kvs:    map[string]string{"cfg/db": "primary", "cfg/db/host": "localhost"},
+			prefix: "cfg/",
+			sep:    "/",
+			want: map[string]interface{}{
+				"db": map[string]interface{}{TreeValueKey: "primary", "host": "localhost"},
+			},
+		},
+		{
+			name:   "key 与前缀相同",
+			kvs:    map[string]string{"cfg": "root", "cfg/a": "1"},
+			prefix: "cfg",
+			sep:    "/",
+			want:   map[string]interface{}{TreeValueKey: "root", "a": "1"},
+		},
+		{
+			name:   "自定义分隔符",
+			kvs:    map[string]string{"a.b.c": "1", "a.d": "2"},
+			prefix: "",
+			sep:    ".",
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": map[string]interface{}{"c": "1"},
+					"d": "2",
+				},
+			},
+		},
+		{
+			name:   "保留连续分隔符之间的空路径段",
+			kvs:    map[string]string{"a//b": "1", "a/b": "2"},
+			prefix: "",
+			sep:    "/",
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					"":  map[string]interface{}{"b": "1"},
+					"b": "2",
+				},
+			},
+		},
+		{
+			name:   "保留末尾分隔符之后的空路径段",
+			kvs:    map[string]string{"a": "1", "a/": "2", "b/": "3"},
+			prefix: "",
+			sep:    "/",
+			want: map[string]interface{}{
+				"a": map[string]interface{}{TreeValueKey: "1", "": "2"},
+				"b": map[string]interface{}{"": "3"},
+			},
+		},
+		{
+			name:   "去掉空路径段",
+			kvs:    map[string]string{"cfg/a//b": "1", "cfg/c/": "2", "cfg/c/d": "3"},
+			prefix: "cfg/",
+			sep:    "/",
+			empty:  TreeEmptyCollapse,
+			want: map[string]interface{}{
+				"a": map[string]interface{}{"b": "1"},
+				"c": map[string]interface{}{TreeValueKey: "2", "d": "3"},
+			},
+		},
+		{
+			name:   "叶子同时是前缀且不含空路径段时 reject 不报错",
+			kvs:    map[string]string{"a": "1", "a/b": "2", "a/b/c": "3"},
+			prefix: "",
+			sep:    "/",
+			empty:  TreeEmptyReject,
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					TreeValueKey: "1",
+					"b":          map[string]interface{}{TreeValueKey: "2", "c": "3"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs := make(map[string][]byte, len(tt.kvs))
+			for k, v := range tt.kvs {
+				kvs[k] = []byte(v)
+			}
+			empty := tt.empty
+			if empty == "" {
+				empty = TreeEmptyKeep
+			}
+			got, err := buildTree(kvs, tt.prefix, tt.sep, empty)
+			if err != nil {
+				t.Fatalf("构建树失败: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("树结构不匹配:\n got  %v\n want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTree_Conflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		kvs    map[string]string
+		empty  string
+		key    string
+		other  string
+		reason string
+	}{
+		{"拒绝连续分隔符", map[string]string{"a//b": "1"}, TreeEmptyReject, "a//b", "", TreeReasonEmptySegment},
+		{"拒绝末尾分隔符", map[string]string{"a/b": "1", "a/b/": "2"}, TreeEmptyReject, "a/b/", "", TreeReasonEmptySegment},
+		{"去掉空路径段后路径重复", map[string]string{"a//b": "1", "a/b": "2"}, TreeEmptyCollapse, "a/b", "a//b", TreeReasonDuplicatePath},
+		{"去掉末尾分隔符后与叶子重复", map[string]string{"a": "1", "a/": "2"}, TreeEmptyCollapse, "a/", "a", TreeReasonDuplicatePath},
+		{"路径段与保留字段同名", map[string]string{"a": "1", "a/" + TreeValueKey: "2"}, TreeEmptyKeep, "a/" + TreeValueKey, "", TreeReasonReservedSegment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs := make(map[string][]byte, len(tt.kvs))
+			for k, v := range tt.kvs {
+				kvs[k] = []byte(v)
+			}
+			_, err := buildTree(kvs, "", "/", tt.empty)
+			conflict, ok := err.(*TreeConflictError)
+			if !ok {
+				t.Fatalf("应返回 TreeConflictError，实际为 %v", err)
+			}
+			if conflict.Key != tt.key || conflict.Other != tt.other || conflict.Reason != tt.reason {
+				t.Errorf("冲突不匹配: got %+v, want key=%q other=%q reason=%q", conflict, tt.key, tt.other, tt.reason)
+			}
+		})
+	}
+}
+
+func TestServer_Tree(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("cfg/db/host"), []byte("localhost"))
+	db.Put([]byte("cfg/db/port"), []byte("5432"))
+	db.Put([]byte("cfg/log"), []byte("info"))
+	db.Put([]byte("other/x"), []byte("ignored"))
+
+	server := NewServer(ServerConfig{Addr: ":0"}, &engineNode{db}, watch.NewWatchHub())
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/kv/tree?prefix=cfg/", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码不匹配: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	want := map[string]interface{}{
+		"db":  map[string]interface{}{"host": "localhost", "port": "5432"},
+		"log": "info",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("响应不匹配:\n got  %v\n want %v", got, want)
+	}
+
+	// 无法放入树中的 key 返回 409 与冲突的 key
+	db.Put([]byte("cfg/db//host"), []byte("dup"))
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/kv/tree?prefix=cfg/&empty=collapse", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("路径重复时状态码不匹配: got %d, want %d", rec.Code, http.StatusConflict)
+	}
+	var conflict map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &conflict); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if conflict["key"] != "cfg/db/host" || conflict["other"] != "cfg/db//host" || conflict["reason"] != TreeReasonDuplicatePath {
+		t.Errorf("冲突响应不匹配: %v", conflict)
+	}
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/kv/tree?prefix=cfg/&empty=drop", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("不支持的 empty 状态码不匹配: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	plain := NewServer(ServerConfig{Addr: ":0"}, newMockNode(), watch.NewWatchHub())
+	rec = httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/kv/tree?prefix=cfg/", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("不支持前缀读取的节点状态码不匹配: got %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
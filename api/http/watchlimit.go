@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== Watch 连接数限制 ====================
+//
+// 每个 Watch 连接都会占用一个 Watcher 和一个长连接，单个客户端打开成千上万个连接就能耗尽服务端资源。
+// 启用后按客户端 IP 统计正在进行的 Watch 连接，超过上限的新请求返回 429，连接断开时释放名额。
+//
+// 客户端 IP 默认取 TCP 连接的对端地址。服务部署在反向代理之后时，所有请求的对端地址都是代理，
+// 应通过 WithTrustedProxyHeader 指定代理写入的请求头（例如 X-Forwarded-For 或 X-Real-IP）。
+// 只有在请求必然经过代理、客户端无法直连时才能信任该请求头，否则客户端可以伪造它绕过限制。
+
+// WithWatchLimitPerIP 设置每个客户端 IP 同时打开的 Watch 连接上限，n <= 0 表示不限制（默认）
+func WithWatchLimitPerIP(n int) ServerOption {
+	return func(o *ServerOptions) {
+		o.WatchLimitPerIP = n
+	}
+}
+
+// WithTrustedProxyHeader 设置从哪个请求头读取客户端 IP
+// 请求头包含多个地址时（例如 X-Forwarded-For: client, proxy1）取第一个；请求头缺失或无效时使用对端地址
+func WithTrustedProxyHeader(header string) ServerOption {
+	return func(o *ServerOptions) {
+		o.TrustedProxyHeader = header
+	}
+}
+
+// watchLimiter 按客户端 IP 统计正在进行的 Watch 连接
+type watchLimiter struct {
+	limit  int
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// newWatchLimiter 创建连接数限制，limit <= 0 时返回 nil 表示不限制
+func newWatchLimiter(limit int) *watchLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &watchLimiter{
+		limit:  limit,
+		counts: make(map[string]int),
+	}
+}
+
+// acquire 为 ip 占用一个名额，已达上限时返回 false
+func (l *watchLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip] >= l.limit {
+		return false
+	}
+	l.counts[ip]++
+	return true
+}
+
+// release 释放 ip 的一个名额
+func (l *watchLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip] <= 1 {
+		delete(l.counts, ip)
+		return
+	}
+	l.counts[ip]--
+}
+
+// count 返回 ip 正在进行的 Watch 连接数
+func (l *watchLimiter) count(ip string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[ip]
+}
+
+// acquireWatch 为请求的客户端 IP 占用一个 Watch 名额
+// 超过上限时返回 429 并返回 false；成功时返回释放名额的函数，连接结束时必须调用
+func (h *Handler) acquireWatch(c *gin.Context) (func(), bool) {
+	if h.watchLimits == nil {
+		return func() {}, true
+	}
+	ip := clientIP(c.Request, h.trustedProxyHeader)
+	if !h.watchLimits.acquire(ip) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many watch connections",
+			"limit": h.watchLimits.limit,
+		})
+		return nil, false
+	}
+	return func() { h.watchLimits.release(ip) }, true
+}
+
+// clientIP 返回请求的客户端 IP
+// header 不为空且包含有效 IP 时取其中第一个地址，否则取对端地址
+func clientIP(r *http.Request, header string) string {
+	if header != "" {
+		if value := r.Header.Get(header); value != "" {
+			first, _, _ := strings.Cut(value, ",")
+			if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage/index"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ==================== 索引分层指标 ====================
+
+var (
+	// IndexTierKeys 混合索引各层的 key 数量
+	IndexTierKeys = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tidekv_index_tier_keys",
+			Help: "Number of keys in each tier of the hybrid index",
+		},
+		[]string{"tier"},
+	)
+
+	// IndexTierPromotionsTotal 提升到各层的 key 总数（按目标层）
+	IndexTierPromotionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tidekv_index_tier_promotions_total",
+			Help: "Total number of keys promoted into each tier of the hybrid index",
+		},
+		[]string{"tier"},
+	)
+
+	// IndexTierDemotionsTotal 降级到各层的 key 总数（按目标层）
+	IndexTierDemotionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tidekv_index_tier_demotions_total",
+			Help: "Total number of keys demoted into each tier of the hybrid index",
+		},
+		[]string{"tier"},
+	)
+)
+
+// TierStatsSource 提供混合索引分层统计的数据源（例如 *bitcask.DB）
+type TierStatsSource interface {
+	TierStats() index.TierStats
+}
+
+// IndexTierCollector 定期采集混合索引的分层统计并更新指标
+type IndexTierCollector struct {
+	source TierStatsSource
+
+	mu   sync.Mutex
+	last index.TierStats // 上一次采集的累计迁移次数
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// StartIndexTierCollector 启动分层指标采集，立即采集一次，之后每隔 interval 采集一次
+// 参数：
+//   - source: 分层统计数据源
+//   - interval: 采集间隔
+//
+// 返回：
+//   - *IndexTierCollector: 采集器，不再使用时调用 Stop
+func StartIndexTierCollector(source TierStatsSource, interval time.Duration) *IndexTierCollector {
+	c := &IndexTierCollector{
+		source: source,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	c.Collect()
+
+	go func() {
+		defer close(c.doneCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+				c.Collect()
+			}
+		}
+	}()
+	return c
+}
+
+// Collect 采集一次分层统计
+// 层大小直接写入 Gauge；迁移次数是累计值，只把两次采集之间的增量累加到 Counter
+func (c *IndexTierCollector) Collect() {
+	stats := c.source.TierStats()
+
+	IndexTierKeys.WithLabelValues(string(index.TierHot)).Set(float64(stats.HotKeys))
+	IndexTierKeys.WithLabelValues(string(index.TierWarm)).Set(float64(stats.WarmKeys))
+	IndexTierKeys.WithLabelValues(string(index.TierCold)).Set(float64(stats.ColdKeys))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	IndexTierPromotionsTotal.WithLabelValues(string(index.TierWarm)).Add(counterDelta(stats.PromotionsToWarm, c.last.PromotionsToWarm))
+	IndexTierPromotionsTotal.WithLabelValues(string(index.TierHot)).Add(counterDelta(stats.PromotionsToHot, c.last.PromotionsToHot))
+	IndexTierDemotionsTotal.WithLabelValues(string(index.TierWarm)).Add(counterDelta(stats.DemotionsToWarm, c.last.DemotionsToWarm))
+	IndexTierDemotionsTotal.WithLabelValues(string(index.TierCold)).Add(counterDelta(stats.DemotionsToCold, c.last.DemotionsToCold))
+	c.last = stats
+}
+
+// Stop 停止定期采集
+func (c *IndexTierCollector) Stop() {
+	close(c.stopCh)
+	<-c.doneCh
+}
+
+// counterDelta 计算累计值的增量，数据源重置（例如重新打开数据库）时把当前值视为增量
+func counterDelta(cur, last int64) float64 {
+	if cur < last {
+		return float64(cur)
+	}
+	return float64(cur - last)
+}
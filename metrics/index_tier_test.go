@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/index"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIndexTierCollector(t *testing.T) {
+	hi := index.NewHybridIndex(
+		index.WithHotCapacity(2),
+		index.WithWarmCapacity(4),
+		index.WithPromoteThreshold(5),
+	)
+	defer hi.Close()
+
+	const totalKeys = 20
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%02d", i)) }
+	for i := 0; i < totalKeys; i++ {
+		hi.Put(key(i), &storage.Position{FileID: 1, Offset: int64(i)})
+	}
+
+	// 倾斜的访问模式：3 个高频 key 争夺 2 个热层位置，6 个中频 key 争夺 4 个温层位置，其余 key 不访问
+	for i := 0; i < 3; i++ {
+		for n := 0; n < 10; n++ {
+			hi.Get(key(i))
+		}
+	}
+	for i := 3; i < 9; i++ {
+		for n := 0; n < 2; n++ {
+			hi.Get(key(i))
+		}
+	}
+
+	promotedToWarm := testutil.ToFloat64(IndexTierPromotionsTotal.WithLabelValues("warm"))
+	promotedToHot := testutil.ToFloat64(IndexTierPromotionsTotal.WithLabelValues("hot"))
+	demotedToWarm := testutil.ToFloat64(IndexTierDemotionsTotal.WithLabelValues("warm"))
+	demotedToCold := testutil.ToFloat64(IndexTierDemotionsTotal.WithLabelValues("cold"))
+
+	collector := StartIndexTierCollector(hi, time.Hour)
+	defer collector.Stop()
+
+	gauges := map[string]float64{"hot": 2, "warm": 4, "cold": totalKeys - 6}
+	for tier, want := range gauges {
+		if got := testutil.ToFloat64(IndexTierKeys.WithLabelValues(tier)); got != want {
+			t.Errorf("%s 层 key 数量不匹配: got %v, want %v", tier, got, want)
+		}
+	}
+
+	counters := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"提升到温层", testutil.ToFloat64(IndexTierPromotionsTotal.WithLabelValues("warm")) - promotedToWarm, 9},
+		{"提升到热层", testutil.ToFloat64(IndexTierPromotionsTotal.WithLabelValues("hot")) - promotedToHot, 3},
+		{"降级到温层", testutil.ToFloat64(IndexTierDemotionsTotal.WithLabelValues("warm")) - demotedToWarm, 1},
+		{"降级到冷层", testutil.ToFloat64(IndexTierDemotionsTotal.WithLabelValues("cold")) - demotedToCold, 3},
+	}
+	for _, c := range counters {
+		if c.got != c.want {
+			t.Errorf("%s次数不匹配: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	// 没有新的迁移时再次采集，计数器保持不变
+	collector.Collect()
+	if got := testutil.ToFloat64(IndexTierPromotionsTotal.WithLabelValues("hot")) - promotedToHot; got != 3 {
+		t.Errorf("重复采集不应增加计数: got %v, want 3", got)
+	}
+}
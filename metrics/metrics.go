@@ -68,6 +68,15 @@ var (
 		Help: "Total number of Bloom filter positive results",
 	})
 
+	// StorageCorruptionTotal 读到 CRC 校验失败的 Entry 的次数（按处理策略）
+	StorageCorruptionTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tidekv_storage_corruption_total",
+			Help: "Total number of corrupted entries encountered on read",
+		},
+		[]string{"policy"},
+	)
+
 	// ==================== Raft 指标 ====================
 
 	// RaftCommitIndex 当前提交索引
@@ -107,6 +116,12 @@ var (
 		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
 	})
 
+	// RaftApplyErrorsTotal FSM 应用日志失败的次数
+	RaftApplyErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tidekv_raft_apply_errors_total",
+		Help: "Total number of Raft log entries the FSM failed to apply",
+	})
+
 	// RaftIsLeader 当前是否为 Leader
 	RaftIsLeader = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "tidekv_raft_is_leader",
@@ -127,6 +142,12 @@ var (
 		Help: "Total number of watch events sent",
 	})
 
+	// WatchEventsDroppedTotal FSM 产生的 Watch 事件因分发队列已满被丢弃的次数
+	WatchEventsDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tidekv_watch_events_dropped_total",
+		Help: "Total number of watch events dropped because the dispatch queue was full",
+	})
+
 	// WatchEventDurationMs Watch 事件发送耗时（毫秒）
 	WatchEventDurationMs = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name:    "tidekv_watch_event_duration_milliseconds",
@@ -190,6 +211,16 @@ func RecordDelete() {
 	StorageDeleteTotal.Inc()
 }
 
+// RecordCorruption 记录一次读到损坏 Entry
+func RecordCorruption(policy string) {
+	StorageCorruptionTotal.WithLabelValues(policy).Inc()
+}
+
+// RecordWatchEventDropped 记录一次因分发队列已满被丢弃的 Watch 事件
+func RecordWatchEventDropped() {
+	WatchEventsDroppedTotal.Inc()
+}
+
 // RecordBloomFilterCheck 记录一次布隆过滤器检查（hit 表示是否可能存在）
 func RecordBloomFilterCheck(hit bool) {
 	StorageBloomFilterCheckTotal.Inc()
@@ -204,6 +235,11 @@ func RecordApply(durationMs float64) {
 	RaftApplyDurationMs.Observe(durationMs)
 }
 
+// RecordApplyError 记录一次应用日志失败
+func RecordApplyError() {
+	RaftApplyErrorsTotal.Inc()
+}
+
 // RecordHTTPRequest 记录一次 HTTP 请求
 func RecordHTTPRequest(method, path, status string, durationMs float64) {
 	HTTPRequestsTotal.WithLabelValues(method, path, status).Inc()
@@ -0,0 +1,165 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/hashicorp/raft"
+)
+
+// ==================== 写入确认级别 ====================
+//
+// AckLevel 决定写入在返回前需要得到多强的确认，用延迟换取持久性：
+//   - AckLeader：提交到 Leader 的日志队列后立即返回，不等待复制与应用。延迟最低，
+//     但 Leader 在复制完成前宕机时写入可能丢失，且紧随其后的读取可能看不到该写入。
+//   - AckQuorum：日志复制到多数派并在 Leader 上应用后返回（Raft 默认语义）。
+//     已确认的写入在任意少数节点故障时都不会丢失。
+//   - AckAll：在 Quorum 的基础上，继续等待所有 voter 都应用了该日志。
+//     返回后从任意节点读取都能看到该写入；任一 voter 缓慢或不可用都会拖慢甚至阻塞写入。
+
+// AckLevel 写入确认级别，零值为 AckQuorum
+type AckLevel int
+
+const (
+	// AckQuorum 多数派确认（默认）
+	AckQuorum AckLevel = iota
+	// AckLeader 仅 Leader 接收
+	AckLeader
+	// AckAll 所有 voter 均已应用
+	AckAll
+)
+
+// ackAllPollInterval AckAll 轮询 Follower 应用进度的间隔
+const ackAllPollInterval = 10 * time.Millisecond
+
+// ackAllTimeout AckAll 等待所有 voter 应用的最长时间
+const ackAllTimeout = 5 * time.Second
+
+// String 返回确认级别的名称
+func (l AckLevel) String() string {
+	switch l {
+	case AckQuorum:
+		return "quorum"
+	case AckLeader:
+		return "leader"
+	case AckAll:
+		return "all"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(l))
+	}
+}
+
+// ParseAckLevel 解析确认级别名称（不区分大小写）
+// 参数：
+//   - s: leader / quorum / all
+//
+// 返回：
+//   - AckLevel: 确认级别
+//   - error: 无法识别时返回错误
+func ParseAckLevel(s string) (AckLevel, error) {
+	switch strings.ToLower(s) {
+	case "quorum":
+		return AckQuorum, nil
+	case "leader":
+		return AckLeader, nil
+	case "all":
+		return AckAll, nil
+	default:
+		return AckQuorum, fmt.Errorf("未知的确认级别: %q", s)
+	}
+}
+
+// AppliedIndexProber 查询指定节点已应用到状态机的日志索引，用于 AckAll
+//
+// 参数：
+//   - server: 集群中的节点
+//
+// 返回：
+//   - uint64: 该节点的 applied index
+//   - error: 查询错误
+type AppliedIndexProber func(server raft.Server) (uint64, error)
+
+// waitAllApplied 等待所有 voter 都应用了 index 处的日志
+// Leader 自身在 Apply 返回时已经应用，无需查询
+func (n *Node) waitAllApplied(index uint64) error {
+	if n.config == nil || n.config.AppliedIndexProber == nil {
+		return fmt.Errorf("%w: 未配置 AppliedIndexProber", ErrAckUnavailable)
+	}
+
+	servers, err := n.Configuration()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(ackAllTimeout)
+	for _, server := range servers {
+		if server.Suffrage != raft.Voter || server.ID == n.config.NodeID {
+			continue
+		}
+		for {
+			applied, err := n.config.AppliedIndexProber(server)
+			if err == nil && applied >= index {
+				break
+			}
+			if time.Now().After(deadline) {
+				if err != nil {
+					return fmt.Errorf("%w: 节点 %s: %v", ErrAckTimeout, server.ID, err)
+				}
+				return fmt.Errorf("%w: 节点 %s 已应用 %d, 需要 %d", ErrAckTimeout, server.ID, applied, index)
+			}
+			time.Sleep(ackAllPollInterval)
+		}
+	}
+	return nil
+}
+
+// ==================== 持久化写入 ====================
+
+// PutDurable 写入键值对，在写入按 level 得到确认、并且 Leader 的存储引擎已同步到磁盘后才返回
+// 把复制与落盘两种保证合并为一次调用：返回 nil 时写入既不会因少数节点故障丢失，也不会因 Leader 掉电丢失。
+// AckLeader 不等待写入在 Leader 上应用，无法保证落盘，因此不支持。
+//
+// 参数：
+//   - ctx: 上下文，取消或超时后立即返回 ctx.Err()，此时写入可能已经提交
+//   - key: 键
+//   - value: 值
+//   - level: 确认级别，AckQuorum 或 AckAll
+//
+// 返回：
+//   - error: 写入错误；AckLeader 返回 ErrAckUnavailable，存储引擎不支持同步时返回 storage.ErrNotSupported
+func (n *Node) PutDurable(ctx context.Context, key []byte, value []byte, level AckLevel) error {
+	if level == AckLeader {
+		return fmt.Errorf("%w: AckLeader 不等待应用，无法保证落盘", ErrAckUnavailable)
+	}
+	syncer, ok := n.engine.(storage.Syncer)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if err := n.PutWithAck(key, value, level); err != nil {
+			done <- err
+			return
+		}
+		// PutWithAck 返回时写入已在本节点（Leader）应用，同步后即已落盘
+		if err := syncer.Sync(); err != nil {
+			done <- fmt.Errorf("同步存储引擎失败: %w", err)
+			return
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
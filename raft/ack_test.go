@@ -0,0 +1,288 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/hashicorp/raft"
+)
+
+// gatedEngine 可以暂停 Put 的存储引擎，用于模拟应用缓慢的 Follower
+type gatedEngine struct {
+	*bitcask.DB
+	mu    sync.Mutex
+	gate  chan struct{}
+	fail  error // 不为 nil 时 Put 与 PutAt 直接返回该错误
+	syncs int   // Sync 的调用次数
+}
+
+func (e *gatedEngine) block() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.gate = make(chan struct{})
+}
+
+func (e *gatedEngine) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.gate != nil {
+		close(e.gate)
+		e.gate = nil
+	}
+}
+
+// failWith 让之后的 Put 与 PutAt 返回 err，err 为 nil 时恢复正常写入
+func (e *gatedEngine) failWith(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fail = err
+}
+
+func (e *gatedEngine) Put(key []byte, value []byte) error {
+	return e.PutAt(key, value, 0)
+}
+
+// PutAt 与 Put 相同地暂停或失败，FSM 以日志索引作为版本号写入时调用
+func (e *gatedEngine) PutAt(key []byte, value []byte, version uint64) error {
+	e.mu.Lock()
+	gate, fail := e.gate, e.fail
+	e.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	if fail != nil {
+		return fail
+	}
+	return e.DB.PutAt(key, value, version)
+}
+
+func (e *gatedEngine) Sync() error {
+	e.mu.Lock()
+	e.syncs++
+	e.mu.Unlock()
+	return e.DB.Sync()
+}
+
+func (e *gatedEngine) syncCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.syncs
+}
+
+// freeAddr 返回一个本地空闲的 TCP 地址
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("分配端口失败: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// startCluster 在本地启动一个 n 节点的集群，并等待选出 Leader
+// configure 可以在创建节点前修改第 i 个节点的配置
+func startCluster(t *testing.T, n int, configure ...func(i int, config *NodeConfig)) ([]*Node, []*gatedEngine) {
+	peers := make([]raft.Server, n)
+	for i := range peers {
+		peers[i] = raft.Server{
+			ID:       raft.ServerID(fmt.Sprintf("node-%d", i)),
+			Address:  raft.ServerAddress(freeAddr(t)),
+			Suffrage: raft.Voter,
+		}
+	}
+
+	nodes := make([]*Node, n)
+	engines := make([]*gatedEngine, n)
+	byID := make(map[raft.ServerID]*Node)
+	prober := func(server raft.Server) (uint64, error) {
+		node, ok := byID[server.ID]
+		if !ok {
+			return 0, fmt.Errorf("未知节点: %s", server.ID)
+		}
+		return node.AppliedIndex(), nil
+	}
+
+	for i, peer := range peers {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		db, err := bitcask.Open(dir)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		engines[i] = &gatedEngine{DB: db}
+
+		config := (&NodeConfig{
+			NodeID:    peer.ID,
+			BindAddr:  string(peer.Address),
+			DataDir:   dir,
+			Bootstrap: true,
+			Peers:     peers,
+		}).WithAppliedIndexProber(prober)
+		for _, fn := range configure {
+			fn(i, config)
+		}
+		node, err := NewNode(engines[i], config)
+		if err != nil {
+			t.Fatalf("创建节点失败: %v", err)
+		}
+		nodes[i] = node
+		byID[peer.ID] = node
+	}
+	t.Cleanup(func() {
+		for i, node := range nodes {
+			engines[i].release()
+			node.Close()
+		}
+	})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, node := range nodes {
+			if node.IsLeader() {
+				return nodes, engines
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("超时未选出 Leader")
+	return nil, nil
+}
+
+func TestNode_PutWithAckAll(t *testing.T) {
+	nodes, engines := startCluster(t, 3)
+
+	var leader *Node
+	var follower int
+	for i, node := range nodes {
+		if node.IsLeader() {
+			leader = node
+		} else {
+			follower = i
+		}
+	}
+
+	// 阻塞一个 Follower 的状态机：多数派仍可提交，但该 Follower 无法应用
+	engines[follower].block()
+
+	// Quorum 不受影响
+	if err := leader.PutWithAck([]byte("q"), []byte("1"), AckQuorum); err != nil {
+		t.Fatalf("Quorum 写入失败: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- leader.PutWithAck([]byte("k"), []byte("v"), AckAll)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Follower 未应用时 All 写入不应返回, 得到: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	engines[follower].release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("All 写入失败: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Follower 恢复后 All 写入仍未返回")
+	}
+
+	// All 返回时每个节点都已应用，本地读取都能看到
+	for i, node := range nodes {
+		if val, err := node.Get([]byte("k")); err != nil || string(val) != "v" {
+			t.Errorf("节点 %d 未应用写入: got %s, err %v", i, val, err)
+		}
+	}
+
+	// Leader 级别的写入不能由 Follower 接收
+	if err := nodes[follower].PutWithAck([]byte("l"), []byte("1"), AckLeader); !errors.Is(err, raft.ErrNotLeader) {
+		t.Errorf("Follower 上的 Leader 级别写入应返回 ErrNotLeader, 得到: %v", err)
+	}
+}
+
+func TestNode_PutDurable(t *testing.T) {
+	nodes, engines := startCluster(t, 3)
+
+	leader, follower := -1, -1
+	for i, node := range nodes {
+		if node.IsLeader() {
+			leader = i
+		} else {
+			follower = i
+		}
+	}
+
+	// Follower 未应用时 All 级别的持久化写入不返回，Leader 也还没有同步
+	engines[follower].block()
+	done := make(chan error, 1)
+	go func() {
+		done <- nodes[leader].PutDurable(context.Background(), []byte("k"), []byte("v"), AckAll)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Follower 未应用时不应返回, 得到: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if n := engines[leader].syncCount(); n != 0 {
+		t.Fatalf("得到全部确认之前不应同步: %d 次", n)
+	}
+
+	engines[follower].release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("持久化写入失败: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Follower 恢复后持久化写入仍未返回")
+	}
+	if n := engines[leader].syncCount(); n != 1 {
+		t.Errorf("返回时 Leader 应已同步一次: %d 次", n)
+	}
+	if val, err := nodes[follower].Get([]byte("k")); err != nil || string(val) != "v" {
+		t.Errorf("Follower 未应用写入: got %s, err %v", val, err)
+	}
+
+	// 上下文超时后立即返回
+	engines[follower].block()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := nodes[leader].PutDurable(ctx, []byte("k"), []byte("v2"), AckAll); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("超时应返回 context.DeadlineExceeded, 得到: %v", err)
+	}
+	engines[follower].release()
+
+	// Leader 级别不等待应用，无法保证落盘
+	if err := nodes[leader].PutDurable(context.Background(), []byte("k"), []byte("v"), AckLeader); !errors.Is(err, ErrAckUnavailable) {
+		t.Errorf("AckLeader 应返回 ErrAckUnavailable, 得到: %v", err)
+	}
+}
+
+func TestParseAckLevel(t *testing.T) {
+	for _, level := range []AckLevel{AckLeader, AckQuorum, AckAll} {
+		got, err := ParseAckLevel(level.String())
+		if err != nil || got != level {
+			t.Errorf("解析 %s 失败: got %v, err %v", level, got, err)
+		}
+	}
+	if got, err := ParseAckLevel("ALL"); err != nil || got != AckAll {
+		t.Errorf("应不区分大小写: got %v, err %v", got, err)
+	}
+	if _, err := ParseAckLevel("majority"); err == nil {
+		t.Errorf("未知级别应返回错误")
+	}
+}
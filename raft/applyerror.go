@@ -0,0 +1,79 @@
+package raft
+
+import (
+	"github.com/forever-free1/TideKV/metrics"
+	"github.com/hashicorp/raft"
+)
+
+// ==================== 应用错误 ====================
+//
+// FSM 应用日志失败（例如存储引擎写入出错）时，错误会通过 ApplyFuture 返回给发起写入的调用方，
+// 但 Follower 上的应用以及 Leader 上调用方已经放弃等待的应用没有人接收这个错误。
+// 同一条日志在某个节点上应用失败、在其他节点上成功，意味着副本之间可能已经不一致，
+// 因此每次失败都会记录到 ApplyErrorCh，供运维订阅告警。
+//
+// 报告不会阻塞 Apply：通道已满时丢弃并计数，见 ApplyErrorsDropped。
+
+// defaultApplyErrorQueueSize 应用错误通道的默认容量
+const defaultApplyErrorQueueSize = 64
+
+// ApplyError 一次应用失败的日志
+type ApplyError struct {
+	Index uint64      // 日志索引
+	Term  uint64      // 日志任期
+	Type  CommandType // 命令类型，命令无法解析时为空
+	Key   []byte      // 单 key 命令的键，批量与前缀替换命令为 nil
+	Data  []byte      // 日志中编码后的完整命令
+	Err   error       // 应用时返回的错误
+}
+
+// WithApplyErrorQueueSize 设置应用错误通道的容量，<= 0 表示使用默认值（64）
+func (c *NodeConfig) WithApplyErrorQueueSize(size int) *NodeConfig {
+	c.ApplyErrorQueueSize = size
+	return c
+}
+
+// ApplyErrorCh 返回报告应用失败的通道
+// 所有订阅者共享同一个通道，每个错误只会被其中一个接收；通道不会被关闭
+func (f *BitcaskFSM) ApplyErrorCh() <-chan ApplyError {
+	return f.applyErrors
+}
+
+// ApplyErrorsDropped 返回因通道已满未能报告的应用失败次数
+func (f *BitcaskFSM) ApplyErrorsDropped() uint64 {
+	return f.applyErrorsDropped.Load()
+}
+
+// reportApplyError 记录一次应用失败，通道已满时不阻塞，丢弃并计数
+func (f *BitcaskFSM) reportApplyError(log *raft.Log, err error) {
+	metrics.RecordApplyError()
+
+	applyErr := ApplyError{
+		Index: log.Index,
+		Term:  log.Term,
+		Data:  log.Data,
+		Err:   err,
+	}
+	var cmd LogCommand
+	if decodeCommand(log.Data, &cmd) == nil {
+		applyErr.Type = cmd.Type
+		applyErr.Key = cmd.Key
+	}
+
+	select {
+	case f.applyErrors <- applyErr:
+	default:
+		f.applyErrorsDropped.Add(1)
+	}
+}
+
+// ApplyErrorCh 返回本节点 FSM 报告应用失败的通道，见 BitcaskFSM.ApplyErrorCh
+// 本节点应用的每条日志都会报告，包括从 Leader 复制来的日志
+func (n *Node) ApplyErrorCh() <-chan ApplyError {
+	return n.fsm.ApplyErrorCh()
+}
+
+// ApplyErrorsDropped 返回本节点因通道已满未能报告的应用失败次数
+func (n *Node) ApplyErrorsDropped() uint64 {
+	return n.fsm.ApplyErrorsDropped()
+}
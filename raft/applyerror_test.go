@@ -0,0 +1,111 @@
+package raft
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/hashicorp/raft"
+)
+
+func TestFSM_ApplyErrorCh(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	engine := &gatedEngine{DB: db}
+	fsm := NewBitcaskFSM(engine)
+	fsm.applyErrors = make(chan ApplyError, 1)
+
+	// 成功的应用不报告
+	applyCommand(t, fsm, 1, &LogCommand{Type: CommandPut, Key: []byte("k"), Value: []byte("v")})
+	select {
+	case applyErr := <-fsm.ApplyErrorCh():
+		t.Fatalf("成功的应用不应报告错误: %+v", applyErr)
+	default:
+	}
+
+	errDisk := errors.New("磁盘已满")
+	engine.failWith(errDisk)
+	data, err := encodeCommand(&LogCommand{Type: CommandPut, Key: []byte("k"), Value: []byte("v2")})
+	if err != nil {
+		t.Fatalf("编码命令失败: %v", err)
+	}
+	result := fsm.Apply(&raft.Log{Index: 2, Term: 3, Data: data})
+	if err, ok := result.(error); !ok || !errors.Is(err, errDisk) {
+		t.Fatalf("Apply 应返回引擎的错误: %v", result)
+	}
+
+	select {
+	case applyErr := <-fsm.ApplyErrorCh():
+		if applyErr.Index != 2 || applyErr.Term != 3 || applyErr.Type != CommandPut || string(applyErr.Key) != "k" {
+			t.Errorf("应用错误不匹配: %+v", applyErr)
+		}
+		if !errors.Is(applyErr.Err, errDisk) {
+			t.Errorf("应用错误应包含引擎的错误: %v", applyErr.Err)
+		}
+		var cmd LogCommand
+		if err := decodeCommand(applyErr.Data, &cmd); err != nil || string(cmd.Value) != "v2" {
+			t.Errorf("应用错误应包含完整命令: %+v, %v", cmd, err)
+		}
+	default:
+		t.Fatalf("应用失败应报告到通道")
+	}
+
+	// 无法解析的命令同样报告；通道已满时不阻塞，丢弃并计数
+	fsm.Apply(&raft.Log{Index: 3, Data: []byte{0xc1}})
+	fsm.Apply(&raft.Log{Index: 4, Data: []byte{0xc1}})
+	if dropped := fsm.ApplyErrorsDropped(); dropped != 1 {
+		t.Errorf("丢弃计数不匹配: got %d, want 1", dropped)
+	}
+	if applyErr := <-fsm.ApplyErrorCh(); applyErr.Index != 3 || applyErr.Type != "" {
+		t.Errorf("无法解析的命令报告不匹配: %+v", applyErr)
+	}
+}
+
+func TestNode_ApplyErrorCh(t *testing.T) {
+	nodes, engines := startCluster(t, 3)
+
+	leader, follower := -1, -1
+	for i, node := range nodes {
+		if node.IsLeader() {
+			leader = i
+		} else if follower < 0 {
+			follower = i
+		}
+	}
+
+	// 只有一个 Follower 的引擎写入失败，Leader 上的写入仍然成功
+	errDisk := errors.New("磁盘已满")
+	engines[follower].failWith(errDisk)
+	if err := nodes[leader].Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	select {
+	case applyErr := <-nodes[follower].ApplyErrorCh():
+		if applyErr.Type != CommandPut || string(applyErr.Key) != "k" || applyErr.Index == 0 {
+			t.Errorf("应用错误不匹配: %+v", applyErr)
+		}
+		if !errors.Is(applyErr.Err, errDisk) {
+			t.Errorf("应用错误应包含引擎的错误: %v", applyErr.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("超时未收到 Follower 的应用错误")
+	}
+
+	select {
+	case applyErr := <-nodes[leader].ApplyErrorCh():
+		t.Errorf("Leader 上的应用不应失败: %+v", applyErr)
+	default:
+	}
+}
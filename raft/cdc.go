@@ -0,0 +1,167 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ==================== 变更数据捕获 (CDC) ====================
+//
+// ChangeHook 在每条写入/删除被 FSM 应用之后调用，用于把变更转发到 Kafka、Webhook 等外部系统。
+// 与 Watch 不同，Hook 不依赖客户端长连接，投递语义为至少一次：
+//   - 变更先进入有界队列，由单独的 goroutine 按提交顺序投递，慢 Hook 不会阻塞写入；
+//   - 投递失败时按 RetryBackoff 重试，超过 MaxRetries 后交给 OnError；
+//   - 队列已满或节点关闭时未投递的变更同样交给 OnError，不会静默丢弃。
+//
+// 注意：集群中每个节点应用日志时都会调用 Hook，下游可以使用 Change.Index 去重。
+
+// ErrChangeQueueFull 表示变更队列已满，变更未能入队
+var ErrChangeQueueFull = errors.New("change queue is full")
+
+// ErrChangeHookClosed 表示节点已关闭，变更未能投递
+var ErrChangeHookClosed = errors.New("change hook closed")
+
+// ChangeType 变更类型
+type ChangeType string
+
+const (
+	ChangeTypePut    ChangeType = "put"
+	ChangeTypeDelete ChangeType = "delete"
+)
+
+// Change 一次已提交的变更
+type Change struct {
+	Index  uint64     // 所在 Raft 日志的索引
+	Type   ChangeType // 变更类型
+	Key    []byte     // 键
+	Before []byte     // 变更前的值，key 原本不存在时为 nil
+	After  []byte     // 变更后的值，删除时为 nil
+}
+
+// ChangeHook 变更回调
+type ChangeHook interface {
+	// OnChange 处理一次变更，返回错误时会重试
+	// ctx 在节点关闭时取消
+	OnChange(ctx context.Context, change Change) error
+}
+
+// ChangeHookOptions 变更投递的配置，零值字段使用默认值
+type ChangeHookOptions struct {
+	// QueueSize 变更队列容量（默认 1024）
+	QueueSize int
+
+	// MaxRetries 单个变更投递失败后的最大重试次数（默认 3，负数表示不重试）
+	MaxRetries int
+
+	// RetryBackoff 重试间隔（默认 100ms）
+	RetryBackoff time.Duration
+
+	// OnError 变更最终未能投递时调用（可选）
+	OnError func(change Change, err error)
+}
+
+// withDefaults 返回填充了默认值的配置
+func (o ChangeHookOptions) withDefaults() ChangeHookOptions {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1024
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	} else if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 100 * time.Millisecond
+	}
+	return o
+}
+
+// changeDispatcher 异步投递变更
+type changeDispatcher struct {
+	hook   ChangeHook
+	opts   ChangeHookOptions
+	queue  chan Change
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newChangeDispatcher 创建变更投递器并启动投递 goroutine
+func newChangeDispatcher(hook ChangeHook, opts ChangeHookOptions) *changeDispatcher {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &changeDispatcher{
+		hook:   hook,
+		opts:   opts,
+		queue:  make(chan Change, opts.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// enqueue 将变更放入队列，队列已满时不阻塞，直接交给 OnError
+func (d *changeDispatcher) enqueue(change Change) {
+	select {
+	case d.queue <- change:
+	default:
+		d.fail(change, ErrChangeQueueFull)
+	}
+}
+
+// run 按入队顺序投递变更
+func (d *changeDispatcher) run() {
+	defer close(d.done)
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case change := <-d.queue:
+			d.deliver(change)
+		}
+	}
+}
+
+// deliver 投递单个变更，失败时重试
+func (d *changeDispatcher) deliver(change Change) {
+	var err error
+	for attempt := 0; attempt <= d.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(d.opts.RetryBackoff):
+			case <-d.ctx.Done():
+				d.fail(change, ErrChangeHookClosed)
+				return
+			}
+		}
+		if err = d.hook.OnChange(d.ctx, change); err == nil {
+			return
+		}
+	}
+	d.fail(change, err)
+}
+
+// fail 报告未能投递的变更
+func (d *changeDispatcher) fail(change Change, err error) {
+	if d.opts.OnError != nil {
+		d.opts.OnError(change, err)
+	}
+}
+
+// close 停止投递，队列中剩余的变更交给 OnError
+// 调用前必须确保不会再有新的变更入队
+func (d *changeDispatcher) close() {
+	d.cancel()
+	<-d.done
+	for {
+		select {
+		case change := <-d.queue:
+			d.fail(change, ErrChangeHookClosed)
+		default:
+			return
+		}
+	}
+}
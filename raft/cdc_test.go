@@ -0,0 +1,226 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/hashicorp/raft"
+)
+
+// recordingHook 记录收到的全部变更，可以让前若干次调用失败
+type recordingHook struct {
+	mu       sync.Mutex
+	changes  []Change
+	attempts int
+	failures int // 剩余需要失败的次数
+}
+
+func (h *recordingHook) OnChange(ctx context.Context, change Change) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attempts++
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("下游暂时不可用")
+	}
+	h.changes = append(h.changes, change)
+	return nil
+}
+
+// wait 等待至少收到 n 个变更，返回收到的全部变更
+func (h *recordingHook) wait(t *testing.T, n int) []Change {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		h.mu.Lock()
+		got := append([]Change(nil), h.changes...)
+		h.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("超时未收到 %d 个变更", n)
+	return nil
+}
+
+// newTestFSM 创建配置了 ChangeHook 的 FSM
+func newTestFSM(t *testing.T, hook ChangeHook, opts ChangeHookOptions) *BitcaskFSM {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	fsm := NewBitcaskFSM(db)
+	fsm.changes = newChangeDispatcher(hook, opts)
+	t.Cleanup(fsm.changes.close)
+	return fsm
+}
+
+// applyCommand 以指定的日志索引将命令应用到 FSM
+func applyCommand(t *testing.T, fsm *BitcaskFSM, index uint64, cmd *LogCommand) {
+	data, err := encodeCommand(cmd)
+	if err != nil {
+		t.Fatalf("编码命令失败: %v", err)
+	}
+	if err, ok := fsm.Apply(&raft.Log{Index: index, Data: data}).(error); ok && err != nil {
+		t.Fatalf("Apply 失败: %v", err)
+	}
+}
+
+func TestFSM_ChangeHook(t *testing.T) {
+	hook := &recordingHook{}
+	fsm := newTestFSM(t, hook, ChangeHookOptions{})
+
+	applyCommand(t, fsm, 1, &LogCommand{Type: CommandPut, Key: []byte("a"), Value: []byte("1")})
+	applyCommand(t, fsm, 2, &LogCommand{Type: CommandPut, Key: []byte("a"), Value: []byte("2")})
+	applyCommand(t, fsm, 3, &LogCommand{Type: CommandDelete, Key: []byte("a")})
+	applyCommand(t, fsm, 4, &LogCommand{Type: CommandPut, Key: []byte("b"), Value: []byte("x")})
+
+	want := []Change{
+		{Index: 1, Type: ChangeTypePut, Key: []byte("a"), After: []byte("1")},
+		{Index: 2, Type: ChangeTypePut, Key: []byte("a"), Before: []byte("1"), After: []byte("2")},
+		{Index: 3, Type: ChangeTypeDelete, Key: []byte("a"), Before: []byte("2")},
+		{Index: 4, Type: ChangeTypePut, Key: []byte("b"), After: []byte("x")},
+	}
+	got := hook.wait(t, len(want))
+
+	// 等待一段时间，确认没有重复投递
+	time.Sleep(50 * time.Millisecond)
+	got = hook.wait(t, len(want))
+	if len(got) != len(want) {
+		t.Fatalf("每次写入应恰好投递一次: got %d 个变更, want %d", len(got), len(want))
+	}
+	for i := range want {
+		assertChange(t, got[i], want[i])
+	}
+}
+
+func TestFSM_ChangeHookReplacePrefix(t *testing.T) {
+	hook := &recordingHook{}
+	fsm := newTestFSM(t, hook, ChangeHookOptions{})
+
+	applyCommand(t, fsm, 1, &LogCommand{Type: CommandPut, Key: []byte("cfg/a"), Value: []byte("1")})
+	applyCommand(t, fsm, 2, &LogCommand{Type: CommandPut, Key: []byte("cfg/b"), Value: []byte("2")})
+
+	data, err := encodeReplacePrefixCommand(&ReplacePrefixCommand{
+		Type:   CommandReplacePrefix,
+		Prefix: []byte("cfg/"),
+		Items: []storage.KV{
+			{Key: []byte("cfg/b"), Value: []byte("3")},
+			{Key: []byte("cfg/c"), Value: []byte("4")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("编码命令失败: %v", err)
+	}
+	if err, ok := fsm.Apply(&raft.Log{Index: 3, Data: data}).(error); ok && err != nil {
+		t.Fatalf("Apply 失败: %v", err)
+	}
+
+	got := hook.wait(t, 5)
+	want := []Change{
+		{Index: 3, Type: ChangeTypeDelete, Key: []byte("cfg/a"), Before: []byte("1")},
+		{Index: 3, Type: ChangeTypePut, Key: []byte("cfg/b"), Before: []byte("2"), After: []byte("3")},
+		{Index: 3, Type: ChangeTypePut, Key: []byte("cfg/c"), After: []byte("4")},
+	}
+	for i := range want {
+		assertChange(t, got[2+i], want[i])
+	}
+}
+
+func TestFSM_ChangeHookRetry(t *testing.T) {
+	hook := &recordingHook{failures: 2}
+	fsm := newTestFSM(t, hook, ChangeHookOptions{MaxRetries: 3, RetryBackoff: time.Millisecond})
+
+	applyCommand(t, fsm, 1, &LogCommand{Type: CommandPut, Key: []byte("k"), Value: []byte("v")})
+
+	got := hook.wait(t, 1)
+	assertChange(t, got[0], Change{Index: 1, Type: ChangeTypePut, Key: []byte("k"), After: []byte("v")})
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if hook.attempts != 3 {
+		t.Errorf("重试次数不匹配: got %d 次调用, want 3", hook.attempts)
+	}
+}
+
+// blockingHook 在 release 关闭前阻塞所有调用
+type blockingHook struct {
+	release chan struct{}
+}
+
+func (h *blockingHook) OnChange(ctx context.Context, change Change) error {
+	select {
+	case <-h.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestFSM_ChangeHookDoesNotBlockWrites(t *testing.T) {
+	hook := &blockingHook{release: make(chan struct{})}
+	defer close(hook.release)
+
+	var mu sync.Mutex
+	var failed []error
+	fsm := newTestFSM(t, hook, ChangeHookOptions{
+		QueueSize: 1,
+		OnError: func(change Change, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		},
+	})
+
+	data, err := encodeCommand(&LogCommand{Type: CommandPut, Key: []byte("k"), Value: []byte("v")})
+	if err != nil {
+		t.Fatalf("编码命令失败: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint64(1); i <= 5; i++ {
+			fsm.Apply(&raft.Log{Index: i, Data: data})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Hook 阻塞时写入不应被阻塞")
+	}
+
+	// 一个变更正在投递，一个在队列中，其余因队列已满交给 OnError
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) < 3 {
+		t.Fatalf("队列已满的变更应交给 OnError: got %d 个", len(failed))
+	}
+	for _, err := range failed {
+		if !errors.Is(err, ErrChangeQueueFull) {
+			t.Errorf("错误不匹配: got %v, want ErrChangeQueueFull", err)
+		}
+	}
+}
+
+func assertChange(t *testing.T, got, want Change) {
+	t.Helper()
+	if got.Index != want.Index || got.Type != want.Type || string(got.Key) != string(want.Key) ||
+		string(got.Before) != string(want.Before) || (got.Before == nil) != (want.Before == nil) ||
+		string(got.After) != string(want.After) || (got.After == nil) != (want.After == nil) {
+		t.Errorf("变更不匹配:\n got  %+v\n want %+v", got, want)
+	}
+}
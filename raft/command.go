@@ -1,13 +1,19 @@
 package raft
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"sync/atomic"
 
 	"github.com/hashicorp/go-msgpack/v2/codec"
 	"github.com/hashicorp/raft"
 	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/watch"
 )
 
 // ==================== 命令定义 ====================
@@ -16,9 +22,12 @@ import (
 type CommandType string
 
 const (
-	CommandPut     CommandType = "put"
-	CommandDelete  CommandType = "delete"
-	CommandBatch   CommandType = "batch"
+	CommandPut           CommandType = "put"
+	CommandDelete        CommandType = "delete"
+	CommandBatch         CommandType = "batch"
+	CommandReplacePrefix CommandType = "replace_prefix"
+	CommandPutIfVersion  CommandType = "put_if_version"
+	CommandAppend        CommandType = "append"
 )
 
 // LogCommand 用于在 Raft 集群间序列化和传递的用户指令
@@ -30,6 +39,21 @@ type LogCommand struct {
 	// 命令参数
 	Key   []byte `msgpack:"key"`
 	Value []byte `msgpack:"value,omitempty"` // Put 时需要
+
+	// 条件写入期望的当前版本号（最后一次写入该 key 的日志索引），PutIfVersion 时需要
+	ExpectedSeq uint64 `msgpack:"expected_seq,omitempty"`
+}
+
+// PutIfVersionResult 条件写入命令的执行结果
+type PutIfVersionResult struct {
+	Seq uint64 // 写入成功时为新的版本号，否则为 key 当前的版本号
+	OK  bool   // 是否写入
+}
+
+// DeleteResult 删除命令的执行结果（存储引擎支持 storage.DeleteReturner 时）
+type DeleteResult struct {
+	PrevValue []byte // 删除前的值
+	Found     bool   // 删除前 key 是否存在
 }
 
 // BatchCommandItem 批量命令中的单个命令项
@@ -41,21 +65,78 @@ type BatchCommandItem struct {
 
 // BatchCommand 批量命令，用于在单个 Raft 日志中执行多个操作
 type BatchCommand struct {
+	Type  CommandType        `msgpack:"type"`
 	Items []BatchCommandItem `msgpack:"items"`
 }
 
+// collapseBatch 按 key 合并批量命令项，同一个 key 只保留最后一次操作（后者覆盖前者）
+// 例如先 Put 后 Delete 合并为 Delete，两次 Put 合并为后一次 Put。
+// 合并后的各项按其最后一次出现的顺序排列
+// 返回：
+//   - []BatchCommandItem: 合并后的命令项
+//   - bool: 是否存在重复的 key
+func collapseBatch(items []BatchCommandItem) ([]BatchCommandItem, bool) {
+	seen := make(map[string]struct{}, len(items))
+	collapsed := make([]BatchCommandItem, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		key := string(items[i].Key)
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		collapsed = append(collapsed, items[i])
+	}
+	if len(collapsed) == len(items) {
+		return items, false
+	}
+
+	// 倒序收集，恢复为正序
+	for i, j := 0, len(collapsed)-1; i < j; i, j = i+1, j-1 {
+		collapsed[i], collapsed[j] = collapsed[j], collapsed[i]
+	}
+	return collapsed, true
+}
+
+// ReplacePrefixCommand 前缀替换命令
+// 在单个 Raft 日志中原子地替换某个前缀下的全部键值对
+type ReplacePrefixCommand struct {
+	Type   CommandType  `msgpack:"type"`
+	Prefix []byte       `msgpack:"prefix"`
+	Items  []storage.KV `msgpack:"items"`
+}
+
+// PrefixReplacer 支持原子前缀替换的存储引擎
+type PrefixReplacer interface {
+	ReplacePrefix(prefix []byte, kvs []storage.KV) error
+}
+
 // ==================== FSM 实现 ====================
 
 // BitcaskFSM 实现 Hashicorp Raft 的 FSM 接口
 // 用于将 Raft 日志应用到 Bitcask 存储引擎
 type BitcaskFSM struct {
-	engine storage.Engine // 底层的存储引擎
+	engine  storage.Engine    // 底层的存储引擎
+	applied atomic.Uint64     // 已应用到存储引擎的最后一条日志索引
+	changes *changeDispatcher // 变更投递器，未配置 ChangeHook 时为 nil
+
+	// Watch 事件分发器，未配置 WatchHub 时为 nil
+	// 事件在 Apply 中按日志顺序产生，以日志索引作为 Seq，因此每个节点上的事件序列相同
+	watches *watchDispatcher
+
+	applyErrors        chan ApplyError // 应用失败的日志，见 ApplyErrorCh
+	applyErrorsDropped atomic.Uint64   // 因通道已满未能报告的失败次数
 }
 
 // NewBitcaskFSM 创建新的 BitcaskFSM
+// 引擎支持 storage.AppendCounter 时把追加写入计数器清零：Raft 启动后要么从快照恢复（Restore 设置计数器），
+// 要么从第一条日志开始重放，两种情况下计数器都必须从对应的状态开始，而不是引擎中已有数据的最大值
 func NewBitcaskFSM(engine storage.Engine) *BitcaskFSM {
+	if counter, ok := engine.(storage.AppendCounter); ok {
+		counter.SetAppendSeq(0)
+	}
 	return &BitcaskFSM{
-		engine: engine,
+		engine:      engine,
+		applyErrors: make(chan ApplyError, defaultApplyErrorQueueSize),
 	}
 }
 
@@ -69,6 +150,18 @@ func NewBitcaskFSM(engine storage.Engine) *BitcaskFSM {
 //   - interface{}: 命令执行的结果（用于返回给客户端）
 //   - error: 执行错误
 func (f *BitcaskFSM) Apply(log *raft.Log) interface{} {
+	result := f.apply(log)
+	if err, ok := result.(error); ok && err != nil {
+		f.reportApplyError(log, err)
+	}
+	return result
+}
+
+// apply 解析并执行日志中的命令
+func (f *BitcaskFSM) apply(log *raft.Log) interface{} {
+	// 无论执行成功与否，该日志都已处理完毕
+	defer f.applied.Store(log.Index)
+
 	// 解析日志中的命令
 	var cmd LogCommand
 	if err := decodeCommand(log.Data, &cmd); err != nil {
@@ -79,25 +172,78 @@ func (f *BitcaskFSM) Apply(log *raft.Log) interface{} {
 	switch cmd.Type {
 	case CommandPut:
 		// 执行 Put 操作
-		if err := f.engine.Put(cmd.Key, cmd.Value); err != nil {
+		before := f.valueBefore(cmd.Key)
+		if err := f.put(log.Index, cmd.Key, cmd.Value); err != nil {
 			return fmt.Errorf("Put 执行失败: %w", err)
 		}
+		f.emit(Change{Index: log.Index, Type: ChangeTypePut, Key: cmd.Key, Before: before, After: cmd.Value})
 		return nil
 
 	case CommandDelete:
-		// 执行 Delete 操作
+		// 执行 Delete 操作，引擎支持时原子地取得删除前的值
+		if prev, ok, err := f.deleteReturning(log.Index, cmd.Key); ok {
+			if errors.Is(err, storage.ErrKeyNotFound) {
+				return &DeleteResult{}
+			}
+			if err != nil {
+				return fmt.Errorf("Delete 执行失败: %w", err)
+			}
+			f.emit(Change{Index: log.Index, Type: ChangeTypeDelete, Key: cmd.Key, Before: prev})
+			return &DeleteResult{PrevValue: prev, Found: true}
+		}
+		before := f.valueBefore(cmd.Key)
 		if err := f.engine.Delete(cmd.Key); err != nil {
 			return fmt.Errorf("Delete 执行失败: %w", err)
 		}
+		f.emit(Change{Index: log.Index, Type: ChangeTypeDelete, Key: cmd.Key, Before: before})
 		return nil
 
+	case CommandPutIfVersion:
+		// 执行条件写入：版本比较与写入在存储引擎内原子完成
+		// 版本号是最后一次写入该 key 的日志索引，在所有副本上相同，因此所有副本得到相同的结果
+		store, ok := f.engine.(storage.VersionedStore)
+		if !ok {
+			return fmt.Errorf("存储引擎不支持条件写入")
+		}
+		before := f.valueBefore(cmd.Key)
+		seq, written, err := store.PutIfVersionAt(cmd.Key, cmd.Value, cmd.ExpectedSeq, log.Index)
+		if err != nil {
+			return fmt.Errorf("PutIfVersion 执行失败: %w", err)
+		}
+		if written {
+			f.emit(Change{Index: log.Index, Type: ChangeTypePut, Key: cmd.Key, Before: before, After: cmd.Value})
+		}
+		return &PutIfVersionResult{Seq: seq, OK: written}
+
+	case CommandAppend:
+		// 执行追加写入：key 由引擎的追加写入计数器分配，计数器只随追加写入前进，
+		// 在所有副本上按相同的日志顺序推进，并随快照复制，因此每个副本分配相同且连续的 key
+		counter, ok := f.engine.(storage.AppendCounter)
+		if !ok {
+			return fmt.Errorf("存储引擎不支持追加写入")
+		}
+		key, err := counter.AppendAt(cmd.Value, log.Index)
+		if err != nil {
+			return fmt.Errorf("Append 执行失败: %w", err)
+		}
+		f.emit(Change{Index: log.Index, Type: ChangeTypePut, Key: key, After: cmd.Value})
+		return key
+
 	case CommandBatch:
 		// 执行批量操作
 		batchCmd, err := decodeBatchCommand(log.Data)
 		if err != nil {
 			return fmt.Errorf("解析批量命令失败: %w", err)
 		}
-		return f.applyBatch(batchCmd)
+		return f.applyBatch(log.Index, batchCmd)
+
+	case CommandReplacePrefix:
+		// 执行前缀替换
+		replaceCmd, err := decodeReplacePrefixCommand(log.Data)
+		if err != nil {
+			return fmt.Errorf("解析前缀替换命令失败: %w", err)
+		}
+		return f.applyReplacePrefix(log.Index, replaceCmd)
 
 	default:
 		return fmt.Errorf("未知的命令类型: %s", cmd.Type)
@@ -105,39 +251,184 @@ func (f *BitcaskFSM) Apply(log *raft.Log) interface{} {
 }
 
 // applyBatch 执行批量命令
-func (f *BitcaskFSM) applyBatch(cmd *BatchCommand) error {
+func (f *BitcaskFSM) applyBatch(index uint64, cmd *BatchCommand) error {
 	for _, item := range cmd.Items {
 		switch item.Type {
 		case CommandPut:
-			if err := f.engine.Put(item.Key, item.Value); err != nil {
+			before := f.valueBefore(item.Key)
+			if err := f.put(index, item.Key, item.Value); err != nil {
 				return fmt.Errorf("Batch Put 执行失败: %w", err)
 			}
+			f.emit(Change{Index: index, Type: ChangeTypePut, Key: item.Key, Before: before, After: item.Value})
 		case CommandDelete:
-			if err := f.engine.Delete(item.Key); err != nil {
+			before := f.valueBefore(item.Key)
+			if err := f.delete(index, item.Key); err != nil {
 				return fmt.Errorf("Batch Delete 执行失败: %w", err)
 			}
+			f.emit(Change{Index: index, Type: ChangeTypeDelete, Key: item.Key, Before: before})
 		}
 	}
 	return nil
 }
 
+// applyReplacePrefix 执行前缀替换
+// 配置了 ChangeHook 或 WatchHub 时，为被删除的旧 key 和写入的新 key 分别产生变更
+func (f *BitcaskFSM) applyReplacePrefix(index uint64, cmd *ReplacePrefixCommand) error {
+	replacer, ok := f.engine.(PrefixReplacer)
+	if !ok {
+		return fmt.Errorf("存储引擎不支持前缀替换")
+	}
+
+	var before map[string][]byte
+	if f.observed() {
+		if reader, ok := f.engine.(storage.PrefixMapReader); ok {
+			var err error
+			if before, err = reader.GetPrefixAsMap(cmd.Prefix); err != nil {
+				return fmt.Errorf("读取前缀旧值失败: %w", err)
+			}
+		}
+	}
+
+	var err error
+	if store, ok := f.engine.(storage.VersionedStore); ok {
+		err = store.ReplacePrefixAt(cmd.Prefix, cmd.Items, index)
+	} else {
+		err = replacer.ReplacePrefix(cmd.Prefix, cmd.Items)
+	}
+	if err != nil {
+		return fmt.Errorf("ReplacePrefix 执行失败: %w", err)
+	}
+	if !f.observed() {
+		return nil
+	}
+
+	// 先报告被删除的旧 key（按 key 排序），再按写入顺序报告新值
+	written := make(map[string]bool, len(cmd.Items))
+	for _, kv := range cmd.Items {
+		written[string(kv.Key)] = true
+	}
+	removed := make([]string, 0, len(before))
+	for key := range before {
+		if !written[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		f.emit(Change{Index: index, Type: ChangeTypeDelete, Key: []byte(key), Before: before[key]})
+	}
+	for _, kv := range cmd.Items {
+		f.emit(Change{Index: index, Type: ChangeTypePut, Key: kv.Key, Before: before[string(kv.Key)], After: kv.Value})
+	}
+	return nil
+}
+
+// put 写入键值对，引擎支持 storage.VersionedStore 时以日志索引作为版本号
+func (f *BitcaskFSM) put(index uint64, key, value []byte) error {
+	if store, ok := f.engine.(storage.VersionedStore); ok {
+		return store.PutAt(key, value, index)
+	}
+	return f.engine.Put(key, value)
+}
+
+// delete 删除 key，引擎支持 storage.VersionedStore 时以日志索引作为版本号；key 不存在不是错误
+func (f *BitcaskFSM) delete(index uint64, key []byte) error {
+	if _, ok, err := f.deleteReturning(index, key); ok {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+	return f.engine.Delete(key)
+}
+
+// deleteReturning 删除 key 并原子地取得删除前的值
+// 返回的 bool 表示引擎是否支持（storage.VersionedStore 或 storage.DeleteReturner），不支持时没有执行删除
+func (f *BitcaskFSM) deleteReturning(index uint64, key []byte) ([]byte, bool, error) {
+	if store, ok := f.engine.(storage.VersionedStore); ok {
+		prev, err := store.DeleteAt(key, index)
+		return prev, true, err
+	}
+	if deleter, ok := f.engine.(storage.DeleteReturner); ok {
+		prev, err := deleter.DeleteReturning(key)
+		return prev, true, err
+	}
+	return nil, false, nil
+}
+
+// valueBefore 读取 key 变更前的值，用于 ChangeHook 与 Watch 事件；两者都未配置或 key 不存在时返回 nil
+func (f *BitcaskFSM) valueBefore(key []byte) []byte {
+	if !f.observed() {
+		return nil
+	}
+	value, err := f.engine.Get(key)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// observed 是否配置了 ChangeHook 或 WatchHub，未配置时无需读取变更前的值
+func (f *BitcaskFSM) observed() bool {
+	return f.changes != nil || f.watches != nil
+}
+
+// emit 将变更交给 ChangeHook 异步投递，并通知 Watch 客户端
+func (f *BitcaskFSM) emit(change Change) {
+	if f.changes != nil {
+		f.changes.enqueue(change)
+	}
+	if f.watches != nil {
+		f.watches.enqueue(changeEvent(change))
+	}
+}
+
+// changeEvent 将变更转换为 Watch 事件
+func changeEvent(change Change) *watch.Event {
+	event := &watch.Event{
+		Key:       string(change.Key),
+		Value:     string(change.After),
+		PrevValue: string(change.Before),
+		Seq:       change.Index,
+	}
+	if change.Type == ChangeTypeDelete {
+		event.Type = watch.EventDelete
+	} else {
+		event.Type = watch.EventPut
+	}
+	return event
+}
+
+// AppliedIndex 返回已应用到存储引擎的最后一条日志索引
+// 与 raft.AppliedIndex() 不同，它在命令真正执行完成后才会前进
+func (f *BitcaskFSM) AppliedIndex() uint64 {
+	return f.applied.Load()
+}
+
 // Snapshot 创建状态机的快照
-// 用于持久化状态机的当前状态，以便在节点重启时快速恢复
+// 用于压缩 Raft 日志，以及向落后过多的节点发送完整状态
+// Raft 保证 Snapshot 不与 Apply 并发调用，因此在这里复制全部键值对即可得到一致的时间点状态；
+// 之后的 Persist 与 Apply 并发执行，不能再读取存储引擎
 //
 // 返回：
 //   - raft.FSMSnapshot: 快照对象
 //   - error: 创建快照错误
 func (f *BitcaskFSM) Snapshot() (raft.FSMSnapshot, error) {
-	// 创建快照实现
-	return &BitcaskSnapshot{
-		// 这里可以传递需要持久化的数据
-		// 由于 Bitcask 的数据已经在磁盘文件中，
-		// 我们可以选择只快照索引状态或让 Raft 自行处理
-	}, nil
+	pairs, err := readAll(f.engine)
+	if err != nil {
+		return nil, err
+	}
+	snap := &BitcaskSnapshot{pairs: pairs}
+	if counter, ok := f.engine.(storage.AppendCounter); ok {
+		snap.appendSeq = counter.AppendSeq()
+	}
+	return snap, nil
 }
 
 // Restore 从快照恢复状态机
-// 节点启动时或追赶日志时，会从快照恢复状态
+// 节点从快照启动，或落后过多由 Leader 发送快照时调用；恢复后存储引擎的内容与快照完全一致：
+// 写入快照中的键值对，删除快照中不存在的 key。从快照恢复的状态不产生变更与 Watch 事件。
+// 引擎支持 storage.VersionedStore 时，键值对以快照中记录的版本号写入，与 Leader 上的版本号相同
 //
 // 参数：
 //   - snapshot: 快照数据的读取器
@@ -145,25 +436,109 @@ func (f *BitcaskFSM) Snapshot() (raft.FSMSnapshot, error) {
 // 返回：
 //   - error: 恢复错误
 func (f *BitcaskFSM) Restore(snapshot io.ReadCloser) error {
-	// 从快照恢复
-	// 读取快照数据（如果有的话）
-	// 这里可以实现从快照恢复索引的逻辑
-
 	defer snapshot.Close()
 
-	// 注意：由于 Bitcask 的数据本身就在磁盘文件中，
-	// 这里可以选择：
-	// 1. 不做任何事（依赖 Bootstrapping 重建索引）
-	// 2. 从快照中恢复元数据（如最新的 key 列表等）
+	pairs, appendSeq, err := readSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// 写入快照中的键值对
+	if bulk, ok := f.engine.(storage.BulkWriter); ok {
+		if err := bulk.PutAll(pairs); err != nil {
+			return fmt.Errorf("恢复快照失败: %w", err)
+		}
+	} else {
+		for _, kv := range pairs {
+			if err := f.put(kv.Version, kv.Key, kv.Value); err != nil {
+				return fmt.Errorf("恢复快照失败: %w", err)
+			}
+		}
+	}
+
+	// 删除快照中不存在的 key
+	keep := make(map[string]struct{}, len(pairs))
+	for _, kv := range pairs {
+		keep[string(kv.Key)] = struct{}{}
+	}
+	current, err := readAll(f.engine)
+	if err != nil {
+		return err
+	}
+	var stale [][]byte
+	for _, kv := range current {
+		if _, ok := keep[string(kv.Key)]; !ok {
+			stale = append(stale, kv.Key)
+		}
+	}
+	for _, key := range stale {
+		if err := f.engine.Delete(key); err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+			return fmt.Errorf("恢复快照失败: %w", err)
+		}
+	}
 
+	// 追加写入计数器恢复为快照中的值，之后重放的日志从这里继续分配 key
+	if counter, ok := f.engine.(storage.AppendCounter); ok {
+		counter.SetAppendSeq(appendSeq)
+	}
 	return nil
 }
 
+// readAll 读取存储引擎中的全部键值对，按 key 升序
+// 优先使用 VersionedStore（同时读取版本号）与 PrefixMapReader，它们在一次加锁内读取，得到一致的视图
+func readAll(engine storage.Engine) ([]storage.KV, error) {
+	if store, ok := engine.(storage.VersionedStore); ok {
+		pairs, err := store.GetPrefixVersioned(nil)
+		if err != nil {
+			return nil, fmt.Errorf("读取存储引擎失败: %w", err)
+		}
+		return pairs, nil
+	}
+	if reader, ok := engine.(storage.PrefixMapReader); ok {
+		m, err := reader.GetPrefixAsMap(nil)
+		if err != nil {
+			return nil, fmt.Errorf("读取存储引擎失败: %w", err)
+		}
+		pairs := make([]storage.KV, 0, len(m))
+		for key, value := range m {
+			pairs = append(pairs, storage.KV{Key: []byte(key), Value: value})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].Key, pairs[j].Key) < 0 })
+		return pairs, nil
+	}
+
+	iter, err := engine.Seek(nil)
+	if err != nil {
+		return nil, fmt.Errorf("遍历存储引擎失败: %w", err)
+	}
+	defer iter.Close()
+	var pairs []storage.KV
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		pairs = append(pairs, storage.KV{
+			Key:   append([]byte(nil), key...),
+			Value: append([]byte(nil), iter.Value()...),
+		})
+		iter.Next()
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("遍历存储引擎失败: %w", err)
+	}
+	return pairs, nil
+}
+
 // ==================== 快照实现 ====================
+//
+// 快照格式：以一个 0 字节开头，之后是 uvarint 编码的追加写入计数器，然后依次写入每个键值对：
+// key 与 value 各以 uvarint 长度为前缀，之后是 uvarint 编码的版本号，以数据结束为终止。
+// 旧格式没有开头的 0 字节、计数器和版本号；key 不能为空，因此旧格式的第一个字节不会是 0，读取时据此区分
+
+// snapshotVersioned 新格式快照开头的标记字节
+const snapshotVersioned = 0
 
 // BitcaskSnapshot 实现 raft.FSMSnapshot 接口
 type BitcaskSnapshot struct {
-	// 可以在这里存储快照的元数据
+	pairs     []storage.KV // 创建快照时的全部键值对，按 key 升序
+	appendSeq uint64       // 创建快照时的追加写入计数器
 }
 
 // Persist 将快照数据写入提供的通道
@@ -174,23 +549,73 @@ type BitcaskSnapshot struct {
 // 返回：
 //   - error: 写入错误
 func (s *BitcaskSnapshot) Persist(sink raft.SnapshotSink) error {
-	// 序列化快照数据
-	// 这里可以写入任意格式的数据
-
-	// 示例：写入空数据（因为 Bitcask 数据本身在磁盘）
-	// 如果需要，可以在这里写入索引信息
-
-	_, err := sink.Write(nil)
-	if err != nil {
-		return err
+	w := bufio.NewWriter(sink)
+	w.WriteByte(snapshotVersioned)
+	var lenBuf [binary.MaxVarintLen64]byte
+	w.Write(lenBuf[:binary.PutUvarint(lenBuf[:], s.appendSeq)])
+	for _, kv := range s.pairs {
+		for _, field := range [][]byte{kv.Key, kv.Value} {
+			n := binary.PutUvarint(lenBuf[:], uint64(len(field)))
+			w.Write(lenBuf[:n])
+			w.Write(field)
+		}
+		n := binary.PutUvarint(lenBuf[:], kv.Version)
+		w.Write(lenBuf[:n])
+	}
+	if err := w.Flush(); err != nil {
+		sink.Cancel()
+		return fmt.Errorf("写入快照失败: %w", err)
 	}
 
 	// 关闭 sink 表示完成
-	if err := sink.Close(); err != nil {
-		return err
+	return sink.Close()
+}
+
+// readSnapshot 读取 Persist 写入的全部键值对与追加写入计数器，兼容没有版本号与计数器的旧格式
+func readSnapshot(r io.Reader) ([]storage.KV, uint64, error) {
+	br := bufio.NewReader(r)
+	versioned := false
+	var appendSeq uint64
+	if first, err := br.Peek(1); err == nil && first[0] == snapshotVersioned {
+		br.ReadByte()
+		versioned = true
+		if appendSeq, err = binary.ReadUvarint(br); err != nil {
+			return nil, 0, fmt.Errorf("读取快照失败: %w", io.ErrUnexpectedEOF)
+		}
+	}
+	readField := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		field := make([]byte, n)
+		if _, err := io.ReadFull(br, field); err != nil {
+			return nil, err
+		}
+		return field, nil
 	}
 
-	return nil
+	var pairs []storage.KV
+	for {
+		key, err := readField()
+		if err == io.EOF {
+			return pairs, appendSeq, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取快照失败: %w", err)
+		}
+		value, err := readField()
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取快照失败: %w", io.ErrUnexpectedEOF)
+		}
+		var version uint64
+		if versioned {
+			if version, err = binary.ReadUvarint(br); err != nil {
+				return nil, 0, fmt.Errorf("读取快照失败: %w", io.ErrUnexpectedEOF)
+			}
+		}
+		pairs = append(pairs, storage.KV{Key: key, Value: value, Version: version})
+	}
 }
 
 // Release 释放快照资源
@@ -231,5 +656,21 @@ func decodeBatchCommand(data []byte) (*BatchCommand, error) {
 	return &cmd, err
 }
 
+// encodeReplacePrefixCommand 将 ReplacePrefixCommand 编码为字节数组
+func encodeReplacePrefixCommand(cmd *ReplacePrefixCommand) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	err := enc.Encode(cmd)
+	return buf.Bytes(), err
+}
+
+// decodeReplacePrefixCommand 从字节数组解码 ReplacePrefixCommand
+func decodeReplacePrefixCommand(data []byte) (*ReplacePrefixCommand, error) {
+	var cmd ReplacePrefixCommand
+	dec := codec.NewDecoderBytes(data, &codec.MsgpackHandle{})
+	err := dec.Decode(&cmd)
+	return &cmd, err
+}
+
 // 确保 BitcaskFSM 实现了 raft.FSM 接口
 var _ raft.FSM = (*BitcaskFSM)(nil)
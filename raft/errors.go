@@ -0,0 +1,27 @@
+package raft
+
+import "errors"
+
+// ErrStaleRead 表示本地状态超出了允许的陈旧度，且无法将读请求转发到 Leader
+var ErrStaleRead = errors.New("local state exceeds staleness bound")
+
+// ErrAckTimeout 表示写入已提交，但在超时前未收到所要求的全部确认
+var ErrAckTimeout = errors.New("timed out waiting for write acknowledgment")
+
+// ErrAckUnavailable 表示节点无法提供所要求的确认级别
+var ErrAckUnavailable = errors.New("acknowledgment level unavailable")
+
+// ErrDuplicateKeyInBatch 表示批量命令中同一个 key 出现了多次（仅在 NodeConfig.RejectDuplicateBatchKeys 时返回）
+var ErrDuplicateKeyInBatch = errors.New("duplicate key in batch")
+
+// ErrUnknownServer 表示指定的节点不在集群配置中
+var ErrUnknownServer = errors.New("server not in cluster configuration")
+
+// ErrNotVoter 表示指定的节点没有投票权，不能成为 Leader
+var ErrNotVoter = errors.New("server is not a voter")
+
+// ErrNotReady 表示节点尚未追上集群，不能提供本地读取（仅在 NodeConfig.ReadinessGate 时返回）
+var ErrNotReady = errors.New("node not ready")
+
+// ErrInvalidLayout 表示 Raft 目录与存储目录未设置、相同或互相包含
+var ErrInvalidLayout = errors.New("invalid data directory layout")
@@ -0,0 +1,139 @@
+package raft
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ==================== 目录布局 ====================
+//
+// Raft 的日志、稳定存储与快照（NodeConfig.DataDir 下的 raft-log、raft-stable、raft-snapshots）
+// 和存储引擎的数据目录是分别配置的。两者相同或互相包含时，一方的文件会出现在另一方的目录中：
+// 存储引擎可能把 Raft 的文件当作自己的文件清理，恢复快照时也可能覆盖 Raft 的状态。
+// Layout 把两者放在同一个根目录下的不同子目录中，并在创建节点之前检查它们互不重叠。
+
+// Layout 单个节点的目录布局
+type Layout struct {
+	RaftDir    string // Raft 日志、稳定存储与快照的目录（NodeConfig.DataDir）
+	StorageDir string // 存储引擎的数据目录（例如 bitcask.Open 的 dir）
+}
+
+// DefaultLayout 返回根目录下的默认布局：
+//
+//	root/
+//	├── raft/   Raft 日志、稳定存储与快照
+//	└── data/   存储引擎的数据文件
+//
+// 参数：
+//   - root: 根目录
+//
+// 返回：
+//   - *Layout: 目录布局
+func DefaultLayout(root string) *Layout {
+	return &Layout{
+		RaftDir:    filepath.Join(root, "raft"),
+		StorageDir: filepath.Join(root, "data"),
+	}
+}
+
+// Validate 检查 Raft 目录与存储目录都已设置且互不重叠
+// 返回：
+//   - error: 目录为空或重叠时返回 ErrInvalidLayout
+func (l *Layout) Validate() error {
+	return ValidateDirs(l.RaftDir, l.StorageDir)
+}
+
+// Create 检查布局并创建 Raft 目录与存储目录
+// 返回：
+//   - error: 布局无效或创建目录失败
+func (l *Layout) Create() error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	for _, dir := range []string{l.RaftDir, l.StorageDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建目录 %s 失败: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// WithLayout 按布局设置 Raft 目录与存储目录，NewNode 会检查两者互不重叠
+func (c *NodeConfig) WithLayout(l *Layout) *NodeConfig {
+	c.DataDir = l.RaftDir
+	c.StorageDir = l.StorageDir
+	return c
+}
+
+// WithStorageDir 设置存储引擎的数据目录，NewNode 会检查它与 DataDir 互不重叠
+func (c *NodeConfig) WithStorageDir(dir string) *NodeConfig {
+	c.StorageDir = dir
+	return c
+}
+
+// ValidateDirs 检查 Raft 目录与存储目录都已设置，且不相同、不互相包含
+// 比较前转换为绝对路径，并解析路径中已存在部分的符号链接
+// 参数：
+//   - raftDir: Raft 目录
+//   - storageDir: 存储引擎的数据目录
+//
+// 返回：
+//   - error: 目录为空或重叠时返回 ErrInvalidLayout
+func ValidateDirs(raftDir, storageDir string) error {
+	if raftDir == "" {
+		return fmt.Errorf("%w: 未设置 Raft 目录", ErrInvalidLayout)
+	}
+	if storageDir == "" {
+		return fmt.Errorf("%w: 未设置存储目录", ErrInvalidLayout)
+	}
+	raftPath, err := resolveDir(raftDir)
+	if err != nil {
+		return fmt.Errorf("解析 Raft 目录 %s 失败: %w", raftDir, err)
+	}
+	storagePath, err := resolveDir(storageDir)
+	if err != nil {
+		return fmt.Errorf("解析存储目录 %s 失败: %w", storageDir, err)
+	}
+
+	switch {
+	case raftPath == storagePath:
+		return fmt.Errorf("%w: Raft 目录与存储目录相同 (%s)", ErrInvalidLayout, raftPath)
+	case isSubdir(raftPath, storagePath):
+		return fmt.Errorf("%w: 存储目录 %s 位于 Raft 目录 %s 之内", ErrInvalidLayout, storagePath, raftPath)
+	case isSubdir(storagePath, raftPath):
+		return fmt.Errorf("%w: Raft 目录 %s 位于存储目录 %s 之内", ErrInvalidLayout, raftPath, storagePath)
+	}
+	return nil
+}
+
+// resolveDir 返回目录的绝对路径
+// 目录可能尚未创建：解析最深的已存在祖先目录中的符号链接，再拼接其余部分
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for path := abs; ; {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// isSubdir 判断 child 是否位于 parent 之内（两者都是清理过的绝对路径）
+func isSubdir(parent, child string) bool {
+	rel, err := filepath.Rel(parent, child)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,75 @@
+package raft
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage/bitcask"
+)
+
+func TestValidateDirs(t *testing.T) {
+	root, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	// 指向 root/raft 的符号链接，用于检查解析符号链接后的重叠
+	if err := os.MkdirAll(filepath.Join(root, "raft"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(filepath.Join(root, "raft"), link); err != nil {
+		t.Fatalf("创建符号链接失败: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		raftDir    string
+		storageDir string
+		valid      bool
+	}{
+		{"默认布局", filepath.Join(root, "raft"), filepath.Join(root, "data"), true},
+		{"名称前缀相同的兄弟目录", filepath.Join(root, "raft"), filepath.Join(root, "raft-data"), true},
+		{"相同目录", filepath.Join(root, "node"), filepath.Join(root, "node") + "/", false},
+		{"存储目录在 Raft 目录之内", root, filepath.Join(root, "raft-snapshots"), false},
+		{"Raft 目录在存储目录之内", filepath.Join(root, "data", "raft"), filepath.Join(root, "data"), false},
+		{"经由符号链接重叠", filepath.Join(root, "raft"), filepath.Join(link, "data"), false},
+		{"未设置存储目录", filepath.Join(root, "raft"), "", false},
+		{"未设置 Raft 目录", "", filepath.Join(root, "data"), false},
+	}
+	for _, tt := range tests {
+		err := ValidateDirs(tt.raftDir, tt.storageDir)
+		if tt.valid && err != nil {
+			t.Errorf("%s: 应通过检查, 得到: %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidLayout) {
+			t.Errorf("%s: 应返回 ErrInvalidLayout, 得到: %v", tt.name, err)
+		}
+	}
+
+	// 默认布局可以创建，存储引擎可以在其中打开
+	layout := DefaultLayout(filepath.Join(root, "node1"))
+	if err := layout.Create(); err != nil {
+		t.Fatalf("创建默认布局失败: %v", err)
+	}
+	db, err := bitcask.Open(layout.StorageDir)
+	if err != nil {
+		t.Fatalf("在默认布局中打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// NewNode 在创建任何文件之前拒绝重叠的配置
+	config := (&NodeConfig{NodeID: "node1", BindAddr: "127.0.0.1:0"}).WithLayout(&Layout{
+		RaftDir:    filepath.Join(root, "node2"),
+		StorageDir: filepath.Join(root, "node2", "data"),
+	})
+	if _, err := NewNode(db, config); !errors.Is(err, ErrInvalidLayout) {
+		t.Fatalf("重叠的目录应被 NewNode 拒绝, 得到: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "node2")); !os.IsNotExist(err) {
+		t.Fatalf("被拒绝的配置不应创建目录: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package raft
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/hashicorp/raft"
 	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/watch"
 )
 
 // ==================== 节点配置 ====================
@@ -25,6 +27,9 @@ type NodeConfig struct {
 	// 数据目录（用于存储 Raft 日志和快照）
 	DataDir string
 
+	// 存储引擎的数据目录（可选），设置后 NewNode 检查它与 DataDir 互不重叠，见 Layout
+	StorageDir string
+
 	// 集群配置
 	Bootstrap bool          // 是否引导集群
 	Peers     []raft.Server // 初始集群节点
@@ -35,8 +40,45 @@ type NodeConfig struct {
 	// 连接池配置
 	MaxPool int           // 最大连接池大小（默认 3）
 	Timeout time.Duration // 超时时间（默认 10 秒）
+
+	// 有界陈旧度读取超出陈旧度时，用于将读请求转发到 Leader（可选）
+	ReadForwarder ReadForwarder
+
+	// 查询其他节点的 applied index，AckAll 写入需要（可选）
+	AppliedIndexProber AppliedIndexProber
+
+	// 变更数据捕获（可选）
+	ChangeHook        ChangeHook
+	ChangeHookOptions ChangeHookOptions
+
+	// Watch 事件中心（可选），设置后由 FSM 在应用日志时产生事件，事件 Seq 为日志索引
+	WatchHub *watch.WatchHub
+
+	// FSM 到 WatchHub 的事件分发队列容量（默认 1024），队列已满时丢弃事件而不阻塞 Apply
+	WatchQueueSize int
+
+	// 应用错误通道的容量（默认 64），见 Node.ApplyErrorCh
+	ApplyErrorQueueSize int
+
+	// 批量命令中同一个 key 出现多次时的处理方式
+	// 默认按 key 合并，只保留最后一次操作（后者覆盖前者）；为 true 时拒绝并返回 ErrDuplicateKeyInBatch
+	RejectDuplicateBatchKeys bool
+
+	// 是否在追上集群之前拒绝本地读取（返回 ErrNotReady），见 Ready
+	ReadinessGate bool
 }
 
+// ReadForwarder 将读请求转发到 Leader 执行
+//
+// 参数：
+//   - leader: Leader 的 Raft 地址
+//   - key: 键
+//
+// 返回：
+//   - []byte: 值
+//   - error: 读取错误
+type ReadForwarder func(leader raft.ServerAddress, key []byte) ([]byte, error)
+
 // WithTLS 设置 TLS 配置
 func (c *NodeConfig) WithTLS(tlsCfg *TLSConfig) *NodeConfig {
 	c.TLS = tlsCfg
@@ -55,17 +97,57 @@ func (c *NodeConfig) WithTimeout(timeout time.Duration) *NodeConfig {
 	return c
 }
 
+// WithReadForwarder 设置读请求转发函数
+func (c *NodeConfig) WithReadForwarder(forwarder ReadForwarder) *NodeConfig {
+	c.ReadForwarder = forwarder
+	return c
+}
+
+// WithAppliedIndexProber 设置查询节点 applied index 的函数
+func (c *NodeConfig) WithAppliedIndexProber(prober AppliedIndexProber) *NodeConfig {
+	c.AppliedIndexProber = prober
+	return c
+}
+
+// WithChangeHook 设置变更回调及其投递配置
+func (c *NodeConfig) WithChangeHook(hook ChangeHook, opts ChangeHookOptions) *NodeConfig {
+	c.ChangeHook = hook
+	c.ChangeHookOptions = opts
+	return c
+}
+
+// WithWatchHub 设置由 FSM 产生事件的 Watch 事件中心
+func (c *NodeConfig) WithWatchHub(hub *watch.WatchHub) *NodeConfig {
+	c.WatchHub = hub
+	return c
+}
+
+// raftState 读取路径与状态查询所需的 Raft 状态，由 *raft.Raft 实现
+type raftState interface {
+	State() raft.RaftState
+	Leader() raft.ServerAddress
+	LeaderWithID() (raft.ServerAddress, raft.ServerID)
+	LastContact() time.Time
+	Stats() map[string]string
+	GetConfiguration() raft.ConfigurationFuture
+}
+
 // Node Raft 节点封装
 type Node struct {
 	raft     *raft.Raft
+	state    raftState
 	fsm      *BitcaskFSM
 	engine   storage.Engine
 	config   *NodeConfig
 	mu       sync.RWMutex
 	isLeader atomic.Bool
+	ready    atomic.Bool // 启用 ReadinessGate 时是否已经就绪
+
+	logs      *logStore          // Raft 日志存储，CompactLog 直接截断
+	snapshots raft.SnapshotStore // Raft 快照存储
 
 	// Session tracking for Read-Your-Writes consistency
-	sessions   sync.Map // map[string]*Session
+	sessions sync.Map // map[string]*Session
 }
 
 // Session 会话跟踪，用于 Read-Your-Writes 一致性
@@ -106,6 +188,13 @@ func (n *Node) GetSession(sessionID string) *Session {
 //   - *Node: Raft 节点
 //   - error: 创建错误
 func NewNode(engine storage.Engine, config *NodeConfig) (*Node, error) {
+	// 检查 Raft 目录与存储目录互不重叠
+	if config.StorageDir != "" {
+		if err := ValidateDirs(config.DataDir, config.StorageDir); err != nil {
+			return nil, err
+		}
+	}
+
 	// 确保数据目录存在
 	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
 		return nil, fmt.Errorf("创建数据目录失败: %w", err)
@@ -113,13 +202,22 @@ func NewNode(engine storage.Engine, config *NodeConfig) (*Node, error) {
 
 	// 创建 FSM
 	fsm := NewBitcaskFSM(engine)
+	if config.ChangeHook != nil {
+		fsm.changes = newChangeDispatcher(config.ChangeHook, config.ChangeHookOptions)
+	}
+	if config.WatchHub != nil {
+		fsm.watches = newWatchDispatcher(config.WatchHub, config.WatchQueueSize)
+	}
+	if config.ApplyErrorQueueSize > 0 {
+		fsm.applyErrors = make(chan ApplyError, config.ApplyErrorQueueSize)
+	}
 
 	// 配置 Raft
 	raftConfig := raft.DefaultConfig()
 	raftConfig.LocalID = config.NodeID
 
 	// 创建日志存储
-	logStore, err := newLogStore(filepath.Join(config.DataDir, "raft-log"))
+	logs, err := newLogStore(filepath.Join(config.DataDir, "raft-log"))
 	if err != nil {
 		return nil, fmt.Errorf("创建日志存储失败: %w", err)
 	}
@@ -160,7 +258,7 @@ func NewNode(engine storage.Engine, config *NodeConfig) (*Node, error) {
 	ra, err := raft.NewRaft(
 		raftConfig,
 		fsm,
-		logStore,
+		logs,
 		stableStore,
 		snapshotStore,
 		transport,
@@ -180,10 +278,13 @@ func NewNode(engine storage.Engine, config *NodeConfig) (*Node, error) {
 	}
 
 	node := &Node{
-		raft:   ra,
-		fsm:    fsm,
-		engine: engine,
-		config: config,
+		raft:      ra,
+		state:     ra,
+		fsm:       fsm,
+		engine:    engine,
+		config:    config,
+		logs:      logs,
+		snapshots: snapshotStore,
 	}
 
 	return node, nil
@@ -194,6 +295,20 @@ func NewNode(engine storage.Engine, config *NodeConfig) (*Node, error) {
 // Put 通过 Raft 集群写入键值对
 // 命令会先写入 Raft 日志，经过共识后才应用到 FSM
 func (n *Node) Put(key []byte, value []byte) error {
+	return n.PutWithAck(key, value, AckQuorum)
+}
+
+// PutWithAck 通过 Raft 集群写入键值对，并按指定的确认级别等待
+// 各级别的持久性权衡见 AckLevel
+//
+// 参数：
+//   - key: 键
+//   - value: 值
+//   - level: 确认级别
+//
+// 返回：
+//   - error: 写入错误；AckAll 超时返回 ErrAckTimeout（此时写入已提交）
+func (n *Node) PutWithAck(key []byte, value []byte, level AckLevel) error {
 	// 创建命令
 	cmd := &LogCommand{
 		Type:  CommandPut,
@@ -207,6 +322,15 @@ func (n *Node) Put(key []byte, value []byte) error {
 		return fmt.Errorf("编码命令失败: %w", err)
 	}
 
+	// AckLeader：只有 Leader 能接收写入，提交到日志队列后不再等待
+	if level == AckLeader {
+		if n.raft.State() != raft.Leader {
+			return raft.ErrNotLeader
+		}
+		n.raft.Apply(data, 5*time.Second)
+		return nil
+	}
+
 	// 提交到 Raft
 	applyFuture := n.raft.Apply(data, 5*time.Second)
 	if err := applyFuture.Error(); err != nil {
@@ -218,9 +342,105 @@ func (n *Node) Put(key []byte, value []byte) error {
 		return err
 	}
 
+	if level == AckAll {
+		return n.waitAllApplied(applyFuture.Index())
+	}
 	return nil
 }
 
+// PutIfVersion 通过 Raft 集群条件写入键值对
+// 版本号是最后一次写入该 key 的 Raft 日志索引，随数据持久化并包含在快照中，因此在所有副本上相同。
+// 仅当 key 当前的版本号等于 expectedSeq 时写入，expectedSeq 为 0 表示仅当 key 不存在时写入
+//
+// 参数：
+//   - key: 键
+//   - value: 值
+//   - expectedSeq: 期望的当前版本号
+//
+// 返回：
+//   - uint64: 写入成功时为新的版本号（该命令的日志索引），否则为 key 当前的版本号
+//   - bool: 是否写入
+//   - error: 写入错误，存储引擎不支持时返回 storage.ErrNotSupported
+func (n *Node) PutIfVersion(key []byte, value []byte, expectedSeq uint64) (uint64, bool, error) {
+	if _, ok := n.engine.(storage.VersionedStore); !ok {
+		return 0, false, storage.ErrNotSupported
+	}
+
+	// 创建命令
+	cmd := &LogCommand{
+		Type:        CommandPutIfVersion,
+		Key:         key,
+		Value:       value,
+		ExpectedSeq: expectedSeq,
+	}
+
+	// 编码命令
+	data, err := encodeCommand(cmd)
+	if err != nil {
+		return 0, false, fmt.Errorf("编码命令失败: %w", err)
+	}
+
+	// 提交到 Raft
+	applyFuture := n.raft.Apply(data, 5*time.Second)
+	if err := applyFuture.Error(); err != nil {
+		return 0, false, fmt.Errorf("提交应用到 Raft 失败: %w", err)
+	}
+
+	// 检查返回结果
+	switch resp := applyFuture.Response().(type) {
+	case error:
+		return 0, false, resp
+	case *PutIfVersionResult:
+		return resp.Seq, resp.OK, nil
+	default:
+		return 0, false, fmt.Errorf("未知的条件写入结果: %T", resp)
+	}
+}
+
+// Append 通过 Raft 集群追加写入 value，由服务端分配 key
+// key 由存储引擎的追加写入计数器分配（见 storage.AppendCounter）：计数器在状态机中按日志顺序推进，
+// 随快照复制，因此 key 在所有副本上相同、按提交顺序递增；其他命令不推进计数器，key 连续
+//
+// 参数：
+//   - value: 值
+//
+// 返回：
+//   - []byte: 分配的 key
+//   - error: 写入错误，存储引擎不支持时返回 storage.ErrNotSupported
+func (n *Node) Append(value []byte) ([]byte, error) {
+	if _, ok := n.engine.(storage.AppendCounter); !ok {
+		return nil, storage.ErrNotSupported
+	}
+
+	// 创建命令
+	cmd := &LogCommand{
+		Type:  CommandAppend,
+		Value: value,
+	}
+
+	// 编码命令
+	data, err := encodeCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("编码命令失败: %w", err)
+	}
+
+	// 提交到 Raft
+	applyFuture := n.raft.Apply(data, 5*time.Second)
+	if err := applyFuture.Error(); err != nil {
+		return nil, fmt.Errorf("提交应用到 Raft 失败: %w", err)
+	}
+
+	// 检查返回结果
+	switch resp := applyFuture.Response().(type) {
+	case error:
+		return nil, resp
+	case []byte:
+		return resp, nil
+	default:
+		return nil, fmt.Errorf("未知的追加写入结果: %T", resp)
+	}
+}
+
 // PutWithSession 通过 Raft 集群写入键值对，并更新会话的 lastIndex
 // 用于 Read-Your-Writes 一致性
 func (n *Node) PutWithSession(sessionID string, key []byte, value []byte) (uint64, error) {
@@ -264,12 +484,19 @@ func (n *Node) PutWithSession(sessionID string, key []byte, value []byte) (uint6
 // Get 从本地存储引擎读取值
 // 注意：Get 不经过 Raft，直接从本地读取
 func (n *Node) Get(key []byte) ([]byte, error) {
+	if err := n.checkReady(); err != nil {
+		return nil, err
+	}
 	return n.engine.Get(key)
 }
 
 // ConsistentGet 从本地存储引擎读取值，等待会话的 lastIndex 被应用后再读取
 // 用于 Read-Your-Writes 一致性
 func (n *Node) ConsistentGet(sessionID string, key []byte) ([]byte, error) {
+	if err := n.checkReady(); err != nil {
+		return nil, err
+	}
+
 	// 如果有 session，先等待 lastIndex 被应用
 	if sessionID != "" {
 		if s := n.GetSession(sessionID); s != nil {
@@ -293,6 +520,48 @@ func (n *Node) ConsistentGet(sessionID string, key []byte) ([]byte, error) {
 	return n.engine.Get(key)
 }
 
+// GetWithin 有界陈旧度读取
+// 本地状态的陈旧度不超过 maxStaleness 时直接读取本地存储引擎，否则转发到 Leader。
+// Leader 的陈旧度视为 0；Follower 的陈旧度为距上次与 Leader 通信的时长。
+// 启用 ReadinessGate 且节点尚未就绪时同样转发到 Leader。
+//
+// 参数：
+//   - key: 键
+//   - maxStaleness: 允许的最大陈旧度
+//
+// 返回：
+//   - []byte: 值
+//   - error: 读取错误；超出陈旧度且无法转发时返回 ErrStaleRead
+func (n *Node) GetWithin(key []byte, maxStaleness time.Duration) ([]byte, error) {
+	if staleness, ok := n.Staleness(); ok && staleness <= maxStaleness && n.checkReady() == nil {
+		return n.engine.Get(key)
+	}
+
+	leader := n.state.Leader()
+	if leader == "" {
+		return nil, fmt.Errorf("%w: 当前没有 Leader", ErrStaleRead)
+	}
+	if n.config == nil || n.config.ReadForwarder == nil {
+		return nil, fmt.Errorf("%w: 未配置读转发 (leader=%s)", ErrStaleRead, leader)
+	}
+	return n.config.ReadForwarder(leader, key)
+}
+
+// Staleness 估计本地状态相对 Leader 的陈旧度
+// 返回：
+//   - time.Duration: 陈旧度
+//   - bool: 是否可以估计（Follower 从未与 Leader 通信过时返回 false）
+func (n *Node) Staleness() (time.Duration, bool) {
+	if n.state.State() == raft.Leader {
+		return 0, true
+	}
+	lastContact := n.state.LastContact()
+	if lastContact.IsZero() {
+		return 0, false
+	}
+	return time.Since(lastContact), true
+}
+
 // Delete 通过 Raft 集群删除键值对
 func (n *Node) Delete(key []byte) error {
 	// 创建命令
@@ -321,11 +590,65 @@ func (n *Node) Delete(key []byte) error {
 	return nil
 }
 
+// DeleteReturning 通过 Raft 集群删除键值对，并返回删除前的值
+// 删除前的值由状态机在应用日志时读取，与删除原子完成
+//
+// 参数：
+//   - key: 键
+//
+// 返回：
+//   - []byte: 删除前的值
+//   - error: 删除错误；键不存在返回 storage.ErrKeyNotFound，存储引擎不支持时返回 storage.ErrNotSupported
+func (n *Node) DeleteReturning(key []byte) ([]byte, error) {
+	if _, ok := n.engine.(storage.DeleteReturner); !ok {
+		return nil, storage.ErrNotSupported
+	}
+
+	// 创建命令
+	cmd := &LogCommand{
+		Type: CommandDelete,
+		Key:  key,
+	}
+
+	// 编码命令
+	data, err := encodeCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("编码命令失败: %w", err)
+	}
+
+	// 提交到 Raft
+	applyFuture := n.raft.Apply(data, 5*time.Second)
+	if err := applyFuture.Error(); err != nil {
+		return nil, fmt.Errorf("提交应用到 Raft 失败: %w", err)
+	}
+
+	// 检查返回结果
+	switch resp := applyFuture.Response().(type) {
+	case error:
+		return nil, resp
+	case *DeleteResult:
+		if !resp.Found {
+			return nil, storage.ErrKeyNotFound
+		}
+		return resp.PrevValue, nil
+	default:
+		return nil, fmt.Errorf("未知的删除结果: %T", resp)
+	}
+}
+
 // BatchPut 批量写入键值对
 // 所有操作通过单个 Raft 日志提交，提高批量写入性能
+// 同一个 key 出现多次时按 NodeConfig.RejectDuplicateBatchKeys 合并或拒绝，
+// 合并后每个 key 只写入最终结果
 func (n *Node) BatchPut(items []BatchCommandItem) error {
+	items, dup := collapseBatch(items)
+	if dup && n.config != nil && n.config.RejectDuplicateBatchKeys {
+		return ErrDuplicateKeyInBatch
+	}
+
 	// 创建批量命令
 	cmd := &BatchCommand{
+		Type:  CommandBatch,
 		Items: items,
 	}
 
@@ -349,6 +672,23 @@ func (n *Node) BatchPut(items []BatchCommandItem) error {
 	return nil
 }
 
+// PutAll 批量写入键值对
+// 作为一个批量命令通过单个 Raft 日志提交，同一个 key 出现多次时按 BatchPut 的规则处理
+func (n *Node) PutAll(pairs []storage.KV) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	items := make([]BatchCommandItem, len(pairs))
+	for i, kv := range pairs {
+		items[i] = BatchCommandItem{
+			Type:  CommandPut,
+			Key:   kv.Key,
+			Value: kv.Value,
+		}
+	}
+	return n.BatchPut(items)
+}
+
 // BatchDelete 批量删除键值对
 // 所有操作通过单个 Raft 日志提交，提高批量删除性能
 func (n *Node) BatchDelete(keys [][]byte) error {
@@ -362,6 +702,35 @@ func (n *Node) BatchDelete(keys [][]byte) error {
 	return n.BatchPut(items)
 }
 
+// ReplacePrefix 通过单个 Raft 日志原子地替换某个前缀下的全部键值对
+func (n *Node) ReplacePrefix(prefix []byte, kvs []storage.KV) error {
+	// 创建命令
+	cmd := &ReplacePrefixCommand{
+		Type:   CommandReplacePrefix,
+		Prefix: prefix,
+		Items:  kvs,
+	}
+
+	// 编码命令
+	data, err := encodeReplacePrefixCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("编码前缀替换命令失败: %w", err)
+	}
+
+	// 提交到 Raft
+	applyFuture := n.raft.Apply(data, 10*time.Second)
+	if err := applyFuture.Error(); err != nil {
+		return fmt.Errorf("提交应用到 Raft 失败: %w", err)
+	}
+
+	// 检查返回结果
+	if err, ok := applyFuture.Response().(error); ok && err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // ==================== 集群管理 ====================
 
 // AddPeer 添加节点到集群
@@ -387,6 +756,26 @@ func (n *Node) IsLeader() bool {
 	return n.raft.State() == raft.Leader
 }
 
+// AppliedIndex 返回本节点已应用到存储引擎的最后一条日志索引
+// 可用于实现其他节点的 AppliedIndexProber
+func (n *Node) AppliedIndex() uint64 {
+	return n.fsm.AppliedIndex()
+}
+
+// Stats 返回 Raft 的内部统计信息（raft.Stats() 的原始结果）
+func (n *Node) Stats() map[string]string {
+	return n.state.Stats()
+}
+
+// Configuration 返回当前的集群成员配置
+func (n *Node) Configuration() ([]raft.Server, error) {
+	future := n.state.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, fmt.Errorf("获取集群配置失败: %w", err)
+	}
+	return future.Configuration().Servers, nil
+}
+
 // GetPeers 获取集群中的所有节点
 func (n *Node) GetPeers() []raft.ServerID {
 	config := n.raft.GetConfiguration()
@@ -410,6 +799,49 @@ func (n *Node) Snapshot() error {
 	return future.Error()
 }
 
+// CompactLog 立即创建快照，并截断快照之前的全部日志以回收空间，例如在批量导入之后
+// Snapshot 按 TrailingLogs 保留快照之前的日志，便于稍有落后的节点通过日志追赶；
+// CompactLog 不保留这些日志，落后于快照的节点需要接收完整的快照
+// 自上次快照以来没有新日志时不创建新快照，只截断最近一次快照之前的日志
+//
+// 返回：
+//   - uint64: 截断后的第一条日志索引；日志被全部截断时为下一条日志的索引
+//   - error: 创建快照或截断日志失败
+func (n *Node) CompactLog() (uint64, error) {
+	if err := n.raft.Snapshot().Error(); err != nil && !errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return 0, fmt.Errorf("创建快照失败: %w", err)
+	}
+
+	snapshots, err := n.snapshots.List()
+	if err != nil {
+		return 0, fmt.Errorf("读取快照列表失败: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return 0, fmt.Errorf("没有可用的快照")
+	}
+	snapIndex := snapshots[0].Index // 按从新到旧排列
+
+	first, err := n.logs.FirstIndex()
+	if err != nil {
+		return 0, fmt.Errorf("读取第一条日志索引失败: %w", err)
+	}
+	// 快照已包含 snapIndex 之前的全部状态，截断与 Raft 自身的日志压缩一致，不会越过快照
+	if first != 0 && first <= snapIndex {
+		if err := n.logs.DeleteRange(first, snapIndex); err != nil {
+			return 0, fmt.Errorf("截断日志失败: %w", err)
+		}
+	}
+
+	first, err = n.logs.FirstIndex()
+	if err != nil {
+		return 0, fmt.Errorf("读取第一条日志索引失败: %w", err)
+	}
+	if first == 0 {
+		first = snapIndex + 1
+	}
+	return first, nil
+}
+
 // ==================== 关闭 ====================
 
 // Close 关闭 Raft 节点
@@ -420,6 +852,14 @@ func (n *Node) Close() error {
 		return fmt.Errorf("关闭 Raft 失败: %w", err)
 	}
 
+	// Raft 关闭后不会再有新的变更，停止变更投递
+	if n.fsm.changes != nil {
+		n.fsm.changes.close()
+	}
+	if n.fsm.watches != nil {
+		n.fsm.watches.close()
+	}
+
 	// 关闭底层存储引擎
 	if err := n.engine.Close(); err != nil {
 		return fmt.Errorf("关闭存储引擎失败: %w", err)
@@ -431,18 +871,68 @@ func (n *Node) Close() error {
 // ==================== 存储实现 ====================
 
 // logStore Raft 日志存储实现
+// 记录日志数据占用的字节数，用于观察日志压缩回收的空间
 type logStore struct {
 	*raft.InmemStore
+	bytes atomic.Int64
 }
 
 // newLogStore 创建新的日志存储
-func newLogStore(path string) (raft.LogStore, error) {
+func newLogStore(path string) (*logStore, error) {
 	// 使用内存存储（生产环境应使用 boltDB 或其他持久化存储）
 	return &logStore{
 		InmemStore: raft.NewInmemStore(),
 	}, nil
 }
 
+// StoreLog 写入一条日志
+func (s *logStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs 写入多条日志，覆盖已有索引时扣除旧日志的大小
+func (s *logStore) StoreLogs(logs []*raft.Log) error {
+	var delta int64
+	var old raft.Log
+	for _, log := range logs {
+		if s.InmemStore.GetLog(log.Index, &old) == nil {
+			delta -= logSize(&old)
+		}
+		delta += logSize(log)
+	}
+	if err := s.InmemStore.StoreLogs(logs); err != nil {
+		return err
+	}
+	s.bytes.Add(delta)
+	return nil
+}
+
+// DeleteRange 删除 [min, max] 范围内的日志
+func (s *logStore) DeleteRange(min, max uint64) error {
+	var delta int64
+	var old raft.Log
+	for i := min; i <= max; i++ {
+		if s.InmemStore.GetLog(i, &old) == nil {
+			delta -= logSize(&old)
+		}
+	}
+	if err := s.InmemStore.DeleteRange(min, max); err != nil {
+		return err
+	}
+	s.bytes.Add(delta)
+	return nil
+}
+
+// Bytes 返回当前保留的日志数据占用的字节数
+func (s *logStore) Bytes() int64 {
+	return s.bytes.Load()
+}
+
+// logSize 返回一条日志的数据大小
+func logSize(log *raft.Log) int64 {
+	return int64(len(log.Data) + len(log.Extensions))
+}
+
 // stableStore Raft 稳定存储实现
 type stableStore struct {
 	*raft.InmemStore
@@ -474,8 +964,89 @@ func newSnapshotStore(path string) (raft.SnapshotStore, error) {
 // Seek 查找第一个大于等于 key 的键，返回迭代器
 // 注意：Raft 集群中，Seek 是本地操作，不经过 Raft 共识
 func (n *Node) Seek(key []byte) (storage.Iterator, error) {
+	if err := n.checkReady(); err != nil {
+		return nil, err
+	}
 	return n.engine.Seek(key)
 }
 
+// EntryMeta 查询本地存储引擎中 key 对应 Entry 的元数据
+// 注意：EntryMeta 是本地诊断操作，不经过 Raft 共识
+func (n *Node) EntryMeta(key []byte) (*storage.EntryMeta, error) {
+	inspector, ok := n.engine.(storage.EntryInspector)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return inspector.EntryMeta(key)
+}
+
+// MemoryStats 估算本地存储引擎的内存占用
+// 注意：MemoryStats 是本地诊断操作，不经过 Raft 共识
+func (n *Node) MemoryStats() (*storage.MemoryStats, error) {
+	reporter, ok := n.engine.(storage.MemoryReporter)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return reporter.MemoryStats()
+}
+
+// KeyDistribution 统计本地索引中 key 的分布
+// 注意：KeyDistribution 是本地诊断操作，不经过 Raft 共识
+func (n *Node) KeyDistribution(buckets int) (*storage.KeyDistribution, error) {
+	reporter, ok := n.engine.(storage.KeyDistributionReporter)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return reporter.KeyDistribution(buckets)
+}
+
+// KeyCount 统计本地存储引擎中 key 的数量
+// 注意：KeyCount 是本地诊断操作，不经过 Raft 共识
+func (n *Node) KeyCount() (*storage.KeyCount, error) {
+	counter, ok := n.engine.(storage.KeyCounter)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return counter.KeyCount()
+}
+
+// LastAccess 查询本地存储引擎中 key 最近一次被访问的时间，引擎不支持时返回 false
+// 注意：LastAccess 是本地读取，不经过 Raft 共识，只反映本节点上的读取
+func (n *Node) LastAccess(key []byte) (time.Time, bool) {
+	reporter, ok := n.engine.(storage.AccessTimeReporter)
+	if !ok {
+		return time.Time{}, false
+	}
+	return reporter.LastAccess(key)
+}
+
+// GetPrefixAsMap 从本地存储引擎读取 prefix 下的全部键值对
+// 注意：GetPrefixAsMap 是本地读取，不经过 Raft 共识
+func (n *Node) GetPrefixAsMap(prefix []byte) (map[string][]byte, error) {
+	if err := n.checkReady(); err != nil {
+		return nil, err
+	}
+	reader, ok := n.engine.(storage.PrefixMapReader)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return reader.GetPrefixAsMap(prefix)
+}
+
+// EmitsWatchEvents 是否由 FSM 产生 Watch 事件（配置了 WatchHub）
+// 此时 HTTP 层不应再自行通知，否则客户端会收到重复的事件
+func (n *Node) EmitsWatchEvents() bool {
+	return n.config != nil && n.config.WatchHub != nil
+}
+
 // 确保 Node 实现了相关接口
 var _ storage.Engine = (*Node)(nil)
+var _ storage.EntryInspector = (*Node)(nil)
+var _ storage.PrefixMapReader = (*Node)(nil)
+var _ storage.VersionedWriter = (*Node)(nil)
+var _ storage.Appender = (*Node)(nil)
+var _ storage.DeleteReturner = (*Node)(nil)
+var _ storage.MemoryReporter = (*Node)(nil)
+var _ storage.BulkWriter = (*Node)(nil)
+var _ storage.KeyDistributionReporter = (*Node)(nil)
+var _ storage.AccessTimeReporter = (*Node)(nil)
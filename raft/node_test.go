@@ -0,0 +1,950 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/bitcask"
+	"github.com/forever-free1/TideKV/watch"
+	"github.com/hashicorp/raft"
+)
+
+// fakeRaftState 可控的 Raft 状态，用于模拟 Follower 的复制延迟与集群状态
+type fakeRaftState struct {
+	state       raft.RaftState
+	leader      raft.ServerAddress
+	leaderID    raft.ServerID
+	lastContact time.Time
+	stats       map[string]string
+	servers     []raft.Server
+}
+
+func (f *fakeRaftState) State() raft.RaftState      { return f.state }
+func (f *fakeRaftState) Leader() raft.ServerAddress { return f.leader }
+func (f *fakeRaftState) LastContact() time.Time     { return f.lastContact }
+func (f *fakeRaftState) Stats() map[string]string   { return f.stats }
+
+func (f *fakeRaftState) LeaderWithID() (raft.ServerAddress, raft.ServerID) {
+	return f.leader, f.leaderID
+}
+
+func (f *fakeRaftState) GetConfiguration() raft.ConfigurationFuture {
+	return &fakeConfigurationFuture{config: raft.Configuration{Servers: f.servers}}
+}
+
+// fakeConfigurationFuture 立即完成的 ConfigurationFuture
+type fakeConfigurationFuture struct {
+	config raft.Configuration
+}
+
+func (f *fakeConfigurationFuture) Error() error                      { return nil }
+func (f *fakeConfigurationFuture) Index() uint64                     { return 0 }
+func (f *fakeConfigurationFuture) Configuration() raft.Configuration { return f.config }
+
+func TestNode_GetWithin(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	db.Put([]byte("k"), []byte("local"))
+
+	var forwardedTo raft.ServerAddress
+	config := (&NodeConfig{}).WithReadForwarder(func(leader raft.ServerAddress, key []byte) ([]byte, error) {
+		forwardedTo = leader
+		return []byte("leader"), nil
+	})
+	state := &fakeRaftState{state: raft.Follower, leader: "10.0.0.1:7000"}
+	node := &Node{engine: db, state: state, config: config}
+
+	tests := []struct {
+		name         string
+		state        raft.RaftState
+		lag          time.Duration // 距上次与 Leader 通信的时长，0 表示从未通信
+		maxStaleness time.Duration
+		want         string
+	}{
+		{"Follower 延迟在范围内", raft.Follower, 50 * time.Millisecond, time.Second, "local"},
+		{"Follower 延迟超出范围", raft.Follower, 2 * time.Second, time.Second, "leader"},
+		{"Follower 从未与 Leader 通信", raft.Follower, 0, time.Hour, "leader"},
+		{"Leader 总是本地读取", raft.Leader, 0, 0, "local"},
+	}
+	for _, tt := range tests {
+		forwardedTo = ""
+		state.state = tt.state
+		state.lastContact = time.Time{}
+		if tt.lag > 0 {
+			state.lastContact = time.Now().Add(-tt.lag)
+		}
+
+		val, err := node.GetWithin([]byte("k"), tt.maxStaleness)
+		if err != nil {
+			t.Fatalf("%s: GetWithin 失败: %v", tt.name, err)
+		}
+		if string(val) != tt.want {
+			t.Errorf("%s: 值不匹配: got %s, want %s", tt.name, val, tt.want)
+		}
+		if tt.want == "leader" && forwardedTo != state.leader {
+			t.Errorf("%s: 应转发到 %s, 实际转发到 %q", tt.name, state.leader, forwardedTo)
+		}
+	}
+
+	// 未配置转发时返回 ErrStaleRead
+	node.config = &NodeConfig{}
+	state.state = raft.Follower
+	state.lastContact = time.Now().Add(-2 * time.Second)
+	if _, err := node.GetWithin([]byte("k"), time.Second); !errors.Is(err, ErrStaleRead) {
+		t.Errorf("期望 ErrStaleRead, 得到: %v", err)
+	}
+}
+
+func TestNode_ClusterStatus(t *testing.T) {
+	state := &fakeRaftState{
+		state:    raft.Follower,
+		leader:   "10.0.0.1:7000",
+		leaderID: "node-1",
+		stats: map[string]string{
+			"state":               "Follower",
+			"term":                "3",
+			"last_log_index":      "42",
+			"last_log_term":       "3",
+			"commit_index":        "40",
+			"applied_index":       "39",
+			"last_snapshot_index": "32",
+			"last_snapshot_term":  "2",
+		},
+		servers: []raft.Server{
+			{ID: "node-1", Address: "10.0.0.1:7000", Suffrage: raft.Voter},
+			{ID: "node-2", Address: "10.0.0.2:7000", Suffrage: raft.Voter},
+			{ID: "node-3", Address: "10.0.0.3:7000", Suffrage: raft.Nonvoter},
+		},
+	}
+	node := &Node{state: state, config: &NodeConfig{NodeID: "node-2"}}
+
+	status, err := node.ClusterStatus()
+	if err != nil {
+		t.Fatalf("ClusterStatus 失败: %v", err)
+	}
+	if status.NodeID != "node-2" || status.State != "Follower" || status.Term != 3 {
+		t.Errorf("节点信息不匹配: %+v", status)
+	}
+	if status.LeaderID != "node-1" || status.LeaderAddress != "10.0.0.1:7000" {
+		t.Errorf("Leader 信息不匹配: id=%s, address=%s", status.LeaderID, status.LeaderAddress)
+	}
+	if status.AppliedIndex != 39 || status.CommitIndex != 40 || status.LastLogIndex != 42 || status.LastLogTerm != 3 {
+		t.Errorf("日志索引不匹配: %+v", status)
+	}
+	if status.LastSnapshotIndex != 32 || status.LastSnapshotTerm != 2 {
+		t.Errorf("快照信息不匹配: index=%d, term=%d", status.LastSnapshotIndex, status.LastSnapshotTerm)
+	}
+
+	want := []ServerStatus{
+		{ID: "node-1", Address: "10.0.0.1:7000", Suffrage: "voter", IsLeader: true},
+		{ID: "node-2", Address: "10.0.0.2:7000", Suffrage: "voter"},
+		{ID: "node-3", Address: "10.0.0.3:7000", Suffrage: "nonvoter"},
+	}
+	if len(status.Servers) != len(want) {
+		t.Fatalf("节点数量不匹配: got %d, want %d", len(status.Servers), len(want))
+	}
+	for i, server := range status.Servers {
+		if server != want[i] {
+			t.Errorf("节点 %d 不匹配: got %+v, want %+v", i, server, want[i])
+		}
+	}
+}
+
+func TestNode_PutIfVersion(t *testing.T) {
+	nodes, engines := startCluster(t, 3)
+
+	var leader *Node
+	for _, node := range nodes {
+		if node.IsLeader() {
+			leader = node
+		}
+	}
+
+	seq, ok, err := leader.PutIfVersion([]byte("k"), []byte("v1"), 0)
+	if err != nil || !ok {
+		t.Fatalf("创建失败: ok %v, err %v", ok, err)
+	}
+	if cur, ok, err := leader.PutIfVersion([]byte("k"), []byte("dup"), 0); err != nil || ok || cur != seq {
+		t.Errorf("key 已存在时不应创建: got seq %d, ok %v, err %v", cur, ok, err)
+	}
+
+	next, ok, err := leader.PutIfVersion([]byte("k"), []byte("v2"), seq)
+	if err != nil || !ok {
+		t.Fatalf("版本匹配时写入失败: ok %v, err %v", ok, err)
+	}
+	if cur, ok, err := leader.PutIfVersion([]byte("k"), []byte("stale"), seq); err != nil || ok || cur != next {
+		t.Errorf("过期版本不应写入: got seq %d, ok %v, err %v", cur, ok, err)
+	}
+
+	// 所有副本以相同的顺序分配写入序号，版本在集群内一致
+	if err := leader.PutWithAck([]byte("sync"), []byte("1"), AckAll); err != nil {
+		t.Fatalf("等待全部节点应用失败: %v", err)
+	}
+	for i, engine := range engines {
+		meta, err := engine.EntryMeta([]byte("k"))
+		if err != nil || meta.Seq != next {
+			t.Errorf("节点 %d 版本不一致: got %+v, err %v, want seq %d", i, meta, err, next)
+		}
+		if val, _ := engine.Get([]byte("k")); string(val) != "v2" {
+			t.Errorf("节点 %d 值不匹配: got %s", i, val)
+		}
+	}
+}
+
+func TestNode_Append(t *testing.T) {
+	nodes, engines := startCluster(t, 3)
+
+	var leader *Node
+	for _, node := range nodes {
+		if node.IsLeader() {
+			leader = node
+		}
+	}
+
+	const workers, perWorker = 4, 10
+	keys := make([][]string, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key, err := leader.Append([]byte(fmt.Sprintf("%d-%d", w, i)))
+				if err != nil {
+					t.Errorf("Append 失败: %v", err)
+					return
+				}
+				keys[w] = append(keys[w], string(key))
+			}
+		}(w)
+		// 同时进行的其他写入占用日志索引，但不推进追加写入计数器
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if err := leader.Put([]byte(fmt.Sprintf("other-%d-%d", w, i)), []byte("x")); err != nil {
+					t.Errorf("Put 失败: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// 每个 goroutine 内部按提交顺序递增，且所有 key 互不相同
+	seen := make(map[string]bool)
+	var all []string
+	for w := range keys {
+		for i, key := range keys[w] {
+			if i > 0 && key <= keys[w][i-1] {
+				t.Fatalf("key 未按提交顺序递增: %s <= %s", key, keys[w][i-1])
+			}
+			if seen[key] {
+				t.Fatalf("key 重复: %s", key)
+			}
+			seen[key] = true
+			all = append(all, key)
+		}
+	}
+
+	// 与其他写入交错时 key 仍从 1 开始连续
+	sort.Strings(all)
+	for i, key := range all {
+		if want := string(storage.AppendKey(uint64(i + 1))); key != want {
+			t.Fatalf("key 不连续: got %s, want %s", key, want)
+		}
+	}
+
+	// 所有副本使用相同的 key
+	if err := leader.PutWithAck([]byte("sync"), []byte("1"), AckAll); err != nil {
+		t.Fatalf("等待全部节点应用失败: %v", err)
+	}
+	for i, engine := range engines {
+		for _, key := range all {
+			if _, err := engine.Get([]byte(key)); err != nil {
+				t.Fatalf("节点 %d 缺少 %s: %v", i, key, err)
+			}
+		}
+	}
+}
+
+func TestNode_DeleteReturning(t *testing.T) {
+	nodes, _ := startCluster(t, 1)
+	node := nodes[0]
+
+	if err := node.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	prev, err := node.DeleteReturning([]byte("k"))
+	if err != nil || string(prev) != "v" {
+		t.Fatalf("应返回删除前的值: got %s, err %v", prev, err)
+	}
+	if _, err := node.Get([]byte("k")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("删除后应不存在, 得到: %v", err)
+	}
+	if _, err := node.DeleteReturning([]byte("k")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("删除不存在的 key 应返回 ErrKeyNotFound, 得到: %v", err)
+	}
+
+	// 普通 Delete 不受结果类型影响
+	node.Put([]byte("k"), []byte("v"))
+	if err := node.Delete([]byte("k")); err != nil {
+		t.Errorf("Delete 失败: %v", err)
+	}
+	if err := node.Delete([]byte("k")); err != nil {
+		t.Errorf("删除不存在的 key 不应报错: %v", err)
+	}
+}
+
+func TestCollapseBatch(t *testing.T) {
+	items := []BatchCommandItem{
+		{Type: CommandPut, Key: []byte("a"), Value: []byte("1")},
+		{Type: CommandPut, Key: []byte("b"), Value: []byte("1")},
+		{Type: CommandDelete, Key: []byte("a")},
+		{Type: CommandPut, Key: []byte("c"), Value: []byte("1")},
+		{Type: CommandPut, Key: []byte("b"), Value: []byte("2")},
+	}
+
+	collapsed, dup := collapseBatch(items)
+	if !dup {
+		t.Fatalf("应检测到重复的 key")
+	}
+	want := []BatchCommandItem{
+		{Type: CommandDelete, Key: []byte("a")},
+		{Type: CommandPut, Key: []byte("c"), Value: []byte("1")},
+		{Type: CommandPut, Key: []byte("b"), Value: []byte("2")},
+	}
+	if !reflect.DeepEqual(collapsed, want) {
+		t.Errorf("合并结果不匹配: got %+v, want %+v", collapsed, want)
+	}
+
+	unique := items[:2]
+	if collapsed, dup := collapseBatch(unique); dup || !reflect.DeepEqual(collapsed, unique) {
+		t.Errorf("没有重复 key 时应原样返回: got %+v, dup %v", collapsed, dup)
+	}
+}
+
+func TestNode_BatchDuplicateKeys(t *testing.T) {
+	nodes, _ := startCluster(t, 1)
+	node := nodes[0]
+
+	node.Put([]byte("a"), []byte("old"))
+
+	// 默认按 key 合并：先 Put 后 Delete 合并为 Delete，两次 Put 合并为后一次
+	err := node.BatchPut([]BatchCommandItem{
+		{Type: CommandPut, Key: []byte("a"), Value: []byte("1")},
+		{Type: CommandPut, Key: []byte("b"), Value: []byte("1")},
+		{Type: CommandDelete, Key: []byte("a")},
+		{Type: CommandPut, Key: []byte("b"), Value: []byte("2")},
+	})
+	if err != nil {
+		t.Fatalf("BatchPut 失败: %v", err)
+	}
+	if _, err := node.Get([]byte("a")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("先 Put 后 Delete 应合并为 Delete, 得到: %v", err)
+	}
+	if value, _ := node.Get([]byte("b")); string(value) != "2" {
+		t.Errorf("两次 Put 应保留后一次: got %s, want 2", value)
+	}
+
+	// 拒绝模式：存在重复 key 时整个批量命令不生效
+	node.config.RejectDuplicateBatchKeys = true
+	err = node.BatchPut([]BatchCommandItem{
+		{Type: CommandPut, Key: []byte("c"), Value: []byte("1")},
+		{Type: CommandPut, Key: []byte("c"), Value: []byte("2")},
+	})
+	if !errors.Is(err, ErrDuplicateKeyInBatch) {
+		t.Fatalf("应返回 ErrDuplicateKeyInBatch, 得到: %v", err)
+	}
+	if _, err := node.Get([]byte("c")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("被拒绝的批量命令不应生效, 得到: %v", err)
+	}
+
+	// 拒绝模式下没有重复 key 的批量命令正常执行
+	if err := node.BatchDelete([][]byte{[]byte("b")}); err != nil {
+		t.Fatalf("BatchDelete 失败: %v", err)
+	}
+	if _, err := node.Get([]byte("b")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("BatchDelete 后应不存在, 得到: %v", err)
+	}
+}
+
+func TestNode_PutAll(t *testing.T) {
+	nodes, _ := startCluster(t, 3)
+
+	var leader *Node
+	for _, node := range nodes {
+		if node.IsLeader() {
+			leader = node
+		}
+	}
+
+	pairs := make([]storage.KV, 100)
+	for i := range pairs {
+		pairs[i] = storage.KV{Key: []byte(fmt.Sprintf("k%03d", i)), Value: []byte(strconv.Itoa(i))}
+	}
+	if err := leader.PutAll(pairs); err != nil {
+		t.Fatalf("PutAll 失败: %v", err)
+	}
+
+	// 以单个批量命令提交，所有节点应用后数据一致
+	deadline := time.Now().Add(5 * time.Second)
+	for _, node := range nodes {
+		for node.AppliedIndex() < leader.AppliedIndex() {
+			if time.Now().After(deadline) {
+				t.Fatalf("节点未在超时前应用批量命令")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, kv := range pairs {
+			if value, err := node.Get(kv.Key); err != nil || string(value) != string(kv.Value) {
+				t.Fatalf("读取 %s 不匹配: got %s, err %v", kv.Key, value, err)
+			}
+		}
+	}
+}
+
+func TestNode_TransferLeadership(t *testing.T) {
+	nodes, _ := startCluster(t, 3)
+
+	var leader *Node
+	var followers []*Node
+	for _, node := range nodes {
+		if node.IsLeader() {
+			leader = node
+		} else {
+			followers = append(followers, node)
+		}
+	}
+
+	// Follower 不能发起转移
+	if err := followers[0].TransferLeadership(leader.config.NodeID); !errors.Is(err, raft.ErrNotLeader) {
+		t.Fatalf("Follower 发起转移应返回 ErrNotLeader, 得到: %v", err)
+	}
+
+	// 目标不在集群中
+	if err := leader.TransferLeadership("node-x"); !errors.Is(err, ErrUnknownServer) {
+		t.Fatalf("未知目标应返回 ErrUnknownServer, 得到: %v", err)
+	}
+
+	// 目标没有投票权
+	if err := leader.raft.AddNonvoter("learner", raft.ServerAddress(freeAddr(t)), 0, 5*time.Second).Error(); err != nil {
+		t.Fatalf("添加非投票节点失败: %v", err)
+	}
+	if err := leader.TransferLeadership("learner"); !errors.Is(err, ErrNotVoter) {
+		t.Fatalf("非投票节点应返回 ErrNotVoter, 得到: %v", err)
+	}
+
+	// 转移到指定的 Follower
+	target := followers[1]
+	if err := leader.TransferLeadership(target.config.NodeID); err != nil {
+		t.Fatalf("转移 Leadership 失败: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !target.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s 未成为 Leader", target.config.NodeID)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if leader.IsLeader() {
+		t.Fatal("原 Leader 转移后不应仍是 Leader")
+	}
+
+	// 新 Leader 可以正常写入
+	if err := target.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("新 Leader 写入失败: %v", err)
+	}
+}
+
+func TestNode_WatchEventsAcrossNodes(t *testing.T) {
+	hubs := make([]*watch.WatchHub, 3)
+	for i := range hubs {
+		hubs[i] = watch.NewWatchHub()
+	}
+	nodes, _ := startCluster(t, 3, func(i int, config *NodeConfig) {
+		config.WithWatchHub(hubs[i])
+	})
+	if !nodes[0].EmitsWatchEvents() {
+		t.Fatal("配置了 WatchHub 的节点应自行产生事件")
+	}
+
+	var leader *Node
+	for _, node := range nodes {
+		if node.IsLeader() {
+			leader = node
+		}
+	}
+
+	// 两个客户端分别连接到不同的节点
+	watchers := []*watch.Watcher{hubs[0].Watch("app/", 100), hubs[2].Watch("app/", 100)}
+
+	leader.Put([]byte("app/a"), []byte("1"))
+	leader.Put([]byte("other/x"), []byte("ignored"))
+	leader.Put([]byte("app/a"), []byte("2"))
+	leader.Delete([]byte("app/a"))
+	leader.BatchPut([]BatchCommandItem{
+		{Type: CommandPut, Key: []byte("app/b"), Value: []byte("3")},
+		{Type: CommandPut, Key: []byte("app/c"), Value: []byte("4")},
+	})
+
+	const want = 5
+	sequences := make([][]watch.Event, len(watchers))
+	for i, watcher := range watchers {
+		timeout := time.After(5 * time.Second)
+		for len(sequences[i]) < want {
+			select {
+			case event := <-watcher.Ch:
+				sequences[i] = append(sequences[i], *event)
+			case <-timeout:
+				t.Fatalf("客户端 %d 超时, 只收到 %d 个事件: %+v", i, len(sequences[i]), sequences[i])
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(sequences[0], sequences[1]) {
+		t.Fatalf("不同节点上的事件序列不一致:\n%+v\n%+v", sequences[0], sequences[1])
+	}
+
+	events := sequences[0]
+	if events[1].PrevValue != "1" || events[2].Type != watch.EventDelete || events[2].PrevValue != "2" {
+		t.Errorf("事件内容不匹配: %+v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq < events[i-1].Seq || events[i].Seq == 0 {
+			t.Fatalf("事件 Seq 应为递增的日志索引: %+v", events)
+		}
+	}
+	// 同一批量命令中的事件共享 Seq
+	if events[3].Seq != events[4].Seq || events[3].Seq == events[2].Seq {
+		t.Errorf("批量命令的事件 Seq 不匹配: %+v", events)
+	}
+}
+
+func TestNode_ReadinessGate(t *testing.T) {
+	nodes, _ := startCluster(t, 1)
+	leader := nodes[0]
+	if !leader.Ready() {
+		t.Fatal("未启用 ReadinessGate 的节点应总是就绪")
+	}
+	for i := 0; i < 5; i++ {
+		if err := leader.Put([]byte(fmt.Sprintf("k%d", i)), []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	engine := &gatedEngine{DB: db}
+	engine.block()
+	defer engine.release()
+
+	config := (&NodeConfig{
+		NodeID:   "joiner",
+		BindAddr: freeAddr(t),
+		DataDir:  dir,
+	}).WithReadinessGate(true).WithAppliedIndexProber(func(server raft.Server) (uint64, error) {
+		return leader.AppliedIndex(), nil
+	})
+	joiner, err := NewNode(engine, config)
+	if err != nil {
+		t.Fatalf("创建节点失败: %v", err)
+	}
+	defer joiner.Close()
+
+	// 加入集群之前拒绝读取
+	if joiner.Ready() {
+		t.Fatal("加入集群之前不应就绪")
+	}
+	if _, err := joiner.Get([]byte("k0")); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("未就绪时应返回 ErrNotReady, 得到: %v", err)
+	}
+
+	if err := leader.AddPeer("joiner", config.BindAddr); err != nil {
+		t.Fatalf("添加节点失败: %v", err)
+	}
+
+	// 已成为集群成员，但存储引擎还没有应用日志，仍然拒绝读取
+	deadline := time.Now().Add(5 * time.Second)
+	for len(joiner.GetPeers()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("超时未收到集群配置")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := joiner.Get([]byte("k0")); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("追上 Leader 之前应返回 ErrNotReady, 得到: %v", err)
+	}
+	if _, err := joiner.GetPrefixAsMap([]byte("k")); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("追上 Leader 之前前缀读取应返回 ErrNotReady, 得到: %v", err)
+	}
+
+	engine.release()
+	deadline = time.Now().Add(5 * time.Second)
+	for !joiner.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatalf("超时未就绪: %v", joiner.checkReady())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		if val, err := joiner.Get([]byte(fmt.Sprintf("k%d", i))); err != nil || string(val) != "v" {
+			t.Fatalf("就绪后读取 k%d 失败: %q, %v", i, val, err)
+		}
+	}
+}
+
+func TestNode_StuckWatcherDoesNotBlockApply(t *testing.T) {
+	const sendTimeout = time.Second
+	hub := watch.NewWatchHub(watch.WithSendTimeout(sendTimeout))
+	nodes, _ := startCluster(t, 1, func(i int, config *NodeConfig) {
+		config.WithWatchHub(hub).WithWatchQueueSize(4)
+	})
+	node := nodes[0]
+
+	// 从不读取的 Watcher：缓冲区满后每次发送都要等待 sendTimeout
+	hub.Watch("", 1)
+
+	const writes = 100
+	start := time.Now()
+	for i := 0; i < writes; i++ {
+		if err := node.Put([]byte(fmt.Sprintf("k%d", i)), []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= sendTimeout {
+		t.Fatalf("卡住的 Watcher 不应拖慢 Apply: %d 次写入耗时 %v", writes, elapsed)
+	}
+
+	// 分发 goroutine 卡在发送上，队列很快写满，之后的事件被丢弃
+	if dropped := node.WatchEventsDropped(); dropped == 0 || dropped >= writes {
+		t.Errorf("丢弃计数不匹配: got %d", dropped)
+	}
+}
+
+func TestBitcaskFSM_SnapshotRestore(t *testing.T) {
+	open := func() *bitcask.DB {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		db, err := bitcask.Open(dir)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	src := open()
+	for i := 0; i < 50; i++ {
+		src.Put([]byte(fmt.Sprintf("k%02d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+	src.Put([]byte("empty"), nil)
+	snap, err := NewBitcaskFSM(src).Snapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	// 快照是创建时的状态，之后的写入不影响快照内容
+	src.Put([]byte("k00"), []byte("changed"))
+
+	store := raft.NewInmemSnapshotStore()
+	sink, err := store.Create(raft.SnapshotVersionMax, 10, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatalf("创建快照存储失败: %v", err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("持久化快照失败: %v", err)
+	}
+	snap.Release()
+
+	// 目标状态机中有快照不存在的 key，以及与快照不同的值
+	dst := open()
+	dst.Put([]byte("stale"), []byte("x"))
+	dst.Put([]byte("k01"), []byte("old"))
+	_, rc, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatalf("打开快照失败: %v", err)
+	}
+	if err := NewBitcaskFSM(dst).Restore(rc); err != nil {
+		t.Fatalf("恢复快照失败: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		val, err := dst.Get([]byte(fmt.Sprintf("k%02d", i)))
+		if err != nil || string(val) != fmt.Sprintf("v%d", i) {
+			t.Fatalf("k%02d 恢复后不匹配: %q, %v", i, val, err)
+		}
+	}
+	if val, err := dst.Get([]byte("empty")); err != nil || len(val) != 0 {
+		t.Fatalf("空 value 恢复后不匹配: %q, %v", val, err)
+	}
+	if _, err := dst.Get([]byte("stale")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("快照中不存在的 key 应被删除, 得到: %v", err)
+	}
+
+	// 截断的快照数据返回错误
+	if err := NewBitcaskFSM(dst).Restore(io.NopCloser(bytes.NewReader([]byte{5, 'a', 'b'}))); err == nil {
+		t.Fatalf("截断的快照应返回错误")
+	}
+}
+
+func TestBitcaskFSM_PutIfVersionReplicated(t *testing.T) {
+	open := func() *bitcask.DB {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		db, err := bitcask.Open(dir)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	logs := []*LogCommand{
+		{Type: CommandPut, Key: []byte("k"), Value: []byte("v1")},
+		{Type: CommandPut, Key: []byte("other"), Value: []byte("x")},
+		{Type: CommandPut, Key: []byte("k"), Value: []byte("v2")},
+		{Type: CommandDelete, Key: []byte("other")},
+	}
+
+	leader := NewBitcaskFSM(open())
+	for i, cmd := range logs {
+		applyCommand(t, leader, uint64(i+1), cmd)
+	}
+
+	// Follower 的本地写入序号与 Leader 不同，重启后又重放了一遍日志
+	followerDB := open()
+	followerDB.Put([]byte("local"), []byte("1"))
+	follower := NewBitcaskFSM(followerDB)
+	for round := 0; round < 2; round++ {
+		for i, cmd := range logs {
+			applyCommand(t, follower, uint64(i+1), cmd)
+		}
+	}
+
+	// 从 Leader 的快照恢复的节点
+	snap, err := leader.Snapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	store := raft.NewInmemSnapshotStore()
+	sink, err := store.Create(raft.SnapshotVersionMax, uint64(len(logs)), 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatalf("创建快照存储失败: %v", err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("持久化快照失败: %v", err)
+	}
+	restoredDB := open()
+	for i := 0; i < 10; i++ {
+		restoredDB.Put([]byte("local"), []byte(fmt.Sprint(i)))
+	}
+	_, rc, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatalf("打开快照失败: %v", err)
+	}
+	restored := NewBitcaskFSM(restoredDB)
+	if err := restored.Restore(rc); err != nil {
+		t.Fatalf("恢复快照失败: %v", err)
+	}
+
+	// 版本是最后一次写入 k 的日志索引，三个节点对同一条条件写入做出相同的决定
+	conditional := []struct {
+		expected uint64
+		want     PutIfVersionResult
+	}{
+		{expected: 3, want: PutIfVersionResult{Seq: 5, OK: true}},
+		{expected: 3, want: PutIfVersionResult{Seq: 5, OK: false}},
+		{expected: 5, want: PutIfVersionResult{Seq: 7, OK: true}},
+	}
+	for i, c := range conditional {
+		index := uint64(len(logs) + 1 + i)
+		data, err := encodeCommand(&LogCommand{Type: CommandPutIfVersion, Key: []byte("k"), Value: []byte(fmt.Sprint(i)), ExpectedSeq: c.expected})
+		if err != nil {
+			t.Fatalf("编码命令失败: %v", err)
+		}
+		for name, fsm := range map[string]*BitcaskFSM{"leader": leader, "follower": follower, "restored": restored} {
+			result, ok := fsm.Apply(&raft.Log{Index: index, Data: data}).(*PutIfVersionResult)
+			if !ok || *result != c.want {
+				t.Fatalf("%s 第 %d 次条件写入: got %+v, want %+v", name, i, result, c.want)
+			}
+		}
+	}
+}
+
+func TestBitcaskFSM_AppendReplicated(t *testing.T) {
+	open := func() *bitcask.DB {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		db, err := bitcask.Open(dir)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	apply := func(fsm *BitcaskFSM, index uint64, cmd *LogCommand) interface{} {
+		data, err := encodeCommand(cmd)
+		if err != nil {
+			t.Fatalf("编码命令失败: %v", err)
+		}
+		return fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+	logs := []*LogCommand{
+		{Type: CommandAppend, Value: []byte("a")},
+		{Type: CommandPut, Key: []byte("k"), Value: []byte("v")},
+		{Type: CommandAppend, Value: []byte("b")},
+	}
+
+	leader := NewBitcaskFSM(open())
+	for i, cmd := range logs {
+		apply(leader, uint64(i+1), cmd)
+	}
+
+	// 重启后从第一条日志重放：引擎中已有的数据不影响分配的 key
+	replayedDB := open()
+	replayed := NewBitcaskFSM(replayedDB)
+	for i, cmd := range logs {
+		apply(replayed, uint64(i+1), cmd)
+	}
+	replayed = NewBitcaskFSM(replayedDB)
+	for i, cmd := range logs {
+		apply(replayed, uint64(i+1), cmd)
+	}
+
+	// 从 Leader 的快照恢复
+	snap, err := leader.Snapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	store := raft.NewInmemSnapshotStore()
+	sink, err := store.Create(raft.SnapshotVersionMax, uint64(len(logs)), 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatalf("创建快照存储失败: %v", err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("持久化快照失败: %v", err)
+	}
+	_, rc, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatalf("打开快照失败: %v", err)
+	}
+	restored := NewBitcaskFSM(open())
+	if err := restored.Restore(rc); err != nil {
+		t.Fatalf("恢复快照失败: %v", err)
+	}
+
+	next := &LogCommand{Type: CommandAppend, Value: []byte("c")}
+	want := string(storage.AppendKey(3))
+	for name, fsm := range map[string]*BitcaskFSM{"leader": leader, "replayed": replayed, "restored": restored} {
+		key, ok := apply(fsm, uint64(len(logs)+1), next).([]byte)
+		if !ok || string(key) != want {
+			t.Fatalf("%s 分配的 key 不匹配: got %s, want %s", name, key, want)
+		}
+	}
+}
+
+func TestNode_CompactLog(t *testing.T) {
+	nodes, _ := startCluster(t, 1)
+	leader := nodes[0]
+
+	value := bytes.Repeat([]byte("x"), 1024)
+	for i := 0; i < 300; i++ {
+		if err := leader.Put([]byte(fmt.Sprintf("k%03d", i)), value); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	firstBefore, _ := leader.logs.FirstIndex()
+	bytesBefore := leader.logs.Bytes()
+	if bytesBefore < 300*1024 {
+		t.Fatalf("日志占用的空间不符合预期: %d", bytesBefore)
+	}
+
+	first, err := leader.CompactLog()
+	if err != nil {
+		t.Fatalf("压缩日志失败: %v", err)
+	}
+	if first <= firstBefore || first <= 300 {
+		t.Fatalf("第一条日志索引应前移: %d -> %d", firstBefore, first)
+	}
+	if after := leader.logs.Bytes(); after >= bytesBefore/10 {
+		t.Fatalf("日志占用的空间应被回收: %d -> %d", bytesBefore, after)
+	}
+
+	// 没有新日志时再次压缩不报错
+	if again, err := leader.CompactLog(); err != nil || again != first {
+		t.Fatalf("重复压缩结果不匹配: %d, %v", again, err)
+	}
+	if err := leader.Put([]byte("after"), []byte("1")); err != nil {
+		t.Fatalf("压缩后写入失败: %v", err)
+	}
+
+	// 日志已被截断，新加入的节点只能通过快照获得之前的数据
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	config := &NodeConfig{NodeID: "joiner", BindAddr: freeAddr(t), DataDir: dir}
+	joiner, err := NewNode(db, config)
+	if err != nil {
+		t.Fatalf("创建节点失败: %v", err)
+	}
+	defer joiner.Close()
+	if err := leader.AddPeer("joiner", config.BindAddr); err != nil {
+		t.Fatalf("添加节点失败: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err0 := db.Get([]byte("k000"))
+		val, err1 := db.Get([]byte("after"))
+		if err0 == nil && err1 == nil && string(val) == "1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("新节点超时未从快照恢复: %v, %v", err0, err1)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if val, err := db.Get([]byte("k299")); err != nil || !bytes.Equal(val, value) {
+		t.Fatalf("新节点的数据不匹配: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/raft"
+)
+
+// ==================== 集群状态 ====================
+
+// ServerStatus 集群中单个节点的状态
+type ServerStatus struct {
+	ID       string // 节点 ID
+	Address  string // Raft 地址
+	Suffrage string // 投票权：voter / nonvoter / staging
+	IsLeader bool   // 是否为当前 Leader
+}
+
+// ClusterStatus 从本节点视角看到的 Raft 集群状态
+type ClusterStatus struct {
+	NodeID        string // 本节点 ID
+	State         string // 本节点角色：Leader / Follower / Candidate / Shutdown
+	Term          uint64 // 当前任期
+	LeaderID      string // Leader 节点 ID（未知时为空）
+	LeaderAddress string // Leader 地址（未知时为空）
+
+	Servers []ServerStatus // 集群成员
+
+	AppliedIndex uint64 // 已应用到状态机的日志索引
+	CommitIndex  uint64 // 已提交的日志索引
+	LastLogIndex uint64 // 最后一条日志的索引
+	LastLogTerm  uint64 // 最后一条日志的任期
+
+	LastSnapshotIndex uint64 // 最近一次快照的日志索引
+	LastSnapshotTerm  uint64 // 最近一次快照的任期
+}
+
+// ClusterStatus 汇总 raft.Stats() 与集群配置，返回完整的集群状态
+// 返回：
+//   - *ClusterStatus: 集群状态
+//   - error: 获取集群配置失败时返回错误
+func (n *Node) ClusterStatus() (*ClusterStatus, error) {
+	servers, err := n.Configuration()
+	if err != nil {
+		return nil, err
+	}
+	stats := n.Stats()
+	leaderAddr, leaderID := n.state.LeaderWithID()
+
+	status := &ClusterStatus{
+		State:             stats["state"],
+		Term:              parseStat(stats, "term"),
+		LeaderID:          string(leaderID),
+		LeaderAddress:     string(leaderAddr),
+		AppliedIndex:      parseStat(stats, "applied_index"),
+		CommitIndex:       parseStat(stats, "commit_index"),
+		LastLogIndex:      parseStat(stats, "last_log_index"),
+		LastLogTerm:       parseStat(stats, "last_log_term"),
+		LastSnapshotIndex: parseStat(stats, "last_snapshot_index"),
+		LastSnapshotTerm:  parseStat(stats, "last_snapshot_term"),
+	}
+	if n.config != nil {
+		status.NodeID = string(n.config.NodeID)
+	}
+
+	for _, server := range servers {
+		status.Servers = append(status.Servers, ServerStatus{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Suffrage: suffrageName(server.Suffrage),
+			IsLeader: server.ID == leaderID,
+		})
+	}
+	return status, nil
+}
+
+// parseStat 解析 raft.Stats() 中的数值字段，缺失或无法解析时返回 0
+func parseStat(stats map[string]string, key string) uint64 {
+	v, err := strconv.ParseUint(stats[key], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// suffrageName 返回投票权的名称
+func suffrageName(s raft.ServerSuffrage) string {
+	switch s {
+	case raft.Voter:
+		return "voter"
+	case raft.Nonvoter:
+		return "nonvoter"
+	case raft.Staging:
+		return "staging"
+	default:
+		return "unknown"
+	}
+}
+
+// ==================== Leader 转移 ====================
+
+// TransferLeadership 将 Leadership 主动转移给指定节点，用于计划内维护时避免选举带来的不可用
+// 参数：
+//   - targetID: 目标节点 ID；为空时由 Raft 选择最合适的节点
+//
+// 返回：
+//   - error: 本节点不是 Leader 时返回 raft.ErrNotLeader；
+//     目标不在集群中返回 ErrUnknownServer，目标没有投票权返回 ErrNotVoter
+func (n *Node) TransferLeadership(targetID raft.ServerID) error {
+	if n.raft.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+	if targetID == "" {
+		return n.raft.LeadershipTransfer().Error()
+	}
+
+	servers, err := n.Configuration()
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if server.ID != targetID {
+			continue
+		}
+		if server.Suffrage != raft.Voter {
+			return fmt.Errorf("%w: %s", ErrNotVoter, targetID)
+		}
+		// 目标就是本节点，已经是 Leader
+		if n.config != nil && server.ID == n.config.NodeID {
+			return nil
+		}
+		return n.raft.LeadershipTransferToServer(server.ID, server.Address).Error()
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownServer, targetID)
+}
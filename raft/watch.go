@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"sync/atomic"
+
+	"github.com/forever-free1/TideKV/metrics"
+	"github.com/forever-free1/TideKV/watch"
+)
+
+// ==================== Watch 事件分发 ====================
+//
+// FSM 在 Apply 中产生 Watch 事件，但 Apply 绝不能被慢速或卡住的 Watcher 阻塞：
+// Apply 是串行的，一旦阻塞，本节点无法继续应用日志，Leader 上的写入也会随之停滞。
+// 因此事件先进入有界队列，由单独的 goroutine 调用 WatchHub.Notify（Notify 可能按 SendTimeout 等待）；
+// 队列已满时直接丢弃事件并计数，而不是阻塞 Apply。
+// Watch 本身就是尽力而为的推送，需要不丢失的变更流时应使用 ChangeHook。
+
+// defaultWatchQueueSize Watch 事件分发队列的默认容量
+const defaultWatchQueueSize = 1024
+
+// WithWatchQueueSize 设置 FSM 到 WatchHub 的事件分发队列容量，<= 0 表示使用默认值（1024）
+func (c *NodeConfig) WithWatchQueueSize(size int) *NodeConfig {
+	c.WatchQueueSize = size
+	return c
+}
+
+// watchDispatcher 异步将事件分发到 WatchHub
+type watchDispatcher struct {
+	hub     *watch.WatchHub
+	queue   chan *watch.Event
+	dropped atomic.Uint64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newWatchDispatcher 创建事件分发器并启动分发 goroutine
+func newWatchDispatcher(hub *watch.WatchHub, queueSize int) *watchDispatcher {
+	if queueSize <= 0 {
+		queueSize = defaultWatchQueueSize
+	}
+	d := &watchDispatcher{
+		hub:   hub,
+		queue: make(chan *watch.Event, queueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// enqueue 将事件放入队列，队列已满时不阻塞，丢弃事件并计数
+func (d *watchDispatcher) enqueue(event *watch.Event) {
+	select {
+	case d.queue <- event:
+	default:
+		d.dropped.Add(1)
+		metrics.RecordWatchEventDropped()
+	}
+}
+
+// run 按入队顺序分发事件
+func (d *watchDispatcher) run() {
+	defer close(d.done)
+	for {
+		select {
+		case <-d.stop:
+			return
+		case event := <-d.queue:
+			d.hub.Notify(event)
+		}
+	}
+}
+
+// close 停止分发，等待正在进行的 Notify 返回；队列中尚未分发的事件被丢弃
+// 卡住的 Watcher 可能让每个事件都等待 SendTimeout，逐个分发完剩余事件会让关闭变得很慢
+// 调用前必须确保不会再有新的事件入队
+func (d *watchDispatcher) close() {
+	close(d.stop)
+	<-d.done
+}
+
+// WatchEventsDropped 返回 FSM 产生的 Watch 事件中因分发队列已满被丢弃的数量
+func (n *Node) WatchEventsDropped() uint64 {
+	if n.fsm.watches == nil {
+		return 0
+	}
+	return n.fsm.watches.dropped.Load()
+}
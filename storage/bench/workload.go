@@ -0,0 +1,370 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 负载定义 ====================
+//
+// bench 为存储引擎生成可复现的负载（key 分布、读写比例、value 大小）并测量吞吐与延迟分位数，
+// 供基准测试与性能相关的测试导入，在同样的负载下比较同步策略、预读等配置的效果。
+
+// Distribution key 的访问分布
+type Distribution string
+
+const (
+	// DistributionUniform 每个 key 被访问的概率相同
+	DistributionUniform Distribution = "uniform"
+	// DistributionZipfian 少数热点 key 占据大部分访问，热点 key 在 key 空间中打散分布
+	DistributionZipfian Distribution = "zipfian"
+)
+
+// 未设置时使用的默认值
+const (
+	DefaultKeys      = 10000
+	DefaultKeyPrefix = "key-"
+	DefaultValueSize = 100
+	DefaultZipfS     = 1.1
+)
+
+// Workload 负载配置，零值字段使用默认值
+type Workload struct {
+	Keys         int          // key 空间大小，默认 10000
+	KeyPrefix    string       // key 前缀，默认 "key-"
+	Distribution Distribution // 访问分布，默认均匀分布
+	ZipfS        float64      // Zipf 分布的倾斜参数，必须大于 1，越大越集中，默认 1.1
+	ReadRatio    float64      // 读操作的比例，取值 [0, 1]，其余为写操作
+	ValueSize    int          // value 大小，默认 100 字节
+	ValueSizeMax int          // 大于 ValueSize 时 value 大小在 [ValueSize, ValueSizeMax] 内均匀分布
+	Seed         int64        // 随机种子，相同的种子生成相同的操作序列
+}
+
+// withDefaults 返回填充默认值后的配置
+func (w Workload) withDefaults() Workload {
+	if w.Keys <= 0 {
+		w.Keys = DefaultKeys
+	}
+	if w.KeyPrefix == "" {
+		w.KeyPrefix = DefaultKeyPrefix
+	}
+	if w.Distribution == "" {
+		w.Distribution = DistributionUniform
+	}
+	if w.ZipfS == 0 {
+		w.ZipfS = DefaultZipfS
+	}
+	if w.ValueSize <= 0 {
+		w.ValueSize = DefaultValueSize
+	}
+	return w
+}
+
+// Validate 检查配置是否合法
+func (w Workload) Validate() error {
+	w = w.withDefaults()
+	switch w.Distribution {
+	case DistributionUniform, DistributionZipfian:
+	default:
+		return fmt.Errorf("未知的访问分布: %s", w.Distribution)
+	}
+	if w.Distribution == DistributionZipfian && w.ZipfS <= 1 {
+		return fmt.Errorf("Zipf 倾斜参数必须大于 1: %v", w.ZipfS)
+	}
+	if w.ReadRatio < 0 || w.ReadRatio > 1 {
+		return fmt.Errorf("读比例必须在 [0, 1] 之内: %v", w.ReadRatio)
+	}
+	return nil
+}
+
+// ==================== 操作生成 ====================
+
+// OpType 操作类型
+type OpType int
+
+const (
+	OpRead OpType = iota
+	OpWrite
+)
+
+// Op 一次操作
+// Value 引用生成器内部的缓冲区，只在下一次调用 Next 之前有效
+type Op struct {
+	Type  OpType
+	Key   []byte
+	Value []byte
+}
+
+// Generator 按负载配置生成操作序列，不是并发安全的，每个 goroutine 应使用自己的生成器
+type Generator struct {
+	workload Workload
+	rng      *rand.Rand
+	zipf     *rand.Zipf
+	perm     []int // Zipf 排名到 key 编号的映射，避免热点 key 在字典序上聚集
+	value    []byte
+}
+
+// NewGenerator 创建操作生成器
+// 参数：
+//   - w: 负载配置
+//
+// 返回：
+//   - *Generator: 生成器
+//   - error: 配置不合法
+func NewGenerator(w Workload) (*Generator, error) {
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	w = w.withDefaults()
+
+	g := &Generator{
+		workload: w,
+		rng:      rand.New(rand.NewSource(w.Seed)),
+	}
+	if w.Distribution == DistributionZipfian {
+		g.zipf = rand.NewZipf(g.rng, w.ZipfS, 1, uint64(w.Keys-1))
+		// 排名映射只取决于 key 空间，不同种子的生成器共享同一组热点 key
+		g.perm = rand.New(rand.NewSource(int64(w.Keys))).Perm(w.Keys)
+	}
+
+	size := w.ValueSize
+	if w.ValueSizeMax > size {
+		size = w.ValueSizeMax
+	}
+	g.value = make([]byte, size)
+	g.rng.Read(g.value)
+	return g, nil
+}
+
+// Key 返回编号为 i 的 key
+func (g *Generator) Key(i int) []byte {
+	return []byte(fmt.Sprintf("%s%08d", g.workload.KeyPrefix, i))
+}
+
+// Next 生成下一个操作
+func (g *Generator) Next() Op {
+	op := Op{Key: g.Key(g.nextKey())}
+	if g.rng.Float64() < g.workload.ReadRatio {
+		op.Type = OpRead
+		return op
+	}
+	op.Type = OpWrite
+	size := g.workload.ValueSize
+	if g.workload.ValueSizeMax > size {
+		size += g.rng.Intn(g.workload.ValueSizeMax - size + 1)
+	}
+	op.Value = g.value[:size]
+	return op
+}
+
+// nextKey 按访问分布选择 key 编号
+func (g *Generator) nextKey() int {
+	if g.zipf != nil {
+		return g.perm[g.zipf.Uint64()]
+	}
+	return g.rng.Intn(g.workload.Keys)
+}
+
+// ==================== 执行与统计 ====================
+
+// Latency 延迟分布
+type Latency struct {
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	P999 time.Duration
+	Max  time.Duration
+}
+
+// Result 一次运行的统计结果
+type Result struct {
+	Ops      int64         // 完成的操作数
+	Reads    int64         // 读操作数
+	Writes   int64         // 写操作数
+	Misses   int64         // 读到不存在的 key 的次数
+	Errors   int64         // 出错的操作数（不含 Misses）
+	Duration time.Duration // 总耗时
+
+	ReadLatency  Latency
+	WriteLatency Latency
+}
+
+// Throughput 返回每秒完成的操作数
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+// MetricReporter 接收自定义指标，*testing.B 实现了该接口
+type MetricReporter interface {
+	ReportMetric(n float64, unit string)
+}
+
+// Report 将吞吐量与延迟分位数报告为基准测试的自定义指标
+func (r *Result) Report(b MetricReporter) {
+	b.ReportMetric(r.Throughput(), "ops/s")
+	if r.Reads > 0 {
+		b.ReportMetric(micros(r.ReadLatency.P50), "read-p50-µs")
+		b.ReportMetric(micros(r.ReadLatency.P99), "read-p99-µs")
+	}
+	if r.Writes > 0 {
+		b.ReportMetric(micros(r.WriteLatency.P50), "write-p50-µs")
+		b.ReportMetric(micros(r.WriteLatency.P99), "write-p99-µs")
+	}
+}
+
+// micros 将时长转换为微秒（保留小数）
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// String 返回可读的统计摘要
+func (r *Result) String() string {
+	return fmt.Sprintf("ops=%d reads=%d writes=%d misses=%d errors=%d duration=%v throughput=%.0f ops/s read p50/p99=%v/%v write p50/p99=%v/%v",
+		r.Ops, r.Reads, r.Writes, r.Misses, r.Errors, r.Duration, r.Throughput(),
+		r.ReadLatency.P50, r.ReadLatency.P99, r.WriteLatency.P50, r.WriteLatency.P99)
+}
+
+// Preload 写入 key 空间中的全部 key，使读操作能读到数据
+// 参数：
+//   - engine: 存储引擎
+//   - w: 负载配置
+//
+// 返回：
+//   - error: 配置不合法或写入失败
+func Preload(engine storage.Engine, w Workload) error {
+	g, err := NewGenerator(w)
+	if err != nil {
+		return err
+	}
+	w = g.workload
+	for i := 0; i < w.Keys; i++ {
+		if err := engine.Put(g.Key(i), g.value[:w.ValueSize]); err != nil {
+			return fmt.Errorf("预写入第 %d 个 key 失败: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Run 用 workers 个 goroutine 对存储引擎执行共 ops 个操作，并统计吞吐与延迟
+// 每个 goroutine 使用种子 Seed+编号 的生成器，相同的配置生成相同的操作集合
+// 参数：
+//   - engine: 存储引擎
+//   - w: 负载配置
+//   - ops: 操作总数
+//   - workers: 并发数，<= 0 时为 1
+//
+// 返回：
+//   - *Result: 统计结果，出错时仍返回已完成部分的统计
+//   - error: 配置不合法，或第一个出错操作的错误
+func Run(engine storage.Engine, w Workload, ops int, workers int) (*Result, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	generators := make([]*Generator, workers)
+	for i := range generators {
+		wi := w
+		wi.Seed = w.Seed + int64(i)
+		g, err := NewGenerator(wi)
+		if err != nil {
+			return nil, err
+		}
+		generators[i] = g
+	}
+
+	type workerResult struct {
+		reads, writes []time.Duration
+		misses        int64
+		errors        int64
+		err           error
+	}
+	results := make([]workerResult, workers)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		// 操作总数平均分配，余数分给前几个 goroutine
+		n := ops / workers
+		if i < ops%workers {
+			n++
+		}
+		wg.Add(1)
+		go func(i, n int) {
+			defer wg.Done()
+			g, res := generators[i], &results[i]
+			for j := 0; j < n; j++ {
+				op := g.Next()
+				begin := time.Now()
+				var err error
+				if op.Type == OpRead {
+					_, err = engine.Get(op.Key)
+					res.reads = append(res.reads, time.Since(begin))
+				} else {
+					err = engine.Put(op.Key, op.Value)
+					res.writes = append(res.writes, time.Since(begin))
+				}
+				switch {
+				case err == nil:
+				case errors.Is(err, storage.ErrKeyNotFound):
+					res.misses++
+				default:
+					res.errors++
+					if res.err == nil {
+						res.err = err
+					}
+				}
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	result := &Result{Duration: time.Since(start)}
+	var reads, writes []time.Duration
+	var firstErr error
+	for _, res := range results {
+		reads = append(reads, res.reads...)
+		writes = append(writes, res.writes...)
+		result.Misses += res.misses
+		result.Errors += res.errors
+		if firstErr == nil {
+			firstErr = res.err
+		}
+	}
+	result.Reads = int64(len(reads))
+	result.Writes = int64(len(writes))
+	result.Ops = result.Reads + result.Writes
+	result.ReadLatency = percentiles(reads)
+	result.WriteLatency = percentiles(writes)
+	return result, firstErr
+}
+
+// percentiles 计算延迟分位数（最近秩法），会对 samples 排序
+func percentiles(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	at := func(q float64) time.Duration {
+		idx := int(math.Ceil(q*float64(len(samples)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return samples[idx]
+	}
+	return Latency{
+		P50:  at(0.50),
+		P90:  at(0.90),
+		P99:  at(0.99),
+		P999: at(0.999),
+		Max:  samples[len(samples)-1],
+	}
+}
@@ -0,0 +1,105 @@
+package bench
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage/bitcask"
+)
+
+func TestGenerator(t *testing.T) {
+	if _, err := NewGenerator(Workload{Distribution: DistributionZipfian, ZipfS: 0.5}); err == nil {
+		t.Fatalf("倾斜参数不大于 1 时应返回错误")
+	}
+	if _, err := NewGenerator(Workload{ReadRatio: 1.5}); err == nil {
+		t.Fatalf("读比例超出范围时应返回错误")
+	}
+
+	w := Workload{Keys: 1000, Distribution: DistributionZipfian, ReadRatio: 0.9, ValueSize: 10, ValueSizeMax: 20, Seed: 7}
+	a, err := NewGenerator(w)
+	if err != nil {
+		t.Fatalf("创建生成器失败: %v", err)
+	}
+	b, _ := NewGenerator(w)
+
+	const n = 20000
+	counts := make(map[string]int)
+	reads := 0
+	for i := 0; i < n; i++ {
+		opA, opB := a.Next(), b.Next()
+		// 相同种子生成相同的操作序列
+		if opA.Type != opB.Type || !bytes.Equal(opA.Key, opB.Key) || len(opA.Value) != len(opB.Value) {
+			t.Fatalf("第 %d 个操作不一致: %+v / %+v", i, opA, opB)
+		}
+		counts[string(opA.Key)]++
+		if opA.Type == OpRead {
+			reads++
+			continue
+		}
+		if size := len(opA.Value); size < 10 || size > 20 {
+			t.Fatalf("value 大小超出范围: %d", size)
+		}
+	}
+	if ratio := float64(reads) / n; ratio < 0.88 || ratio > 0.92 {
+		t.Fatalf("读比例偏离配置: %.3f", ratio)
+	}
+
+	// Zipf 分布下最热的 1% key 占据远多于 1% 的访问，均匀分布下则接近 1%
+	top := func(counts map[string]int) float64 {
+		freq := make([]int, 0, len(counts))
+		for _, c := range counts {
+			freq = append(freq, c)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(freq)))
+		sum := 0
+		for i := 0; i < 10 && i < len(freq); i++ {
+			sum += freq[i]
+		}
+		return float64(sum) / n
+	}
+	if share := top(counts); share < 0.3 {
+		t.Fatalf("Zipf 分布的热点 key 占比过低: %.3f", share)
+	}
+	uniform, _ := NewGenerator(Workload{Keys: 1000, Seed: 7})
+	counts = make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[string(uniform.Next().Key)]++
+	}
+	if share := top(counts); share > 0.05 {
+		t.Fatalf("均匀分布的热点 key 占比过高: %.3f", share)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	w := Workload{Keys: 500, Distribution: DistributionZipfian, ReadRatio: 0.8}
+	if err := Preload(db, w); err != nil {
+		t.Fatalf("预写入失败: %v", err)
+	}
+	result, err := Run(db, w, 2001, 4)
+	if err != nil {
+		t.Fatalf("运行负载失败: %v", err)
+	}
+	if result.Ops != 2001 || result.Reads+result.Writes != result.Ops {
+		t.Fatalf("操作数不匹配: %s", result)
+	}
+	if result.Misses != 0 || result.Errors != 0 {
+		t.Fatalf("预写入后不应有未命中或错误: %s", result)
+	}
+	if result.Throughput() <= 0 || result.ReadLatency.P50 > result.ReadLatency.P99 || result.ReadLatency.P99 > result.ReadLatency.Max {
+		t.Fatalf("统计结果不合理: %s", result)
+	}
+}
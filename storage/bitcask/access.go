@@ -0,0 +1,92 @@
+package bitcask
+
+import (
+	"sync"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage/index"
+)
+
+// ==================== 访问时间 ====================
+//
+// LastAccess 向外部系统（例如 L2 缓存）报告 key 的新近程度，用于淘汰决策。
+// key 的最近访问时间取以下时间中最晚的一个：
+//   - 写入时间：当前 Entry 头部的时间戳，总是可用，不需要额外开销
+//   - 混合索引热层与温层记录的访问时间（冷层不记录）
+//   - 启用 TrackAccess 时 Get 记录的读取时间
+
+// WithAccessTracking 设置是否记录每个 key 最近一次被读取的时间
+// 未启用时 LastAccess 只能报告写入时间与混合索引热层、温层的访问时间
+func WithAccessTracking(enabled bool) Option {
+	return func(o *Options) {
+		o.TrackAccess = enabled
+	}
+}
+
+// accessTracker 记录每个 key 最近一次被读取的时间（纳秒时间戳）
+// Get 只持有 DB 的读锁，因此使用独立的互斥锁
+type accessTracker struct {
+	mu    sync.Mutex
+	times map[string]int64
+}
+
+// newAccessTracker 创建访问时间记录
+func newAccessTracker() *accessTracker {
+	return &accessTracker{times: make(map[string]int64)}
+}
+
+// touch 将 key 的读取时间更新为当前时间
+func (t *accessTracker) touch(key []byte) {
+	now := time.Now().UnixNano()
+	t.mu.Lock()
+	t.times[string(key)] = now
+	t.mu.Unlock()
+}
+
+// get 返回 key 最近一次被读取的时间
+func (t *accessTracker) get(key []byte) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts, ok := t.times[string(key)]
+	return ts, ok
+}
+
+// remove 移除 key 的读取时间
+func (t *accessTracker) remove(key []byte) {
+	t.mu.Lock()
+	delete(t.times, string(key))
+	t.mu.Unlock()
+}
+
+// LastAccess 返回 key 最近一次被访问（读取或写入）的时间
+// 参数：
+//   - key: 键
+//
+// 返回：
+//   - time.Time: 最近访问时间，从未被读取的 key 为写入时间
+//   - bool: key 不存在或读取失败时为 false
+func (db *DB) LastAccess(key []byte) (time.Time, bool) {
+	meta, err := db.EntryMeta(key)
+	if err != nil {
+		// 已不存在的 key（例如 Merge 按保留时长丢弃）不再需要记录
+		if db.accessTimes != nil {
+			db.accessTimes.remove(key)
+		}
+		return time.Time{}, false
+	}
+	last := time.Unix(0, meta.Timestamp)
+
+	db.mu.RLock()
+	if hi, ok := db.index.(*index.HybridIndex); ok {
+		if t, ok := hi.LastAccess(key); ok && t.After(last) {
+			last = t
+		}
+	}
+	db.mu.RUnlock()
+	if db.accessTimes != nil {
+		if ts, ok := db.accessTimes.get(key); ok && ts > last.UnixNano() {
+			last = time.Unix(0, ts)
+		}
+	}
+	return last, true
+}
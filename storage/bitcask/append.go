@@ -0,0 +1,130 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 追加写入 ====================
+//
+// Append 由 DB 分配 key：key 是专用的追加写入计数器的下一个值（格式见 storage.AppendKey），
+// 其他写入不占用计数器，因此追加写入得到的 key 连续。
+//
+// 计数器随数据持久化：写入任何形如追加写入 key 的 Entry（包括用户直接 Put 的同格式 key）都会把计数器推进到该值，
+// 启动引导时从全部记录（包括墓碑）中恢复，因此不会分配已经存在或曾经存在的 key。
+// Merge 会丢弃墓碑与被删除的 Entry，所以在 Merge 之前与关闭时把计数器写入 append 文件，
+// 打开时取 append 文件与启动引导结果中较大的一个。
+//
+// append 文件格式（小端序）：magic "TKVA" | seq uint64 | crc uint32（之前全部字节的 CRC32）
+
+const (
+	// appendSeqFileName 记录追加写入计数器的文件名
+	appendSeqFileName = "append"
+	appendSeqMagic    = "TKVA"
+)
+
+// Append 以追加写入计数器的下一个值作为 key 写入 value，key 格式见 storage.AppendKey
+// 计数器在写锁内推进，并发追加得到的 key 互不相同、按写入顺序递增且连续，其他写入不会造成空洞
+// 参数：
+//   - value: 值
+//
+// 返回：
+//   - []byte: 分配的 key
+//   - error: 写入错误
+func (db *DB) Append(value []byte) ([]byte, error) {
+	return db.AppendAt(value, 0)
+}
+
+// AppendAt 与 Append 相同，并以指定的版本号写入，见 PutAt
+// 参数：
+//   - value: 值
+//   - version: 版本号，0 表示由 DB 分配
+//
+// 返回：
+//   - []byte: 分配的 key
+//   - error: 写入错误
+func (db *DB) AppendAt(value []byte, version uint64) ([]byte, error) {
+	if err := db.lockForWrite(); err != nil {
+		return nil, err
+	}
+	defer db.mu.Unlock()
+
+	key := storage.AppendKey(db.appendSeq + 1)
+	entry := NewEntry(key, value)
+	entry.Seq = version
+	if err := db.applyEntry(entry); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// AppendSeq 返回追加写入计数器的当前值，即最近一次分配的追加写入序号
+func (db *DB) AppendSeq() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.appendSeq
+}
+
+// SetAppendSeq 设置追加写入计数器，下一次追加写入分配 seq+1
+// 用于复制状态机从快照恢复或从头重放日志，可以小于当前值
+// 参数：
+//   - seq: 计数器的新值
+func (db *DB) SetAppendSeq(seq uint64) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.appendSeq = seq
+}
+
+// observeAppendKey 写入或启动引导读到形如追加写入 key 的记录时推进计数器
+// 调用方必须持有写锁，或处于打开过程中
+func (db *DB) observeAppendKey(key []byte) {
+	if seq, ok := storage.ParseAppendKey(key); ok && seq > db.appendSeq {
+		db.appendSeq = seq
+	}
+}
+
+// appendSeqPath 返回 append 文件的路径
+func (db *DB) appendSeqPath() string {
+	return filepath.Join(db.dir, appendSeqFileName)
+}
+
+// loadAppendSeq 读取 append 文件，计数器取其与启动引导结果中较大的一个
+// 文件不存在时忽略，损坏时返回 ErrUnrecognizedFile
+func (db *DB) loadAppendSeq() error {
+	data, err := readFile(db.options.FileSystem, db.appendSeqPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取 append 文件失败: %w", err)
+	}
+	if len(data) != 16 || !bytes.Equal(data[:4], []byte(appendSeqMagic)) ||
+		crc32.ChecksumIEEE(data[:12]) != binary.LittleEndian.Uint32(data[12:]) {
+		return fmt.Errorf("%w: append 文件已损坏", ErrUnrecognizedFile)
+	}
+	if seq := binary.LittleEndian.Uint64(data[4:12]); seq > db.appendSeq {
+		db.appendSeq = seq
+	}
+	return nil
+}
+
+// saveAppendSeq 将计数器写入 append 文件，计数器为 0 时不创建文件
+// 调用方必须持有写锁
+func (db *DB) saveAppendSeq() error {
+	if db.appendSeq == 0 {
+		return nil
+	}
+	buf := []byte(appendSeqMagic)
+	buf = binary.LittleEndian.AppendUint64(buf, db.appendSeq)
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	if err := writeFileSynced(db.options.FileSystem, db.appendSeqPath(), buf); err != nil {
+		return fmt.Errorf("写入 append 文件失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package bitcask
+
+import (
+	"fmt"
+
+	"github.com/forever-free1/TideKV/storage/index"
+)
+
+// ==================== 自动选择索引类型 ====================
+//
+// Map 索引在数据量小时最快，但有序遍历需要排序全部 key；ART 与混合索引在数据量大时更省内存，
+// 并且天然有序。IndexTypeAuto 先使用 Map 索引，key 数量达到 AutoIndexThreshold 时
+// 在写锁内把全部条目复制到 AutoIndexTarget 指定的索引并替换，之后不再迁移回 Map。
+// 迁移在触发它的写入中同步完成，期间其他读写等待，耗时与 key 数量成正比；
+// 打开时 key 数量已经达到阈值的数据库在启动引导之后直接迁移。
+
+// DefaultAutoIndexThreshold IndexTypeAuto 默认的迁移阈值（key 数量）
+const DefaultAutoIndexThreshold = 100000
+
+// WithAutoIndex 使用 IndexTypeAuto：先使用 Map 索引，key 数量达到 threshold 时迁移到 target
+// 参数：
+//   - threshold: 迁移阈值，0 表示 DefaultAutoIndexThreshold
+//   - target: 迁移的目标索引类型，IndexTypeART 或 IndexTypeHybrid；IndexTypeMap 表示默认的 IndexTypeART
+func WithAutoIndex(threshold int, target IndexType) Option {
+	return func(o *Options) {
+		o.IndexType = IndexTypeAuto
+		o.AutoIndexThreshold = threshold
+		o.AutoIndexTarget = target
+	}
+}
+
+// IndexType 返回当前使用的索引类型
+// 配置为 IndexTypeAuto 时，迁移之前返回 IndexTypeMap，迁移之后返回 AutoIndexTarget
+func (db *DB) IndexType() IndexType {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.indexType
+}
+
+// validateAutoIndex 校验 IndexTypeAuto 的配置，未设置 AutoIndexTarget 时填入 IndexTypeART
+func (o *Options) validateAutoIndex() error {
+	if o.IndexType != IndexTypeAuto {
+		return nil
+	}
+	if o.AutoIndexThreshold < 0 {
+		return fmt.Errorf("%w: AutoIndexThreshold 不能为负数，实际为 %d", ErrInvalidOptions, o.AutoIndexThreshold)
+	}
+	// 未设置（零值 IndexTypeMap）时迁移到 ART
+	if o.AutoIndexTarget == IndexTypeMap {
+		o.AutoIndexTarget = IndexTypeART
+	}
+	if o.AutoIndexTarget != IndexTypeART && o.AutoIndexTarget != IndexTypeHybrid {
+		return fmt.Errorf("%w: AutoIndexTarget 只能是 IndexTypeART 或 IndexTypeHybrid", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// maybeMigrateIndex key 数量达到阈值时把 Map 索引迁移到 AutoIndexTarget
+// 调用方必须持有写锁
+func (db *DB) maybeMigrateIndex() {
+	if db.options.IndexType != IndexTypeAuto || db.indexType != IndexTypeMap {
+		return
+	}
+	threshold := db.options.AutoIndexThreshold
+	if threshold == 0 {
+		threshold = DefaultAutoIndexThreshold
+	}
+	if db.index.Size() < threshold {
+		return
+	}
+
+	var target index.Index
+	if db.options.AutoIndexTarget == IndexTypeHybrid {
+		target = index.NewHybridIndex()
+	} else {
+		target = index.NewARTIndex()
+	}
+	iter := db.index.Seek(nil)
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		target.Put(key, iter.Value())
+		iter.Next()
+	}
+	iter.Close()
+
+	// 不关闭旧的 Map 索引：DB.Seek 返回的迭代器可能仍在遍历它，迁移之后它不再被修改，
+	// 迭代器关闭之后由 GC 回收
+	db.index = target
+	db.indexType = db.options.AutoIndexTarget
+}
@@ -0,0 +1,171 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage/index"
+)
+
+func TestDB_AutoIndex(t *testing.T) {
+	for _, target := range []IndexType{IndexTypeART, IndexTypeHybrid} {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		const threshold = 100
+		db, err := Open(dir, WithAutoIndex(threshold, target))
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		if got := db.IndexType(); got != IndexTypeMap {
+			t.Fatalf("迁移之前应使用 Map 索引: %d", got)
+		}
+
+		// 逆序写入，迁移前后有序遍历的结果都应按 key 升序
+		for i := threshold - 1; i >= 1; i-- {
+			db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		}
+		db.Put([]byte("key-0001"), []byte("value-1"))
+		db.Delete([]byte("key-0002"))
+		db.Put([]byte("key-0002"), []byte("value-2"))
+		if got := db.IndexType(); got != IndexTypeMap {
+			t.Fatalf("未达到阈值时不应迁移: %d", got)
+		}
+
+		db.Put([]byte("key-0000"), []byte("value-0"))
+		if got := db.IndexType(); got != target {
+			t.Fatalf("达到阈值后应迁移到 %d: %d", target, got)
+		}
+		if _, isMap := db.index.(*index.MapIndex); isMap {
+			t.Fatalf("迁移之后不应再使用 Map 索引")
+		}
+
+		for i := threshold; i < threshold+50; i++ {
+			db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		}
+		var prev string
+		count := 0
+		err = db.ScanPrefix([]byte("key-"), func(key, value []byte) bool {
+			if string(key) <= prev {
+				t.Fatalf("遍历应按 key 升序: %s 在 %s 之后", key, prev)
+			}
+			if want := fmt.Sprintf("value-%d", count); string(value) != want {
+				t.Fatalf("%s 的值不匹配: %q, want %q", key, value, want)
+			}
+			prev = string(key)
+			count++
+			return true
+		})
+		if err != nil || count != threshold+50 {
+			t.Fatalf("迁移之后应能遍历全部 key: %d, %v", count, err)
+		}
+		for i := 0; i < threshold+50; i++ {
+			key := fmt.Sprintf("key-%04d", i)
+			if got, err := db.Get([]byte(key)); err != nil || string(got) != fmt.Sprintf("value-%d", i) {
+				t.Fatalf("迁移之后 %s 不匹配: %q, %v", key, got, err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("关闭数据库失败: %v", err)
+		}
+
+		// 重新打开时 key 数量已经达到阈值，启动引导之后直接迁移
+		db, err = Open(dir, WithAutoIndex(threshold, target))
+		if err != nil {
+			t.Fatalf("重新打开数据库失败: %v", err)
+		}
+		if got := db.IndexType(); got != target {
+			t.Fatalf("重新打开后应直接迁移到 %d: %d", target, got)
+		}
+		if got, err := db.Get([]byte("key-0120")); err != nil || string(got) != "value-120" {
+			t.Fatalf("重新打开后读取不匹配: %q, %v", got, err)
+		}
+		db.Close()
+	}
+
+	// 未指定目标时迁移到 ART；目标只能是 ART 或混合索引，阈值不能为负数
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := Open(dir, WithIndexType(IndexTypeAuto))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if db.options.AutoIndexTarget != IndexTypeART || db.IndexType() != IndexTypeMap {
+		t.Fatalf("默认配置不匹配: target=%d, current=%d", db.options.AutoIndexTarget, db.IndexType())
+	}
+	db.Close()
+	if _, err := Open(dir, WithAutoIndex(10, IndexTypeAuto)); !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("不支持的目标类型应返回 ErrInvalidOptions: %v", err)
+	}
+	if _, err := Open(dir, WithAutoIndex(-1, IndexTypeART)); !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("负数阈值应返回 ErrInvalidOptions: %v", err)
+	}
+}
+
+func TestDB_AutoIndexConcurrentReaders(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 迁移过程中读者仍在使用 Seek 迭代器与 LastAccess，不能产生数据竞争（go test -race）
+	const threshold = 200
+	db, err := Open(dir, WithAutoIndex(threshold, IndexTypeART))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < threshold/2; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("v"))
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				iter, err := db.Seek([]byte("key-"))
+				if err != nil {
+					t.Errorf("Seek 失败: %v", err)
+					return
+				}
+				for i := 0; i < 50; i++ {
+					iter.Next()
+					if iter.Key() != nil && iter.Value() == nil {
+						t.Errorf("迭代器读取 %s 失败", iter.Key())
+						iter.Close()
+						return
+					}
+				}
+				iter.Close()
+				db.LastAccess([]byte("key-0001"))
+			}
+		}()
+	}
+
+	for i := threshold / 2; i < threshold*2; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("v"))
+	}
+	close(stop)
+	wg.Wait()
+	if got := db.IndexType(); got != IndexTypeART {
+		t.Fatalf("达到阈值后应迁移到 ART: %d", got)
+	}
+}
@@ -0,0 +1,186 @@
+package bitcask
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 启动引导 ====================
+
+// bootRecord 启动时从数据文件（或 Key-Log）读取的一条记录
+type bootRecord struct {
+	Key  []byte
+	Type EntryType
+	Seq  uint64
+	Pos  *storage.Position
+}
+
+// fileRecords 按写入顺序列出数据文件中的全部记录
+// 启用 Key-Log 时只读取 Key-Log，否则顺序读取每个 Entry 的头部与 Key 并分块校验 CRC，跳过损坏的部分；
+// value 不会整体读入内存，因此启动时的内存占用与 value 大小无关
+func (db *DB) fileRecords(dataFile *DataFile) ([]bootRecord, error) {
+	fileID := dataFile.GetFileID()
+	var records []bootRecord
+
+	// 优先从 Key-Log 重建索引，无需读取 value
+	if db.options.KeyLog {
+		keyLogRecords, err := db.loadKeyLog(dataFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载 Key-Log %d 失败: %w", fileID, err)
+		}
+		records = make([]bootRecord, 0, len(keyLogRecords))
+		for _, rec := range keyLogRecords {
+			records = append(records, bootRecord{
+				Key:  rec.Key,
+				Type: rec.Type,
+				Seq:  rec.Seq,
+				Pos:  &storage.Position{FileID: fileID, Offset: rec.Offset, Size: rec.Size},
+			})
+		}
+		return records, nil
+	}
+
+	// 遍历文件中的所有 Entry
+	var offset int64 = 0
+	writeOff := dataFile.GetWriteOff()
+	for offset < writeOff {
+		entry, err := dataFile.readEntryKey(offset, true)
+		if err != nil {
+			// 如果读取出错（可能是损坏的 Entry），跳过继续
+			// 这里简单处理：每次跳过 20 字节尝试读取下一个
+			offset += 20
+			continue
+		}
+
+		records = append(records, bootRecord{
+			Key:  entry.Key,
+			Type: entry.Type,
+			Seq:  entry.Seq,
+			Pos:  &storage.Position{FileID: fileID, Offset: offset, Size: entry.Size()},
+		})
+
+		// 移动到下一个 Entry
+		offset += int64(entry.Size())
+	}
+	return records, nil
+}
+
+// indexOlderFiles 构建旧文件的索引：可以并行扫描，也可以按文件 ID 顺序扫描
+// 启用检查点时先从检查点恢复已完成扫描的文件，只扫描之后的文件，并在扫描过程中定期写入检查点
+func (db *DB) indexOlderFiles(files []*DataFile) error {
+	// 冲突解决需要按写入顺序比较版本，不使用检查点与并行扫描
+	interval, workers := db.options.BootstrapCheckpointInterval, db.options.BootstrapWorkers
+	if db.options.ConflictResolver != nil {
+		interval, workers = 0, 1
+	}
+	done := 0
+	if interval > 0 {
+		done = db.resumeBootstrap(files)
+	}
+
+	if workers > 1 && len(files)-done > 1 {
+		if err := db.indexFilesParallel(files[done:], workers); err != nil {
+			return err
+		}
+		if interval > 0 {
+			db.saveBootstrapCheckpoint(files)
+		}
+		return nil
+	}
+
+	for i := done; i < len(files); i++ {
+		records, err := db.fileRecords(files[i])
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := db.indexBootRecord(rec); err != nil {
+				return err
+			}
+		}
+		// 每扫描 interval 个文件以及扫描完最后一个文件之后写入检查点
+		if interval > 0 && ((i+1-done)%interval == 0 || i == len(files)-1) {
+			db.saveBootstrapCheckpoint(files[:i+1])
+		}
+		if bootstrapFileIndexed != nil {
+			if err := bootstrapFileIndexed(files[i].GetFileID()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bootstrapFileIndexed 测试钩子：按顺序扫描时每个旧文件建立索引之后调用，返回错误时中止启动引导
+var bootstrapFileIndexed func(fileID uint32) error
+
+// indexFilesParallel 使用多个 worker 并行扫描数据文件并构建索引
+// 每个 worker 为分到的文件构建局部结果，随后按 Seq 合并（最后写入者胜出，墓碑同样参与比较），
+// 最终只把仍然存活的 key 写入索引与布隆过滤器。
+// 调用方必须保证随后再按顺序索引比这些文件更新的数据（活跃文件）。
+func (db *DB) indexFilesParallel(files []*DataFile, workers int) error {
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	partials := make([][]bootRecord, len(files))
+	errs := make([]error, len(files))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				partials[i], errs[i] = db.fileRecords(files[i])
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// 合并局部结果：同一个 key 保留 Seq 最大的记录
+	// 冲突解决的写回结果保留胜出版本的 Seq，可能小于它之前的版本，按文件顺序总是取代之前的记录
+	latest := make(map[string]bootRecord)
+	for _, records := range partials {
+		for _, rec := range records {
+			if cur, ok := latest[string(rec.Key)]; ok && cur.Seq >= rec.Seq && rec.Type != EntryTypeResolved {
+				continue
+			}
+			latest[string(rec.Key)] = rec
+		}
+	}
+
+	for _, rec := range latest {
+		if rec.Seq > db.seq {
+			db.seq = rec.Seq
+		}
+		db.observeAppendKey(rec.Key)
+		// 从检查点恢复时索引中已有更早的文件中的 key，墓碑需要删除它们
+		if rec.Type == EntryTypeTombstone {
+			if db.bootTombstones == nil {
+				db.bootTombstones = make(map[string]uint64)
+			}
+			db.bootTombstones[string(rec.Key)] = rec.Seq
+			db.index.Delete(rec.Key)
+			db.suffixDelete(rec.Key)
+			continue
+		}
+		db.index.Put(rec.Key, rec.Pos)
+		db.suffixAdd(rec.Key)
+		db.bloomFilter.Add(rec.Key)
+	}
+	return nil
+}
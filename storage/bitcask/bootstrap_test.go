@@ -0,0 +1,632 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// writeManyFiles 写入覆盖、删除交错的数据，生成大量数据文件
+// 返回所有出现过的 key
+func writeManyFiles(tb testing.TB, dir string, keys, rounds int, opts ...Option) []string {
+	db, err := Open(dir, append([]Option{WithDataFileSizeLimit(4 * 1024)}, opts...)...)
+	if err != nil {
+		tb.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	var all []string
+	for i := 0; i < keys; i++ {
+		all = append(all, fmt.Sprintf("key-%04d", i))
+	}
+	for round := 0; round < rounds; round++ {
+		for i, key := range all {
+			switch {
+			case (i+round)%7 == 0:
+				if err := db.Delete([]byte(key)); err != nil {
+					tb.Fatalf("Delete 失败: %v", err)
+				}
+			default:
+				if err := db.Put([]byte(key), []byte(fmt.Sprintf("%s-%d", key, round))); err != nil {
+					tb.Fatalf("Put 失败: %v", err)
+				}
+			}
+		}
+	}
+	return all
+}
+
+func TestDB_ParallelBootstrap(t *testing.T) {
+	for _, keyLog := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keyLog=%v", keyLog), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			keys := writeManyFiles(t, dir, 200, 10, WithKeyLog(keyLog))
+			if n := countDataFiles(t, dir); n < 10 {
+				t.Fatalf("数据文件太少，无法覆盖并行场景: %d", n)
+			}
+
+			open := func(workers int) *DB {
+				db, err := Open(dir, WithKeyLog(keyLog), WithBootstrapWorkers(workers))
+				if err != nil {
+					t.Fatalf("打开数据库失败 (workers=%d): %v", workers, err)
+				}
+				return db
+			}
+
+			sequential := open(1)
+			want := make(map[string]string)
+			for _, key := range keys {
+				val, err := sequential.Get([]byte(key))
+				if err == storage.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Get 失败: %v", err)
+				}
+				want[key] = string(val)
+			}
+			wantSeq, wantSize := sequential.seq, sequential.index.Size()
+			sequential.Close()
+
+			parallel := open(4)
+			defer parallel.Close()
+			for _, key := range keys {
+				val, err := parallel.Get([]byte(key))
+				if err == storage.ErrKeyNotFound {
+					if _, ok := want[key]; ok {
+						t.Errorf("%s 在并行启动后丢失", key)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Get 失败: %v", err)
+				}
+				if want[key] != string(val) {
+					t.Errorf("%s 值不匹配: got %s, want %s", key, val, want[key])
+				}
+			}
+			if parallel.seq != wantSeq || parallel.index.Size() != wantSize {
+				t.Errorf("并行启动结果不一致: seq %d/%d, size %d/%d",
+					parallel.seq, wantSeq, parallel.index.Size(), wantSize)
+			}
+		})
+	}
+}
+
+func TestDB_BootstrapCheckpoint(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := writeManyFiles(t, dir, 200, 10)
+	defer func() { bootstrapFileIndexed = nil }()
+
+	// 不使用检查点打开，记录期望的数据与旧文件的扫描顺序
+	var older []uint32
+	bootstrapFileIndexed = func(fileID uint32) error {
+		older = append(older, fileID)
+		return nil
+	}
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	want := make(map[string]string)
+	for _, key := range keys {
+		val, err := db.Get([]byte(key))
+		if err == storage.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Get 失败: %v", err)
+		}
+		want[key] = string(val)
+	}
+	wantSeq := db.seq
+	db.Close()
+	if len(older) < 8 {
+		t.Fatalf("旧文件太少，无法覆盖恢复场景: %d", len(older))
+	}
+
+	check := func(stage string, db *DB) {
+		t.Helper()
+		for _, key := range keys {
+			val, err := db.Get([]byte(key))
+			if err == storage.ErrKeyNotFound {
+				if _, ok := want[key]; ok {
+					t.Fatalf("%s: %s 丢失", stage, key)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: Get 失败: %v", stage, err)
+			}
+			if want[key] != string(val) {
+				t.Fatalf("%s: %s 值不匹配: got %s, want %s", stage, key, val, want[key])
+			}
+		}
+		if db.seq != wantSeq || db.index.Size() != len(want) {
+			t.Fatalf("%s: 结果不一致: seq %d/%d, size %d/%d", stage, db.seq, wantSeq, db.index.Size(), len(want))
+		}
+	}
+	var scanned []uint32
+	record := func(fileID uint32) error {
+		scanned = append(scanned, fileID)
+		return nil
+	}
+
+	// 扫描完第 5 个旧文件后中止，检查点只记录到前 4 个文件
+	bootstrapFileIndexed = func(fileID uint32) error {
+		if fileID == older[4] {
+			return fmt.Errorf("模拟崩溃")
+		}
+		return nil
+	}
+	if _, err := Open(dir, WithBootstrapCheckpoint(2)); err == nil {
+		t.Fatalf("启动引导中止时打开应失败")
+	}
+
+	bootstrapFileIndexed = record
+	db, err = Open(dir, WithBootstrapCheckpoint(2))
+	if err != nil {
+		t.Fatalf("从检查点恢复打开失败: %v", err)
+	}
+	if len(scanned) != len(older)-4 || scanned[0] != older[4] {
+		t.Fatalf("应只扫描检查点之后的旧文件: %v", scanned)
+	}
+	check("从检查点恢复", db)
+	db.Close()
+
+	// 检查点已覆盖全部旧文件
+	scanned = nil
+	db, err = Open(dir, WithBootstrapCheckpoint(2))
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	if len(scanned) != 0 {
+		t.Fatalf("检查点覆盖全部旧文件时不应扫描: %v", scanned)
+	}
+	check("完整检查点", db)
+	db.Close()
+
+	// 检查点损坏时退回完整扫描
+	path := filepath.Join(dir, bootstrapCheckpointName)
+	data, err := readFile(OSFileSystem, path)
+	if err != nil {
+		t.Fatalf("读取检查点失败: %v", err)
+	}
+	data[len(data)/2] ^= 0xFF
+	file, err := OSFileSystem.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatalf("打开检查点失败: %v", err)
+	}
+	file.Write(data)
+	file.Close()
+
+	scanned = nil
+	db, err = Open(dir, WithBootstrapCheckpoint(2))
+	if err != nil {
+		t.Fatalf("检查点损坏时打开失败: %v", err)
+	}
+	if len(scanned) != len(older) {
+		t.Fatalf("检查点损坏时应完整扫描: %v", scanned)
+	}
+	check("检查点损坏", db)
+	db.Close()
+
+	// 并行扫描同样从检查点恢复
+	bootstrapFileIndexed = func(fileID uint32) error {
+		if fileID == older[2] {
+			return fmt.Errorf("模拟崩溃")
+		}
+		return nil
+	}
+	OSFileSystem.Remove(path)
+	if _, err := Open(dir, WithBootstrapCheckpoint(1)); err == nil {
+		t.Fatalf("启动引导中止时打开应失败")
+	}
+	bootstrapFileIndexed = nil
+	db, err = Open(dir, WithBootstrapCheckpoint(1), WithBootstrapWorkers(4))
+	if err != nil {
+		t.Fatalf("并行恢复打开失败: %v", err)
+	}
+	check("并行恢复", db)
+
+	// Merge 删除旧文件时同时删除检查点
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	if _, err := OSFileSystem.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Merge 之后检查点应被删除: %v", err)
+	}
+	db.Close()
+}
+
+func BenchmarkDB_Bootstrap(b *testing.B) {
+	dir, err := os.MkdirTemp("", "bitcask_bench")
+	if err != nil {
+		b.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeManyFiles(b, dir, 2000, 20)
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				db, err := Open(dir, WithBootstrapWorkers(workers))
+				if err != nil {
+					b.Fatalf("打开数据库失败: %v", err)
+				}
+				db.Close()
+			}
+		})
+	}
+}
+
+// largeValue 生成内容随 key 变化的大 value，便于发现读错位置
+func largeValue(i, size int) []byte {
+	return bytes.Repeat([]byte{byte('a' + i%26)}, size)
+}
+
+func TestDB_ConflictResolver(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 每个版本写入不同的数据文件
+	db, err := Open(dir, WithDataFileSizeLimit(128))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	writes := []struct{ key, value string }{
+		{"tags", "a"}, {"keep", "1"}, {"gone", "x"},
+		{"tags", "b"}, {"keep", "2"},
+	}
+	// 每个 key 各版本的写入序号
+	seqs := make(map[string]uint64)
+	for i, w := range writes {
+		if err := db.Put([]byte(w.key), []byte(w.value)); err != nil {
+			t.Fatalf("第 %d 次写入失败: %v", i, err)
+		}
+		meta, err := db.EntryMeta([]byte(w.key))
+		if err != nil {
+			t.Fatalf("查询元数据失败: %v", err)
+		}
+		seqs[w.key+"="+w.value] = meta.Seq
+	}
+	if err := db.Delete([]byte("gone")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.Put([]byte("gone"), []byte("y")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	db.Close()
+
+	// tags 的各版本按写入顺序拼接（不是幂等的），keep 保留最早的版本
+	calls := 0
+	resolver := func(existing, candidate *Entry) *Entry {
+		calls++
+		if string(candidate.Key) == "keep" {
+			return existing
+		}
+		return &Entry{Key: candidate.Key, Value: append(append([]byte(nil), existing.Value...), candidate.Value...)}
+	}
+
+	check := func(stage string, db *DB, want map[string]string) {
+		t.Helper()
+		for key, value := range want {
+			val, err := db.Get([]byte(key))
+			if err != nil {
+				t.Fatalf("%s: 读取 %s 失败: %v", stage, key, err)
+			}
+			if string(val) != value {
+				t.Fatalf("%s: %s 的值不匹配: 期望 %q，实际 %q", stage, key, value, val)
+			}
+		}
+	}
+	want := map[string]string{"tags": "ab", "keep": "1", "gone": "y"}
+
+	db, err = Open(dir, WithConflictResolver(resolver), WithBootstrapWorkers(4))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	// 墓碑之后的 gone 不与删除之前的版本比较
+	if calls != 2 {
+		t.Fatalf("解析函数的调用次数不匹配: %d", calls)
+	}
+	check("解决冲突后", db, want)
+	if meta, err := db.EntryMeta([]byte("tags")); err != nil || meta.Type != EntryTypeResolved.String() {
+		t.Fatalf("合并结果应以 EntryTypeResolved 写回: %+v, %v", meta, err)
+	}
+	// 写回保留胜出版本的写入序号：合并结果取最新版本的序号，保留的版本取它自己的序号
+	checkSeqs := func(stage string, db *DB) {
+		t.Helper()
+		for key, want := range map[string]uint64{"tags": seqs["tags=b"], "keep": seqs["keep=1"]} {
+			meta, err := db.EntryMeta([]byte(key))
+			if err != nil {
+				t.Fatalf("%s: 查询 %s 的元数据失败: %v", stage, key, err)
+			}
+			if meta.Seq != want {
+				t.Fatalf("%s: %s 的写入序号不匹配: 期望 %d，实际 %d", stage, key, want, meta.Seq)
+			}
+		}
+	}
+	checkSeqs("解决冲突后", db)
+	db.Close()
+
+	// 结果只写回一次：重复打开不会再次合并，也不会继续追加
+	for i := 0; i < 3; i++ {
+		db, err = Open(dir, WithConflictResolver(resolver))
+		if err != nil {
+			t.Fatalf("第 %d 次重新打开数据库失败: %v", i, err)
+		}
+		check(fmt.Sprintf("第 %d 次重新打开", i), db, want)
+		db.Close()
+	}
+
+	// 合并结果与保留的版本都已写回，不配置解析函数也能读到
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	check("不使用解析函数重新打开", db, want)
+	checkSeqs("不使用解析函数重新打开", db)
+	db.Close()
+
+	// 写回的结果序号可能小于之前的版本，按序号合并的并行扫描仍以写回的结果为准
+	// 写回的结果位于活跃文件中，先轮转让它进入并行扫描的旧文件
+	db, err = Open(dir, WithDataFileSizeLimit(128))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		db.Put([]byte("pad"), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	db.Close()
+	db, err = Open(dir, WithBootstrapWorkers(4))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	check("并行扫描重新打开", db, want)
+	checkSeqs("并行扫描重新打开", db)
+
+	// 写回之后的新版本仍与写回的结果比较
+	db.Put([]byte("tags"), []byte("c"))
+	db.Close()
+	db, err = Open(dir, WithConflictResolver(resolver))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	check("写入新版本后", db, map[string]string{"tags": "abc", "keep": "1", "gone": "y"})
+}
+
+func TestDB_BootstrapLargeValues(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const size = 3 * 1024 * 1024
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	want := make(map[string][]byte)
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("large-%d", i)
+		want[key] = largeValue(i, size)
+		db.Put([]byte(key), want[key])
+		small := fmt.Sprintf("small-%d", i)
+		want[small] = []byte(small)
+		db.Put([]byte(small), want[small])
+	}
+	// 覆盖与删除：启动后应以最后一次写入为准
+	want["large-1"] = largeValue(7, size)
+	db.Put([]byte("large-1"), want["large-1"])
+	db.Delete([]byte("large-2"))
+	delete(want, "large-2")
+
+	// 最后写入的大 value 在后面被破坏，启动时 CRC 校验失败，应回退到旧值
+	db.Put([]byte("small-0"), largeValue(0, size))
+	tail := db.activeFile.GetWriteOff() - size/2
+	path := db.GetFilePath(db.activeFile.FileID)
+	db.Close()
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("打开数据文件失败: %v", err)
+	}
+	if _, err := file.WriteAt([]byte{0xff}, tail); err != nil {
+		t.Fatalf("写入数据文件失败: %v", err)
+	}
+	file.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	if db.index.Size() != len(want) {
+		t.Errorf("key 数量不匹配: got %d, want %d", db.index.Size(), len(want))
+	}
+	for key, value := range want {
+		got, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", key, err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Errorf("%s 的值不匹配: got %d 字节, want %d 字节", key, len(got), len(value))
+		}
+	}
+	if _, err := db.Get([]byte("large-2")); err != storage.ErrKeyNotFound {
+		t.Errorf("已删除的 key 应返回 ErrKeyNotFound, 得到: %v", err)
+	}
+}
+
+// BenchmarkDB_BootstrapLargeValues 对比启动时只读取头部与 Key（分块校验 CRC）和读取完整 Entry 的内存分配
+func BenchmarkDB_BootstrapLargeValues(b *testing.B) {
+	dir, err := os.MkdirTemp("", "bitcask_bench")
+	if err != nil {
+		b.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		b.Fatalf("打开数据库失败: %v", err)
+	}
+	for i := 0; i < 16; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%d", i)), largeValue(i, 4*1024*1024))
+	}
+	db.Close()
+
+	b.Run("Open", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			db, err := Open(dir)
+			if err != nil {
+				b.Fatalf("打开数据库失败: %v", err)
+			}
+			db.Close()
+		}
+	})
+
+	// 原来的做法：逐个读取完整的 Entry
+	b.Run("ReadEntry", func(b *testing.B) {
+		db, err := Open(dir)
+		if err != nil {
+			b.Fatalf("打开数据库失败: %v", err)
+		}
+		defer db.Close()
+		dataFile := db.activeFile
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for offset := int64(0); offset < dataFile.GetWriteOff(); {
+				entry, err := dataFile.ReadEntry(offset)
+				if err != nil {
+					b.Fatalf("读取 Entry 失败: %v", err)
+				}
+				offset += int64(entry.Size())
+			}
+		}
+	})
+}
+
+func TestDB_BootstrapTombstones(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 写入之后跨文件删除：墓碑与被删除的记录位于不同的数据文件
+	db, err := Open(dir, WithDataFileSizeLimit(128))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+	}
+	deadFile := db.activeFile.GetFileID()
+	for i := 0; i < 10; i += 2 {
+		if err := db.Delete([]byte(fmt.Sprintf("key-%d", i))); err != nil {
+			t.Fatalf("Delete 失败: %v", err)
+		}
+	}
+	if db.activeFile.GetFileID() == deadFile || len(db.olderFiles) < 2 {
+		t.Fatalf("墓碑应写入之后的数据文件")
+	}
+	db.Close()
+
+	check := func(stage string, opts ...Option) {
+		t.Helper()
+		db, err := Open(dir, append([]Option{WithDataFileSizeLimit(128)}, opts...)...)
+		if err != nil {
+			t.Fatalf("%s: 打开数据库失败: %v", stage, err)
+		}
+		defer db.Close()
+		if size := db.index.Size(); size != 5 {
+			t.Fatalf("%s: 索引大小应只计入存活的 key: %d", stage, size)
+		}
+		for i := 0; i < 10; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			if i%2 == 0 {
+				if db.bloomFilter.Test(key) {
+					t.Fatalf("%s: 已删除的 %s 不应在布隆过滤器中", stage, key)
+				}
+				continue
+			}
+			if val, err := db.Get(key); err != nil || string(val) != "value" {
+				t.Fatalf("%s: 读取 %s 失败: %q, %v", stage, key, val, err)
+			}
+		}
+	}
+	// 关闭时保存的布隆过滤器包含已删除的 key，重新打开后应被重建
+	check("顺序扫描")
+	check("并行扫描", WithBootstrapWorkers(4))
+
+	// 文件顺序与序号不一致时按序号决定先后
+	outOfOrder, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(outOfOrder)
+	db, err = Open(outOfOrder)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	write := func(entry *Entry, seq uint64) {
+		t.Helper()
+		entry.Seq = seq
+		if _, err := db.activeFile.Write(entry); err != nil {
+			t.Fatalf("写入数据文件失败: %v", err)
+		}
+	}
+	// 旧文件中是更新的墓碑与更新的写入，之后的文件中是更早的写入与更早的墓碑
+	write(NewTombstoneEntry([]byte("a")), 10)
+	write(NewEntry([]byte("b"), []byte("new")), 11)
+	if err := db.rotateActiveFile(); err != nil {
+		t.Fatalf("轮转活跃文件失败: %v", err)
+	}
+	write(NewEntry([]byte("a"), []byte("old")), 5)
+	write(NewTombstoneEntry([]byte("b")), 6)
+	db.Close()
+
+	db, err = Open(outOfOrder)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Get([]byte("a")); err != storage.ErrKeyNotFound {
+		t.Fatalf("a 已被更新的墓碑删除: %v", err)
+	}
+	if val, err := db.Get([]byte("b")); err != nil || string(val) != "new" {
+		t.Fatalf("b 的更早的墓碑不应删除更新的写入: %q, %v", val, err)
+	}
+	if size := db.index.Size(); size != 1 {
+		t.Fatalf("索引大小不匹配: %d", size)
+	}
+	if db.seq != 11 {
+		t.Fatalf("写入序号应为见到的最大序号: %d", db.seq)
+	}
+}
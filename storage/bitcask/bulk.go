@@ -0,0 +1,142 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 批量导入 ====================
+//
+// PutAll 用于导入大批量（通常已排序）的数据：整个导入只加一次写锁，
+// 多个 Entry 编码后合并为一次文件写入（每批不超过活跃文件的剩余空间与 putAllChunkBytes），
+// 轮转检查也只在每批写入之前进行，同一批的 Entry 在磁盘上连续存放。
+// 超过单文件大小限制的 Entry 仍按 Put 的方式单独写入。
+//
+// PutAll 不是原子的：中途出错时，此前已写入的键值对保持有效。
+
+// putAllChunkBytes PutAll 单次文件写入的最大字节数
+const putAllChunkBytes = 4 * 1024 * 1024
+
+// PutAll 批量写入键值对
+// 同一个 key 出现多次时后者覆盖前者
+// 参数：
+//   - pairs: 键值对，Version 不为 0 时作为写入序号
+//
+// 返回：
+//   - error: 写入错误；key 或 value 超出限制时不写入任何数据
+func (db *DB) PutAll(pairs []KV) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	// 先校验全部键值对，避免写入一部分后才发现超限
+	entries := make([]*Entry, len(pairs))
+	for i, kv := range pairs {
+		entry := NewEntry(kv.Key, kv.Value)
+		entry.Seq = kv.Version
+		if err := db.checkNewEntry(entry); err != nil {
+			return err
+		}
+		entries[i] = entry
+	}
+
+	if err := db.lockForWrite(); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+
+	for start := 0; start < len(entries); {
+		// 超大 Entry 需要独占文件，走单条写入的轮转逻辑
+		if int64(entries[start].Size()) > db.options.DataFileSizeLimit {
+			if err := db.applyEntry(entries[start]); err != nil {
+				return err
+			}
+			start++
+			continue
+		}
+
+		if db.shouldRotate(entries[start]) {
+			if err := db.rotateActiveFile(); err != nil {
+				return fmt.Errorf("轮转活跃文件失败: %w", err)
+			}
+		}
+
+		// 本批写满活跃文件的剩余空间为止，每批至少包含一个 Entry
+		room := db.options.DataFileSizeLimit - db.activeFile.GetWriteOff()
+		if room > putAllChunkBytes {
+			room = putAllChunkBytes
+		}
+		end, size := start, int64(0)
+		for end < len(entries) {
+			entrySize := int64(entries[end].Size())
+			if entrySize > db.options.DataFileSizeLimit || (end > start && size+entrySize > room) {
+				break
+			}
+			size += entrySize
+			end++
+		}
+
+		if err := db.writeChunk(entries[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// writeChunk 将一组 Entry 合并为一次写入追加到活跃文件，并更新索引与布隆过滤器
+// 调用方必须持有写锁
+func (db *DB) writeChunk(entries []*Entry) error {
+	for _, entry := range entries {
+		if err := db.checkFreeSpace(entry); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		db.assignSeq(entry)
+		db.observeAppendKey(entry.Key)
+		buf.Write(entry.Encode())
+	}
+
+	offset, err := db.activeFile.WriteBytes(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("写入数据文件失败: %w", err)
+	}
+	fileID := db.activeFile.GetFileID()
+
+	for _, entry := range entries {
+		db.activeEntries++
+
+		// 与 appendEntry 相同，数据写入成功后再追加 Key-Log
+		if db.activeKeyLog != nil {
+			if err := db.activeKeyLog.Append(newKeyLogRecord(entry, offset)); err != nil {
+				return err
+			}
+		}
+		if db.mirror != nil {
+			db.mirror.enqueue(entry)
+		}
+		db.unquarantine(entry.Key)
+
+		db.index.Put(entry.Key, &storage.Position{
+			FileID: fileID,
+			Offset: offset,
+			Size:   entry.Size(),
+		})
+		if db.negCache != nil {
+			db.negCache.remove(entry.Key)
+		}
+		db.suffixAdd(entry.Key)
+		db.secondaryPut(entry.Key, entry.Value)
+		db.bloomFilter.Add(entry.Key)
+		db.keyEstimator.Add(entry.Key)
+
+		offset += int64(entry.Size())
+	}
+	db.maybeMigrateIndex()
+	return nil
+}
@@ -0,0 +1,162 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+func sortedPairs(n int) []KV {
+	pairs := make([]KV, n)
+	for i := range pairs {
+		pairs[i] = KV{
+			Key:   []byte(fmt.Sprintf("import/%06d", i)),
+			Value: []byte(fmt.Sprintf("value-%d", i)),
+		}
+	}
+	return pairs
+}
+
+func TestDB_PutAll(t *testing.T) {
+	for _, keyLog := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keyLog=%v", keyLog), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// 较小的文件限制，使导入跨越多个数据文件，并混入独占文件的超大 Entry
+			opts := []Option{WithDataFileSizeLimit(4096), WithKeyLog(keyLog), WithSuffixIndex(true)}
+			db, err := Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+
+			db.Put([]byte("import/000000"), []byte("old"))
+			pairs := sortedPairs(2000)
+			large := KV{Key: []byte("import/large"), Value: []byte(strings.Repeat("x", 8192))}
+			pairs = append(pairs[:1000], append([]KV{large}, pairs[1000:]...)...)
+			// 同一个 key 出现多次时后者覆盖前者
+			pairs = append(pairs, KV{Key: []byte("import/000001"), Value: []byte("latest")})
+
+			if err := db.PutAll(pairs); err != nil {
+				t.Fatalf("PutAll 失败: %v", err)
+			}
+
+			check := func(db *DB) {
+				t.Helper()
+				for i, kv := range pairs[:len(pairs)-1] {
+					want := string(kv.Value)
+					if i == 1 {
+						want = "latest"
+					}
+					value, err := db.Get(kv.Key)
+					if err != nil || string(value) != want {
+						t.Fatalf("读取 %s 不匹配: got %.20q, err %v", kv.Key, value, err)
+					}
+				}
+				count := 0
+				db.ScanSuffix([]byte("999"), func(key, value []byte) bool {
+					count++
+					return true
+				})
+				if count != 2 {
+					t.Errorf("后缀索引应包含导入的 key: got %d, want 2", count)
+				}
+			}
+			check(db)
+
+			if len(db.olderFiles) < 2 {
+				t.Errorf("导入应按大小限制轮转数据文件: 只有 %d 个旧文件", len(db.olderFiles))
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭数据库失败: %v", err)
+			}
+
+			db, err = Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("重新打开数据库失败: %v", err)
+			}
+			defer db.Close()
+			check(db)
+		})
+	}
+}
+
+func TestDB_PutAllValidation(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithMaxKeySize(16))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 任一 key 超限时不写入任何数据
+	err = db.PutAll([]KV{
+		{Key: []byte("ok"), Value: []byte("v")},
+		{Key: []byte(strings.Repeat("k", 17)), Value: []byte("v")},
+	})
+	if err != ErrKeyTooLarge {
+		t.Fatalf("应返回 ErrKeyTooLarge, 得到: %v", err)
+	}
+	if _, err := db.Get([]byte("ok")); err != storage.ErrKeyNotFound {
+		t.Errorf("校验失败时不应写入, 得到: %v", err)
+	}
+
+	if err := db.PutAll(nil); err != nil {
+		t.Errorf("空导入不应报错: %v", err)
+	}
+}
+
+func BenchmarkDB_PutAll(b *testing.B) {
+	pairs := sortedPairs(10000)
+
+	bench := func(b *testing.B, write func(db *DB) error) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			dir, err := os.MkdirTemp("", "bitcask_bench")
+			if err != nil {
+				b.Fatalf("创建临时目录失败: %v", err)
+			}
+			db, err := Open(dir)
+			if err != nil {
+				b.Fatalf("打开数据库失败: %v", err)
+			}
+			b.StartTimer()
+
+			if err := write(db); err != nil {
+				b.Fatalf("写入失败: %v", err)
+			}
+
+			b.StopTimer()
+			db.Close()
+			os.RemoveAll(dir)
+			b.StartTimer()
+		}
+	}
+
+	b.Run("Put", func(b *testing.B) {
+		bench(b, func(db *DB) error {
+			for _, kv := range pairs {
+				if err := db.Put(kv.Key, kv.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("PutAll", func(b *testing.B) {
+		bench(b, func(db *DB) error {
+			return db.PutAll(pairs)
+		})
+	})
+}
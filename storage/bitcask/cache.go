@@ -0,0 +1,275 @@
+package bitcask
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ==================== Value 缓存 ====================
+//
+// Value 缓存按 value 大小分为 small / medium / large 三类，每类是一个独立容量的 LRU 段，
+// 少量大 value 只会挤占 large 段，不会把大量热点小 value 驱逐出去。
+//
+// 缓存以 Entry 的位置（FileID + Offset）为键：数据文件只追加、文件 ID 单调递增，
+// 同一位置上的内容永远不会改变。覆盖或删除 key 后索引指向新的位置，旧位置的缓存不再被命中，
+// 随 LRU 淘汰；Merge 删除旧文件时一并清理其缓存。
+
+// SizeClass value 的大小分类
+type SizeClass int
+
+const (
+	SizeClassSmall  SizeClass = iota // 小 value
+	SizeClassMedium                  // 中等 value
+	SizeClassLarge                   // 大 value
+
+	numSizeClasses = 3
+)
+
+// String 返回大小分类的名称
+func (c SizeClass) String() string {
+	switch c {
+	case SizeClassSmall:
+		return "small"
+	case SizeClassMedium:
+		return "medium"
+	case SizeClassLarge:
+		return "large"
+	default:
+		return "unknown"
+	}
+}
+
+// 分类阈值的默认值
+const (
+	defaultSmallValueSize  = 1024      // 不超过 1KB 为 small
+	defaultMediumValueSize = 64 * 1024 // 不超过 64KB 为 medium
+)
+
+// cacheEntryOverhead 每个缓存项除 value 之外的估算开销（链表节点、map 项、位置），计入容量
+const cacheEntryOverhead = 64
+
+// ValueCacheConfig Value 缓存的配置
+// 阈值为 0 时使用默认值（1KB / 64KB）；容量为 0 的分类不缓存，三类容量都为 0 时不启用缓存
+type ValueCacheConfig struct {
+	SmallMaxSize  int // value 不超过该大小（字节）为 small
+	MediumMaxSize int // value 不超过该大小（字节）为 medium，更大的为 large
+
+	SmallCapacity  int64 // small 段容量（字节）
+	MediumCapacity int64 // medium 段容量（字节）
+	LargeCapacity  int64 // large 段容量（字节）
+}
+
+// enabled 是否至少有一类启用了缓存
+func (c ValueCacheConfig) enabled() bool {
+	return c.SmallCapacity > 0 || c.MediumCapacity > 0 || c.LargeCapacity > 0
+}
+
+// classOf 返回 value 大小对应的分类
+func (c ValueCacheConfig) classOf(size int) SizeClass {
+	switch {
+	case size <= c.SmallMaxSize:
+		return SizeClassSmall
+	case size <= c.MediumMaxSize:
+		return SizeClassMedium
+	default:
+		return SizeClassLarge
+	}
+}
+
+// WithValueCache 启用按大小分类的 Value 缓存
+func WithValueCache(config ValueCacheConfig) Option {
+	return func(o *Options) {
+		o.ValueCache = config
+	}
+}
+
+// CacheClassStats 单个大小分类的缓存统计
+type CacheClassStats struct {
+	Entries   int    // 缓存项数量
+	Bytes     int64  // 已用容量（字节，含每项的估算开销）
+	Capacity  int64  // 容量（字节）
+	Hits      uint64 // 命中次数
+	Misses    uint64 // 未命中次数
+	Evictions uint64 // 因容量不足被淘汰的次数
+}
+
+// ValueCacheStats Value 缓存各分类的统计
+type ValueCacheStats struct {
+	Small  CacheClassStats
+	Medium CacheClassStats
+	Large  CacheClassStats
+}
+
+// cacheKey 缓存项的键：Entry 的位置
+type cacheKey struct {
+	fileID uint32
+	offset int64
+}
+
+// cacheItem 缓存项
+type cacheItem struct {
+	key   cacheKey
+	value []byte
+}
+
+// lruSegment 单个分类的 LRU 段
+type lruSegment struct {
+	mu       sync.Mutex
+	capacity int64
+	used     int64
+	ll       *list.List // 队首为最近使用
+	items    map[cacheKey]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func newLRUSegment(capacity int64) *lruSegment {
+	return &lruSegment{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// get 查询缓存项并将其移到队首
+func (s *lruSegment) get(key cacheKey) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		s.misses++
+		return nil, false
+	}
+	s.hits++
+	s.ll.MoveToFront(elem)
+	return elem.Value.(*cacheItem).value, true
+}
+
+// put 加入缓存项，超出容量时从队尾淘汰
+// 单个 value 超过整段容量时不缓存
+func (s *lruSegment) put(key cacheKey, value []byte) {
+	cost := int64(len(value)) + cacheEntryOverhead
+	if cost > s.capacity {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; ok {
+		return
+	}
+	for s.used+cost > s.capacity {
+		s.removeElement(s.ll.Back())
+		s.evictions++
+	}
+	s.items[key] = s.ll.PushFront(&cacheItem{key: key, value: value})
+	s.used += cost
+}
+
+// removeFile 删除某个数据文件的全部缓存项
+func (s *lruSegment) removeFile(fileID uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, elem := range s.items {
+		if key.fileID == fileID {
+			s.removeElement(elem)
+		}
+	}
+}
+
+// removeElement 删除缓存项，调用方必须持有 s.mu
+func (s *lruSegment) removeElement(elem *list.Element) {
+	item := s.ll.Remove(elem).(*cacheItem)
+	delete(s.items, item.key)
+	s.used -= int64(len(item.value)) + cacheEntryOverhead
+}
+
+// stats 返回该段的统计
+func (s *lruSegment) stats() CacheClassStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return CacheClassStats{
+		Entries:   len(s.items),
+		Bytes:     s.used,
+		Capacity:  s.capacity,
+		Hits:      s.hits,
+		Misses:    s.misses,
+		Evictions: s.evictions,
+	}
+}
+
+// valueCache 按大小分类的 Value 缓存，可并发使用
+type valueCache struct {
+	config   ValueCacheConfig
+	segments [numSizeClasses]*lruSegment
+}
+
+func newValueCache(config ValueCacheConfig) *valueCache {
+	if config.SmallMaxSize <= 0 {
+		config.SmallMaxSize = defaultSmallValueSize
+	}
+	if config.MediumMaxSize <= 0 {
+		config.MediumMaxSize = defaultMediumValueSize
+	}
+	return &valueCache{
+		config: config,
+		segments: [numSizeClasses]*lruSegment{
+			SizeClassSmall:  newLRUSegment(config.SmallCapacity),
+			SizeClassMedium: newLRUSegment(config.MediumCapacity),
+			SizeClassLarge:  newLRUSegment(config.LargeCapacity),
+		},
+	}
+}
+
+// get 查询 (fileID, offset) 处的 value，命中时返回副本
+// size 为 value 在磁盘上的大小，用于确定分类
+func (c *valueCache) get(fileID uint32, offset int64, size int) ([]byte, bool) {
+	segment := c.segments[c.config.classOf(size)]
+	if segment.capacity <= 0 {
+		return nil, false
+	}
+	value, ok := segment.get(cacheKey{fileID: fileID, offset: offset})
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), value...), true
+}
+
+// put 缓存 (fileID, offset) 处的 value，保存的是副本，调用方可以继续使用 value
+func (c *valueCache) put(fileID uint32, offset int64, size int, value []byte) {
+	segment := c.segments[c.config.classOf(size)]
+	if segment.capacity <= 0 {
+		return
+	}
+	segment.put(cacheKey{fileID: fileID, offset: offset}, append([]byte(nil), value...))
+}
+
+// removeFile 删除某个数据文件的全部缓存项
+func (c *valueCache) removeFile(fileID uint32) {
+	for _, segment := range c.segments {
+		segment.removeFile(fileID)
+	}
+}
+
+// stats 返回各分类的统计
+func (c *valueCache) stats() ValueCacheStats {
+	return ValueCacheStats{
+		Small:  c.segments[SizeClassSmall].stats(),
+		Medium: c.segments[SizeClassMedium].stats(),
+		Large:  c.segments[SizeClassLarge].stats(),
+	}
+}
+
+// ValueCacheStats 返回 Value 缓存各分类的统计，未启用缓存时返回零值
+func (db *DB) ValueCacheStats() ValueCacheStats {
+	if db.valueCache == nil {
+		return ValueCacheStats{}
+	}
+	return db.valueCache.stats()
+}
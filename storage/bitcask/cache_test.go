@@ -0,0 +1,189 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+func TestValueCache_ClassesEvictIndependently(t *testing.T) {
+	small := make([]byte, 10)
+	large := make([]byte, 4096)
+	cache := newValueCache(ValueCacheConfig{
+		SmallMaxSize:   16,
+		MediumMaxSize:  1024,
+		SmallCapacity:  10 * (int64(len(small)) + cacheEntryOverhead),
+		MediumCapacity: 0,
+		LargeCapacity:  2 * (int64(len(large)) + cacheEntryOverhead),
+	})
+
+	for i := 0; i < 10; i++ {
+		cache.put(1, int64(i), len(small), small)
+	}
+	// 大 value 超出 large 段容量，只淘汰 large 段
+	for i := 0; i < 5; i++ {
+		cache.put(2, int64(i), len(large), large)
+	}
+	stats := cache.stats()
+	if stats.Large.Entries != 2 || stats.Large.Evictions != 3 {
+		t.Fatalf("large 段统计不匹配: %+v", stats.Large)
+	}
+	if stats.Small.Entries != 10 || stats.Small.Evictions != 0 {
+		t.Fatalf("large 段淘汰不应影响 small 段: %+v", stats.Small)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := cache.get(1, int64(i), len(small)); !ok {
+			t.Fatalf("small value %d 应仍在缓存中", i)
+		}
+	}
+
+	// small 段满后只淘汰 small 段
+	for i := 10; i < 15; i++ {
+		cache.put(1, int64(i), len(small), small)
+	}
+	stats = cache.stats()
+	if stats.Small.Entries != 10 || stats.Small.Evictions != 5 {
+		t.Fatalf("small 段统计不匹配: %+v", stats.Small)
+	}
+	if stats.Large.Entries != 2 || stats.Large.Evictions != 3 {
+		t.Fatalf("small 段淘汰不应影响 large 段: %+v", stats.Large)
+	}
+
+	// 容量为 0 的分类不缓存
+	cache.put(3, 0, 100, make([]byte, 100))
+	if _, ok := cache.get(3, 0, 100); ok {
+		t.Fatal("medium 段容量为 0 时不应缓存")
+	}
+
+	// 删除文件时清理其缓存项
+	cache.removeFile(2)
+	if stats := cache.stats(); stats.Large.Entries != 0 || stats.Large.Bytes != 0 {
+		t.Fatalf("删除文件后 large 段应为空: %+v", stats.Large)
+	}
+}
+
+func TestValueCache_ReturnsCopy(t *testing.T) {
+	cache := newValueCache(ValueCacheConfig{SmallCapacity: 1024})
+
+	value := []byte("hello")
+	cache.put(1, 0, len(value), value)
+	value[0] = 'x'
+
+	got, ok := cache.get(1, 0, len(value))
+	if !ok || string(got) != "hello" {
+		t.Fatalf("缓存应保存副本: got %q, ok=%v", got, ok)
+	}
+	got[0] = 'y'
+	if again, _ := cache.get(1, 0, len(value)); string(again) != "hello" {
+		t.Fatalf("修改返回值不应影响缓存: got %q", again)
+	}
+}
+
+func TestDB_ValueCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithValueCache(ValueCacheConfig{
+		SmallCapacity: 64 * 1024,
+		LargeCapacity: 1024 * 1024,
+	}))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("L"), 100*1024)
+	db.Put([]byte("small"), []byte("v1"))
+	db.Put([]byte("large"), large)
+
+	for i := 0; i < 3; i++ {
+		if value, err := db.Get([]byte("small")); err != nil || string(value) != "v1" {
+			t.Fatalf("读取 small 失败: %q, %v", value, err)
+		}
+		if value, err := db.Get([]byte("large")); err != nil || !bytes.Equal(value, large) {
+			t.Fatalf("读取 large 失败: %v", err)
+		}
+	}
+	stats := db.ValueCacheStats()
+	if stats.Small.Hits != 2 || stats.Small.Misses != 1 {
+		t.Errorf("small 命中统计不匹配: %+v", stats.Small)
+	}
+	if stats.Large.Hits != 2 || stats.Large.Misses != 1 {
+		t.Errorf("large 命中统计不匹配: %+v", stats.Large)
+	}
+
+	// 覆盖与删除后不会读到缓存中的旧值
+	db.Put([]byte("small"), []byte("v2"))
+	if value, _ := db.Get([]byte("small")); string(value) != "v2" {
+		t.Fatalf("覆盖后应读到新值: got %q", value)
+	}
+	db.Delete([]byte("large"))
+	if _, err := db.Get([]byte("large")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("删除后应返回 ErrKeyNotFound, 得到: %v", err)
+	}
+
+	// Merge 删除旧文件时清理其缓存项，重写后的位置重新缓存
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	if stats := db.ValueCacheStats(); stats.Small.Entries != 0 || stats.Large.Entries != 0 {
+		t.Fatalf("Merge 后旧文件的缓存项应被清理: %+v", stats)
+	}
+	if value, _ := db.Get([]byte("small")); string(value) != "v2" {
+		t.Fatalf("Merge 后应读到新值: got %q", value)
+	}
+}
+
+// BenchmarkValueCache_MixedTraffic 对比总容量相同时单一 LRU 与按大小分类的 LRU 在混合负载下的小 value 命中率：
+// 热点小 value 被反复读取，穿插读取只出现一次的大 value
+func BenchmarkValueCache_MixedTraffic(b *testing.B) {
+	const total = 1024 * 1024
+	small := make([]byte, 100)
+	large := make([]byte, 128*1024)
+
+	configs := []struct {
+		name   string
+		config ValueCacheConfig
+	}{
+		// 阈值足够大时所有 value 都进入同一个段，相当于不分类
+		{"Unified", ValueCacheConfig{SmallMaxSize: math.MaxInt, MediumMaxSize: math.MaxInt, SmallCapacity: total}},
+		{"SizeClasses", ValueCacheConfig{SmallCapacity: total / 4, MediumCapacity: total / 4, LargeCapacity: total / 2}},
+	}
+	for _, tc := range configs {
+		b.Run(tc.name, func(b *testing.B) {
+			cache := newValueCache(tc.config)
+			rng := rand.New(rand.NewSource(1))
+
+			var hits, lookups int
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// 每 10 次读取中有一次是只出现一次的大 value
+				if i%10 == 0 {
+					if _, ok := cache.get(2, int64(i), len(large)); !ok {
+						cache.put(2, int64(i), len(large), large)
+					}
+					continue
+				}
+
+				offset := int64(rng.Intn(1500))
+				lookups++
+				if _, ok := cache.get(1, offset, len(small)); ok {
+					hits++
+				} else {
+					cache.put(1, offset, len(small), small)
+				}
+			}
+			if lookups > 0 {
+				b.ReportMetric(float64(hits)/float64(lookups)*100, "small-hit%")
+			}
+		})
+	}
+}
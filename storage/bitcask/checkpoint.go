@@ -0,0 +1,247 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 启动引导检查点 ====================
+//
+// 数据量很大时启动引导需要扫描全部旧文件，扫描中途崩溃后重新打开又要从头开始。
+// 启用 BootstrapCheckpointInterval 后，扫描旧文件时每完成若干个文件写入一次检查点，
+// 记录已完成扫描的文件（ID 与大小）、最大写入序号以及此时索引中全部存活 key 的位置。
+//
+// 重新打开时先校验检查点：记录的文件必须正好是现有旧文件中 ID 最小的若干个，且大小不变。
+// 通过校验则直接恢复索引，布隆过滤器与后缀索引由恢复的 key 重建，只扫描之后的文件；
+// 检查点损坏或与现有文件不一致时删除它，退回完整扫描。
+// 旧文件是只读的，只会被 Merge 删除，删除数据文件时同时删除检查点。
+//
+// 检查点只是加速手段：写入失败时删除不完整的文件，不影响打开。
+//
+// 文件格式（小端序）：
+//
+//	magic "TKVP" | version uint32 | seq uint64
+//	fileCount uint32 | 每个文件：fileID uint32 | size uint64
+//	entryCount uint64 | 每个 key：keyLen uvarint | key | fileID uint32 | offset uint64 | size uint32
+//	crc uint32（之前全部字节的 CRC32）
+
+const (
+	// bootstrapCheckpointName 检查点文件名
+	bootstrapCheckpointName = "bootstrap.checkpoint"
+
+	bootstrapCheckpointMagic   = "TKVP"
+	bootstrapCheckpointVersion = 1
+)
+
+// errBadCheckpoint 表示检查点格式错误或校验失败
+var errBadCheckpoint = errors.New("bad bootstrap checkpoint")
+
+// checkpointFile 检查点中记录的一个已完成扫描的文件
+type checkpointFile struct {
+	FileID uint32
+	Size   int64
+}
+
+// checkpointEntry 检查点中记录的一个存活 key
+type checkpointEntry struct {
+	Key []byte
+	Pos storage.Position
+}
+
+// bootstrapCheckpoint 解码后的检查点
+type bootstrapCheckpoint struct {
+	Seq     uint64
+	Files   []checkpointFile
+	Entries []checkpointEntry
+}
+
+// bootstrapCheckpointPath 返回检查点文件的路径
+func (db *DB) bootstrapCheckpointPath() string {
+	return filepath.Join(db.dir, bootstrapCheckpointName)
+}
+
+// resumeBootstrap 从检查点恢复索引
+// 参数：
+//   - files: 按 ID 升序排列的全部旧文件
+//
+// 返回：
+//   - int: 从检查点恢复的文件数量，即 files 中无需再扫描的前缀长度；检查点不存在或无效时为 0
+func (db *DB) resumeBootstrap(files []*DataFile) int {
+	cp, err := db.loadBootstrapCheckpoint()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			db.removeBootstrapCheckpoint()
+		}
+		return 0
+	}
+	if !cp.matches(files) {
+		db.removeBootstrapCheckpoint()
+		return 0
+	}
+
+	if cp.Seq > db.seq {
+		db.seq = cp.Seq
+	}
+	for _, entry := range cp.Entries {
+		pos := entry.Pos
+		db.index.Put(entry.Key, &pos)
+		db.suffixAdd(entry.Key)
+		db.observeAppendKey(entry.Key)
+		db.bloomFilter.Add(entry.Key)
+	}
+	return len(cp.Files)
+}
+
+// matches 检查点记录的文件是否正好是 files 中 ID 最小的若干个，且大小不变
+func (cp *bootstrapCheckpoint) matches(files []*DataFile) bool {
+	if len(cp.Files) > len(files) {
+		return false
+	}
+	for i, f := range cp.Files {
+		if files[i].GetFileID() != f.FileID || files[i].GetWriteOff() != f.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// saveBootstrapCheckpoint 将已扫描的旧文件与当前索引写入检查点，写入失败时删除不完整的文件
+// 只在启动引导扫描旧文件期间调用，此时索引中正好是 scanned 中的存活 key
+// 参数：
+//   - scanned: 已完成扫描的旧文件，按 ID 升序排列
+func (db *DB) saveBootstrapCheckpoint(scanned []*DataFile) {
+	if err := db.writeBootstrapCheckpoint(scanned); err != nil {
+		db.removeBootstrapCheckpoint()
+	}
+}
+
+// writeBootstrapCheckpoint 写入检查点，覆盖已有的检查点
+func (db *DB) writeBootstrapCheckpoint(scanned []*DataFile) error {
+	file, err := db.options.FileSystem.OpenFile(db.bootstrapCheckpointPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	crc := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(file, crc))
+
+	buf := []byte(bootstrapCheckpointMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, bootstrapCheckpointVersion)
+	buf = binary.LittleEndian.AppendUint64(buf, db.seq)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(scanned)))
+	for _, dataFile := range scanned {
+		buf = binary.LittleEndian.AppendUint32(buf, dataFile.GetFileID())
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(dataFile.GetWriteOff()))
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(db.index.Size()))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	count := 0
+	iter := db.index.Seek(nil)
+	defer iter.Close()
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		pos := iter.Value()
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.LittleEndian.AppendUint32(buf, pos.FileID)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(pos.Offset))
+		buf = binary.LittleEndian.AppendUint32(buf, pos.Size)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		count++
+		iter.Next()
+	}
+	if count != db.index.Size() {
+		return fmt.Errorf("索引大小与遍历结果不一致: %d != %d", db.index.Size(), count)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, err := file.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// loadBootstrapCheckpoint 读取并校验检查点
+// 返回：
+//   - *bootstrapCheckpoint: 检查点
+//   - error: 文件不存在时返回满足 os.IsNotExist 的错误，格式错误或校验失败时返回 errBadCheckpoint
+func (db *DB) loadBootstrapCheckpoint() (*bootstrapCheckpoint, error) {
+	data, err := readFile(db.options.FileSystem, db.bootstrapCheckpointPath())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: 文件过短", errBadCheckpoint)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%w: 校验失败", errBadCheckpoint)
+	}
+
+	truncated := fmt.Errorf("%w: 数据截断", errBadCheckpoint)
+	if len(body) < 20 || string(body[:4]) != bootstrapCheckpointMagic {
+		return nil, fmt.Errorf("%w: magic 不匹配", errBadCheckpoint)
+	}
+	if version := binary.LittleEndian.Uint32(body[4:8]); version != bootstrapCheckpointVersion {
+		return nil, fmt.Errorf("%w: 不支持的版本 %d", errBadCheckpoint, version)
+	}
+	cp := &bootstrapCheckpoint{Seq: binary.LittleEndian.Uint64(body[8:16])}
+	fileCount := int(binary.LittleEndian.Uint32(body[16:20]))
+	body = body[20:]
+
+	if len(body) < fileCount*12+8 {
+		return nil, truncated
+	}
+	cp.Files = make([]checkpointFile, fileCount)
+	for i := range cp.Files {
+		cp.Files[i] = checkpointFile{
+			FileID: binary.LittleEndian.Uint32(body[0:4]),
+			Size:   int64(binary.LittleEndian.Uint64(body[4:12])),
+		}
+		body = body[12:]
+	}
+
+	entryCount := binary.LittleEndian.Uint64(body[:8])
+	body = body[8:]
+	for i := uint64(0); i < entryCount; i++ {
+		keyLen, n := binary.Uvarint(body)
+		if n <= 0 || uint64(len(body)-n) < keyLen+16 {
+			return nil, truncated
+		}
+		body = body[n:]
+		rest := body[keyLen:]
+		cp.Entries = append(cp.Entries, checkpointEntry{
+			Key: body[:keyLen:keyLen],
+			Pos: storage.Position{
+				FileID: binary.LittleEndian.Uint32(rest[0:4]),
+				Offset: int64(binary.LittleEndian.Uint64(rest[4:12])),
+				Size:   binary.LittleEndian.Uint32(rest[12:16]),
+			},
+		})
+		body = rest[16:]
+	}
+	if len(body) != 0 {
+		return nil, fmt.Errorf("%w: 存在多余的数据", errBadCheckpoint)
+	}
+	return cp, nil
+}
+
+// removeBootstrapCheckpoint 删除检查点，文件不存在时不做任何事
+func (db *DB) removeBootstrapCheckpoint() {
+	db.options.FileSystem.Remove(db.bootstrapCheckpointPath())
+}
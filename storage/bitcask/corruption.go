@@ -0,0 +1,118 @@
+package bitcask
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/forever-free1/TideKV/metrics"
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 损坏处理 ====================
+//
+// Get 读到 CRC 校验失败的 Entry 时，按 CorruptionPolicy 处理。每次发生都会输出一行日志
+// 并递增 tidekv_storage_corruption_total 指标。
+//
+// 隔离（CorruptionQuarantineKey）只把 key 移出内存索引，数据文件保持原样以便修复；
+// 重启后 key 会从数据文件重新载入索引，再次读到时重新隔离；Merge 不会保留已隔离的 Entry。
+// 再次写入该 key 即视为已修复。
+
+// CorruptionPolicy 定义读到损坏 Entry 时的处理策略
+type CorruptionPolicy int
+
+const (
+	// CorruptionFail 返回包装了 ErrCRCMismatch 的错误（默认）
+	CorruptionFail CorruptionPolicy = iota
+	// CorruptionSkipAsNotFound 视为 key 不存在，返回 storage.ErrKeyNotFound
+	CorruptionSkipAsNotFound
+	// CorruptionQuarantineKey 将 key 移出索引并记录到隔离列表，返回 storage.ErrKeyNotFound
+	CorruptionQuarantineKey
+)
+
+// String 返回策略名称，用于日志与指标标签
+func (p CorruptionPolicy) String() string {
+	switch p {
+	case CorruptionSkipAsNotFound:
+		return "skip"
+	case CorruptionQuarantineKey:
+		return "quarantine"
+	default:
+		return "fail"
+	}
+}
+
+// QuarantinedEntry 被隔离的 key 及其损坏 Entry 的位置
+type QuarantinedEntry struct {
+	Key    []byte
+	FileID uint32
+	Offset int64
+	Time   time.Time // 隔离时间
+}
+
+// handleCorruption 按 CorruptionPolicy 处理 Get 读到的损坏 Entry
+// 调用方不能持有锁
+func (db *DB) handleCorruption(key []byte, pos *storage.Position, err error) ([]byte, error) {
+	policy := db.options.CorruptionPolicy
+	metrics.RecordCorruption(policy.String())
+	log.Printf("bitcask: 读取 key %q 失败 (file=%d, offset=%d, policy=%s): %v",
+		key, pos.FileID, pos.Offset, policy, err)
+
+	switch policy {
+	case CorruptionSkipAsNotFound:
+		return nil, storage.ErrKeyNotFound
+	case CorruptionQuarantineKey:
+		db.quarantineKey(key, pos)
+		return nil, storage.ErrKeyNotFound
+	default:
+		return nil, err
+	}
+}
+
+// quarantineKey 将 key 移出索引并加入隔离列表
+// 读锁释放后 key 可能已被重新写入，只有索引仍指向损坏的位置时才隔离
+func (db *DB) quarantineKey(key []byte, pos *storage.Position) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current, _ := db.peekIndex(key)
+	if current == nil || current.FileID != pos.FileID || current.Offset != pos.Offset {
+		return
+	}
+
+	db.index.Delete(key)
+	db.suffixDelete(key)
+	db.secondaryDelete(key)
+	if db.quarantine == nil {
+		db.quarantine = make(map[string]QuarantinedEntry)
+	}
+	db.quarantine[string(key)] = QuarantinedEntry{
+		Key:    append([]byte(nil), key...),
+		FileID: pos.FileID,
+		Offset: pos.Offset,
+		Time:   time.Now(),
+	}
+}
+
+// unquarantine 写入 key 后将其移出隔离列表
+// 调用方必须持有写锁
+func (db *DB) unquarantine(key []byte) {
+	if len(db.quarantine) > 0 {
+		delete(db.quarantine, string(key))
+	}
+}
+
+// Quarantined 返回当前被隔离的 key，按 key 排序
+func (db *DB) Quarantined() []QuarantinedEntry {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entries := make([]QuarantinedEntry, 0, len(db.quarantine))
+	for _, entry := range db.quarantine {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return string(entries[i].Key) < string(entries[j].Key)
+	})
+	return entries
+}
@@ -0,0 +1,96 @@
+package bitcask
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// corruptValue 破坏 key 当前 Entry 的 value，使 CRC 校验失败
+func corruptValue(t *testing.T, db *DB, key []byte) {
+	t.Helper()
+	pos := db.index.Get(key)
+	valueOffset := pos.Offset + HeaderSize + int64(len(key))
+	patchTestFile(t, OSFileSystem, db.GetFilePath(pos.FileID), valueOffset, []byte("XX"))
+}
+
+func TestDB_CorruptionPolicy(t *testing.T) {
+	tests := []struct {
+		policy CorruptionPolicy
+		check  func(t *testing.T, err error)
+	}{
+		{CorruptionFail, func(t *testing.T, err error) {
+			if !errors.Is(err, ErrCRCMismatch) {
+				t.Fatalf("应返回 ErrCRCMismatch, 得到: %v", err)
+			}
+		}},
+		{CorruptionSkipAsNotFound, func(t *testing.T, err error) {
+			if err != storage.ErrKeyNotFound {
+				t.Fatalf("应视为不存在, 得到: %v", err)
+			}
+		}},
+		{CorruptionQuarantineKey, func(t *testing.T, err error) {
+			if err != storage.ErrKeyNotFound {
+				t.Fatalf("应视为不存在, 得到: %v", err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir, WithCorruptionPolicy(tt.policy))
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			defer db.Close()
+
+			db.Put([]byte("bad"), []byte("value"))
+			db.Put([]byte("good"), []byte("value"))
+			corruptValue(t, db, []byte("bad"))
+			pos := db.index.Get([]byte("bad"))
+
+			_, err = db.Get([]byte("bad"))
+			tt.check(t, err)
+
+			// 其他 key 不受影响
+			if value, err := db.Get([]byte("good")); err != nil || string(value) != "value" {
+				t.Fatalf("未损坏的 key 读取失败: %s, %v", value, err)
+			}
+
+			quarantined := db.Quarantined()
+			if tt.policy != CorruptionQuarantineKey {
+				if len(quarantined) != 0 || db.index.Get([]byte("bad")) == nil {
+					t.Fatalf("非隔离策略不应修改索引: %v", quarantined)
+				}
+				return
+			}
+
+			if len(quarantined) != 1 || string(quarantined[0].Key) != "bad" ||
+				quarantined[0].FileID != pos.FileID || quarantined[0].Offset != pos.Offset {
+				t.Fatalf("隔离列表不匹配: %+v", quarantined)
+			}
+			if db.index.Get([]byte("bad")) != nil {
+				t.Fatalf("被隔离的 key 应移出索引")
+			}
+
+			// 重新写入视为已修复
+			if err := db.Put([]byte("bad"), []byte("repaired")); err != nil {
+				t.Fatalf("Put 失败: %v", err)
+			}
+			if value, err := db.Get([]byte("bad")); err != nil || string(value) != "repaired" {
+				t.Fatalf("修复后读取失败: %s, %v", value, err)
+			}
+			if n := len(db.Quarantined()); n != 0 {
+				t.Errorf("修复后应移出隔离列表: 剩余 %d", n)
+			}
+		})
+	}
+}
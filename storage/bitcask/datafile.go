@@ -3,19 +3,31 @@ package bitcask
 import (
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
 // DataFile 表示一个数据文件
 // 支持追加写入、随机读取和同步操作
 type DataFile struct {
 	FileID   uint32       // 文件 ID，用于标识不同的数据文件
-	File     *os.File     // 底层文件句柄
+	File     File         // 底层文件句柄
 	WriteOff int64        // 当前写入偏移量
+	name     string       // 文件名（不含目录），由 FileNamer 生成
 	mu       sync.RWMutex // 读写锁，保护文件操作
+
+	reuseBuffers bool // 编码与读取头部使用缓冲池（Options.ReuseBuffers）
+
+	safeOff atomic.Int64 // 最后一个完整写入的 Entry 的末尾，不加锁读取，见 SafeReadOffset
+
+	// 写缓冲（Options.WriteBufferSize），打开之后不再修改
+	bufLimit int                 // 缓冲的数据达到该大小时写入文件，0 表示不缓冲
+	onFlush  func(fileID uint32) // 缓冲的数据写入文件之后调用
+	pending  []byte              // 尚未写入文件的数据，位于 [WriteOff-len(pending), WriteOff)
 }
 
 // DataFileOption 定义 DataFile 的配置选项
@@ -37,14 +49,20 @@ func WithFileID(id uint32) DataFileOption {
 //   - *DataFile: 数据文件指针
 //   - error: 打开错误
 func OpenDataFile(dir string, fileID uint32) (*DataFile, error) {
+	return openDataFile(OSFileSystem, DefaultFileNamer, dir, fileID)
+}
+
+// openDataFile 在指定文件系统上按 namer 的命名规则打开或创建一个数据文件
+func openDataFile(fsys FileSystem, namer FileNamer, dir string, fileID uint32) (*DataFile, error) {
 	// 生成文件名
-	filename := fmt.Sprintf("%s/%08d.data", dir, fileID)
+	name := namer.DataFileName(fileID)
+	filename := filepath.Join(dir, name)
 
 	// 以读写追加模式打开文件（不存在则创建）
 	// O_APPEND: 每次写入从文件末尾开始
 	// O_CREATE: 文件不存在时创建
 	// O_RDWR: 读写模式，支持同时读写
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	file, err := fsys.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("打开数据文件失败: %w", err)
 	}
@@ -60,7 +78,9 @@ func OpenDataFile(dir string, fileID uint32) (*DataFile, error) {
 		FileID:   fileID,
 		File:     file,
 		WriteOff: stat.Size(),
+		name:     name,
 	}
+	df.safeOff.Store(stat.Size())
 
 	return df, nil
 }
@@ -105,21 +125,25 @@ func (df *DataFile) Write(entry *Entry) (int64, error) {
 		return 0, ErrFileClosed
 	}
 
-	// 编码 Entry 为字节切片
-	data := entry.Encode()
+	// 编码 Entry 为字节切片；缓冲池中的缓冲区在写入返回后即可复用（io.Writer 不得保留传入的切片）
+	var data []byte
+	if df.reuseBuffers {
+		buf := getBuffer(int(entry.Size()))
+		defer putBuffer(buf)
+		data = *buf
+		entry.encodeTo(data)
+	} else {
+		data = entry.Encode()
+	}
 
 	// 记录写入前的偏移量（作为返回的 Position）
 	offset := df.WriteOff
 
-	// 写入数据
-	n, err := df.File.Write(data)
-	if err != nil {
+	// 写入数据，写入不完整时回滚
+	if err := df.writeFull(data); err != nil {
 		return offset, fmt.Errorf("写入数据失败: %w", err)
 	}
 
-	// 更新写入偏移量
-	df.WriteOff += int64(n)
-
 	return offset, nil
 }
 
@@ -142,18 +166,95 @@ func (df *DataFile) WriteBytes(data []byte) (int64, error) {
 	// 记录写入前的偏移量
 	offset := df.WriteOff
 
-	// 写入数据
-	n, err := df.File.Write(data)
-	if err != nil {
+	// 写入数据，写入不完整时回滚
+	if err := df.writeFull(data); err != nil {
 		return offset, fmt.Errorf("写入字节数据失败: %w", err)
 	}
 
-	// 更新写入偏移量
-	df.WriteOff += int64(n)
-
 	return offset, nil
 }
 
+// writeFull 追加 data 并推进写入偏移量，启用写缓冲时先放入缓冲区，调用方必须持有 df.mu
+func (df *DataFile) writeFull(data []byte) error {
+	if df.bufLimit > 0 {
+		return df.writeBuffered(data)
+	}
+	return df.writeFile(data)
+}
+
+// writeBuffered 将 data 追加到缓冲区，缓冲的数据达到 bufLimit 时写入文件
+// 写入文件失败时本次写入不计入（已部分写入文件的除外），之前缓冲的数据留在缓冲区中，下次写入文件时重试
+// 调用方必须持有 df.mu
+func (df *DataFile) writeBuffered(data []byte) error {
+	df.pending = append(df.pending, data...)
+	df.WriteOff += int64(len(data))
+	if len(df.pending) < df.bufLimit {
+		return nil
+	}
+	if err := df.flush(); err != nil {
+		drop := len(data)
+		if drop > len(df.pending) {
+			drop = len(df.pending)
+		}
+		df.pending = df.pending[:len(df.pending)-drop]
+		df.WriteOff -= int64(drop)
+		return err
+	}
+	return nil
+}
+
+// flush 将缓冲区中的数据写入文件，调用方必须持有 df.mu 写锁
+// 失败时未写入文件的部分留在缓冲区中
+func (df *DataFile) flush() error {
+	if len(df.pending) == 0 {
+		return nil
+	}
+	pending, end := df.pending, df.WriteOff
+	start := end - int64(len(pending))
+	df.WriteOff = start
+	if err := df.writeFile(pending); err != nil {
+		df.pending = pending[df.WriteOff-start:]
+		df.WriteOff = end
+		return err
+	}
+	df.pending = pending[:0]
+	if df.onFlush != nil {
+		df.onFlush(df.FileID)
+	}
+	return nil
+}
+
+// writeFile 将 data 完整写入文件并推进写入偏移量，调用方必须持有 df.mu
+// File.Write 返回的字节数少于 len(data) 时继续写入剩余部分；
+// 写入出错或没有进展时截断回写入前的偏移量，避免留下不完整的记录，并返回 ErrWriteFailed。
+// 截断失败时写入偏移量按实际写入的字节数推进，使后续记录的位置仍与文件内容一致，
+// 不完整的记录留给打开时的恢复流程处理
+func (df *DataFile) writeFile(data []byte) error {
+	start := df.WriteOff
+	written := 0
+	for written < len(data) {
+		n, err := df.File.Write(data[written:])
+		if n < 0 || n > len(data)-written {
+			n = 0
+		}
+		written += n
+		if err == nil && n > 0 {
+			continue
+		}
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		if truncErr := df.File.Truncate(start); truncErr != nil {
+			df.WriteOff = start + int64(written)
+			return fmt.Errorf("%w: 已写入 %d/%d 字节 (%v)，回滚失败: %v", ErrWriteFailed, written, len(data), err, truncErr)
+		}
+		return fmt.Errorf("%w: 已写入 %d/%d 字节，已回滚: %v", ErrWriteFailed, written, len(data), err)
+	}
+	df.WriteOff = start + int64(written)
+	df.safeOff.Store(df.WriteOff)
+	return nil
+}
+
 // Read 从指定偏移量读取数据
 // 参数：
 //   - offset: 读取起始偏移量
@@ -171,15 +272,9 @@ func (df *DataFile) Read(offset int64, size uint32) ([]byte, error) {
 		return nil, ErrFileClosed
 	}
 
-	// 跳转到指定偏移量
-	_, err := df.File.Seek(offset, io.SeekStart)
-	if err != nil {
-		return nil, fmt.Errorf("文件定位失败 (offset=%d): %w", offset, err)
-	}
-
-	// 读取指定大小的数据
+	// 使用 ReadAt 按偏移量读取，不改变共享的文件偏移，多个读者可以并发读取
 	data := make([]byte, size)
-	n, err := df.File.Read(data)
+	n, err := df.readAt(data, offset)
 	if err != nil {
 		if err == io.EOF {
 			// 读取到文件末尾，返回已读取的数据
@@ -199,18 +294,29 @@ func (df *DataFile) Read(offset int64, size uint32) ([]byte, error) {
 //   - *Entry: 读取的 Entry
 //   - error: 读取错误
 func (df *DataFile) ReadEntry(offset int64) (*Entry, error) {
-	// 首先读取头部信息（20 字节）
+	return df.readEntry(offset, true)
+}
+
+// readEntry 读取一个完整的 Entry，verify 为 false 时跳过 CRC 校验
+func (df *DataFile) readEntry(offset int64, verify bool) (*Entry, error) {
+	if df.reuseBuffers {
+		return df.readEntryPooled(offset, verify)
+	}
+
+	// 首先读取头部信息
 	header, err := df.Read(offset, HeaderSize)
 	if err != nil {
 		return nil, err
 	}
 
 	// 从头部解析 KeySize 和 ValueSize
-	keySize := binary.LittleEndian.Uint32(header[12:16])
-	valueSize := binary.LittleEndian.Uint32(header[16:20])
+	h, err := DecodeHeader(header)
+	if err != nil {
+		return nil, err
+	}
 
 	// 计算 Entry 总大小
-	totalSize := HeaderSize + int(keySize+valueSize)
+	totalSize := HeaderSize + int(h.KeySize+h.ValueSize)
 
 	// 读取完整的 Entry 数据
 	data, err := df.Read(offset, uint32(totalSize))
@@ -219,13 +325,197 @@ func (df *DataFile) ReadEntry(offset int64) (*Entry, error) {
 	}
 
 	// 解码 Entry
-	return Decode(data)
+	return decode(data, verify)
+}
+
+// readEntryPooled 同 readEntry，头部读入缓冲池中的缓冲区
+// Key 与 Value 读入一次分配的独立切片，不重复读取头部，返回的 Entry 不引用缓冲池
+func (df *DataFile) readEntryPooled(offset int64, verify bool) (*Entry, error) {
+	buf := getBuffer(HeaderSize)
+	defer putBuffer(buf)
+	header := *buf
+	if err := df.readFull(header, offset); err != nil {
+		return nil, err
+	}
+	entry, err := DecodeHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先按文件大小检查声明的长度，损坏的头部不会导致按巨大的长度分配
+	if offset+int64(entry.Size()) > df.GetWriteOff() {
+		return nil, ErrInvalidEntry
+	}
+
+	data := make([]byte, entry.KeySize+entry.ValueSize)
+	if err := df.readFull(data, offset+HeaderSize); err != nil {
+		return nil, err
+	}
+	entry.Key = data[:entry.KeySize:entry.KeySize]
+	entry.Value = data[entry.KeySize:]
+
+	if verify {
+		crc := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, data)
+		if crc != entry.CRC {
+			return nil, ErrCRCMismatch
+		}
+	}
+	return entry, nil
+}
+
+// ==================== 缓冲池 ====================
+//
+// 缓冲池只保存不超过 maxPooledBufferSize 的缓冲区，避免偶尔写入的大 value 长期占用内存。
+// 从池中取出的缓冲区只在 DataFile 内部使用，放回之前不会被返回给调用方。
+
+// maxPooledBufferSize 放回缓冲池的缓冲区的最大容量
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+// getBuffer 取出长度为 size 的缓冲区，内容未初始化
+func getBuffer(size int) *[]byte {
+	if size > maxPooledBufferSize {
+		buf := make([]byte, size)
+		return &buf
+	}
+	buf := bufferPool.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	*buf = (*buf)[:size]
+	return buf
+}
+
+// putBuffer 将缓冲区放回缓冲池，调用方之后不得再使用
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
 }
 
-// Sync 将缓冲区中的数据同步到磁盘
+// crcChunkSize readEntryKey 校验 CRC 时每次读取 value 的字节数
+const crcChunkSize = 64 * 1024
+
+// readEntryKey 只读取 Entry 的头部与 Key，返回的 Entry 中 Value 为 nil
+// verify 为 true 时按 crcChunkSize 分块读取 value 计算 CRC，内存占用与 value 大小无关；
+// 为 false 时直接跳过 value。用于启动引导与 Merge 这类只需要 key 的扫描
+// 参数：
+//   - offset: 读取起始偏移量
+//   - verify: 是否校验 CRC
+//
+// 返回：
+//   - *Entry: 只包含头部与 Key 的 Entry
+//   - error: 读取错误；Entry 超出文件末尾时返回 ErrInvalidEntry，CRC 不匹配时返回 ErrCRCMismatch
+func (df *DataFile) readEntryKey(offset int64, verify bool) (*Entry, error) {
+	header := make([]byte, HeaderSize)
+	if err := df.readFull(header, offset); err != nil {
+		return nil, err
+	}
+	entry, err := DecodeHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先按文件大小检查声明的长度，损坏的头部不会导致按巨大的长度读取
+	if offset+int64(entry.Size()) > df.GetWriteOff() {
+		return nil, ErrInvalidEntry
+	}
+
+	entry.Key = make([]byte, entry.KeySize)
+	if err := df.readFull(entry.Key, offset+HeaderSize); err != nil {
+		return nil, err
+	}
+	if !verify {
+		return entry, nil
+	}
+
+	crc := crc32.ChecksumIEEE(header[4:])
+	crc = crc32.Update(crc, crc32.IEEETable, entry.Key)
+	buf := make([]byte, min(int64(crcChunkSize), int64(entry.ValueSize)))
+	valueOff := offset + HeaderSize + int64(entry.KeySize)
+	for remaining := int64(entry.ValueSize); remaining > 0; {
+		chunk := buf[:min(remaining, int64(len(buf)))]
+		if err := df.readFull(chunk, valueOff); err != nil {
+			return nil, err
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, chunk)
+		valueOff += int64(len(chunk))
+		remaining -= int64(len(chunk))
+	}
+	if crc != entry.CRC {
+		return nil, ErrCRCMismatch
+	}
+	return entry, nil
+}
+
+// readFull 将 offset 处的 len(buf) 个字节读入 buf，数据不足时返回 ErrInvalidEntry
+func (df *DataFile) readFull(buf []byte, offset int64) error {
+	df.mu.RLock()
+	defer df.mu.RUnlock()
+
+	if df.File == nil {
+		return ErrFileClosed
+	}
+	n, err := df.readAt(buf, offset)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return ErrInvalidEntry
+	}
+	return fmt.Errorf("读取数据失败 (offset=%d, size=%d): %w", offset, len(buf), err)
+}
+
+// readAt 从 offset 处读取 len(p) 个字节，语义与 io.ReaderAt 相同
+// 写缓冲中尚未写入文件的部分从缓冲区读取，调用方必须持有 df.mu
+func (df *DataFile) readAt(p []byte, offset int64) (int, error) {
+	flushed := df.WriteOff - int64(len(df.pending))
+	if len(df.pending) == 0 || offset+int64(len(p)) <= flushed {
+		return df.File.ReadAt(p, offset)
+	}
+
+	n := 0
+	if offset < flushed {
+		m, err := df.File.ReadAt(p[:flushed-offset], offset)
+		n = m
+		if m < int(flushed-offset) {
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+	}
+	start := offset + int64(n) - flushed
+	if start >= int64(len(df.pending)) {
+		return n, io.EOF
+	}
+	n += copy(p[n:], df.pending[start:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Sync 将写缓冲与操作系统缓冲区中的数据同步到磁盘
 // 返回：
 //   - error: 同步错误
 func (df *DataFile) Sync() error {
+	if df.bufLimit > 0 {
+		df.mu.Lock()
+		err := df.flush()
+		df.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("写入缓冲的数据失败: %w", err)
+		}
+	}
+
 	df.mu.RLock()
 	defer df.mu.RUnlock()
 
@@ -255,7 +545,10 @@ func (df *DataFile) Close() error {
 		return nil
 	}
 
-	// 同步数据
+	// 写入缓冲的数据并同步
+	if err := df.flush(); err != nil {
+		return fmt.Errorf("关闭前写入缓冲的数据失败: %w", err)
+	}
 	if err := df.File.Sync(); err != nil {
 		return fmt.Errorf("关闭前同步数据失败: %w", err)
 	}
@@ -295,7 +588,7 @@ func (df *DataFile) GetFileID() uint32 {
 // 返回：
 //   - string: 文件路径
 func (df *DataFile) GetFilePath(dir string) string {
-	return filepath.Join(dir, fmt.Sprintf("%08d.data", df.FileID))
+	return filepath.Join(dir, df.Name())
 }
 
 // SetWriteOff 设置写入偏移量
@@ -306,6 +599,24 @@ func (df *DataFile) SetWriteOff(offset int64) {
 	df.mu.Lock()
 	defer df.mu.Unlock()
 	df.WriteOff = offset
+	df.safeOff.Store(offset)
+}
+
+// isPending 判断 offset 处的数据是否还在写缓冲中、尚未写入文件
+func (df *DataFile) isPending(offset int64) bool {
+	df.mu.RLock()
+	defer df.mu.RUnlock()
+	return offset >= df.WriteOff-int64(len(df.pending))
+}
+
+// SafeReadOffset 返回外部跟读（tail）工具可以安全读取到的偏移量
+// 偏移量之前的 Entry 都已完整写入文件：未启用写缓冲时写入返回后内容即对其他读者可见，
+// 启用写缓冲时只计入已从缓冲区写入文件的部分；正在进行中的写入以及回滚失败留下的不完整 Entry 都不计入。
+// 不加锁读取，不会被正在进行的写入阻塞；需要落盘保证时先调用 Sync
+// 返回：
+//   - int64: 可以安全读取到的偏移量
+func (df *DataFile) SafeReadOffset() int64 {
+	return df.safeOff.Load()
 }
 
 // IsClosed 检查文件是否已关闭
@@ -321,5 +632,89 @@ func (df *DataFile) IsClosed() bool {
 // 返回：
 //   - string: 文件名
 func (df *DataFile) Name() string {
-	return fmt.Sprintf("%08d.data", df.FileID)
+	if df.name == "" {
+		return DefaultFileNamer.DataFileName(df.FileID)
+	}
+	return df.name
+}
+
+// validateDataFile 校验数据文件首个 Entry 的头部是否合理
+// 检查 key/value 长度是否不超出文件大小、类型与压缩标志是否可识别、CRC 是否正确。
+// 不按配置的 MaxKeySize / MaxValueSize 校验：它们只限制新写入，调低之后已写入的数据仍然有效
+// 参数：
+//   - path: 文件路径
+//   - opts: 数据库配置（提供文件系统）
+//   - isLast: 是否为最后一个文件（允许因崩溃导致的首个 Entry 不完整）
+//
+// 返回：
+//   - error: 文件无法识别时返回包装了 ErrUnrecognizedFile 的错误
+func validateDataFile(path string, opts *Options, isLast bool) error {
+	file, err := opts.FileSystem.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("打开数据文件失败: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("获取文件状态失败: %w", err)
+	}
+	fileSize := stat.Size()
+
+	// 空文件是合法的（刚创建的活跃文件）
+	if fileSize == 0 {
+		return nil
+	}
+
+	unrecognized := func(reason string) error {
+		return fmt.Errorf("%w: %s (%s)", ErrUnrecognizedFile, path, reason)
+	}
+
+	if fileSize < HeaderSize {
+		if isLast {
+			return nil
+		}
+		return unrecognized("文件小于 Entry 头部大小")
+	}
+
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("读取文件头部失败: %w", err)
+	}
+
+	h, err := DecodeHeader(header)
+	if err != nil {
+		return unrecognized("无法解析 Entry 头部")
+	}
+	keySize, valueSize := h.KeySize, h.ValueSize
+
+	if keySize == 0 {
+		return unrecognized("key 长度为 0")
+	}
+	if h.Flags > CompressionZSTD {
+		return unrecognized(fmt.Sprintf("未知的压缩标志 %d", h.Flags))
+	}
+	if !h.Type.inDataFile() {
+		return unrecognized(fmt.Sprintf("未知的 Entry 类型 %d", h.Type))
+	}
+
+	totalSize := int64(HeaderSize) + int64(keySize) + int64(valueSize)
+	if totalSize > fileSize {
+		// 活跃文件的首个 Entry 可能因崩溃只写入了一部分
+		if isLast {
+			return nil
+		}
+		return unrecognized("首个 Entry 超出文件大小")
+	}
+
+	data := make([]byte, totalSize)
+	copy(data, header)
+	if _, err := io.ReadFull(file, data[HeaderSize:]); err != nil {
+		return fmt.Errorf("读取首个 Entry 失败: %w", err)
+	}
+	if crc32.ChecksumIEEE(data[4:]) != binary.LittleEndian.Uint32(data[0:4]) {
+		return unrecognized("首个 Entry 的 CRC 校验失败")
+	}
+
+	return nil
 }
@@ -1,13 +1,14 @@
 package bitcask
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/forever-free1/TideKV/storage"
 	"github.com/forever-free1/TideKV/storage/index"
@@ -16,20 +17,46 @@ import (
 // DB 表示 Bitcask 存储引擎的核心结构体
 // 封装了数据文件管理、内存索引和配置选项
 type DB struct {
-	dir          string                  // 数据目录
-	activeFile   *DataFile               // 当前活跃的数据文件
-	olderFiles   map[uint32]*DataFile   // 历史数据文件集合
-	index        index.Index            // 内存索引（支持 Map 或 ART）
-	bloomFilter  *index.BloomFilter     // 布隆过滤器，用于快速判断 key 是否存在
-	options      *Options               // 配置选项
-	mu           sync.RWMutex           // 写锁，保证写入顺序
-	fileID       uint32                 // 当前文件 ID
+	dir            string                      // 数据目录
+	activeFile     *DataFile                   // 当前活跃的数据文件
+	olderFiles     map[uint32]*DataFile        // 历史数据文件集合
+	index          index.Index                 // 内存索引（支持 Map、ART 或混合索引）
+	bloomFilter    *index.BloomFilter          // 布隆过滤器，用于快速判断 key 是否存在
+	keyEstimator   *index.HyperLogLog          // 估算不同 key 的数量，打开时从索引重建
+	options        *Options                    // 配置选项
+	mu             sync.RWMutex                // 写锁，保证写入顺序
+	fileID         uint32                      // 最近一次分配的文件 ID（活跃文件或 Merge 输出文件）
+	seq            uint64                      // 最近一次分配的写入序号
+	appendSeq      uint64                      // 追加写入计数器，最近一次分配的追加写入序号，见 append.go
+	activeKeyLog   *KeyLog                     // 活跃文件对应的 Key-Log（未启用时为 nil）
+	activeEntries  int                         // 活跃文件中的 Entry 数量
+	suffixIndex    index.Index                 // 后缀索引：以反转后的 key 为键的二级索引（未启用时为 nil）
+	mirror         *mirror                     // 镜像目录的异步写入器（未启用时为 nil）
+	freeBytes      uint64                      // 缓存的磁盘可用空间，扣除了此后写入的字节数
+	freeCheckedAt  time.Time                   // freeBytes 的查询时间
+	quarantine     map[string]QuarantinedEntry // 因 CRC 校验失败被移出索引的 key（CorruptionQuarantineKey）
+	valueCache     *valueCache                 // Get 的 Value 缓存（未启用时为 nil）
+	merging        bool                        // 正在执行 Merge，期间不调度后台合并
+	mergeMu        sync.Mutex                  // 保证同一时间只执行一个 Merge，Merge 重写期间不持有写锁
+	mergeBroken    error                       // Merge 提交之后发布失败的原因，重新打开之前不再执行 Merge
+	closed         bool                        // 已关闭，后台合并不再执行
+	autoMerge      autoMergeState              // 按文件数量触发的后台合并
+	secondary      map[string]*secondaryIndex  // 二级索引，按名称索引
+	accessTimes    *accessTracker              // 每个 key 最近一次被读取的时间（未启用时为 nil）
+	negCache       *negativeCache              // 最近确认不存在的 key（未启用时为 nil）
+	resolved       map[string]*Entry           // 启动引导中由 ConflictResolver 得到、尚未写回的合并结果
+	bootTombstones map[string]uint64           // 启动引导中见到的墓碑：key → 最大的墓碑序号，启动引导结束后清空
+	recent         *recentWrites               // 写缓冲中尚未写入文件的 value（未启用写缓冲时为 nil）
+	indexType      IndexType                   // 当前使用的索引类型，IndexTypeAuto 迁移之后随之改变
 }
 
+// freeSpaceCacheTTL 磁盘可用空间查询结果的缓存时长，避免每次写入都调用 statfs
+const freeSpaceCacheTTL = time.Second
+
 // Options 定义 DB 的配置选项
 type Options struct {
 	// DataFileSizeLimit 单个数据文件的大小限制（字节）
-	// 超过限制时创建新文件
+	// 超过限制时创建新文件；不能小于 MinDataFileSizeLimit，否则 Open 返回 ErrInvalidOptions
 	DataFileSizeLimit int64
 
 	// IndexType 索引类型：true 使用 ART (Adaptive Radix Tree)，false 使用 Map
@@ -37,11 +64,149 @@ type Options struct {
 	// 默认使用 Map 索引
 	IndexType IndexType
 
+	// AutoIndexThreshold IndexTypeAuto 从 Map 索引迁移的 key 数量阈值，0 表示 DefaultAutoIndexThreshold
+	AutoIndexThreshold int
+
+	// AutoIndexTarget IndexTypeAuto 迁移的目标索引类型：IndexTypeART（默认）或 IndexTypeHybrid
+	AutoIndexTarget IndexType
+
 	// BloomFilterFP 布隆过滤器的期望误判率
 	// 值越小，需要的内存越多
 	BloomFilterFP float64
+
+	// BloomKeyHash key 进入布隆过滤器之前的预哈希函数，为 nil 表示不预哈希
+	BloomKeyHash index.BloomKeyHash
+
+	// MaxKeySize 单个 key 的最大长度（字节）
+	// 只限制新写入，调低之后已写入的数据仍可读取
+	MaxKeySize uint32
+
+	// MaxValueSize 单个 value 的最大长度（字节）
+	// 只限制新写入，调低之后已写入的数据仍可读取
+	MaxValueSize uint32
+
+	// ValidateHeaders 打开时是否校验每个数据文件首个 Entry 的头部
+	// 用于尽早发现目录中混入的非 TideKV 文件或不兼容的格式版本
+	ValidateHeaders bool
+
+	// KeyLog 是否为每个数据文件维护独立的 Key-Log
+	// 启用后 Merge 与启动时的索引重建只需读取 key，不再读取 value，
+	// 适合写多、value 较大的场景
+	KeyLog bool
+
+	// RotateMinEntries 轮转前活跃文件至少需要包含的 Entry 数量
+	// 文件超过 DataFileSizeLimit 后，只有 Entry 数与字节数都达到下限才会轮转，
+	// 避免突发的大 value 写入产生大量小文件。0 表示不限制
+	RotateMinEntries int
+
+	// RotateMinBytes 轮转前活跃文件至少需要达到的字节数，可大于 DataFileSizeLimit。0 表示不限制
+	RotateMinBytes int64
+
+	// MergeSkipCRC Merge 读取源文件时是否跳过 CRC 校验
+	// 源数据在写入和打开时已经校验过，跳过可以显著减少 Merge 的 CPU 开销；
+	// 重写的 Entry 仍会重新计算 CRC。默认关闭
+	MergeSkipCRC bool
+
+	// MergeFileCountTrigger 旧文件数量超过该值时，轮转后在后台自动执行 Merge
+	// 与回收空间不同，这一触发条件关注的是文件数量：文件过多会拖慢启动、占用更多文件句柄。
+	// 配合 MergeFileSizeLimit 将小文件合并为更少、更大的文件。0 表示不启用
+	// 注意：后台合并与 Merge 一样只在开始与发布时短暂持有写锁，但重写存活数据会占用磁盘带宽，
+	// 耗时与存活数据量成正比；对延迟敏感的场景应配合 MergeWindows 限定在低峰时段
+	MergeFileCountTrigger int
+
+	// MergeFileSizeLimit Merge 输出文件的大小限制（字节），0 表示与 DataFileSizeLimit 相同
+	MergeFileSizeLimit int64
+
+	// MergeWindows 允许后台合并的时间段，窗口外触发的合并推迟到下一个窗口开始，为空时不限制，见 mergewindow.go
+	MergeWindows []MergeWindow
+
+	// MergeEmergencyFreeBytes 磁盘可用空间低于该值时后台合并不受 MergeWindows 限制，0 表示不启用
+	MergeEmergencyFreeBytes uint64
+
+	// Retention 全局数据保留时长，Merge 时丢弃最新版本早于该时长的 key
+	// 与单 key 的 TTL 不同，过期数据只在 Merge 时清理，清理前仍可读取。0 表示永久保留
+	Retention time.Duration
+
+	// FileSystem 所有文件操作使用的文件系统，默认为操作系统文件系统
+	FileSystem FileSystem
+
+	// BootstrapWorkers 启动时并行扫描旧文件的 worker 数量，不大于 1 时按顺序扫描
+	BootstrapWorkers int
+
+	// BootstrapCheckpointInterval 启动引导每扫描多少个旧文件写入一次检查点，0 表示不使用检查点
+	// 重新打开时从检查点恢复索引，只扫描检查点之后的文件，见 checkpoint.go
+	BootstrapCheckpointInterval int
+
+	// ConflictResolver 启动引导中同一个 key 出现多个版本时决定保留哪一个，nil 表示最后写入者胜出
+	// 配置后按顺序扫描全部文件，忽略 BootstrapWorkers 与 BootstrapCheckpointInterval，见 resolver.go
+	ConflictResolver ConflictResolver
+
+	// ValidateBloomFilter 打开时是否校验布隆过滤器与索引的一致性
+	// 需要遍历全部 key；发现索引中的 key 未通过布隆过滤器时从索引重建过滤器。默认关闭
+	ValidateBloomFilter bool
+
+	// SuffixIndex 是否维护后缀索引以支持 ScanSuffix
+	// 额外保存一份反转后的 key，索引内存约翻倍。默认关闭
+	SuffixIndex bool
+
+	// MinFreeBytes 写入后磁盘至少需要保留的可用空间（字节），不足时拒绝写入并返回 ErrInsufficientSpace
+	// 删除与 Merge 不受限制，以便释放空间。需要 FileSystem 实现 SpaceReporter。0 表示不检查
+	// 注意：检查在本地执行，作为 Raft 状态机使用时各副本的结果可能不同
+	MinFreeBytes uint64
+
+	// MirrorDir 镜像目录，非空时每个成功写入的 Entry 都会异步追加到该目录
+	// 尽力而为：队列已满或写入失败时镜像会落后于主目录，可通过 MirrorStats 查看
+	MirrorDir string
+
+	// OversizedEntryPolicy 超过 DataFileSizeLimit 的单个 Entry 的处理策略
+	// 默认让其独占一个数据文件
+	OversizedEntryPolicy OversizedEntryPolicy
+
+	// CorruptionPolicy Get 读到 CRC 校验失败的 Entry 时的处理策略
+	// 默认返回错误（ErrCRCMismatch）
+	CorruptionPolicy CorruptionPolicy
+
+	// ReuseBuffers 是否复用编码与读取头部使用的缓冲区，降低高写入速率下的 GC 压力
+	// 返回给调用方的 Key 与 Value 不引用被复用的缓冲区。默认关闭
+	ReuseBuffers bool
+
+	// WriteBufferSize 活跃文件写缓冲的大小（字节），0 表示每次写入直接写入文件（默认）
+	// 缓冲的数据在 Sync、轮转与关闭时写入文件，进程崩溃时丢失；不能与 KeyLog 同时启用
+	WriteBufferSize int
+
+	// TrackAccess 是否记录每个 key 最近一次被读取的时间，供 LastAccess 使用
+	// 每次 Get 都要加锁更新时间戳，并为每个被读取的 key 占用内存。默认关闭
+	TrackAccess bool
+
+	// WriteTimeout 写入（Put、Delete、PutIfVersion、Append、ReplacePrefix、PutAll 等）等待写锁的最长时间，
+	// 超时返回 ErrWriteTimeout，0 表示一直等待
+	// 用于给延迟敏感的调用方一个上限，例如轮转或长时间同步期间不被无限阻塞
+	WriteTimeout time.Duration
+
+	// NegativeCacheSize 负缓存最多记录多少个最近确认不存在的 key，0 表示不启用
+	// 删除不会更新布隆过滤器，被删除的 key 仍能通过过滤器；负缓存让重复读取这些 key 时跳过索引查询
+	NegativeCacheSize int
+
+	// SecondaryIndexes 打开时构建的二级索引，键为索引名称，见 WithSecondaryIndex
+	SecondaryIndexes map[string]SecondaryExtractor
+
+	// ValueCache 按 value 大小分类的 Get 缓存，各分类容量独立。默认不启用
+	ValueCache ValueCacheConfig
+
+	// FileNamer 数据文件的命名规则，默认为 "%08d.data"
+	FileNamer FileNamer
 }
 
+// OversizedEntryPolicy 定义超过单文件大小限制的 Entry 的处理策略
+type OversizedEntryPolicy int
+
+const (
+	// OversizedDedicatedFile 超大 Entry 独占一个数据文件（默认）
+	OversizedDedicatedFile OversizedEntryPolicy = iota
+	// OversizedReject 拒绝写入超大 Entry，返回 ErrEntryTooLarge
+	OversizedReject
+)
+
 // IndexType 定义索引类型
 type IndexType int
 
@@ -50,12 +215,16 @@ const (
 	IndexTypeMap IndexType = iota
 	// IndexTypeART 使用自适应基数树作为索引
 	IndexTypeART
+	// IndexTypeHybrid 使用 Hot / Warm / Cold 三层混合索引
+	IndexTypeHybrid
+	// IndexTypeAuto 先使用 Map 索引，key 数量达到 AutoIndexThreshold 时迁移到 AutoIndexTarget
+	IndexTypeAuto
 )
 
 // Option 定义 Options 的配置函数
 type Option func(*Options)
 
-// WithDataFileSizeLimit 设置单文件大小限制
+// WithDataFileSizeLimit 设置单文件大小限制，不能小于 MinDataFileSizeLimit
 func WithDataFileSizeLimit(limit int64) Option {
 	return func(o *Options) {
 		o.DataFileSizeLimit = limit
@@ -76,6 +245,187 @@ func WithBloomFilterFP(fp float64) Option {
 	}
 }
 
+// WithBloomKeyHash 设置 key 进入布隆过滤器之前的预哈希函数，例如 index.XXHashBloomKey
+// 适合共享长前缀的 key。预哈希的过滤器持久化到单独的文件（bloom.prehash.filter），
+// 启用或关闭预哈希后不会加载另一种方式的过滤器；启动引导会重新添加全部 key，过滤器始终完整
+func WithBloomKeyHash(hash index.BloomKeyHash) Option {
+	return func(o *Options) {
+		o.BloomKeyHash = hash
+	}
+}
+
+// WithMaxKeySize 设置单个 key 的最大长度
+func WithMaxKeySize(size uint32) Option {
+	return func(o *Options) {
+		o.MaxKeySize = size
+	}
+}
+
+// WithMaxValueSize 设置单个 value 的最大长度
+func WithMaxValueSize(size uint32) Option {
+	return func(o *Options) {
+		o.MaxValueSize = size
+	}
+}
+
+// WithHeaderValidation 设置打开时是否校验数据文件头部
+func WithHeaderValidation(enabled bool) Option {
+	return func(o *Options) {
+		o.ValidateHeaders = enabled
+	}
+}
+
+// WithKeyLog 设置是否启用 Key-Log
+func WithKeyLog(enabled bool) Option {
+	return func(o *Options) {
+		o.KeyLog = enabled
+	}
+}
+
+// WithRotateMinEntries 设置轮转前活跃文件的最少 Entry 数
+func WithRotateMinEntries(n int) Option {
+	return func(o *Options) {
+		o.RotateMinEntries = n
+	}
+}
+
+// WithRotateMinBytes 设置轮转前活跃文件的最少字节数
+func WithRotateMinBytes(n int64) Option {
+	return func(o *Options) {
+		o.RotateMinBytes = n
+	}
+}
+
+// WithMergeSkipCRC 设置 Merge 读取源文件时是否跳过 CRC 校验
+func WithMergeSkipCRC(skip bool) Option {
+	return func(o *Options) {
+		o.MergeSkipCRC = skip
+	}
+}
+
+// WithMergeFileCountTrigger 设置自动触发 Merge 的旧文件数量，0 表示不启用
+func WithMergeFileCountTrigger(n int) Option {
+	return func(o *Options) {
+		o.MergeFileCountTrigger = n
+	}
+}
+
+// WithMergeFileSizeLimit 设置 Merge 输出文件的大小限制（字节）
+func WithMergeFileSizeLimit(limit int64) Option {
+	return func(o *Options) {
+		o.MergeFileSizeLimit = limit
+	}
+}
+
+// WithReuseBuffers 设置是否复用编码与读取使用的缓冲区
+func WithReuseBuffers(enabled bool) Option {
+	return func(o *Options) {
+		o.ReuseBuffers = enabled
+	}
+}
+
+// WithRetention 设置全局数据保留时长，Merge 时丢弃超出保留时长的 key
+func WithRetention(d time.Duration) Option {
+	return func(o *Options) {
+		o.Retention = d
+	}
+}
+
+// WithMinFreeBytes 设置写入后磁盘至少需要保留的可用空间（字节）
+func WithMinFreeBytes(n uint64) Option {
+	return func(o *Options) {
+		o.MinFreeBytes = n
+	}
+}
+
+// WithMirror 设置镜像目录，每个写入都会异步追加到该目录，用于简单的容灾
+func WithMirror(dir string) Option {
+	return func(o *Options) {
+		o.MirrorDir = dir
+	}
+}
+
+// WithFileSystem 设置文件系统（例如测试中使用 NewMemFileSystem）
+func WithFileSystem(fsys FileSystem) Option {
+	return func(o *Options) {
+		o.FileSystem = fsys
+	}
+}
+
+// WithBootstrapWorkers 设置启动时并行扫描旧文件的 worker 数量
+func WithBootstrapWorkers(n int) Option {
+	return func(o *Options) {
+		o.BootstrapWorkers = n
+	}
+}
+
+// WithBootstrapCheckpoint 设置启动引导每扫描多少个旧文件写入一次检查点，interval <= 0 表示不使用检查点
+func WithBootstrapCheckpoint(interval int) Option {
+	return func(o *Options) {
+		o.BootstrapCheckpointInterval = interval
+	}
+}
+
+// WithWriteTimeout 设置写入等待写锁的最长时间，d <= 0 表示一直等待
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.WriteTimeout = d
+	}
+}
+
+// WithBloomFilterValidation 设置打开时是否校验并修复布隆过滤器
+func WithBloomFilterValidation(enabled bool) Option {
+	return func(o *Options) {
+		o.ValidateBloomFilter = enabled
+	}
+}
+
+// WithSuffixIndex 设置是否启用后缀索引
+func WithSuffixIndex(enabled bool) Option {
+	return func(o *Options) {
+		o.SuffixIndex = enabled
+	}
+}
+
+// WithCorruptionPolicy 设置 Get 读到损坏 Entry 时的处理策略
+func WithCorruptionPolicy(policy CorruptionPolicy) Option {
+	return func(o *Options) {
+		o.CorruptionPolicy = policy
+	}
+}
+
+// WithOversizedEntryPolicy 设置超过单文件大小限制的 Entry 的处理策略
+func WithOversizedEntryPolicy(policy OversizedEntryPolicy) Option {
+	return func(o *Options) {
+		o.OversizedEntryPolicy = policy
+	}
+}
+
+// MinDataFileSizeLimit 数据文件大小限制的最小值：至少能容纳一个空 Entry 的头部
+// 更小的限制（包括 0 与负数）会让每次写入都超限并轮转出一个新文件
+const MinDataFileSizeLimit = HeaderSize
+
+// validate 检查配置选项是否合法
+// 返回：
+//   - error: 不合法时返回包装了 ErrInvalidOptions 的错误
+func (o *Options) validate() error {
+	if o.DataFileSizeLimit < MinDataFileSizeLimit {
+		return fmt.Errorf("%w: DataFileSizeLimit 不能小于 %d 字节，实际为 %d", ErrInvalidOptions, MinDataFileSizeLimit, o.DataFileSizeLimit)
+	}
+	// MergeFileSizeLimit 为 0 表示与 DataFileSizeLimit 相同
+	if o.MergeFileSizeLimit != 0 && o.MergeFileSizeLimit < MinDataFileSizeLimit {
+		return fmt.Errorf("%w: MergeFileSizeLimit 不能小于 %d 字节，实际为 %d", ErrInvalidOptions, MinDataFileSizeLimit, o.MergeFileSizeLimit)
+	}
+	if o.WriteBufferSize < 0 {
+		return fmt.Errorf("%w: WriteBufferSize 不能为负数，实际为 %d", ErrInvalidOptions, o.WriteBufferSize)
+	}
+	// Key-Log 直接写入文件，会领先于缓冲中的数据
+	if o.WriteBufferSize > 0 && o.KeyLog {
+		return fmt.Errorf("%w: WriteBufferSize 不能与 KeyLog 同时启用", ErrInvalidOptions)
+	}
+	return o.validateAutoIndex()
+}
+
 // Open 打开或创建一个 Bitcask 数据库
 // 参数：
 //   - dir: 数据库目录
@@ -88,54 +438,134 @@ func Open(dir string, opts ...Option) (*DB, error) {
 	// 应用配置选项
 	options := &Options{
 		DataFileSizeLimit: 64 * 1024 * 1024, // 默认 64MB
-		IndexType:        IndexTypeART,       // 默认使用 ART 索引
-		BloomFilterFP:   0.01,               // 默认 1% 误判率
+		IndexType:         IndexTypeART,     // 默认使用 ART 索引
+		BloomFilterFP:     0.01,             // 默认 1% 误判率
+		MaxKeySize:        64 * 1024,        // 默认 64KB
+		MaxValueSize:      64 * 1024 * 1024, // 默认 64MB
+		ValidateHeaders:   true,             // 默认校验文件头部
+		FileSystem:        OSFileSystem,     // 默认使用操作系统文件系统
+		FileNamer:         DefaultFileNamer, // 默认文件名 "%08d.data"
 	}
 	for _, opt := range opts {
 		opt(options)
 	}
+	if options.FileNamer == nil {
+		options.FileNamer = DefaultFileNamer
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
 
 	// 创建索引实例
 	var idx index.Index
-	switch options.IndexType {
+	indexType := options.IndexType
+	switch indexType {
 	case IndexTypeART:
 		idx = index.NewARTIndex()
+	case IndexTypeHybrid:
+		idx = index.NewHybridIndex()
 	default:
+		// IndexTypeAuto 先使用 Map 索引
 		idx = index.NewMapIndex()
+		indexType = IndexTypeMap
 	}
 
 	// 创建布隆过滤器
 	// 初始容量设置为 1000000，预估最多存储 100 万个 key
-	bloomFilter := index.NewBloomFilter(1000000, options.BloomFilterFP)
-
-	// 尝试从文件加载已存在的布隆过滤器
-	if loaded, err := bloomFilter.Load(dir, 1000000, options.BloomFilterFP); err != nil {
-		return nil, fmt.Errorf("加载布隆过滤器失败: %w", err)
-	} else if !loaded {
-		// 没有已存在的布隆过滤器文件，保持新创建的布隆过滤器
-		// 注释说明：布隆过滤器会在 bootstrap 过程中重建
+	var bloomOpts []index.BloomOption
+	if options.BloomKeyHash != nil {
+		bloomOpts = append(bloomOpts, index.WithBloomKeyHash(options.BloomKeyHash))
 	}
+	bloomFilter := index.NewBloomFilter(1000000, options.BloomFilterFP, bloomOpts...)
 
 	// 创建数据库实例
 	db := &DB{
-		dir:         dir,
-		olderFiles:  make(map[uint32]*DataFile),
-		index:       idx,
-		bloomFilter: bloomFilter,
-		options:     options,
-		fileID:      0,
+		dir:          dir,
+		olderFiles:   make(map[uint32]*DataFile),
+		index:        idx,
+		bloomFilter:  bloomFilter,
+		keyEstimator: index.NewHyperLogLog(index.DefaultHLLPrecision),
+		options:      options,
+		fileID:       0,
+		indexType:    indexType,
+	}
+	if options.SuffixIndex {
+		db.suffixIndex = index.NewARTIndex()
+	}
+	if options.ValueCache.enabled() {
+		db.valueCache = newValueCache(options.ValueCache)
+	}
+	if options.TrackAccess {
+		db.accessTimes = newAccessTracker()
+	}
+	if options.NegativeCacheSize > 0 {
+		db.negCache = newNegativeCache(options.NegativeCacheSize)
+	}
+	if options.WriteBufferSize > 0 {
+		db.recent = newRecentWrites()
 	}
 
 	// 确保目录存在
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := options.FileSystem.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
 	}
 
+	// 把旧格式的数据文件升级为当前格式，之后的流程只处理当前格式
+	if err := db.upgradeFormat(); err != nil {
+		return nil, fmt.Errorf("升级数据格式失败: %w", err)
+	}
+
+	// 尝试从文件加载已存在的布隆过滤器
+	// 没有已存在的布隆过滤器文件时保持新创建的布隆过滤器，它会在 bootstrap 过程中重建
+	if err := db.loadBloomFilter(); err != nil {
+		return nil, fmt.Errorf("加载布隆过滤器失败: %w", err)
+	}
+
+	// 完成已提交的 Merge，删除未发布的 Merge 临时文件
+	if err := db.recoverMerge(); err != nil {
+		return nil, fmt.Errorf("恢复 Merge 失败: %w", err)
+	}
+
 	// Bootstrapping：加载或创建数据文件
 	if err := db.bootstrap(); err != nil {
 		return nil, fmt.Errorf("启动引导失败: %w", err)
 	}
 
+	// 重放上次崩溃时未完成的意图日志
+	if err := db.recoverIntent(); err != nil {
+		return nil, fmt.Errorf("恢复意图日志失败: %w", err)
+	}
+
+	// 启动引导已从数据中恢复追加写入计数器，Merge 可能丢弃了更大的值
+	if err := db.loadAppendSeq(); err != nil {
+		return nil, err
+	}
+
+	// 打开时 key 数量已经达到阈值时直接迁移索引
+	db.maybeMigrateIndex()
+
+	// 启动引导会读到之后被删除的 key，从最终的索引重建 key 数量估算
+	db.rebuildKeyEstimator()
+
+	// 二级索引只保存在内存中，从数据重建
+	if err := db.buildSecondaryIndexes(); err != nil {
+		return nil, err
+	}
+
+	// 确保索引中的每个 key 都能通过布隆过滤器，否则有效的 Get 会被误判为不存在
+	if options.ValidateBloomFilter {
+		db.repairBloomFilter()
+	}
+
+	// 镜像只接收打开之后的写入
+	if options.MirrorDir != "" {
+		m, err := openMirror(options.MirrorDir, options)
+		if err != nil {
+			return nil, fmt.Errorf("打开镜像目录失败: %w", err)
+		}
+		db.mirror = m
+	}
+
 	return db, nil
 }
 
@@ -151,7 +581,7 @@ func Open(dir string, opts ...Option) (*DB, error) {
 // 这样在系统重启后，布隆过滤器会被重建，可以继续用于优化查询不存在的 key
 func (db *DB) bootstrap() error {
 	// 读取目录中的所有数据文件
-	files, err := os.ReadDir(db.dir)
+	files, err := db.options.FileSystem.ReadDir(db.dir)
 	if err != nil {
 		return fmt.Errorf("读取目录失败: %w", err)
 	}
@@ -159,24 +589,23 @@ func (db *DB) bootstrap() error {
 	// 收集所有数据文件 ID
 	var fileIDs []uint32
 	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".data") {
-			idStr := strings.TrimSuffix(f.Name(), ".data")
-			var id uint32
-			if _, err := fmt.Sscanf(idStr, "%d", &id); err == nil {
-				fileIDs = append(fileIDs, id)
-			}
+		if f.IsDir() {
+			continue
+		}
+		if id, ok := db.options.FileNamer.ParseDataFileName(f.Name()); ok {
+			fileIDs = append(fileIDs, id)
 		}
 	}
 
 	// 如果没有数据文件，创建第一个活跃文件
 	if len(fileIDs) == 0 {
 		db.fileID = 0
-		activeFile, err := OpenDataFile(db.dir, db.fileID)
+		activeFile, err := db.openFile(db.fileID)
 		if err != nil {
 			return fmt.Errorf("创建活跃数据文件失败: %w", err)
 		}
 		db.activeFile = activeFile
-		return nil
+		return db.openActiveKeyLog()
 	}
 
 	// 按文件 ID 排序
@@ -184,71 +613,152 @@ func (db *DB) bootstrap() error {
 		return fileIDs[i] < fileIDs[j]
 	})
 
-	// 遍历所有数据文件，构建索引
+	// 在打开任何文件之前校验头部，避免把无关文件当作数据解析
+	if db.options.ValidateHeaders {
+		for i, fileID := range fileIDs {
+			isLast := i == len(fileIDs)-1
+			if err := validateDataFile(db.GetFilePath(fileID), db.options, isLast); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 打开所有数据文件，最后一个文件是当前活跃文件
+	olderFiles := make([]*DataFile, 0, len(fileIDs)-1)
 	for i, fileID := range fileIDs {
-		// 打开数据文件
-		dataFile, err := OpenDataFile(db.dir, fileID)
+		dataFile, err := db.openFile(fileID)
 		if err != nil {
 			return fmt.Errorf("打开数据文件 %d 失败: %w", fileID, err)
 		}
 
 		if i == len(fileIDs)-1 {
-			// 最后一个文件是当前活跃文件
 			db.activeFile = dataFile
 			db.fileID = fileID
 		} else {
-			// 旧文件
 			db.olderFiles[fileID] = dataFile
+			olderFiles = append(olderFiles, dataFile)
 		}
+	}
 
-		// 遍历文件中的所有 Entry，构建索引
-		var offset int64 = 0
-		for {
-			entry, err := dataFile.ReadEntry(offset)
-			if err != nil {
-				if err == io.EOF {
-					// 读取完成
-					break
-				}
-				// 如果读取出错（可能是损坏的 Entry），跳过继续
-				// 计算下一个可能的 Entry 位置
-				// 这里简单处理：每次跳过 20 字节尝试读取下一个
-				offset += 20
-				if offset >= dataFile.GetWriteOff() {
-					break
-				}
-				continue
-			}
-
-			// 构建位置信息
-			pos := &storage.Position{
-				FileID: fileID,
-				Offset: offset,
-				Size:   entry.Size(),
-			}
-
-			// 写入索引
-			db.index.Put(entry.Key, pos)
-
-			// 【关键】重建布隆过滤器：将 Key 加入布隆过滤器
-			// 这样在系统重启后，布隆过滤器会被恢复到之前的状态
-			db.bloomFilter.Add(entry.Key)
+	// 构建旧文件的索引
+	if err := db.indexOlderFiles(olderFiles); err != nil {
+		return err
+	}
 
-			// 移动到下一个 Entry
-			offset += int64(entry.Size())
+	// 最后构建活跃文件的索引
+	records, err := db.fileRecords(db.activeFile)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := db.indexBootRecord(rec); err != nil {
+			return err
 		}
 	}
+	db.activeEntries = len(records)
+	db.rebuildBloomAfterTombstones()
 
 	// 如果活跃文件为空，从下一个 ID 开始
 	if db.activeFile.GetWriteOff() == 0 {
 		db.fileID = fileIDs[len(fileIDs)-1] + 1
-		newFile, err := OpenDataFile(db.dir, db.fileID)
+		newFile, err := db.openFile(db.fileID)
 		if err != nil {
 			return fmt.Errorf("创建新的活跃数据文件失败: %w", err)
 		}
 		db.activeFile = newFile
 	}
 
+	if err := db.openActiveKeyLog(); err != nil {
+		return err
+	}
+	return db.writeResolved()
+}
+
+// indexRecord 在启动引导过程中将一条记录应用到索引
+// 普通记录写入索引和布隆过滤器，墓碑记录从索引中删除之前写入的 key。
+// 记录通常按序号递增的顺序到达；序号小于已见到的最大序号时按序号决定墓碑与普通记录的先后，
+// 而不是按所在文件的顺序
+func (db *DB) indexRecord(key []byte, typ EntryType, seq uint64, pos *storage.Position) {
+	newest := seq > db.seq
+	if newest {
+		db.seq = seq
+	}
+	db.observeAppendKey(key)
+
+	if typ == EntryTypeTombstone {
+		if db.bootTombstones == nil {
+			db.bootTombstones = make(map[string]uint64)
+		}
+		if seq > db.bootTombstones[string(key)] {
+			db.bootTombstones[string(key)] = seq
+		}
+		// 乱序到达的墓碑不能删除比它更新的版本
+		if !newest {
+			if current, err := db.currentSeq(key); err == nil && current > seq {
+				return
+			}
+		}
+		db.index.Delete(key)
+		db.suffixDelete(key)
+		return
+	}
+
+	// 乱序到达的普通记录已被更新的墓碑删除
+	if !newest && seq < db.bootTombstones[string(key)] {
+		return
+	}
+
+	db.index.Put(key, pos)
+	db.suffixAdd(key)
+	db.bloomFilter.Add(key)
+}
+
+// rebuildBloomAfterTombstones 启动引导见到墓碑时从最终的索引重建布隆过滤器
+// 加载的过滤器以及启动引导中途加入的 key 可能包含之后被删除的 key，重建后过滤器只包含存活的 key
+func (db *DB) rebuildBloomAfterTombstones() {
+	if len(db.bootTombstones) == 0 {
+		return
+	}
+	db.bootTombstones = nil
+
+	db.bloomFilter.Reset()
+	iter := db.index.Seek(nil)
+	defer iter.Close()
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		db.bloomFilter.Add(key)
+		iter.Next()
+	}
+}
+
+// openFile 按数据库的文件系统、命名规则与缓冲区选项打开或创建数据文件
+func (db *DB) openFile(fileID uint32) (*DataFile, error) {
+	dataFile, err := openDataFile(db.options.FileSystem, db.options.FileNamer, db.dir, fileID)
+	if err != nil {
+		return nil, err
+	}
+	dataFile.reuseBuffers = db.options.ReuseBuffers
+	if db.recent != nil {
+		dataFile.bufLimit = db.options.WriteBufferSize
+		dataFile.onFlush = db.recent.dropFile
+	}
+	return dataFile, nil
+}
+
+// openActiveKeyLog 为当前活跃文件打开 Key-Log（未启用时不做任何事）
+func (db *DB) openActiveKeyLog() error {
+	if !db.options.KeyLog {
+		return nil
+	}
+	if db.activeKeyLog != nil {
+		if err := db.activeKeyLog.Close(); err != nil {
+			return err
+		}
+	}
+	kl, err := openKeyLog(db.options.FileSystem, keyLogPath(db.activeFile.GetFilePath(db.dir)), db.activeFile.GetFileID())
+	if err != nil {
+		return err
+	}
+	db.activeKeyLog = kl
 	return nil
 }
 
@@ -259,49 +769,339 @@ func (db *DB) bootstrap() error {
 // 返回：
 //   - error: 写入错误
 func (db *DB) Put(key []byte, value []byte) error {
+	return db.PutAt(key, value, 0)
+}
+
+// PutAt 以指定的版本号写入键值对，版本号作为 Entry 的写入序号持久化，见 storage.VersionedStore
+// 版本号可以小于已分配的最大序号（例如 Raft 重启后重放日志），之后的写入仍从最大序号继续分配
+// 参数：
+//   - key: 键
+//   - value: 值
+//   - version: 版本号，0 表示由 DB 分配
+//
+// 返回：
+//   - error: 写入错误
+func (db *DB) PutAt(key []byte, value []byte, version uint64) error {
 	// 加写锁，保证写入顺序
-	db.mu.Lock()
+	if err := db.lockForWrite(); err != nil {
+		return err
+	}
 	defer db.mu.Unlock()
 
+	entry := NewEntry(key, value)
+	entry.Seq = version
+	return db.applyEntry(entry)
+}
+
+// lockForWrite 获取写锁，未设置 WriteTimeout 时一直等待；所有写入都通过它加锁
+// 设置了 WriteTimeout 时由一个 goroutine 调用 Lock 排队等待：排队中的写者会阻止新的读者加锁，
+// 持续有读者时也能在现有读者释放后拿到锁；超时后放弃，goroutine 之后拿到锁时立即释放
+// 返回：
+//   - error: 超时未获取到写锁时返回 ErrWriteTimeout，此时调用方不持有锁
+func (db *DB) lockForWrite() error {
+	timeout := db.options.WriteTimeout
+	if timeout <= 0 {
+		db.mu.Lock()
+		return nil
+	}
+	if db.mu.TryLock() {
+		return nil
+	}
+
+	locked := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		db.mu.Lock()
+		select {
+		case locked <- struct{}{}:
+			// 锁的所有权交给调用方
+		case <-abandoned:
+			db.mu.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-locked:
+		return nil
+	case <-timer.C:
+		close(abandoned)
+		return ErrWriteTimeout
+	}
+}
+
+// PutIfVersion 仅当 key 当前的写入序号等于 expectedSeq 时写入
+// 写入序号在 Merge 后保持不变，可以作为 key 的版本号（类似 ETag）使用，当前序号可通过 EntryMeta 查询
+// 参数：
+//   - key: 键
+//   - value: 值
+//   - expectedSeq: 期望的当前写入序号，0 表示仅当 key 不存在时写入
+//
+// 返回：
+//   - uint64: 写入成功时为新的写入序号，否则为 key 当前的写入序号（不存在为 0）
+//   - bool: 是否写入
+//   - error: 写入错误
+func (db *DB) PutIfVersion(key []byte, value []byte, expectedSeq uint64) (uint64, bool, error) {
+	return db.PutIfVersionAt(key, value, expectedSeq, 0)
+}
+
+// PutIfVersionAt 仅当 key 当前的写入序号等于 expected 时以 version 作为写入序号写入
+// 参数：
+//   - key: 键
+//   - value: 值
+//   - expected: 期望的当前写入序号，0 表示仅当 key 不存在时写入
+//   - version: 写入序号，0 表示由 DB 分配
+//
+// 返回：
+//   - uint64: 写入成功时为新的写入序号，否则为 key 当前的写入序号（不存在为 0）
+//   - bool: 是否写入
+//   - error: 写入错误
+func (db *DB) PutIfVersionAt(key []byte, value []byte, expected uint64, version uint64) (uint64, bool, error) {
+	if err := db.lockForWrite(); err != nil {
+		return 0, false, err
+	}
+	defer db.mu.Unlock()
+
+	current, err := db.currentSeq(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if current != expected {
+		return current, false, nil
+	}
+
+	entry := NewEntry(key, value)
+	entry.Seq = version
+	if err := db.applyEntry(entry); err != nil {
+		return 0, false, err
+	}
+	return entry.Seq, true, nil
+}
+
+// currentSeq 返回 key 当前 Entry 的写入序号，key 不存在时返回 0
+// 调用方必须持有读锁或写锁
+func (db *DB) currentSeq(key []byte) (uint64, error) {
+	pos, _ := db.peekIndex(key)
+	if pos == nil {
+		return 0, nil
+	}
+	dataFile := db.dataFileFor(pos.FileID)
+	if dataFile == nil {
+		return 0, nil
+	}
+	entry, err := dataFile.ReadEntry(pos.Offset)
+	if err != nil {
+		return 0, fmt.Errorf("读取 Entry 失败: %w", err)
+	}
+	return entry.Seq, nil
+}
+
+// appendEntry 将 Entry 追加写入活跃文件，必要时先轮转文件
+// 调用方必须持有写锁
+func (db *DB) appendEntry(entry *Entry) (*storage.Position, error) {
 	// 检查是否需要创建新文件
-	if db.activeFile.GetWriteOff() >= db.options.DataFileSizeLimit {
+	if db.shouldRotate(entry) {
 		if err := db.rotateActiveFile(); err != nil {
-			return fmt.Errorf("轮转活跃文件失败: %w", err)
+			return nil, fmt.Errorf("轮转活跃文件失败: %w", err)
 		}
 	}
 
-	// 创建 Entry
-	entry := NewEntry(key, value)
+	db.assignSeq(entry)
+	db.observeAppendKey(entry.Key)
 
 	// 追加写入活跃文件
 	offset, err := db.activeFile.Write(entry)
 	if err != nil {
-		return fmt.Errorf("写入数据文件失败: %w", err)
+		return nil, fmt.Errorf("写入数据文件失败: %w", err)
+	}
+
+	db.activeEntries++
+
+	// 数据写入成功后再追加 Key-Log，保证 Key-Log 不会领先于数据文件
+	if db.activeKeyLog != nil {
+		if err := db.activeKeyLog.Append(newKeyLogRecord(entry, offset)); err != nil {
+			return nil, err
+		}
 	}
 
 	// 构建位置信息
-	pos := &storage.Position{
+	return &storage.Position{
 		FileID: db.activeFile.GetFileID(),
 		Offset: offset,
 		Size:   entry.Size(),
+	}, nil
+}
+
+// assignSeq 为 Entry 分配写入序号
+// 已带有序号的 Entry（Merge 重写的 Entry、以指定版本号写入的 Entry）保留原序号，最大序号随之前进
+// 调用方必须持有写锁
+func (db *DB) assignSeq(entry *Entry) {
+	if entry.Seq == 0 {
+		db.seq++
+		entry.Seq = db.seq
+	} else if entry.Seq > db.seq {
+		db.seq = entry.Seq
+	}
+}
+
+// shouldRotate 判断写入 entry 之前是否需要轮转活跃文件
+// 调用方必须持有写锁
+func (db *DB) shouldRotate(entry *Entry) bool {
+	return db.rotateNeeded(db.activeFile.GetWriteOff(), db.activeEntries, entry, db.options.DataFileSizeLimit)
+}
+
+// rotateNeeded 判断向已写入 writeOff 字节、entries 个 Entry 的文件写入 entry 之前是否需要换到新文件
+// 活跃文件与 Merge 的输出文件使用相同的规则，只有大小限制不同
+func (db *DB) rotateNeeded(writeOff int64, entries int, entry *Entry, limit int64) bool {
+	if writeOff == 0 {
+		return false
+	}
+
+	// 超过单文件大小限制的 Entry 独占一个文件：写入前轮转，
+	// 写入后文件中只有这一个 Entry 且已超限，下一次写入再轮转
+	if int64(entry.Size()) > limit {
+		return true
+	}
+	if entries == 1 && writeOff > limit {
+		return true
+	}
+
+	if writeOff < limit {
+		return false
+	}
+
+	// 迟滞：已超限，但 Entry 数或字节数未达到下限时继续写入当前文件
+	return entries >= db.options.RotateMinEntries && writeOff >= db.options.RotateMinBytes
+}
+
+// checkNewEntry 检查新写入的 Entry 是否超出 key / value 的大小限制与超大 Entry 策略
+// 只限制新写入；Merge 重写已存在的超大 Entry、重放意图日志都不受这些限制
+func (db *DB) checkNewEntry(entry *Entry) error {
+	if entry.KeySize > db.options.MaxKeySize {
+		return ErrKeyTooLarge
+	}
+	if entry.ValueSize > db.options.MaxValueSize {
+		return ErrValueTooLarge
+	}
+	if db.options.OversizedEntryPolicy == OversizedReject && int64(entry.Size()) > db.options.DataFileSizeLimit {
+		return ErrEntryTooLarge
+	}
+	return nil
+}
+
+// applyEntry 检查限制后写入 Entry，并同步更新内存索引与布隆过滤器
+// 调用方必须持有写锁
+func (db *DB) applyEntry(entry *Entry) error {
+	if err := db.checkNewEntry(entry); err != nil {
+		return err
+	}
+	if !entry.IsTombstone() {
+		if err := db.checkFreeSpace(entry); err != nil {
+			return err
+		}
+	}
+	return db.writeEntry(entry)
+}
+
+// writeEntry 不检查限制，写入 Entry 并同步更新内存索引与布隆过滤器
+// 普通 Entry 写入索引，墓碑 Entry 从索引中删除 key
+// 调用方必须持有写锁
+func (db *DB) writeEntry(entry *Entry) error {
+	pos, err := db.appendEntry(entry)
+	if err != nil {
+		return err
+	}
+	if db.mirror != nil {
+		db.mirror.enqueue(entry)
+	}
+	db.unquarantine(entry.Key)
+	db.trackRecentWrite(entry, pos)
+
+	if entry.IsTombstone() {
+		db.index.Delete(entry.Key)
+		db.suffixDelete(entry.Key)
+		db.secondaryDelete(entry.Key)
+		if db.accessTimes != nil {
+			db.accessTimes.remove(entry.Key)
+		}
+		return nil
 	}
 
 	// 更新内存索引
-	db.index.Put(key, pos)
+	db.index.Put(entry.Key, pos)
+	db.maybeMigrateIndex()
+	if db.negCache != nil {
+		db.negCache.remove(entry.Key)
+	}
+	db.suffixAdd(entry.Key)
+	db.secondaryPut(entry.Key, entry.Value)
 
 	// 【关键】将 Key 加入布隆过滤器
 	// 这样在后续的 Get 操作中，可以通过布隆过滤器快速判断 key 是否可能存在
-	db.bloomFilter.Add(key)
+	db.bloomFilter.Add(entry.Key)
+	db.keyEstimator.Add(entry.Key)
+
+	return nil
+}
 
+// checkFreeSpace 检查写入 entry 后磁盘可用空间是否仍不低于 MinFreeBytes，并扣除写入的字节数
+// 调用方必须持有写锁
+func (db *DB) checkFreeSpace(entry *Entry) error {
+	size := uint64(entry.Size())
+	if err := db.checkFreeSpaceFor(size); err != nil {
+		return err
+	}
+	db.consumeFreeSpace(size)
+	return nil
+}
+
+// consumeFreeSpace 从缓存的磁盘可用空间中扣除写入的字节数，未启用检查时 freeBytes 始终为 0
+// 调用方必须持有写锁
+func (db *DB) consumeFreeSpace(size uint64) {
+	if db.freeBytes >= size {
+		db.freeBytes -= size
+	}
+}
+
+// checkFreeSpaceFor 检查再写入 size 字节后磁盘可用空间是否仍不低于 MinFreeBytes，不扣除 freeBytes
+// 查询结果缓存 freeSpaceCacheTTL，期间按写入的字节数递减；查询失败时不阻止写入
+// 调用方必须持有写锁
+func (db *DB) checkFreeSpaceFor(size uint64) error {
+	if db.options.MinFreeBytes == 0 {
+		return nil
+	}
+	reporter, ok := db.options.FileSystem.(SpaceReporter)
+	if !ok {
+		return nil
+	}
+
+	if time.Since(db.freeCheckedAt) >= freeSpaceCacheTTL {
+		free, err := reporter.FreeSpace(db.dir)
+		if err != nil {
+			return nil
+		}
+		db.freeBytes = free
+		db.freeCheckedAt = time.Now()
+	}
+
+	if db.freeBytes < size+db.options.MinFreeBytes {
+		return ErrInsufficientSpace
+	}
 	return nil
 }
 
 // rotateActiveFile 轮转活跃文件
 // 当活跃文件达到大小限制时，创建一个新的活跃文件
 func (db *DB) rotateActiveFile() error {
-	// 关闭当前活跃文件
-	if err := db.activeFile.Close(); err != nil {
-		return fmt.Errorf("关闭活跃文件失败: %w", err)
+	// 活跃文件还是空的，轮转只会再创建一个空文件
+	if db.activeFile.GetWriteOff() == 0 {
+		return nil
+	}
+
+	// 同步当前活跃文件（文件保持打开，转为只读的旧文件后仍需要被读取）
+	if err := db.activeFile.Sync(); err != nil {
+		return fmt.Errorf("同步活跃文件失败: %w", err)
 	}
 
 	// 将当前活跃文件移动到旧文件集合
@@ -309,13 +1109,16 @@ func (db *DB) rotateActiveFile() error {
 
 	// 创建新的活跃文件
 	db.fileID++
-	newFile, err := OpenDataFile(db.dir, db.fileID)
+	newFile, err := db.openFile(db.fileID)
 	if err != nil {
 		return fmt.Errorf("创建新的活跃文件失败: %w", err)
 	}
 	db.activeFile = newFile
+	db.activeEntries = 0
+	db.maybeScheduleMerge()
 
-	return nil
+	// Key-Log 跟随数据文件轮转
+	return db.openActiveKeyLog()
 }
 
 // Get 根据键获取值
@@ -325,6 +1128,18 @@ func (db *DB) rotateActiveFile() error {
 //   - []byte: 值
 //   - error: 读取错误，如果键不存在返回 ErrKeyNotFound
 func (db *DB) Get(key []byte) ([]byte, error) {
+	value, pos, err := db.get(key)
+	if err != nil && errors.Is(err, ErrCRCMismatch) {
+		return db.handleCorruption(key, pos, err)
+	}
+	if err == nil && db.accessTimes != nil {
+		db.accessTimes.touch(key)
+	}
+	return value, err
+}
+
+// get 读取 key 对应的 value，同时返回其位置，供处理损坏的 Entry 使用
+func (db *DB) get(key []byte) ([]byte, *storage.Position, error) {
 	// 加读锁
 	db.mu.RLock()
 	defer db.mu.RUnlock()
@@ -335,14 +1150,21 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	//   - 返回 true：key 可能存在，继续查询 ART 索引
 	if !db.bloomFilter.Test(key) {
 		// 布隆过滤器返回 false，一定不存在
-		return nil, storage.ErrKeyNotFound
+		return nil, nil, storage.ErrKeyNotFound
+	}
+	// 最近确认不存在的 key（通常是已删除的 key）不再查询索引
+	if db.negCache != nil && db.negCache.contains(key) {
+		return nil, nil, storage.ErrKeyNotFound
 	}
 
 	// 布隆过滤器返回 true，可能存在，继续查询 ART 索引
 	pos := db.index.Get(key)
 	if pos == nil {
-		// 索引中也没有，key 确实不存在（布隆过滤器误判）
-		return nil, storage.ErrKeyNotFound
+		// 索引中也没有，key 确实不存在（布隆过滤器误判或已删除）
+		if db.negCache != nil {
+			db.negCache.add(key)
+		}
+		return nil, nil, storage.ErrKeyNotFound
 	}
 
 	// 根据 FileID 获取数据文件
@@ -353,18 +1175,122 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 		var ok bool
 		dataFile, ok = db.olderFiles[pos.FileID]
 		if !ok {
-			return nil, storage.ErrKeyNotFound
+			return nil, nil, storage.ErrKeyNotFound
+		}
+	}
+
+	// 尚未写入文件的写入直接从内存返回
+	if db.recent != nil {
+		if value, ok := db.recent.get(key, pos); ok {
+			return value, pos, nil
+		}
+	}
+
+	// 先查 Value 缓存，按 value 在磁盘上的大小确定分类
+	valueSize := int(pos.Size) - HeaderSize - len(key)
+	if db.valueCache != nil {
+		if value, ok := db.valueCache.get(pos.FileID, pos.Offset, valueSize); ok {
+			return value, pos, nil
 		}
 	}
 
 	// 从文件读取 Entry
 	entry, err := dataFile.ReadEntry(pos.Offset)
 	if err != nil {
-		return nil, fmt.Errorf("读取 Entry 失败: %w", err)
+		return nil, pos, fmt.Errorf("读取 Entry 失败: %w", err)
+	}
+	if db.valueCache != nil {
+		db.valueCache.put(pos.FileID, pos.Offset, valueSize, entry.Value)
 	}
 
 	// 返回 Value
-	return entry.Value, nil
+	return entry.Value, pos, nil
+}
+
+// MultiGetConsistent 一致性地读取多个 key
+// 在同一次读锁内获取所有 key 的索引位置并读取 value，期间不会有写入插入，
+// 因此返回的结果对应同一个逻辑时间点。
+// 参数：
+//   - keys: 键列表
+//
+// 返回：
+//   - [][]byte: 与 keys 一一对应的值，不存在的 key 对应 nil
+//   - error: 读取错误
+func (db *DB) MultiGetConsistent(keys [][]byte) ([][]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// 先在读锁内为所有 key 拍下索引位置的快照
+	positions := make([]*storage.Position, len(keys))
+	for i, key := range keys {
+		if db.bloomFilter.Test(key) {
+			positions[i] = db.index.Get(key)
+		}
+	}
+
+	// 数据文件只追加，快照中的位置指向的数据不会改变
+	values := make([][]byte, len(keys))
+	for i, pos := range positions {
+		if pos == nil {
+			continue
+		}
+		value, err := db.readValue(pos)
+		if err == storage.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// GetPrefixAsMap 读取 prefix 下的全部键值对
+// 与 ScanPrefix 一样在同一次读锁内完成，返回的是某一时刻的一致视图。
+// 参数：
+//   - prefix: 前缀
+//
+// 返回：
+//   - map[string][]byte: 完整 key 到 value 的映射，没有匹配时返回空 map
+//   - error: 读取错误
+func (db *DB) GetPrefixAsMap(prefix []byte) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	err := db.ScanPrefix(prefix, func(key, value []byte) bool {
+		result[string(key)] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPrefixVersioned 读取 prefix 下的全部键值对及其写入序号，按 key 升序
+// 读取期间持有读锁，因此看到的是某一时刻的一致视图
+// 参数：
+//   - prefix: 前缀，空前缀表示全部 key
+//
+// 返回：
+//   - []KV: 键值对，Version 为各 key 当前 Entry 的写入序号
+//   - error: 读取错误
+func (db *DB) GetPrefixVersioned(prefix []byte) ([]KV, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	iter := db.index.Seek(prefix)
+	defer iter.Close()
+
+	var pairs []KV
+	for key := iter.Key(); key != nil && bytes.HasPrefix(key, prefix); key = iter.Key() {
+		entry, err := db.readEntry(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, KV{Key: append([]byte(nil), key...), Value: entry.Value, Version: entry.Seq})
+		iter.Next()
+	}
+	return pairs, nil
 }
 
 // Delete 删除键值对
@@ -374,35 +1300,115 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 //   - error: 删除错误
 func (db *DB) Delete(key []byte) error {
 	// 加写锁
-	db.mu.Lock()
+	if err := db.lockForWrite(); err != nil {
+		return err
+	}
 	defer db.mu.Unlock()
 
-	// 从索引中删除
-	// 注意：Bitcask 使用标记删除或直接删除，这里使用直接删除
-	// 实际生产环境可能需要使用墓碑机制
-	db.index.Delete(key)
+	// key 不存在时无需写入墓碑
+	if db.index.Get(key) == nil {
+		return nil
+	}
 
+	// 追加墓碑记录并从索引中删除
+	// 墓碑保证删除在重启后依然生效（bootstrap 会重放墓碑）
+	//
 	// 注意：布隆过滤器不支持删除操作
 	// 如果需要支持删除，应该使用计数布隆过滤器或布谷鸟过滤器
 	// 但由于 Bitcask 的特性，我们可以在 Get 时通过索引二次确认
+	return db.applyEntry(NewTombstoneEntry(key))
+}
 
-	return nil
+// DeleteReturning 删除 key 并返回删除前的值
+// 读取与删除在同一次写锁内完成，不会与并发写入交错
+// 参数：
+//   - key: 键
+//
+// 返回：
+//   - []byte: 删除前的值
+//   - error: 删除错误，如果键不存在返回 storage.ErrKeyNotFound
+func (db *DB) DeleteReturning(key []byte) ([]byte, error) {
+	return db.DeleteAt(key, 0)
+}
+
+// DeleteAt 以指定的版本号删除 key 并返回删除前的值，版本号作为墓碑的写入序号持久化
+// 参数：
+//   - key: 键
+//   - version: 版本号，0 表示由 DB 分配
+//
+// 返回：
+//   - []byte: 删除前的值
+//   - error: 删除错误，如果键不存在返回 storage.ErrKeyNotFound
+func (db *DB) DeleteAt(key []byte, version uint64) ([]byte, error) {
+	if err := db.lockForWrite(); err != nil {
+		return nil, err
+	}
+	defer db.mu.Unlock()
+
+	pos := db.index.Get(key)
+	if pos == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	value, err := db.readValue(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstone := NewTombstoneEntry(key)
+	tombstone.Seq = version
+	if err := db.applyEntry(tombstone); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Sync 将活跃文件及其 Key-Log 同步到磁盘
+// 旧文件在轮转时已经同步过，之后不再写入
+// 返回：
+//   - error: 同步错误
+func (db *DB) Sync() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.syncActive()
 }
 
 // Close 关闭数据库
 // 返回：
 //   - error: 关闭错误
 func (db *DB) Close() error {
+	// 先在写锁内标记关闭，之后 maybeScheduleMerge 不会再调度新的后台合并（wg.Add），
+	// 再在锁外等待已经调度的后台合并，它们拿到写锁后发现已关闭直接返回
+	db.mu.Lock()
+	db.closed = true
+	if db.autoMerge.timer != nil {
+		db.autoMerge.timer.Stop()
+		db.autoMerge.timer = nil
+	}
+	db.mu.Unlock()
+	db.autoMerge.wg.Wait()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	if err := db.saveAppendSeq(); err != nil {
+		return err
+	}
+
 	// 保存布隆过滤器
 	if db.bloomFilter != nil {
-		if err := db.bloomFilter.Save(db.dir); err != nil {
+		if err := db.saveBloomFilter(); err != nil {
 			return fmt.Errorf("保存布隆过滤器失败: %w", err)
 		}
 	}
 
+	// 关闭 Key-Log
+	if db.activeKeyLog != nil {
+		if err := db.activeKeyLog.Close(); err != nil {
+			return fmt.Errorf("关闭 Key-Log 失败: %w", err)
+		}
+	}
+
 	// 关闭所有数据文件
 	if db.activeFile != nil {
 		if err := db.activeFile.Close(); err != nil {
@@ -420,21 +1426,113 @@ func (db *DB) Close() error {
 	if db.index != nil {
 		db.index.Close()
 	}
+	if db.suffixIndex != nil {
+		db.suffixIndex.Close()
+	}
+
+	// 写完队列中剩余的 Entry 后关闭镜像
+	if db.mirror != nil {
+		if err := db.mirror.close(); err != nil {
+			return fmt.Errorf("关闭镜像失败: %w", err)
+		}
+		db.mirror = nil
+	}
 
 	return nil
 }
 
+// bloomFilterPath 返回布隆过滤器持久化文件的路径
+// 预哈希与不预哈希的过滤器位模式不同，分别保存，避免加载另一种方式的过滤器
+func (db *DB) bloomFilterPath() string {
+	if db.bloomFilter.PreHashed() {
+		return filepath.Join(db.dir, "bloom.prehash.filter")
+	}
+	return filepath.Join(db.dir, "bloom.filter")
+}
+
+// loadBloomFilter 从文件加载布隆过滤器，文件不存在时保持不变
+func (db *DB) loadBloomFilter() error {
+	file, err := db.options.FileSystem.OpenFile(db.bloomFilterPath(), os.O_RDONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	return db.bloomFilter.LoadFromReader(file)
+}
+
+// repairBloomFilter 校验索引中的每个 key 都能通过布隆过滤器，发现遗漏时从索引重建过滤器
+// 重建同时会清除已删除 key 残留的位，降低误判率
+// 返回：
+//   - bool: 是否进行了重建
+func (db *DB) repairBloomFilter() bool {
+	keys := db.indexKeys()
+	for _, key := range keys {
+		if !db.bloomFilter.Test(key) {
+			db.bloomFilter.Reset()
+			for _, key := range keys {
+				db.bloomFilter.Add(key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// indexKeys 返回索引中的全部 key
+func (db *DB) indexKeys() [][]byte {
+	iter := db.index.Seek(nil)
+	defer iter.Close()
+
+	var keys [][]byte
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		keys = append(keys, key)
+		iter.Next()
+	}
+	return keys
+}
+
+// saveBloomFilter 将布隆过滤器持久化到文件
+func (db *DB) saveBloomFilter() error {
+	file, err := db.options.FileSystem.OpenFile(db.bloomFilterPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = db.bloomFilter.SaveToWriter(file)
+	return err
+}
+
+// ActiveFileSafeOffset 返回活跃文件的 ID 以及外部跟读工具可以安全读取到的偏移量
+// 偏移量之前的 Entry 都已完整写入，见 DataFile.SafeReadOffset；活跃文件轮转后旧文件不再增长，
+// 跟读工具读到偏移量后发现文件 ID 变化时，应先读完旧文件的剩余部分再切换到新文件
+// 返回：
+//   - uint32: 活跃文件 ID
+//   - int64: 可以安全读取到的偏移量
+func (db *DB) ActiveFileSafeOffset() (uint32, int64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.activeFile.GetFileID(), db.activeFile.SafeReadOffset()
+}
+
 // GetFilePath 获取指定文件 ID 的文件路径
 // 参数：
 //   - fileID: 文件 ID
 // 返回：
 //   - string: 文件路径
 func (db *DB) GetFilePath(fileID uint32) string {
-	return filepath.Join(db.dir, fmt.Sprintf("%08d.data", fileID))
+	return filepath.Join(db.dir, db.options.FileNamer.DataFileName(fileID))
 }
 
 // Seek 查找第一个大于等于 key 的键，返回迭代器
+// 迭代器的每一步都短暂持有读锁，不阻塞写入；IndexTypeAuto 迁移索引之后，
+// 之前创建的迭代器继续遍历迁移前的 Map 索引
 func (db *DB) Seek(key []byte) (storage.Iterator, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	// 使用索引的 Seek 获取位置迭代器
 	indexIter := db.index.Seek(key)
 	return &DBIterator{
@@ -458,6 +1556,8 @@ func (it *DBIterator) Next() {
 	if it.indexIter == nil {
 		return
 	}
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
 
 	it.indexIter.Next()
 	pos := it.indexIter.Value()
@@ -487,16 +1587,13 @@ func (it *DBIterator) Value() []byte {
 		return nil
 	}
 
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+
 	// 从数据文件读取 value
-	var dataFile *DataFile
-	if it.current.FileID == it.db.activeFile.GetFileID() {
-		dataFile = it.db.activeFile
-	} else {
-		var ok bool
-		dataFile, ok = it.db.olderFiles[it.current.FileID]
-		if !ok {
-			return nil
-		}
+	dataFile := it.db.dataFileFor(it.current.FileID)
+	if dataFile == nil {
+		return nil
 	}
 
 	entry, err := dataFile.ReadEntry(it.current.Offset)
@@ -525,5 +1622,16 @@ func (it *DBIterator) Close() {
 	it.indexIter = nil
 }
 
-// 确保 DB 实现了 storage.Engine 接口
+// 确保 DB 实现了相关接口
 var _ storage.Engine = (*DB)(nil)
+var _ storage.PrefixMapReader = (*DB)(nil)
+var _ storage.VersionedWriter = (*DB)(nil)
+var _ storage.VersionedStore = (*DB)(nil)
+var _ storage.AppendCounter = (*DB)(nil)
+var _ storage.DeleteReturner = (*DB)(nil)
+var _ storage.MemoryReporter = (*DB)(nil)
+var _ storage.BulkWriter = (*DB)(nil)
+var _ storage.KeyDistributionReporter = (*DB)(nil)
+var _ storage.Syncer = (*DB)(nil)
+var _ storage.KeyCounter = (*DB)(nil)
+var _ storage.AccessTimeReporter = (*DB)(nil)
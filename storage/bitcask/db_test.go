@@ -1,11 +1,22 @@
 package bitcask
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/bench"
+	"github.com/forever-free1/TideKV/storage/index"
 )
 
 func TestDB_PutAndGet(t *testing.T) {
@@ -272,3 +283,1646 @@ func TestDB_FileRotation(t *testing.T) {
 	}
 	t.Logf("创建了 %d 个数据文件", dataFiles)
 }
+
+func TestDB_OpenUnrecognizedFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 在目录中放入一个非 TideKV 的 .data 文件，后面跟一个正常的活跃文件
+	garbage := []byte("this is definitely not a TideKV data file, just some text")
+	writeTestFile(t, OSFileSystem, filepath.Join(dir, "00000000.data"), garbage)
+	writeTestFile(t, OSFileSystem, filepath.Join(dir, "00000001.data"), nil)
+
+	_, err = Open(dir)
+	if !errors.Is(err, ErrUnrecognizedFile) {
+		t.Fatalf("期望 ErrUnrecognizedFile, 得到: %v", err)
+	}
+	if !strings.Contains(err.Error(), "00000000.data") {
+		t.Errorf("错误信息应包含文件名: %v", err)
+	}
+}
+
+func TestDB_OpenAfterLoweringLimits(t *testing.T) {
+	forEachFileSystem(t, testDBOpenAfterLoweringLimits)
+}
+
+func testDBOpenAfterLoweringLimits(t *testing.T, fsys FileSystem) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 每个数据文件的首个 Entry 都超出之后调低的限制
+	db, err := Open(dir, WithFileSystem(fsys), WithDataFileSizeLimit(256))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	large := bytes.Repeat([]byte("v"), 200)
+	for i := 0; i < 4; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("large-key-%d", i)), large); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	db.Close()
+
+	// 调低的限制只作用于新写入，已写入的数据仍能打开与读取
+	db, err = Open(dir, WithFileSystem(fsys), WithDataFileSizeLimit(256), WithMaxKeySize(4), WithMaxValueSize(16))
+	if err != nil {
+		t.Fatalf("调低限制之后打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 4; i++ {
+		if value, err := db.Get([]byte(fmt.Sprintf("large-key-%d", i))); err != nil || !bytes.Equal(value, large) {
+			t.Fatalf("调低限制之后读取 large-key-%d 失败: %v", i, err)
+		}
+	}
+	if err := db.Put([]byte("k"), large); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("新写入仍应受限制: %v", err)
+	}
+}
+
+func TestDB_PutTooLarge(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithMaxKeySize(8), WithMaxValueSize(16))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("a-very-long-key"), []byte("v")); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("期望 ErrKeyTooLarge, 得到: %v", err)
+	}
+	if err := db.Put([]byte("k"), make([]byte, 17)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("期望 ErrValueTooLarge, 得到: %v", err)
+	}
+}
+
+// countDataFiles 统计目录下的数据文件数量
+func countDataFiles(t *testing.T, dir string) int {
+	files, err := OSFileSystem.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取目录失败: %v", err)
+	}
+	count := 0
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".data" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDB_DataFileSizeLimitValidation(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 过小的限制会让每次写入都轮转出新文件，打开时直接拒绝
+	invalid := [][]Option{
+		{WithDataFileSizeLimit(0)},
+		{WithDataFileSizeLimit(-1)},
+		{WithDataFileSizeLimit(MinDataFileSizeLimit - 1)},
+		{WithMergeFileSizeLimit(-1)},
+	}
+	for i, opts := range invalid {
+		db, err := Open(filepath.Join(dir, "invalid"), opts...)
+		if !errors.Is(err, ErrInvalidOptions) {
+			if db != nil {
+				db.Close()
+			}
+			t.Fatalf("第 %d 组配置应返回 ErrInvalidOptions: %v", i, err)
+		}
+	}
+
+	// 很小但合法的限制：每个文件最多容纳两个 Entry，不会产生空文件
+	check := func(limit int64, puts, wantFiles int) {
+		t.Helper()
+		sub := filepath.Join(dir, fmt.Sprintf("limit-%d", limit))
+		db, err := Open(sub, WithDataFileSizeLimit(limit))
+		if err != nil {
+			t.Fatalf("限制为 %d 时打开数据库失败: %v", limit, err)
+		}
+		for i := 0; i < puts; i++ {
+			if err := db.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("v")); err != nil {
+				t.Fatalf("限制为 %d 时写入失败: %v", limit, err)
+			}
+		}
+		if files := len(db.olderFiles) + 1; files != wantFiles {
+			t.Fatalf("限制为 %d 时数据文件数量不匹配: 期望 %d，实际 %d", limit, wantFiles, files)
+		}
+		for id, dataFile := range db.olderFiles {
+			if dataFile.GetWriteOff() == 0 {
+				t.Fatalf("限制为 %d 时文件 %d 是空的", limit, id)
+			}
+		}
+		db.Close()
+
+		db, err = Open(sub, WithDataFileSizeLimit(limit))
+		if err != nil {
+			t.Fatalf("限制为 %d 时重新打开数据库失败: %v", limit, err)
+		}
+		defer db.Close()
+		for i := 0; i < puts; i++ {
+			key := fmt.Sprintf("key-%02d", i)
+			if val, err := db.Get([]byte(key)); err != nil || string(val) != "v" {
+				t.Fatalf("限制为 %d 时读取 %s 失败: %q, %v", limit, key, val, err)
+			}
+		}
+	}
+	// 每个 Entry 37 字节：超过最小限制时独占一个文件，限制为 64 时每个文件两个
+	check(MinDataFileSizeLimit, 5, 5)
+	check(64, 20, 10)
+}
+
+func TestDB_RotationHysteresis(t *testing.T) {
+	const limit = 1024
+
+	// 每个 value 超过半个文件：不启用迟滞时，每个文件只能容纳 2 个 Entry
+	writeBurst := func(t *testing.T, opts ...Option) (string, *DB) {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		db, err := Open(dir, append([]Option{WithDataFileSizeLimit(limit)}, opts...)...)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			if err := db.Put([]byte(fmt.Sprintf("key-%d", i)), make([]byte, 600)); err != nil {
+				t.Fatalf("Put 失败: %v", err)
+			}
+		}
+		return dir, db
+	}
+
+	dir, db := writeBurst(t)
+	baseline := countDataFiles(t, dir)
+	db.Close()
+	os.RemoveAll(dir)
+	if baseline != 5 {
+		t.Fatalf("不启用迟滞时文件数不匹配: got %d, want 5", baseline)
+	}
+
+	dir, db = writeBurst(t, WithRotateMinEntries(4))
+	defer os.RemoveAll(dir)
+	if got := countDataFiles(t, dir); got != 3 {
+		t.Fatalf("启用迟滞后文件数不匹配: got %d, want 3", got)
+	}
+
+	// 超过文件大小限制的 value 各自独占一个文件，之后的普通写入进入新文件
+	oversized := make([]byte, 3*limit)
+	for i := range oversized {
+		oversized[i] = byte(i)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("big-%d", i)), oversized); err != nil {
+			t.Fatalf("写入超大 value 失败: %v", err)
+		}
+	}
+	if err := db.Put([]byte("small"), []byte("v")); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	if got := countDataFiles(t, dir); got != 6 {
+		t.Fatalf("写入超大 value 后文件数不匹配: got %d, want 6", got)
+	}
+	db.Close()
+
+	// 重启后数据完整
+	db, err := Open(dir, WithDataFileSizeLimit(limit), WithRotateMinEntries(4))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 2; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("big-%d", i)))
+		if err != nil || !bytes.Equal(val, oversized) {
+			t.Fatalf("超大 value 不匹配: err %v", err)
+		}
+	}
+	if val, err := db.Get([]byte("small")); err != nil || string(val) != "v" {
+		t.Fatalf("small 值不匹配: got %s, err %v", val, err)
+	}
+}
+
+func TestDB_OversizedEntryPolicy(t *testing.T) {
+	const limit = 1024
+	oversized := make([]byte, 2*limit)
+	for i := range oversized {
+		oversized[i] = byte(i)
+	}
+
+	t.Run("dedicated", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		opts := []Option{WithDataFileSizeLimit(limit), WithOversizedEntryPolicy(OversizedDedicatedFile)}
+		db, err := Open(dir, opts...)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		db.Put([]byte("before"), []byte("1"))
+		if err := db.Put([]byte("big"), oversized); err != nil {
+			t.Fatalf("写入超大 value 失败: %v", err)
+		}
+		db.Put([]byte("after"), []byte("2"))
+
+		// before / big / after 各占一个文件
+		if got := countDataFiles(t, dir); got != 3 {
+			t.Fatalf("文件数不匹配: got %d, want 3", got)
+		}
+		if pos := db.index.Get([]byte("big")); pos == nil || pos.Offset != 0 {
+			t.Fatalf("超大 Entry 应位于独占文件的开头: %+v", pos)
+		}
+		if val, err := db.Get([]byte("big")); err != nil || !bytes.Equal(val, oversized) {
+			t.Fatalf("读取超大 value 失败: err %v", err)
+		}
+		db.Close()
+
+		db, err = Open(dir, opts...)
+		if err != nil {
+			t.Fatalf("重新打开数据库失败: %v", err)
+		}
+		defer db.Close()
+		if val, err := db.Get([]byte("big")); err != nil || !bytes.Equal(val, oversized) {
+			t.Fatalf("重启后读取超大 value 失败: err %v", err)
+		}
+		if val, err := db.Get([]byte("after")); err != nil || string(val) != "2" {
+			t.Fatalf("after 值不匹配: got %s, err %v", val, err)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		db, err := Open(dir, WithDataFileSizeLimit(limit), WithOversizedEntryPolicy(OversizedReject))
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		defer db.Close()
+
+		db.Put([]byte("before"), []byte("1"))
+		if err := db.Put([]byte("big"), oversized); !errors.Is(err, ErrEntryTooLarge) {
+			t.Fatalf("期望 ErrEntryTooLarge, 得到: %v", err)
+		}
+		if _, err := db.Get([]byte("big")); err != storage.ErrKeyNotFound {
+			t.Errorf("被拒绝的 key 不应存在, 得到: %v", err)
+		}
+
+		// 拒绝写入不会产生新文件，后续写入不受影响
+		if err := db.Put([]byte("after"), []byte("2")); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+		if got := countDataFiles(t, dir); got != 1 {
+			t.Errorf("文件数不匹配: got %d, want 1", got)
+		}
+	})
+}
+
+func TestDB_GetPrefixAsMap(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("cfg/a"), []byte("1"))
+	db.Put([]byte("cfg/b/c"), []byte("2"))
+	db.Put([]byte("cfg/deleted"), []byte("x"))
+	db.Delete([]byte("cfg/deleted"))
+	db.Put([]byte("other"), []byte("3"))
+
+	got, err := db.GetPrefixAsMap([]byte("cfg/"))
+	if err != nil {
+		t.Fatalf("GetPrefixAsMap 失败: %v", err)
+	}
+	want := map[string]string{"cfg/a": "1", "cfg/b/c": "2"}
+	if len(got) != len(want) {
+		t.Fatalf("数量不匹配: got %d, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if string(got[k]) != v {
+			t.Errorf("%s 值不匹配: got %s, want %s", k, got[k], v)
+		}
+	}
+
+	empty, err := db.GetPrefixAsMap([]byte("missing/"))
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("没有匹配时应返回空 map: got %v, err %v", empty, err)
+	}
+}
+
+func TestDB_PutIfVersion(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// expectedSeq 为 0：仅当 key 不存在时写入
+	seq, ok, err := db.PutIfVersion([]byte("k"), []byte("v1"), 0)
+	if err != nil || !ok || seq == 0 {
+		t.Fatalf("创建失败: seq %d, ok %v, err %v", seq, ok, err)
+	}
+	if cur, ok, _ := db.PutIfVersion([]byte("k"), []byte("dup"), 0); ok || cur != seq {
+		t.Errorf("key 已存在时不应创建: got seq %d, ok %v, want seq %d", cur, ok, seq)
+	}
+
+	// 版本匹配时写入并返回新版本
+	next, ok, err := db.PutIfVersion([]byte("k"), []byte("v2"), seq)
+	if err != nil || !ok || next <= seq {
+		t.Fatalf("版本匹配时写入失败: seq %d, ok %v, err %v", next, ok, err)
+	}
+
+	// 过期版本被拒绝，返回当前版本，值保持不变
+	if cur, ok, _ := db.PutIfVersion([]byte("k"), []byte("stale"), seq); ok || cur != next {
+		t.Errorf("过期版本不应写入: got seq %d, ok %v, want seq %d", cur, ok, next)
+	}
+	if val, _ := db.Get([]byte("k")); string(val) != "v2" {
+		t.Errorf("值不匹配: got %s, want v2", val)
+	}
+	if meta, _ := db.EntryMeta([]byte("k")); meta.Seq != next {
+		t.Errorf("EntryMeta 版本不匹配: got %d, want %d", meta.Seq, next)
+	}
+
+	// 删除后 key 不存在，可以重新创建
+	db.Delete([]byte("k"))
+	if _, ok, _ := db.PutIfVersion([]byte("k"), []byte("v3"), next); ok {
+		t.Errorf("key 已删除时旧版本不应写入")
+	}
+	recreated, ok, _ := db.PutIfVersion([]byte("k"), []byte("v3"), 0)
+	if !ok {
+		t.Fatalf("key 已删除时应可以重新创建")
+	}
+
+	// Merge 与重启后版本保持不变
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if _, ok, err := db.PutIfVersion([]byte("k"), []byte("v4"), recreated); err != nil || !ok {
+		t.Errorf("重启后版本应保持不变: ok %v, err %v", ok, err)
+	}
+}
+
+func TestDB_PutAt(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// 指定的版本号作为写入序号保存，之后由 DB 分配的序号从最大值继续
+	if err := db.PutAt([]byte("a"), []byte("1"), 100); err != nil {
+		t.Fatalf("PutAt 失败: %v", err)
+	}
+	if err := db.PutAll([]KV{{Key: []byte("b"), Value: []byte("2"), Version: 120}, {Key: []byte("c"), Value: []byte("3")}}); err != nil {
+		t.Fatalf("PutAll 失败: %v", err)
+	}
+	if _, ok, err := db.PutIfVersionAt([]byte("a"), []byte("stale"), 99, 130); err != nil || ok {
+		t.Fatalf("过期版本不应写入: ok %v, err %v", ok, err)
+	}
+	if seq, ok, err := db.PutIfVersionAt([]byte("a"), []byte("11"), 100, 130); err != nil || !ok || seq != 130 {
+		t.Fatalf("版本匹配时应以指定版本写入: seq %d, ok %v, err %v", seq, ok, err)
+	}
+	if _, err := db.DeleteAt([]byte("b"), 140); err != nil {
+		t.Fatalf("DeleteAt 失败: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	pairs, err := db.GetPrefixVersioned(nil)
+	if err != nil {
+		t.Fatalf("GetPrefixVersioned 失败: %v", err)
+	}
+	if len(pairs) != 2 || string(pairs[0].Key) != "a" || pairs[0].Version != 130 || string(pairs[0].Value) != "11" ||
+		string(pairs[1].Key) != "c" || pairs[1].Version != 121 {
+		t.Fatalf("重启后版本不匹配: %+v", pairs)
+	}
+	if err := db.Put([]byte("d"), []byte("4")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if meta, _ := db.EntryMeta([]byte("d")); meta.Seq != 141 {
+		t.Fatalf("之后分配的序号应从最大值继续: got %d, want 141", meta.Seq)
+	}
+}
+
+func TestDB_Append(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	const workers, perWorker = 8, 50
+	keys := make([][]string, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key, err := db.Append([]byte(fmt.Sprintf("%d-%d", w, i)))
+				if err != nil {
+					t.Errorf("Append 失败: %v", err)
+					return
+				}
+				keys[w] = append(keys[w], string(key))
+			}
+		}(w)
+		// 同时进行的其他写入不占用追加写入计数器
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key := []byte(fmt.Sprintf("other-%d-%d", w, i))
+				db.Put(key, []byte("x"))
+				db.Delete(key)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// 每个 goroutine 内部的 key 按写入顺序递增
+	var all []string
+	for w := range keys {
+		for i := 1; i < len(keys[w]); i++ {
+			if keys[w][i] <= keys[w][i-1] {
+				t.Fatalf("key 未按写入顺序递增: %s <= %s", keys[w][i], keys[w][i-1])
+			}
+		}
+		all = append(all, keys[w]...)
+	}
+
+	// 所有 key 互不相同且连续
+	sort.Strings(all)
+	for i, key := range all {
+		if want := string(storage.AppendKey(uint64(i + 1))); key != want {
+			t.Fatalf("key 不连续: got %s, want %s", key, want)
+		}
+		val, err := db.Get([]byte(key))
+		if err != nil || len(val) == 0 {
+			t.Fatalf("%s 读取失败: %v", key, err)
+		}
+	}
+	db.Close()
+
+	// 重启后继续递增，不会复用已分配的 key
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	key, err := db.Append([]byte("next"))
+	if want := string(storage.AppendKey(workers*perWorker + 1)); err != nil || string(key) != want {
+		t.Errorf("重启后 key 不匹配: got %s, want %s, err %v", key, want, err)
+	}
+
+	// 删除最大的 key 并 Merge 掉它的墓碑后，重启仍不会复用它
+	db.Delete(key)
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	key, err = db.Append([]byte("after-merge"))
+	if want := string(storage.AppendKey(workers*perWorker + 2)); err != nil || string(key) != want {
+		t.Errorf("Merge 后 key 不匹配: got %s, want %s, err %v", key, want, err)
+	}
+}
+
+func TestDB_DeleteReturning(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	db.Put([]byte("k"), []byte("v1"))
+	db.Put([]byte("k"), []byte("v2"))
+
+	prev, err := db.DeleteReturning([]byte("k"))
+	if err != nil || string(prev) != "v2" {
+		t.Fatalf("应返回删除前的值: got %s, err %v", prev, err)
+	}
+	if _, err := db.Get([]byte("k")); err != storage.ErrKeyNotFound {
+		t.Errorf("删除后应不存在, 得到: %v", err)
+	}
+
+	// key 不存在（包括已删除）时返回 ErrKeyNotFound
+	if _, err := db.DeleteReturning([]byte("k")); err != storage.ErrKeyNotFound {
+		t.Errorf("重复删除应返回 ErrKeyNotFound, 得到: %v", err)
+	}
+	if _, err := db.DeleteReturning([]byte("missing")); err != storage.ErrKeyNotFound {
+		t.Errorf("删除不存在的 key 应返回 ErrKeyNotFound, 得到: %v", err)
+	}
+	db.Close()
+
+	// 删除在重启后依然生效
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Get([]byte("k")); err != storage.ErrKeyNotFound {
+		t.Errorf("重启后应不存在, 得到: %v", err)
+	}
+}
+
+func TestDB_BloomKeyHash(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("tenant-1/orders/2024/%06d", i)) }
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			val, err := db.Get(key(i))
+			if err != nil || string(val) != fmt.Sprintf("value-%d", i) {
+				t.Fatalf("%s 读取失败: got %s, err %v", key(i), val, err)
+			}
+		}
+		if _, err := db.Get(key(200)); err != storage.ErrKeyNotFound {
+			t.Fatalf("不存在的 key 应返回 ErrKeyNotFound, 得到: %v", err)
+		}
+	}
+
+	db, err := Open(dir, WithBloomKeyHash(index.XXHashBloomKey))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		db.Put(key(i), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	check(db)
+	db.Close()
+	if _, err := OSFileSystem.Stat(filepath.Join(dir, "bloom.prehash.filter")); err != nil {
+		t.Fatalf("预哈希的过滤器应保存到单独的文件: %v", err)
+	}
+
+	// 关闭预哈希后重新打开：不加载预哈希的过滤器，启动引导重新添加全部 key
+	db, err = Open(dir, WithBloomFilterValidation(true))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	check(db)
+	if db.repairBloomFilter() {
+		t.Errorf("启动引导后过滤器应与索引一致")
+	}
+	db.Close()
+
+	// 再次启用预哈希
+	db, err = Open(dir, WithBloomKeyHash(index.XXHashBloomKey), WithBloomFilterValidation(true))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	check(db)
+	if db.repairBloomFilter() {
+		t.Errorf("启动引导后过滤器应与索引一致")
+	}
+}
+
+func TestDB_LastAccess(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithAccessTracking(true))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("read"), []byte("v"))
+	db.Put([]byte("untouched"), []byte("v"))
+
+	// 从未被读取的 key 报告写入时间
+	meta, err := db.EntryMeta([]byte("untouched"))
+	if err != nil {
+		t.Fatalf("查询元数据失败: %v", err)
+	}
+	last, ok := db.LastAccess([]byte("untouched"))
+	if !ok || last.UnixNano() != meta.Timestamp {
+		t.Fatalf("未读取的 key 应报告写入时间: got %v (%v), want %d", last, ok, meta.Timestamp)
+	}
+
+	written, _ := db.LastAccess([]byte("read"))
+	time.Sleep(2 * time.Millisecond)
+	before := time.Now()
+	if _, err := db.Get([]byte("read")); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	last, ok = db.LastAccess([]byte("read"))
+	if !ok || last.Before(before) || !last.After(written) {
+		t.Fatalf("读取后访问时间应更新: got %v (%v), 读取前 %v", last, ok, before)
+	}
+
+	// 查询访问时间本身不算访问
+	if again, _ := db.LastAccess([]byte("read")); !again.Equal(last) {
+		t.Errorf("查询访问时间不应改变结果: %v != %v", again, last)
+	}
+
+	// 再次写入后报告新的写入时间
+	time.Sleep(2 * time.Millisecond)
+	db.Put([]byte("read"), []byte("v2"))
+	if rewritten, _ := db.LastAccess([]byte("read")); !rewritten.After(last) {
+		t.Errorf("写入后访问时间应更新: %v 不晚于 %v", rewritten, last)
+	}
+
+	db.Delete([]byte("read"))
+	if _, ok := db.LastAccess([]byte("read")); ok {
+		t.Errorf("删除的 key 不应有访问时间")
+	}
+	if _, ok := db.accessTimes.get([]byte("read")); ok {
+		t.Errorf("删除的 key 的读取时间应被移除")
+	}
+	if _, ok := db.LastAccess([]byte("missing")); ok {
+		t.Errorf("不存在的 key 不应有访问时间")
+	}
+}
+
+func TestDB_LastAccessHybridIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 未启用访问记录时，混合索引温层与热层的访问时间仍然可用
+	db, err := Open(dir, WithIndexType(IndexTypeHybrid))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("k"), []byte("v"))
+	written, ok := db.LastAccess([]byte("k"))
+	if !ok {
+		t.Fatalf("key 应存在")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, err := db.Get([]byte("k")); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if last, _ := db.LastAccess([]byte("k")); !last.After(written) {
+		t.Fatalf("读取后访问时间应更新: %v 不晚于 %v", last, written)
+	}
+}
+
+func TestDB_BloomFilterRepair(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	db.Close()
+
+	// 用只包含前 10 个 key 的过期布隆过滤器覆盖持久化文件
+	stale := index.NewBloomFilter(1000000, 0.01)
+	for i := 0; i < 10; i++ {
+		stale.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	var buf bytes.Buffer
+	if _, err := stale.SaveToWriter(&buf); err != nil {
+		t.Fatalf("序列化布隆过滤器失败: %v", err)
+	}
+	writeTestFile(t, OSFileSystem, filepath.Join(dir, "bloom.filter"), buf.Bytes())
+
+	db, err = Open(dir, WithBloomFilterValidation(true))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil || string(val) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("key-%d 读取失败: got %s, err %v", i, val, err)
+		}
+	}
+
+	// 过滤器与索引一致时不需要重建
+	if db.repairBloomFilter() {
+		t.Errorf("一致的过滤器不应被重建")
+	}
+
+	// 过滤器丢失索引中的 key 时，Get 会被误判为不存在，修复后恢复
+	db.bloomFilter.Reset()
+	if _, err := db.Get([]byte("key-42")); err != storage.ErrKeyNotFound {
+		t.Fatalf("过滤器缺失 key 时应短路为不存在, 得到: %v", err)
+	}
+	if !db.repairBloomFilter() {
+		t.Fatalf("缺失 key 的过滤器应被重建")
+	}
+	if val, err := db.Get([]byte("key-42")); err != nil || string(val) != "value-42" {
+		t.Errorf("修复后读取失败: got %s, err %v", val, err)
+	}
+}
+
+func TestDB_MultiGetConsistent(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	keys := [][]byte{[]byte("from"), []byte("to"), []byte("missing")}
+	db.Put(keys[0], []byte("0"))
+	db.Put(keys[1], []byte("0"))
+
+	// 写入方总是先更新 from 再更新 to，任意时间点上 from 要么等于 to，要么恰好领先 1
+	const rounds = 2000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= rounds; i++ {
+			v := []byte(fmt.Sprint(i))
+			db.Put(keys[0], v)
+			db.Put(keys[1], v)
+		}
+	}()
+
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+
+		values, err := db.MultiGetConsistent(keys)
+		if err != nil {
+			t.Fatalf("MultiGetConsistent 失败: %v", err)
+		}
+		if values[2] != nil {
+			t.Fatalf("不存在的 key 应返回 nil, 得到: %s", values[2])
+		}
+		var from, to int
+		fmt.Sscan(string(values[0]), &from)
+		fmt.Sscan(string(values[1]), &to)
+		if from != to && from != to+1 {
+			t.Fatalf("读到了不一致的状态: from=%d, to=%d", from, to)
+		}
+	}
+}
+
+// spaceFileSystem 报告可控可用空间的 FileSystem，用于测试 MinFreeBytes
+type spaceFileSystem struct {
+	FileSystem
+	free  atomic.Uint64
+	calls atomic.Int64
+}
+
+func (f *spaceFileSystem) FreeSpace(dir string) (uint64, error) {
+	f.calls.Add(1)
+	return f.free.Load(), nil
+}
+
+func TestDB_WriteTimeout(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithWriteTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+
+	// 持有写锁时，并发的写入超时返回 ErrWriteTimeout
+	writes := []func() error{
+		func() error { return db.Put([]byte("key"), []byte("other")) },
+		func() error { return db.Delete([]byte("key")) },
+		func() error { _, err := db.DeleteReturning([]byte("key")); return err },
+		func() error { _, _, err := db.PutIfVersion([]byte("key"), []byte("other"), 0); return err },
+		func() error { _, err := db.Append([]byte("other")); return err },
+		func() error { return db.ReplacePrefix([]byte("k"), []KV{{Key: []byte("key"), Value: []byte("other")}}) },
+		func() error { return db.PutAll([]KV{{Key: []byte("key"), Value: []byte("other")}}) },
+	}
+	db.mu.Lock()
+	errs := make(chan error, len(writes))
+	start := time.Now()
+	for _, write := range writes {
+		go func() { errs <- write() }()
+	}
+	for i := 0; i < len(writes); i++ {
+		if err := <-errs; !errors.Is(err, ErrWriteTimeout) {
+			db.mu.Unlock()
+			t.Fatalf("持有写锁时写入应返回 ErrWriteTimeout: %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+	db.mu.Unlock()
+	if elapsed < 20*time.Millisecond {
+		t.Fatalf("应等待到超时才返回: %v", elapsed)
+	}
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("超时的写入不应生效: %q, %v", value, err)
+	}
+
+	// 写锁在超时之前释放时写入成功
+	db.mu.Lock()
+	go func() { errs <- db.Put([]byte("key"), []byte("later")) }()
+	time.Sleep(5 * time.Millisecond)
+	db.mu.Unlock()
+	if err := <-errs; err != nil {
+		t.Fatalf("写锁释放后 Put 应成功: %v", err)
+	}
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "later" {
+		t.Fatalf("读取失败: %q, %v", value, err)
+	}
+}
+
+func TestDB_WriteTimeoutReleasesLock(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 写锁泄漏时 Close 会一直等待，因此不使用 defer 关闭
+	db, err := Open(dir, WithWriteTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// 超时的写入留下排队等待写锁的 goroutine
+	db.mu.Lock()
+	for i := 0; i < 5; i++ {
+		if err := db.Put([]byte("key"), []byte("value")); !errors.Is(err, ErrWriteTimeout) {
+			db.mu.Unlock()
+			t.Fatalf("持有写锁时写入应返回 ErrWriteTimeout: %v", err)
+		}
+	}
+	db.mu.Unlock()
+
+	// 这些 goroutine 之后拿到写锁时必须立即释放，否则写锁泄漏，之后的写入全部超时
+	// 先让它们拿到写锁，再检查写锁是否可以获取
+	time.Sleep(50 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for !db.mu.TryLock() {
+		if time.Now().After(deadline) {
+			t.Fatalf("超时放弃的写入拿到写锁后未释放")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	db.mu.Unlock()
+	if err := db.Put([]byte("key"), []byte("later")); err != nil {
+		t.Fatalf("写锁释放后 Put 应成功: %v", err)
+	}
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "later" {
+		t.Fatalf("读取失败: %q, %v", value, err)
+	}
+	db.Close()
+}
+
+func TestDB_WriteTimeoutContinuousReaders(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithWriteTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	db.Put([]byte("key"), []byte("value"))
+
+	// 读者交替持有读锁，任意时刻几乎总有读者；写者排队之后新的读者等待，写入不应超时
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				db.ScanPrefix([]byte("key"), func(key, value []byte) bool {
+					time.Sleep(time.Millisecond)
+					return true
+				})
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		if err := db.Put([]byte("key"), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("持续有读者时写入不应超时: %v", err)
+		}
+	}
+}
+
+func TestDB_MinFreeBytes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fsys := &spaceFileSystem{FileSystem: OSFileSystem}
+	fsys.free.Store(10000)
+	db, err := Open(dir, WithFileSystem(fsys), WithMinFreeBytes(4096))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 可用空间充足时允许写入，且缓存期内不会重复查询
+	for i := 0; i < 10; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")); err != nil {
+			t.Fatalf("空间充足时 Put 失败: %v", err)
+		}
+	}
+	if calls := fsys.calls.Load(); calls != 1 {
+		t.Errorf("缓存期内应只查询一次可用空间, 查询了 %d 次", calls)
+	}
+
+	// 缓存期内按写入的字节数扣减：写入后剩余空间低于阈值的大 value 被拒绝
+	big := make([]byte, 6000)
+	if err := db.Put([]byte("big"), big); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("写入后低于阈值时应返回 ErrInsufficientSpace, 得到: %v", err)
+	}
+	if _, err := db.Get([]byte("big")); err != storage.ErrKeyNotFound {
+		t.Errorf("被拒绝的写入不应可见, 得到: %v", err)
+	}
+
+	// 可用空间低于阈值：拒绝写入，但允许删除以释放空间
+	fsys.free.Store(1000)
+	db.freeCheckedAt = time.Time{}
+	if err := db.Put([]byte("k"), []byte("v")); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("低于阈值时应返回 ErrInsufficientSpace, 得到: %v", err)
+	}
+	if err := db.Delete([]byte("key-0")); err != nil {
+		t.Errorf("低于阈值时应允许删除: %v", err)
+	}
+
+	// 空间恢复后允许写入
+	fsys.free.Store(1 << 20)
+	db.freeCheckedAt = time.Time{}
+	if err := db.Put([]byte("k"), []byte("v")); err != nil {
+		t.Errorf("空间恢复后 Put 失败: %v", err)
+	}
+}
+
+// shortWriteFileSystem 对数据文件返回短写文件的 FileSystem，用于测试不完整写入的处理
+// 每次 Write 最多写入 chunk 字节；budget >= 0 时总共最多再写入 budget 字节，之后的 Write 返回 0 且不报错
+type shortWriteFileSystem struct {
+	FileSystem
+	chunk  int
+	budget atomic.Int64
+}
+
+func (f *shortWriteFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.FileSystem.OpenFile(name, flag, perm)
+	if err != nil || filepath.Ext(name) != ".data" {
+		return file, err
+	}
+	return &shortWriteFile{File: file, fs: f}, nil
+}
+
+type shortWriteFile struct {
+	File
+	fs *shortWriteFileSystem
+}
+
+func (f *shortWriteFile) Write(p []byte) (int, error) {
+	n := len(p)
+	if f.fs.chunk > 0 && n > f.fs.chunk {
+		n = f.fs.chunk
+	}
+	if budget := f.fs.budget.Load(); budget >= 0 {
+		if int64(n) > budget {
+			n = int(budget)
+		}
+		f.fs.budget.Add(-int64(n))
+	}
+	return f.File.Write(p[:n])
+}
+
+func TestDB_ShortWrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fsys := &shortWriteFileSystem{FileSystem: OSFileSystem, chunk: 7}
+	fsys.budget.Store(-1)
+	db, err := Open(dir, WithFileSystem(fsys))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// 每次只写入一部分但持续有进展：应补全写入
+	if err := db.Put([]byte("key-1"), []byte("value-1")); err != nil {
+		t.Fatalf("短写可补全时 Put 失败: %v", err)
+	}
+
+	// 写入中途停滞：应回滚并返回 ErrWriteFailed，索引不更新
+	size := db.activeFile.WriteOff
+	fsys.budget.Store(10)
+	if err := db.Put([]byte("key-2"), []byte("value-2")); !errors.Is(err, ErrWriteFailed) {
+		t.Fatalf("写入不完整时应返回 ErrWriteFailed, 得到: %v", err)
+	}
+	if _, err := db.Get([]byte("key-2")); err != storage.ErrKeyNotFound {
+		t.Fatalf("不完整的写入不应可见, 得到: %v", err)
+	}
+	if off := db.activeFile.WriteOff; off != size {
+		t.Fatalf("写入偏移量应回滚到 %d, 实际 %d", size, off)
+	}
+	if got := testFileSize(t, OSFileSystem, db.activeFile.GetFilePath(dir)); got != size {
+		t.Fatalf("文件应截断回 %d 字节, 实际 %d", size, got)
+	}
+
+	// 恢复后的写入紧接在回滚位置之后，重新打开时没有损坏的记录
+	fsys.budget.Store(-1)
+	if err := db.Put([]byte("key-3"), []byte("value-3")); err != nil {
+		t.Fatalf("恢复后 Put 失败: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for key, expected := range map[string]string{"key-1": "value-1", "key-3": "value-3"} {
+		value, err := db.Get([]byte(key))
+		if err != nil || string(value) != expected {
+			t.Fatalf("%s 不匹配: %q, %v", key, value, err)
+		}
+	}
+	if _, err := db.Get([]byte("key-2")); err != storage.ErrKeyNotFound {
+		t.Fatalf("重新打开后不完整的写入不应可见, 得到: %v", err)
+	}
+}
+
+// stallingFile 写入 Entry 时先写入一部分，然后等待 release 再写入剩余部分，模拟进行中的写入
+type stallingFile struct {
+	File
+	armed   bool
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *stallingFile) Write(p []byte) (int, error) {
+	if !f.armed {
+		return f.File.Write(p)
+	}
+	f.armed = false
+	n, err := f.File.Write(p[:len(p)/2])
+	close(f.started)
+	<-f.release
+	return n, err
+}
+
+func TestDataFile_SafeReadOffset(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	db.Put([]byte("first"), []byte("value-1"))
+	fileID, offset := db.ActiveFileSafeOffset()
+	if fileID != db.activeFile.GetFileID() || offset != db.activeFile.GetWriteOff() {
+		t.Fatalf("活跃文件的安全偏移量不匹配: file=%d offset=%d", fileID, offset)
+	}
+
+	// 第二个 Entry 只写入一半时，安全偏移量不包含它，且读取安全偏移量不被写入阻塞
+	df := db.activeFile
+	stall := &stallingFile{File: df.File, armed: true, started: make(chan struct{}), release: make(chan struct{})}
+	df.File = stall
+	done := make(chan error, 1)
+	entry := NewEntry([]byte("second"), []byte("value-2"))
+	go func() {
+		_, err := df.Write(entry)
+		done <- err
+	}()
+	<-stall.started
+	if got := df.SafeReadOffset(); got != offset {
+		close(stall.release)
+		t.Fatalf("进行中的写入不应计入安全偏移量: got %d, want %d", got, offset)
+	}
+	if size := testFileSize(t, OSFileSystem, df.GetFilePath(dir)); size <= offset {
+		close(stall.release)
+		t.Fatalf("文件中应已有不完整的 Entry: %d", size)
+	}
+	close(stall.release)
+	if err := <-done; err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if got, want := df.SafeReadOffset(), offset+int64(entry.Size()); got != want {
+		t.Fatalf("写入完成后安全偏移量不匹配: got %d, want %d", got, want)
+	}
+	df.File = stall.File
+}
+
+func TestDB_Stat(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("first"), []byte("v1"))
+	db.Put([]byte("second"), []byte("value-2"))
+
+	pos, ok := db.Stat([]byte("second"))
+	if !ok {
+		t.Fatalf("已写入的 key 应存在")
+	}
+	firstSize := int64(HeaderSize + len("first") + len("v1"))
+	if pos.FileID != 0 || pos.Offset != firstSize {
+		t.Errorf("位置不匹配: got file=%d offset=%d, want file=0 offset=%d", pos.FileID, pos.Offset, firstSize)
+	}
+	if want := uint32(HeaderSize + len("second") + len("value-2")); pos.Size != want {
+		t.Errorf("大小不匹配: got %d, want %d", pos.Size, want)
+	}
+	meta, err := db.EntryMeta([]byte("second"))
+	if err != nil || meta.FileID != pos.FileID || meta.Offset != pos.Offset || meta.Size != pos.Size {
+		t.Errorf("位置应与 EntryMeta 一致: %+v, %+v, %v", pos, meta, err)
+	}
+
+	// 返回的是副本，修改不影响索引
+	pos.Offset = 12345
+	if again, _ := db.Stat([]byte("second")); again.Offset != firstSize {
+		t.Errorf("修改返回值不应影响索引: %d", again.Offset)
+	}
+
+	db.Delete([]byte("second"))
+	if pos, ok := db.Stat([]byte("second")); ok || pos != nil {
+		t.Errorf("删除后不应存在: %+v", pos)
+	}
+	if _, ok := db.Stat([]byte("missing")); ok {
+		t.Errorf("不存在的 key 不应存在")
+	}
+}
+
+func TestDB_Fingerprint(t *testing.T) {
+	open := func(opts ...Option) *DB {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		db, err := Open(dir, opts...)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	fingerprint := func(db *DB) []byte {
+		fp, err := db.Fingerprint()
+		if err != nil {
+			t.Fatalf("计算指纹失败: %v", err)
+		}
+		return fp
+	}
+
+	a := open()
+	b := open(WithIndexType(IndexTypeMap), WithDataFileSizeLimit(256))
+	if !bytes.Equal(fingerprint(a), fingerprint(b)) {
+		t.Fatalf("两个空数据库的指纹应相同")
+	}
+
+	// 逻辑内容相同，但写入顺序、覆盖与删除的历史以及文件布局都不同
+	for i := 0; i < 20; i++ {
+		a.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	for i := 19; i >= 0; i-- {
+		b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("stale"))
+	}
+	b.Put([]byte("removed"), []byte("x"))
+	for i := 19; i >= 0; i-- {
+		b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	b.Delete([]byte("removed"))
+	if err := b.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	want := fingerprint(a)
+	if len(want) != 32 {
+		t.Fatalf("指纹长度不匹配: %d", len(want))
+	}
+	if got := fingerprint(b); !bytes.Equal(got, want) {
+		t.Fatalf("逻辑内容相同的数据库指纹应相同: %x != %x", got, want)
+	}
+
+	// 任一 value 不同时指纹不同，恢复后再次相同
+	b.Put([]byte("key-07"), []byte("changed"))
+	if bytes.Equal(fingerprint(b), want) {
+		t.Fatalf("value 不同时指纹应不同")
+	}
+	b.Put([]byte("key-07"), []byte("value-7"))
+	if !bytes.Equal(fingerprint(b), want) {
+		t.Fatalf("恢复后指纹应相同")
+	}
+
+	// 多出一个 key 时指纹不同
+	b.Put([]byte("extra"), nil)
+	if bytes.Equal(fingerprint(b), want) {
+		t.Fatalf("多出 key 时指纹应不同")
+	}
+
+	// key 与 value 的边界不同时指纹不同
+	c, d := open(), open()
+	c.Put([]byte("ab"), []byte("c"))
+	d.Put([]byte("a"), []byte("bc"))
+	if bytes.Equal(fingerprint(c), fingerprint(d)) {
+		t.Fatalf("key 与 value 的边界不同时指纹应不同")
+	}
+}
+
+func TestDB_MemoryStats(t *testing.T) {
+	for _, indexType := range []IndexType{IndexTypeMap, IndexTypeART, IndexTypeHybrid} {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		db, err := Open(dir, WithIndexType(indexType), WithSuffixIndex(true))
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+
+		empty, err := db.MemoryStats()
+		if err != nil {
+			t.Fatalf("MemoryStats 失败: %v", err)
+		}
+		if empty.Bloom <= 0 {
+			t.Errorf("布隆过滤器估算值应大于 0 (index=%d): %+v", indexType, empty)
+		}
+
+		for i := 0; i < 1000; i++ {
+			db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("v"))
+		}
+		stats, _ := db.MemoryStats()
+		if stats.Index <= empty.Index || stats.Suffix <= empty.Suffix {
+			t.Errorf("写入后索引估算值应增长 (index=%d): before %+v, after %+v", indexType, empty, stats)
+		}
+		if stats.Bloom != empty.Bloom {
+			t.Errorf("布隆过滤器大小固定，估算值不应变化 (index=%d): before %d, after %d", indexType, empty.Bloom, stats.Bloom)
+		}
+		if stats.Total != stats.Index+stats.Bloom+stats.Suffix {
+			t.Errorf("Total 应为各项之和 (index=%d): %+v", indexType, stats)
+		}
+
+		tiers := stats.HotTier + stats.WarmTier + stats.ColdTier
+		if indexType == IndexTypeHybrid {
+			if stats.ColdTier <= 0 || tiers > stats.Index {
+				t.Errorf("混合索引各层估算值不合理: %+v", stats)
+			}
+		} else if tiers != 0 {
+			t.Errorf("非混合索引不应报告分层估算值 (index=%d): %+v", indexType, stats)
+		}
+		db.Close()
+	}
+}
+
+func TestDB_EstimateKeyCount(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// HyperLogLog 的标准误差约 0.81%，允许 4 倍标准误差
+	const n = 50000
+	within := func(estimate uint64, want int) bool {
+		return math.Abs(float64(estimate)-float64(want))/float64(want) <= 4*0.0081
+	}
+	for i := 0; i < n; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%06d", i)), []byte("v")); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+	}
+	// 覆盖写入不增加不同 key 的数量
+	for i := 0; i < n; i += 3 {
+		db.Put([]byte(fmt.Sprintf("key-%06d", i)), []byte("v2"))
+	}
+	if estimate := db.EstimateKeyCount(); !within(estimate, n) {
+		t.Fatalf("估算值超出误差范围: got %d, want ~%d", estimate, n)
+	}
+	count, err := db.KeyCount()
+	if err != nil || count.Exact != n {
+		t.Fatalf("精确数量不匹配: %+v, %v", count, err)
+	}
+
+	// 删除一半的 key，重新打开后估算值从索引重建
+	for i := 0; i < n; i += 2 {
+		db.Delete([]byte(fmt.Sprintf("key-%06d", i)))
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if estimate := db.EstimateKeyCount(); !within(estimate, n/2) {
+		t.Fatalf("重新打开后估算值超出误差范围: got %d, want ~%d", estimate, n/2)
+	}
+}
+
+func TestDB_ReuseBuffers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithReuseBuffers(true), WithDataFileSizeLimit(64*1024))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// value 内容由 key 与轮次决定；若返回的 value 引用了被复用的缓冲区，
+	// 之后的写入或读取会改写它，校验时就会发现内容不一致（-race 下还会报告数据竞争）
+	value := func(w, i, round int) []byte {
+		size := 16 + (w*31+i*7)%512
+		if i%50 == 0 {
+			size = maxPooledBufferSize + 1 // 不放回缓冲池的大 value
+		}
+		return bytes.Repeat([]byte{byte('a' + (w+i+round)%26)}, size)
+	}
+
+	const writers, keys, rounds = 4, 100, 3
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var held [][]byte
+			for round := 0; round < rounds; round++ {
+				for i := 0; i < keys; i++ {
+					key := []byte(fmt.Sprintf("w%d-key-%03d", w, i))
+					if err := db.Put(key, value(w, i, round)); err != nil {
+						errs <- err
+						return
+					}
+					got, err := db.Get(key)
+					if err != nil {
+						errs <- err
+						return
+					}
+					held = append(held, got)
+				}
+			}
+			// 所有读写结束后，之前返回的 value 仍应保持原样
+			for n, got := range held {
+				round, i := n/keys, n%keys
+				if !bytes.Equal(got, value(w, i, round)) {
+					errs <- fmt.Errorf("w%d key %d round %d 的 value 被改写", w, i, round)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("并发读写失败: %v", err)
+	}
+
+	// 重新打开后数据完整
+	db.Close()
+	db, err = Open(dir, WithReuseBuffers(true))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for w := 0; w < writers; w++ {
+		for i := 0; i < keys; i++ {
+			got, err := db.Get([]byte(fmt.Sprintf("w%d-key-%03d", w, i)))
+			if err != nil || !bytes.Equal(got, value(w, i, rounds-1)) {
+				t.Fatalf("重新打开后 w%d key %d 不匹配: %v", w, i, err)
+			}
+		}
+	}
+}
+
+func BenchmarkDB_ReuseBuffers(b *testing.B) {
+	value := bytes.Repeat([]byte("v"), 1024)
+	for _, reuse := range []bool{false, true} {
+		dir, err := os.MkdirTemp("", "bitcask_bench")
+		if err != nil {
+			b.Fatalf("创建临时目录失败: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		db, err := Open(dir, WithReuseBuffers(reuse))
+		if err != nil {
+			b.Fatalf("打开数据库失败: %v", err)
+		}
+		defer db.Close()
+
+		b.Run(fmt.Sprintf("Put/reuse=%v", reuse), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				db.Put([]byte(fmt.Sprintf("key-%d", i%1000)), value)
+			}
+		})
+		b.Run(fmt.Sprintf("Get/reuse=%v", reuse), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				db.Get([]byte(fmt.Sprintf("key-%d", i%1000)))
+			}
+		})
+	}
+}
+
+func TestDB_KeysModifiedSince(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		db.Put([]byte(key), []byte("old"))
+	}
+	time.Sleep(5 * time.Millisecond)
+	cutoff := time.Now().UnixNano()
+	time.Sleep(5 * time.Millisecond)
+
+	// 截止时间之后：覆盖 b，新增 e，删除 d
+	db.Put([]byte("b"), []byte("new"))
+	db.Put([]byte("e"), []byte("new"))
+	db.Delete([]byte("d"))
+
+	check := func(stage string) {
+		var got []string
+		for _, key := range db.KeysModifiedSince(cutoff) {
+			got = append(got, string(key))
+		}
+		want := []string{"b", "e"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("%s: 修改过的 key 不匹配: got %v, want %v", stage, got, want)
+		}
+	}
+	check("写入后")
+
+	if keys := db.KeysModifiedSince(0); len(keys) != 4 {
+		t.Fatalf("ts=0 时应返回全部 4 个 key, 得到 %d", len(keys))
+	}
+	if keys := db.KeysModifiedSince(time.Now().UnixNano()); len(keys) != 0 {
+		t.Fatalf("当前时间之后不应有修改, 得到 %d 个 key", len(keys))
+	}
+
+	// 时间戳保存在数据文件中，重启后结果不变
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	check("重启后")
+}
+
+// BenchmarkDB_ZipfianReadHeavy 在 Zipf 分布、95% 读的负载下测量吞吐与延迟分位数
+func BenchmarkDB_ZipfianReadHeavy(b *testing.B) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		b.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		b.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	w := bench.Workload{
+		Keys:         100000,
+		Distribution: bench.DistributionZipfian,
+		ReadRatio:    0.95,
+		ValueSize:    64,
+		ValueSizeMax: 512,
+		Seed:         1,
+	}
+	if err := bench.Preload(db, w); err != nil {
+		b.Fatalf("预写入失败: %v", err)
+	}
+
+	b.ResetTimer()
+	result, err := bench.Run(db, w, b.N, 4)
+	if err != nil {
+		b.Fatalf("运行负载失败: %v", err)
+	}
+	b.StopTimer()
+	result.Report(b)
+}
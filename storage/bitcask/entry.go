@@ -3,6 +3,7 @@ package bitcask
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"hash/crc32"
 	"time"
 
@@ -21,20 +22,61 @@ const (
 	CompressionZSTD CompressionType = 2
 )
 
+// EntryType 定义 Entry 的类型
+// 与压缩标志共用 Flags 字段：低 8 位为压缩类型，高 8 位为 Entry 类型
+type EntryType uint8
+
+const (
+	// EntryTypeNormal 普通的键值对
+	EntryTypeNormal EntryType = 0
+	// EntryTypeTombstone 墓碑记录，表示 key 已被删除
+	EntryTypeTombstone EntryType = 1
+	// EntryTypeIntentCommit 意图日志的提交标记，仅出现在意图日志中
+	EntryTypeIntentCommit EntryType = 2
+	// EntryTypeResolved 启动引导写回的冲突解决结果，读取时与普通键值对相同，
+	// 之后的启动引导直接采用它，不再与之前的版本比较，见 ConflictResolver
+	EntryTypeResolved EntryType = 3
+)
+
+// String 返回 Entry 类型的名称
+func (t EntryType) String() string {
+	switch t {
+	case EntryTypeNormal:
+		return "normal"
+	case EntryTypeTombstone:
+		return "tombstone"
+	case EntryTypeIntentCommit:
+		return "intent_commit"
+	case EntryTypeResolved:
+		return "resolved"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// inDataFile 返回该类型的 Entry 是否可以出现在数据文件中
+func (t EntryType) inDataFile() bool {
+	return t == EntryTypeNormal || t == EntryTypeTombstone || t == EntryTypeResolved
+}
+
 // Entry 表示存储在数据文件中的记录条目
-// 格式：| CRC32 (4B) | Timestamp (8B) | KeySize (4B) | ValueSize (4B) | Flags (2B) | Key | Value |
+// 格式：| CRC32 (4B) | Timestamp (8B) | Seq (8B) | KeySize (4B) | ValueSize (4B) | Flags (2B) | Key | Value |
+// Flags：| Type (高 8 位) | Compression (低 8 位) |
 type Entry struct {
 	CRC       uint32          // 校验和，4 字节
 	Timestamp int64           // 时间戳，8 字节
+	Seq       uint64          // 写入序号，8 字节，由 DB 单调递增分配
 	KeySize   uint32          // Key 长度，4 字节
 	ValueSize uint32          // Value 长度，4 字节
-	Flags     CompressionType // 压缩标志，2 字节
+	Flags     CompressionType // 压缩标志，Flags 低 8 位
+	Type      EntryType       // Entry 类型，Flags 高 8 位
 	Key       []byte          // 键数据
 	Value     []byte          // 值数据
 }
 
-// 固定头部大小：CRC(4) + Timestamp(8) + KeySize(4) + ValueSize(4) + Flags(2) = 22 字节
-const HeaderSize = 22
+// 固定头部大小：CRC(4) + Timestamp(8) + Seq(8) + KeySize(4) + ValueSize(4) + Flags(2) = 30 字节
+// 这是数据格式版本 2 的头部，版本 1 的 22 字节头部（没有 Seq）在打开时升级，见 format.go
+const HeaderSize = 30
 
 // NewEntry 创建一个新的 Entry 实例
 // 参数：
@@ -54,6 +96,22 @@ func NewEntry(key []byte, value []byte) *Entry {
 	}
 }
 
+// NewTombstoneEntry 创建一个墓碑 Entry，用于持久化删除操作
+// 参数：
+//   - key: 被删除的键
+//
+// 返回：
+//   - *Entry: 墓碑 Entry 指针
+func NewTombstoneEntry(key []byte) *Entry {
+	return &Entry{
+		Timestamp: time.Now().UnixNano(),
+		KeySize:   uint32(len(key)),
+		Flags:     CompressionNone,
+		Type:      EntryTypeTombstone,
+		Key:       key,
+	}
+}
+
 // NewEntryWithCompression 创建一个带压缩的 Entry
 func NewEntryWithCompression(key []byte, value []byte, compression CompressionType) *Entry {
 	entry := &Entry{
@@ -139,31 +197,39 @@ func (e *Entry) DecompressValue() error {
 
 // Encode 将 Entry 编码为字节切片
 // 编码顺序：小端字节序
-// 格式：| CRC32 (4B) | Timestamp (8B) | KeySize (4B) | ValueSize (4B) | Flags (2B) | Key | Value |
+// 格式：| CRC32 (4B) | Timestamp (8B) | Seq (8B) | KeySize (4B) | ValueSize (4B) | Flags (2B) | Key | Value |
 //
 // 返回：
 //   - []byte: 编码后的字节切片
 func (e *Entry) Encode() []byte {
 	// 计算总大小并分配缓冲区
 	buf := make([]byte, HeaderSize+int(e.KeySize+e.ValueSize))
+	e.encodeTo(buf)
+	return buf
+}
 
+// encodeTo 将 Entry 编码到 buf，buf 的长度必须等于 Size()
+func (e *Entry) encodeTo(buf []byte) {
 	// 写入 Timestamp (8 字节，小端序)
 	binary.LittleEndian.PutUint64(buf[4:12], uint64(e.Timestamp))
 
+	// 写入 Seq (8 字节，小端序)
+	binary.LittleEndian.PutUint64(buf[12:20], e.Seq)
+
 	// 写入 KeySize (4 字节，小端序)
-	binary.LittleEndian.PutUint32(buf[12:16], e.KeySize)
+	binary.LittleEndian.PutUint32(buf[20:24], e.KeySize)
 
 	// 写入 ValueSize (4 字节，小端序)
-	binary.LittleEndian.PutUint32(buf[16:20], e.ValueSize)
+	binary.LittleEndian.PutUint32(buf[24:28], e.ValueSize)
 
-	// 写入 Flags (2 字节，小端序)
-	binary.LittleEndian.PutUint16(buf[20:22], uint16(e.Flags))
+	// 写入 Flags (2 字节，小端序)：高 8 位为类型，低 8 位为压缩标志
+	binary.LittleEndian.PutUint16(buf[28:30], uint16(e.Type)<<8|uint16(e.Flags&0xFF))
 
 	// 写入 Key
-	copy(buf[22:22+e.KeySize], e.Key)
+	copy(buf[HeaderSize:HeaderSize+e.KeySize], e.Key)
 
 	// 写入 Value
-	copy(buf[22+e.KeySize:], e.Value)
+	copy(buf[HeaderSize+e.KeySize:], e.Value)
 
 	// 计算 CRC32 校验和（不包括 CRC 字段本身）
 	// 使用 IEEE 多项式
@@ -171,8 +237,6 @@ func (e *Entry) Encode() []byte {
 
 	// 将 CRC 写入头部（4 字节，小端序）
 	binary.LittleEndian.PutUint32(buf[0:4], e.CRC)
-
-	return buf
 }
 
 // Decode 从字节切片解码出 Entry
@@ -183,6 +247,50 @@ func (e *Entry) Encode() []byte {
 //   - *Entry: 解码后的 Entry 指针
 //   - error: 解码错误
 func Decode(data []byte) (*Entry, error) {
+	return decode(data, true)
+}
+
+// decode 解码 Entry，verify 为 false 时跳过 CRC 校验
+// 跳过校验仅用于已经校验过的可信数据（例如 Merge 的源文件）
+func decode(data []byte, verify bool) (*Entry, error) {
+	// 解析固定头部
+	entry, err := DecodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证数据长度
+	totalSize := HeaderSize + int(entry.KeySize) + int(entry.ValueSize)
+	if len(data) < totalSize {
+		return nil, ErrInvalidEntry
+	}
+
+	// 读取 Key
+	entry.Key = data[HeaderSize : HeaderSize+entry.KeySize]
+
+	// 读取 Value
+	entry.Value = data[HeaderSize+entry.KeySize : totalSize]
+
+	// 验证 CRC
+	if !verify {
+		return entry, nil
+	}
+	calculatedCRC := crc32.ChecksumIEEE(data[4:totalSize])
+	if calculatedCRC != entry.CRC {
+		return nil, ErrCRCMismatch
+	}
+
+	return entry, nil
+}
+
+// DecodeHeader 从字节切片解析 Entry 的固定头部（不包含 Key 和 Value，也不校验 CRC）
+// 参数：
+//   - data: 至少 HeaderSize 字节的头部数据
+//
+// 返回：
+//   - *Entry: 只填充了头部字段的 Entry 指针
+//   - error: 解码错误
+func DecodeHeader(data []byte) (*Entry, error) {
 	// 检查数据长度是否足够
 	if len(data) < HeaderSize {
 		return nil, ErrInvalidEntry
@@ -196,32 +304,19 @@ func Decode(data []byte) (*Entry, error) {
 	// 读取 Timestamp (8 字节，小端序)
 	entry.Timestamp = int64(binary.LittleEndian.Uint64(data[4:12]))
 
+	// 读取 Seq (8 字节，小端序)
+	entry.Seq = binary.LittleEndian.Uint64(data[12:20])
+
 	// 读取 KeySize (4 字节，小端序)
-	entry.KeySize = binary.LittleEndian.Uint32(data[12:16])
+	entry.KeySize = binary.LittleEndian.Uint32(data[20:24])
 
 	// 读取 ValueSize (4 字节，小端序)
-	entry.ValueSize = binary.LittleEndian.Uint32(data[16:20])
-
-	// 读取 Flags (2 字节，小端序)
-	entry.Flags = CompressionType(binary.LittleEndian.Uint16(data[20:22]))
+	entry.ValueSize = binary.LittleEndian.Uint32(data[24:28])
 
-	// 验证数据长度
-	totalSize := HeaderSize + int(entry.KeySize+entry.ValueSize)
-	if len(data) < totalSize {
-		return nil, ErrInvalidEntry
-	}
-
-	// 读取 Key
-	entry.Key = data[22 : 22+entry.KeySize]
-
-	// 读取 Value
-	entry.Value = data[22+entry.KeySize : totalSize]
-
-	// 验证 CRC
-	calculatedCRC := crc32.ChecksumIEEE(data[4:totalSize])
-	if calculatedCRC != entry.CRC {
-		return nil, ErrCRCMismatch
-	}
+	// 读取 Flags (2 字节，小端序)：高 8 位为类型，低 8 位为压缩标志
+	flags := binary.LittleEndian.Uint16(data[28:30])
+	entry.Flags = CompressionType(flags & 0xFF)
+	entry.Type = EntryType(flags >> 8)
 
 	return entry, nil
 }
@@ -263,11 +358,21 @@ func (e *Entry) GetTimestamp() int64 {
 	return e.Timestamp
 }
 
+// GetSeq 获取写入序号
+func (e *Entry) GetSeq() uint64 {
+	return e.Seq
+}
+
 // GetFlags 获取压缩标志
 func (e *Entry) GetFlags() CompressionType {
 	return e.Flags
 }
 
+// IsTombstone 判断是否为墓碑记录
+func (e *Entry) IsTombstone() bool {
+	return e.Type == EntryTypeTombstone
+}
+
 // Size 返回 Entry 的总大小（字节）
 func (e *Entry) Size() uint32 {
 	return HeaderSize + e.KeySize + e.ValueSize
@@ -289,9 +394,11 @@ func (e *Entry) Equals(other *Entry) bool {
 	}
 	return e.CRC == other.CRC &&
 		e.Timestamp == other.Timestamp &&
+		e.Seq == other.Seq &&
 		e.KeySize == other.KeySize &&
 		e.ValueSize == other.ValueSize &&
 		e.Flags == other.Flags &&
+		e.Type == other.Type &&
 		bytes.Equal(e.Key, other.Key) &&
 		bytes.Equal(e.Value, other.Value)
 }
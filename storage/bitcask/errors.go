@@ -25,3 +25,36 @@ var ErrSeekFailed = errors.New("seek failed")
 
 // ErrSyncFailed 表示同步失败
 var ErrSyncFailed = errors.New("sync failed")
+
+// ErrUnrecognizedFile 表示数据文件不是可识别的 TideKV 数据文件
+var ErrUnrecognizedFile = errors.New("unrecognized data file")
+
+// ErrKeyTooLarge 表示 key 超过了允许的最大长度
+var ErrKeyTooLarge = errors.New("key too large")
+
+// ErrValueTooLarge 表示 value 超过了允许的最大长度
+var ErrValueTooLarge = errors.New("value too large")
+
+// ErrEntryTooLarge 表示 Entry 超过了单个数据文件的大小限制，且策略为拒绝写入
+var ErrEntryTooLarge = errors.New("entry too large")
+
+// ErrInsufficientSpace 表示写入后磁盘可用空间将低于 MinFreeBytes
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrSuffixIndexDisabled 表示未启用后缀索引
+var ErrSuffixIndexDisabled = errors.New("suffix index is disabled")
+
+// ErrMirrorQueueFull 表示镜像队列已满，Entry 未写入镜像目录
+var ErrMirrorQueueFull = errors.New("mirror queue full")
+
+// ErrSecondaryIndexExists 表示同名的二级索引已存在
+var ErrSecondaryIndexExists = errors.New("secondary index already exists")
+
+// ErrWriteTimeout 表示在 WriteTimeout 内未能获取写锁，写入没有执行
+var ErrWriteTimeout = errors.New("write lock timeout")
+
+// ErrMergeUnfinished 表示上一次 Merge 已提交但未能完成发布，需要重新打开数据库由恢复流程完成
+var ErrMergeUnfinished = errors.New("merge unfinished")
+
+// ErrInvalidOptions 表示配置选项不合法
+var ErrInvalidOptions = errors.New("invalid options")
@@ -0,0 +1,236 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ==================== 数据格式版本 ====================
+//
+// 版本 1 的 Entry 头部为 22 字节：| CRC32 (4B) | Timestamp (8B) | KeySize (4B) | ValueSize (4B) | Flags (2B) |，
+// 版本 2 在 Timestamp 之后加入写入序号 Seq (8B)，头部为 HeaderSize（30）字节，Flags 的高 8 位为 Entry 类型。
+// 目录中的 format 文件记录数据格式版本。没有 format 文件的目录按版本 1 处理：打开时先把每个版本 1 的数据文件
+// 改写为当前格式（按文件 ID 与文件内的顺序分配写入序号，写入临时文件并同步后原子地替换原文件），
+// 全部改写完成后才写入 format 文件，之后的流程只处理当前格式。
+// 每个文件按首个能通过 CRC 校验的 Entry 判断格式：按当前格式解析成功的文件（升级中途崩溃前已改写的文件）保持不变，
+// 按版本 1 解析成功的文件才改写；两种格式都无法解析的文件保持不变，交给头部校验与启动引导处理。
+// 与启动引导相同，改写时跳过无法解析的数据（损坏或因崩溃写入不完整的 Entry）并记录日志，不中止打开。
+
+const (
+	// FormatVersion 当前的数据格式版本
+	FormatVersion = 2
+
+	// formatFileName 记录数据格式版本的文件名
+	formatFileName = "format"
+	formatMagic    = "TKVF"
+
+	// headerSizeV1 版本 1 的 Entry 头部大小：CRC(4) + Timestamp(8) + KeySize(4) + ValueSize(4) + Flags(2)
+	headerSizeV1 = 22
+
+	// upgradeTempSuffix 升级时改写的数据文件在替换原文件之前的临时后缀
+	upgradeTempSuffix = ".upgrade"
+)
+
+// formatPath 返回 format 文件的路径
+func (db *DB) formatPath() string {
+	return filepath.Join(db.dir, formatFileName)
+}
+
+// readFormatVersion 读取目录的数据格式版本，format 文件不存在时返回满足 os.IsNotExist 的错误
+func (db *DB) readFormatVersion() (uint32, error) {
+	data, err := readFile(db.options.FileSystem, db.formatPath())
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 12 || !bytes.Equal(data[:4], []byte(formatMagic)) ||
+		crc32.ChecksumIEEE(data[:8]) != binary.LittleEndian.Uint32(data[8:]) {
+		return 0, fmt.Errorf("%w: format 文件已损坏", ErrUnrecognizedFile)
+	}
+	return binary.LittleEndian.Uint32(data[4:8]), nil
+}
+
+// upgradeFormat 检查目录的数据格式版本，必要时把版本 1 的数据文件升级为当前格式
+// 在打开任何数据文件之前调用
+func (db *DB) upgradeFormat() error {
+	version, err := db.readFormatVersion()
+	switch {
+	case err == nil && version == FormatVersion:
+		return nil
+	case err == nil && version > FormatVersion:
+		return fmt.Errorf("%w: 数据格式版本 %d 高于支持的版本 %d", ErrUnrecognizedFile, version, FormatVersion)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+
+	fsys := db.options.FileSystem
+	files, err := fsys.ReadDir(db.dir)
+	if err != nil {
+		return fmt.Errorf("读取目录失败: %w", err)
+	}
+	var fileIDs []uint32
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// 上次升级中途崩溃留下的临时文件，原文件仍然完整
+		if strings.HasSuffix(f.Name(), upgradeTempSuffix) {
+			if err := fsys.Remove(filepath.Join(db.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("删除升级临时文件失败: %w", err)
+			}
+			continue
+		}
+		if id, ok := db.options.FileNamer.ParseDataFileName(f.Name()); ok {
+			fileIDs = append(fileIDs, id)
+		}
+	}
+	sort.Slice(fileIDs, func(i, j int) bool { return fileIDs[i] < fileIDs[j] })
+
+	var seq uint64
+	for _, fileID := range fileIDs {
+		if seq, err = db.upgradeDataFile(fileID, seq); err != nil {
+			return fmt.Errorf("升级数据文件 %d 失败: %w", fileID, err)
+		}
+	}
+
+	buf := []byte(formatMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, FormatVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	return writeFileSynced(fsys, db.formatPath(), buf)
+}
+
+// upgradeDataFile 将一个版本 1 的数据文件改写为当前格式，已是当前格式的文件保持不变
+// 参数：
+//   - fileID: 文件 ID
+//   - seq: 之前的文件中已分配的最大写入序号
+//
+// 返回：
+//   - uint64: 包括该文件在内已分配的最大写入序号
+//   - error: 读取或改写失败
+func (db *DB) upgradeDataFile(fileID uint32, seq uint64) (uint64, error) {
+	fsys := db.options.FileSystem
+	path := db.GetFilePath(fileID)
+	data, err := readFile(fsys, path)
+	if err != nil {
+		return seq, err
+	}
+
+	switch detectFormat(data) {
+	case 0:
+		// 没有可以解析的 Entry（空文件或无关文件）
+		return seq, nil
+	case FormatVersion:
+		// 之前升级过的文件，继续之后的写入序号
+		for offset := 0; offset < len(data); {
+			entry, err := Decode(data[offset:])
+			if err != nil {
+				offset++
+				continue
+			}
+			if entry.Seq > seq {
+				seq = entry.Seq
+			}
+			offset += int(entry.Size())
+		}
+		return seq, nil
+	}
+
+	var out []byte
+	kept := 0
+	for offset := 0; offset < len(data); {
+		entry, err := decodeV1(data[offset:])
+		if err != nil {
+			// 与启动引导相同，跳过无法解析的数据继续向后查找；逐字节查找下一个能通过 CRC 校验的 Entry
+			offset++
+			continue
+		}
+		size := headerSizeV1 + int(entry.KeySize) + int(entry.ValueSize)
+		offset += size
+		kept += size
+
+		seq++
+		entry.Seq = seq
+		out = append(out, entry.Encode()...)
+	}
+	if dropped := len(data) - kept; dropped > 0 {
+		log.Printf("bitcask: 升级数据文件 %s 时丢弃了 %d 字节无法解析的数据", path, dropped)
+	}
+	return seq, writeFileSynced(fsys, path, out)
+}
+
+// detectFormat 按文件中首个能通过 CRC 校验的 Entry 判断数据格式版本
+// 返回：
+//   - uint32: FormatVersion 或 1，没有可以解析的 Entry 时返回 0
+func detectFormat(data []byte) uint32 {
+	for offset := 0; offset < len(data); offset++ {
+		if _, err := Decode(data[offset:]); err == nil {
+			return FormatVersion
+		}
+		if _, err := decodeV1(data[offset:]); err == nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+// decodeV1 解码一个版本 1 的 Entry 并校验 CRC
+// 版本 1 的 Flags 只有压缩标志，解码后的 Entry 类型为 EntryTypeNormal
+// 返回：
+//   - *Entry: 解码后的 Entry，Key 与 Value 引用 data
+//   - error: 数据不完整返回 ErrInvalidEntry，校验失败返回 ErrCRCMismatch
+func decodeV1(data []byte) (*Entry, error) {
+	if len(data) < headerSizeV1 {
+		return nil, ErrInvalidEntry
+	}
+	entry := &Entry{
+		CRC:       binary.LittleEndian.Uint32(data[0:4]),
+		Timestamp: int64(binary.LittleEndian.Uint64(data[4:12])),
+		KeySize:   binary.LittleEndian.Uint32(data[12:16]),
+		ValueSize: binary.LittleEndian.Uint32(data[16:20]),
+		Flags:     CompressionType(binary.LittleEndian.Uint16(data[20:22])),
+	}
+	totalSize := int64(headerSizeV1) + int64(entry.KeySize) + int64(entry.ValueSize)
+	if int64(len(data)) < totalSize {
+		return nil, ErrInvalidEntry
+	}
+	if crc32.ChecksumIEEE(data[4:totalSize]) != entry.CRC || entry.Flags > CompressionZSTD {
+		return nil, ErrCRCMismatch
+	}
+	entry.Key = data[headerSizeV1 : headerSizeV1+entry.KeySize]
+	entry.Value = data[headerSizeV1+entry.KeySize : totalSize]
+	return entry, nil
+}
+
+// writeFileSynced 将 data 写入临时文件并同步，再原子地替换 name
+func writeFileSynced(fsys FileSystem, name string, data []byte) error {
+	temp := name + upgradeTempSuffix
+	file, err := fsys.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		fsys.Remove(temp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		fsys.Remove(temp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		fsys.Remove(temp)
+		return err
+	}
+	if err := fsys.Rename(temp, name); err != nil {
+		fsys.Remove(temp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// copyV1Fixture 把 testdata/v1 中版本 1 的数据文件复制到新的临时目录
+// 这些文件由加入写入序号之前的版本写入：WithDataFileSizeLimit(64)，依次写入
+// user/1=alice, user/2=bob, user/3=carol, user/2=bobby, config=v1-format, user/4=""
+func copyV1Fixture(t *testing.T, fsys FileSystem) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	files, err := filepath.Glob(filepath.Join("testdata", "v1", "*.data"))
+	if err != nil || len(files) != 3 {
+		t.Fatalf("读取版本 1 的数据文件失败: %v, %v", files, err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", file, err)
+		}
+		writeTestFile(t, fsys, filepath.Join(dir, filepath.Base(file)), data)
+	}
+	return dir
+}
+
+// checkV1Fixture 检查从版本 1 的数据升级之后的内容，写入序号按原来的写入顺序递增
+func checkV1Fixture(t *testing.T, db *DB) {
+	t.Helper()
+	want := []struct{ key, value string }{
+		{"user/1", "alice"}, {"user/3", "carol"}, {"user/2", "bobby"}, {"config", "v1-format"}, {"user/4", ""},
+	}
+	var prev uint64
+	for _, w := range want {
+		value, err := db.Get([]byte(w.key))
+		if err != nil || string(value) != w.value {
+			t.Fatalf("%s 的值不匹配: %q, %v", w.key, value, err)
+		}
+		meta, err := db.EntryMeta([]byte(w.key))
+		if err != nil {
+			t.Fatalf("读取 %s 的元信息失败: %v", w.key, err)
+		}
+		if meta.Seq <= prev {
+			t.Fatalf("%s 的写入序号应按写入顺序递增: %d <= %d", w.key, meta.Seq, prev)
+		}
+		prev = meta.Seq
+	}
+}
+
+func TestDB_OpenV1Format(t *testing.T) {
+	dir := copyV1Fixture(t, OSFileSystem)
+	if _, err := os.Stat(filepath.Join(dir, formatFileName)); !os.IsNotExist(err) {
+		t.Fatalf("版本 1 的目录不应有 format 文件: %v", err)
+	}
+
+	db, err := Open(dir, WithDataFileSizeLimit(64))
+	if err != nil {
+		t.Fatalf("打开版本 1 的目录失败: %v", err)
+	}
+	checkV1Fixture(t, db)
+	if version, err := db.readFormatVersion(); err != nil || version != FormatVersion {
+		t.Fatalf("升级之后应记录当前格式版本: %d, %v", version, err)
+	}
+
+	// 升级之后照常写入、合并与重新打开
+	if err := db.Put([]byte("user/5"), []byte("dave")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(dir, WithDataFileSizeLimit(64))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	checkV1Fixture(t, db)
+	if value, err := db.Get([]byte("user/5")); err != nil || string(value) != "dave" {
+		t.Fatalf("升级之后的写入不匹配: %q, %v", value, err)
+	}
+}
+
+func TestDB_OpenV1FormatResume(t *testing.T) {
+	// 模拟升级中途崩溃：第一个文件已改写，其余文件仍是版本 1，还留有未完成的临时文件，没有 format 文件
+	upgraded := copyV1Fixture(t, OSFileSystem)
+	db, err := Open(upgraded, WithDataFileSizeLimit(64))
+	if err != nil {
+		t.Fatalf("打开版本 1 的目录失败: %v", err)
+	}
+	db.Close()
+
+	dir := copyV1Fixture(t, OSFileSystem)
+	first := DefaultFileNamer.DataFileName(0)
+	data, err := os.ReadFile(filepath.Join(upgraded, first))
+	if err != nil {
+		t.Fatalf("读取升级之后的文件失败: %v", err)
+	}
+	writeTestFile(t, OSFileSystem, filepath.Join(dir, first), data)
+	writeTestFile(t, OSFileSystem, filepath.Join(dir, DefaultFileNamer.DataFileName(1)+upgradeTempSuffix), []byte("partial"))
+
+	db, err = Open(dir, WithDataFileSizeLimit(64))
+	if err != nil {
+		t.Fatalf("继续升级失败: %v", err)
+	}
+	defer db.Close()
+	checkV1Fixture(t, db)
+	if _, err := os.Stat(filepath.Join(dir, DefaultFileNamer.DataFileName(1)+upgradeTempSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("升级临时文件应被删除: %v", err)
+	}
+}
+
+func TestDB_OpenNewerFormat(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 新目录直接记录当前格式版本
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if version, err := db.readFormatVersion(); err != nil || version != FormatVersion {
+		t.Fatalf("新目录应记录当前格式版本: %d, %v", version, err)
+	}
+	db.Close()
+
+	// 更高版本写入的目录不能打开
+	buf := []byte(formatMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, FormatVersion+1)
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	writeTestFile(t, OSFileSystem, filepath.Join(dir, formatFileName), buf)
+	if _, err := Open(dir); !errors.Is(err, ErrUnrecognizedFile) {
+		t.Fatalf("更高的格式版本应返回 ErrUnrecognizedFile: %v", err)
+	}
+}
+
+func TestDB_OpenV1FormatDamaged(t *testing.T) {
+	forEachFileSystem(t, testDBOpenV1FormatDamaged)
+}
+
+func testDBOpenV1FormatDamaged(t *testing.T, fsys FileSystem) {
+	dir := copyV1Fixture(t, fsys)
+
+	// 第一个文件的首个 Entry（user/1）损坏，最后一个文件末尾的 Entry（user/4）因崩溃写入不完整
+	patchTestFile(t, fsys, filepath.Join(dir, DefaultFileNamer.DataFileName(0)), int64(headerSizeV1+len("user/1")), []byte("X"))
+	truncateTestFile(t, fsys, filepath.Join(dir, DefaultFileNamer.DataFileName(2)), 60)
+
+	for i := 0; i < 2; i++ {
+		db, err := Open(dir, WithFileSystem(fsys), WithDataFileSizeLimit(64))
+		if err != nil {
+			t.Fatalf("第 %d 次打开损坏的版本 1 目录失败: %v", i+1, err)
+		}
+		for key, want := range map[string]string{"user/2": "bobby", "user/3": "carol", "config": "v1-format"} {
+			if value, err := db.Get([]byte(key)); err != nil || string(value) != want {
+				t.Fatalf("%s 的值不匹配: %q, %v", key, value, err)
+			}
+		}
+		for _, key := range []string{"user/1", "user/4"} {
+			if _, err := db.Get([]byte(key)); err != storage.ErrKeyNotFound {
+				t.Fatalf("无法解析的 %s 应被丢弃: %v", key, err)
+			}
+		}
+		db.Close()
+	}
+}
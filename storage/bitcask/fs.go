@@ -0,0 +1,98 @@
+package bitcask
+
+import (
+	"io"
+	"os"
+)
+
+// ==================== 文件系统抽象 ====================
+//
+// DB 的所有文件操作（数据文件、Key-Log、意图日志、布隆过滤器）都通过 FileSystem 完成，
+// 便于在测试中使用内存文件系统，或接入其他存储后端。
+
+// File 表示一个打开的文件句柄
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+
+	// Name 返回打开文件时使用的路径
+	Name() string
+
+	// Stat 返回文件信息
+	Stat() (os.FileInfo, error)
+
+	// Sync 将文件内容同步到持久化存储
+	Sync() error
+
+	// Truncate 截断文件到指定长度
+	Truncate(size int64) error
+}
+
+// FileSystem 抽象 DB 使用的文件系统操作
+type FileSystem interface {
+	// OpenFile 以指定标志打开文件，语义与 os.OpenFile 相同
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Remove 删除文件，文件不存在时返回满足 os.IsNotExist 的错误
+	Remove(name string) error
+
+	// ReadDir 列出目录下的文件，按文件名排序
+	ReadDir(dir string) ([]os.DirEntry, error)
+
+	// Stat 返回文件信息，文件不存在时返回满足 os.IsNotExist 的错误
+	Stat(name string) (os.FileInfo, error)
+
+	// Rename 原子地将 oldpath 重命名为 newpath，newpath 已存在时被替换，语义与 os.Rename 相同
+	Rename(oldpath, newpath string) error
+
+	// MkdirAll 创建目录及其所有父目录
+	MkdirAll(path string, perm os.FileMode) error
+}
+
+// SpaceReporter 是 FileSystem 可选实现的接口，报告目录所在磁盘的可用空间
+// 用于 MinFreeBytes 检查；未实现该接口的文件系统（例如内存文件系统）不做检查
+type SpaceReporter interface {
+	// FreeSpace 返回 dir 所在磁盘对当前用户可用的字节数
+	FreeSpace(dir string) (uint64, error)
+}
+
+// OSFileSystem 基于操作系统文件系统的默认实现
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) ReadDir(dir string) ([]os.DirEntry, error) {
+	return os.ReadDir(dir)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// readFile 读取整个文件的内容
+func readFile(fsys FileSystem, name string) ([]byte, error) {
+	file, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
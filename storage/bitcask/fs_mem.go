@@ -0,0 +1,265 @@
+package bitcask
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemFileSystem 纯内存的 FileSystem 实现
+// 数据只保存在进程内存中，Sync 为空操作；同一实例内关闭并重新打开 DB 可以看到之前的数据。
+// 主要用于测试。
+type MemFileSystem struct {
+	mu    sync.RWMutex
+	files map[string]*memFileData
+}
+
+// memFileData 内存文件的内容，被所有打开的句柄共享
+type memFileData struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFileSystem 创建一个空的内存文件系统
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{files: make(map[string]*memFileData)}
+}
+
+// OpenFile 打开内存文件，支持 O_CREATE、O_EXCL、O_TRUNC、O_APPEND
+func (m *MemFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		data = &memFileData{modTime: time.Now()}
+		m.files[name] = data
+	}
+
+	if flag&os.O_TRUNC != 0 {
+		data.mu.Lock()
+		data.data = nil
+		data.modTime = time.Now()
+		data.mu.Unlock()
+	}
+
+	return &memFile{name: name, data: data, flag: flag}, nil
+}
+
+// Remove 删除内存文件，已打开的句柄仍可继续访问原有内容
+func (m *MemFileSystem) Remove(name string) error {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// ReadDir 列出目录下的文件（不包含子目录），按文件名排序
+func (m *MemFileSystem) ReadDir(dir string) ([]os.DirEntry, error) {
+	dir = filepath.Clean(dir)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []os.DirEntry
+	for name, data := range m.files {
+		if filepath.Dir(name) != dir {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(data.stat(name)))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Stat 返回内存文件的信息
+func (m *MemFileSystem) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return data.stat(name), nil
+}
+
+// Rename 重命名内存文件，newpath 已存在时被替换；已打开的句柄仍可继续访问原有内容
+func (m *MemFileSystem) Rename(oldpath, newpath string) error {
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = data
+	return nil
+}
+
+// MkdirAll 内存文件系统没有目录的概念，总是成功
+func (m *MemFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+func (d *memFileData) stat(name string) os.FileInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return &memFileInfo{name: filepath.Base(name), size: int64(len(d.data)), modTime: d.modTime}
+}
+
+// memFile 内存文件的句柄，维护独立的读写偏移
+type memFile struct {
+	name   string
+	data   *memFileData
+	flag   int
+	offset int64
+	closed bool
+	mu     sync.Mutex
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := f.data.readAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return 0, os.ErrClosed
+	}
+	return f.data.readAt(p, off)
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	d := f.data
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(d.data))
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(d.data)) {
+		d.data = append(d.data, make([]byte, end-int64(len(d.data)))...)
+	}
+	copy(d.data[f.offset:end], p)
+	f.offset = end
+	d.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.data.stat(f.name), nil
+}
+
+func (f *memFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	d := f.data
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if size < int64(len(d.data)) {
+		d.data = d.data[:size]
+	} else if size > int64(len(d.data)) {
+		d.data = append(d.data, make([]byte, size-int64(len(d.data)))...)
+	}
+	d.modTime = time.Now()
+	return nil
+}
+
+func (d *memFileData) readAt(p []byte, off int64) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if off >= int64(len(d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// memFileInfo 内存文件的 os.FileInfo 实现
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() os.FileMode  { return 0644 }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return false }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+// 确保实现了相关接口
+var _ FileSystem = (*MemFileSystem)(nil)
+var _ File = (*memFile)(nil)
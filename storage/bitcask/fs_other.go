@@ -0,0 +1,10 @@
+//go:build !unix
+
+package bitcask
+
+import "github.com/forever-free1/TideKV/storage"
+
+// FreeSpace 当前平台不支持查询可用空间
+func (osFileSystem) FreeSpace(dir string) (uint64, error) {
+	return 0, storage.ErrNotSupported
+}
@@ -0,0 +1,168 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 测试辅助函数 ====================
+// 需要同时覆盖两种文件系统的测试通过 forEachFileSystem 运行，把得到的 fsys 通过 WithFileSystem 传给 Open，
+// 并通过以下辅助函数用同一个 fsys 访问文件
+
+// forEachFileSystem 分别在操作系统文件系统与内存文件系统上以子测试运行 fn
+func forEachFileSystem(t *testing.T, fn func(t *testing.T, fsys FileSystem)) {
+	t.Run("os", func(t *testing.T) { fn(t, OSFileSystem) })
+	t.Run("mem", func(t *testing.T) { fn(t, NewMemFileSystem()) })
+}
+
+// writeTestFile 创建（或覆盖）文件并写入内容
+func writeTestFile(t *testing.T, fsys FileSystem, path string, data []byte) {
+	file, err := fsys.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
+
+// patchTestFile 覆盖文件中 offset 处的内容，用于模拟数据损坏
+func patchTestFile(t *testing.T, fsys FileSystem, path string, offset int64, patch []byte) {
+	data, err := readFile(fsys, path)
+	if err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	copy(data[offset:], patch)
+	writeTestFile(t, fsys, path, data)
+}
+
+// truncateTestFile 截断文件到指定长度
+func truncateTestFile(t *testing.T, fsys FileSystem, path string, size int64) {
+	file, err := fsys.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		t.Fatalf("截断文件失败: %v", err)
+	}
+}
+
+// testFileSize 返回文件大小
+func testFileSize(t *testing.T, fsys FileSystem, path string) int64 {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		t.Fatalf("获取文件信息失败: %v", err)
+	}
+	return info.Size()
+}
+
+// ==================== 内存文件系统 ====================
+
+func TestMemFileSystem(t *testing.T) {
+	fsys := NewMemFileSystem()
+
+	if _, err := fsys.OpenFile("/db/a", os.O_RDONLY, 0); !os.IsNotExist(err) {
+		t.Fatalf("打开不存在的文件应返回 NotExist, 得到: %v", err)
+	}
+
+	f, err := fsys.OpenFile("/db/a", os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	f.Write([]byte("hello "))
+	f.Write([]byte("world"))
+
+	buf := make([]byte, 5)
+	if _, err := f.ReadAt(buf, 6); err != nil || string(buf) != "world" {
+		t.Errorf("ReadAt 不匹配: got %q, err %v", buf, err)
+	}
+	f.Close()
+
+	fsys.OpenFile("/db/b", os.O_CREATE|os.O_WRONLY, 0644)
+	fsys.OpenFile("/other/c", os.O_CREATE|os.O_WRONLY, 0644)
+	entries, _ := fsys.ReadDir("/db")
+	if len(entries) != 2 || entries[0].Name() != "a" || entries[1].Name() != "b" {
+		t.Errorf("ReadDir 结果不匹配: %v", entries)
+	}
+
+	if info, err := fsys.Stat("/db/a"); err != nil || info.Size() != 11 {
+		t.Errorf("Stat 不匹配: %v, err %v", info, err)
+	}
+	if err := fsys.Remove("/db/a"); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if err := fsys.Remove("/db/a"); !os.IsNotExist(err) {
+		t.Errorf("重复删除应返回 NotExist, 得到: %v", err)
+	}
+}
+
+func TestDB_FileSystems(t *testing.T) {
+	forEachFileSystem(t, testDBFileSystems)
+}
+
+// testDBFileSystems 在给定的文件系统上走一遍写入、轮转、Merge、前缀替换与重新打开的完整流程
+func testDBFileSystems(t *testing.T, fsys FileSystem) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := []Option{WithFileSystem(fsys), WithDataFileSizeLimit(256)}
+	db, err := Open(dir, opts...)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			if err := db.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%d-%d", i, round))); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+	}
+	for i := 0; i < 20; i += 2 {
+		db.Delete([]byte(fmt.Sprintf("key-%02d", i)))
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	if err := db.ReplacePrefix([]byte("cfg/"), []KV{{Key: []byte("cfg/a"), Value: []byte("1")}}); err != nil {
+		t.Fatalf("ReplacePrefix 失败: %v", err)
+	}
+	db.Close()
+
+	// 数据文件只存在于给定的文件系统中
+	entries, err := fsys.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("文件系统中应有数据文件: %d, %v", len(entries), err)
+	}
+	if onDisk, _ := os.ReadDir(dir); fsys != OSFileSystem && len(onDisk) != 0 {
+		t.Fatalf("内存文件系统不应在磁盘上创建文件: %d", len(onDisk))
+	}
+
+	db, err = Open(dir, opts...)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		if i%2 == 0 {
+			if err != storage.ErrKeyNotFound {
+				t.Fatalf("key-%02d 应已被删除: %v", i, err)
+			}
+			continue
+		}
+		if want := fmt.Sprintf("value-%d-2", i); err != nil || string(value) != want {
+			t.Fatalf("key-%02d 不匹配: %q, %v", i, value, err)
+		}
+	}
+	if value, err := db.Get([]byte("cfg/a")); err != nil || string(value) != "1" {
+		t.Fatalf("cfg/a 不匹配: %q, %v", value, err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package bitcask
+
+import "syscall"
+
+// FreeSpace 通过 statfs 查询 dir 所在磁盘的可用空间
+func (osFileSystem) FreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+var _ SpaceReporter = osFileSystem{}
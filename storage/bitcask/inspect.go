@@ -0,0 +1,187 @@
+package bitcask
+
+import (
+	"fmt"
+
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/index"
+)
+
+// ==================== 诊断 ====================
+
+// EntryMeta 查询 key 当前对应 Entry 的元数据
+// 读取磁盘上的完整 Entry 并校验 CRC；使用混合索引时同时报告 key 所在的层。
+// 查询不会更新混合索引的访问统计。
+// 参数：
+//   - key: 键
+//
+// 返回：
+//   - *storage.EntryMeta: 元数据
+//   - error: 查询错误，如果键不存在返回 storage.ErrKeyNotFound
+func (db *DB) EntryMeta(key []byte) (*storage.EntryMeta, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pos, tier := db.peekIndex(key)
+	if pos == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+
+	dataFile := db.dataFileFor(pos.FileID)
+	if dataFile == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	entry, err := dataFile.ReadEntry(pos.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("读取 Entry 失败: %w", err)
+	}
+
+	return &storage.EntryMeta{
+		FileID:    pos.FileID,
+		Offset:    pos.Offset,
+		Size:      entry.Size(),
+		Timestamp: entry.Timestamp,
+		Seq:       entry.Seq,
+		CRC:       entry.CRC,
+		Type:      entry.Type.String(),
+		Tier:      string(tier),
+	}, nil
+}
+
+// Stat 查询 key 在索引中的位置，不读取数据文件
+// 比 EntryMeta 开销小，适合只需要判断 key 是否存在或定位 Entry 的场景；查询不会更新混合索引的访问统计
+// 参数：
+//   - key: 键
+//
+// 返回：
+//   - *storage.Position: 位置的副本，key 不存在时为 nil
+//   - bool: key 是否存在（已删除的 key 返回 false）
+func (db *DB) Stat(key []byte) (*storage.Position, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pos, _ := db.peekIndex(key)
+	if pos == nil || db.dataFileFor(pos.FileID) == nil {
+		return nil, false
+	}
+	stat := *pos
+	return &stat, true
+}
+
+// peekIndex 查询 key 的位置，不产生副作用
+// 混合索引的 Get 会更新访问统计并可能迁移 key，因此改用 Peek
+// 调用方必须持有读锁或写锁
+func (db *DB) peekIndex(key []byte) (*storage.Position, index.Tier) {
+	if hi, ok := db.index.(*index.HybridIndex); ok {
+		return hi.Peek(key)
+	}
+	return db.index.Get(key), index.TierNone
+}
+
+// TierStats 返回混合索引各层的大小与层间迁移次数，用于指标采集
+// 未使用混合索引时返回零值
+func (db *DB) TierStats() index.TierStats {
+	if hi, ok := db.index.(*index.HybridIndex); ok {
+		return hi.TierStats()
+	}
+	return index.TierStats{}
+}
+
+// MemoryStats 估算索引与布隆过滤器占用的内存
+// 各项均为按 key 数量与 key 长度近似计算的值，不包含数据文件的页缓存
+// 返回：
+//   - *storage.MemoryStats: 内存占用估算值
+//   - error: 总是返回 nil
+func (db *DB) MemoryStats() (*storage.MemoryStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stats := &storage.MemoryStats{
+		Index: db.index.EstimatedMemory(),
+		Bloom: db.bloomFilter.EstimatedMemory(),
+	}
+	if db.suffixIndex != nil {
+		stats.Suffix = db.suffixIndex.EstimatedMemory()
+	}
+	if hi, ok := db.index.(*index.HybridIndex); ok {
+		tiers := hi.TierMemory()
+		stats.HotTier = tiers.Hot
+		stats.WarmTier = tiers.Warm
+		stats.ColdTier = tiers.Cold
+	}
+	stats.Total = stats.Index + stats.Bloom + stats.Suffix
+	return stats, nil
+}
+
+// EstimateKeyCount 估算不同 key 的数量
+// 基于 HyperLogLog，开销固定，不需要遍历索引，即使混合索引的冷层大部分在磁盘上也很廉价。
+// 标准误差约 0.81%；删除的 key 在重新打开之前仍计入估算值
+// 返回：
+//   - uint64: 估算值
+func (db *DB) EstimateKeyCount() uint64 {
+	return db.keyEstimator.Estimate()
+}
+
+// KeyCount 统计 key 的数量
+// 估算值来自 EstimateKeyCount；Map 与 ART 索引同时报告精确数量，
+// 混合索引的 Size 会重复计入热层与温层的 key，不报告精确数量
+// 返回：
+//   - *storage.KeyCount: key 数量
+//   - error: 总是返回 nil
+func (db *DB) KeyCount() (*storage.KeyCount, error) {
+	count := &storage.KeyCount{Estimate: db.EstimateKeyCount(), Exact: -1}
+	if _, hybrid := db.index.(*index.HybridIndex); !hybrid {
+		db.mu.RLock()
+		count.Exact = int64(db.index.Size())
+		db.mu.RUnlock()
+	}
+	return count, nil
+}
+
+// rebuildKeyEstimator 从索引中的全部 key 重建 key 数量估算
+func (db *DB) rebuildKeyEstimator() {
+	db.keyEstimator.Reset()
+	iter := db.index.Seek(nil)
+	defer iter.Close()
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		db.keyEstimator.Add(key)
+		iter.Next()
+	}
+}
+
+// KeyDistribution 统计索引中 key 在键空间上的分布，使用混合索引时同时报告各层的分布
+// 需要遍历全部 key，期间持有读锁
+// 参数：
+//   - buckets: 区间数量，限制在 [1, 256] 之内
+//
+// 返回：
+//   - *storage.KeyDistribution: key 分布
+//   - error: 总是返回 nil
+func (db *DB) KeyDistribution(buckets int) (*storage.KeyDistribution, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if hi, ok := db.index.(*index.HybridIndex); ok {
+		tiers := hi.TierKeyHistogram(buckets)
+		return &storage.KeyDistribution{
+			Buckets:  tiers.Cold,
+			HotTier:  tiers.Hot,
+			WarmTier: tiers.Warm,
+			ColdTier: tiers.Cold,
+		}, nil
+	}
+	return &storage.KeyDistribution{Buckets: db.index.KeyHistogram(buckets)}, nil
+}
+
+// Fingerprint 计算全部存活键值对的内容指纹
+// 按 key 的字典序对每个键值对（长度前缀 + 内容）计算 SHA-256，结果只取决于逻辑内容，
+// 与写入顺序、数据文件布局、是否 Merge 过以及索引类型无关。
+// 两个节点（或备份与源数据库）的指纹相同即可认为数据一致，不需要逐个比较 key。
+// 计算期间持有读锁，得到的是某一时刻的一致视图；需要读取全部 value，开销与全量扫描相同。
+// 需要定位差异所在的范围时使用 MerkleTree
+// 返回：
+//   - []byte: 32 字节的指纹
+//   - error: 读取错误
+func (db *DB) Fingerprint() ([]byte, error) {
+	return db.RangeFingerprint(nil, nil)
+}
@@ -0,0 +1,338 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// KV 表示一个键值对（storage.KV 的别名）
+type KV = storage.KV
+
+// intentFileName 意图日志文件名
+const intentFileName = "intent.log"
+
+// ==================== 意图日志 ====================
+//
+// 意图日志（intent log）用于保证多 key 操作的原子性：
+//  1. 将全部操作（普通 Entry / 墓碑）连同一个提交标记写入 intent.log 并 fsync
+//  2. 将操作逐条写入数据文件并更新索引
+//  3. 删除 intent.log
+//
+// 如果在第 2 步崩溃，重启时会发现带提交标记的 intent.log 并重放全部操作；
+// 如果在第 1 步崩溃，intent.log 没有提交标记，直接丢弃。
+// 由于写入与墓碑都是幂等的，重放后状态等价于一次完整的原子操作。
+//
+// 大小限制、超大 Entry 策略与磁盘空间在第 1 步之前对全部操作检查，重放时不再检查，
+// 避免已提交的意图日志因之后调整的配置无法重放、导致数据库无法打开。
+// 第 2 步仍因 I/O 错误失败时，为已写入的操作写入恢复原值的 Entry 并删除 intent.log；
+// 回滚也失败时保留 intent.log，下次打开时重放完成整个操作。
+
+// intentPath 返回意图日志的路径
+func (db *DB) intentPath() string {
+	return filepath.Join(db.dir, intentFileName)
+}
+
+// writeIntent 将一组操作写入意图日志并同步到磁盘
+func (db *DB) writeIntent(ops []*Entry) error {
+	var buf bytes.Buffer
+	for _, op := range ops {
+		buf.Write(op.Encode())
+	}
+	commit := &Entry{Type: EntryTypeIntentCommit}
+	buf.Write(commit.Encode())
+
+	file, err := db.options.FileSystem.OpenFile(db.intentPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建意图日志失败: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("写入意图日志失败: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("同步意图日志失败: %w", err)
+	}
+	return nil
+}
+
+// readIntent 读取意图日志
+// 返回：
+//   - []*Entry: 日志中的操作
+//   - bool: 日志是否完整（包含提交标记）
+//   - error: 读取错误，日志不存在时返回 nil
+func (db *DB) readIntent() ([]*Entry, bool, error) {
+	data, err := readFile(db.options.FileSystem, db.intentPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("读取意图日志失败: %w", err)
+	}
+
+	var ops []*Entry
+	for len(data) > 0 {
+		entry, err := Decode(data)
+		if err != nil {
+			// 日志被截断或损坏，说明提交标记尚未写入
+			return nil, false, nil
+		}
+		if entry.Type == EntryTypeIntentCommit {
+			return ops, true, nil
+		}
+		ops = append(ops, entry)
+		data = data[entry.Size():]
+	}
+	return nil, false, nil
+}
+
+// clearIntent 删除意图日志
+func (db *DB) clearIntent() error {
+	if err := db.options.FileSystem.Remove(db.intentPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除意图日志失败: %w", err)
+	}
+	return nil
+}
+
+// checkOps 在写入意图日志之前检查全部操作，与单条写入使用相同的大小限制、超大 Entry 策略与磁盘空间检查
+// 调用方必须持有写锁
+func (db *DB) checkOps(ops []*Entry) error {
+	var size uint64
+	for _, op := range ops {
+		if err := db.checkNewEntry(op); err != nil {
+			return fmt.Errorf("key %q: %w", op.Key, err)
+		}
+		if !op.IsTombstone() {
+			size += uint64(op.Size())
+		}
+	}
+	return db.checkFreeSpaceFor(size)
+}
+
+// commitIntent 以原子方式应用一组操作，ops 需已通过 checkOps
+// 调用方必须持有写锁
+func (db *DB) commitIntent(ops []*Entry) error {
+	// 记录每个 key 操作之前的位置，写入中途失败时用于回滚
+	prev := make([]*storage.Position, len(ops))
+	for i, op := range ops {
+		prev[i] = db.index.Get(op.Key)
+	}
+
+	if err := db.writeIntent(ops); err != nil {
+		return err
+	}
+	if applied, err := db.applyOps(ops); err != nil {
+		if rbErr := db.rollbackOps(ops[:applied], prev); rbErr != nil {
+			return fmt.Errorf("%w（回滚失败，下次打开时完成该操作: %v）", err, rbErr)
+		}
+		if clearErr := db.clearIntent(); clearErr != nil {
+			return fmt.Errorf("%w（%v）", err, clearErr)
+		}
+		return err
+	}
+	return db.clearIntent()
+}
+
+// applyOps 将操作写入数据文件并更新索引，最后同步活跃文件
+// 返回：
+//   - int: 已写入的操作数量
+//   - error: 写入或同步错误
+//
+// 调用方必须持有写锁
+func (db *DB) applyOps(ops []*Entry) (int, error) {
+	for i, op := range ops {
+		if err := db.writeEntry(op); err != nil {
+			return i, err
+		}
+		if !op.IsTombstone() {
+			db.consumeFreeSpace(uint64(op.Size()))
+		}
+	}
+	return len(ops), db.activeFile.Sync()
+}
+
+// rollbackOps 撤销已写入的操作：之前存在的 key 重新写入原值，之前不存在的 key 写入墓碑
+// 参数：
+//   - applied: 已写入的操作
+//   - prev: 与 applied 对应的操作之前的位置，key 不存在时为 nil
+//
+// 调用方必须持有写锁
+func (db *DB) rollbackOps(applied []*Entry, prev []*storage.Position) error {
+	restored := make(map[string]struct{}, len(applied))
+	for i, op := range applied {
+		if _, done := restored[string(op.Key)]; done {
+			continue
+		}
+		restored[string(op.Key)] = struct{}{}
+
+		if prev[i] == nil {
+			if db.index.Get(op.Key) == nil {
+				continue
+			}
+			if err := db.writeEntry(NewTombstoneEntry(op.Key)); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := db.readValue(prev[i])
+		if err != nil {
+			return err
+		}
+		if err := db.writeEntry(NewEntry(op.Key, value)); err != nil {
+			return err
+		}
+	}
+	return db.activeFile.Sync()
+}
+
+// recoverIntent 在启动时重放已提交但未完成的意图日志
+func (db *DB) recoverIntent() error {
+	ops, committed, err := db.readIntent()
+	if err != nil {
+		return err
+	}
+	if committed {
+		if _, err := db.applyOps(ops); err != nil {
+			return err
+		}
+	}
+	return db.clearIntent()
+}
+
+// ==================== 前缀替换 ====================
+
+// ReplacePrefix 原子地替换某个前缀下的全部键值对
+// 删除前缀下已有但不在 kvs 中的 key，并写入 kvs 中的全部键值对
+// 整个替换在写锁内完成，并经由意图日志保证崩溃后要么全部生效、要么全部不生效
+//
+// 参数：
+//   - prefix: 前缀
+//   - kvs: 新的键值对集合，每个 key 都必须以 prefix 开头
+//
+// 返回：
+//   - error: 替换错误
+func (db *DB) ReplacePrefix(prefix []byte, kvs []KV) error {
+	return db.ReplacePrefixAt(prefix, kvs, 0)
+}
+
+// ReplacePrefixAt 以指定的版本号原子地替换某个前缀下的全部键值对
+// 写入的键值对与删除旧 key 的墓碑都以 version 作为写入序号
+//
+// 参数：
+//   - prefix: 前缀
+//   - kvs: 新的键值对集合，每个 key 都必须以 prefix 开头
+//   - version: 版本号，0 表示由 DB 分配
+//
+// 返回：
+//   - error: 替换错误
+func (db *DB) ReplacePrefixAt(prefix []byte, kvs []KV, version uint64) error {
+	newKeys := make(map[string]struct{}, len(kvs))
+	for _, kv := range kvs {
+		if !bytes.HasPrefix(kv.Key, prefix) {
+			return fmt.Errorf("key %q 不在前缀 %q 下", kv.Key, prefix)
+		}
+		newKeys[string(kv.Key)] = struct{}{}
+	}
+
+	if err := db.lockForWrite(); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+
+	// 收集需要删除的旧 key
+	var ops []*Entry
+	iter := db.index.Seek(prefix)
+	for key := iter.Key(); key != nil && bytes.HasPrefix(key, prefix); key = iter.Key() {
+		if _, keep := newKeys[string(key)]; !keep {
+			ops = append(ops, NewTombstoneEntry(append([]byte(nil), key...)))
+		}
+		iter.Next()
+	}
+	iter.Close()
+
+	for _, kv := range kvs {
+		ops = append(ops, NewEntry(kv.Key, kv.Value))
+	}
+	for _, op := range ops {
+		op.Seq = version
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+	if err := db.checkOps(ops); err != nil {
+		return err
+	}
+	return db.commitIntent(ops)
+}
+
+// ScanPrefix 遍历前缀下的全部键值对
+// 遍历期间持有读锁，因此看到的是某一时刻的一致视图
+// fn 返回 false 时停止遍历
+//
+// 参数：
+//   - prefix: 前缀
+//   - fn: 回调函数
+//
+// 返回：
+//   - error: 读取错误
+func (db *DB) ScanPrefix(prefix []byte, fn func(key, value []byte) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	iter := db.index.Seek(prefix)
+	defer iter.Close()
+
+	for key := iter.Key(); key != nil && bytes.HasPrefix(key, prefix); key = iter.Key() {
+		value, err := db.readValue(iter.Value())
+		if err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			return nil
+		}
+		iter.Next()
+	}
+	return nil
+}
+
+// readValue 根据位置读取 value
+// 调用方必须持有读锁或写锁
+func (db *DB) readValue(pos *storage.Position) ([]byte, error) {
+	entry, err := db.readEntry(pos)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// readEntry 根据位置读取 Entry
+// 调用方必须持有读锁或写锁
+func (db *DB) readEntry(pos *storage.Position) (*Entry, error) {
+	dataFile := db.dataFileFor(pos.FileID)
+	if dataFile == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	entry, err := dataFile.ReadEntry(pos.Offset)
+	if err != nil {
+		if err == io.EOF {
+			return nil, storage.ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("读取 Entry 失败: %w", err)
+	}
+	return entry, nil
+}
+
+// dataFileFor 根据文件 ID 查找数据文件，不存在返回 nil
+// 调用方必须持有读锁或写锁
+func (db *DB) dataFileFor(fileID uint32) *DataFile {
+	if fileID == db.activeFile.GetFileID() {
+		return db.activeFile
+	}
+	return db.olderFiles[fileID]
+}
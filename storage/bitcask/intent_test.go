@@ -0,0 +1,354 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+func TestDB_ReplacePrefix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	db.Put([]byte("cfg/a"), []byte("1"))
+	db.Put([]byte("cfg/b"), []byte("1"))
+	db.Put([]byte("other"), []byte("x"))
+
+	err = db.ReplacePrefix([]byte("cfg/"), []KV{
+		{Key: []byte("cfg/b"), Value: []byte("2")},
+		{Key: []byte("cfg/c"), Value: []byte("2")},
+	})
+	if err != nil {
+		t.Fatalf("ReplacePrefix 失败: %v", err)
+	}
+	db.Close()
+
+	// 重新打开，验证替换结果已持久化（包括删除）
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Get([]byte("cfg/a")); err != storage.ErrKeyNotFound {
+		t.Errorf("cfg/a 应已被删除, 得到: %v", err)
+	}
+	for _, key := range []string{"cfg/b", "cfg/c"} {
+		val, err := db.Get([]byte(key))
+		if err != nil || string(val) != "2" {
+			t.Errorf("%s 值不匹配: got %s, err %v", key, val, err)
+		}
+	}
+	if val, _ := db.Get([]byte("other")); string(val) != "x" {
+		t.Errorf("前缀外的 key 不应受影响: got %s", val)
+	}
+
+	// key 不在前缀下时拒绝
+	err = db.ReplacePrefix([]byte("cfg/"), []KV{{Key: []byte("bad"), Value: []byte("1")}})
+	if err == nil {
+		t.Error("key 不在前缀下时应返回错误")
+	}
+}
+
+func TestDB_ReplacePrefixNoTornReads(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 两组互不重叠的 key，每组内的 value 相同
+	sets := [][]KV{
+		{{Key: []byte("cfg/a"), Value: []byte("A")}, {Key: []byte("cfg/b"), Value: []byte("A")}},
+		{{Key: []byte("cfg/c"), Value: []byte("B")}, {Key: []byte("cfg/d"), Value: []byte("B")}, {Key: []byte("cfg/e"), Value: []byte("B")}},
+	}
+	expected := []string{"cfg/a=A,cfg/b=A", "cfg/c=B,cfg/d=B,cfg/e=B"}
+
+	if err := db.ReplacePrefix([]byte("cfg/"), sets[0]); err != nil {
+		t.Fatalf("ReplacePrefix 失败: %v", err)
+	}
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			var pairs []string
+			err := db.ScanPrefix([]byte("cfg/"), func(key, value []byte) bool {
+				pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+				return true
+			})
+			if err != nil {
+				errCh <- err
+				return
+			}
+			sort.Strings(pairs)
+			got := strings.Join(pairs, ",")
+			if got != expected[0] && got != expected[1] {
+				errCh <- fmt.Errorf("读到了新旧混合的状态: %s", got)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		if err := db.ReplacePrefix([]byte("cfg/"), sets[i%2]); err != nil {
+			t.Fatalf("ReplacePrefix 失败: %v", err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	default:
+	}
+}
+
+func TestDB_ScanPrefixConcurrentMapIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Map 索引在 Seek 时重建排序列表，多个读者在读锁下同时遍历不能产生数据竞争（go test -race）
+	db, err := Open(dir, WithIndexType(IndexTypeMap))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	errCh := make(chan error, 4)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				var prev string
+				var unordered error
+				err := db.ScanPrefix([]byte("key-"), func(key, value []byte) bool {
+					if string(key) <= prev {
+						unordered = fmt.Errorf("遍历应按 key 升序: %s 在 %s 之后", key, prev)
+						return false
+					}
+					prev = string(key)
+					return true
+				})
+				if err == nil {
+					err = unordered
+				}
+				if err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 500; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		if i%3 == 0 {
+			db.Delete([]byte(fmt.Sprintf("key-%04d", i/2)))
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	default:
+	}
+}
+
+func TestDB_IntentRecovery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	db.Put([]byte("cfg/old"), []byte("1"))
+
+	// 模拟意图日志已落盘、但尚未应用到数据文件时崩溃
+	ops := []*Entry{
+		NewTombstoneEntry([]byte("cfg/old")),
+		NewEntry([]byte("cfg/new"), []byte("2")),
+	}
+	if err := db.writeIntent(ops); err != nil {
+		t.Fatalf("写入意图日志失败: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Get([]byte("cfg/old")); err != storage.ErrKeyNotFound {
+		t.Errorf("cfg/old 应已被删除, 得到: %v", err)
+	}
+	if val, err := db.Get([]byte("cfg/new")); err != nil || string(val) != "2" {
+		t.Errorf("cfg/new 值不匹配: got %s, err %v", val, err)
+	}
+	if _, err := OSFileSystem.Stat(db.intentPath()); !os.IsNotExist(err) {
+		t.Errorf("恢复后意图日志应被删除")
+	}
+}
+
+// failingWriteFileSystem 数据文件允许 allowed 次写入之后写入失败的 FileSystem，allowed < 0 表示不限制
+// sticky 为 false 时只失败一次，之后恢复正常
+type failingWriteFileSystem struct {
+	FileSystem
+	allowed atomic.Int64
+	sticky  bool
+}
+
+func (f *failingWriteFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.FileSystem.OpenFile(name, flag, perm)
+	if err != nil || filepath.Ext(name) != ".data" {
+		return file, err
+	}
+	return &failingWriteFile{File: file, fs: f}, nil
+}
+
+type failingWriteFile struct {
+	File
+	fs *failingWriteFileSystem
+}
+
+func (f *failingWriteFile) Write(p []byte) (int, error) {
+	switch allowed := f.fs.allowed.Load(); {
+	case allowed == 0:
+		if !f.fs.sticky {
+			f.fs.allowed.Store(-1)
+		}
+		return 0, errors.New("injected write failure")
+	case allowed > 0:
+		f.fs.allowed.Add(-1)
+	}
+	return f.File.Write(p)
+}
+
+func TestDB_ReplacePrefixFailure(t *testing.T) {
+	forEachFileSystem(t, testDBReplacePrefixFailure)
+}
+
+func testDBReplacePrefixFailure(t *testing.T, fsys FileSystem) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	failing := &failingWriteFileSystem{FileSystem: fsys}
+	failing.allowed.Store(-1)
+	open := func() *DB {
+		t.Helper()
+		db, err := Open(dir, WithFileSystem(failing), WithMaxValueSize(16))
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		return db
+	}
+	// check 检查前缀下的内容，并确认没有残留的意图日志
+	check := func(stage string, db *DB, want string) {
+		t.Helper()
+		var pairs []string
+		db.ScanPrefix([]byte("cfg/"), func(key, value []byte) bool {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+			return true
+		})
+		if got := strings.Join(pairs, ","); got != want {
+			t.Fatalf("%s: 前缀下的内容不匹配: %s, want %s", stage, got, want)
+		}
+		if _, err := fsys.Stat(db.intentPath()); !os.IsNotExist(err) {
+			t.Fatalf("%s: 不应残留意图日志: %v", stage, err)
+		}
+	}
+	const old = "cfg/a=old,cfg/b=old"
+	replacement := []KV{{Key: []byte("cfg/b"), Value: []byte("new")}, {Key: []byte("cfg/c"), Value: []byte("new")}}
+
+	db := open()
+	db.Put([]byte("cfg/a"), []byte("old"))
+	db.Put([]byte("cfg/b"), []byte("old"))
+
+	// 超出限制的操作在写入意图日志之前被拒绝，不写入任何数据
+	tooLarge := append(replacement[:1:1], KV{Key: []byte("cfg/c"), Value: make([]byte, 17)})
+	if err := db.ReplacePrefix([]byte("cfg/"), tooLarge); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("value 超出限制时应返回 ErrValueTooLarge: %v", err)
+	}
+	check("超出限制", db, old)
+
+	// 写入中途失败时回滚已写入的操作（删除 cfg/a 已生效，写入 cfg/b 失败）
+	failing.allowed.Store(1)
+	if err := db.ReplacePrefix([]byte("cfg/"), replacement); !errors.Is(err, ErrWriteFailed) {
+		t.Fatalf("写入失败时应返回 ErrWriteFailed: %v", err)
+	}
+	check("回滚之后", db, old)
+	db.Close()
+
+	db = open()
+	check("回滚之后重新打开", db, old)
+
+	// 回滚也失败时保留意图日志，重新打开时完成整个替换
+	failing.sticky = true
+	failing.allowed.Store(1)
+	if err := db.ReplacePrefix([]byte("cfg/"), replacement); !errors.Is(err, ErrWriteFailed) {
+		t.Fatalf("写入失败时应返回 ErrWriteFailed: %v", err)
+	}
+	db.Close()
+	failing.allowed.Store(-1)
+
+	db = open()
+	check("重放意图日志之后", db, "cfg/b=new,cfg/c=new")
+	db.Close()
+
+	// 已提交的意图日志不受之后调低的限制影响，数据库仍能打开
+	db = open()
+	if err := db.writeIntent([]*Entry{NewEntry([]byte("cfg/d"), make([]byte, 32))}); err != nil {
+		t.Fatalf("写入意图日志失败: %v", err)
+	}
+	db.Close()
+	db = open()
+	defer db.Close()
+	if value, err := db.Get([]byte("cfg/d")); err != nil || len(value) != 32 {
+		t.Fatalf("重放超出当前限制的意图日志失败: %d, %v", len(value), err)
+	}
+}
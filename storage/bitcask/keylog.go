@@ -0,0 +1,258 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ==================== Key-Log ====================
+//
+// Key-Log 为每个数据文件维护一份只包含 key 与位置信息的紧凑日志（类似 Bitcask 的 hint 文件），
+// 使得 Merge 与启动时的索引重建无需读取 value。
+//
+// 崩溃一致性依靠写入顺序保证：总是先写数据文件，再写 Key-Log。
+// 因此 Key-Log 永远不会领先于数据文件；启动时如果 Key-Log 落后（崩溃发生在两次写入之间），
+// 会从数据文件补齐缺失的记录。
+
+// KeyLogRecord 表示 Key-Log 中的一条记录
+// 格式：| CRC32 (4B) | Seq (8B) | Timestamp (8B) | Offset (8B) | Size (4B) | Type (1B) | KeySize (4B) | Key |
+type KeyLogRecord struct {
+	Seq       uint64    // Entry 的写入序号
+	Timestamp int64     // Entry 的时间戳
+	Offset    int64     // Entry 在数据文件中的偏移量
+	Size      uint32    // Entry 的总大小
+	Type      EntryType // Entry 类型
+	Key       []byte    // 键
+}
+
+// keyLogHeaderSize Key-Log 记录的固定头部大小
+const keyLogHeaderSize = 4 + 8 + 8 + 8 + 4 + 1 + 4
+
+// keyLogSuffix Key-Log 文件后缀
+const keyLogSuffix = ".keys"
+
+// newKeyLogRecord 根据 Entry 及其位置构建 Key-Log 记录
+func newKeyLogRecord(entry *Entry, offset int64) *KeyLogRecord {
+	return &KeyLogRecord{
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		Offset:    offset,
+		Size:      entry.Size(),
+		Type:      entry.Type,
+		Key:       entry.Key,
+	}
+}
+
+// Encode 将记录编码为字节切片
+func (r *KeyLogRecord) Encode() []byte {
+	buf := make([]byte, keyLogHeaderSize+len(r.Key))
+	binary.LittleEndian.PutUint64(buf[4:12], r.Seq)
+	binary.LittleEndian.PutUint64(buf[12:20], uint64(r.Timestamp))
+	binary.LittleEndian.PutUint64(buf[20:28], uint64(r.Offset))
+	binary.LittleEndian.PutUint32(buf[28:32], r.Size)
+	buf[32] = byte(r.Type)
+	binary.LittleEndian.PutUint32(buf[33:37], uint32(len(r.Key)))
+	copy(buf[keyLogHeaderSize:], r.Key)
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// decodeKeyLogRecord 从字节切片解码一条记录
+// 返回：
+//   - *KeyLogRecord: 解码后的记录
+//   - int: 记录占用的字节数
+//   - error: 数据不完整或 CRC 校验失败
+func decodeKeyLogRecord(data []byte) (*KeyLogRecord, int, error) {
+	if len(data) < keyLogHeaderSize {
+		return nil, 0, ErrInvalidEntry
+	}
+	keySize := int(binary.LittleEndian.Uint32(data[33:37]))
+	total := keyLogHeaderSize + keySize
+	if keySize < 0 || len(data) < total {
+		return nil, 0, ErrInvalidEntry
+	}
+	if crc32.ChecksumIEEE(data[4:total]) != binary.LittleEndian.Uint32(data[0:4]) {
+		return nil, 0, ErrCRCMismatch
+	}
+	return &KeyLogRecord{
+		Seq:       binary.LittleEndian.Uint64(data[4:12]),
+		Timestamp: int64(binary.LittleEndian.Uint64(data[12:20])),
+		Offset:    int64(binary.LittleEndian.Uint64(data[20:28])),
+		Size:      binary.LittleEndian.Uint32(data[28:32]),
+		Type:      EntryType(data[32]),
+		Key:       data[keyLogHeaderSize:total],
+	}, total, nil
+}
+
+// KeyLog 表示一个数据文件对应的 Key-Log 文件
+type KeyLog struct {
+	FileID uint32     // 对应的数据文件 ID
+	File   File       // 底层文件句柄
+	mu     sync.Mutex // 保护写入
+}
+
+// OpenKeyLog 打开或创建一个 Key-Log 文件
+// 参数：
+//   - dir: 文件所在目录
+//   - fileID: 对应的数据文件 ID
+//
+// 返回：
+//   - *KeyLog: Key-Log 指针
+//   - error: 打开错误
+func OpenKeyLog(dir string, fileID uint32) (*KeyLog, error) {
+	return openKeyLog(OSFileSystem, keyLogPath(filepath.Join(dir, DefaultFileNamer.DataFileName(fileID))), fileID)
+}
+
+// openKeyLog 在指定文件系统上打开或创建路径为 path 的 Key-Log 文件
+func openKeyLog(fsys FileSystem, path string, fileID uint32) (*KeyLog, error) {
+	file, err := fsys.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开 Key-Log 失败: %w", err)
+	}
+	return &KeyLog{FileID: fileID, File: file}, nil
+}
+
+// Append 追加一条记录
+func (kl *KeyLog) Append(rec *KeyLogRecord) error {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.File == nil {
+		return ErrFileClosed
+	}
+	if _, err := kl.File.Write(rec.Encode()); err != nil {
+		return fmt.Errorf("写入 Key-Log 失败: %w", err)
+	}
+	return nil
+}
+
+// ReadAll 读取全部有效记录
+// 遇到不完整或损坏的记录时停止，并返回有效部分的长度，供调用方截断
+// 返回：
+//   - []*KeyLogRecord: 有效记录
+//   - int64: 有效记录占用的总字节数
+//   - error: 读取错误
+func (kl *KeyLog) ReadAll() ([]*KeyLogRecord, int64, error) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.File == nil {
+		return nil, 0, ErrFileClosed
+	}
+
+	stat, err := kl.File.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取 Key-Log 状态失败: %w", err)
+	}
+	data, err := io.ReadAll(io.NewSectionReader(kl.File, 0, stat.Size()))
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取 Key-Log 失败: %w", err)
+	}
+
+	var records []*KeyLogRecord
+	var valid int64
+	for len(data) > 0 {
+		rec, n, err := decodeKeyLogRecord(data)
+		if err != nil {
+			break
+		}
+		records = append(records, rec)
+		valid += int64(n)
+		data = data[n:]
+	}
+	return records, valid, nil
+}
+
+// Truncate 截断到指定长度，用于丢弃尾部不完整的记录
+func (kl *KeyLog) Truncate(size int64) error {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.File == nil {
+		return ErrFileClosed
+	}
+	return kl.File.Truncate(size)
+}
+
+// Sync 将 Key-Log 同步到磁盘
+func (kl *KeyLog) Sync() error {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.File == nil {
+		return ErrFileClosed
+	}
+	return kl.File.Sync()
+}
+
+// Close 关闭 Key-Log
+func (kl *KeyLog) Close() error {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.File == nil {
+		return nil
+	}
+	if err := kl.File.Sync(); err != nil {
+		return fmt.Errorf("关闭前同步 Key-Log 失败: %w", err)
+	}
+	err := kl.File.Close()
+	kl.File = nil
+	return err
+}
+
+// ==================== DB 集成 ====================
+
+// loadKeyLog 加载数据文件对应的 Key-Log，并与数据文件对齐
+// 丢弃尾部损坏的记录，并从数据文件补齐 Key-Log 缺失的记录
+// 调用方必须持有写锁（或处于启动阶段）
+func (db *DB) loadKeyLog(dataFile *DataFile) ([]*KeyLogRecord, error) {
+	kl, err := openKeyLog(db.options.FileSystem, keyLogPath(dataFile.GetFilePath(db.dir)), dataFile.GetFileID())
+	if err != nil {
+		return nil, err
+	}
+	defer kl.Close()
+
+	records, valid, err := kl.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Key-Log 不会领先于数据文件；如有超出数据文件的记录，说明文件不一致，丢弃
+	writeOff := dataFile.GetWriteOff()
+	for len(records) > 0 {
+		last := records[len(records)-1]
+		if last.Offset+int64(last.Size) <= writeOff {
+			break
+		}
+		records = records[:len(records)-1]
+		valid -= int64(keyLogHeaderSize + len(last.Key))
+	}
+
+	// 截断尾部损坏或被丢弃的记录
+	if err := kl.Truncate(valid); err != nil {
+		return nil, fmt.Errorf("截断 Key-Log 失败: %w", err)
+	}
+
+	// 从数据文件补齐缺失的记录
+	var offset int64
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		offset = last.Offset + int64(last.Size)
+	}
+	for offset < writeOff {
+		entry, err := dataFile.ReadEntry(offset)
+		if err != nil {
+			// 数据文件尾部不完整，停止补齐
+			break
+		}
+		rec := newKeyLogRecord(entry, offset)
+		if err := kl.Append(rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+		offset += int64(entry.Size())
+	}
+
+	return records, nil
+}
@@ -0,0 +1,367 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== Merge ====================
+//
+// Merge 将所有旧文件中仍然有效的 Entry 重写到新的数据文件中，然后删除旧文件，回收被覆盖或删除的数据占用的空间。
+//
+// 重写期间不持有写锁，读写照常进行：开始时在写锁内轮转活跃文件并确定参与合并的文件，
+// 重写时只按批次短暂持有读锁判断 Entry 是否仍然有效，发布时再次持有写锁切换活跃文件、更新索引。
+// 同一时间只执行一个 Merge。
+//
+// 重写的 Entry 先写入临时文件（数据文件与 Key-Log），全部写完后通过 footer 原子地发布，
+// 发布之后才更新索引并删除旧文件，见 mergeout.go。发布之前崩溃时旧文件仍然是权威数据，
+// 临时文件在重新打开时被清理；发布之后崩溃时由重新打开时的恢复流程完成发布。
+// 输出文件的 ID 大于所有参与合并的文件、小于发布时的新活跃文件，但可能大于重写期间写入的文件；
+// 重写期间被覆盖或删除的 key 在发布时把当前状态重写到新活跃文件，按文件 ID 顺序重放的结果不变。
+//
+// 配置了 Retention 时，最新版本的时间戳早于保留窗口的 key 不再被重写，发布之后从索引中移除。
+// 它的所有旧版本都位于本次合并的文件中，会随旧文件一起删除，因此不需要写入墓碑。
+
+// errMergeClosed 表示数据库在 Merge 期间被关闭，Merge 放弃且不做任何修改
+var errMergeClosed = errors.New("merge aborted: database closed")
+
+// mergeLiveBatch 重写时每次持有读锁判断是否有效的记录数
+const mergeLiveBatch = 1024
+
+// mergeRecord Merge 过程中遍历到的一条记录（只包含判断存活所需的信息）
+type mergeRecord struct {
+	Key    []byte
+	Type   EntryType
+	Offset int64
+}
+
+// Merge 合并所有旧文件，回收无效数据占用的空间
+// 只在开始与发布时短暂持有写锁；配置了 MergeFileSizeLimit 时按该限制轮转输出文件
+// 返回：
+//   - error: 合并错误
+func (db *DB) Merge() error {
+	db.mergeMu.Lock()
+	defer db.mergeMu.Unlock()
+
+	inputs, cutoff, err := db.beginMerge()
+	if err != nil || len(inputs) == 0 {
+		return err
+	}
+	defer func() {
+		db.mu.Lock()
+		db.merging = false
+		db.mu.Unlock()
+	}()
+
+	// 重写每个文件中仍然有效的 Entry，失败时丢弃已写入的临时文件
+	out := db.newMergeOutput()
+	fileIDs := make([]uint32, 0, len(inputs))
+	for _, dataFile := range inputs {
+		if err := db.mergeFile(dataFile, cutoff, out); err != nil {
+			out.discard()
+			if errors.Is(err, errMergeClosed) {
+				return err
+			}
+			return fmt.Errorf("合并数据文件 %d 失败: %w", dataFile.GetFileID(), err)
+		}
+		fileIDs = append(fileIDs, dataFile.GetFileID())
+	}
+	if err := crashAt(mergeStageRewritten); err != nil {
+		return err
+	}
+
+	// 发布输出文件，更新索引并删除旧文件
+	return db.publishMerge(out, fileIDs)
+}
+
+// beginMerge 在写锁内开始 Merge：轮转活跃文件，确定本次参与合并的文件（按 ID 升序）
+// 返回：
+//   - []*DataFile: 参与合并的文件，为空时不需要合并
+//   - int64: 保留窗口的起点，时间戳早于它的 Entry 不再重写，0 表示不限制
+//   - error: 错误
+func (db *DB) beginMerge() ([]*DataFile, int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, 0, errMergeClosed
+	}
+	if db.mergeBroken != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrMergeUnfinished, db.mergeBroken)
+	}
+
+	// 合并会丢弃墓碑与被删除的 Entry，先保存从它们恢复的追加写入计数器
+	if err := db.saveAppendSeq(); err != nil {
+		return nil, 0, err
+	}
+
+	// 先轮转活跃文件，让所有已有数据都进入旧文件
+	if db.activeFile.GetWriteOff() > 0 {
+		if err := db.rotateActiveFile(); err != nil {
+			return nil, 0, fmt.Errorf("轮转活跃文件失败: %w", err)
+		}
+	}
+
+	// 确定本次参与合并的文件（之后写入与重写产生的新文件不参与）
+	inputs := make([]*DataFile, 0, len(db.olderFiles))
+	for _, dataFile := range db.olderFiles {
+		inputs = append(inputs, dataFile)
+	}
+	if len(inputs) == 0 {
+		return nil, 0, nil
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].GetFileID() < inputs[j].GetFileID()
+	})
+
+	// 时间戳早于 cutoff 的 Entry 超出了保留窗口
+	var cutoff int64
+	if db.options.Retention > 0 {
+		cutoff = time.Now().Add(-db.options.Retention).UnixNano()
+	}
+
+	db.merging = true
+	return inputs, cutoff, nil
+}
+
+// mergeFile 将单个旧文件中仍然有效的 Entry 重写到 Merge 的输出文件
+// 时间戳早于 cutoff 的 Entry 被丢弃，cutoff 为 0 表示不限制；索引在发布之后才更新
+// 调用方不能持有锁
+func (db *DB) mergeFile(dataFile *DataFile, cutoff int64, out *mergeOutput) error {
+	records, err := db.mergeRecords(dataFile)
+	if err != nil {
+		return err
+	}
+	live, err := db.liveMergeRecords(dataFile.GetFileID(), records)
+	if err != nil {
+		return err
+	}
+
+	fileID := dataFile.GetFileID()
+	for _, rec := range live {
+		// 只读取有效 Entry 的 value；可信数据可以跳过 CRC 校验，重写时会重新计算
+		entry, err := dataFile.readEntry(rec.Offset, !db.options.MergeSkipCRC)
+		if err != nil {
+			return fmt.Errorf("读取 Entry 失败 (offset=%d): %w", rec.Offset, err)
+		}
+		from := storage.Position{FileID: fileID, Offset: rec.Offset}
+
+		// 超出保留窗口的 key 不再重写
+		if entry.Timestamp < cutoff {
+			out.expired = append(out.expired, mergeMove{key: entry.Key, from: from})
+			continue
+		}
+
+		// 重写时保留原有的 Seq 与时间戳
+		if err := out.write(entry, from); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// liveMergeRecords 过滤出索引仍指向其位置的记录
+// 墓碑不需要保留：它所遮蔽的旧 Entry 也在本次合并中被丢弃
+// 每 mergeLiveBatch 条记录持有一次读锁，数据库已关闭时返回 errMergeClosed
+func (db *DB) liveMergeRecords(fileID uint32, records []mergeRecord) ([]mergeRecord, error) {
+	live := records[:0]
+	for start := 0; start < len(records); start += mergeLiveBatch {
+		end := start + mergeLiveBatch
+		if end > len(records) {
+			end = len(records)
+		}
+
+		db.mu.RLock()
+		if db.closed {
+			db.mu.RUnlock()
+			return nil, errMergeClosed
+		}
+		for _, rec := range records[start:end] {
+			if rec.Type == EntryTypeTombstone {
+				continue
+			}
+			if pos := db.index.Get(rec.Key); pos != nil && pos.FileID == fileID && pos.Offset == rec.Offset {
+				live = append(live, rec)
+			}
+		}
+		db.mu.RUnlock()
+	}
+	return live, nil
+}
+
+// mergeRecords 列出数据文件中的全部记录
+// 启用 Key-Log 时只读取 Key-Log，否则顺序读取每个 Entry 的头部与 Key（不读取 value）
+func (db *DB) mergeRecords(dataFile *DataFile) ([]mergeRecord, error) {
+	var records []mergeRecord
+
+	if db.options.KeyLog {
+		keyLogRecords, err := db.loadKeyLog(dataFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range keyLogRecords {
+			records = append(records, mergeRecord{Key: rec.Key, Type: rec.Type, Offset: rec.Offset})
+		}
+		return records, nil
+	}
+
+	var offset int64
+	writeOff := dataFile.GetWriteOff()
+	for offset < writeOff {
+		entry, err := dataFile.readEntryKey(offset, !db.options.MergeSkipCRC)
+		if err != nil {
+			return nil, fmt.Errorf("读取 Entry 失败 (offset=%d): %w", offset, err)
+		}
+		records = append(records, mergeRecord{Key: entry.Key, Type: entry.Type, Offset: offset})
+		offset += int64(entry.Size())
+	}
+	return records, nil
+}
+
+// syncActive 同步活跃文件及其 Key-Log
+// 调用方必须持有读锁或写锁
+func (db *DB) syncActive() error {
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	if db.activeKeyLog != nil {
+		if err := db.activeKeyLog.Sync(); err != nil {
+			return fmt.Errorf("同步 Key-Log 失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeDataFile 关闭并删除一个旧文件及其 Key-Log
+// 调用方必须持有写锁
+func (db *DB) removeDataFile(fileID uint32) error {
+	dataFile, ok := db.olderFiles[fileID]
+	if !ok {
+		return nil
+	}
+	if err := dataFile.Close(); err != nil {
+		return fmt.Errorf("关闭数据文件 %d 失败: %w", fileID, err)
+	}
+	delete(db.olderFiles, fileID)
+	// 检查点记录的文件不再完整，下次打开时需要完整扫描
+	db.removeBootstrapCheckpoint()
+	if db.valueCache != nil {
+		db.valueCache.removeFile(fileID)
+	}
+
+	if err := db.options.FileSystem.Remove(db.GetFilePath(fileID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除数据文件 %d 失败: %w", fileID, err)
+	}
+	if err := db.options.FileSystem.Remove(keyLogPath(db.GetFilePath(fileID))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除 Key-Log %d 失败: %w", fileID, err)
+	}
+	return nil
+}
+
+// ==================== 按文件数量自动合并 ====================
+//
+// 每次轮转后检查旧文件数量，超过 MergeFileCountTrigger 时在后台执行一次 Merge。
+// 同一时间最多一个后台合并，合并自身轮转输出文件时不会再次触发。
+// 后台合并在另一个 goroutine 中执行 Merge，与 Merge 一样只在开始与发布时短暂持有写锁。
+// 存活数据本身就需要很多文件时，合并后文件数仍可能超过阈值；为避免每次轮转都重写全部数据，
+// 下一次触发至少要等到文件数达到上次合并结果的两倍。
+// 配置 MergeWindows 时只在时间窗口内调度，见 mergewindow.go。
+
+// autoMergeState 后台合并的状态，由 DB 的写锁保护（wg 除外）
+type autoMergeState struct {
+	running   bool           // 已调度或正在执行
+	lastFiles int            // 上次后台合并完成后的旧文件数量
+	runs      int            // 已完成的后台合并次数
+	lastErr   error          // 最近一次后台合并的错误
+	deferred  int            // 因不在时间窗口内被推迟的次数
+	timer     *time.Timer    // 下一个时间窗口开始时重新检查，未推迟时为 nil
+	wg        sync.WaitGroup // Close 等待正在进行的后台合并
+}
+
+// maybeScheduleMerge 旧文件数量超过阈值时调度后台合并
+// 调用方必须持有写锁
+func (db *DB) maybeScheduleMerge() {
+	trigger := db.options.MergeFileCountTrigger
+	if trigger <= 0 || db.autoMerge.running || db.merging || db.closed {
+		return
+	}
+	if threshold := 2 * db.autoMerge.lastFiles; threshold > trigger {
+		trigger = threshold
+	}
+	if len(db.olderFiles) <= trigger {
+		return
+	}
+	if !db.mergeAllowed() {
+		db.deferMerge()
+		return
+	}
+
+	db.autoMerge.running = true
+	db.autoMerge.wg.Add(1)
+	go db.runAutoMerge()
+}
+
+// runAutoMerge 执行后台合并
+func (db *DB) runAutoMerge() {
+	defer db.autoMerge.wg.Done()
+
+	err := db.Merge()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.autoMerge.running = false
+	if errors.Is(err, errMergeClosed) {
+		return
+	}
+	db.autoMerge.lastErr = err
+	db.autoMerge.lastFiles = len(db.olderFiles)
+	db.autoMerge.runs++
+}
+
+// AutoMergeStats 返回按文件数量触发的后台合并的完成次数与最近一次的错误
+func (db *DB) AutoMergeStats() (runs int, lastErr error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.autoMerge.runs, db.autoMerge.lastErr
+}
+
+// ==================== 合并优先级 ====================
+
+// FileDeadRatios 计算每个旧文件中已失效数据所占的比例，用于挑选最值得合并的文件
+// 一次遍历索引，按 FileID 累加仍然有效的 Entry 大小，与文件大小比较；
+// 被覆盖、删除的 Entry 以及墓碑都计为失效。活跃文件仍在写入，不参与统计。
+// 返回：
+//   - map[uint32]float64: 文件 ID -> 失效字节数 / 文件大小，取值范围 [0, 1]；空文件为 0
+func (db *DB) FileDeadRatios() map[uint32]float64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	live := make(map[uint32]int64, len(db.olderFiles))
+	iter := db.index.Seek(nil)
+	defer iter.Close()
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		pos := iter.Value()
+		if _, ok := db.olderFiles[pos.FileID]; ok {
+			live[pos.FileID] += int64(pos.Size)
+		}
+		iter.Next()
+	}
+
+	ratios := make(map[uint32]float64, len(db.olderFiles))
+	for fileID, dataFile := range db.olderFiles {
+		size := dataFile.GetWriteOff()
+		if size <= 0 {
+			ratios[fileID] = 0
+			continue
+		}
+		ratios[fileID] = float64(size-live[fileID]) / float64(size)
+	}
+	return ratios
+}
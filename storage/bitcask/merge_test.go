@@ -0,0 +1,830 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// dataDirSize 统计目录下所有 .data 文件的总大小
+func dataDirSize(t *testing.T, dir string) int64 {
+	files, err := OSFileSystem.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取目录失败: %v", err)
+	}
+	var total int64
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".data" {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			t.Fatalf("获取文件信息失败: %v", err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+func TestDB_Merge(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithDataFileSizeLimit(1024))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// 反复覆盖同一批 key，并删除其中一部分
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 10; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			value := []byte(fmt.Sprintf("value-%d-%d", i, round))
+			if err := db.Put(key, value); err != nil {
+				t.Fatalf("Put 失败: %v", err)
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Delete([]byte(fmt.Sprintf("key-%d", i))); err != nil {
+			t.Fatalf("Delete 失败: %v", err)
+		}
+	}
+
+	before := dataDirSize(t, dir)
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	after := dataDirSize(t, dir)
+	if after >= before {
+		t.Errorf("Merge 后空间未回收: before=%d, after=%d", before, after)
+	}
+
+	check := func(db *DB) {
+		for i := 0; i < 10; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			val, err := db.Get(key)
+			if i < 3 {
+				if err != storage.ErrKeyNotFound {
+					t.Errorf("%s 应已被删除, 得到: %v", key, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Get %s 失败: %v", key, err)
+			}
+			if want := fmt.Sprintf("value-%d-9", i); string(val) != want {
+				t.Errorf("值不匹配: got %s, want %s", val, want)
+			}
+		}
+	}
+	check(db)
+
+	// Merge 后继续写入，并验证重启后数据一致
+	if err := db.Put([]byte("key-9"), []byte("value-9-9")); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(dir, WithDataFileSizeLimit(1024))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	check(db)
+}
+
+func TestDB_MergeWithKeyLogSkipsDeadValues(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithKeyLog(true))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	bigValue := make([]byte, 4096)
+	var deadPositions []*storage.Position
+	for i := 0; i < 5; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if err := db.Put(key, bigValue); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+		deadPositions = append(deadPositions, db.index.Get(key))
+		if err := db.Put(key, []byte(fmt.Sprintf("live-%d", i))); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+	}
+
+	// 破坏所有已失效 Entry 的 value：如果 Merge 读取了它们，CRC 校验一定会失败
+	for _, pos := range deadPositions {
+		valueOffset := pos.Offset + HeaderSize + int64(len("key-0"))
+		patchTestFile(t, OSFileSystem, db.GetFilePath(pos.FileID), valueOffset, []byte("corrupted"))
+	}
+
+	before := dataDirSize(t, dir)
+	if err := db.Merge(); err != nil {
+		t.Fatalf("使用 Key-Log 的 Merge 不应读取失效的 value: %v", err)
+	}
+	after := dataDirSize(t, dir)
+	if after >= before/2 {
+		t.Errorf("Merge 后空间未充分回收: before=%d, after=%d", before, after)
+	}
+	db.Close()
+
+	// 重启后通过 Key-Log 重建索引
+	db, err = Open(dir, WithKeyLog(true))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			t.Fatalf("Get 失败: %v", err)
+		}
+		if want := fmt.Sprintf("live-%d", i); string(val) != want {
+			t.Errorf("值不匹配: got %s, want %s", val, want)
+		}
+	}
+}
+
+func TestDB_KeyLogRepairAfterCrash(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithKeyLog(true))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	db.Put([]byte("a"), []byte("1"))
+	db.Put([]byte("b"), []byte("2"))
+	fileID := db.activeFile.GetFileID()
+	db.Close()
+
+	// 模拟数据已写入但 Key-Log 尚未写入时崩溃：截掉最后一条 Key-Log 记录
+	path := keyLogPath(db.GetFilePath(fileID))
+	truncateTestFile(t, OSFileSystem, path, testFileSize(t, OSFileSystem, path)-int64(keyLogHeaderSize+1))
+
+	db, err = Open(dir, WithKeyLog(true))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if val, err := db.Get([]byte("b")); err != nil || string(val) != "2" {
+		t.Errorf("Key-Log 缺失的记录应从数据文件补齐: got %s, err %v", val, err)
+	}
+}
+
+func TestDB_MergeSkipCRC(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		t.Run(fmt.Sprintf("skip=%v", skip), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir, WithMergeSkipCRC(skip))
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			db.Put([]byte("a"), []byte("1"))
+			db.Put([]byte("b"), []byte("2"))
+
+			// 只破坏 b 存储的 CRC 字段，数据本身保持完好
+			pos := db.index.Get([]byte("b"))
+			patchTestFile(t, OSFileSystem, db.GetFilePath(pos.FileID), pos.Offset, []byte{0xde, 0xad, 0xbe, 0xef})
+
+			err = db.Merge()
+			if !skip {
+				if !errors.Is(err, ErrCRCMismatch) {
+					t.Fatalf("校验 CRC 时期望 ErrCRCMismatch, 得到: %v", err)
+				}
+				db.Close()
+				return
+			}
+			if err != nil {
+				t.Fatalf("跳过 CRC 校验时 Merge 失败: %v", err)
+			}
+			db.Close()
+
+			// 重写的 Entry 重新计算了 CRC，重启后正常读取（Get 会校验 CRC）
+			db, err = Open(dir)
+			if err != nil {
+				t.Fatalf("重新打开数据库失败: %v", err)
+			}
+			defer db.Close()
+			for key, want := range map[string]string{"a": "1", "b": "2"} {
+				val, err := db.Get([]byte(key))
+				if err != nil || string(val) != want {
+					t.Errorf("%s 值不匹配: got %s, err %v", key, val, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDB_MergeRetention(t *testing.T) {
+	for _, keyLog := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keyLog=%v", keyLog), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			opts := []Option{WithRetention(200 * time.Millisecond), WithKeyLog(keyLog), WithDataFileSizeLimit(256)}
+			db, err := Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+
+			// old-* 只有旧版本；refreshed 的旧版本随后被新版本覆盖
+			for i := 0; i < 5; i++ {
+				db.Put([]byte(fmt.Sprintf("old-%d", i)), []byte("old"))
+			}
+			db.Put([]byte("refreshed"), []byte("old"))
+			time.Sleep(300 * time.Millisecond)
+			for i := 0; i < 5; i++ {
+				db.Put([]byte(fmt.Sprintf("new-%d", i)), []byte("new"))
+			}
+			db.Put([]byte("refreshed"), []byte("new"))
+
+			// Merge 前超出保留窗口的数据仍可读取
+			if _, err := db.Get([]byte("old-0")); err != nil {
+				t.Fatalf("Merge 前 old-0 应可读取: %v", err)
+			}
+
+			if err := db.Merge(); err != nil {
+				t.Fatalf("Merge 失败: %v", err)
+			}
+
+			check := func(db *DB) {
+				for i := 0; i < 5; i++ {
+					key := []byte(fmt.Sprintf("old-%d", i))
+					if _, err := db.Get(key); err != storage.ErrKeyNotFound {
+						t.Errorf("%s 应已被清理, 得到: %v", key, err)
+					}
+					key = []byte(fmt.Sprintf("new-%d", i))
+					if val, err := db.Get(key); err != nil || string(val) != "new" {
+						t.Errorf("%s 值不匹配: got %s, err %v", key, val, err)
+					}
+				}
+				if val, err := db.Get([]byte("refreshed")); err != nil || string(val) != "new" {
+					t.Errorf("refreshed 值不匹配: got %s, err %v", val, err)
+				}
+			}
+			check(db)
+			db.Close()
+
+			// 重启后被清理的 key 不会复活
+			db, err = Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("重新打开数据库失败: %v", err)
+			}
+			defer db.Close()
+			check(db)
+		})
+	}
+}
+
+// mergeTempFiles 返回目录下未发布的 Merge 临时文件
+func mergeTempFiles(t *testing.T, dir string) []string {
+	files, err := OSFileSystem.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取目录失败: %v", err)
+	}
+	var temps []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), mergeTempSuffix) {
+			temps = append(temps, f.Name())
+		}
+	}
+	return temps
+}
+
+func TestDB_MergeCrashRecovery(t *testing.T) {
+	defer func() { mergeCrashPoint = nil }()
+
+	for _, keyLog := range []bool{false, true} {
+		for _, stage := range []string{mergeStageWritten, mergeStageCommitted, mergeStagePublished} {
+			t.Run(fmt.Sprintf("keyLog=%v/%s", keyLog, stage), func(t *testing.T) {
+				dir, err := os.MkdirTemp("", "bitcask_test")
+				if err != nil {
+					t.Fatalf("创建临时目录失败: %v", err)
+				}
+				defer os.RemoveAll(dir)
+
+				opts := []Option{WithKeyLog(keyLog), WithDataFileSizeLimit(512)}
+				db, err := Open(dir, opts...)
+				if err != nil {
+					t.Fatalf("打开数据库失败: %v", err)
+				}
+				want := make(map[string]string)
+				for round := 0; round < 5; round++ {
+					for i := 0; i < 20; i++ {
+						key := fmt.Sprintf("key-%02d", i)
+						if (i+round)%6 == 0 {
+							db.Delete([]byte(key))
+							delete(want, key)
+							continue
+						}
+						value := fmt.Sprintf("value-%d-%d", i, round)
+						if err := db.Put([]byte(key), []byte(value)); err != nil {
+							t.Fatalf("Put 失败: %v", err)
+						}
+						want[key] = value
+					}
+				}
+				before := countDataFiles(t, dir)
+
+				check := func(stage string, db *DB) {
+					t.Helper()
+					for i := 0; i < 20; i++ {
+						key := fmt.Sprintf("key-%02d", i)
+						val, err := db.Get([]byte(key))
+						if _, ok := want[key]; !ok {
+							if err != storage.ErrKeyNotFound {
+								t.Fatalf("%s: %s 应不存在, 得到: %v", stage, key, err)
+							}
+							continue
+						}
+						if err != nil || string(val) != want[key] {
+							t.Fatalf("%s: %s 值不匹配: got %s, want %s, err %v", stage, key, val, want[key], err)
+						}
+					}
+				}
+
+				// 在指定阶段模拟崩溃：Merge 立即返回，不做任何清理
+				crash := errors.New("模拟崩溃")
+				mergeCrashPoint = func(s string) error {
+					if s == stage {
+						return crash
+					}
+					return nil
+				}
+				if err := db.Merge(); !errors.Is(err, crash) {
+					t.Fatalf("Merge 应在 %s 阶段中止: %v", stage, err)
+				}
+				mergeCrashPoint = nil
+				if stage == mergeStageWritten {
+					if len(mergeTempFiles(t, dir)) == 0 {
+						t.Fatalf("发布之前崩溃时应留下临时文件")
+					}
+				} else if err := db.Merge(); !errors.Is(err, ErrMergeUnfinished) {
+					t.Fatalf("提交之后中止的 Merge 应阻止再次合并: %v", err)
+				}
+				db.Close()
+
+				db, err = Open(dir, opts...)
+				if err != nil {
+					t.Fatalf("重新打开数据库失败: %v", err)
+				}
+				if temps := mergeTempFiles(t, dir); len(temps) != 0 {
+					t.Fatalf("恢复后不应留下临时文件: %v", temps)
+				}
+				if _, err := OSFileSystem.Stat(db.mergeFooterPath()); !os.IsNotExist(err) {
+					t.Fatalf("恢复后 footer 应被删除: %v", err)
+				}
+				after := countDataFiles(t, dir)
+				if stage == mergeStageWritten && after < before {
+					t.Fatalf("发布之前崩溃时参与合并的文件应保留: before=%d, after=%d", before, after)
+				}
+				if stage != mergeStageWritten && after >= before {
+					t.Fatalf("提交之后崩溃时恢复应完成合并: before=%d, after=%d", before, after)
+				}
+				check("恢复后", db)
+
+				// 恢复后的写入晚于 Merge 的输出，合并后重新打开仍然一致
+				db.Put([]byte("key-01"), []byte("latest"))
+				want["key-01"] = "latest"
+				db.Delete([]byte("key-02"))
+				delete(want, "key-02")
+				if err := db.Merge(); err != nil {
+					t.Fatalf("恢复后 Merge 失败: %v", err)
+				}
+				check("再次合并后", db)
+				db.Close()
+
+				db, err = Open(dir, opts...)
+				if err != nil {
+					t.Fatalf("重新打开数据库失败: %v", err)
+				}
+				defer db.Close()
+				check("重新打开后", db)
+			})
+		}
+	}
+}
+
+func BenchmarkDB_Merge(b *testing.B) {
+	value := make([]byte, 4096)
+	for _, skip := range []bool{false, true} {
+		b.Run(fmt.Sprintf("skipCRC=%v", skip), func(b *testing.B) {
+			dir, err := os.MkdirTemp("", "bitcask_bench")
+			if err != nil {
+				b.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			db, err := Open(dir, WithMergeSkipCRC(skip), WithDataFileSizeLimit(1<<20))
+			if err != nil {
+				b.Fatalf("打开数据库失败: %v", err)
+			}
+			defer db.Close()
+			for i := 0; i < 2000; i++ {
+				db.Put([]byte(fmt.Sprintf("key-%d", i)), value)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := db.Merge(); err != nil {
+					b.Fatalf("Merge 失败: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDB_MergeConcurrentWrites(t *testing.T) {
+	defer func() { mergeCrashPoint = nil }()
+
+	for _, keyLog := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keyLog=%v", keyLog), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// 写锁被 Merge 持有时写入超时失败
+			opts := []Option{WithKeyLog(keyLog), WithDataFileSizeLimit(512), WithWriteTimeout(time.Second)}
+			db, err := Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			want := make(map[string]string)
+			for round := 0; round < 3; round++ {
+				for i := 0; i < 20; i++ {
+					key := fmt.Sprintf("key-%02d", i)
+					value := fmt.Sprintf("value-%d-%d", i, round)
+					if err := db.Put([]byte(key), []byte(value)); err != nil {
+						t.Fatalf("Put 失败: %v", err)
+					}
+					want[key] = value
+				}
+			}
+
+			check := func(stage string, db *DB) {
+				t.Helper()
+				for _, key := range []string{"key-00", "key-01", "key-02", "key-03", "new-key"} {
+					val, err := db.Get([]byte(key))
+					if _, ok := want[key]; !ok {
+						if err != storage.ErrKeyNotFound {
+							t.Fatalf("%s: %s 应不存在, 得到: %v", stage, key, err)
+						}
+						continue
+					}
+					if err != nil || string(val) != want[key] {
+						t.Fatalf("%s: %s 值不匹配: got %s, want %s, err %v", stage, key, val, want[key], err)
+					}
+				}
+			}
+
+			// 全部文件重写完、发布之前暂停 Merge
+			paused := make(chan struct{})
+			resume := make(chan struct{})
+			mergeCrashPoint = func(s string) error {
+				if s == mergeStageRewritten {
+					close(paused)
+					<-resume
+				}
+				return nil
+			}
+			done := make(chan error, 1)
+			go func() { done <- db.Merge() }()
+			select {
+			case <-paused:
+			case err := <-done:
+				t.Fatalf("Merge 提前结束: %v", err)
+			}
+
+			// 重写期间读写不被阻塞；被覆盖与删除的 key 已经写入输出文件
+			if err := db.Put([]byte("key-01"), []byte("during")); err != nil {
+				t.Fatalf("Merge 期间 Put 失败: %v", err)
+			}
+			want["key-01"] = "during"
+			if err := db.Delete([]byte("key-02")); err != nil {
+				t.Fatalf("Merge 期间 Delete 失败: %v", err)
+			}
+			delete(want, "key-02")
+			if err := db.Put([]byte("new-key"), []byte("new")); err != nil {
+				t.Fatalf("Merge 期间 Put 失败: %v", err)
+			}
+			want["new-key"] = "new"
+			check("Merge 期间", db)
+
+			close(resume)
+			if err := <-done; err != nil {
+				t.Fatalf("Merge 失败: %v", err)
+			}
+			mergeCrashPoint = nil
+			check("Merge 之后", db)
+			db.Close()
+
+			// 输出文件的 ID 大于 Merge 期间写入的文件，重放后仍以 Merge 期间的写入为准
+			db, err = Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("重新打开数据库失败: %v", err)
+			}
+			defer db.Close()
+			check("重新打开后", db)
+		})
+	}
+}
+
+func TestDB_MergeFileCountTrigger(t *testing.T) {
+	// 极小的文件大小限制产生大量小文件；没有覆盖与删除，合并不回收任何空间，只减少文件数量
+	const trigger, keys = 8, 100
+	value := []byte("value-0123456789-0123456789-0123456789")
+
+	// fill 写入 keys 个不同的 key，等待后台合并结束后返回数据文件数量
+	fill := func(db *DB) int {
+		for i := 0; i < keys; i++ {
+			if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), value); err != nil {
+				t.Fatalf("Put 失败: %v", err)
+			}
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			db.mu.RLock()
+			running, files := db.autoMerge.running, len(db.olderFiles)+1
+			db.mu.RUnlock()
+			if !running {
+				return files
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("后台合并未结束")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// 未启用时不自动合并
+	plainDir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(plainDir)
+	plain, err := Open(plainDir, WithDataFileSizeLimit(256))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer plain.Close()
+	unmerged := fill(plain)
+	if runs, _ := plain.AutoMergeStats(); runs != 0 {
+		t.Fatalf("未启用时不应自动合并: runs=%d", runs)
+	}
+	if unmerged <= trigger*2 {
+		t.Fatalf("测试数据应产生大量小文件: %d", unmerged)
+	}
+
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := Open(dir,
+		WithDataFileSizeLimit(256),
+		WithMergeFileCountTrigger(trigger),
+		WithMergeFileSizeLimit(64*1024),
+	)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 合并输出为一个大文件；合并期间的写入不被阻塞，产生的文件留给下一次合并
+	files := fill(db)
+	runs, mergeErr := db.AutoMergeStats()
+	if mergeErr != nil {
+		t.Fatalf("后台合并失败: %v", mergeErr)
+	}
+	if runs == 0 || files >= unmerged {
+		t.Fatalf("后台合并应减少文件数量: runs=%d, files=%d, 未合并 %d", runs, files, unmerged)
+	}
+	for i := 0; i < keys; i++ {
+		if _, err := db.Get([]byte(fmt.Sprintf("key-%04d", i))); err != nil {
+			t.Fatalf("合并后 Get 失败: %v", err)
+		}
+	}
+}
+
+func TestParseMergeWindow(t *testing.T) {
+	w, err := ParseMergeWindow("22:00-06:30")
+	if err != nil {
+		t.Fatalf("解析时间段失败: %v", err)
+	}
+	if w.Start != 22*time.Hour || w.End != 6*time.Hour+30*time.Minute {
+		t.Fatalf("时间段不匹配: %+v", w)
+	}
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		at   time.Duration
+		want bool
+	}{
+		{21*time.Hour + 59*time.Minute, false},
+		{22 * time.Hour, true},
+		{23 * time.Hour, true},
+		{6*time.Hour + 29*time.Minute, true},
+		{6*time.Hour + 30*time.Minute, false},
+		{12 * time.Hour, false},
+	} {
+		if got := w.contains(day.Add(tc.at)); got != tc.want {
+			t.Errorf("%v 是否在时间段内不匹配: got %v, want %v", tc.at, got, tc.want)
+		}
+	}
+	if next := w.nextStart(day.Add(23 * time.Hour)); !next.Equal(day.AddDate(0, 0, 1).Add(22 * time.Hour)) {
+		t.Errorf("下一次开始时间不匹配: %v", next)
+	}
+
+	for _, bad := range []string{"", "01:00", "01:00-25:00", "1-2", "03:00-03:00"} {
+		if _, err := ParseMergeWindow(bad); err == nil {
+			t.Errorf("%q 应解析失败", bad)
+		}
+	}
+}
+
+func TestDB_MergeWindow(t *testing.T) {
+	// 可控的时钟：从中午开始，时间窗口为凌晨 1 点到 5 点
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	var now atomic.Int64
+	now.Store(int64(12 * time.Hour))
+	mergeClock = func() time.Time { return day.Add(time.Duration(now.Load())) }
+	defer func() { mergeClock = time.Now }()
+	window, err := ParseMergeWindow("01:00-05:00")
+	if err != nil {
+		t.Fatalf("解析时间段失败: %v", err)
+	}
+
+	const trigger = 4
+	open := func(opts ...Option) *DB {
+		t.Helper()
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		db, err := Open(dir, append([]Option{
+			WithDataFileSizeLimit(256),
+			WithMergeFileCountTrigger(trigger),
+			WithMergeFileSizeLimit(64 * 1024),
+			WithMergeWindows(window),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	fill := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 50; i++ {
+			if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("value-0123456789-0123456789")); err != nil {
+				t.Fatalf("Put 失败: %v", err)
+			}
+		}
+	}
+	// waitRuns 等待后台合并结束，返回完成次数
+	waitRuns := func(db *DB) int {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			db.mu.RLock()
+			running := db.autoMerge.running
+			db.mu.RUnlock()
+			if !running {
+				runs, err := db.AutoMergeStats()
+				if err != nil {
+					t.Fatalf("后台合并失败: %v", err)
+				}
+				return runs
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("后台合并未结束")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// 窗口外触发的合并被推迟，并安排在窗口开始时重新检查
+	db := open()
+	fill(db)
+	if runs := waitRuns(db); runs != 0 {
+		t.Fatalf("窗口外不应执行后台合并: runs=%d", runs)
+	}
+	db.mu.RLock()
+	deferred, armed, files := db.autoMerge.deferred, db.autoMerge.timer != nil, len(db.olderFiles)
+	db.mu.RUnlock()
+	if deferred == 0 || !armed || files <= trigger {
+		t.Fatalf("合并应被推迟: deferred=%d, armed=%v, files=%d", deferred, armed, files)
+	}
+
+	// 窗口开始后重新检查，执行被推迟的合并
+	now.Store(int64(24*time.Hour + 2*time.Hour))
+	db.retryDeferredMerge()
+	if runs := waitRuns(db); runs != 1 {
+		t.Fatalf("窗口内应执行被推迟的合并: runs=%d", runs)
+	}
+	db.mu.RLock()
+	files = len(db.olderFiles)
+	db.mu.RUnlock()
+	if files > trigger {
+		t.Fatalf("合并后文件数量应减少: %d", files)
+	}
+
+	// 磁盘空间不足时不受窗口限制
+	now.Store(int64(12 * time.Hour))
+	fsys := &spaceFileSystem{FileSystem: OSFileSystem}
+	fsys.free.Store(1024)
+	urgent := open(WithFileSystem(fsys), WithMergeEmergencyFreeBytes(4096))
+	fill(urgent)
+	if runs := waitRuns(urgent); runs == 0 {
+		t.Fatalf("磁盘空间不足时应立即合并")
+	}
+}
+
+func TestDB_FileDeadRatios(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithDataFileSizeLimit(1024))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 热点 key 写满第一个文件，其余 key 分散在后续文件
+	hotFile := db.activeFile.GetFileID()
+	hot := 0
+	for ; db.activeFile.GetFileID() == hotFile; hot++ {
+		db.Put([]byte(fmt.Sprintf("hot-%d", hot)), []byte(fmt.Sprintf("value-%d", hot)))
+	}
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("cold-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+
+	// 覆盖热点 key 后，它们所在的文件几乎全部失效
+	for i := 0; i < hot; i++ {
+		db.Put([]byte(fmt.Sprintf("hot-%d", i)), []byte(fmt.Sprintf("new-%d", i)))
+	}
+
+	ratios := db.FileDeadRatios()
+	if len(ratios) != len(db.olderFiles) {
+		t.Fatalf("应统计全部旧文件: got %d, want %d", len(ratios), len(db.olderFiles))
+	}
+	if _, ok := ratios[db.activeFile.GetFileID()]; ok {
+		t.Fatal("活跃文件不应参与统计")
+	}
+	for fileID, ratio := range ratios {
+		if ratio < 0 || ratio > 1 {
+			t.Errorf("文件 %d 的失效比例超出范围: %f", fileID, ratio)
+		}
+		if fileID != hotFile && ratio >= ratios[hotFile] {
+			t.Errorf("文件 %d 的失效比例 %f 不应高于热点文件 %d 的 %f", fileID, ratio, hotFile, ratios[hotFile])
+		}
+	}
+	if ratios[hotFile] != 1 {
+		t.Errorf("热点文件应全部失效: %f", ratios[hotFile])
+	}
+
+	// Merge 之后没有失效数据
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	for fileID, ratio := range db.FileDeadRatios() {
+		if ratio != 0 {
+			t.Errorf("Merge 后文件 %d 不应有失效数据: %f", fileID, ratio)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== Merge 输出与原子发布 ====================
+//
+// Merge 的输出先写入临时文件：数据文件 <数据文件名>.merge 与对应的 Key-Log（hint）<Key-Log 名>.merge，
+// 文件 ID 在写锁内与活跃文件的轮转共用同一个计数器分配。全部写完后按以下顺序发布，第 2 步起持有写锁：
+//
+//  1. 同步并关闭全部临时文件
+//  2. 轮转到 ID 大于所有输出文件的新活跃文件，之后的写入在重放时晚于输出文件
+//  3. 重写期间被覆盖或删除的 key，如果当前状态位于 ID 小于输出文件的文件中，把最新的 Entry（或墓碑）重写到新活跃文件并同步，
+//     重放时它晚于输出文件中的旧版本；这些 key 的索引不再指向输出文件
+//  4. 写入 footer 临时文件，记录参与合并的文件与输出文件（ID 与大小），同步后重命名为 merge.footer，这是提交点
+//  5. 将临时文件重命名为正式名称，作为旧文件打开
+//  6. 更新索引，按 ID 升序删除参与合并的文件，最后删除 footer
+//
+// 重新打开时先执行 recoverMerge：存在 footer 说明已经提交，重命名尚未发布的输出文件并删除参与合并的文件；
+// 不存在 footer 时删除所有临时文件，参与合并的文件仍是权威数据。
+// 发布在提交之后失败时，本进程不再执行 Merge（ErrMergeUnfinished），重新打开数据库后由恢复流程完成。
+//
+// footer 文件格式（小端序）：
+//
+//	magic "TKVM" | version uint32
+//	inputCount uint32 | 每个参与合并的文件：fileID uint32
+//	outputCount uint32 | 每个输出文件：fileID uint32 | size uint64
+//	crc uint32（之前全部字节的 CRC32）
+
+const (
+	// mergeTempSuffix 未发布的 Merge 临时文件的后缀
+	mergeTempSuffix = ".merge"
+	// mergeFooterName Merge footer 的文件名
+	mergeFooterName = "merge.footer"
+
+	mergeFooterMagic   = "TKVM"
+	mergeFooterVersion = 1
+)
+
+// errBadMergeFooter 表示 Merge footer 格式错误或校验失败
+var errBadMergeFooter = errors.New("bad merge footer")
+
+// Merge 发布过程中的阶段，供测试钩子模拟崩溃
+const (
+	mergeStageRewritten = "rewritten" // 参与合并的文件已重写，尚未关闭输出文件，此时不持有锁
+	mergeStageWritten   = "written"   // 临时文件已写完并关闭，尚未提交
+	mergeStageCommitted = "committed" // footer 已提交，输出文件尚未重命名
+	mergeStagePublished = "published" // 输出文件已重命名，参与合并的文件尚未删除
+)
+
+// mergeCrashPoint 测试钩子：发布到各个阶段时调用，返回错误时立即返回且不做任何清理，模拟进程在该阶段崩溃
+// 钩子也可以阻塞，在该阶段插入并发的读写
+var mergeCrashPoint func(stage string) error
+
+// mergeOutputFile 一个 Merge 输出文件及其 Key-Log
+type mergeOutputFile struct {
+	dataFile *DataFile
+	keyLog   *KeyLog // 未启用 Key-Log 时为 nil
+	entries  int
+}
+
+// mergeMove 发布之后需要更新的索引位置
+// 只有索引仍指向 from 时才更新，否则 key 在重写期间已被覆盖或删除
+type mergeMove struct {
+	key  []byte
+	from storage.Position  // 参与合并的文件中的位置
+	pos  *storage.Position // 输出文件中的位置，超出保留窗口的 key 为 nil
+}
+
+// mergeOutput 一次 Merge 的输出：临时文件、发布后的索引更新与超出保留窗口的 key
+type mergeOutput struct {
+	db      *DB
+	files   []*mergeOutputFile
+	moves   []mergeMove
+	expired []mergeMove
+}
+
+// mergeFooterFile footer 中记录的一个输出文件
+type mergeFooterFile struct {
+	FileID uint32
+	Size   int64
+}
+
+// mergeFooter 解码后的 footer
+type mergeFooter struct {
+	Inputs  []uint32
+	Outputs []mergeFooterFile
+}
+
+// newMergeOutput 创建 Merge 输出
+func (db *DB) newMergeOutput() *mergeOutput {
+	return &mergeOutput{db: db}
+}
+
+// mergeTempPath 返回输出文件的临时路径
+func (db *DB) mergeTempPath(fileID uint32) string {
+	return db.GetFilePath(fileID) + mergeTempSuffix
+}
+
+// mergeKeyLogTempPath 返回输出文件的 Key-Log 的临时路径
+func (db *DB) mergeKeyLogTempPath(fileID uint32) string {
+	return keyLogPath(db.GetFilePath(fileID)) + mergeTempSuffix
+}
+
+// mergeFooterPath 返回 footer 的路径
+func (db *DB) mergeFooterPath() string {
+	return filepath.Join(db.dir, mergeFooterName)
+}
+
+// write 将位于 from 的 Entry 写入当前输出文件，按 MergeFileSizeLimit（未设置时为 DataFileSizeLimit）换到新文件
+func (out *mergeOutput) write(entry *Entry, from storage.Position) error {
+	db := out.db
+	limit := db.options.DataFileSizeLimit
+	if db.options.MergeFileSizeLimit > 0 {
+		limit = db.options.MergeFileSizeLimit
+	}
+
+	var cur *mergeOutputFile
+	if n := len(out.files); n > 0 {
+		cur = out.files[n-1]
+	}
+	if cur == nil || db.rotateNeeded(cur.dataFile.GetWriteOff(), cur.entries, entry, limit) {
+		var err error
+		if cur, err = out.open(); err != nil {
+			return err
+		}
+	}
+
+	offset, err := cur.dataFile.Write(entry)
+	if err != nil {
+		return fmt.Errorf("写入 Merge 输出文件失败: %w", err)
+	}
+	cur.entries++
+	if cur.keyLog != nil {
+		if err := cur.keyLog.Append(newKeyLogRecord(entry, offset)); err != nil {
+			return err
+		}
+	}
+
+	out.moves = append(out.moves, mergeMove{
+		key:  entry.Key,
+		from: from,
+		pos:  &storage.Position{FileID: cur.dataFile.GetFileID(), Offset: offset, Size: entry.Size()},
+	})
+	return nil
+}
+
+// open 创建下一个输出文件（以及启用时的 Key-Log），覆盖同名的残留临时文件
+// 文件 ID 在写锁内分配，大于已有的全部文件，之后轮转的活跃文件不会再使用它
+func (out *mergeOutput) open() (*mergeOutputFile, error) {
+	db := out.db
+	fsys := db.options.FileSystem
+	db.mu.Lock()
+	db.fileID++
+	fileID := db.fileID
+	db.mu.Unlock()
+
+	path := db.mergeTempPath(fileID)
+	file, err := fsys.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Merge 输出文件失败: %w", err)
+	}
+	f := &mergeOutputFile{dataFile: &DataFile{
+		FileID:       fileID,
+		File:         file,
+		name:         filepath.Base(path),
+		reuseBuffers: db.options.ReuseBuffers,
+	}}
+	out.files = append(out.files, f)
+
+	if db.options.KeyLog {
+		keyLogTemp := db.mergeKeyLogTempPath(fileID)
+		if err := fsys.Remove(keyLogTemp); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("删除残留的 Key-Log 临时文件失败: %w", err)
+		}
+		if f.keyLog, err = openKeyLog(fsys, keyLogTemp, fileID); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// close 同步并关闭全部输出文件
+func (out *mergeOutput) close() error {
+	for _, f := range out.files {
+		if err := f.dataFile.Close(); err != nil {
+			return err
+		}
+		if f.keyLog != nil {
+			if err := f.keyLog.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// discard 关闭并删除全部临时文件，用于提交之前失败的 Merge
+func (out *mergeOutput) discard() {
+	fsys := out.db.options.FileSystem
+	for _, f := range out.files {
+		f.dataFile.Close()
+		if f.keyLog != nil {
+			f.keyLog.Close()
+		}
+		fsys.Remove(out.db.mergeTempPath(f.dataFile.GetFileID()))
+		fsys.Remove(out.db.mergeKeyLogTempPath(f.dataFile.GetFileID()))
+	}
+	out.files = nil
+}
+
+// publishMerge 原子地发布 Merge 的输出，然后更新索引并删除参与合并的文件
+// 提交之前失败时丢弃临时文件，数据库中的数据保持不变；提交之后失败时返回 ErrMergeUnfinished
+// 关闭输出文件之后持有写锁直到发布完成，调用方不能持有锁
+func (db *DB) publishMerge(out *mergeOutput, inputs []uint32) error {
+	footer := &mergeFooter{Inputs: inputs}
+	for _, f := range out.files {
+		footer.Outputs = append(footer.Outputs, mergeFooterFile{FileID: f.dataFile.GetFileID(), Size: f.dataFile.GetWriteOff()})
+	}
+	if err := out.close(); err != nil {
+		out.discard()
+		return fmt.Errorf("关闭 Merge 输出文件失败: %w", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		out.discard()
+		return errMergeClosed
+	}
+	if err := crashAt(mergeStageWritten); err != nil {
+		return err
+	}
+
+	if len(footer.Outputs) > 0 {
+		if err := db.rotatePastMergeOutputs(); err != nil {
+			out.discard()
+			return err
+		}
+		if err := db.reconcileMergeMoves(out); err != nil {
+			out.discard()
+			return err
+		}
+	}
+	out.expired = db.unchangedMoves(out.expired)
+
+	if err := db.writeMergeFooter(footer); err != nil {
+		out.discard()
+		return fmt.Errorf("写入 Merge footer 失败: %w", err)
+	}
+	if err := crashAt(mergeStageCommitted); err != nil {
+		db.mergeBroken = err
+		return err
+	}
+
+	if err := db.completeMerge(out, footer); err != nil {
+		db.mergeBroken = err
+		return fmt.Errorf("%w: %w", ErrMergeUnfinished, err)
+	}
+	return nil
+}
+
+// crashAt 在发布的阶段调用测试钩子
+func crashAt(stage string) error {
+	if mergeCrashPoint == nil {
+		return nil
+	}
+	return mergeCrashPoint(stage)
+}
+
+// rotatePastMergeOutputs 轮转到 ID 大于全部已分配文件（包括 Merge 输出文件）的新活跃文件
+// 当前活跃文件为空时直接替换，否则作为旧文件保留
+// 调用方必须持有写锁
+func (db *DB) rotatePastMergeOutputs() error {
+	if db.activeFile.GetWriteOff() > 0 {
+		if err := db.rotateActiveFile(); err != nil {
+			return fmt.Errorf("轮转活跃文件失败: %w", err)
+		}
+		return nil
+	}
+	return db.replaceActiveFile(db.fileID + 1)
+}
+
+// reconcileMergeMoves 处理重写期间被覆盖或删除的 key，只保留仍然需要更新索引的 mergeMove
+// 这些 key 的当前状态如果位于 ID 小于输出文件的文件中，重放时会被输出文件中的旧版本覆盖，
+// 因此把最新的 Entry（保留原有的 Seq）或墓碑重写到活跃文件并同步，使其晚于全部输出文件
+// 调用方必须持有写锁，且活跃文件的 ID 大于全部输出文件
+func (db *DB) reconcileMergeMoves(out *mergeOutput) error {
+	moves := out.moves[:0]
+	rewritten := false
+	for _, move := range out.moves {
+		cur := db.index.Get(move.key)
+		if cur != nil && cur.FileID == move.from.FileID && cur.Offset == move.from.Offset {
+			moves = append(moves, move)
+			continue
+		}
+		// 当前版本位于输出文件之后，重放顺序已经正确
+		if cur != nil && cur.FileID > move.pos.FileID {
+			continue
+		}
+
+		entry := NewTombstoneEntry(move.key)
+		if cur != nil {
+			var err error
+			if entry, err = db.readEntry(cur); err != nil {
+				return fmt.Errorf("读取重写期间写入的 Entry 失败: %w", err)
+			}
+		}
+		pos, err := db.appendEntry(entry)
+		if err != nil {
+			return err
+		}
+		if cur != nil {
+			db.index.Put(move.key, pos)
+			db.trackRecentWrite(entry, pos)
+		}
+		rewritten = true
+	}
+	out.moves = moves
+
+	if !rewritten {
+		return nil
+	}
+	if err := db.syncActive(); err != nil {
+		return fmt.Errorf("同步活跃文件失败: %w", err)
+	}
+	return nil
+}
+
+// unchangedMoves 返回索引仍指向 from 的 mergeMove
+// 调用方必须持有写锁
+func (db *DB) unchangedMoves(moves []mergeMove) []mergeMove {
+	kept := moves[:0]
+	for _, move := range moves {
+		if cur := db.index.Get(move.key); cur != nil && cur.FileID == move.from.FileID && cur.Offset == move.from.Offset {
+			kept = append(kept, move)
+		}
+	}
+	return kept
+}
+
+// replaceActiveFile 用 ID 为 fileID 的新活跃文件替换当前为空的活跃文件
+// 调用方必须持有写锁，并保证当前活跃文件为空
+func (db *DB) replaceActiveFile(fileID uint32) error {
+	newFile, err := db.openFile(fileID)
+	if err != nil {
+		return fmt.Errorf("创建新的活跃文件失败: %w", err)
+	}
+	old := db.activeFile
+	db.activeFile = newFile
+	db.fileID = fileID
+	db.activeEntries = 0
+	if err := db.openActiveKeyLog(); err != nil {
+		return err
+	}
+
+	// 旧活跃文件为空，删除它；删除失败只会留下一个空的旧文件
+	old.Close()
+	db.options.FileSystem.Remove(db.GetFilePath(old.GetFileID()))
+	db.options.FileSystem.Remove(keyLogPath(db.GetFilePath(old.GetFileID())))
+	return nil
+}
+
+// completeMerge 发布已提交的 Merge：重命名输出文件并作为旧文件打开，更新索引，删除参与合并的文件与 footer
+// 调用方必须持有写锁
+func (db *DB) completeMerge(out *mergeOutput, footer *mergeFooter) error {
+	if err := db.renameMergeOutputs(footer); err != nil {
+		return err
+	}
+	for _, f := range footer.Outputs {
+		dataFile, err := db.openFile(f.FileID)
+		if err != nil {
+			return fmt.Errorf("打开 Merge 输出文件 %d 失败: %w", f.FileID, err)
+		}
+		db.olderFiles[f.FileID] = dataFile
+	}
+	if err := crashAt(mergeStagePublished); err != nil {
+		return err
+	}
+
+	for _, move := range out.moves {
+		db.index.Put(move.key, move.pos)
+	}
+	for _, move := range out.expired {
+		db.index.Delete(move.key)
+		db.suffixDelete(move.key)
+		db.secondaryDelete(move.key)
+	}
+
+	// 按 ID 升序删除参与合并的文件
+	for _, fileID := range footer.Inputs {
+		if err := db.removeDataFile(fileID); err != nil {
+			return err
+		}
+	}
+	return db.removeMergeFooter()
+}
+
+// renameMergeOutputs 将 footer 记录的输出文件从临时名称重命名为正式名称，已经重命名的文件跳过
+func (db *DB) renameMergeOutputs(footer *mergeFooter) error {
+	fsys := db.options.FileSystem
+	for _, f := range footer.Outputs {
+		path := db.GetFilePath(f.FileID)
+		if err := fsys.Rename(db.mergeTempPath(f.FileID), path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("发布 Merge 输出文件 %d 失败: %w", f.FileID, err)
+		}
+		info, err := fsys.Stat(path)
+		if err != nil {
+			return fmt.Errorf("Merge 输出文件 %d 缺失: %w", f.FileID, err)
+		}
+		if info.Size() != f.Size {
+			return fmt.Errorf("Merge 输出文件 %d 的大小与 footer 不一致: %d != %d", f.FileID, info.Size(), f.Size)
+		}
+		// Key-Log 缺失时在加载时从数据文件补齐
+		if err := fsys.Rename(db.mergeKeyLogTempPath(f.FileID), keyLogPath(path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("发布 Merge 输出文件 %d 的 Key-Log 失败: %w", f.FileID, err)
+		}
+	}
+	return nil
+}
+
+// recoverMerge 在启动引导之前完成已提交的 Merge，并删除未发布的临时文件
+func (db *DB) recoverMerge() error {
+	fsys := db.options.FileSystem
+	footer, err := db.readMergeFooter()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if footer != nil {
+		if err := db.renameMergeOutputs(footer); err != nil {
+			return err
+		}
+		for _, fileID := range footer.Inputs {
+			if err := fsys.Remove(db.GetFilePath(fileID)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("删除数据文件 %d 失败: %w", fileID, err)
+			}
+			if err := fsys.Remove(keyLogPath(db.GetFilePath(fileID))); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("删除 Key-Log %d 失败: %w", fileID, err)
+			}
+		}
+		db.removeBootstrapCheckpoint()
+		if err := db.removeMergeFooter(); err != nil {
+			return err
+		}
+	}
+
+	// 剩下的临时文件都属于未提交的 Merge
+	files, err := fsys.ReadDir(db.dir)
+	if err != nil {
+		return fmt.Errorf("读取目录失败: %w", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), mergeTempSuffix) {
+			continue
+		}
+		if err := fsys.Remove(filepath.Join(db.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除 Merge 临时文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeMergeFooter 写入 footer 临时文件并同步，再重命名为正式名称
+func (db *DB) writeMergeFooter(footer *mergeFooter) error {
+	buf := []byte(mergeFooterMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, mergeFooterVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(footer.Inputs)))
+	for _, fileID := range footer.Inputs {
+		buf = binary.LittleEndian.AppendUint32(buf, fileID)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(footer.Outputs)))
+	for _, f := range footer.Outputs {
+		buf = binary.LittleEndian.AppendUint32(buf, f.FileID)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(f.Size))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	fsys := db.options.FileSystem
+	temp := db.mergeFooterPath() + mergeTempSuffix
+	file, err := fsys.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		fsys.Remove(temp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		fsys.Remove(temp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		fsys.Remove(temp)
+		return err
+	}
+	if err := fsys.Rename(temp, db.mergeFooterPath()); err != nil {
+		fsys.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// readMergeFooter 读取并校验 footer
+// 返回：
+//   - *mergeFooter: footer
+//   - error: 文件不存在时返回满足 os.IsNotExist 的错误，格式错误或校验失败时返回 errBadMergeFooter
+func (db *DB) readMergeFooter() (*mergeFooter, error) {
+	data, err := readFile(db.options.FileSystem, db.mergeFooterPath())
+	if err != nil {
+		return nil, err
+	}
+	// footer 通过重命名发布，内容总是完整的；校验失败说明文件被破坏，无法判断发布进行到哪一步
+	if len(data) < 20 || !bytes.Equal(data[:4], []byte(mergeFooterMagic)) {
+		return nil, fmt.Errorf("%w: magic 不匹配", errBadMergeFooter)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%w: 校验失败", errBadMergeFooter)
+	}
+	if version := binary.LittleEndian.Uint32(body[4:8]); version != mergeFooterVersion {
+		return nil, fmt.Errorf("%w: 不支持的版本 %d", errBadMergeFooter, version)
+	}
+	truncated := fmt.Errorf("%w: 数据截断", errBadMergeFooter)
+
+	footer := &mergeFooter{}
+	body = body[8:]
+	inputCount := int(binary.LittleEndian.Uint32(body))
+	body = body[4:]
+	if len(body) < inputCount*4+4 {
+		return nil, truncated
+	}
+	for i := 0; i < inputCount; i++ {
+		footer.Inputs = append(footer.Inputs, binary.LittleEndian.Uint32(body))
+		body = body[4:]
+	}
+	outputCount := int(binary.LittleEndian.Uint32(body))
+	body = body[4:]
+	if len(body) != outputCount*12 {
+		return nil, truncated
+	}
+	for i := 0; i < outputCount; i++ {
+		footer.Outputs = append(footer.Outputs, mergeFooterFile{
+			FileID: binary.LittleEndian.Uint32(body),
+			Size:   int64(binary.LittleEndian.Uint64(body[4:])),
+		})
+		body = body[12:]
+	}
+	return footer, nil
+}
+
+// removeMergeFooter 删除 footer，文件不存在时不做任何事
+func (db *DB) removeMergeFooter() error {
+	if err := db.options.FileSystem.Remove(db.mergeFooterPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除 Merge footer 失败: %w", err)
+	}
+	return nil
+}
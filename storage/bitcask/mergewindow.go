@@ -0,0 +1,154 @@
+package bitcask
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ==================== 后台合并的时间窗口 ====================
+//
+// Merge 重写存活数据会占用磁盘带宽，运维通常希望它只在低峰时段执行。配置 MergeWindows 后，
+// 按文件数量触发的后台合并只在窗口内调度：窗口外触发的合并被推迟，
+// 在下一个窗口开始时（以及窗口内的下一次轮转时）重新检查并执行。
+//
+// 推迟合并会让旧文件继续积累、已删除的数据继续占用空间。配置 MergeEmergencyFreeBytes 后，
+// 磁盘可用空间低于该值时不受窗口限制立即合并（需要 FileSystem 实现 SpaceReporter）。
+// 手动调用 Merge 不受窗口限制。
+
+// MergeWindow 一天中允许后台合并的时间段（本地时间）
+// Start 与 End 为距当天零点的偏移；End 小于 Start 时跨越零点，例如 22:00-06:00
+type MergeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseMergeWindow 解析 "HH:MM-HH:MM" 格式的时间段
+// 参数：
+//   - s: 时间段，例如 "01:00-05:00"、"22:00-06:00"
+//
+// 返回：
+//   - MergeWindow: 时间段
+//   - error: 格式错误，或开始与结束时间相同
+func ParseMergeWindow(s string) (MergeWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return MergeWindow{}, fmt.Errorf("时间段格式应为 HH:MM-HH:MM: %q", s)
+	}
+	var w MergeWindow
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return MergeWindow{}, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return MergeWindow{}, err
+	}
+	if w.Start == w.End {
+		return MergeWindow{}, fmt.Errorf("时间段的开始与结束相同: %q", s)
+	}
+	return w, nil
+}
+
+// parseClock 解析 "HH:MM"，返回距零点的偏移
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为 HH:MM: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// WithMergeWindows 设置允许后台合并的时间段，不设置时随时可以合并
+func WithMergeWindows(windows ...MergeWindow) Option {
+	return func(o *Options) {
+		o.MergeWindows = windows
+	}
+}
+
+// WithMergeEmergencyFreeBytes 设置磁盘可用空间低于多少字节时不受时间窗口限制立即合并，0 表示不启用
+func WithMergeEmergencyFreeBytes(n uint64) Option {
+	return func(o *Options) {
+		o.MergeEmergencyFreeBytes = n
+	}
+}
+
+// mergeClock 判断时间窗口使用的时钟，测试中替换为可控的时钟
+var mergeClock = time.Now
+
+// contains 判断 t 是否在时间段内
+func (w MergeWindow) contains(t time.Time) bool {
+	offset := t.Sub(midnight(t))
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// nextStart 返回 t 之后（不含 t）时间段下一次开始的时刻
+func (w MergeWindow) nextStart(t time.Time) time.Time {
+	start := midnight(t).Add(w.Start)
+	if !start.After(t) {
+		start = midnight(t).AddDate(0, 0, 1).Add(w.Start)
+	}
+	return start
+}
+
+// midnight 返回 t 当天的零点
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// mergeAllowed 判断现在是否可以执行后台合并：在任一时间窗口内，或磁盘空间不足
+// 调用方必须持有写锁
+func (db *DB) mergeAllowed() bool {
+	if len(db.options.MergeWindows) == 0 {
+		return true
+	}
+	now := mergeClock()
+	for _, w := range db.options.MergeWindows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return db.mergeEmergency()
+}
+
+// mergeEmergency 判断磁盘可用空间是否低于 MergeEmergencyFreeBytes，查询失败时视为空间充足
+func (db *DB) mergeEmergency() bool {
+	threshold := db.options.MergeEmergencyFreeBytes
+	if threshold == 0 {
+		return false
+	}
+	reporter, ok := db.options.FileSystem.(SpaceReporter)
+	if !ok {
+		return false
+	}
+	free, err := reporter.FreeSpace(db.dir)
+	return err == nil && free < threshold
+}
+
+// deferMerge 推迟已触发的后台合并，在下一个时间窗口开始时重新检查
+// 调用方必须持有写锁
+func (db *DB) deferMerge() {
+	db.autoMerge.deferred++
+	if db.autoMerge.timer != nil {
+		return
+	}
+	now := mergeClock()
+	var next time.Time
+	for _, w := range db.options.MergeWindows {
+		if start := w.nextStart(now); next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	db.autoMerge.timer = time.AfterFunc(next.Sub(now), db.retryDeferredMerge)
+}
+
+// retryDeferredMerge 时间窗口开始时重新检查被推迟的后台合并
+func (db *DB) retryDeferredMerge() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.autoMerge.timer = nil
+	db.maybeScheduleMerge()
+}
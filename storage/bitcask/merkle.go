@@ -0,0 +1,254 @@
+package bitcask
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// ==================== 范围指纹与 Merkle 树 ====================
+//
+// Fingerprint 只能判断两个副本是否一致，不能指出差异在哪里。MerkleTree 把 key 空间按固定规则
+// 切分为 2^depth 个叶子范围：叶子的哈希是该范围的 RangeFingerprint，内部节点的哈希是两个子节点哈希
+// 拼接后的 SHA-256。范围边界只取决于 prefix 与 depth，与数据无关，因此两个节点各自构建的树可以
+// 逐个节点比较：从根开始只进入哈希不同的子树，O(depth) 层比较即可定位到存在差异的叶子范围，
+// 之后只需要同步这些范围内的数据。
+//
+// 叶子按 key 去掉 prefix 之后的前 depth 位划分（不足的位补 0），与 key 的字典序一致，
+// 每个叶子都是一个连续的 key 范围。所有 key 共享较长的前缀时，应把公共前缀作为 prefix 传入，
+// 否则数据会集中在少数叶子中。
+
+// MaxMerkleDepth Merkle 树的最大深度，对应 2^20 个叶子
+const MaxMerkleDepth = 20
+
+// KeyRange 左闭右开的 key 范围 [Start, End)
+// Start 为 nil 表示没有下界，End 为 nil 表示没有上界
+type KeyRange struct {
+	Start []byte
+	End   []byte
+}
+
+// Contains 判断 key 是否在范围内
+func (r KeyRange) Contains(key []byte) bool {
+	return bytes.Compare(key, r.Start) >= 0 && (r.End == nil || bytes.Compare(key, r.End) < 0)
+}
+
+// MerkleTree 前缀下 key 空间的 Merkle 树，构建之后不随数据库变化
+type MerkleTree struct {
+	prefix []byte
+	depth  int
+	// levels[l] 为第 l 层的节点哈希，第 0 层为根，第 depth 层为叶子
+	levels [][][]byte
+}
+
+// RangeFingerprint 计算范围 [start, end) 内全部存活键值对的指纹
+// 编码方式与 Fingerprint 相同，RangeFingerprint(nil, nil) 等于 Fingerprint()
+// 参数：
+//   - start: 起始 key（包含），nil 表示没有下界
+//   - end: 结束 key（不包含），nil 表示没有上界
+//
+// 返回：
+//   - []byte: 32 字节的指纹
+//   - error: 读取错误
+func (db *DB) RangeFingerprint(start, end []byte) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	h := sha256.New()
+	err := db.scanRange(start, end, func(key, value []byte) {
+		hashPair(h, key, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("计算范围指纹失败: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// MerkleTree 构建 prefix 下 key 空间的 Merkle 树
+// 构建时持有读锁扫描一次前缀下的全部键值对，得到的是某一时刻的一致视图
+// 参数：
+//   - prefix: key 前缀，nil 表示全部 key
+//   - depth: 树的深度，0 到 MaxMerkleDepth；叶子数量为 2^depth
+//
+// 返回：
+//   - *MerkleTree: Merkle 树
+//   - error: 深度超出范围或读取错误
+func (db *DB) MerkleTree(prefix []byte, depth int) (*MerkleTree, error) {
+	if depth < 0 || depth > MaxMerkleDepth {
+		return nil, fmt.Errorf("Merkle 树深度应在 0 到 %d 之间: %d", MaxMerkleDepth, depth)
+	}
+	t := &MerkleTree{
+		prefix: append([]byte(nil), prefix...),
+		depth:  depth,
+		levels: make([][][]byte, depth+1),
+	}
+
+	leaves := make([][]byte, 1<<depth)
+	var h hash.Hash
+	current := -1
+	db.mu.RLock()
+	err := db.scanRange(prefix, prefixEnd(prefix), func(key, value []byte) {
+		// key 按字典序遍历，叶子编号只增不减
+		if leaf := leafIndex(key[len(prefix):], depth); leaf != current {
+			if h != nil {
+				leaves[current] = h.Sum(nil)
+			}
+			h = sha256.New()
+			current = leaf
+		}
+		hashPair(h, key, value)
+	})
+	db.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("构建 Merkle 树失败: %w", err)
+	}
+	if h != nil {
+		leaves[current] = h.Sum(nil)
+	}
+	empty := sha256.Sum256(nil)
+	for i := range leaves {
+		if leaves[i] == nil {
+			leaves[i] = empty[:]
+		}
+	}
+
+	t.levels[depth] = leaves
+	for l := depth - 1; l >= 0; l-- {
+		children := t.levels[l+1]
+		nodes := make([][]byte, len(children)/2)
+		for i := range nodes {
+			h := sha256.New()
+			h.Write(children[2*i])
+			h.Write(children[2*i+1])
+			nodes[i] = h.Sum(nil)
+		}
+		t.levels[l] = nodes
+	}
+	return t, nil
+}
+
+// Depth 返回树的深度
+func (t *MerkleTree) Depth() int {
+	return t.depth
+}
+
+// Root 返回根节点的哈希
+func (t *MerkleTree) Root() []byte {
+	return t.levels[0][0]
+}
+
+// Hash 返回第 level 层第 index 个节点的哈希，第 level 层共有 2^level 个节点
+// 用于与远端逐层比较；level 或 index 超出范围时返回 nil
+func (t *MerkleTree) Hash(level, index int) []byte {
+	if level < 0 || level > t.depth || index < 0 || index >= len(t.levels[level]) {
+		return nil
+	}
+	return t.levels[level][index]
+}
+
+// Range 返回第 level 层第 index 个节点覆盖的 key 范围
+func (t *MerkleTree) Range(level, index int) KeyRange {
+	shift := uint(t.depth - level)
+	first, last := index<<shift, (index+1)<<shift
+	r := KeyRange{Start: t.leafStart(first), End: prefixEnd(t.prefix)}
+	if last < 1<<t.depth {
+		r.End = t.leafStart(last)
+	}
+	return r
+}
+
+// Diff 与另一棵树比较，返回哈希不同的叶子范围，按 key 的顺序排列
+// 只进入哈希不同的子树，两棵树相同时只比较根节点
+// 参数：
+//   - other: 另一个节点按相同 prefix 与 depth 构建的树
+//
+// 返回：
+//   - []KeyRange: 存在差异的叶子范围，两棵树相同时为空
+//   - error: prefix 或 depth 不同时返回错误
+func (t *MerkleTree) Diff(other *MerkleTree) ([]KeyRange, error) {
+	if t.depth != other.depth || !bytes.Equal(t.prefix, other.prefix) {
+		return nil, fmt.Errorf("Merkle 树的前缀或深度不同: %q/%d, %q/%d", t.prefix, t.depth, other.prefix, other.depth)
+	}
+	var ranges []KeyRange
+	var walk func(level, index int)
+	walk = func(level, index int) {
+		if bytes.Equal(t.levels[level][index], other.levels[level][index]) {
+			return
+		}
+		if level == t.depth {
+			ranges = append(ranges, t.Range(level, index))
+			return
+		}
+		walk(level+1, 2*index)
+		walk(level+1, 2*index+1)
+	}
+	walk(0, 0)
+	return ranges, nil
+}
+
+// leafStart 返回第 leaf 个叶子的起始 key：prefix 之后接叶子编号的 depth 位，去掉末尾的 0 字节
+// 去掉末尾的 0 字节后，按前 depth 位（不足补 0）划分的叶子与 key 的字典序一致
+func (t *MerkleTree) leafStart(leaf int) []byte {
+	bits := make([]byte, (t.depth+7)/8)
+	for b := 0; b < t.depth; b++ {
+		if leaf>>(t.depth-1-b)&1 == 1 {
+			bits[b/8] |= 0x80 >> (b % 8)
+		}
+	}
+	bits = bytes.TrimRight(bits, "\x00")
+	start := make([]byte, 0, len(t.prefix)+len(bits))
+	start = append(start, t.prefix...)
+	return append(start, bits...)
+}
+
+// leafIndex 取 rest 的前 depth 位作为叶子编号，不足的位补 0
+func leafIndex(rest []byte, depth int) int {
+	leaf := 0
+	for b := 0; b < depth; b++ {
+		leaf <<= 1
+		if b/8 < len(rest) && rest[b/8]&(0x80>>(b%8)) != 0 {
+			leaf |= 1
+		}
+	}
+	return leaf
+}
+
+// prefixEnd 返回大于所有以 prefix 开头的 key 的最小 key，prefix 为空或全为 0xff 时返回 nil（没有上界）
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// scanRange 按 key 的字典序遍历 [start, end) 内的全部键值对
+// 调用方必须持有读锁或写锁
+func (db *DB) scanRange(start, end []byte, fn func(key, value []byte)) error {
+	iter := db.index.Seek(start)
+	defer iter.Close()
+
+	for key := iter.Key(); key != nil && (end == nil || bytes.Compare(key, end) < 0); key = iter.Key() {
+		value, err := db.readValue(iter.Value())
+		if err != nil {
+			return err
+		}
+		fn(key, value)
+		iter.Next()
+	}
+	return nil
+}
+
+// hashPair 将一个键值对（长度前缀 + 内容）写入指纹
+func hashPair(h hash.Hash, key, value []byte) {
+	var lenBuf [binary.MaxVarintLen64]byte
+	h.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(key)))])
+	h.Write(key)
+	h.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(value)))])
+	h.Write(value)
+}
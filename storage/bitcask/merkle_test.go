@@ -0,0 +1,141 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestDB_MerkleTree(t *testing.T) {
+	open := func() *DB {
+		dir, err := os.MkdirTemp("", "bitcask_test")
+		if err != nil {
+			t.Fatalf("创建临时目录失败: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		db, err := Open(dir)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	build := func(db *DB, prefix []byte, depth int) *MerkleTree {
+		tree, err := db.MerkleTree(prefix, depth)
+		if err != nil {
+			t.Fatalf("构建 Merkle 树失败: %v", err)
+		}
+		return tree
+	}
+
+	a, b := open(), open()
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("user/%03d", i))
+		a.Put(key, []byte(fmt.Sprintf("v%d", i)))
+		b.Put(key, []byte(fmt.Sprintf("v%d", i)))
+	}
+	a.Put([]byte("zzz"), []byte("outside"))
+
+	fp, _ := a.Fingerprint()
+	if all, _ := a.RangeFingerprint(nil, nil); !bytes.Equal(all, fp) {
+		t.Fatalf("全范围的指纹应等于 Fingerprint")
+	}
+
+	// 前缀之外的 key 不影响前缀下的树
+	const depth = 8
+	prefix := []byte("user/")
+	ta, tb := build(a, prefix, depth), build(b, prefix, depth)
+	if !bytes.Equal(ta.Root(), tb.Root()) {
+		t.Fatalf("内容相同的前缀，根哈希应相同")
+	}
+	if ranges, err := ta.Diff(tb); err != nil || len(ranges) != 0 {
+		t.Fatalf("相同的树不应有差异: %v, %v", ranges, err)
+	}
+
+	// 只修改一个 key，比较应定位到包含它的叶子范围
+	changed := []byte("user/257")
+	b.Put(changed, []byte("diverged"))
+	tb = build(b, prefix, depth)
+	ranges, err := ta.Diff(tb)
+	if err != nil {
+		t.Fatalf("比较失败: %v", err)
+	}
+	if len(ranges) != 1 || !ranges[0].Contains(changed) {
+		t.Fatalf("差异应定位到包含 %s 的一个范围: %v", changed, ranges)
+	}
+	r := ranges[0]
+	if !bytes.HasPrefix(r.Start, prefix) || r.End == nil || !bytes.HasPrefix(r.End, prefix) {
+		t.Fatalf("叶子范围应在前缀之内: %q - %q", r.Start, r.End)
+	}
+
+	// 叶子哈希等于该范围的指纹：范围内不同，范围外相同
+	fa, _ := a.RangeFingerprint(r.Start, r.End)
+	fb, _ := b.RangeFingerprint(r.Start, r.End)
+	if bytes.Equal(fa, fb) || !bytes.Equal(fa, ta.Hash(depth, leafIndex(changed[len(prefix):], depth))) {
+		t.Fatalf("差异范围的指纹应不同，且等于叶子哈希")
+	}
+	for _, other := range []KeyRange{{Start: prefix, End: r.Start}, {Start: r.End, End: prefixEnd(prefix)}} {
+		fa, _ := a.RangeFingerprint(other.Start, other.End)
+		fb, _ := b.RangeFingerprint(other.Start, other.End)
+		if !bytes.Equal(fa, fb) {
+			t.Fatalf("差异范围之外的指纹应相同: %q - %q", other.Start, other.End)
+		}
+	}
+
+	// 各层节点的范围首尾相接，覆盖整个前缀
+	for level := 0; level <= depth; level++ {
+		start := ta.Range(level, 0).Start
+		if !bytes.Equal(start, prefix) {
+			t.Fatalf("第 %d 层应从前缀开始: %q", level, start)
+		}
+		for i := 0; i < 1<<level; i++ {
+			cur := ta.Range(level, i)
+			if !bytes.Equal(cur.Start, start) {
+				t.Fatalf("第 %d 层第 %d 个节点的范围不连续: %q != %q", level, i, cur.Start, start)
+			}
+			start = cur.End
+		}
+		if !bytes.Equal(start, prefixEnd(prefix)) {
+			t.Fatalf("第 %d 层应在前缀之后结束: %q", level, start)
+		}
+	}
+
+	// 删除 key 同样能定位
+	b.Put(changed, []byte("v257"))
+	b.Delete([]byte("user/003"))
+	ranges, _ = ta.Diff(build(b, prefix, depth))
+	if len(ranges) != 1 || !ranges[0].Contains([]byte("user/003")) {
+		t.Fatalf("删除的 key 应定位到包含它的范围: %v", ranges)
+	}
+
+	// 前缀或深度不同的树不能比较
+	if _, err := ta.Diff(build(b, prefix, depth-1)); err == nil {
+		t.Fatalf("深度不同时应返回错误")
+	}
+	if _, err := a.MerkleTree(nil, MaxMerkleDepth+1); err == nil {
+		t.Fatalf("深度超出范围时应返回错误")
+	}
+}
+
+func TestMerkleTree_LeafBoundaries(t *testing.T) {
+	// 叶子编号与 key 的字典序一致：key 落在自己编号的叶子范围内
+	tree := &MerkleTree{prefix: []byte("p"), depth: 12}
+	keys := [][]byte{
+		[]byte("p"), []byte("p\x00"), []byte("p\x00\x0f"), []byte("p\x01"), []byte("p\x01\x00"),
+		[]byte("p\x7f\xff"), []byte("p\x80"), []byte("p\xab\xcd"), []byte("p\xff\xf0"), []byte("p\xff\xff\xff"),
+	}
+	for _, key := range keys {
+		leaf := leafIndex(key[1:], tree.depth)
+		if r := tree.Range(tree.depth, leaf); !r.Contains(key) {
+			t.Errorf("key %q 不在叶子 %d 的范围 %q - %q 内", key, leaf, r.Start, r.End)
+		}
+	}
+
+	if end := prefixEnd([]byte("a\xff")); !bytes.Equal(end, []byte("b")) {
+		t.Errorf("前缀上界不匹配: %q", end)
+	}
+	if end := prefixEnd([]byte("\xff\xff")); end != nil {
+		t.Errorf("全为 0xff 的前缀没有上界: %q", end)
+	}
+}
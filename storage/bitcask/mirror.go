@@ -0,0 +1,192 @@
+package bitcask
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ==================== 镜像 ====================
+//
+// 镜像在不引入 Raft 的情况下为单写入者部署提供简单的容灾：每个成功写入主目录的 Entry
+// 都会异步追加到镜像目录中（保留原有的 Seq 与时间戳）。镜像目录本身就是一个普通的数据目录，
+// 主目录损坏时可以直接用 Open 打开镜像目录读取数据。
+//
+// 镜像是尽力而为的：队列已满时丢弃 Entry，镜像写入失败时只记录错误，都不会影响主目录的写入。
+// 丢弃或失败后镜像不再与主目录一致，可通过 MirrorStats 发现。
+
+// defaultMirrorQueueSize 镜像队列的默认容量
+const defaultMirrorQueueSize = 1024
+
+// MirrorStats 镜像的运行状态
+type MirrorStats struct {
+	Enabled   bool   // 是否启用镜像
+	Pending   int    // 队列中等待写入镜像的 Entry 数量
+	Mirrored  uint64 // 已写入镜像的 Entry 数量
+	Dropped   uint64 // 因队列已满被丢弃的 Entry 数量
+	Errors    uint64 // 写入镜像失败的次数
+	LastError string // 最近一次写入失败的错误信息
+	Lag       uint64 // 主目录最新 Seq 与镜像已写入的最新 Seq 之差
+}
+
+// mirrorOp 镜像队列中的一项：待写入的 Entry，或等待此前 Entry 全部写入的 flush 请求
+type mirrorOp struct {
+	entry *Entry
+	done  chan error
+}
+
+// mirror 将 Entry 异步写入镜像目录
+type mirror struct {
+	db    *DB
+	queue chan mirrorOp
+	wg    sync.WaitGroup
+
+	enqueuedSeq atomic.Uint64 // 最近一次入队的 Seq
+	mirroredSeq atomic.Uint64 // 最近一次写入镜像的 Seq
+	mirrored    atomic.Uint64
+	dropped     atomic.Uint64
+	errors      atomic.Uint64
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// openMirror 打开镜像目录并启动写入 goroutine
+// 镜像目录沿用主目录的文件系统与文件布局相关的配置
+func openMirror(dir string, options *Options) (*mirror, error) {
+	db, err := Open(dir,
+		WithFileSystem(options.FileSystem),
+		WithDataFileSizeLimit(options.DataFileSizeLimit),
+		WithMaxKeySize(options.MaxKeySize),
+		WithMaxValueSize(options.MaxValueSize),
+		WithKeyLog(options.KeyLog),
+		WithFileNamer(options.FileNamer),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mirror{
+		db:    db,
+		queue: make(chan mirrorOp, defaultMirrorQueueSize),
+	}
+	m.wg.Add(1)
+	go m.run()
+	return m, nil
+}
+
+// enqueue 将 Entry 的副本放入队列，队列已满时丢弃
+// 调用方持有主目录的写锁，因此不能阻塞
+func (m *mirror) enqueue(entry *Entry) {
+	clone := &Entry{
+		Timestamp: entry.Timestamp,
+		Seq:       entry.Seq,
+		KeySize:   entry.KeySize,
+		ValueSize: entry.ValueSize,
+		Flags:     entry.Flags,
+		Type:      entry.Type,
+		Key:       append([]byte(nil), entry.Key...),
+		Value:     append([]byte(nil), entry.Value...),
+	}
+	m.enqueuedSeq.Store(entry.Seq)
+
+	select {
+	case m.queue <- mirrorOp{entry: clone}:
+	default:
+		m.dropped.Add(1)
+		m.recordError(ErrMirrorQueueFull)
+	}
+}
+
+// run 按入队顺序将 Entry 写入镜像
+func (m *mirror) run() {
+	defer m.wg.Done()
+	for op := range m.queue {
+		if op.done != nil {
+			m.db.mu.Lock()
+			op.done <- m.db.syncActive()
+			m.db.mu.Unlock()
+			continue
+		}
+		if err := m.db.applyMirrored(op.entry); err != nil {
+			m.errors.Add(1)
+			m.recordError(fmt.Errorf("写入镜像失败 (seq=%d): %w", op.entry.Seq, err))
+			continue
+		}
+		m.mirrored.Add(1)
+		m.mirroredSeq.Store(op.entry.Seq)
+	}
+}
+
+// flush 等待此前入队的 Entry 全部写入镜像并落盘
+func (m *mirror) flush() error {
+	done := make(chan error, 1)
+	m.queue <- mirrorOp{done: done}
+	return <-done
+}
+
+// close 写完队列中剩余的 Entry 后关闭镜像目录
+func (m *mirror) close() error {
+	close(m.queue)
+	m.wg.Wait()
+	return m.db.Close()
+}
+
+func (m *mirror) recordError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastErr = err
+}
+
+func (m *mirror) stats() MirrorStats {
+	stats := MirrorStats{
+		Enabled:  true,
+		Pending:  len(m.queue),
+		Mirrored: m.mirrored.Load(),
+		Dropped:  m.dropped.Load(),
+		Errors:   m.errors.Load(),
+	}
+	if enqueued, mirrored := m.enqueuedSeq.Load(), m.mirroredSeq.Load(); enqueued > mirrored {
+		stats.Lag = enqueued - mirrored
+	}
+	m.mu.Lock()
+	if m.lastErr != nil {
+		stats.LastError = m.lastErr.Error()
+	}
+	m.mu.Unlock()
+	return stats
+}
+
+// applyMirrored 将主目录的 Entry 原样写入镜像，保留 Seq 与时间戳
+func (db *DB) applyMirrored(entry *Entry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if entry.Seq > db.seq {
+		db.seq = entry.Seq
+	}
+	return db.applyEntry(entry)
+}
+
+// FlushMirror 等待此前的写入全部进入镜像目录并落盘
+// 未启用镜像时直接返回
+func (db *DB) FlushMirror() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.mirror == nil {
+		return nil
+	}
+	return db.mirror.flush()
+}
+
+// MirrorStats 返回镜像的运行状态，未启用镜像时返回零值
+func (db *DB) MirrorStats() MirrorStats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.mirror == nil {
+		return MirrorStats{}
+	}
+	return db.mirror.stats()
+}
@@ -0,0 +1,110 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+func TestDB_Mirror(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mirrorDir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(mirrorDir)
+
+	db, err := Open(dir, WithMirror(mirrorDir), WithDataFileSizeLimit(512))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		db.Delete([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	db.Put([]byte("key-20"), []byte("updated"))
+	db.ReplacePrefix([]byte("cfg/"), []KV{{Key: []byte("cfg/a"), Value: []byte("1")}})
+
+	if err := db.FlushMirror(); err != nil {
+		t.Fatalf("FlushMirror 失败: %v", err)
+	}
+	stats := db.MirrorStats()
+	if !stats.Enabled || stats.Pending != 0 || stats.Lag != 0 || stats.Dropped != 0 || stats.Errors != 0 {
+		t.Errorf("镜像状态不匹配: %+v", stats)
+	}
+	if stats.Mirrored != 62 {
+		t.Errorf("镜像 Entry 数量不匹配: got %d, want 62", stats.Mirrored)
+	}
+
+	// 记录主目录中每个 key 的值与 Seq
+	want := make(map[string]*storage.EntryMeta)
+	values := make(map[string]string)
+	db.ScanPrefix(nil, func(key, value []byte) bool {
+		meta, err := db.EntryMeta(key)
+		if err != nil {
+			t.Fatalf("EntryMeta 失败: %v", err)
+		}
+		want[string(key)] = meta
+		values[string(key)] = string(value)
+		return true
+	})
+	db.Close()
+
+	// 镜像目录可以作为普通数据目录打开，内容与 Seq 都与主目录一致
+	mirror, err := Open(mirrorDir)
+	if err != nil {
+		t.Fatalf("打开镜像目录失败: %v", err)
+	}
+	defer mirror.Close()
+
+	got := 0
+	mirror.ScanPrefix(nil, func(key, value []byte) bool {
+		got++
+		if string(value) != values[string(key)] {
+			t.Errorf("%s 值不匹配: got %s, want %s", key, value, values[string(key)])
+		}
+		if meta, _ := mirror.EntryMeta(key); want[string(key)] == nil || meta.Seq != want[string(key)].Seq {
+			t.Errorf("%s Seq 不匹配: got %+v, want %+v", key, meta, want[string(key)])
+		}
+		return true
+	})
+	if got != len(want) {
+		t.Errorf("镜像 key 数量不匹配: got %d, want %d", got, len(want))
+	}
+	if _, err := mirror.Get([]byte("key-0")); err != storage.ErrKeyNotFound {
+		t.Errorf("删除同样应写入镜像, 得到: %v", err)
+	}
+}
+
+func TestDB_MirrorDisabled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("k"), []byte("v"))
+	if err := db.FlushMirror(); err != nil {
+		t.Errorf("未启用镜像时 FlushMirror 应直接返回: %v", err)
+	}
+	if stats := db.MirrorStats(); stats.Enabled {
+		t.Errorf("未启用镜像时状态应为零值: %+v", stats)
+	}
+}
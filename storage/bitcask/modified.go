@@ -0,0 +1,50 @@
+package bitcask
+
+// ==================== 增量同步 ====================
+//
+// 索引中不保存时间戳，KeysModifiedSince 遍历索引并按需读取每个 key 当前 Entry 的头部，
+// 代价与 key 数量成正比（每个 key 一次头部读取），适合缓存预热、增量同步等低频场景。
+
+// KeysModifiedSince 返回当前 Entry 时间戳晚于 ts 的全部 key，按 key 升序
+// 时间戳为写入时的 time.Now().UnixNano()，受节点时钟影响；
+// 头部无法读取的 Entry 会被跳过。
+// 参数：
+//   - ts: 截止时间戳（纳秒），不包含等于 ts 的 Entry
+//
+// 返回：
+//   - [][]byte: 在 ts 之后写入的 key
+func (db *DB) KeysModifiedSince(ts int64) [][]byte {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	iter := db.index.Seek(nil)
+	defer iter.Close()
+
+	var keys [][]byte
+	for key := iter.Key(); key != nil; key = iter.Key() {
+		pos := iter.Value()
+		if timestamp, ok := db.entryTimestamp(pos.FileID, pos.Offset); ok && timestamp > ts {
+			keys = append(keys, key)
+		}
+		iter.Next()
+	}
+	return keys
+}
+
+// entryTimestamp 只读取 Entry 头部，返回其时间戳
+// 调用方必须持有读锁或写锁
+func (db *DB) entryTimestamp(fileID uint32, offset int64) (int64, bool) {
+	dataFile := db.dataFileFor(fileID)
+	if dataFile == nil {
+		return 0, false
+	}
+	data, err := dataFile.Read(offset, HeaderSize)
+	if err != nil {
+		return 0, false
+	}
+	header, err := DecodeHeader(data)
+	if err != nil {
+		return 0, false
+	}
+	return header.Timestamp, true
+}
@@ -0,0 +1,78 @@
+package bitcask
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ==================== 文件命名 ====================
+//
+// 数据文件名由 FileNamer 生成与解析：打开、轮转、Merge 删除文件以及启动时发现数据文件都经过它，
+// 目录中不符合命名规则的文件会被忽略，因此可以与其他文件共存于同一目录。
+// Key-Log 文件名由数据文件名去掉扩展名后加上 ".keys" 得到。
+
+// FileNamer 数据文件的命名规则
+type FileNamer interface {
+	// DataFileName 返回文件 ID 对应的数据文件名（不含目录）
+	DataFileName(fileID uint32) string
+
+	// ParseDataFileName 从文件名中解析文件 ID
+	// 返回：
+	//   - uint32: 文件 ID
+	//   - bool: 文件名是否符合命名规则，不符合的文件不是数据文件
+	ParseDataFileName(name string) (uint32, bool)
+}
+
+// PatternFileNamer 按 前缀 + 十进制文件 ID + 扩展名 命名，例如 "seg-000001.log"
+type PatternFileNamer struct {
+	Prefix    string // 文件名前缀，可为空
+	Extension string // 扩展名（包含 "."），可为空
+	Digits    int    // 文件 ID 补零后的最小位数，0 表示不补零
+}
+
+// DefaultFileNamer 默认的命名规则："%08d.data"
+var DefaultFileNamer FileNamer = PatternFileNamer{Extension: ".data", Digits: 8}
+
+// DataFileName 返回文件 ID 对应的数据文件名
+func (n PatternFileNamer) DataFileName(fileID uint32) string {
+	return fmt.Sprintf("%s%0*d%s", n.Prefix, n.Digits, fileID, n.Extension)
+}
+
+// ParseDataFileName 从文件名中解析文件 ID，前缀与扩展名之间必须全部是数字
+func (n PatternFileNamer) ParseDataFileName(name string) (uint32, bool) {
+	if len(name) <= len(n.Prefix)+len(n.Extension) ||
+		!strings.HasPrefix(name, n.Prefix) || !strings.HasSuffix(name, n.Extension) {
+		return 0, false
+	}
+	digits := name[len(n.Prefix) : len(name)-len(n.Extension)]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	id, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// WithFileNamer 设置数据文件的命名规则，nil 表示使用 DefaultFileNamer
+// 同一个目录必须始终使用相同的命名规则打开，否则已有的数据文件不会被发现
+func WithFileNamer(namer FileNamer) Option {
+	return func(o *Options) {
+		o.FileNamer = namer
+	}
+}
+
+// keyLogPath 返回数据文件对应的 Key-Log 路径：去掉数据文件的扩展名后加上 keyLogSuffix
+// 数据文件的扩展名恰好是 keyLogSuffix 时直接追加，避免两者重名
+func keyLogPath(dataPath string) string {
+	base := strings.TrimSuffix(dataPath, filepath.Ext(dataPath))
+	if base+keyLogSuffix == dataPath {
+		return dataPath + keyLogSuffix
+	}
+	return base + keyLogSuffix
+}
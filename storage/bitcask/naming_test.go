@@ -0,0 +1,112 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hexFileNamer 以十六进制文件 ID 命名的测试用命名规则，例如 "0000001a.seg"
+type hexFileNamer struct{}
+
+func (hexFileNamer) DataFileName(fileID uint32) string {
+	return fmt.Sprintf("%08x.seg", fileID)
+}
+
+func (hexFileNamer) ParseDataFileName(name string) (uint32, bool) {
+	if !strings.HasSuffix(name, ".seg") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, ".seg"), 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+func TestPatternFileNamer(t *testing.T) {
+	namer := PatternFileNamer{Prefix: "seg-", Extension: ".log", Digits: 4}
+	if got := namer.DataFileName(12); got != "seg-0012.log" {
+		t.Fatalf("文件名不匹配: got %s", got)
+	}
+
+	tests := []struct {
+		name string
+		id   uint32
+		ok   bool
+	}{
+		{"seg-0012.log", 12, true},
+		{"seg-123456.log", 123456, true},
+		{"seg-.log", 0, false},
+		{"seg-12a.log", 0, false},
+		{"seg-0012.data", 0, false},
+		{"0012.log", 0, false},
+		{"seg-99999999999.log", 0, false}, // 超出 uint32
+	}
+	for _, tt := range tests {
+		id, ok := namer.ParseDataFileName(tt.name)
+		if id != tt.id || ok != tt.ok {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, id, ok, tt.id, tt.ok)
+		}
+	}
+
+	if id, ok := DefaultFileNamer.ParseDataFileName("00000007.data"); !ok || id != 7 {
+		t.Errorf("默认命名规则解析失败: got (%d, %v)", id, ok)
+	}
+}
+
+func TestDB_CustomFileNamer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 目录中不符合命名规则的文件（包括默认命名的文件）都会被忽略
+	for _, name := range []string{"notes.txt", "00000001.data"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("not a data file"), 0644); err != nil {
+			t.Fatalf("写入无关文件失败: %v", err)
+		}
+	}
+
+	opts := []Option{WithFileNamer(hexFileNamer{}), WithKeyLog(true), WithDataFileSizeLimit(1024)}
+	db, err := Open(dir, opts...)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%03d", i)))
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	db.Close()
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(names) < 2 {
+		t.Fatalf("应按自定义规则生成多个数据文件, 得到 %v", names)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(keyLogPath(name)); err != nil {
+			t.Errorf("数据文件 %s 缺少对应的 Key-Log: %v", filepath.Base(name), err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("无关文件不应被删除: %v", err)
+	}
+
+	db, err = Open(dir, opts...)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%03d", i)))
+		if err != nil || string(value) != fmt.Sprintf("value-%03d", i) {
+			t.Fatalf("重启后读取 key-%03d 失败: %q, %v", i, value, err)
+		}
+	}
+}
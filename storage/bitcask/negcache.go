@@ -0,0 +1,85 @@
+package bitcask
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ==================== 负缓存 ====================
+//
+// Delete 只从索引中移除 key，不会更新布隆过滤器（布隆过滤器不支持删除），
+// 大量删除之后读取已删除的 key 总能通过过滤器，再到索引中查询落空，过滤器失去作用。
+// 负缓存记录最近在索引中确认不存在的 key，重复读取同一个 key 时在过滤器之后直接返回不存在。
+//
+// 负缓存是有界的 LRU：超过容量时淘汰最久未命中的 key。
+// 写入 key 时（Put、PutAll 等所有更新索引的路径）从负缓存中移除它，保证不会把存在的 key 报告为不存在。
+
+// WithNegativeCache 启用负缓存，最多记录 size 个最近确认不存在的 key，size <= 0 表示不启用
+func WithNegativeCache(size int) Option {
+	return func(o *Options) {
+		o.NegativeCacheSize = size
+	}
+}
+
+// negativeCache 最近确认不存在的 key 的有界集合
+// Get 只持有 DB 的读锁，因此使用独立的互斥锁
+type negativeCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List               // 按最近命中排序，表头最新
+	items    map[string]*list.Element // key → 链表节点，节点值为 key
+}
+
+// newNegativeCache 创建负缓存
+func newNegativeCache(capacity int) *negativeCache {
+	return &negativeCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// contains 判断 key 是否被记录为不存在，命中时将其移到表头
+func (c *negativeCache) contains(key []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[string(key)]
+	if ok {
+		c.ll.MoveToFront(elem)
+	}
+	return ok
+}
+
+// add 记录 key 不存在，超过容量时淘汰最久未命中的 key
+func (c *negativeCache) add(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[string(key)]; ok {
+		c.ll.MoveToFront(elem)
+		return
+	}
+	k := string(key)
+	c.items[k] = c.ll.PushFront(k)
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(string))
+	}
+}
+
+// remove 移除 key 的记录，key 被写入时调用
+func (c *negativeCache) remove(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[string(key)]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, string(key))
+	}
+}
+
+// len 返回记录的 key 数量
+func (c *negativeCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,87 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/forever-free1/TideKV/storage/index"
+)
+
+// countingIndex 统计 Get 调用次数的索引包装
+type countingIndex struct {
+	index.Index
+	gets int
+}
+
+func (c *countingIndex) Get(key []byte) *storage.Position {
+	c.gets++
+	return c.Index.Get(key)
+}
+
+func TestDB_NegativeCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithNegativeCache(2))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	counter := &countingIndex{Index: db.index}
+	db.index = counter
+
+	for i := 0; i < 3; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if err := db.Put(key, []byte("value")); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+		if err := db.Delete(key); err != nil {
+			t.Fatalf("Delete 失败: %v", err)
+		}
+	}
+
+	// 已删除的 key 仍能通过布隆过滤器，只有第一次读取查询索引
+	counter.gets = 0
+	for i := 0; i < 5; i++ {
+		if _, err := db.Get([]byte("key-0")); err != storage.ErrKeyNotFound {
+			t.Fatalf("读取已删除的 key 应返回 ErrKeyNotFound: %v", err)
+		}
+	}
+	if counter.gets != 1 {
+		t.Fatalf("重复读取已删除的 key 应只查询一次索引: %d", counter.gets)
+	}
+
+	// 重新写入后负缓存失效
+	if err := db.Put([]byte("key-0"), []byte("again")); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	if value, err := db.Get([]byte("key-0")); err != nil || string(value) != "again" {
+		t.Fatalf("重新写入后应能读到新值: %q, %v", value, err)
+	}
+	if err := db.PutAll([]KV{{Key: []byte("key-1"), Value: []byte("bulk")}}); err != nil {
+		t.Fatalf("PutAll 失败: %v", err)
+	}
+	if value, err := db.Get([]byte("key-1")); err != nil || string(value) != "bulk" {
+		t.Fatalf("PutAll 之后应能读到新值: %q, %v", value, err)
+	}
+
+	// 超过容量时淘汰最久未命中的 key
+	db.Delete([]byte("key-0"))
+	db.Delete([]byte("key-1"))
+	for i := 0; i < 3; i++ {
+		db.Get([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	if n := db.negCache.len(); n != 2 {
+		t.Fatalf("负缓存的大小应受容量限制: %d", n)
+	}
+	counter.gets = 0
+	db.Get([]byte("key-0"))
+	if counter.gets != 1 {
+		t.Fatalf("被淘汰的 key 应重新查询索引: %d", counter.gets)
+	}
+}
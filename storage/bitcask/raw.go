@@ -0,0 +1,89 @@
+package bitcask
+
+import (
+	"fmt"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 原始 Entry ====================
+//
+// 代理与复制程序在两个 TideKV 实例之间转发数据时，不需要解码 value 再重新构造 Entry。
+// GetRawEntry 返回磁盘上编码后的完整 Entry（头部 + key + value），
+// PutRawEntry 校验后把它追加到本地并更新索引，时间戳、类型、压缩标志、key 与 value 保持原样。
+//
+// 写入序号是每个实例本地的，用于确定同一个 key 的版本先后，
+// 因此 PutRawEntry 按本地写入顺序重新分配序号（CRC 随之重新计算），其余字节不变。
+
+// GetRawEntry 读取 key 当前对应的编码后的完整 Entry
+// 返回前校验 CRC，不会转发已损坏的数据
+// 参数：
+//   - key: 键
+//
+// 返回：
+//   - []byte: 磁盘上的 Entry 字节，调用方可以持有
+//   - error: key 不存在时返回 storage.ErrKeyNotFound，读取失败或校验失败时返回相应错误
+func (db *DB) GetRawEntry(key []byte) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if !db.bloomFilter.Test(key) {
+		return nil, storage.ErrKeyNotFound
+	}
+	pos := db.index.Get(key)
+	if pos == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	dataFile := db.dataFileFor(pos.FileID)
+	if dataFile == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+
+	data, err := dataFile.Read(pos.Offset, pos.Size)
+	if err != nil {
+		return nil, fmt.Errorf("读取 Entry 失败: %w", err)
+	}
+	if _, err := decodeRaw(data); err != nil {
+		return nil, fmt.Errorf("读取 Entry 失败: %w", err)
+	}
+	return data, nil
+}
+
+// PutRawEntry 写入一个编码后的完整 Entry（通常来自另一个实例的 GetRawEntry）
+// 校验 CRC 与长度之后追加到活跃文件并更新索引；墓碑 Entry 删除 key。
+// 写入序号按本地写入顺序重新分配，其余字段保持原样
+// 参数：
+//   - encoded: 编码后的 Entry，长度必须正好是一个 Entry，调用方之后可以复用它
+//
+// 返回：
+//   - error: 长度或类型不符返回 ErrInvalidEntry，CRC 校验失败返回 ErrCRCMismatch，写入失败返回相应错误
+func (db *DB) PutRawEntry(encoded []byte) error {
+	entry, err := decodeRaw(append([]byte(nil), encoded...))
+	if err != nil {
+		return err
+	}
+	// 只接受数据文件中的 Entry 类型
+	if !entry.Type.inDataFile() {
+		return fmt.Errorf("%w: 不支持的 Entry 类型 %s", ErrInvalidEntry, entry.Type)
+	}
+	entry.Seq = 0
+
+	if err := db.lockForWrite(); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+
+	return db.applyEntry(entry)
+}
+
+// decodeRaw 解码并校验一个完整的 Entry，data 中不能有多余的字节
+func decodeRaw(data []byte) (*Entry, error) {
+	entry, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != int(entry.Size()) {
+		return nil, ErrInvalidEntry
+	}
+	return entry, nil
+}
@@ -0,0 +1,111 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+func TestDB_RawEntry(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := Open(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatalf("打开源数据库失败: %v", err)
+	}
+	defer src.Close()
+	dst, err := Open(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatalf("打开目标数据库失败: %v", err)
+	}
+	defer dst.Close()
+
+	// 目标库先有自己的写入，序号与源库不同
+	for _, key := range []string{"local-1", "local-2", "key"} {
+		if err := dst.Put([]byte(key), []byte("old")); err != nil {
+			t.Fatalf("写入目标数据库失败: %v", err)
+		}
+	}
+	if err := src.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("写入源数据库失败: %v", err)
+	}
+
+	raw, err := src.GetRawEntry([]byte("key"))
+	if err != nil {
+		t.Fatalf("读取原始 Entry 失败: %v", err)
+	}
+	srcMeta, err := src.EntryMeta([]byte("key"))
+	if err != nil {
+		t.Fatalf("读取源元数据失败: %v", err)
+	}
+	if len(raw) != int(srcMeta.Size) {
+		t.Fatalf("原始 Entry 的长度不匹配: %d != %d", len(raw), srcMeta.Size)
+	}
+
+	if err := dst.PutRawEntry(raw); err != nil {
+		t.Fatalf("写入原始 Entry 失败: %v", err)
+	}
+	val, err := dst.Get([]byte("key"))
+	if err != nil || string(val) != "value" {
+		t.Fatalf("目标数据库的值不匹配: %q, %v", val, err)
+	}
+	dstMeta, err := dst.EntryMeta([]byte("key"))
+	if err != nil {
+		t.Fatalf("读取目标元数据失败: %v", err)
+	}
+	if dstMeta.Timestamp != srcMeta.Timestamp {
+		t.Fatalf("时间戳不匹配: %d != %d", dstMeta.Timestamp, srcMeta.Timestamp)
+	}
+	// 序号按目标库的写入顺序分配
+	if dstMeta.Seq != 4 {
+		t.Fatalf("写入序号应由目标库分配: %d", dstMeta.Seq)
+	}
+	// 除 CRC 与序号之外的字节保持原样
+	copied, err := dst.GetRawEntry([]byte("key"))
+	if err != nil {
+		t.Fatalf("读取目标原始 Entry 失败: %v", err)
+	}
+	if !bytes.Equal(copied[20:], raw[20:]) || !bytes.Equal(copied[4:12], raw[4:12]) {
+		t.Fatalf("原始 Entry 的内容不匹配")
+	}
+
+	// 墓碑同样可以转发
+	if err := dst.PutRawEntry(NewTombstoneEntry([]byte("local-1")).Encode()); err != nil {
+		t.Fatalf("写入墓碑失败: %v", err)
+	}
+	if _, err := dst.Get([]byte("local-1")); err != storage.ErrKeyNotFound {
+		t.Fatalf("墓碑之后 key 应不存在: %v", err)
+	}
+	if _, err := src.GetRawEntry([]byte("missing")); err != storage.ErrKeyNotFound {
+		t.Fatalf("不存在的 key 应返回 ErrKeyNotFound: %v", err)
+	}
+
+	// 损坏、截断或带多余字节的 Entry 都被拒绝，不影响已有数据
+	corrupted := append([]byte(nil), raw...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	if err := dst.PutRawEntry(corrupted); !errors.Is(err, ErrCRCMismatch) {
+		t.Fatalf("CRC 不匹配应返回 ErrCRCMismatch: %v", err)
+	}
+	if err := dst.PutRawEntry(raw[:len(raw)-1]); !errors.Is(err, ErrInvalidEntry) {
+		t.Fatalf("截断的 Entry 应返回 ErrInvalidEntry: %v", err)
+	}
+	if err := dst.PutRawEntry(append(append([]byte(nil), raw...), 0)); !errors.Is(err, ErrInvalidEntry) {
+		t.Fatalf("多余的字节应返回 ErrInvalidEntry: %v", err)
+	}
+	intent := NewEntry([]byte("key"), []byte("intent"))
+	intent.Type = EntryTypeIntentCommit
+	if err := dst.PutRawEntry(intent.Encode()); !errors.Is(err, ErrInvalidEntry) {
+		t.Fatalf("意图日志的 Entry 应返回 ErrInvalidEntry: %v", err)
+	}
+	if val, err := dst.Get([]byte("key")); err != nil || string(val) != "value" {
+		t.Fatalf("拒绝写入后值不应改变: %q, %v", val, err)
+	}
+}
@@ -0,0 +1,160 @@
+package bitcask
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 启动引导冲突解决 ====================
+//
+// 默认情况下启动引导按文件 ID 与写入顺序重放记录，同一个 key 最后写入的版本胜出。
+// 多个副本各自写入、之后把数据文件汇总到一起的场景（例如离线合并两个目录）需要由应用决定保留哪个版本。
+// 配置 ConflictResolver 后，启动引导每遇到一个已在索引中存活的 key 的新版本，就调用它选出结果：
+//
+//   - 返回 candidate 或 nil：保留新版本，与默认行为相同
+//   - 返回 existing：保留已有版本
+//   - 返回其他 Entry：作为合并结果，Get 返回合并结果
+//
+// 合并结果只使用返回 Entry 的 Value。墓碑记录不经过解析函数，仍然删除 key 并丢弃之前的合并结果。
+// 解析函数需要按版本的先后依次比较，因此配置后启动引导总是按顺序扫描，不使用并行扫描与检查点。
+//
+// 合并结果与保留的已有版本在启动引导结束后以 EntryTypeResolved 追加到活跃文件，只写回一次：
+// 之后的启动引导遇到 EntryTypeResolved 时直接采用，丢弃与之前版本的比较结果，
+// 因此重复打开不会再次合并同一组版本，解析函数不需要是幂等的。之后写入的新版本仍会与它比较。
+// 写回的 Entry 保留胜出版本的写入序号（保留已有版本时为它的序号，合并结果为参与比较的最新版本的序号），
+// key 的版本号（见 PutIfVersion）不会因为写回而改变，各副本写回的结果一致。
+// 因此写回的 Entry 的序号可能小于之前的版本，并行启动引导按序号合并时，EntryTypeResolved 总是取代位于它之前的记录。
+
+// ConflictResolver 决定启动引导中同一个 key 的两个版本保留哪一个
+// 参数：
+//   - existing: 已在索引中的版本（或之前的合并结果）
+//   - candidate: 之后写入的版本
+//
+// 返回：
+//   - *Entry: 保留的版本，见上文
+type ConflictResolver func(existing, candidate *Entry) *Entry
+
+// WithConflictResolver 设置启动引导中重复 key 的冲突解决函数，nil 表示最后写入者胜出
+func WithConflictResolver(resolver ConflictResolver) Option {
+	return func(o *Options) {
+		o.ConflictResolver = resolver
+	}
+}
+
+// indexBootRecord 在启动引导过程中应用一条记录，配置了 ConflictResolver 时先解决与已有版本的冲突
+// 调用方必须按写入顺序调用
+func (db *DB) indexBootRecord(rec bootRecord) error {
+	if db.options.ConflictResolver == nil {
+		db.indexRecord(rec.Key, rec.Type, rec.Seq, rec.Pos)
+		return nil
+	}
+
+	// 墓碑与已经写回的解决结果都取代之前的全部版本
+	if rec.Type == EntryTypeTombstone || rec.Type == EntryTypeResolved {
+		delete(db.resolved, string(rec.Key))
+		db.indexRecord(rec.Key, rec.Type, rec.Seq, rec.Pos)
+		return nil
+	}
+
+	keep, err := db.resolveConflict(rec)
+	if err != nil {
+		return err
+	}
+	if keep {
+		// 保留已有版本，只推进写入序号
+		if rec.Seq > db.seq {
+			db.seq = rec.Seq
+		}
+		return nil
+	}
+	db.indexRecord(rec.Key, rec.Type, rec.Seq, rec.Pos)
+	return nil
+}
+
+// resolveConflict 对 key 已有的版本与新版本调用 ConflictResolver
+// 返回：
+//   - bool: 为 true 时保留索引中已有的位置，不应用新版本
+//   - error: 读取任一版本失败
+func (db *DB) resolveConflict(rec bootRecord) (bool, error) {
+	pos := db.index.Get(rec.Key)
+	if pos == nil {
+		return false, nil
+	}
+
+	existing := db.resolved[string(rec.Key)]
+	if existing == nil {
+		entry, err := db.readBootEntry(pos)
+		if err != nil {
+			return false, fmt.Errorf("读取 key %q 的已有版本失败: %w", rec.Key, err)
+		}
+		existing = entry
+	}
+	candidate, err := db.readBootEntry(rec.Pos)
+	if err != nil {
+		return false, fmt.Errorf("读取 key %q 的新版本失败: %w", rec.Key, err)
+	}
+
+	result := db.options.ConflictResolver(existing, candidate)
+	switch {
+	case result == nil || result == candidate:
+		delete(db.resolved, string(rec.Key))
+		return false, nil
+	case result == existing:
+		// 已有版本是之前的合并结果时，索引中仍是占位位置，合并结果照常写回；
+		// 否则记录下保留的版本，写回之后下次启动不再重新解析
+		if db.resolved == nil {
+			db.resolved = make(map[string]*Entry)
+		}
+		db.resolved[string(rec.Key)] = existing
+		return true, nil
+	default:
+		if db.resolved == nil {
+			db.resolved = make(map[string]*Entry)
+		}
+		// 合并结果只使用 Value，写入序号取参与比较的最新版本
+		merged := NewEntry(rec.Key, result.Value)
+		merged.Seq = candidate.Seq
+		db.resolved[string(rec.Key)] = merged
+		// 在写回之前，索引指向最新的版本作为占位
+		return false, nil
+	}
+}
+
+// readBootEntry 读取 pos 处的 Entry 并解压 Value
+func (db *DB) readBootEntry(pos *storage.Position) (*Entry, error) {
+	dataFile := db.dataFileFor(pos.FileID)
+	if dataFile == nil {
+		return nil, fmt.Errorf("数据文件 %d 不存在", pos.FileID)
+	}
+	entry, err := dataFile.ReadEntry(pos.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := entry.DecompressValue(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// writeResolved 将启动引导中得到的合并结果与保留的版本按 key 的字典序以 EntryTypeResolved 写入活跃文件
+// 保留胜出版本的写入序号；在启动引导结束、活跃文件就绪之后调用
+func (db *DB) writeResolved() error {
+	keys := make([]string, 0, len(db.resolved))
+	for key := range db.resolved {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		entry := NewEntry([]byte(key), db.resolved[key].Value)
+		entry.Type = EntryTypeResolved
+		entry.Seq = db.resolved[key].Seq
+		if err := db.applyEntry(entry); err != nil {
+			return fmt.Errorf("写回 key %q 的合并结果失败: %w", key, err)
+		}
+	}
+	db.resolved = nil
+	return nil
+}
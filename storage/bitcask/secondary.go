@@ -0,0 +1,183 @@
+package bitcask
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ==================== 二级索引 ====================
+//
+// 二级索引从 value 中提取索引 key（例如 JSON 中的某个字段），维护索引 key 到主 key 集合的映射，
+// 用于按字段查询。每个二级索引同时记录主 key 当前对应的索引 key，
+// 更新或删除时不需要读取旧 value 就能移除旧的映射。
+//
+// 二级索引只保存在内存中：通过 WithSecondaryIndex 注册的索引在打开时从数据重建，
+// 运行期间通过 AddSecondaryIndex 注册的索引在注册时扫描现有数据构建。
+// 提取函数在写锁内调用，必须是确定性的、快速的，并且不能访问 DB。
+
+// SecondaryExtractor 从键值对中提取二级索引 key
+// 返回：
+//   - indexKey: 索引 key
+//   - ok: 为 false 时该键值对不进入索引（例如 value 中没有该字段）
+type SecondaryExtractor func(key, value []byte) (indexKey []byte, ok bool)
+
+// secondaryIndex 一个二级索引
+type secondaryIndex struct {
+	extract SecondaryExtractor
+	primary map[string]map[string]struct{} // 索引 key → 主 key 集合
+	current map[string]string              // 主 key → 当前的索引 key
+}
+
+// WithSecondaryIndex 注册一个二级索引，打开数据库时从现有数据构建
+func WithSecondaryIndex(name string, extractor SecondaryExtractor) Option {
+	return func(o *Options) {
+		if o.SecondaryIndexes == nil {
+			o.SecondaryIndexes = make(map[string]SecondaryExtractor)
+		}
+		o.SecondaryIndexes[name] = extractor
+	}
+}
+
+// AddSecondaryIndex 注册一个二级索引并立即扫描现有数据构建，之后的写入与删除会同步维护它
+// 构建期间持有写锁
+// 参数：
+//   - name: 索引名称
+//   - extractor: 索引 key 的提取函数
+//
+// 返回：
+//   - error: 同名索引已存在时返回 ErrSecondaryIndexExists，读取现有数据失败时返回读取错误
+func (db *DB) AddSecondaryIndex(name string, extractor SecondaryExtractor) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.secondary[name]; ok {
+		return fmt.Errorf("%w: %s", ErrSecondaryIndexExists, name)
+	}
+	idx, err := db.buildSecondaryIndex(extractor)
+	if err != nil {
+		return fmt.Errorf("构建二级索引 %s 失败: %w", name, err)
+	}
+	if db.secondary == nil {
+		db.secondary = make(map[string]*secondaryIndex)
+	}
+	db.secondary[name] = idx
+	return nil
+}
+
+// QuerySecondary 查询二级索引中索引 key 对应的全部主 key，按字典序排列
+// 参数：
+//   - name: 索引名称
+//   - indexKey: 索引 key
+//
+// 返回：
+//   - [][]byte: 主 key，索引不存在或没有匹配时返回 nil
+func (db *DB) QuerySecondary(name string, indexKey []byte) [][]byte {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx, ok := db.secondary[name]
+	if !ok {
+		return nil
+	}
+	set := idx.primary[string(indexKey)]
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i] = []byte(key)
+	}
+	return result
+}
+
+// buildSecondaryIndexes 构建通过 WithSecondaryIndex 注册的全部二级索引
+// 调用方必须持有写锁（或在打开期间调用）
+func (db *DB) buildSecondaryIndexes() error {
+	for name, extractor := range db.options.SecondaryIndexes {
+		idx, err := db.buildSecondaryIndex(extractor)
+		if err != nil {
+			return fmt.Errorf("构建二级索引 %s 失败: %w", name, err)
+		}
+		if db.secondary == nil {
+			db.secondary = make(map[string]*secondaryIndex)
+		}
+		db.secondary[name] = idx
+	}
+	return nil
+}
+
+// buildSecondaryIndex 读取主索引中每个 key 的 value 构建二级索引
+// 调用方必须持有写锁
+func (db *DB) buildSecondaryIndex(extractor SecondaryExtractor) (*secondaryIndex, error) {
+	idx := &secondaryIndex{
+		extract: extractor,
+		primary: make(map[string]map[string]struct{}),
+		current: make(map[string]string),
+	}
+	for _, key := range db.indexKeys() {
+		pos, _ := db.peekIndex(key)
+		if pos == nil {
+			continue
+		}
+		value, err := db.readValue(pos)
+		if err != nil {
+			return nil, fmt.Errorf("读取 key %q 失败: %w", key, err)
+		}
+		idx.put(key, value)
+	}
+	return idx, nil
+}
+
+// secondaryPut 在所有二级索引中更新 key 的映射
+// 调用方必须持有写锁
+func (db *DB) secondaryPut(key, value []byte) {
+	for _, idx := range db.secondary {
+		idx.put(key, value)
+	}
+}
+
+// secondaryDelete 从所有二级索引中移除 key
+// 调用方必须持有写锁
+func (db *DB) secondaryDelete(key []byte) {
+	for _, idx := range db.secondary {
+		idx.remove(string(key))
+	}
+}
+
+// put 移除 key 旧的映射，再按新的 value 建立映射
+func (idx *secondaryIndex) put(key, value []byte) {
+	primaryKey := string(key)
+	idx.remove(primaryKey)
+
+	indexKey, ok := idx.extract(key, value)
+	if !ok {
+		return
+	}
+	set := idx.primary[string(indexKey)]
+	if set == nil {
+		set = make(map[string]struct{})
+		idx.primary[string(indexKey)] = set
+	}
+	set[primaryKey] = struct{}{}
+	idx.current[primaryKey] = string(indexKey)
+}
+
+// remove 移除 key 当前的映射
+func (idx *secondaryIndex) remove(primaryKey string) {
+	indexKey, ok := idx.current[primaryKey]
+	if !ok {
+		return
+	}
+	delete(idx.current, primaryKey)
+	set := idx.primary[indexKey]
+	delete(set, primaryKey)
+	if len(set) == 0 {
+		delete(idx.primary, indexKey)
+	}
+}
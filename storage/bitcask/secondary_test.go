@@ -0,0 +1,94 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// cityOf 提取 JSON value 中的 city 字段作为二级索引 key
+func cityOf(key, value []byte) ([]byte, bool) {
+	var user struct {
+		City string `json:"city"`
+	}
+	if err := json.Unmarshal(value, &user); err != nil || user.City == "" {
+		return nil, false
+	}
+	return []byte(user.City), true
+}
+
+func TestDB_SecondaryIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	put := func(key, city string) {
+		t.Helper()
+		value := fmt.Sprintf(`{"name":%q,"city":%q}`, key, city)
+		if err := db.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("Put 失败: %v", err)
+		}
+	}
+	expect := func(city string, want ...string) {
+		t.Helper()
+		got := db.QuerySecondary("city", []byte(city))
+		if len(got) != len(want) {
+			t.Fatalf("%s 的查询结果不匹配: got %q, want %q", city, got, want)
+		}
+		for i := range want {
+			if string(got[i]) != want[i] {
+				t.Fatalf("%s 的查询结果不匹配: got %q, want %q", city, got, want)
+			}
+		}
+	}
+
+	// 注册前已有的数据在注册时被索引
+	put("user/1", "paris")
+	put("user/2", "tokyo")
+	db.Put([]byte("config"), []byte("not json"))
+	if err := db.AddSecondaryIndex("city", cityOf); err != nil {
+		t.Fatalf("注册二级索引失败: %v", err)
+	}
+	if err := db.AddSecondaryIndex("city", cityOf); !errors.Is(err, ErrSecondaryIndexExists) {
+		t.Fatalf("重复注册应返回 ErrSecondaryIndexExists: %v", err)
+	}
+	expect("paris", "user/1")
+
+	// 注册后的写入、修改索引字段与删除
+	put("user/3", "paris")
+	expect("paris", "user/1", "user/3")
+	put("user/1", "tokyo")
+	expect("paris", "user/3")
+	expect("tokyo", "user/1", "user/2")
+	db.Delete([]byte("user/3"))
+	expect("paris")
+	db.Put([]byte("user/2"), []byte(`{"name":"user/2"}`))
+	expect("tokyo", "user/1")
+	if err := db.PutAll([]KV{{Key: []byte("user/4"), Value: []byte(`{"city":"lima"}`)}}); err != nil {
+		t.Fatalf("PutAll 失败: %v", err)
+	}
+	expect("lima", "user/4")
+	if got := db.QuerySecondary("missing", []byte("tokyo")); got != nil {
+		t.Fatalf("不存在的索引应返回 nil: %q", got)
+	}
+	db.Close()
+
+	// 通过 WithSecondaryIndex 注册的索引在打开时重建
+	db, err = Open(dir, WithSecondaryIndex("city", cityOf))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	expect("tokyo", "user/1")
+	expect("lima", "user/4")
+	expect("paris")
+}
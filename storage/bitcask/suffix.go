@@ -0,0 +1,79 @@
+package bitcask
+
+import (
+	"bytes"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 后缀索引 ====================
+//
+// 后缀索引是一个以反转后的 key 为键的 ART，key 的后缀对应反转 key 的前缀，
+// 因此后缀匹配可以转换为有序的前缀扫描。后缀索引只记录 key 是否存在，
+// 位置总是从主索引读取，Merge 移动数据时无需更新后缀索引。
+
+// suffixPresent 后缀索引中所有 key 共用的占位位置
+var suffixPresent = &storage.Position{}
+
+// ScanSuffix 遍历所有以 suffix 结尾的 key
+// 需要通过 WithSuffixIndex(true) 启用后缀索引；遍历期间持有读锁，看到的是某一时刻的一致视图。
+// 遍历顺序为反转后 key 的字典序；fn 返回 false 时停止遍历
+//
+// 参数：
+//   - suffix: 后缀
+//   - fn: 回调函数
+//
+// 返回：
+//   - error: 读取错误；未启用后缀索引时返回 ErrSuffixIndexDisabled
+func (db *DB) ScanSuffix(suffix []byte, fn func(key, value []byte) bool) error {
+	if db.suffixIndex == nil {
+		return ErrSuffixIndexDisabled
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	reversed := reverseKey(suffix)
+	iter := db.suffixIndex.Seek(reversed)
+	defer iter.Close()
+
+	for rkey := iter.Key(); rkey != nil && bytes.HasPrefix(rkey, reversed); rkey = iter.Key() {
+		key := reverseKey(rkey)
+		if pos, _ := db.peekIndex(key); pos != nil {
+			value, err := db.readValue(pos)
+			if err != nil {
+				return err
+			}
+			if !fn(key, value) {
+				return nil
+			}
+		}
+		iter.Next()
+	}
+	return nil
+}
+
+// suffixAdd 将 key 加入后缀索引（未启用时不做任何事）
+// 调用方必须持有写锁
+func (db *DB) suffixAdd(key []byte) {
+	if db.suffixIndex != nil {
+		db.suffixIndex.Put(reverseKey(key), suffixPresent)
+	}
+}
+
+// suffixDelete 将 key 从后缀索引中删除（未启用时不做任何事）
+// 调用方必须持有写锁
+func (db *DB) suffixDelete(key []byte) {
+	if db.suffixIndex != nil {
+		db.suffixIndex.Delete(reverseKey(key))
+	}
+}
+
+// reverseKey 返回按字节反转后的 key 副本
+func reverseKey(key []byte) []byte {
+	reversed := make([]byte, len(key))
+	for i, b := range key {
+		reversed[len(key)-1-i] = b
+	}
+	return reversed
+}
@@ -0,0 +1,120 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scanSuffixKeys 返回 ScanSuffix 遍历到的全部 key（排序后），并校验 value
+func scanSuffixKeys(t *testing.T, db *DB, suffix string) []string {
+	var keys []string
+	err := db.ScanSuffix([]byte(suffix), func(key, value []byte) bool {
+		if want := "v:" + string(key); string(value) != want {
+			t.Errorf("%s 值不匹配: got %s, want %s", key, value, want)
+		}
+		keys = append(keys, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ScanSuffix 失败: %v", err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDB_ScanSuffix(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask_test")
+			if err != nil {
+				t.Fatalf("创建临时目录失败: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			opts := []Option{WithSuffixIndex(true), WithDataFileSizeLimit(256), WithBootstrapWorkers(workers)}
+			db, err := Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+
+			put := func(key string) {
+				if err := db.Put([]byte(key), []byte("v:"+key)); err != nil {
+					t.Fatalf("Put 失败: %v", err)
+				}
+			}
+			for _, user := range []string{"alice", "bob", "carol"} {
+				put("user/" + user + "@tenant-a")
+				put("user/" + user + "@tenant-b")
+			}
+			put("tenant-a")
+			put("order/1@tenant-a")
+
+			want := []string{"order/1@tenant-a", "user/alice@tenant-a", "user/bob@tenant-a", "user/carol@tenant-a"}
+			if got := scanSuffixKeys(t, db, "@tenant-a"); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("后缀扫描结果不匹配:\n got  %v\n want %v", got, want)
+			}
+
+			// 删除后的 key 不再出现在后缀索引中
+			db.Delete([]byte("user/bob@tenant-a"))
+			if db.suffixIndex.Get(reverseKey([]byte("user/bob@tenant-a"))) != nil {
+				t.Fatalf("删除的 key 应从后缀索引中移除")
+			}
+			want = []string{"order/1@tenant-a", "user/alice@tenant-a", "user/carol@tenant-a"}
+			if got := scanSuffixKeys(t, db, "@tenant-a"); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("删除后结果不匹配:\n got  %v\n want %v", got, want)
+			}
+
+			// 提前停止
+			count := 0
+			db.ScanSuffix([]byte("@tenant-b"), func(key, value []byte) bool {
+				count++
+				return false
+			})
+			if count != 1 {
+				t.Errorf("fn 返回 false 后应停止遍历: 遍历了 %d 个", count)
+			}
+
+			// Merge 移动数据后仍能读取到最新的 value
+			if err := db.Merge(); err != nil {
+				t.Fatalf("Merge 失败: %v", err)
+			}
+			db.Close()
+
+			// 重启后从数据文件重建后缀索引
+			db, err = Open(dir, opts...)
+			if err != nil {
+				t.Fatalf("重新打开数据库失败: %v", err)
+			}
+			defer db.Close()
+			if got := scanSuffixKeys(t, db, "@tenant-a"); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("重启后结果不匹配:\n got  %v\n want %v", got, want)
+			}
+			if got := scanSuffixKeys(t, db, "missing"); len(got) != 0 {
+				t.Errorf("不存在的后缀应返回空结果: %v", got)
+			}
+		})
+	}
+}
+
+func TestDB_ScanSuffixDisabled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	err = db.ScanSuffix([]byte("x"), func(key, value []byte) bool { return true })
+	if !errors.Is(err, ErrSuffixIndexDisabled) {
+		t.Errorf("未启用后缀索引时应返回 ErrSuffixIndexDisabled, 得到: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package bitcask
+
+import (
+	"sync"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// ==================== 写缓冲 ====================
+//
+// 默认每次写入都直接写入活跃文件（一次系统调用）。配置 WriteBufferSize 后，写入先追加到活跃文件的
+// 内存缓冲区，缓冲的数据达到该大小、调用 Sync、轮转或关闭时才一次性写入文件，减少小 Entry 的系统调用。
+// 代价是缓冲区中的数据在进程崩溃时丢失，需要持久化保证的写入之后应调用 Sync。
+//
+// 读取必须看到刚写入、尚未写入文件的数据：DataFile 的读取会从缓冲区补齐尚未写入文件的部分，
+// 另外 DB 在 recentWrites 中保存缓冲区内每个 key 的最新 value，Get 命中时直接返回，
+// 不需要从缓冲区解码 Entry；缓冲区写入文件之后对应的记录随之清除。
+// Key-Log 直接写入文件，会领先于缓冲的数据文件，因此不能与写缓冲同时启用。
+
+// WithWriteBufferSize 设置活跃文件写缓冲的大小（字节），0 表示不缓冲（默认）
+func WithWriteBufferSize(n int) Option {
+	return func(o *Options) {
+		o.WriteBufferSize = n
+	}
+}
+
+// recentWrites 写缓冲中尚未写入文件的 key 的最新 value
+type recentWrites struct {
+	mu     sync.Mutex
+	values map[string]recentWrite
+}
+
+// recentWrite 一个尚未写入文件的写入
+type recentWrite struct {
+	pos   storage.Position
+	value []byte
+}
+
+// newRecentWrites 创建空的 recentWrites
+func newRecentWrites() *recentWrites {
+	return &recentWrites{values: make(map[string]recentWrite)}
+}
+
+// put 记录 key 写入 pos 处的 value，保存的是副本
+func (r *recentWrites) put(key []byte, pos *storage.Position, value []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[string(key)] = recentWrite{pos: *pos, value: append([]byte(nil), value...)}
+}
+
+// remove 删除 key 的记录
+func (r *recentWrites) remove(key []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, string(key))
+}
+
+// get 返回 key 在 pos 处写入的 value 的副本，记录不存在或位置不同（已被 Merge 移动）时返回 false
+func (r *recentWrites) get(key []byte, pos *storage.Position) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.values[string(key)]
+	if !ok || w.pos.FileID != pos.FileID || w.pos.Offset != pos.Offset {
+		return nil, false
+	}
+	return append([]byte(nil), w.value...), true
+}
+
+// dropFile 清除 fileID 中的记录，在该文件的缓冲区写入文件之后调用
+func (r *recentWrites) dropFile(fileID uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, w := range r.values {
+		if w.pos.FileID == fileID {
+			delete(r.values, key)
+		}
+	}
+}
+
+// len 返回记录的数量
+func (r *recentWrites) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.values)
+}
+
+// trackRecentWrite 写入之后更新 recentWrites，只记录仍在写缓冲中的写入
+// 调用方必须持有写锁
+func (db *DB) trackRecentWrite(entry *Entry, pos *storage.Position) {
+	if db.recent == nil {
+		return
+	}
+	if entry.IsTombstone() {
+		db.recent.remove(entry.Key)
+		return
+	}
+	if db.dataFileFor(pos.FileID).isPending(pos.Offset) {
+		db.recent.put(entry.Key, pos, entry.Value)
+	} else {
+		db.recent.remove(entry.Key)
+	}
+}
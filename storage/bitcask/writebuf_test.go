@@ -0,0 +1,170 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDB_WriteBuffer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithWriteBufferSize(4096))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	// fileSize 返回活跃文件在文件系统中的大小
+	fileSize := func() int64 {
+		info, err := db.options.FileSystem.Stat(db.activeFile.GetFilePath(dir))
+		if err != nil {
+			t.Fatalf("获取文件状态失败: %v", err)
+		}
+		return info.Size()
+	}
+
+	// 写入之后还在缓冲区中，Get 与其他读取路径都能看到
+	if err := db.Put([]byte("k1"), []byte("v1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if size := fileSize(); size != 0 {
+		t.Fatalf("缓冲区未满时不应写入文件: size=%d", size)
+	}
+	if got, err := db.Get([]byte("k1")); err != nil || string(got) != "v1" {
+		t.Fatalf("应读到缓冲区中的值: %q, %v", got, err)
+	}
+	if db.recent.len() != 1 {
+		t.Fatalf("缓冲区中的写入应记录在 recentWrites 中: %d", db.recent.len())
+	}
+	if meta, err := db.EntryMeta([]byte("k1")); err != nil || meta.Offset != 0 {
+		t.Fatalf("EntryMeta 应读到缓冲区中的 Entry: %+v, %v", meta, err)
+	}
+	if safe := db.activeFile.SafeReadOffset(); safe != 0 {
+		t.Fatalf("缓冲区中的数据不应计入安全读取偏移量: %d", safe)
+	}
+
+	db.Put([]byte("k1"), []byte("v2"))
+	db.Put([]byte("k2"), []byte("v3"))
+	db.Delete([]byte("k2"))
+	if got, _ := db.Get([]byte("k1")); string(got) != "v2" {
+		t.Fatalf("应读到最新的值: %q", got)
+	}
+	if _, err := db.Get([]byte("k2")); err == nil {
+		t.Fatalf("删除的 key 不应存在")
+	}
+	var scanned int
+	db.ScanPrefix([]byte("k"), func(key, value []byte) bool {
+		scanned++
+		return true
+	})
+	if scanned != 1 {
+		t.Fatalf("遍历应读到缓冲区中的数据: %d", scanned)
+	}
+
+	// Sync 将缓冲区写入文件并清除记录
+	if err := db.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if size := fileSize(); size != db.activeFile.GetWriteOff() || size == 0 {
+		t.Fatalf("同步后缓冲区应写入文件: size=%d, writeOff=%d", size, db.activeFile.GetWriteOff())
+	}
+	if db.recent.len() != 0 {
+		t.Fatalf("写入文件之后应清除记录: %d", db.recent.len())
+	}
+	if got, _ := db.Get([]byte("k1")); string(got) != "v2" {
+		t.Fatalf("写入文件之后应从文件读取: %q", got)
+	}
+
+	// 缓冲的数据达到上限时自动写入文件
+	value := make([]byte, 1024)
+	for i := 0; i < 8; i++ {
+		db.Put([]byte(fmt.Sprintf("big-%d", i)), value)
+	}
+	if size := fileSize(); size <= 4096 {
+		t.Fatalf("缓冲区满时应写入文件: size=%d", size)
+	}
+
+	// 关闭时写入缓冲区，重新打开后数据完整
+	db.Put([]byte("last"), []byte("tail"))
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	db, err = Open(dir, WithWriteBufferSize(4096))
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for key, want := range map[string]string{"k1": "v2", "last": "tail"} {
+		if got, err := db.Get([]byte(key)); err != nil || string(got) != want {
+			t.Fatalf("重新打开后 %s 不匹配: %q, %v", key, got, err)
+		}
+	}
+
+	if _, err := Open(dir+"-keylog", WithWriteBufferSize(4096), WithKeyLog(true)); !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("写缓冲与 Key-Log 同时启用应返回 ErrInvalidOptions: %v", err)
+	}
+}
+
+func TestDB_WriteBufferReadAfterWrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir, WithWriteBufferSize(1<<20))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 多个写入者各自写入后立即读取，同时有读者遍历与后台同步，缓冲区在此期间不断写入文件
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	stop := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := []byte(fmt.Sprintf("w%d-%d", w, i))
+				want := fmt.Sprintf("value-%d-%d", w, i)
+				if err := db.Put(key, []byte(want)); err != nil {
+					errs <- err
+					return
+				}
+				got, err := db.Get(key)
+				if err != nil || string(got) != want {
+					errs <- fmt.Errorf("写入后立即读取 %s 不匹配: %q, %v", key, got, err)
+					return
+				}
+			}
+		}(w)
+	}
+	var bg sync.WaitGroup
+	bg.Add(1)
+	go func() {
+		defer bg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			db.Sync()
+			db.ScanPrefix([]byte("w"), func(key, value []byte) bool { return true })
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	bg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,18 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // ErrKeyNotFound 表示键不存在的错误
 var ErrKeyNotFound = errors.New("key not found")
 
+// ErrNotSupported 表示存储引擎不支持该操作
+var ErrNotSupported = errors.New("operation not supported")
+
 // Position 表示数据在文件中的位置
 type Position struct {
 	FileID uint32 // 数据文件 ID
@@ -12,6 +20,277 @@ type Position struct {
 	Size   uint32 // 数据大小
 }
 
+// KV 表示一个键值对
+type KV struct {
+	Key   []byte
+	Value []byte
+
+	// 版本号，见 VersionedStore；0 表示由存储引擎分配
+	Version uint64
+}
+
+// EntryMeta 描述单个 Entry 在磁盘与索引中的元数据，用于诊断
+type EntryMeta struct {
+	FileID    uint32 // 所在数据文件 ID
+	Offset    int64  // 在数据文件中的偏移量
+	Size      uint32 // Entry 总大小（头部 + Key + Value）
+	Timestamp int64  // 写入时间戳（纳秒）
+	Seq       uint64 // 写入序号
+	CRC       uint32 // CRC32 校验和
+	Type      string // Entry 类型：normal / tombstone
+	Tier      string // 所在索引层（仅混合索引）：hot / warm / cold，其他索引为空
+}
+
+// EntryInspector 是可选的诊断接口，支持查询单个 Entry 的元数据
+type EntryInspector interface {
+	// EntryMeta 查询 key 当前对应 Entry 的元数据
+	// 参数：
+	//   - key: 键
+	// 返回：
+	//   - *EntryMeta: 元数据
+	//   - error: 查询错误，如果键不存在返回 ErrKeyNotFound
+	EntryMeta(key []byte) (*EntryMeta, error)
+}
+
+// MemoryStats 存储引擎内存占用的估算值（字节），用于容量规划
+type MemoryStats struct {
+	Index  int64 // 主索引
+	Bloom  int64 // 布隆过滤器
+	Suffix int64 // 后缀索引，未启用时为 0
+
+	// 混合索引各层，其他索引为 0；三者之和即 Index
+	HotTier  int64
+	WarmTier int64
+	ColdTier int64
+
+	Total int64 // 以上各项之和（各层已包含在 Index 中，不重复计入）
+}
+
+// MemoryReporter 是可选的诊断接口，支持估算内存占用
+type MemoryReporter interface {
+	// MemoryStats 估算索引与布隆过滤器占用的内存
+	// 返回：
+	//   - *MemoryStats: 内存占用估算值
+	//   - error: 查询错误
+	MemoryStats() (*MemoryStats, error)
+}
+
+// BucketStat 键空间中一个区间内的 key 分布
+// 区间按 key 的首字节划分，空 key 计入第一个区间
+type BucketStat struct {
+	Low      byte  // 区间内 key 首字节的最小值
+	High     byte  // 区间内 key 首字节的最大值（含）
+	Keys     int64 // key 数量
+	KeyBytes int64 // key 总长度（字节）
+}
+
+// KeyDistribution 索引中 key 在键空间上的分布，用于发现倾斜与规划分片
+type KeyDistribution struct {
+	Buckets []BucketStat // 全部 key
+
+	// 混合索引各层，其他索引为 nil；冷层包含全部 key
+	HotTier  []BucketStat
+	WarmTier []BucketStat
+	ColdTier []BucketStat
+}
+
+// KeyDistributionReporter 是可选的诊断接口，支持统计 key 的分布
+type KeyDistributionReporter interface {
+	// KeyDistribution 将键空间按首字节均分为 buckets 个区间并统计每个区间的 key
+	// 参数：
+	//   - buckets: 区间数量，限制在 [1, 256] 之内
+	// 返回：
+	//   - *KeyDistribution: key 分布
+	//   - error: 查询错误
+	KeyDistribution(buckets int) (*KeyDistribution, error)
+}
+
+// KeyCount 存储引擎中 key 的数量
+type KeyCount struct {
+	Estimate uint64 // 估算的不同 key 数量，开销固定，不需要遍历 key
+	Exact    int64  // 精确数量，无法廉价得到时为 -1
+}
+
+// KeyCounter 是可选的诊断接口，支持统计 key 的数量
+type KeyCounter interface {
+	// KeyCount 统计 key 的数量
+	// 返回：
+	//   - *KeyCount: key 数量
+	//   - error: 查询错误
+	KeyCount() (*KeyCount, error)
+}
+
+// AccessTimeReporter 是可选的接口，支持查询 key 最近一次被访问的时间，供外部缓存分层使用
+type AccessTimeReporter interface {
+	// LastAccess 查询 key 最近一次被访问（读取或写入）的时间
+	// 参数：
+	//   - key: 键
+	// 返回：
+	//   - time.Time: 最近访问时间
+	//   - bool: 键不存在或引擎无法报告时为 false
+	LastAccess(key []byte) (time.Time, bool)
+}
+
+// PrefixMapReader 是可选的接口，支持一次性读取某个前缀下的全部键值对
+type PrefixMapReader interface {
+	// GetPrefixAsMap 读取 prefix 下的全部键值对
+	// 参数：
+	//   - prefix: 前缀，空前缀表示全部 key
+	// 返回：
+	//   - map[string][]byte: 完整 key 到 value 的映射，没有匹配时返回空 map
+	//   - error: 读取错误
+	GetPrefixAsMap(prefix []byte) (map[string][]byte, error)
+}
+
+// VersionedWriter 是可选的接口，支持基于版本号的条件写入（乐观并发控制）
+// 单机引擎的版本号是 key 当前 Entry 的写入序号；Raft 集群中是最后一次写入该 key 的日志索引，见 VersionedStore
+type VersionedWriter interface {
+	// PutIfVersion 仅当 key 当前的版本号等于 expectedSeq 时写入
+	// expectedSeq 为 0 表示仅当 key 不存在时写入
+	// 参数：
+	//   - key: 键
+	//   - value: 值
+	//   - expectedSeq: 期望的当前版本号
+	// 返回：
+	//   - uint64: 写入成功时为新的版本号，否则为 key 当前的版本号（不存在为 0）
+	//   - bool: 是否写入
+	//   - error: 写入错误
+	PutIfVersion(key []byte, value []byte, expectedSeq uint64) (uint64, bool, error)
+}
+
+// VersionedStore 是可选的接口，供复制状态机以调用方分配的版本号写入
+// 版本号与 Entry 一起持久化，并作为 VersionedWriter 比较的版本。Raft 状态机以日志索引作为版本号，
+// 同一条日志在每个副本上、重启后重放时以及经快照恢复后都得到相同的版本号
+type VersionedStore interface {
+	// PutAt 以指定的版本号写入键值对
+	// 参数：
+	//   - key: 键
+	//   - value: 值
+	//   - version: 版本号
+	// 返回：
+	//   - error: 写入错误
+	PutAt(key []byte, value []byte, version uint64) error
+
+	// DeleteAt 以指定的版本号删除 key 并返回删除前的值
+	// 参数：
+	//   - key: 键
+	//   - version: 版本号
+	// 返回：
+	//   - []byte: 删除前的值
+	//   - error: 删除错误，如果键不存在返回 ErrKeyNotFound
+	DeleteAt(key []byte, version uint64) ([]byte, error)
+
+	// PutIfVersionAt 仅当 key 当前的版本号等于 expected 时以 version 写入
+	// 参数：
+	//   - key: 键
+	//   - value: 值
+	//   - expected: 期望的当前版本号，0 表示仅当 key 不存在时写入
+	//   - version: 写入使用的版本号
+	// 返回：
+	//   - uint64: 写入成功时为 version，否则为 key 当前的版本号（不存在为 0）
+	//   - bool: 是否写入
+	//   - error: 写入错误
+	PutIfVersionAt(key []byte, value []byte, expected uint64, version uint64) (uint64, bool, error)
+
+	// ReplacePrefixAt 以指定的版本号原子地替换 prefix 下的全部键值对
+	// 参数：
+	//   - prefix: 前缀
+	//   - kvs: 新的键值对，必须都在 prefix 下
+	//   - version: 版本号
+	// 返回：
+	//   - error: 替换错误
+	ReplacePrefixAt(prefix []byte, kvs []KV, version uint64) error
+
+	// GetPrefixVersioned 读取 prefix 下的全部键值对及其版本号，按 key 升序
+	// 参数：
+	//   - prefix: 前缀，空前缀表示全部 key
+	// 返回：
+	//   - []KV: 键值对，Version 为各 key 当前的版本号
+	//   - error: 读取错误
+	GetPrefixVersioned(prefix []byte) ([]KV, error)
+}
+
+// DeleteReturner 是可选的接口，支持删除时原子地返回被删除的值
+type DeleteReturner interface {
+	// DeleteReturning 删除 key 并返回删除前的值
+	// 参数：
+	//   - key: 键
+	// 返回：
+	//   - []byte: 删除前的值
+	//   - error: 删除错误，如果键不存在返回 ErrKeyNotFound
+	DeleteReturning(key []byte) ([]byte, error)
+}
+
+// BulkWriter 是可选的接口，支持高效的批量写入
+type BulkWriter interface {
+	// PutAll 批量写入键值对，同一个 key 出现多次时后者覆盖前者
+	// 支持 VersionedStore 的引擎以 KV.Version 作为版本号写入，为 0 时由引擎分配
+	// 参数：
+	//   - pairs: 键值对
+	// 返回：
+	//   - error: 写入错误
+	PutAll(pairs []KV) error
+}
+
+// Syncer 是可选的接口，支持将已写入的数据强制同步到磁盘
+type Syncer interface {
+	// Sync 将已写入的数据同步到磁盘
+	// 返回：
+	//   - error: 同步错误
+	Sync() error
+}
+
+// Appender 是可选的接口，支持由服务端分配 key 的追加写入
+type Appender interface {
+	// Append 以专用计数器的下一个值作为 key 写入 value，key 连续递增
+	// 参数：
+	//   - value: 值
+	// 返回：
+	//   - []byte: 分配的 key，格式见 AppendKey
+	//   - error: 写入错误
+	Append(value []byte) ([]byte, error)
+}
+
+// AppendCounter 是可选的接口，供复制状态机驱动存储引擎的追加写入计数器
+// 状态机从快照恢复时设置计数器、在快照中保存计数器，保证每个副本为同一条日志分配相同的 key
+type AppendCounter interface {
+	Appender
+
+	// AppendAt 与 Append 相同，并以指定的版本号写入，见 VersionedStore
+	// 参数：
+	//   - value: 值
+	//   - version: 版本号
+	// 返回：
+	//   - []byte: 分配的 key
+	//   - error: 写入错误
+	AppendAt(value []byte, version uint64) ([]byte, error)
+
+	// AppendSeq 返回计数器的当前值，即最近一次分配的序号
+	AppendSeq() uint64
+
+	// SetAppendSeq 设置计数器，下一次追加写入分配 seq+1
+	SetAppendSeq(seq uint64)
+}
+
+// AppendKey 返回序号对应的追加写入 key：20 位零填充的十进制数，字典序与数值序一致
+func AppendKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", seq))
+}
+
+// ParseAppendKey 解析 AppendKey 生成的 key，返回对应的序号；key 不是该格式时返回 false
+func ParseAppendKey(key []byte) (uint64, bool) {
+	if len(key) != 20 {
+		return 0, false
+	}
+	for _, c := range key {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	seq, err := strconv.ParseUint(string(key), 10, 64)
+	return seq, err == nil
+}
+
 // Iterator 是键值迭代器的抽象接口
 // 用于范围查询和有序遍历
 type Iterator interface {
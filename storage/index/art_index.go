@@ -7,7 +7,8 @@ import (
 
 // ARTIndex 是基于自适应基数树（Adaptive Radix Tree）的内存索引实现
 type ARTIndex struct {
-	tree art.Tree
+	tree     art.Tree
+	keyBytes int64 // 所有 key 的总长度，用于内存估算
 }
 
 // NewARTIndex 创建一个新的 ART 索引实例
@@ -24,7 +25,9 @@ func NewARTIndex() *ARTIndex {
 //   - key: 键
 //   - pos: 位置指针
 func (idx *ARTIndex) Put(key []byte, pos *storage.Position) {
-	idx.tree.Insert(art.Key(key), pos)
+	if _, updated := idx.tree.Insert(art.Key(key), pos); !updated {
+		idx.keyBytes += int64(len(key))
+	}
 }
 
 // Get 根据键从 ART 索引获取位置
@@ -47,6 +50,9 @@ func (idx *ARTIndex) Get(key []byte) *storage.Position {
 //   - bool: 是否删除成功
 func (idx *ARTIndex) Delete(key []byte) bool {
 	_, deleted := idx.tree.Delete(art.Key(key))
+	if deleted {
+		idx.keyBytes -= int64(len(key))
+	}
 	return deleted
 }
 
@@ -57,6 +63,11 @@ func (idx *ARTIndex) Size() int {
 	return idx.tree.Size()
 }
 
+// EstimatedMemory 估算 ART 索引占用的内存字节数
+func (idx *ARTIndex) EstimatedMemory() int64 {
+	return int64(idx.tree.Size())*(artEntryOverhead+positionSize) + idx.keyBytes
+}
+
 // Seek 查找第一个大于等于 key 的键，返回迭代器
 func (idx *ARTIndex) Seek(key []byte) IndexIterator {
 	iterator := idx.tree.Iterator()
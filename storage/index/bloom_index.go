@@ -1,33 +1,76 @@
 package index
 
 import (
+	"encoding/binary"
 	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/cespare/xxhash/v2"
 	"sync"
 )
 
 // BloomFilter 是布隆过滤器的并发安全包装类
 // 用于快速判断一个 key 是否可能存在于索引中
 type BloomFilter struct {
-	filter *bloom.BloomFilter
-	mu     sync.RWMutex
+	filter  *bloom.BloomFilter
+	keyHash BloomKeyHash // 为 nil 时 key 原样进入过滤器
+	mu      sync.RWMutex
+}
+
+// BloomKeyHash 在 key 进入布隆过滤器之前将其预先哈希为 64 位
+// 共享长前缀的 key 只在末尾几个字节不同，预先对完整的 key 做一次充分混合的哈希，
+// 可以让这类 key 在过滤器中分布得更均匀
+type BloomKeyHash func(key []byte) uint64
+
+// XXHashBloomKey 使用 xxhash 预先哈希 key
+func XXHashBloomKey(key []byte) uint64 {
+	return xxhash.Sum64(key)
+}
+
+// BloomOption 定义布隆过滤器的配置函数
+type BloomOption func(*BloomFilter)
+
+// WithBloomKeyHash 设置 key 的预哈希函数
+// Add、Test 以及重建过滤器都经过同一个预哈希，持久化的过滤器只能由使用相同预哈希的过滤器加载
+func WithBloomKeyHash(hash BloomKeyHash) BloomOption {
+	return func(bf *BloomFilter) {
+		bf.keyHash = hash
+	}
 }
 
 // NewBloomFilter 创建一个新的布隆过滤器
 // 参数：
 //   - n: 预期存储的元素数量
 //   - fp: 期望的误判率
+//   - opts: 配置选项，例如 WithBloomKeyHash
 //
 // 返回：
 //   - *BloomFilter: 布隆过滤器指针
-func NewBloomFilter(n uint, fp float64) *BloomFilter {
+func NewBloomFilter(n uint, fp float64, opts ...BloomOption) *BloomFilter {
 	// 使用 NewWithEstimates 自动计算最优的 m 和 k
-	return &BloomFilter{
+	bf := &BloomFilter{
 		filter: bloom.NewWithEstimates(n, fp),
 	}
+	for _, opt := range opts {
+		opt(bf)
+	}
+	return bf
+}
+
+// PreHashed 返回是否设置了 key 的预哈希函数
+func (bf *BloomFilter) PreHashed() bool {
+	return bf.keyHash != nil
+}
+
+// filterKey 返回 key 进入过滤器的形式：设置了预哈希时为写入 buf 的 8 字节哈希值，否则为 key 本身
+func (bf *BloomFilter) filterKey(key []byte, buf *[8]byte) []byte {
+	if bf.keyHash == nil {
+		return key
+	}
+	binary.LittleEndian.PutUint64(buf[:], bf.keyHash(key))
+	return buf[:]
 }
 
 // Add 添加一个 key 到布隆过滤器
@@ -36,7 +79,8 @@ func NewBloomFilter(n uint, fp float64) *BloomFilter {
 func (bf *BloomFilter) Add(key []byte) {
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
-	bf.filter.Add(key)
+	var buf [8]byte
+	bf.filter.Add(bf.filterKey(key, &buf))
 }
 
 // Test 测试一个 key 是否可能存在于布隆过滤器中
@@ -48,7 +92,8 @@ func (bf *BloomFilter) Add(key []byte) {
 func (bf *BloomFilter) Test(key []byte) bool {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
-	return bf.filter.Test(key)
+	var buf [8]byte
+	return bf.filter.Test(bf.filterKey(key, &buf))
 }
 
 // AddAndTest 添加 key 并返回添加后的测试结果
@@ -60,8 +105,10 @@ func (bf *BloomFilter) Test(key []byte) bool {
 func (bf *BloomFilter) AddAndTest(key []byte) bool {
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
-	bf.filter.Add(key)
-	return bf.filter.Test(key)
+	var buf [8]byte
+	data := bf.filterKey(key, &buf)
+	bf.filter.Add(data)
+	return bf.filter.Test(data)
 }
 
 // Reset 重置布隆过滤器
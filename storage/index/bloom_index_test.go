@@ -0,0 +1,56 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter_KeyHash(t *testing.T) {
+	// 共享长前缀、只在末尾几个字节不同的 key
+	const n, probes, fp = 50000, 100000, 0.01
+	prefix := "tenant-0001/region-eu-west-1/service-orders/user-profile/"
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%s%08d", prefix, i)) }
+
+	rate := func(bf *BloomFilter) float64 {
+		for i := 0; i < n; i++ {
+			bf.Add(key(i))
+		}
+		for i := 0; i < n; i++ {
+			if !bf.Test(key(i)) {
+				t.Fatalf("已添加的 %s 不应被判定为不存在", key(i))
+			}
+		}
+		positives := 0
+		for i := n; i < n+probes; i++ {
+			if bf.Test(key(i)) {
+				positives++
+			}
+		}
+		return float64(positives) / probes
+	}
+
+	plain := NewBloomFilter(n, fp)
+	hashed := NewBloomFilter(n, fp, WithBloomKeyHash(XXHashBloomKey))
+	if plain.PreHashed() || !hashed.PreHashed() {
+		t.Fatalf("预哈希状态不匹配")
+	}
+	plainRate, hashedRate := rate(plain), rate(hashed)
+	t.Logf("误判率: 不预哈希 %.4f, 预哈希 %.4f", plainRate, hashedRate)
+
+	// 预哈希的误判率应接近期望值，且不差于不预哈希（允许统计波动）
+	if hashedRate > 2*fp {
+		t.Errorf("预哈希的误判率过高: %.4f", hashedRate)
+	}
+	if hashedRate > plainRate*1.2+0.002 {
+		t.Errorf("预哈希的误判率不应明显高于不预哈希: %.4f / %.4f", hashedRate, plainRate)
+	}
+
+	// AddAndTest 与重置后的过滤器经过同一个预哈希
+	if !hashed.AddAndTest([]byte("extra")) || !hashed.Test([]byte("extra")) {
+		t.Errorf("AddAndTest 添加的 key 应能通过测试")
+	}
+	hashed.Reset()
+	if !hashed.PreHashed() {
+		t.Errorf("重置不应清除预哈希设置")
+	}
+}
@@ -0,0 +1,396 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+// ==================== 冷层磁盘格式 ====================
+//
+// 冷层持久化为一个按 key 有序的只读文件，所有整数均为小端序：
+//
+//	文件头   magic "TKVC" | version uint32
+//	数据块   若干条记录：keyLen uvarint | key | fileID uint32 | offset uint64 | size uint32
+//	         每块写满约 coldBlockSize 字节后结束
+//	块索引   每块一项：firstKeyLen uvarint | firstKey | blockOffset uint64 | blockLen uint32 | blockCRC uint32
+//	文件尾   indexOffset uint64 | indexLen uint32 | indexCRC uint32 | entries uint64 | keyBytes uint64 | magic "TKVC"
+//
+// 版本 1 的记录没有 size 字段，仍可读取，从中查到的记录 Size 为 0。
+//
+// 打开时只把块索引（每块的最小 key）读入内存；查询时二分查找块索引定位到一个数据块，
+// 读取并校验该块后顺序查找。内存占用与块数量成正比，而不是与 key 数量成正比。
+
+// ErrCorruptColdTable 表示冷层文件格式错误或校验失败
+var ErrCorruptColdTable = errors.New("corrupt cold table")
+
+const (
+	coldTableMagic   = "TKVC"
+	coldTableVersion = 2
+
+	// coldTableVersionNoSize 记录中不含 size 字段的旧版本
+	coldTableVersionNoSize = 1
+
+	coldHeaderSize = 8
+	coldFooterSize = 36
+
+	// coldBlockSize 数据块的目标大小
+	coldBlockSize = 4096
+
+	// coldRecordFixedSize 记录中 fileID、offset 与 size 的长度
+	coldRecordFixedSize = 16
+
+	// coldRecordFixedSizeNoSize 版本 1 的记录中 fileID 与 offset 的长度
+	coldRecordFixedSizeNoSize = 12
+)
+
+// coldBlock 块索引项
+type coldBlock struct {
+	firstKey []byte
+	offset   int64
+	length   uint32
+	crc      uint32
+}
+
+// coldTable 打开的冷层文件，可并发查询
+type coldTable struct {
+	file     *os.File
+	version  uint32
+	blocks   []coldBlock
+	entries  int64 // 记录数量
+	keyBytes int64 // 所有 key 的总长度
+}
+
+// openColdTable 打开冷层文件并加载块索引
+// 返回：
+//   - *coldTable: 冷层文件
+//   - error: 打开错误，格式错误或校验失败时返回 ErrCorruptColdTable
+func openColdTable(path string) (*coldTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	table, err := loadColdTable(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("加载冷层文件 %s 失败: %w", path, err)
+	}
+	return table, nil
+}
+
+// loadColdTable 校验文件头、文件尾并解析块索引
+func loadColdTable(file *os.File) (*coldTable, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < coldHeaderSize+coldFooterSize {
+		return nil, fmt.Errorf("%w: 文件过短 (%d 字节)", ErrCorruptColdTable, info.Size())
+	}
+
+	header := make([]byte, coldHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != coldTableMagic {
+		return nil, fmt.Errorf("%w: magic 不匹配", ErrCorruptColdTable)
+	}
+	version := binary.LittleEndian.Uint32(header[4:])
+	if version != coldTableVersion && version != coldTableVersionNoSize {
+		return nil, fmt.Errorf("%w: 不支持的版本 %d", ErrCorruptColdTable, version)
+	}
+
+	footer := make([]byte, coldFooterSize)
+	if _, err := file.ReadAt(footer, info.Size()-coldFooterSize); err != nil {
+		return nil, err
+	}
+	if string(footer[32:]) != coldTableMagic {
+		return nil, fmt.Errorf("%w: 文件尾 magic 不匹配", ErrCorruptColdTable)
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer[0:8]))
+	indexLen := int64(binary.LittleEndian.Uint32(footer[8:12]))
+	indexCRC := binary.LittleEndian.Uint32(footer[12:16])
+	if indexOffset < coldHeaderSize || indexOffset+indexLen != info.Size()-coldFooterSize {
+		return nil, fmt.Errorf("%w: 块索引位置错误", ErrCorruptColdTable)
+	}
+
+	index := make([]byte, indexLen)
+	if _, err := file.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(index) != indexCRC {
+		return nil, fmt.Errorf("%w: 块索引校验失败", ErrCorruptColdTable)
+	}
+
+	table := &coldTable{
+		file:     file,
+		version:  version,
+		entries:  int64(binary.LittleEndian.Uint64(footer[16:24])),
+		keyBytes: int64(binary.LittleEndian.Uint64(footer[24:32])),
+	}
+	for len(index) > 0 {
+		keyLen, n := binary.Uvarint(index)
+		if n <= 0 || uint64(len(index)-n) < keyLen+16 {
+			return nil, fmt.Errorf("%w: 块索引项截断", ErrCorruptColdTable)
+		}
+		index = index[n:]
+		block := coldBlock{
+			firstKey: append([]byte(nil), index[:keyLen]...),
+			offset:   int64(binary.LittleEndian.Uint64(index[keyLen:])),
+			length:   binary.LittleEndian.Uint32(index[keyLen+8:]),
+			crc:      binary.LittleEndian.Uint32(index[keyLen+12:]),
+		}
+		if block.offset < coldHeaderSize || block.offset+int64(block.length) > indexOffset {
+			return nil, fmt.Errorf("%w: 数据块位置错误", ErrCorruptColdTable)
+		}
+		table.blocks = append(table.blocks, block)
+		index = index[keyLen+16:]
+	}
+	return table, nil
+}
+
+// get 查询 key 对应的记录
+// 返回：
+//   - SparseIndexEntry: 记录
+//   - bool: 是否存在
+//   - error: 读取错误
+func (t *coldTable) get(key []byte) (SparseIndexEntry, bool, error) {
+	// 最后一个最小 key 不大于 key 的块
+	i := sort.Search(len(t.blocks), func(i int) bool {
+		return compareKeys(t.blocks[i].firstKey, key) > 0
+	}) - 1
+	if i < 0 {
+		return SparseIndexEntry{}, false, nil
+	}
+
+	data, err := t.readBlock(i)
+	if err != nil {
+		return SparseIndexEntry{}, false, err
+	}
+	for len(data) > 0 {
+		entry, n, err := decodeColdRecord(data, t.version)
+		if err != nil {
+			return SparseIndexEntry{}, false, err
+		}
+		switch cmp := compareKeys(entry.Key, key); {
+		case cmp == 0:
+			return entry, true, nil
+		case cmp > 0:
+			return SparseIndexEntry{}, false, nil
+		}
+		data = data[n:]
+	}
+	return SparseIndexEntry{}, false, nil
+}
+
+// forEach 按 key 升序遍历全部记录，fn 返回 false 时停止
+func (t *coldTable) forEach(fn func(entry SparseIndexEntry) bool) error {
+	for i := range t.blocks {
+		data, err := t.readBlock(i)
+		if err != nil {
+			return err
+		}
+		for len(data) > 0 {
+			entry, n, err := decodeColdRecord(data, t.version)
+			if err != nil {
+				return err
+			}
+			if !fn(entry) {
+				return nil
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+// readBlock 读取并校验第 i 个数据块
+func (t *coldTable) readBlock(i int) ([]byte, error) {
+	block := t.blocks[i]
+	data := make([]byte, block.length)
+	if _, err := t.file.ReadAt(data, block.offset); err != nil {
+		return nil, fmt.Errorf("读取冷层数据块 %d 失败: %w", i, err)
+	}
+	if crc32.ChecksumIEEE(data) != block.crc {
+		return nil, fmt.Errorf("%w: 数据块 %d 校验失败", ErrCorruptColdTable, i)
+	}
+	return data, nil
+}
+
+// memory 估算块索引占用的内存字节数
+func (t *coldTable) memory() int64 {
+	var total int64
+	for _, block := range t.blocks {
+		total += coldBlockEntrySize + int64(len(block.firstKey))
+	}
+	return total
+}
+
+// close 关闭文件
+func (t *coldTable) close() error {
+	return t.file.Close()
+}
+
+// decodeColdRecord 解码一条记录
+// 参数：
+//   - data: 从记录开始的数据
+//   - version: 文件版本，版本 1 的记录没有 size 字段
+//
+// 返回：
+//   - SparseIndexEntry: 记录，Key 引用 data 中的字节
+//   - int: 记录长度
+//   - error: 记录截断时返回 ErrCorruptColdTable
+func decodeColdRecord(data []byte, version uint32) (SparseIndexEntry, int, error) {
+	fixed := coldRecordFixedSize
+	if version == coldTableVersionNoSize {
+		fixed = coldRecordFixedSizeNoSize
+	}
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < keyLen+uint64(fixed) {
+		return SparseIndexEntry{}, 0, fmt.Errorf("%w: 记录截断", ErrCorruptColdTable)
+	}
+	key := data[n : n+int(keyLen)]
+	rest := data[n+int(keyLen):]
+	entry := SparseIndexEntry{
+		Key:    key,
+		FileID: binary.LittleEndian.Uint32(rest[0:4]),
+		Offset: int64(binary.LittleEndian.Uint64(rest[4:12])),
+	}
+	if fixed == coldRecordFixedSize {
+		entry.Size = binary.LittleEndian.Uint32(rest[12:16])
+	}
+	return entry, n + int(keyLen) + fixed, nil
+}
+
+// coldTableWriter 按 key 升序写入冷层文件
+// 先写入临时文件，finish 时同步并原子地重命名为目标文件
+type coldTableWriter struct {
+	path    string
+	tmpPath string
+	file    *os.File
+	w       *bufio.Writer
+
+	offset   int64  // 下一个数据块在文件中的偏移量
+	block    []byte // 正在写入的数据块
+	first    []byte // 正在写入的数据块的最小 key
+	last     []byte // 上一条记录的 key，用于检查顺序
+	index    []byte // 已编码的块索引
+	entries  int64
+	keyBytes int64
+}
+
+// newColdTableWriter 创建冷层文件写入器
+func newColdTableWriter(path string) (*coldTableWriter, error) {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	w := &coldTableWriter{
+		path:    path,
+		tmpPath: tmpPath,
+		file:    file,
+		w:       bufio.NewWriter(file),
+		offset:  coldHeaderSize,
+	}
+
+	header := make([]byte, coldHeaderSize)
+	copy(header, coldTableMagic)
+	binary.LittleEndian.PutUint32(header[4:], coldTableVersion)
+	if _, err := w.w.Write(header); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// add 追加一条记录，key 必须严格大于上一条记录的 key
+func (w *coldTableWriter) add(entry SparseIndexEntry) error {
+	if w.entries > 0 && compareKeys(entry.Key, w.last) <= 0 {
+		return fmt.Errorf("冷层记录必须按 key 严格升序写入: %q 位于 %q 之后", entry.Key, w.last)
+	}
+	w.last = append(w.last[:0], entry.Key...)
+
+	if len(w.block) == 0 {
+		w.first = append(w.first[:0], entry.Key...)
+	}
+	w.block = binary.AppendUvarint(w.block, uint64(len(entry.Key)))
+	w.block = append(w.block, entry.Key...)
+	w.block = binary.LittleEndian.AppendUint32(w.block, entry.FileID)
+	w.block = binary.LittleEndian.AppendUint64(w.block, uint64(entry.Offset))
+	w.block = binary.LittleEndian.AppendUint32(w.block, entry.Size)
+	w.entries++
+	w.keyBytes += int64(len(entry.Key))
+
+	if len(w.block) >= coldBlockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+// flushBlock 写出当前数据块并记录块索引项
+func (w *coldTableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	if _, err := w.w.Write(w.block); err != nil {
+		return err
+	}
+	w.index = binary.AppendUvarint(w.index, uint64(len(w.first)))
+	w.index = append(w.index, w.first...)
+	w.index = binary.LittleEndian.AppendUint64(w.index, uint64(w.offset))
+	w.index = binary.LittleEndian.AppendUint32(w.index, uint32(len(w.block)))
+	w.index = binary.LittleEndian.AppendUint32(w.index, crc32.ChecksumIEEE(w.block))
+
+	w.offset += int64(len(w.block))
+	w.block = w.block[:0]
+	return nil
+}
+
+// finish 写出块索引与文件尾，同步后替换目标文件
+func (w *coldTableWriter) finish() error {
+	if err := w.flushBlock(); err != nil {
+		w.abort()
+		return err
+	}
+
+	footer := make([]byte, coldFooterSize)
+	binary.LittleEndian.PutUint64(footer[0:8], uint64(w.offset))
+	binary.LittleEndian.PutUint32(footer[8:12], uint32(len(w.index)))
+	binary.LittleEndian.PutUint32(footer[12:16], crc32.ChecksumIEEE(w.index))
+	binary.LittleEndian.PutUint64(footer[16:24], uint64(w.entries))
+	binary.LittleEndian.PutUint64(footer[24:32], uint64(w.keyBytes))
+	copy(footer[32:], coldTableMagic)
+
+	if _, err := w.w.Write(w.index); err != nil {
+		w.abort()
+		return err
+	}
+	if _, err := w.w.Write(footer); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.tmpPath)
+		return err
+	}
+	return os.Rename(w.tmpPath, w.path)
+}
+
+// abort 放弃写入并删除临时文件
+func (w *coldTableWriter) abort() {
+	w.file.Close()
+	os.Remove(w.tmpPath)
+}
@@ -0,0 +1,279 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+func TestColdTable_Roundtrip(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cold.idx")
+
+	// 偶数 key 写入文件，奇数 key 用于查询不存在的情况
+	const n = 5000
+	w, err := newColdTableWriter(path)
+	if err != nil {
+		t.Fatalf("创建写入器失败: %v", err)
+	}
+	for i := 0; i < n; i += 2 {
+		entry := SparseIndexEntry{Key: []byte(fmt.Sprintf("key-%06d", i)), FileID: uint32(i % 7), Size: uint32(i + 20), Offset: int64(i) * 100}
+		if err := w.add(entry); err != nil {
+			t.Fatalf("写入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := w.add(SparseIndexEntry{Key: []byte("key-000000")}); err == nil {
+		t.Fatalf("乱序写入应返回错误")
+	}
+	if err := w.finish(); err != nil {
+		t.Fatalf("完成写入失败: %v", err)
+	}
+
+	table, err := openColdTable(path)
+	if err != nil {
+		t.Fatalf("打开冷层文件失败: %v", err)
+	}
+	if len(table.blocks) < 2 {
+		t.Fatalf("记录应分布在多个数据块中: %d", len(table.blocks))
+	}
+	if table.entries != n/2 {
+		t.Fatalf("记录数量不匹配: %d", table.entries)
+	}
+
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%06d", i))
+		entry, found, err := table.get(key)
+		if err != nil {
+			t.Fatalf("查询 %s 失败: %v", key, err)
+		}
+		if found != (i%2 == 0) {
+			t.Fatalf("%s 的查询结果不匹配: %v", key, found)
+		}
+		if found && (entry.FileID != uint32(i%7) || entry.Size != uint32(i+20) || entry.Offset != int64(i)*100) {
+			t.Fatalf("%s 的位置不匹配: %+v", key, entry)
+		}
+	}
+	for _, key := range []string{"a", "key-", "key-999999", "z"} {
+		if _, found, _ := table.get([]byte(key)); found {
+			t.Fatalf("%s 不应存在", key)
+		}
+	}
+
+	var prev []byte
+	count := 0
+	if err := table.forEach(func(entry SparseIndexEntry) bool {
+		if prev != nil && bytes.Compare(prev, entry.Key) >= 0 {
+			t.Fatalf("遍历顺序错误: %s 在 %s 之后", entry.Key, prev)
+		}
+		prev = append(prev[:0], entry.Key...)
+		count++
+		return true
+	}); err != nil {
+		t.Fatalf("遍历失败: %v", err)
+	}
+	if count != n/2 {
+		t.Fatalf("遍历数量不匹配: %d", count)
+	}
+	table.close()
+
+	// 破坏第一个数据块，查询应返回 ErrCorruptColdTable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	data[coldHeaderSize+4] ^= 0xFF
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	table, err = openColdTable(path)
+	if err != nil {
+		t.Fatalf("块索引未损坏，应能打开: %v", err)
+	}
+	if _, _, err := table.get([]byte("key-000000")); !errors.Is(err, ErrCorruptColdTable) {
+		t.Fatalf("数据块损坏应返回 ErrCorruptColdTable: %v", err)
+	}
+	table.close()
+
+	// 截断文件尾
+	if err := os.WriteFile(path, data[:len(data)-4], 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if _, err := openColdTable(path); !errors.Is(err, ErrCorruptColdTable) {
+		t.Fatalf("文件尾损坏应返回 ErrCorruptColdTable: %v", err)
+	}
+}
+
+func TestDecodeColdRecord_Versions(t *testing.T) {
+	record := binary.AppendUvarint(nil, 3)
+	record = append(record, "key"...)
+	record = binary.LittleEndian.AppendUint32(record, 5)
+	record = binary.LittleEndian.AppendUint64(record, 4096)
+
+	// 版本 1 的记录没有 size 字段
+	entry, n, err := decodeColdRecord(record, coldTableVersionNoSize)
+	if err != nil {
+		t.Fatalf("解码版本 1 的记录失败: %v", err)
+	}
+	if n != len(record) || string(entry.Key) != "key" || entry.FileID != 5 || entry.Offset != 4096 || entry.Size != 0 {
+		t.Fatalf("版本 1 的记录不匹配: %+v (%d 字节)", entry, n)
+	}
+	if _, _, err := decodeColdRecord(record, coldTableVersion); !errors.Is(err, ErrCorruptColdTable) {
+		t.Fatalf("缺少 size 字段的记录按当前版本解码应返回 ErrCorruptColdTable: %v", err)
+	}
+
+	record = binary.LittleEndian.AppendUint32(record, 64)
+	entry, n, err = decodeColdRecord(record, coldTableVersion)
+	if err != nil {
+		t.Fatalf("解码记录失败: %v", err)
+	}
+	if n != len(record) || entry.Size != 64 {
+		t.Fatalf("记录不匹配: %+v (%d 字节)", entry, n)
+	}
+}
+
+func TestHybridIndex_ColdSize(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cold.idx")
+
+	opts := []Option{WithColdMemoryLimit(10), WithBackgroundInterval(60 * 1000)}
+	hi, err := OpenHybridIndex(path, opts...)
+	if err != nil {
+		t.Fatalf("打开混合索引失败: %v", err)
+	}
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%03d", i)) }
+	check := func(stage string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			// Peek 不提升访问层级，保证查询的是冷层
+			pos, tier := hi.Peek(key(i))
+			if tier != TierCold || pos == nil || pos.FileID != 1 || pos.Offset != int64(i)*64 || pos.Size != uint32(i+30) {
+				t.Fatalf("%s: %s 的位置不匹配: %+v (%s)", stage, key(i), pos, tier)
+			}
+		}
+	}
+
+	// 新写入的 key 位于冷层
+	for i := 0; i < 100; i++ {
+		hi.Put(key(i), &storage.Position{FileID: 1, Offset: int64(i) * 64, Size: uint32(i + 30)})
+	}
+	check("内存中的冷层")
+
+	hi.runMaintenance()
+	if pending := hi.GetStats()["cold_pending"].(int); pending >= 10 {
+		t.Fatalf("内存中的变更应已落盘: %d", pending)
+	}
+	check("落盘后")
+	hi.Close()
+
+	hi, err = OpenHybridIndex(path, opts...)
+	if err != nil {
+		t.Fatalf("重新打开混合索引失败: %v", err)
+	}
+	defer hi.Close()
+	check("重新打开后")
+}
+
+func TestHybridIndex_ColdTableReopen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cold.idx")
+
+	// key 数量是内存上限的 20 倍；后台任务间隔足够长，由测试显式触发维护
+	const n, limit = 20000, 1000
+	opts := []Option{WithColdMemoryLimit(limit), WithBackgroundInterval(60 * 1000)}
+	hi, err := OpenHybridIndex(path, opts...)
+	if err != nil {
+		t.Fatalf("打开混合索引失败: %v", err)
+	}
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%06d", i)) }
+	for i := 0; i < n; i++ {
+		hi.Put(key(i), &storage.Position{FileID: 1, Offset: int64(i)})
+		if (i+1)%limit == 0 {
+			hi.runMaintenance()
+		}
+	}
+	if pending := hi.GetStats()["cold_pending"].(int); pending >= limit {
+		t.Fatalf("内存中的变更应已落盘: %d", pending)
+	}
+
+	// 落盘之后的删除与更新
+	for i := 0; i < n; i += 10 {
+		hi.Delete(key(i))
+	}
+	for i := 1; i < n; i += 10 {
+		hi.Put(key(i), &storage.Position{FileID: 2, Offset: int64(i)})
+	}
+	if size := hi.Size(); size != n-n/10 {
+		t.Fatalf("大小不匹配: %d", size)
+	}
+	// 位于温层的 key 更新后，冷层中的位置也应更新
+	hi.addToWarm(key(3), &storage.Position{FileID: 1, Offset: 3})
+	hi.Put(key(3), &storage.Position{FileID: 2, Offset: 3})
+	hi.Close()
+
+	hi, err = OpenHybridIndex(path, opts...)
+	if err != nil {
+		t.Fatalf("重新打开混合索引失败: %v", err)
+	}
+	defer hi.Close()
+
+	if pending := hi.GetStats()["cold_pending"].(int); pending != 0 {
+		t.Fatalf("重新打开后内存中不应有变更: %d", pending)
+	}
+	if size := hi.Size(); size != n-n/10 {
+		t.Fatalf("重新打开后大小不匹配: %d", size)
+	}
+	for i := 0; i < n; i++ {
+		pos := hi.Get(key(i))
+		switch {
+		case i%10 == 0:
+			if pos != nil {
+				t.Fatalf("%s 已删除，不应存在", key(i))
+			}
+		case i%10 == 1 || i == 3:
+			if pos == nil || pos.FileID != 2 || pos.Offset != int64(i) {
+				t.Fatalf("%s 的位置应为更新后的值: %+v", key(i), pos)
+			}
+		default:
+			if pos == nil || pos.FileID != 1 || pos.Offset != int64(i) {
+				t.Fatalf("%s 的位置不匹配: %+v", key(i), pos)
+			}
+		}
+	}
+
+	// 重新写入已删除的 key 并删除磁盘上的 key，遍历应合并内存与磁盘
+	hi.Put(key(0), &storage.Position{FileID: 3, Offset: 0})
+	hi.Delete(key(2))
+	it := hi.Seek(nil)
+	defer it.Close()
+	expected := []int{0, 1, 3, 4, 5, 6, 7, 8, 9, 11}
+	for _, i := range expected {
+		if it.Key() == nil {
+			t.Fatalf("迭代器提前结束，期望 %s", key(i))
+		}
+		if !bytes.Equal(it.Key(), key(i)) {
+			t.Fatalf("迭代顺序不匹配: 期望 %s，实际 %s", key(i), it.Key())
+		}
+		it.Next()
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("迭代出错: %v", err)
+	}
+}
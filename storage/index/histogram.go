@@ -0,0 +1,124 @@
+package index
+
+import (
+	"github.com/forever-free1/TideKV/storage"
+	"github.com/plar/go-adaptive-radix-tree"
+)
+
+// ==================== Key 分布 ====================
+//
+// 键空间按 key 的首字节（0x00 ~ 0xFF）均分为若干区间，每个区间统计 key 数量与 key 总长度。
+// 按首字节划分与 key 的排序一致，相邻区间即相邻的 key 范围，可以直接作为按范围分片的参考。
+
+// histogram 统计 key 分布的累加器
+type histogram struct {
+	buckets []storage.BucketStat
+	index   [256]int // 首字节到区间下标的映射
+}
+
+// newHistogram 创建 n 个区间的累加器，n 限制在 [1, 256] 之内
+func newHistogram(n int) *histogram {
+	if n < 1 {
+		n = 1
+	} else if n > 256 {
+		n = 256
+	}
+
+	h := &histogram{buckets: make([]storage.BucketStat, n)}
+	for b := 0; b < 256; b++ {
+		i := b * n / 256
+		h.index[b] = i
+		if b == 0 || h.index[b-1] != i {
+			h.buckets[i].Low = byte(b)
+		}
+		h.buckets[i].High = byte(b)
+	}
+	return h
+}
+
+// add 将 key 计入对应的区间，空 key 计入第一个区间
+func (h *histogram) add(key []byte) {
+	i := 0
+	if len(key) > 0 {
+		i = h.index[key[0]]
+	}
+	h.count(i, len(key))
+}
+
+// addString 与 add 相同，用于 map 中的 string key，避免复制
+func (h *histogram) addString(key string) {
+	i := 0
+	if len(key) > 0 {
+		i = h.index[key[0]]
+	}
+	h.count(i, len(key))
+}
+
+// count 将长度为 size 的 key 计入第 i 个区间
+func (h *histogram) count(i int, size int) {
+	h.buckets[i].Keys++
+	h.buckets[i].KeyBytes += int64(size)
+}
+
+// addTree 遍历 ART 中的全部叶子节点
+func (h *histogram) addTree(tree art.Tree) {
+	tree.ForEach(func(node art.Node) bool {
+		h.add(node.Key())
+		return true
+	})
+}
+
+// KeyHistogram 单次遍历 map 统计 key 分布
+func (idx *MapIndex) KeyHistogram(buckets int) []storage.BucketStat {
+	h := newHistogram(buckets)
+	for key := range idx.data {
+		h.addString(key)
+	}
+	return h.buckets
+}
+
+// KeyHistogram 遍历 ART 的叶子节点统计 key 分布
+func (idx *ARTIndex) KeyHistogram(buckets int) []storage.BucketStat {
+	h := newHistogram(buckets)
+	h.addTree(idx.tree)
+	return h.buckets
+}
+
+// TierHistogram 混合索引各层的 key 分布
+type TierHistogram struct {
+	Hot  []storage.BucketStat
+	Warm []storage.BucketStat
+	Cold []storage.BucketStat // 冷层包含全部 key
+}
+
+// TierKeyHistogram 分别统计各层的 key 分布
+func (hi *HybridIndex) TierKeyHistogram(buckets int) TierHistogram {
+	hot := newHistogram(buckets)
+	hi.hotMu.RLock()
+	hot.addTree(hi.hotTree)
+	hi.hotMu.RUnlock()
+
+	warm := newHistogram(buckets)
+	hi.warmMu.RLock()
+	warm.addTree(hi.warmTree)
+	hi.warmMu.RUnlock()
+
+	return TierHistogram{
+		Hot:  hot.buckets,
+		Warm: warm.buckets,
+		Cold: hi.KeyHistogram(buckets),
+	}
+}
+
+// KeyHistogram 统计混合索引的 key 分布，即冷层中的全部 key
+// 启用冷层文件时需要读取整个文件，读取失败的部分不计入
+func (hi *HybridIndex) KeyHistogram(buckets int) []storage.BucketStat {
+	h := newHistogram(buckets)
+	hi.sparseIndexMu.RLock()
+	hi.forEachColdLocked(func(entry SparseIndexEntry) bool {
+		h.add(entry.Key)
+		return true
+	})
+	hi.sparseIndexMu.RUnlock()
+	return h.buckets
+}
@@ -0,0 +1,94 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// fillSkewed 写入倾斜的 key 集合：900 个 "user/"（首字节 0x75）与 100 个 "admin/"（首字节 0x61）
+func fillSkewed(idx Index) {
+	for i := 0; i < 900; i++ {
+		idx.Put([]byte(fmt.Sprintf("user/%04d", i)), &storage.Position{FileID: 1, Offset: int64(i)})
+	}
+	for i := 0; i < 100; i++ {
+		idx.Put([]byte(fmt.Sprintf("admin/%04d", i)), &storage.Position{FileID: 1, Offset: int64(i)})
+	}
+}
+
+func TestIndex_KeyHistogram(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func() Index
+	}{
+		{"map", func() Index { return NewMapIndex() }},
+		{"art", func() Index { return NewARTIndex() }},
+		{"hybrid", func() Index { return NewHybridIndex(WithBackgroundInterval(60 * 1000)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := tt.new()
+			defer idx.Close()
+			fillSkewed(idx)
+
+			// 16 个区间，每个区间覆盖 16 个首字节：0x70~0x7f 为第 7 个，0x60~0x6f 为第 6 个
+			buckets := idx.KeyHistogram(16)
+			if len(buckets) != 16 {
+				t.Fatalf("区间数量不匹配: got %d, want 16", len(buckets))
+			}
+			for i, b := range buckets {
+				if int(b.Low) != i*16 || int(b.High) != i*16+15 {
+					t.Fatalf("区间 %d 边界不匹配: %+v", i, b)
+				}
+				var want int64
+				switch i {
+				case 7:
+					want = 900
+				case 6:
+					want = 100
+				}
+				if b.Keys != want {
+					t.Errorf("区间 %d 的 key 数量不匹配: got %d, want %d", i, b.Keys, want)
+				}
+			}
+			if buckets[7].KeyBytes != 900*9 || buckets[6].KeyBytes != 100*10 {
+				t.Errorf("key 总长度不匹配: %+v, %+v", buckets[7], buckets[6])
+			}
+
+			// 区间数量限制在 [1, 256] 之内
+			if all := idx.KeyHistogram(0); len(all) != 1 || all[0].Keys != 1000 || all[0].High != 0xff {
+				t.Errorf("单个区间应包含全部 key: %+v", all)
+			}
+			if fine := idx.KeyHistogram(1000); len(fine) != 256 || fine['u'].Keys != 900 || fine['a'].Keys != 100 {
+				t.Errorf("256 个区间时应按首字节统计: %d 个区间", len(fine))
+			}
+		})
+	}
+}
+
+func TestHybridIndex_TierKeyHistogram(t *testing.T) {
+	hi := NewHybridIndex(WithBackgroundInterval(60 * 1000))
+	defer hi.Close()
+	fillSkewed(hi)
+
+	// 再次访问的 key 从冷层提升到温层
+	for i := 0; i < 100; i++ {
+		hi.Get([]byte(fmt.Sprintf("admin/%04d", i)))
+	}
+
+	tiers := hi.TierKeyHistogram(16)
+	if tiers.Warm[6].Keys != 100 || tiers.Warm[7].Keys != 0 {
+		t.Errorf("温层分布不匹配: admin=%d, user=%d", tiers.Warm[6].Keys, tiers.Warm[7].Keys)
+	}
+	// 冷层包含全部 key
+	if tiers.Cold[6].Keys != 100 || tiers.Cold[7].Keys != 900 {
+		t.Errorf("冷层分布不匹配: admin=%d, user=%d", tiers.Cold[6].Keys, tiers.Cold[7].Keys)
+	}
+	for i, b := range tiers.Hot {
+		if b.Keys != 0 {
+			t.Errorf("热层区间 %d 应为空: %+v", i, b)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog_Estimate(t *testing.T) {
+	h := NewHyperLogLog(DefaultHLLPrecision)
+	if n := h.Estimate(); n != 0 {
+		t.Fatalf("空估算器的估算值应为 0: %d", n)
+	}
+
+	// 标准误差约 0.81%，允许 4 倍标准误差
+	bound := 4 * 1.04 / math.Sqrt(float64(uint(1)<<DefaultHLLPrecision))
+	added := 0
+	for _, n := range []int{100, 1000, 10000, 100000, 500000} {
+		for ; added < n; added++ {
+			h.Add([]byte(fmt.Sprintf("key-%08d", added)))
+		}
+		// 重复添加不影响估算值
+		for i := 0; i < n; i += 7 {
+			h.Add([]byte(fmt.Sprintf("key-%08d", i)))
+		}
+		estimate := float64(h.Estimate())
+		if err := math.Abs(estimate-float64(n)) / float64(n); err > bound {
+			t.Fatalf("估算误差过大: n=%d, estimate=%.0f, 相对误差 %.4f > %.4f", n, estimate, err, bound)
+		}
+	}
+
+	h.Reset()
+	if n := h.Estimate(); n != 0 {
+		t.Fatalf("重置后估算值应为 0: %d", n)
+	}
+}
@@ -1,7 +1,10 @@
 package index
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -21,6 +24,16 @@ const (
 	AccessTypeWrite
 )
 
+// Tier 表示 key 在混合索引中所在的层
+type Tier string
+
+const (
+	TierNone Tier = ""
+	TierHot  Tier = "hot"
+	TierWarm Tier = "warm"
+	TierCold Tier = "cold"
+)
+
 // HotEntry 表示热数据的条目
 type HotEntry struct {
 	Position *storage.Position
@@ -38,9 +51,10 @@ type WarmEntry struct {
 // SparseIndexEntry 稀疏索引条目
 // 用于 Cold 层快速定位数据在文件中的位置
 type SparseIndexEntry struct {
-	Key     []byte
-	FileID  uint32
-	Offset  int64
+	Key    []byte
+	FileID uint32
+	Size   uint32 // Entry 的总大小，来自旧版本冷层文件的记录为 0
+	Offset int64
 }
 
 // ==================== HybridIndex 主结构体 ====================
@@ -48,7 +62,7 @@ type SparseIndexEntry struct {
 // HybridIndex 三层混合索引架构
 // - Hot: 内存 ART 树，存储高频访问的 key
 // - Warm: 内存 ART 树，存储中频访问的 key
-// - Cold: 磁盘稀疏索引 + 有序表，存储所有 key
+// - Cold: 稀疏索引，存储所有 key；通过 OpenHybridIndex 打开时持久化为磁盘上的有序表（见 coldtable.go）
 type HybridIndex struct {
 	// 热数据层：高频访问的 key
 	hotTree    art.Tree
@@ -60,12 +74,23 @@ type HybridIndex struct {
 	warmEntries map[string]*WarmEntry
 	warmMu      sync.RWMutex
 
-	// 冷数据层：稀疏索引（内存）+ 有序数据（磁盘）
-	sparseIndex     []SparseIndexEntry // 稀疏索引，内存中维护
-	sparseIndexMu   sync.RWMutex
+	// 冷数据层：稀疏索引（内存）+ 有序表（磁盘，可选）
+	// 未启用冷层文件时 sparseIndex 保存全部冷层 key；启用后 sparseIndex 只保存上次落盘之后新增或更新的 key，
+	// coldDeleted 记录落盘之后被删除的磁盘 key，二者叠加在 coldTable 之上才是完整的冷层。
+	// 以下字段均由 sparseIndexMu 保护
+	sparseIndex    []SparseIndexEntry // 稀疏索引，内存中维护
+	sparseIndexMu  sync.RWMutex
+	coldTable      *coldTable          // 冷层文件，未启用或尚未落盘时为 nil
+	coldDeleted    map[string]struct{} // 落盘之后被删除的磁盘 key
+	coldClosed     bool                // 索引已关闭，不再落盘
+	coldFlushErr   error               // 最近一次后台落盘的错误
+	coldKeys       int64               // 冷层 key 总数
+	coldKeyBytes   int64               // 冷层所有 key 的总长度
+	sparseKeyBytes int64               // sparseIndex 中 key 的总长度
 
 	// 统计信息：记录每个 key 的访问频率
-	stats sync.Map // map[string]*atomic.Int64
+	stats     sync.Map     // map[string]*atomic.Int64
+	statsKeys atomic.Int64 // stats 中的 key 数量，用于内存估算
 
 	// 配置参数
 	options *HybridOptions
@@ -75,6 +100,18 @@ type HybridIndex struct {
 
 	// 容量监控
 	totalKeys int64
+
+	// 层间迁移计数（累计值）
+	promotionsToWarm atomic.Int64
+	promotionsToHot  atomic.Int64
+	demotionsToWarm  atomic.Int64
+	demotionsToCold  atomic.Int64
+
+	// 后台维护的耗时监控
+	interval            atomic.Int64 // 当前后台任务间隔（纳秒），自动调整后可能大于配置值
+	maintenanceDuration atomic.Int64 // 最近一次维护的耗时（纳秒）
+	maintenanceOverruns atomic.Int64 // 连续超过间隔的维护次数
+	maintenanceLagging  atomic.Bool  // 维护是否持续跟不上间隔
 }
 
 // HybridOptions 三层索引的配置选项
@@ -96,17 +133,40 @@ type HybridOptions struct {
 
 	// 后台任务执行间隔（毫秒）
 	BackgroundInterval int
+
+	// 维护持续滞后时是否自动加倍后台任务间隔（不超过 maxBackgroundInterval）
+	AutoAdjustInterval bool
+
+	// 冷层在内存中的变更（新增、更新、删除的 key）达到该数量时，后台任务将其合并到冷层文件
+	// 只在通过 OpenHybridIndex 启用冷层文件时生效
+	ColdMemoryLimit int
+
+	// coldPath 冷层文件路径，为空表示冷层只保存在内存中
+	coldPath string
+
+	// clock 用于测量维护耗时，测试中可替换为假时钟
+	clock func() time.Time
 }
 
+const (
+	// maintenanceLagRuns 连续超过间隔的维护次数达到该值时判定为滞后
+	maintenanceLagRuns = 3
+
+	// maxBackgroundInterval 自动调整后台任务间隔的上限
+	maxBackgroundInterval = time.Minute
+)
+
 // DefaultHybridOptions 返回默认配置
 func DefaultHybridOptions() *HybridOptions {
 	return &HybridOptions{
-		HotCapacity:         10000,      // 热层最多 1 万个 key
-		WarmCapacity:        100000,     // 温层最多 10 万个 key
-		PromoteThreshold:   10,         // 访问 10 次后提升到热层
-		DemoteThreshold:    5,          // 访问低于 5 次后降级到温层
-		StatsResetInterval: 300,        // 5 分钟重置统计
-		BackgroundInterval: 1000,       // 1 秒执行一次后台任务
+		HotCapacity:        10000,  // 热层最多 1 万个 key
+		WarmCapacity:       100000, // 温层最多 10 万个 key
+		PromoteThreshold:   10,     // 访问 10 次后提升到热层
+		DemoteThreshold:    5,      // 访问低于 5 次后降级到温层
+		StatsResetInterval: 300,    // 5 分钟重置统计
+		BackgroundInterval: 1000,   // 1 秒执行一次后台任务
+		ColdMemoryLimit:    100000, // 冷层内存中最多 10 万个变更
+		clock:              time.Now,
 	}
 }
 
@@ -118,16 +178,53 @@ func NewHybridIndex(opts ...Option) *HybridIndex {
 	for _, opt := range opts {
 		opt(options)
 	}
+	return newHybridIndex(options, nil)
+}
 
+// OpenHybridIndex 创建冷层持久化到磁盘的三层混合索引
+// path 处已有冷层文件时只加载其块索引，冷层查询按需读取磁盘；内存中只保留块索引与尚未落盘的变更，
+// 变更数达到 ColdMemoryLimit 后由后台任务合并到文件，FlushCold 与 Close 也会落盘。
+// 热层与温层只在内存中，重新打开后所有 key 都位于冷层。
+// 参数：
+//   - path: 冷层文件路径
+//   - opts: 配置选项
+//
+// 返回：
+//   - *HybridIndex: 混合索引
+//   - error: 冷层文件存在但无法加载时返回错误，格式错误或校验失败时返回 ErrCorruptColdTable
+func OpenHybridIndex(path string, opts ...Option) (*HybridIndex, error) {
+	options := DefaultHybridOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.coldPath = path
+
+	table, err := openColdTable(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return newHybridIndex(options, table), nil
+}
+
+// newHybridIndex 创建混合索引并启动后台任务，table 为已加载的冷层文件（可为 nil）
+func newHybridIndex(options *HybridOptions, table *coldTable) *HybridIndex {
 	hi := &HybridIndex{
-		hotTree:    art.New(),
-		hotEntries: make(map[string]*HotEntry),
-		warmTree:   art.New(),
+		hotTree:     art.New(),
+		hotEntries:  make(map[string]*HotEntry),
+		warmTree:    art.New(),
 		warmEntries: make(map[string]*WarmEntry),
 		sparseIndex: make([]SparseIndexEntry, 0),
-		options:    options,
-		stopCh:    make(chan struct{}),
+		coldDeleted: make(map[string]struct{}),
+		options:     options,
+		stopCh:      make(chan struct{}),
+	}
+	if table != nil {
+		hi.coldTable = table
+		hi.coldKeys = table.entries
+		hi.coldKeyBytes = table.keyBytes
+		hi.totalKeys = table.entries
 	}
+	hi.interval.Store(int64(time.Duration(options.BackgroundInterval) * time.Millisecond))
 
 	// 启动后台 goroutine
 	go hi.backgroundWorker()
@@ -161,6 +258,27 @@ func WithPromoteThreshold(threshold int64) Option {
 	}
 }
 
+// WithBackgroundInterval 设置后台任务执行间隔（毫秒）
+func WithBackgroundInterval(ms int) Option {
+	return func(o *HybridOptions) {
+		o.BackgroundInterval = ms
+	}
+}
+
+// WithColdMemoryLimit 设置冷层在内存中保留的最大变更数，超过后由后台任务合并到冷层文件
+func WithColdMemoryLimit(limit int) Option {
+	return func(o *HybridOptions) {
+		o.ColdMemoryLimit = limit
+	}
+}
+
+// WithAutoAdjustInterval 设置维护持续滞后时是否自动加倍后台任务间隔
+func WithAutoAdjustInterval(enabled bool) Option {
+	return func(o *HybridOptions) {
+		o.AutoAdjustInterval = enabled
+	}
+}
+
 // ==================== 核心接口实现 ====================
 
 // Put 写入键值对到索引
@@ -171,16 +289,18 @@ func (hi *HybridIndex) Put(key []byte, pos *storage.Position) {
 	hi.incrementStats(keyStr)
 
 	// 先尝试在现有层查找
-	// 如果存在，则更新位置信息
+	// 如果存在，则更新位置信息；冷层包含全部 key，同样更新，冷层文件重新打开后位置才是最新的
 	if hi.existsInHot(keyStr) {
 		hi.updateHotEntry(keyStr, pos)
 		hi.incrementHotFrequency(keyStr)
+		hi.addToCold(key, pos)
 		return
 	}
 
 	if hi.existsInWarm(keyStr) {
 		hi.updateWarmEntry(keyStr, pos)
 		hi.incrementWarmFrequency(keyStr)
+		hi.addToCold(key, pos)
 		// 检查是否需要提升到热层
 		if hi.getStats(keyStr) >= hi.options.PromoteThreshold {
 			hi.promoteToHot(keyStr)
@@ -188,11 +308,11 @@ func (hi *HybridIndex) Put(key []byte, pos *storage.Position) {
 		return
 	}
 
-	// 新 key：添加到冷层（稀疏索引）
-	hi.addToCold(key, pos)
-
-	// 原子增加总 key 计数
-	atomic.AddInt64(&hi.totalKeys, 1)
+	// 新 key：添加到冷层（稀疏索引），已在冷层的 key 只更新位置
+	if hi.addToCold(key, pos) {
+		// 原子增加总 key 计数
+		atomic.AddInt64(&hi.totalKeys, 1)
+	}
 }
 
 // Get 查询键值对
@@ -233,6 +353,7 @@ func (hi *HybridIndex) Get(key []byte) *storage.Position {
 		if freq >= 2 {
 			// 如果访问频率足够，添加到温层
 			hi.addToWarm(key, pos)
+			hi.promotionsToWarm.Add(1)
 		}
 		return pos
 	}
@@ -241,52 +362,68 @@ func (hi *HybridIndex) Get(key []byte) *storage.Position {
 }
 
 // Delete 删除键值对
+// 从冷层提升的 key 在冷层中仍保留一份，因此需要从所有层删除
 func (hi *HybridIndex) Delete(key []byte) bool {
 	keyStr := string(key)
 
-	// 从热层删除
-	if hi.removeFromHot(keyStr) {
-		return true
-	}
-
-	// 从温层删除
-	if hi.removeFromWarm(keyStr) {
-		return true
-	}
-
-	// 从冷层删除
-	if hi.removeFromCold(key) {
-		return true
+	removed := hi.removeFromHot(keyStr)
+	removed = hi.removeFromWarm(keyStr) || removed
+	removed = hi.removeFromCold(key) || removed
+	if !removed {
+		return false
 	}
 
 	// 删除统计
-	hi.stats.Delete(keyStr)
+	hi.deleteStats(keyStr)
 	atomic.AddInt64(&hi.totalKeys, -1)
-	return false
+	return true
+}
+
+// Peek 查询 key 的位置及其所在的层，不更新访问统计，也不触发层间迁移
+// 用于诊断，避免观察行为本身改变 key 的冷热分布
+// 返回：
+//   - *storage.Position: 位置指针，不存在返回 nil
+//   - Tier: key 所在的层，不存在返回 TierNone
+func (hi *HybridIndex) Peek(key []byte) (*storage.Position, Tier) {
+	keyStr := string(key)
+	if pos := hi.getFromHot(keyStr); pos != nil {
+		return pos, TierHot
+	}
+	if pos := hi.getFromWarm(keyStr); pos != nil {
+		return pos, TierWarm
+	}
+	if pos := hi.getFromCold(key); pos != nil {
+		return pos, TierCold
+	}
+	return nil, TierNone
 }
 
 // Size 返回索引中的键值对数量
 func (hi *HybridIndex) Size() int {
 	hotSize := hi.hotTree.Size()
 	warmSize := hi.warmTree.Size()
-	coldSize := len(hi.sparseIndex)
+	hi.sparseIndexMu.RLock()
+	coldSize := int(hi.coldKeys)
+	hi.sparseIndexMu.RUnlock()
 	return hotSize + warmSize + coldSize
 }
 
 // Seek 查找第一个大于等于 key 的键，返回迭代器
 func (hi *HybridIndex) Seek(key []byte) IndexIterator {
 	// 收集所有层的 keys 并排序
-	allKeys := hi.collectAllKeysSorted(key)
+	allKeys, err := hi.collectAllKeysSorted(key)
 
 	return &HybridIterator{
 		hybridIndex: hi,
-		keys:       allKeys,
-		pos:        0,
+		keys:        allKeys,
+		pos:         0,
+		err:         err,
 	}
 }
 
 // collectAllKeysSorted 收集所有大于等于 key 的 keys 并排序
-func (hi *HybridIndex) collectAllKeysSorted(startKey []byte) []string {
+// 读取冷层文件失败时返回已收集的 keys 与错误
+func (hi *HybridIndex) collectAllKeysSorted(startKey []byte) ([]string, error) {
 	keySet := make(map[string]bool)
 
 	// 从 Hot 层收集
@@ -309,11 +446,12 @@ func (hi *HybridIndex) collectAllKeysSorted(startKey []byte) []string {
 
 	// 从 Cold 层收集
 	hi.sparseIndexMu.RLock()
-	for _, entry := range hi.sparseIndex {
+	err := hi.forEachColdLocked(func(entry SparseIndexEntry) bool {
 		if compareKeys(entry.Key, startKey) >= 0 {
 			keySet[string(entry.Key)] = true
 		}
-	}
+		return true
+	})
 	hi.sparseIndexMu.RUnlock()
 
 	// 排序
@@ -322,14 +460,15 @@ func (hi *HybridIndex) collectAllKeysSorted(startKey []byte) []string {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-	return keys
+	return keys, err
 }
 
 // HybridIterator 是 HybridIndex 的迭代器实现
 type HybridIterator struct {
 	hybridIndex *HybridIndex
-	keys       []string
-	pos        int
+	keys        []string
+	pos         int
+	err         error // 收集 key 时读取冷层文件的错误
 }
 
 // Next 移动到下一个键
@@ -369,7 +508,7 @@ func (it *HybridIterator) Value() *storage.Position {
 
 // Error 返回错误
 func (it *HybridIterator) Error() error {
-	return nil
+	return it.err
 }
 
 // Close 关闭迭代器
@@ -379,9 +518,21 @@ func (it *HybridIterator) Close() {
 }
 
 // Close 关闭索引
+// 启用冷层文件时先将内存中的变更落盘再关闭文件；需要得到落盘错误时应先调用 FlushCold
 func (hi *HybridIndex) Close() {
 	// 停止后台 goroutine
 	close(hi.stopCh)
+
+	hi.sparseIndexMu.Lock()
+	defer hi.sparseIndexMu.Unlock()
+	if hi.options.coldPath != "" {
+		hi.flushColdLocked()
+	}
+	if hi.coldTable != nil {
+		hi.coldTable.close()
+		hi.coldTable = nil
+	}
+	hi.coldClosed = true
 }
 
 // ==================== 热层操作 ====================
@@ -426,6 +577,28 @@ func (hi *HybridIndex) updateHotAccessTime(key string) {
 	}
 }
 
+// LastAccess 返回热层或温层记录的 key 最近访问时间，不更新访问统计
+// 冷层不记录访问时间，key 位于冷层或不存在时返回 false
+func (hi *HybridIndex) LastAccess(key []byte) (time.Time, bool) {
+	hi.hotMu.RLock()
+	hot, ok := hi.hotEntries[string(key)]
+	var last time.Time
+	if ok {
+		last = hot.LastAccess
+	}
+	hi.hotMu.RUnlock()
+	if ok {
+		return last, true
+	}
+
+	hi.warmMu.RLock()
+	defer hi.warmMu.RUnlock()
+	if warm, ok := hi.warmEntries[string(key)]; ok {
+		return warm.LastAccess, true
+	}
+	return time.Time{}, false
+}
+
 func (hi *HybridIndex) removeFromHot(key string) bool {
 	hi.hotMu.Lock()
 	defer hi.hotMu.Unlock()
@@ -444,7 +617,7 @@ func (hi *HybridIndex) addToHot(key string, pos *storage.Position) {
 	// 检查容量
 	if hi.hotTree.Size() >= hi.options.HotCapacity {
 		// 需要降级一个条目到温层
-		hi.demoteOneFromHot()
+		hi.demoteOneFromHotLocked()
 	}
 
 	entry := &HotEntry{
@@ -517,7 +690,7 @@ func (hi *HybridIndex) addToWarm(key []byte, pos *storage.Position) {
 	// 检查容量
 	if hi.warmTree.Size() >= hi.options.WarmCapacity {
 		// 温层已满，删除最旧的条目
-		hi.demoteOneFromWarm()
+		hi.demoteOneFromWarmLocked()
 	}
 
 	keyStr := string(key)
@@ -532,54 +705,208 @@ func (hi *HybridIndex) addToWarm(key []byte, pos *storage.Position) {
 }
 
 // ==================== 冷层操作 ====================
-
-func (hi *HybridIndex) addToCold(key []byte, pos *storage.Position) {
+//
+// 启用冷层文件后，查询先查内存中的 sparseIndex，再查磁盘；判断 key 是否已存在同样需要查询磁盘。
+// 读取冷层文件失败时按 key 不存在处理。
+
+// addToCold 将 key 插入冷层，保持稀疏索引有序
+// 返回：
+//   - bool: 是否为新插入的 key（已存在时只更新位置）
+func (hi *HybridIndex) addToCold(key []byte, pos *storage.Position) bool {
 	hi.sparseIndexMu.Lock()
 	defer hi.sparseIndexMu.Unlock()
 
 	entry := SparseIndexEntry{
 		Key:    key,
 		FileID: pos.FileID,
+		Size:   pos.Size,
 		Offset: pos.Offset,
 	}
 
-	// 使用二分查找插入保持有序
-	hi.sparseIndex = append(hi.sparseIndex, entry)
-	// 简单排序（实际生产应该用插入排序或保持有序）
-	// 这里省略排序逻辑，假设插入是有序的
+	// 二分查找插入位置，保持有序以便 getFromCold 使用二分查找
+	idx := hi.binarySearch(key)
+	if idx < len(hi.sparseIndex) && compareKeys(hi.sparseIndex[idx].Key, key) == 0 {
+		hi.sparseIndex[idx] = entry
+		return false
+	}
+	hi.sparseIndex = append(hi.sparseIndex, SparseIndexEntry{})
+	copy(hi.sparseIndex[idx+1:], hi.sparseIndex[idx:])
+	hi.sparseIndex[idx] = entry
+	hi.sparseKeyBytes += int64(len(key))
+
+	// 磁盘上已有该 key 时内存中的记录只是更新了位置
+	if hi.coldTable != nil {
+		if _, deleted := hi.coldDeleted[string(key)]; deleted {
+			// 磁盘上的记录已被删除，由内存中的新记录遮蔽
+			delete(hi.coldDeleted, string(key))
+		} else if _, found, _ := hi.coldTable.get(key); found {
+			return false
+		}
+	}
+	hi.coldKeys++
+	hi.coldKeyBytes += int64(len(key))
+	return true
 }
 
 func (hi *HybridIndex) getFromCold(key []byte) *storage.Position {
 	hi.sparseIndexMu.RLock()
 	defer hi.sparseIndexMu.RUnlock()
 
-	// 二分查找
-	idx := hi.binarySearch(key)
-	if idx >= 0 && idx < len(hi.sparseIndex) {
-		entry := hi.sparseIndex[idx]
-		if string(entry.Key) == string(key) {
-			return &storage.Position{
-				FileID: entry.FileID,
-				Offset: entry.Offset,
-				Size:   0, // Cold 层不记录 size，需要从数据文件读取
-			}
-		}
+	entry, found := hi.sparseLookupLocked(key)
+	if !found {
+		entry, found = hi.diskLookupLocked(key)
+	}
+	if !found {
+		return nil
+	}
+	return &storage.Position{
+		FileID: entry.FileID,
+		Offset: entry.Offset,
+		Size:   entry.Size,
 	}
-	return nil
 }
 
 func (hi *HybridIndex) removeFromCold(key []byte) bool {
 	hi.sparseIndexMu.Lock()
 	defer hi.sparseIndexMu.Unlock()
 
+	removed := false
 	idx := hi.binarySearch(key)
 	if idx >= 0 && idx < len(hi.sparseIndex) {
 		if string(hi.sparseIndex[idx].Key) == string(key) {
+			hi.sparseKeyBytes -= int64(len(key))
 			hi.sparseIndex = append(hi.sparseIndex[:idx], hi.sparseIndex[idx+1:]...)
+			removed = true
+		}
+	}
+	if _, found := hi.diskLookupLocked(key); found {
+		hi.coldDeleted[string(key)] = struct{}{}
+		removed = true
+	}
+
+	if removed {
+		hi.coldKeys--
+		hi.coldKeyBytes -= int64(len(key))
+	}
+	return removed
+}
+
+// sparseLookupLocked 在内存中的稀疏索引里查找 key，调用方必须持有 sparseIndexMu
+func (hi *HybridIndex) sparseLookupLocked(key []byte) (SparseIndexEntry, bool) {
+	idx := hi.binarySearch(key)
+	if idx >= 0 && idx < len(hi.sparseIndex) && string(hi.sparseIndex[idx].Key) == string(key) {
+		return hi.sparseIndex[idx], true
+	}
+	return SparseIndexEntry{}, false
+}
+
+// diskLookupLocked 在冷层文件中查找未被删除的 key，调用方必须持有 sparseIndexMu
+func (hi *HybridIndex) diskLookupLocked(key []byte) (SparseIndexEntry, bool) {
+	if hi.coldTable == nil {
+		return SparseIndexEntry{}, false
+	}
+	if _, deleted := hi.coldDeleted[string(key)]; deleted {
+		return SparseIndexEntry{}, false
+	}
+	entry, found, err := hi.coldTable.get(key)
+	if err != nil {
+		return SparseIndexEntry{}, false
+	}
+	return entry, found
+}
+
+// forEachColdLocked 按 key 升序遍历冷层的全部 key（内存与磁盘合并，内存中的记录优先），fn 返回 false 时停止
+// 调用方必须持有 sparseIndexMu
+func (hi *HybridIndex) forEachColdLocked(fn func(entry SparseIndexEntry) bool) error {
+	i, stopped := 0, false
+	if hi.coldTable != nil {
+		err := hi.coldTable.forEach(func(disk SparseIndexEntry) bool {
+			// 先输出内存中更小的 key
+			for ; i < len(hi.sparseIndex) && compareKeys(hi.sparseIndex[i].Key, disk.Key) < 0; i++ {
+				if !fn(hi.sparseIndex[i]) {
+					stopped = true
+					return false
+				}
+			}
+			// 内存中有同一个 key 的新位置，留给下一轮输出
+			if i < len(hi.sparseIndex) && compareKeys(hi.sparseIndex[i].Key, disk.Key) == 0 {
+				return true
+			}
+			if _, deleted := hi.coldDeleted[string(disk.Key)]; deleted {
+				return true
+			}
+			if !fn(disk) {
+				stopped = true
+				return false
+			}
 			return true
+		})
+		if err != nil || stopped {
+			return err
 		}
 	}
-	return false
+	for ; i < len(hi.sparseIndex); i++ {
+		if !fn(hi.sparseIndex[i]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// FlushCold 将冷层在内存中的变更合并到冷层文件
+// 合并会重写整个文件，期间持有冷层的写锁，冷层的读写需要等待；未启用冷层文件时不做任何事
+// 返回：
+//   - error: 写入或重新打开文件失败时返回错误，此时内存中的变更保持不变
+func (hi *HybridIndex) FlushCold() error {
+	if hi.options.coldPath == "" {
+		return nil
+	}
+	hi.sparseIndexMu.Lock()
+	defer hi.sparseIndexMu.Unlock()
+	return hi.flushColdLocked()
+}
+
+// flushColdLocked 同 FlushCold，调用方必须持有 sparseIndexMu 的写锁
+func (hi *HybridIndex) flushColdLocked() error {
+	if hi.coldClosed {
+		return nil
+	}
+	if hi.coldTable != nil && len(hi.sparseIndex) == 0 && len(hi.coldDeleted) == 0 {
+		return nil
+	}
+
+	w, err := newColdTableWriter(hi.options.coldPath)
+	if err != nil {
+		return fmt.Errorf("创建冷层文件失败: %w", err)
+	}
+	var addErr error
+	err = hi.forEachColdLocked(func(entry SparseIndexEntry) bool {
+		addErr = w.add(entry)
+		return addErr == nil
+	})
+	if err == nil {
+		err = addErr
+	}
+	if err != nil {
+		w.abort()
+		return fmt.Errorf("写入冷层文件失败: %w", err)
+	}
+	if err := w.finish(); err != nil {
+		return fmt.Errorf("写入冷层文件失败: %w", err)
+	}
+
+	table, err := openColdTable(hi.options.coldPath)
+	if err != nil {
+		return err
+	}
+	if hi.coldTable != nil {
+		hi.coldTable.close()
+	}
+	hi.coldTable = table
+	hi.sparseIndex = make([]SparseIndexEntry, 0)
+	hi.sparseKeyBytes = 0
+	hi.coldDeleted = make(map[string]struct{})
+	return nil
 }
 
 // binarySearch 二分查找key在稀疏索引中的位置
@@ -640,7 +967,7 @@ func (hi *HybridIndex) promoteToHot(key string) {
 
 	if hi.hotTree.Size() >= hi.options.HotCapacity {
 		// 需要先降级一个
-		hi.demoteOneFromHot()
+		hi.demoteOneFromHotLocked()
 	}
 
 	// 从温层移除
@@ -657,23 +984,28 @@ func (hi *HybridIndex) promoteToHot(key string) {
 	}
 	hi.hotEntries[key].Frequency.Store(entry.Frequency.Load())
 	hi.hotTree.Insert(art.Key(key), entry.Position)
+	hi.promotionsToHot.Add(1)
 
 	// 重置统计
-	hi.stats.Delete(key)
+	hi.deleteStats(key)
 }
 
 // demoteOneFromHot 将热层中最不常用的一个 key 降级到温层
 func (hi *HybridIndex) demoteOneFromHot() {
 	hi.hotMu.Lock()
 	defer hi.hotMu.Unlock()
+	hi.demoteOneFromHotLocked()
+}
 
+// demoteOneFromHotLocked 同 demoteOneFromHot，调用方必须持有 hotMu
+func (hi *HybridIndex) demoteOneFromHotLocked() {
 	if hi.hotTree.Size() == 0 {
 		return
 	}
 
 	// 找到访问频率最低的条目
 	var minKey string
-	var minFreq int64 = ^int64(0) >> 1
+	var minFreq int64 = math.MaxInt64
 
 	for key, entry := range hi.hotEntries {
 		freq := entry.Frequency.Load()
@@ -702,6 +1034,7 @@ func (hi *HybridIndex) demoteOneFromHot() {
 		hi.warmEntries[minKey].Frequency.Store(minFreq)
 		hi.warmTree.Insert(art.Key(minKey), pos)
 		hi.warmMu.Unlock()
+		hi.demotionsToWarm.Add(1)
 	}
 }
 
@@ -709,7 +1042,11 @@ func (hi *HybridIndex) demoteOneFromHot() {
 func (hi *HybridIndex) demoteOneFromWarm() {
 	hi.warmMu.Lock()
 	defer hi.warmMu.Unlock()
+	hi.demoteOneFromWarmLocked()
+}
 
+// demoteOneFromWarmLocked 同 demoteOneFromWarm，调用方必须持有 warmMu
+func (hi *HybridIndex) demoteOneFromWarmLocked() {
 	if hi.warmTree.Size() == 0 {
 		return
 	}
@@ -735,23 +1072,27 @@ func (hi *HybridIndex) demoteOneFromWarm() {
 		hi.warmTree.Delete(art.Key(minKey))
 
 		// 添加到冷层
-		hi.sparseIndexMu.Lock()
-		hi.sparseIndex = append(hi.sparseIndex, SparseIndexEntry{
-			Key:    []byte(minKey),
-			FileID: pos.FileID,
-			Offset: pos.Offset,
-		})
-		hi.sparseIndexMu.Unlock()
+		hi.addToCold([]byte(minKey), pos)
+		hi.demotionsToCold.Add(1)
 	}
 }
 
 // ==================== 统计操作 ====================
 
 func (hi *HybridIndex) incrementStats(key string) {
-	value, _ := hi.stats.LoadOrStore(key, new(atomic.Int64))
+	value, loaded := hi.stats.LoadOrStore(key, new(atomic.Int64))
+	if !loaded {
+		hi.statsKeys.Add(1)
+	}
 	value.(*atomic.Int64).Add(1)
 }
 
+func (hi *HybridIndex) deleteStats(key string) {
+	if _, loaded := hi.stats.LoadAndDelete(key); loaded {
+		hi.statsKeys.Add(-1)
+	}
+}
+
 func (hi *HybridIndex) getStats(key string) int64 {
 	value, found := hi.stats.Load(key)
 	if !found {
@@ -764,7 +1105,7 @@ func (hi *HybridIndex) getStats(key string) int64 {
 
 // backgroundWorker 后台 goroutine，定期执行维护任务
 func (hi *HybridIndex) backgroundWorker() {
-	ticker := time.NewTicker(time.Duration(hi.options.BackgroundInterval) * time.Millisecond)
+	ticker := time.NewTicker(time.Duration(hi.interval.Load()))
 	defer ticker.Stop()
 
 	for {
@@ -772,11 +1113,49 @@ func (hi *HybridIndex) backgroundWorker() {
 		case <-hi.stopCh:
 			return
 		case <-ticker.C:
-			hi.runMaintenance()
+			if hi.maintain() {
+				ticker.Reset(time.Duration(hi.interval.Load()))
+			}
 		}
 	}
 }
 
+// maintain 执行一次维护任务并检测是否滞后
+// 维护耗时连续 maintenanceLagRuns 次超过间隔时标记为滞后，任意一次按时完成即清除标记。
+// 启用 AutoAdjustInterval 时，判定滞后后将间隔加倍
+// 返回：
+//   - bool: 后台任务间隔是否被调整
+func (hi *HybridIndex) maintain() bool {
+	start := hi.options.clock()
+	hi.runMaintenance()
+	elapsed := hi.options.clock().Sub(start)
+	hi.maintenanceDuration.Store(int64(elapsed))
+
+	interval := time.Duration(hi.interval.Load())
+	if elapsed <= interval {
+		hi.maintenanceOverruns.Store(0)
+		hi.maintenanceLagging.Store(false)
+		return false
+	}
+
+	if hi.maintenanceOverruns.Add(1) < maintenanceLagRuns {
+		return false
+	}
+	hi.maintenanceLagging.Store(true)
+
+	if !hi.options.AutoAdjustInterval || interval >= maxBackgroundInterval {
+		return false
+	}
+	interval *= 2
+	if interval > maxBackgroundInterval {
+		interval = maxBackgroundInterval
+	}
+	hi.interval.Store(int64(interval))
+	// 重新计数，新的间隔仍跟不上时才会再次加倍
+	hi.maintenanceOverruns.Store(0)
+	return true
+}
+
 // runMaintenance 执行维护任务
 func (hi *HybridIndex) runMaintenance() {
 	// 1. 检查热层是否需要降级
@@ -799,6 +1178,15 @@ func (hi *HybridIndex) runMaintenance() {
 
 	// 3. 清理过期的统计信息
 	hi.cleanupStats()
+
+	// 4. 冷层在内存中的变更过多时合并到冷层文件
+	if hi.options.coldPath != "" {
+		hi.sparseIndexMu.Lock()
+		if len(hi.sparseIndex)+len(hi.coldDeleted) >= hi.options.ColdMemoryLimit {
+			hi.coldFlushErr = hi.flushColdLocked()
+		}
+		hi.sparseIndexMu.Unlock()
+	}
 }
 
 // cleanupStats 清理长时间未访问的 key 的统计信息
@@ -820,7 +1208,9 @@ func (hi *HybridIndex) GetStats() map[string]interface{} {
 	hi.warmMu.RUnlock()
 
 	hi.sparseIndexMu.RLock()
-	coldSize := len(hi.sparseIndex)
+	coldSize := int(hi.coldKeys)
+	coldPending := len(hi.sparseIndex) + len(hi.coldDeleted)
+	coldFlushErr := hi.coldFlushErr
 	hi.sparseIndexMu.RUnlock()
 
 	return map[string]interface{}{
@@ -828,13 +1218,117 @@ func (hi *HybridIndex) GetStats() map[string]interface{} {
 		"warm_size": warmSize,
 		"cold_size": coldSize,
 		"total":     hotSize + warmSize + coldSize,
+
+		"cold_pending":     coldPending,
+		"cold_flush_error": coldFlushErr,
+
+		"maintenance_lagging":  hi.maintenanceLagging.Load(),
+		"maintenance_duration": time.Duration(hi.maintenanceDuration.Load()),
+		"background_interval":  time.Duration(hi.interval.Load()),
+	}
+}
+
+// TierStats 混合索引各层的大小与层间迁移次数
+// 迁移次数为自索引创建以来的累计值，可据此计算迁移速率
+type TierStats struct {
+	HotKeys  int // 热层 key 数量
+	WarmKeys int // 温层 key 数量
+	ColdKeys int // 仅位于冷层（未被提升）的 key 数量
+
+	PromotionsToWarm int64 // 冷层 -> 温层
+	PromotionsToHot  int64 // 温层 -> 热层
+	DemotionsToWarm  int64 // 热层 -> 温层
+	DemotionsToCold  int64 // 温层 -> 冷层
+}
+
+// TierStats 返回各层的大小与层间迁移次数
+func (hi *HybridIndex) TierStats() TierStats {
+	hi.hotMu.RLock()
+	hotSize := hi.hotTree.Size()
+	hi.hotMu.RUnlock()
+
+	hi.warmMu.RLock()
+	warmSize := hi.warmTree.Size()
+	hi.warmMu.RUnlock()
+
+	// 被提升的 key 在冷层中仍保留一份，需要扣除
+	hi.sparseIndexMu.RLock()
+	coldSize := int(hi.coldKeys) - hotSize - warmSize
+	hi.sparseIndexMu.RUnlock()
+	if coldSize < 0 {
+		coldSize = 0
+	}
+
+	return TierStats{
+		HotKeys:          hotSize,
+		WarmKeys:         warmSize,
+		ColdKeys:         coldSize,
+		PromotionsToWarm: hi.promotionsToWarm.Load(),
+		PromotionsToHot:  hi.promotionsToHot.Load(),
+		DemotionsToWarm:  hi.demotionsToWarm.Load(),
+		DemotionsToCold:  hi.demotionsToCold.Load(),
 	}
 }
 
+// TierMemory 混合索引各层估算占用的内存字节数
+type TierMemory struct {
+	Hot  int64 // 热层：ART、条目 map 与条目结构体
+	Warm int64 // 温层：同热层
+	Cold int64 // 冷层：稀疏索引（未启用冷层文件时包含全部 key），启用后为未落盘的变更与块索引
+
+	Stats int64 // 访问频率统计，不属于任何一层
+}
+
+// TierMemory 估算各层占用的内存字节数
+// 热层、温层与访问频率统计中的 key 是冷层 key 的副本，其长度按冷层的平均 key 长度估算
+func (hi *HybridIndex) TierMemory() TierMemory {
+	hi.sparseIndexMu.RLock()
+	coldKeys := hi.coldKeys
+	coldKeyBytes := hi.coldKeyBytes
+	coldMemory := int64(cap(hi.sparseIndex))*sparseEntrySize + hi.sparseKeyBytes
+	if hi.coldTable != nil {
+		coldMemory += hi.coldTable.memory()
+	}
+	deletedKeys := int64(len(hi.coldDeleted))
+	hi.sparseIndexMu.RUnlock()
+
+	var avgKeySize int64
+	if coldKeys > 0 {
+		avgKeySize = coldKeyBytes / coldKeys
+	}
+	// 热层与温层中每个 key 同时存在于 ART 和条目 map 中，key 各占一份
+	perTierEntry := artEntryOverhead + mapEntryOverhead + tierEntrySize + positionSize + 2*avgKeySize
+
+	hi.hotMu.RLock()
+	hotKeys := int64(hi.hotTree.Size())
+	hi.hotMu.RUnlock()
+
+	hi.warmMu.RLock()
+	warmKeys := int64(hi.warmTree.Size())
+	hi.warmMu.RUnlock()
+
+	return TierMemory{
+		Hot:  hotKeys * perTierEntry,
+		Warm: warmKeys * perTierEntry,
+		Cold: coldMemory + deletedKeys*(mapEntryOverhead+avgKeySize),
+
+		Stats: hi.statsKeys.Load() * (syncMapEntryOverhead + avgKeySize),
+	}
+}
+
+// EstimatedMemory 估算混合索引占用的内存字节数，即各层之和
+func (hi *HybridIndex) EstimatedMemory() int64 {
+	mem := hi.TierMemory()
+	return mem.Hot + mem.Warm + mem.Cold + mem.Stats
+}
+
 // String 返回索引的字符串描述
 func (hi *HybridIndex) String() string {
+	hi.sparseIndexMu.RLock()
+	coldSize := hi.coldKeys
+	hi.sparseIndexMu.RUnlock()
 	return fmt.Sprintf("HybridIndex{Hot: %d, Warm: %d, Cold: %d}",
-		hi.hotTree.Size(), hi.warmTree.Size(), len(hi.sparseIndex))
+		hi.hotTree.Size(), hi.warmTree.Size(), coldSize)
 }
 
 // 确保 HybridIndex 实现了 Index 接口
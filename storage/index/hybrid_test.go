@@ -0,0 +1,99 @@
+package index
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 每次读取时前进 step，用于模拟耗时的维护任务
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func (c *fakeClock) setStep(step time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.step = step
+}
+
+func TestHybridIndex_MaintenanceLag(t *testing.T) {
+	for _, autoAdjust := range []bool{false, true} {
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		// 间隔足够长，避免后台 goroutine 在测试期间触发维护
+		hi := NewHybridIndex(
+			WithBackgroundInterval(60*1000),
+			WithAutoAdjustInterval(autoAdjust),
+			func(o *HybridOptions) { o.clock = clock.Now },
+		)
+
+		// 每次维护耗时 2 分钟，超过 1 分钟的间隔
+		clock.setStep(2 * time.Minute)
+		for i := 0; i < maintenanceLagRuns-1; i++ {
+			hi.maintain()
+			if hi.GetStats()["maintenance_lagging"].(bool) {
+				t.Fatalf("autoAdjust=%v: 第 %d 次超时后不应判定为滞后", autoAdjust, i+1)
+			}
+		}
+		adjusted := hi.maintain()
+		stats := hi.GetStats()
+		if !stats["maintenance_lagging"].(bool) {
+			t.Fatalf("autoAdjust=%v: 连续 %d 次超时后应判定为滞后", autoAdjust, maintenanceLagRuns)
+		}
+		if d := stats["maintenance_duration"].(time.Duration); d != 2*time.Minute {
+			t.Errorf("autoAdjust=%v: 维护耗时不匹配: %v", autoAdjust, d)
+		}
+
+		// 1 分钟的间隔已达到上限，不会继续加倍
+		if adjusted || stats["background_interval"].(time.Duration) != time.Minute {
+			t.Errorf("autoAdjust=%v: 间隔已达上限，不应调整: %v", autoAdjust, stats["background_interval"])
+		}
+
+		// 按时完成一次后清除滞后标记
+		clock.setStep(time.Second)
+		hi.maintain()
+		if hi.GetStats()["maintenance_lagging"].(bool) {
+			t.Errorf("autoAdjust=%v: 按时完成后应清除滞后标记", autoAdjust)
+		}
+		hi.Close()
+	}
+}
+
+func TestHybridIndex_MaintenanceAutoAdjust(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0), step: 3 * time.Second}
+	hi := NewHybridIndex(
+		WithBackgroundInterval(1000),
+		WithAutoAdjustInterval(true),
+		func(o *HybridOptions) { o.clock = clock.Now },
+	)
+	defer hi.Close()
+
+	// 间隔 1s、每次耗时 3s：连续滞后后加倍到 2s，再次连续滞后后加倍到 4s
+	want := []time.Duration{2 * time.Second, 4 * time.Second}
+	for _, interval := range want {
+		adjusted := false
+		for i := 0; i < maintenanceLagRuns; i++ {
+			adjusted = hi.maintain()
+		}
+		if !adjusted {
+			t.Fatalf("连续滞后后应调整间隔")
+		}
+		if got := hi.GetStats()["background_interval"].(time.Duration); got != interval {
+			t.Fatalf("间隔不匹配: got %v, want %v", got, interval)
+		}
+	}
+
+	// 4s 的间隔已能跟上
+	if hi.maintain() || hi.GetStats()["maintenance_lagging"].(bool) {
+		t.Errorf("间隔足够后不应再滞后或调整")
+	}
+}
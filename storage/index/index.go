@@ -47,6 +47,14 @@ type Index interface {
 	//   - IndexIterator: 迭代器
 	Seek(key []byte) IndexIterator
 
+	// EstimatedMemory 估算索引占用的内存字节数
+	// 基于 key 数量、key 总长度与各数据结构的固定开销近似计算，用于容量规划
+	EstimatedMemory() int64
+
+	// KeyHistogram 将键空间按 key 的首字节均分为 buckets 个区间，统计每个区间的 key 数量与总长度
+	// buckets 限制在 [1, 256] 之内，需要遍历全部 key
+	KeyHistogram(buckets int) []storage.BucketStat
+
 	// Close 关闭索引，释放资源
 	Close()
 }
@@ -2,16 +2,23 @@ package index
 
 import (
 	"sort"
+	"sync"
 
 	"github.com/forever-free1/TideKV/storage"
 )
 
 // MapIndex 是基于 Go 内置 map 的内存索引实现
 // 这是一个后备实现，当 ART 库不可用时使用
+// Put/Delete 与 Get/Seek 之间的互斥由调用方负责（DB 的读写锁），
+// 但多个读者可以同时调用 Seek，因此排序列表由 mu 单独保护
 type MapIndex struct {
-	data    map[string]*storage.Position
-	sorted  []string // 排序后的 keys
-	dirty   bool     // 是否有未排序的修改
+	data map[string]*storage.Position
+
+	mu     sync.Mutex
+	sorted []string // 排序后的 keys，重建时整体替换，迭代器持有的旧列表不会被修改
+	dirty  bool     // 是否有未排序的修改
+
+	keyBytes int64 // 所有 key 的总长度，用于内存估算
 }
 
 // NewMapIndex 创建一个新的 Map 索引实例
@@ -36,8 +43,12 @@ func bytesToString(b []byte) string {
 //   - key: 键
 //   - pos: 位置指针
 func (idx *MapIndex) Put(key []byte, pos *storage.Position) {
-	idx.data[bytesToString(key)] = pos
-	idx.dirty = true
+	keyStr := bytesToString(key)
+	if _, exists := idx.data[keyStr]; !exists {
+		idx.keyBytes += int64(len(key))
+	}
+	idx.data[keyStr] = pos
+	idx.markDirty()
 }
 
 // Get 根据键从 Map 索引获取位置
@@ -59,7 +70,8 @@ func (idx *MapIndex) Delete(key []byte) bool {
 	_, exists := idx.data[keyStr]
 	if exists {
 		delete(idx.data, keyStr)
-		idx.dirty = true
+		idx.keyBytes -= int64(len(key))
+		idx.markDirty()
 		return true
 	}
 	return false
@@ -72,29 +84,54 @@ func (idx *MapIndex) Size() int {
 	return len(idx.data)
 }
 
+// EstimatedMemory 估算 Map 索引占用的内存字节数
+// 包括 map 条目、Position、key 本身以及排序 key 列表（与 map 共享 key 的底层数据）
+func (idx *MapIndex) EstimatedMemory() int64 {
+	idx.mu.Lock()
+	sortedCap := int64(cap(idx.sorted))
+	idx.mu.Unlock()
+
+	n := int64(len(idx.data))
+	return n*(mapEntryOverhead+positionSize) + idx.keyBytes + sortedCap*stringHeaderSize
+}
+
 // Seek 查找第一个大于等于 key 的键，返回迭代器
+// 迭代器遍历的是调用时的排序列表，之后的 Put/Delete 不会改变遍历的 key 集合
 func (idx *MapIndex) Seek(key []byte) IndexIterator {
+	idx.mu.Lock()
 	// 确保排序列表是最新的
 	if idx.dirty {
 		idx.rebuildSorted()
 	}
+	sorted := idx.sorted
+	idx.mu.Unlock()
 
 	keyStr := bytesToString(key)
-	pos := sort.SearchStrings(idx.sorted, keyStr)
+	pos := sort.SearchStrings(sorted, keyStr)
 
 	return &MapIterator{
-		index: idx,
-		pos:   pos,
+		index:  idx,
+		sorted: sorted,
+		pos:    pos,
 	}
 }
 
+// markDirty 标记排序列表需要重建
+func (idx *MapIndex) markDirty() {
+	idx.mu.Lock()
+	idx.dirty = true
+	idx.mu.Unlock()
+}
+
 // rebuildSorted 重建排序列表
+// 调用方必须持有 mu
 func (idx *MapIndex) rebuildSorted() {
-	idx.sorted = make([]string, 0, len(idx.data))
+	sorted := make([]string, 0, len(idx.data))
 	for k := range idx.data {
-		idx.sorted = append(idx.sorted, k)
+		sorted = append(sorted, k)
 	}
-	sort.Strings(idx.sorted)
+	sort.Strings(sorted)
+	idx.sorted = sorted
 	idx.dirty = false
 }
 
@@ -102,45 +139,48 @@ func (idx *MapIndex) rebuildSorted() {
 func (idx *MapIndex) Close() {
 	// 清空 map，释放内存
 	idx.data = nil
+	idx.mu.Lock()
 	idx.sorted = nil
+	idx.mu.Unlock()
 }
 
 // MapIterator 是 Map 索引的迭代器实现
 type MapIterator struct {
-	index *MapIndex
-	pos   int
+	index  *MapIndex
+	sorted []string // Seek 时的排序列表
+	pos    int
 }
 
 // Next 移动到下一个键
 func (it *MapIterator) Next() {
-	if it.index == nil || it.index.sorted == nil {
+	if it.index == nil {
 		return
 	}
-	if it.pos < len(it.index.sorted) {
+	if it.pos < len(it.sorted) {
 		it.pos++
 	}
 }
 
 // Key 返回当前键
 func (it *MapIterator) Key() []byte {
-	if it.index == nil || it.index.sorted == nil {
+	if it.index == nil {
 		return nil
 	}
-	if it.pos < 0 || it.pos >= len(it.index.sorted) {
+	if it.pos < 0 || it.pos >= len(it.sorted) {
 		return nil
 	}
-	return []byte(it.index.sorted[it.pos])
+	return []byte(it.sorted[it.pos])
 }
 
 // Value 返回当前位置
 func (it *MapIterator) Value() *storage.Position {
-	if it.index == nil || it.index.sorted == nil {
+	if it.index == nil {
 		return nil
 	}
-	if it.pos < 0 || it.pos >= len(it.index.sorted) {
+	if it.pos < 0 || it.pos >= len(it.sorted) {
 		return nil
 	}
-	return it.index.data[it.index.sorted[it.pos]]
+	return it.index.data[it.sorted[it.pos]]
 }
 
 // Error 返回错误
@@ -0,0 +1,40 @@
+package index
+
+// ==================== 内存估算 ====================
+//
+// 以下常量是 64 位平台上各数据结构每个 key 的近似开销（不含 key 本身），
+// 按 Go 运行时与所用库的内存布局估算，只用于容量规划，不追求精确。
+
+const (
+	// positionSize storage.Position 结构体及指向它的指针
+	positionSize = 24 + 8
+
+	// mapEntryOverhead Go map 中每个 string key 的桶开销（string 头、值指针、tophash，按装载因子摊销）
+	mapEntryOverhead = 48
+
+	// artEntryOverhead ART 中每个 key 的叶子节点与摊销后的内部节点开销
+	artEntryOverhead = 96
+
+	// sparseEntrySize 冷层稀疏索引条目（切片头、FileID、Size、Offset）
+	sparseEntrySize = 40
+
+	// coldBlockEntrySize 冷层文件块索引项（最小 key 的切片头、偏移量、长度、CRC）
+	coldBlockEntrySize = 40
+
+	// tierEntrySize 热层 / 温层条目结构体（位置指针、访问频率、访问时间）
+	tierEntrySize = 40
+
+	// syncMapEntryOverhead sync.Map 中每个 key 的开销（内部 map 条目、entry、接口值与 *atomic.Int64）
+	syncMapEntryOverhead = 128
+
+	// stringHeaderSize 排序 key 列表中每个 string 头的大小
+	stringHeaderSize = 16
+
+	// bloomOverhead 布隆过滤器结构体与位图切片头的固定开销
+	bloomOverhead = 64
+)
+
+// EstimatedMemory 估算布隆过滤器占用的内存字节数：位图 Cap()/8 加固定开销
+func (bf *BloomFilter) EstimatedMemory() int64 {
+	return int64(bf.Cap()/8) + bloomOverhead
+}
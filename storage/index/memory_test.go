@@ -0,0 +1,84 @@
+package index
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/forever-free1/TideKV/storage"
+)
+
+// heapAlloc 返回 GC 后堆上仍在使用的字节数
+func heapAlloc() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+func fillIndex(idx Index, from, to int) {
+	for i := from; i < to; i++ {
+		idx.Put([]byte(fmt.Sprintf("user/%08d", i)), &storage.Position{FileID: 1, Offset: int64(i)})
+	}
+}
+
+func TestIndex_EstimatedMemory(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func() Index
+	}{
+		{"map", func() Index { return NewMapIndex() }},
+		{"art", func() Index { return NewARTIndex() }},
+		{"hybrid", func() Index { return NewHybridIndex(WithBackgroundInterval(60 * 1000)) }},
+	}
+
+	const small, large = 1000, 20000
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := heapAlloc()
+			idx := tt.new()
+			defer idx.Close()
+
+			fillIndex(idx, 0, small)
+			smallEstimate := idx.EstimatedMemory()
+			fillIndex(idx, small, large)
+			largeEstimate := idx.EstimatedMemory()
+			// MapIndex 在 Seek 时才构建排序列表，一并计入实际分配
+			idx.Seek(nil).Close()
+			largeEstimate = idx.EstimatedMemory()
+
+			actual := int64(heapAlloc() - before)
+			runtime.KeepAlive(idx)
+
+			if smallEstimate <= 0 || largeEstimate <= smallEstimate {
+				t.Fatalf("估算值应随 key 数量增长: %d keys=%d, %d keys=%d", small, smallEstimate, large, largeEstimate)
+			}
+			// 估算值只是近似，要求与实际分配在同一数量级
+			if largeEstimate < actual/3 || largeEstimate > actual*3 {
+				t.Fatalf("估算值偏离实际分配过大: estimate=%d, actual=%d", largeEstimate, actual)
+			}
+
+			// 删除后估算值回落（切片容量不会收缩，因此只要求低于删除前）
+			for i := 0; i < large; i++ {
+				idx.Delete([]byte(fmt.Sprintf("user/%08d", i)))
+			}
+			idx.Seek(nil).Close()
+			if after := idx.EstimatedMemory(); after >= largeEstimate {
+				t.Fatalf("删除全部 key 后估算值应回落: got %d, 删除前为 %d", after, largeEstimate)
+			}
+		})
+	}
+}
+
+func TestBloomFilter_EstimatedMemory(t *testing.T) {
+	small := NewBloomFilter(1000, 0.01)
+	large := NewBloomFilter(100000, 0.01)
+
+	if got, want := small.EstimatedMemory(), int64(small.Cap()/8); got < want {
+		t.Fatalf("估算值小于位图大小: got %d, want >= %d", got, want)
+	}
+	if large.EstimatedMemory() <= small.EstimatedMemory() {
+		t.Fatalf("估算值应随容量增长: small=%d, large=%d", small.EstimatedMemory(), large.EstimatedMemory())
+	}
+}
@@ -1,10 +1,13 @@
 package watch
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/plar/go-adaptive-radix-tree"
 )
@@ -21,10 +24,104 @@ const (
 
 // Event 表示键值变更事件
 type Event struct {
-	Type      EventType `json:"type"`       // 事件类型：put 或 delete
-	Key       string    `json:"key"`        // 变更的键
-	Value     string    `json:"value,omitempty"` // 变更的值（仅 put 事件有值）
+	Type      EventType `json:"type"`                 // 事件类型：put 或 delete
+	Key       string    `json:"key"`                  // 变更的键
+	Value     string    `json:"value,omitempty"`      // 变更的值（仅 put 事件有值）
 	PrevValue string    `json:"prev_value,omitempty"` // 变更前的值
+	Encoding  string    `json:"encoding,omitempty"`   // Key / Value / PrevValue 的编码方式，为空表示原始字符串
+	Seq       uint64    `json:"seq,omitempty"`        // 产生该事件的 Raft 日志索引，在所有节点上相同；同一批量命令的事件共享 Seq
+	Version   int       `json:"version,omitempty"`    // 序列化格式的版本，见 ForVersion；v1 不带该字段
+}
+
+// 事件序列化格式的版本
+// 客户端按版本协商事件的形状，新增字段只出现在新版本中，旧客户端不受影响
+const (
+	// EventVersion1 最初的格式：type、key、value、prev_value，以及按需出现的 encoding
+	EventVersion1 = 1
+	// EventVersion2 增加 seq 与 version 字段
+	EventVersion2 = 2
+	// EventVersionLatest 客户端未指定版本时使用的版本
+	EventVersionLatest = EventVersion2
+)
+
+// ParseEventVersion 解析客户端请求的事件格式版本
+// 参数：
+//   - s: 版本号，例如 "1"、"v2"，为空时返回 EventVersionLatest
+//
+// 返回：
+//   - int: 版本号
+//   - error: 不是受支持的版本时返回错误
+func ParseEventVersion(s string) (int, error) {
+	if s == "" {
+		return EventVersionLatest, nil
+	}
+	switch strings.TrimPrefix(strings.ToLower(s), "v") {
+	case "1":
+		return EventVersion1, nil
+	case "2":
+		return EventVersion2, nil
+	}
+	return 0, fmt.Errorf("不支持的事件格式版本: %q", s)
+}
+
+// ForVersion 返回按指定格式版本序列化的副本：去掉该版本之后新增的字段，并标记版本号
+// Encoding 只在客户端显式要求 base64 时出现，所有版本都保留
+func (e *Event) ForVersion(version int) *Event {
+	out := *e
+	switch version {
+	case EventVersion1:
+		out.Seq = 0
+		out.Version = 0
+	default:
+		out.Version = version
+	}
+	return &out
+}
+
+// EncodingBase64 表示 Key / Value / PrevValue 经过标准 base64 编码
+// JSON 字符串只能承载合法的 UTF-8，二进制的 key 或 value 需要编码后才能无损传输
+const EncodingBase64 = "base64"
+
+// EncodeBase64 返回 Key / Value / PrevValue 经 base64 编码的副本
+func (e *Event) EncodeBase64() *Event {
+	if e.Encoding == EncodingBase64 {
+		return e
+	}
+	return &Event{
+		Type:      e.Type,
+		Key:       base64.StdEncoding.EncodeToString([]byte(e.Key)),
+		Value:     base64.StdEncoding.EncodeToString([]byte(e.Value)),
+		PrevValue: base64.StdEncoding.EncodeToString([]byte(e.PrevValue)),
+		Encoding:  EncodingBase64,
+		Seq:       e.Seq,
+		Version:   e.Version,
+	}
+}
+
+// DecodeBase64 返回还原为原始字节的副本，未编码的事件原样返回
+// 返回：
+//   - *Event: 解码后的事件
+//   - error: 任一字段不是合法的 base64 时返回错误
+func (e *Event) DecodeBase64() (*Event, error) {
+	if e.Encoding != EncodingBase64 {
+		return e, nil
+	}
+	decoded := &Event{Type: e.Type, Seq: e.Seq, Version: e.Version}
+	for _, field := range []struct {
+		src string
+		dst *string
+	}{
+		{e.Key, &decoded.Key},
+		{e.Value, &decoded.Value},
+		{e.PrevValue, &decoded.PrevValue},
+	} {
+		raw, err := base64.StdEncoding.DecodeString(field.src)
+		if err != nil {
+			return nil, fmt.Errorf("解码事件失败: %w", err)
+		}
+		*field.dst = string(raw)
+	}
+	return decoded, nil
 }
 
 // ==================== Watcher 定义 ====================
@@ -40,8 +137,36 @@ type Watcher struct {
 	// 如果为空字符串，表示关注所有键
 	Prefix string
 
+	// 发送超时：channel 已满时最多等待多久
+	// 为 0 表示非阻塞发送，channel 满时立即丢弃事件
+	SendTimeout time.Duration
+
+	// 因 channel 已满而被丢弃的事件数量
+	dropped atomic.Int64
+
+	// 连续发送超时达到 maxSendTimeouts 时关闭 Watcher，为 0 表示不关闭，见 WithMaxSendTimeouts
+	// sendTimeouts 为当前连续超时的次数，发送成功时清零
+	maxSendTimeouts int64
+	sendTimeouts    atomic.Int64
+
+	// 最多推送的事件数量，为 0 表示不限制
+	// remaining 为尚未占用的名额，delivered 为已推送的数量，达到 maxEvents 后自动关闭
+	maxEvents int64
+	remaining atomic.Int64
+	delivered atomic.Int64
+
+	// 保护 closed；发送不持有该锁，而是登记在 sending 中，Close 等待登记的发送结束后才关闭 channel
+	mu      sync.RWMutex
+	sending sync.WaitGroup
+
 	// 是否已关闭
 	closed bool
+
+	// Close 时关闭，让等待 SendTimeout 的发送立即放弃
+	done chan struct{}
+
+	// 事件过滤条件，为 nil 表示推送所有前缀匹配的事件，见 WithPredicate
+	predicate EventPredicate
 }
 
 // NewWatcher 创建新的 Watcher
@@ -56,25 +181,155 @@ func NewWatcher(prefix string, bufferSize int) *Watcher {
 	return &Watcher{
 		Ch:     make(chan *Event, bufferSize),
 		Prefix: prefix,
+		done:   make(chan struct{}),
 	}
 }
 
-// IsMatch 检查事件是否匹配该 Watcher 的前缀
+// IsMatch 检查事件是否匹配该 Watcher 的前缀与过滤条件
 func (w *Watcher) IsMatch(event *Event) bool {
-	// 如果前缀为空，表示匹配所有
-	if w.Prefix == "" {
+	// 检查事件的 key 是否以指定前缀开头，前缀为空表示匹配所有
+	if w.Prefix != "" && !strings.HasPrefix(event.Key, w.Prefix) {
+		return false
+	}
+	if w.predicate == nil {
 		return true
 	}
-	// 检查事件的 key 是否以指定前缀开头
-	return strings.HasPrefix(event.Key, w.Prefix)
+	return w.matchPredicate(event)
+}
+
+// matchPredicate 调用过滤条件，过滤条件 panic 时视为不匹配
+// 过滤条件在分发事件的 goroutine 中调用，panic 不能让整个进程退出
+func (w *Watcher) matchPredicate(event *Event) (matched bool) {
+	defer func() {
+		if recover() != nil {
+			matched = false
+		}
+	}()
+	return w.predicate(event)
 }
 
 // Close 关闭 Watcher
+// 正在等待 SendTimeout 的发送会立即放弃，因此 Close 不会被慢消费者阻塞
 func (w *Watcher) Close() {
-	if !w.closed {
-		close(w.Ch)
-		w.closed = true
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
 	}
+	w.closed = true
+	close(w.done)
+	w.mu.Unlock()
+
+	// closed 已设置，之后不会再有新的发送登记；等待已登记的发送返回后再关闭 channel
+	w.sending.Wait()
+	close(w.Ch)
+}
+
+// IsClosed 返回 Watcher 是否已关闭
+func (w *Watcher) IsClosed() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.closed
+}
+
+// Dropped 返回因 channel 已满而被丢弃的事件数量
+func (w *Watcher) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// MaxEvents 返回最多推送的事件数量，为 0 表示不限制
+func (w *Watcher) MaxEvents() int64 {
+	return w.maxEvents
+}
+
+// send 向 Watcher 发送事件
+// 设置了 maxEvents 时，推送第 maxEvents 个事件后关闭 Watcher；
+// 被丢弃的事件不计入，其名额留给后续事件
+// 返回：
+//   - bool: 是否发送成功
+func (w *Watcher) send(event *Event) bool {
+	if w.maxEvents == 0 {
+		return w.deliver(event)
+	}
+
+	// 先占用名额，保证并发发送时推送的事件不超过 maxEvents
+	for {
+		n := w.remaining.Load()
+		if n <= 0 {
+			return false
+		}
+		if w.remaining.CompareAndSwap(n, n-1) {
+			break
+		}
+	}
+
+	if !w.deliver(event) {
+		w.remaining.Add(1)
+		return false
+	}
+	if w.delivered.Add(1) == w.maxEvents {
+		w.Close()
+	}
+	return true
+}
+
+// deliver 将事件写入 channel
+// channel 已满时最多等待 SendTimeout，超时后丢弃事件并计数；等待期间 Watcher 被关闭时立即放弃。
+// 连续超时达到 maxSendTimeouts 时关闭 Watcher，避免每个事件都为同一个慢消费者等待 SendTimeout
+// 返回：
+//   - bool: 是否发送成功
+func (w *Watcher) deliver(event *Event) bool {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return false
+	}
+	w.sending.Add(1)
+	w.mu.RUnlock()
+
+	sent, timedOut := w.trySend(event)
+	w.sending.Done()
+
+	switch {
+	case sent:
+		w.sendTimeouts.Store(0)
+	case timedOut && w.maxSendTimeouts > 0 && w.sendTimeouts.Add(1) >= w.maxSendTimeouts:
+		w.Close()
+	}
+	return sent
+}
+
+// trySend 向 channel 发送事件，不持有 w.mu
+// 返回：
+//   - bool: 是否发送成功
+//   - bool: 是否因等待 SendTimeout 超时而丢弃
+func (w *Watcher) trySend(event *Event) (bool, bool) {
+	// 先尝试非阻塞发送，绝大多数情况下 channel 有空位
+	select {
+	case w.Ch <- event:
+		return true, false
+	default:
+	}
+
+	if w.SendTimeout > 0 {
+		// channel 暂时已满，等待消费者在超时前腾出空位
+		timer := time.NewTimer(w.SendTimeout)
+		defer timer.Stop()
+		select {
+		case w.Ch <- event:
+			return true, false
+		case <-w.done:
+			return false, false
+		case <-timer.C:
+			// 消费者持续过慢，丢弃事件
+			w.dropped.Add(1)
+			return false, true
+		}
+	}
+
+	// 非阻塞发送，channel 已满时直接丢弃
+	w.dropped.Add(1)
+	return false, false
 }
 
 // ==================== WatchHub 定义 ====================
@@ -95,17 +350,77 @@ type WatchHub struct {
 
 	// 统计信息
 	watcherCount int64
+
+	// 新注册 Watcher 的默认发送超时
+	sendTimeout time.Duration
+
+	// 新注册 Watcher 连续发送超时多少次后关闭，见 WithMaxSendTimeouts
+	maxSendTimeouts int
+}
+
+// WatchOption 定义注册 Watcher 时的配置函数
+type WatchOption func(*Watcher)
+
+// WithMaxEvents 设置 Watcher 最多推送的事件数量
+// 推送第 n 个匹配事件后 Watcher 自动关闭并取消注册，此后的变更不再推送；n <= 0 表示不限制
+func WithMaxEvents(n int) WatchOption {
+	return func(w *Watcher) {
+		if n > 0 {
+			w.maxEvents = int64(n)
+			w.remaining.Store(int64(n))
+		}
+	}
+}
+
+// WithPredicate 设置事件过滤条件，只推送前缀匹配且 pred 返回 true 的事件
+// 未通过过滤的事件不占用 WithMaxEvents 的名额，也不计入 Dropped
+func WithPredicate(pred EventPredicate) WatchOption {
+	return func(w *Watcher) {
+		w.predicate = pred
+	}
+}
+
+// HubOption 定义 WatchHub 的配置函数
+type HubOption func(*WatchHub)
+
+// WithSendTimeout 设置 Watcher 的默认发送超时
+// channel 短暂已满时最多等待该时长，避免瞬时拥塞导致事件丢失
+func WithSendTimeout(timeout time.Duration) HubOption {
+	return func(h *WatchHub) {
+		h.sendTimeout = timeout
+	}
+}
+
+// DefaultMaxSendTimeouts Watcher 默认允许的连续发送超时次数
+const DefaultMaxSendTimeouts = 8
+
+// WithMaxSendTimeouts 设置 Watcher 连续发送超时多少次后自动关闭并取消注册
+// 只在设置了 SendTimeout 时生效：消费者长时间不读取时，每个事件都会等待 SendTimeout 后才被丢弃，
+// 连续 n 次超时后关闭 Watcher，消费者通过 channel 被关闭得知监听已结束。
+// 任意一次发送成功都会清零计数；默认为 DefaultMaxSendTimeouts，n <= 0 表示从不关闭
+func WithMaxSendTimeouts(n int) HubOption {
+	return func(h *WatchHub) {
+		h.maxSendTimeouts = n
+	}
 }
 
 // NewWatchHub 创建新的 WatchHub
 //
+// 参数：
+//   - opts: 配置选项
+//
 // 返回：
 //   - *WatchHub: WatchHub 实例
-func NewWatchHub() *WatchHub {
-	return &WatchHub{
-		watchers:    make([]*Watcher, 0),
-		prefixTree:  art.New(),
+func NewWatchHub(opts ...HubOption) *WatchHub {
+	h := &WatchHub{
+		watchers:        make([]*Watcher, 0),
+		prefixTree:      art.New(),
+		maxSendTimeouts: DefaultMaxSendTimeouts,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // ==================== Watcher 管理 ====================
@@ -116,11 +431,19 @@ func NewWatchHub() *WatchHub {
 // 参数：
 //   - prefix: 关注的前缀，为空表示关注所有键
 //   - bufferSize: 事件通道的缓冲区大小
+//   - opts: 配置选项，例如 WithMaxEvents
 //
 // 返回：
 //   - *Watcher: 注册的 Watcher 实例
-func (h *WatchHub) Watch(prefix string, bufferSize int) *Watcher {
+func (h *WatchHub) Watch(prefix string, bufferSize int, opts ...WatchOption) *Watcher {
 	watcher := NewWatcher(prefix, bufferSize)
+	watcher.SendTimeout = h.sendTimeout
+	if h.maxSendTimeouts > 0 {
+		watcher.maxSendTimeouts = int64(h.maxSendTimeouts)
+	}
+	for _, opt := range opts {
+		opt(watcher)
+	}
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -146,22 +469,96 @@ func (h *WatchHub) Watch(prefix string, bufferSize int) *Watcher {
 	return watcher
 }
 
+// WatchIf 注册一个带过滤条件的 Watcher，只推送前缀匹配且 pred 返回 true 的事件
+// pred 在 Notify 中调用，调用时不持有 hub 的锁，但会阻塞同一次 Notify 中后续 Watcher 的推送，
+// 因此应当快速返回，且不能修改事件
+//
+// 参数：
+//   - prefix: 关注的前缀，为空表示关注所有键
+//   - pred: 过滤条件，为 nil 时等价于 Watch
+//   - bufferSize: 事件通道的缓冲区大小
+//   - opts: 配置选项，例如 WithMaxEvents
+//
+// 返回：
+//   - *Watcher: 注册的 Watcher 实例
+func (h *WatchHub) WatchIf(prefix string, pred EventPredicate, bufferSize int, opts ...WatchOption) *Watcher {
+	return h.Watch(prefix, bufferSize, append(opts, WithPredicate(pred))...)
+}
+
 // Unregister 取消注册一个 Watcher
+// 对已取消注册（包括被 CloseMatching / CloseAll 关闭）的 Watcher 重复调用是安全的
 //
 // 参数：
 //   - watcher: 要取消注册的 Watcher
 func (h *WatchHub) Unregister(watcher *Watcher) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.unregisterLocked(watcher)
+}
 
+// CloseMatching 关闭并取消注册所有前缀位于 prefix 之下的 Watcher
+// 例如 prefix 为 "tenant-a/" 时，关注 "tenant-a/" 与 "tenant-a/orders/" 的 Watcher 都会被关闭，
+// 关注全部键（前缀为空）的 Watcher 只有在 prefix 为空时才会被关闭。
+// 被关闭 Watcher 的 channel 会被 close，消费者据此得知监听已结束
+//
+// 参数：
+//   - prefix: 前缀
+//
+// 返回：
+//   - int: 关闭的 Watcher 数量
+func (h *WatchHub) CloseMatching(prefix string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var matched []*Watcher
+	for _, watcher := range h.watchers {
+		if strings.HasPrefix(watcher.Prefix, prefix) {
+			matched = append(matched, watcher)
+		}
+	}
+	for _, watcher := range matched {
+		h.unregisterLocked(watcher)
+	}
+	return len(matched)
+}
+
+// CloseAll 关闭并取消注册所有 Watcher
+//
+// 返回：
+//   - int: 关闭的 Watcher 数量
+func (h *WatchHub) CloseAll() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := len(h.watchers)
+	for _, watcher := range h.watchers {
+		watcher.Close()
+	}
+	h.watchers = nil
+	h.prefixTree = art.New()
+	h.watcherCount = 0
+	return n
+}
+
+// unregisterLocked 从列表与前缀树中移除 Watcher 并关闭它
+// 调用方必须持有 h.mu 写锁
+func (h *WatchHub) unregisterLocked(watcher *Watcher) {
 	// 从 watchers 列表中移除
+	found := false
 	for i, w := range h.watchers {
 		if w == watcher {
 			h.watchers = append(h.watchers[:i], h.watchers[i+1:]...)
+			found = true
 			break
 		}
 	}
 
+	// 关闭 watcher
+	watcher.Close()
+	if !found {
+		return
+	}
+
 	// 如果有前缀，从前缀树中移除
 	if watcher.Prefix != "" {
 		val, found := h.prefixTree.Search(art.Key(watcher.Prefix))
@@ -181,9 +578,6 @@ func (h *WatchHub) Unregister(watcher *Watcher) {
 		}
 	}
 
-	// 关闭 watcher
-	watcher.Close()
-
 	// 更新统计
 	h.watcherCount--
 }
@@ -193,27 +587,28 @@ func (h *WatchHub) Unregister(watcher *Watcher) {
 // Notify 通知所有匹配的 Watcher 有键值变更
 // 这个方法会在 Raft Apply 成功后调用
 //
+// 发送可能因等待慢消费者而阻塞最多 SendTimeout，
+// 因此先在读锁内复制 watcher 列表，发送时不持有 hub 的锁，
+// 避免阻塞 Watch/Unregister 以及其他并发的 Notify
+//
 // 参数：
 //   - event: 变更事件
 func (h *WatchHub) Notify(event *Event) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	watchers := make([]*Watcher, len(h.watchers))
+	copy(watchers, h.watchers)
+	h.mu.RUnlock()
 
 	// 遍历所有 watcher，检查是否匹配
-	for _, watcher := range h.watchers {
-		// 跳过已关闭的 watcher
-		if watcher.closed {
-			continue
-		}
-
-		// 检查事件是否匹配该 watcher 的前缀
+	for _, watcher := range watchers {
+		// 检查事件是否匹配该 watcher 的前缀与过滤条件（不持有 hub 的锁）
 		if watcher.IsMatch(event) {
-			// 非阻塞发送，避免阻塞主流程
-			select {
-			case watcher.Ch <- event:
-			default:
-				// 如果 channel 已满，跳过这个 watcher
-				// 实际生产环境可以考虑记录警告日志
+			// 已关闭的 watcher 会在 send 中被跳过
+			watcher.send(event)
+
+			// 达到最大事件数或连续发送超时后自动关闭的 watcher 从 hub 中移除
+			if watcher.IsClosed() {
+				h.Unregister(watcher)
 			}
 		}
 	}
@@ -326,17 +721,9 @@ func (h *WatchHub) Count() int64 {
 	return h.watcherCount
 }
 
-// Close 关闭所有 watcher
+// Close 关闭所有 watcher，等价于 CloseAll
 func (h *WatchHub) Close() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	for _, watcher := range h.watchers {
-		watcher.Close()
-	}
-	h.watchers = nil
-	h.prefixTree = art.New()
-	h.watcherCount = 0
+	h.CloseAll()
 }
 
 // String 返回 WatchHub 的字符串描述
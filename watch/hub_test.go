@@ -0,0 +1,367 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchHub_SendTimeoutTransientSlowness(t *testing.T) {
+	hub := NewWatchHub(WithSendTimeout(500 * time.Millisecond))
+	watcher := hub.Watch("", 1)
+	defer hub.Unregister(watcher)
+
+	// 第一个事件填满缓冲区
+	hub.NotifyPut("k1", "v1")
+
+	// 消费者短暂停顿后开始读取
+	received := make(chan *Event, 2)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		for i := 0; i < 2; i++ {
+			received <- <-watcher.Ch
+		}
+	}()
+
+	// 第二个事件需要等待消费者腾出空位，不应被丢弃
+	hub.NotifyPut("k2", "v2")
+
+	for _, want := range []string{"k1", "k2"} {
+		select {
+		case event := <-received:
+			if event.Key != want {
+				t.Errorf("事件顺序不匹配: got %s, want %s", event.Key, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("等待事件 %s 超时", want)
+		}
+	}
+	if dropped := watcher.Dropped(); dropped != 0 {
+		t.Errorf("瞬时拥塞不应丢弃事件, 丢弃了 %d 个", dropped)
+	}
+}
+
+func TestWatchHub_SendTimeoutPersistentSlowness(t *testing.T) {
+	timeout := 20 * time.Millisecond
+	hub := NewWatchHub(WithSendTimeout(timeout))
+	watcher := hub.Watch("", 1)
+	defer hub.Unregister(watcher)
+
+	// 没有消费者：第一个事件进入缓冲区，之后的事件在超时后被丢弃
+	start := time.Now()
+	hub.NotifyPut("k1", "v1")
+	hub.NotifyPut("k2", "v2")
+	hub.NotifyPut("k3", "v3")
+	elapsed := time.Since(start)
+
+	if dropped := watcher.Dropped(); dropped != 2 {
+		t.Errorf("持续阻塞时应丢弃 2 个事件, 实际丢弃 %d 个", dropped)
+	}
+	if elapsed < 2*timeout {
+		t.Errorf("丢弃前应等待发送超时, 实际耗时 %v", elapsed)
+	}
+	if event := <-watcher.Ch; event.Key != "k1" {
+		t.Errorf("缓冲区中的事件不匹配: got %s, want k1", event.Key)
+	}
+}
+
+func TestWatchHub_CloseDuringSendTimeout(t *testing.T) {
+	hub := NewWatchHub(WithSendTimeout(10 * time.Second))
+	watcher := hub.Watch("", 1)
+	hub.NotifyPut("k1", "v1")
+
+	// 第二个事件等待消费者腾出空位，此时关闭不应等到发送超时
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		hub.NotifyPut("k2", "v2")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	hub.Unregister(watcher)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("发送等待期间关闭不应被阻塞, 耗时 %v", elapsed)
+	}
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("关闭后等待中的发送应立即放弃")
+	}
+	if event := <-watcher.Ch; event == nil || event.Key != "k1" {
+		t.Errorf("缓冲区中的事件不匹配: %v", event)
+	}
+	if _, ok := <-watcher.Ch; ok {
+		t.Error("关闭后 channel 应被 close")
+	}
+	if dropped := watcher.Dropped(); dropped != 0 {
+		t.Errorf("因关闭放弃的事件不计入丢弃, 实际 %d", dropped)
+	}
+}
+
+func TestWatchHub_MaxSendTimeouts(t *testing.T) {
+	hub := NewWatchHub(WithSendTimeout(5*time.Millisecond), WithMaxSendTimeouts(3))
+	watcher := hub.Watch("", 1)
+
+	// 第一个事件进入缓冲区，之后连续超时两次，读取一个事件后发送成功，计数清零
+	hub.NotifyPut("k1", "v1")
+	hub.NotifyPut("k2", "v2")
+	hub.NotifyPut("k3", "v3")
+	<-watcher.Ch
+	hub.NotifyPut("k4", "v4")
+	hub.NotifyPut("k5", "v5")
+	hub.NotifyPut("k6", "v6")
+	if watcher.IsClosed() || hub.Count() != 1 {
+		t.Fatalf("发送成功应清零连续超时计数")
+	}
+
+	// 连续第三次超时后关闭并取消注册
+	hub.NotifyPut("k7", "v7")
+	if !watcher.IsClosed() || hub.Count() != 0 {
+		t.Fatalf("连续超时 3 次后应关闭并取消注册")
+	}
+	if dropped := watcher.Dropped(); dropped != 5 {
+		t.Errorf("丢弃计数不匹配: got %d, want 5", dropped)
+	}
+	if event := <-watcher.Ch; event.Key != "k4" {
+		t.Errorf("缓冲区中的事件不匹配: got %s, want k4", event.Key)
+	}
+	if _, ok := <-watcher.Ch; ok {
+		t.Error("关闭后 channel 应被 close")
+	}
+
+	// 未设置发送超时时从不因丢弃而关闭
+	hub = NewWatchHub(WithMaxSendTimeouts(1))
+	watcher = hub.Watch("", 1)
+	defer hub.Unregister(watcher)
+	for i := 0; i < 5; i++ {
+		hub.NotifyPut("k", "v")
+	}
+	if watcher.IsClosed() {
+		t.Error("非阻塞发送的丢弃不应关闭 Watcher")
+	}
+}
+
+func TestWatchHub_NonBlockingByDefault(t *testing.T) {
+	hub := NewWatchHub()
+	watcher := hub.Watch("", 1)
+	defer hub.Unregister(watcher)
+
+	start := time.Now()
+	hub.NotifyPut("k1", "v1")
+	hub.NotifyPut("k2", "v2")
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("默认配置下不应阻塞, 耗时 %v", elapsed)
+	}
+	if dropped := watcher.Dropped(); dropped != 1 {
+		t.Errorf("应立即丢弃 1 个事件, 实际丢弃 %d 个", dropped)
+	}
+}
+
+func TestWatchHub_NotifyAfterUnregister(t *testing.T) {
+	hub := NewWatchHub(WithSendTimeout(10 * time.Millisecond))
+	watcher := hub.Watch("a/", 1)
+	hub.Unregister(watcher)
+
+	// 向已关闭的 watcher 发送不能 panic
+	watcher.send(&Event{Type: EventPut, Key: "a/1"})
+	hub.NotifyPut("a/1", "v")
+
+	if !watcher.IsClosed() {
+		t.Error("Unregister 后 watcher 应已关闭")
+	}
+}
+
+func TestWatchHub_CloseMatching(t *testing.T) {
+	hub := NewWatchHub()
+	all := hub.Watch("", 10)
+	tenantA := hub.Watch("tenant-a/", 10)
+	tenantAOrders := hub.Watch("tenant-a/orders/", 10)
+	tenantAB := hub.Watch("tenant-ab/", 10)
+	tenantB := hub.Watch("tenant-b/", 10)
+
+	// 关闭过程中持续有事件通知，不能 panic
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				hub.NotifyPut("tenant-a/orders/1", "v")
+			}
+		}
+	}()
+
+	if n := hub.CloseMatching("tenant-a/"); n != 2 {
+		t.Errorf("关闭数量不匹配: got %d, want 2", n)
+	}
+	close(stop)
+	<-done
+
+	for _, w := range []*Watcher{tenantA, tenantAOrders} {
+		if !w.IsClosed() {
+			t.Errorf("%s 应已关闭", w.Prefix)
+		}
+		// 排空缓冲区后 channel 应处于关闭状态
+		for range w.Ch {
+		}
+	}
+	for _, w := range []*Watcher{all, tenantAB, tenantB} {
+		if w.IsClosed() {
+			t.Errorf("%q 不应被关闭", w.Prefix)
+		}
+	}
+	if count := hub.Count(); count != 3 {
+		t.Errorf("剩余 watcher 数量不匹配: got %d, want 3", count)
+	}
+
+	// 被关闭的 watcher 不再出现在前缀匹配结果中；重复 Unregister 不影响计数
+	if got := hub.FindWatchersByPrefix("tenant-a/orders/1"); len(got) != 1 || got[0] != all {
+		t.Errorf("前缀匹配结果不匹配: %v", got)
+	}
+	hub.Unregister(tenantA)
+	if count := hub.Count(); count != 3 {
+		t.Errorf("重复 Unregister 后数量不匹配: got %d, want 3", count)
+	}
+
+	if n := hub.CloseAll(); n != 3 {
+		t.Errorf("CloseAll 数量不匹配: got %d, want 3", n)
+	}
+	for _, w := range []*Watcher{all, tenantAB, tenantB} {
+		if !w.IsClosed() {
+			t.Errorf("%q 应已关闭", w.Prefix)
+		}
+	}
+	if count := hub.Count(); count != 0 {
+		t.Errorf("CloseAll 后数量不匹配: got %d, want 0", count)
+	}
+}
+
+func TestWatchHub_MaxEvents(t *testing.T) {
+	hub := NewWatchHub()
+	limited := hub.Watch("cfg/", 10, WithMaxEvents(3))
+	unlimited := hub.Watch("cfg/", 10)
+
+	// 不匹配前缀的事件不计入
+	hub.NotifyPut("other/x", "v")
+	for i := 1; i <= 5; i++ {
+		hub.NotifyPut(fmt.Sprintf("cfg/%d", i), "v")
+		if closed := limited.IsClosed(); closed != (i >= 3) {
+			t.Fatalf("第 %d 个事件后关闭状态不匹配: got %v", i, closed)
+		}
+	}
+
+	var keys []string
+	for event := range limited.Ch {
+		keys = append(keys, event.Key)
+	}
+	if want := []string{"cfg/1", "cfg/2", "cfg/3"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("推送的事件不匹配: got %v, want %v", keys, want)
+	}
+
+	if n := len(unlimited.Ch); n != 5 {
+		t.Errorf("未设置上限的 Watcher 应收到全部事件: got %d, want 5", n)
+	}
+	if n := hub.Count(); n != 1 {
+		t.Errorf("自动关闭的 Watcher 应被取消注册: got %d, want 1", n)
+	}
+}
+
+func TestWatchHub_MaxEventsConcurrent(t *testing.T) {
+	hub := NewWatchHub()
+	watcher := hub.Watch("", 100, WithMaxEvents(10))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				hub.NotifyPut(fmt.Sprintf("k-%d-%d", g, i), "v")
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	count := 0
+	for range watcher.Ch {
+		count++
+	}
+	if count != 10 {
+		t.Errorf("并发通知时推送的事件数不匹配: got %d, want 10", count)
+	}
+}
+
+func TestWatchHub_WatchIf(t *testing.T) {
+	hub := NewWatchHub()
+	failing := hub.WatchIf("job/", FieldEquals("status", "error"), 10, WithMaxEvents(2))
+	all := hub.Watch("job/", 10)
+
+	events := []struct {
+		key, value string
+	}{
+		{"job/1", `{"status":"running"}`},
+		{"job/2", `{"status":"error"}`},
+		{"job/3", `not json`},
+		{"other/1", `{"status":"error"}`},
+		{"job/4", `{"status":"error","retries":3}`},
+		{"job/5", `{"status":"error"}`},
+	}
+	for _, e := range events {
+		hub.NotifyPut(e.key, e.value)
+	}
+	hub.NotifyDelete("job/2", `{"status":"error"}`)
+
+	// 未通过过滤的事件不占用 limit 的名额
+	var keys []string
+	for event := range failing.Ch {
+		keys = append(keys, event.Key)
+	}
+	if want := []string{"job/2", "job/4"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("推送的事件不匹配: got %v, want %v", keys, want)
+	}
+	if n := len(all.Ch); n != 6 {
+		t.Errorf("未设置过滤条件的 Watcher 应收到全部事件: got %d, want 6", n)
+	}
+
+	// 过滤条件 panic 时视为不匹配，不影响其他 Watcher
+	panicking := hub.WatchIf("", func(event *Event) bool { panic("boom") }, 10)
+	hub.NotifyPut("job/6", "v")
+	if n := len(panicking.Ch); n != 0 {
+		t.Errorf("panic 的过滤条件不应推送事件: got %d", n)
+	}
+	if n := len(all.Ch); n != 7 {
+		t.Errorf("其他 Watcher 应正常收到事件: got %d, want 7", n)
+	}
+
+	matches := []struct {
+		pred  EventPredicate
+		value string
+		want  bool
+	}{
+		{FieldEquals("meta.state", "ok"), `{"meta":{"state":"ok"}}`, true},
+		{FieldEquals("meta.state", "ok"), `{"meta":"ok"}`, false},
+		{FieldEquals("n", "3"), `{"n":3}`, true},
+		{FieldEquals("n", "3"), `{"n":"3"}`, true},
+		{FieldEquals("flag", "true"), `{"flag":true}`, true},
+		{FieldEquals("flag", "false"), `{"flag":true}`, false},
+		{FieldEquals("gone", "null"), `{"gone":null}`, true},
+		{FieldEquals("list", "[]"), `{"list":[]}`, false},
+		{ValueContains("err"), `{"status":"error"}`, true},
+		{AllOf(ValueContains("err"), FieldEquals("status", "ok")), `{"status":"error"}`, false},
+	}
+	for i, m := range matches {
+		if got := m.pred(&Event{Type: EventPut, Value: m.value}); got != m.want {
+			t.Errorf("第 %d 个过滤条件结果不匹配: value %s, got %v, want %v", i, m.value, got, m.want)
+		}
+	}
+	if AllOf(nil, nil) != nil {
+		t.Errorf("没有过滤条件时 AllOf 应返回 nil")
+	}
+}
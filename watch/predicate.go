@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ==================== 事件过滤条件 ====================
+//
+// 过滤条件只检查事件的新值（Value），delete 事件没有新值，不会通过基于值的过滤。
+// 过滤在服务端进行，客户端只收到关心的事件，减少带宽与客户端的过滤开销。
+
+// EventPredicate 事件过滤条件，返回 true 表示推送该事件
+type EventPredicate func(event *Event) bool
+
+// ValueContains 返回 Value 包含 substr 的过滤条件
+func ValueContains(substr string) EventPredicate {
+	return func(event *Event) bool {
+		return event.Type == EventPut && strings.Contains(event.Value, substr)
+	}
+}
+
+// FieldEquals 返回 Value 为 JSON 对象且 path 处的字段等于 want 的过滤条件
+// path 以 "." 分隔逐层访问嵌套对象，例如 "status" 或 "meta.state"。
+// 字段为字符串时比较字符串本身，为数字、布尔值或 null 时比较其 JSON 文本（例如 "3"、"true"、"null"）；
+// 对象与数组不与任何值相等
+//
+// 参数：
+//   - path: 字段路径
+//   - want: 期望的值
+//
+// 返回：
+//   - EventPredicate: 过滤条件
+func FieldEquals(path, want string) EventPredicate {
+	fields := strings.Split(path, ".")
+	return func(event *Event) bool {
+		if event.Type != EventPut {
+			return false
+		}
+		value, ok := jsonField([]byte(event.Value), fields)
+		if !ok {
+			return false
+		}
+		switch v := value.(type) {
+		case string:
+			return v == want
+		case json.Number:
+			return v.String() == want
+		case bool:
+			return (v && want == "true") || (!v && want == "false")
+		case nil:
+			return want == "null"
+		}
+		return false
+	}
+}
+
+// AllOf 返回所有过滤条件都满足时才通过的过滤条件，忽略 nil；没有过滤条件时返回 nil
+func AllOf(preds ...EventPredicate) EventPredicate {
+	var list []EventPredicate
+	for _, pred := range preds {
+		if pred != nil {
+			list = append(list, pred)
+		}
+	}
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	return func(event *Event) bool {
+		for _, pred := range list {
+			if !pred(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// jsonField 解析 JSON 并按路径取出字段，数字保留为 json.Number
+func jsonField(data []byte, fields []string) (interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	for _, field := range fields {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}